@@ -0,0 +1,301 @@
+package activity
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"v/audit"
+	"v/logger"
+	"v/model"
+	"v/settings"
+)
+
+// 变更来源
+const (
+	SourceAudit    = "audit"
+	SourceSettings = "settings"
+	SourceXray     = "xray"
+	SourceAlert    = "alert"
+)
+
+const (
+	// maxRecent 内存中保留的设置变更和 xray 事件数量
+	maxRecent = 1000
+	// maxAlerts 每次查询读取的告警记录数量
+	maxAlerts = 500
+	// actorSystem 没有修改人的变更
+	actorSystem = "system"
+)
+
+// Entry 变更动态中的一条记录
+type Entry struct {
+	Source    string      `json:"source"`
+	Type      string      `json:"type"`
+	Actor     string      `json:"actor"`
+	Resource  string      `json:"resource,omitempty"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Relative  string      `json:"relative"` // 相对时间，如“5 分钟前”
+}
+
+// Query 查询条件，零值表示不限制
+type Query struct {
+	Sources  []string
+	Actor    string
+	Type     string
+	Since    time.Time
+	Until    time.Time
+	Page     int
+	PageSize int
+}
+
+// Page 分页结果
+type Page struct {
+	Entries    []Entry `json:"entries"`
+	Total      int     `json:"total"`
+	Page       int     `json:"page"`
+	PageSize   int     `json:"page_size"`
+	TotalPages int     `json:"total_pages"`
+}
+
+// Feed 合并审计事件、设置变更、xray 事件和告警状态变化的变更动态。
+// 审计和告警从各自的存储读取，设置变更和 xray 事件没有持久化，只保留在内存中
+type Feed struct {
+	log *logger.Logger
+	db  model.DB
+
+	mu      sync.Mutex
+	auditor *audit.Auditor
+	recent  []Entry
+}
+
+// New 创建变更动态
+func New(log *logger.Logger, db model.DB) *Feed {
+	return &Feed{
+		log: log,
+		db:  db,
+	}
+}
+
+// SetAuditor 设置审计事件来源，为 nil 时不包含审计事件
+func (f *Feed) SetAuditor(auditor *audit.Auditor) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auditor = auditor
+}
+
+// WatchSettings 记录之后的设置变更
+func (f *Feed) WatchSettings(mgr *settings.Manager) {
+	mgr.OnChange(func(prev, next *settings.Settings, actor string) {
+		sections := settings.ChangedSections(prev, next)
+		if len(sections) == 0 {
+			return
+		}
+		f.Record(Entry{
+			Source:    SourceSettings,
+			Type:      "update",
+			Actor:     actor,
+			Resource:  strings.Join(sections, ","),
+			Message:   fmt.Sprintf("修改了设置：%s", strings.Join(sections, "、")),
+			Details:   map[string]interface{}{"sections": sections},
+			Timestamp: time.Now(),
+		})
+	})
+}
+
+// RecordXray 记录 xray 事件，下载进度不记录
+func (f *Feed) RecordXray(typ, status, version, message string, details interface{}) {
+	if status == "progress" {
+		return
+	}
+	f.Record(Entry{
+		Source:    SourceXray,
+		Type:      typ + "_" + status,
+		Resource:  version,
+		Message:   message,
+		Details:   details,
+		Timestamp: time.Now(),
+	})
+}
+
+// Record 记录一条内存中的变更，超出数量时丢弃最旧的记录
+func (f *Feed) Record(entry Entry) {
+	if entry.Actor == "" {
+		entry.Actor = actorSystem
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recent = append(f.recent, entry)
+	if len(f.recent) > maxRecent {
+		f.recent = append([]Entry(nil), f.recent[len(f.recent)-maxRecent:]...)
+	}
+}
+
+// List 按时间倒序返回符合条件的变更，某个来源读取失败时跳过该来源
+func (f *Feed) List(q Query, now time.Time) *Page {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = 20
+	}
+
+	f.mu.Lock()
+	entries := append([]Entry(nil), f.recent...)
+	auditor := f.auditor
+	f.mu.Unlock()
+
+	if wants(q.Sources, SourceAudit) && auditor != nil {
+		entries = append(entries, f.auditEntries(auditor, q)...)
+	}
+	if wants(q.Sources, SourceAlert) && f.db != nil {
+		entries = append(entries, f.alertEntries()...)
+	}
+
+	matched := entries[:0]
+	for _, e := range entries {
+		if q.matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp.After(matched[j].Timestamp)
+	})
+
+	page := &Page{
+		Entries:    []Entry{},
+		Total:      len(matched),
+		Page:       q.Page,
+		PageSize:   q.PageSize,
+		TotalPages: (len(matched) + q.PageSize - 1) / q.PageSize,
+	}
+	start := (q.Page - 1) * q.PageSize
+	if start < len(matched) {
+		page.Entries = matched[start:min(len(matched), start+q.PageSize)]
+	}
+	for i := range page.Entries {
+		page.Entries[i].Relative = relativeTime(page.Entries[i].Timestamp, now)
+	}
+	return page
+}
+
+// auditEntries 读取审计事件
+func (f *Feed) auditEntries(auditor *audit.Auditor, q Query) []Entry {
+	events, err := auditor.Query(0, q.Since, q.Until)
+	if err != nil {
+		f.log.WarnWithFields("Failed to read audit events for activity feed", logger.Fields{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	entries := make([]Entry, 0, len(events))
+	for _, event := range events {
+		actor := actorSystem
+		if event.UserID != 0 {
+			actor = fmt.Sprintf("user:%d", event.UserID)
+		}
+		message := event.Action + " " + event.Resource
+		if event.Details != "" {
+			message += "：" + event.Details
+		}
+		entries = append(entries, Entry{
+			Source:    SourceAudit,
+			Type:      event.Action,
+			Actor:     actor,
+			Resource:  event.Resource,
+			Message:   message,
+			Details:   map[string]interface{}{"ip": event.IP},
+			Timestamp: event.Timestamp,
+		})
+	}
+	return entries
+}
+
+// alertEntries 读取最近的告警触发和恢复记录
+func (f *Feed) alertEntries() []Entry {
+	records, err := f.db.ListAlerts(1, maxAlerts)
+	if err != nil {
+		f.log.WarnWithFields("Failed to read alerts for activity feed", logger.Fields{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	entries := make([]Entry, 0, len(records))
+	for _, record := range records {
+		resource, state := record.Type, "triggered"
+		if strings.HasSuffix(resource, "_recovered") {
+			resource, state = strings.TrimSuffix(resource, "_recovered"), "recovered"
+		}
+		entries = append(entries, Entry{
+			Source:   SourceAlert,
+			Type:     state,
+			Actor:    actorSystem,
+			Resource: resource,
+			Message:  record.Message,
+			Details: map[string]interface{}{
+				"value":     record.Value,
+				"threshold": record.Threshold,
+			},
+			Timestamp: record.CreatedAt,
+		})
+	}
+	return entries
+}
+
+// matches 判断记录是否符合查询条件
+func (q Query) matches(e Entry) bool {
+	if !wants(q.Sources, e.Source) {
+		return false
+	}
+	if q.Actor != "" && e.Actor != q.Actor {
+		return false
+	}
+	if q.Type != "" && e.Type != q.Type {
+		return false
+	}
+	if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Timestamp.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// wants 判断是否查询该来源，未指定来源时查询全部
+func wants(sources []string, source string) bool {
+	if len(sources) == 0 {
+		return true
+	}
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeTime 返回相对于 now 的时间描述
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "刚刚"
+	case d < time.Hour:
+		return fmt.Sprintf("%d 分钟前", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d 小时前", int(d/time.Hour))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%d 天前", int(d/(24*time.Hour)))
+	default:
+		return t.Format("2006-01-02")
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"v/activity"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxActivityPageSize 变更动态每页最大条数
+const maxActivityPageSize = 100
+
+// ActivityHandler 管理员变更动态处理器
+type ActivityHandler struct {
+	feed *activity.Feed
+}
+
+// NewActivityHandler 创建变更动态处理器
+func NewActivityHandler(feed *activity.Feed) *ActivityHandler {
+	return &ActivityHandler{feed: feed}
+}
+
+// RegisterRoutes 注册路由
+func (h *ActivityHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/activity", h.List)
+}
+
+// List 分页获取最近的变更
+// 查询参数：source（audit、settings、xray、alert，逗号分隔）、actor、type、
+// since 和 until（RFC3339）、page、page_size
+func (h *ActivityHandler) List(c *gin.Context) {
+	query := activity.Query{
+		Actor: c.Query("actor"),
+		Type:  c.Query("type"),
+	}
+	if source := c.Query("source"); source != "" {
+		query.Sources = strings.Split(source, ",")
+	}
+	for param, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的时间格式",
+				"error":   err.Error(),
+			})
+			return
+		}
+		*target = t
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	query.Page = page
+	query.PageSize = min(pageSize, maxActivityPageSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.feed.List(query, time.Now()),
+	})
+}
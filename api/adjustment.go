@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"v/logger"
+	"v/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAdjustmentNote 调整说明最大长度
+const maxAdjustmentNote = 500
+
+// TrafficAdjustmentHandler 用户流量人工调整处理器
+type TrafficAdjustmentHandler struct {
+	log *logger.Logger
+	db  model.DB
+}
+
+// NewTrafficAdjustmentHandler 创建用户流量人工调整处理器
+func NewTrafficAdjustmentHandler(log *logger.Logger, db model.DB) *TrafficAdjustmentHandler {
+	return &TrafficAdjustmentHandler{
+		log: log,
+		db:  db,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *TrafficAdjustmentHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/users/:id/traffic-adjustments", h.ListAdjustments)
+	router.POST("/users/:id/traffic-adjustments", h.CreateAdjustment)
+}
+
+// trafficAdjustmentRequest 流量调整请求，正数增加用量，负数扣减用量
+type trafficAdjustmentRequest struct {
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+	Note     string `json:"note"`
+}
+
+// CreateAdjustment 人工增加或扣减用户流量，必须填写说明，调整记录写入流量历史并计入报告
+func (h *TrafficAdjustmentHandler) CreateAdjustment(c *gin.Context) {
+	userID, ok := userIDParam(c, h.db)
+	if !ok {
+		return
+	}
+
+	var req trafficAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求参数错误",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "必须填写调整说明",
+		})
+		return
+	}
+	if len([]rune(req.Note)) > maxAdjustmentNote {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "调整说明过长",
+		})
+		return
+	}
+	if req.Upload == 0 && req.Download == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "调整流量不能为0",
+		})
+		return
+	}
+
+	adjustment := &model.Traffic{
+		UserID:   userID,
+		Up:       req.Upload,
+		Down:     req.Download,
+		Note:     req.Note,
+		Operator: c.GetString("username"),
+	}
+	if err := h.db.AdjustUserTraffic(adjustment); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "用户不存在",
+			})
+			return
+		}
+		h.log.ErrorWithFields("Failed to adjust user traffic", logger.Fields{
+			"user_id": userID,
+			"error":   err,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "调整用户流量失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	h.log.WithFields("User traffic adjusted", logger.Fields{
+		"user_id":  userID,
+		"upload":   adjustment.Up,
+		"download": adjustment.Down,
+		"operator": adjustment.Operator,
+		"note":     adjustment.Note,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "流量调整成功",
+		"data":    adjustment,
+	})
+}
+
+// ListAdjustments 获取用户的流量调整记录
+func (h *TrafficAdjustmentHandler) ListAdjustments(c *gin.Context) {
+	userID, ok := userIDParam(c, h.db)
+	if !ok {
+		return
+	}
+
+	adjustments, err := h.db.ListTrafficAdjustments(userID)
+	if err != nil {
+		h.log.ErrorWithFields("Failed to list traffic adjustments", logger.Fields{
+			"user_id": userID,
+			"error":   err,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取流量调整记录失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    adjustments,
+	})
+}
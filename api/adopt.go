@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"v/logger"
+	"v/model"
+	"v/protocol"
+	"v/xray"
+
+	"github.com/gin-gonic/gin"
+)
+
+// XrayAdoptionHandler 检测并接管通过安装脚本或 systemd 运行的外部 xray
+type XrayAdoptionHandler struct {
+	log       *logger.Logger
+	xray      *xray.Manager
+	protocols *protocol.Manager
+}
+
+// NewXrayAdoptionHandler 创建外部 xray 接管处理器
+func NewXrayAdoptionHandler(log *logger.Logger, xrayMgr *xray.Manager, protocolMgr *protocol.Manager) *XrayAdoptionHandler {
+	return &XrayAdoptionHandler{
+		log:       log,
+		xray:      xrayMgr,
+		protocols: protocolMgr,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *XrayAdoptionHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/xray/external", h.ListExternal)
+	router.POST("/xray/external/:pid/adopt", h.AdoptExternal)
+}
+
+// adoptRequest 接管请求。接管流程：先 GET /xray/external 查看外部实例和入站，
+// 再以 import_inbounds 导入协议、take_over 停止外部 xray 并由面板启动
+type adoptRequest struct {
+	ImportInbounds bool  `json:"import_inbounds"` // 将入站导入为协议
+	UserID         int64 `json:"user_id"`         // 导入协议所属的用户
+	TakeOver       bool  `json:"take_over"`       // 停止外部 xray 并由面板接管
+}
+
+// ListExternal 列出不由面板启动的 xray 进程及其配置中的入站
+func (h *XrayAdoptionHandler) ListExternal(c *gin.Context) {
+	instances, err := h.xray.DetectExternal()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "检测外部 Xray 失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    instances,
+	})
+}
+
+// AdoptExternal 导入外部 xray 的入站并可选地接管其运行
+func (h *XrayAdoptionHandler) AdoptExternal(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的进程ID",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var req adoptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if req.ImportInbounds && req.UserID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "导入入站需要指定用户",
+		})
+		return
+	}
+
+	var imported *protocol.ImportResult
+	if req.ImportInbounds {
+		instances, err := h.xray.DetectExternal()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "检测外部 Xray 失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+		var inst *xray.ExternalInstance
+		for _, candidate := range instances {
+			if candidate.PID == pid {
+				inst = candidate
+			}
+		}
+		if inst == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "外部 Xray 进程不存在",
+			})
+			return
+		}
+
+		imported, err = h.protocols.ImportInbounds(inst.Inbounds, req.UserID, c.GetString("username"))
+		if err != nil {
+			status, message := http.StatusInternalServerError, "导入入站失败"
+			if errors.Is(err, model.ErrNotFound) {
+				status, message = http.StatusNotFound, "用户不存在"
+			}
+			c.JSON(status, gin.H{
+				"success": false,
+				"message": message,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	result, err := h.xray.AdoptExternal(pid, req.TakeOver)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, xray.ErrExternalNotFound) {
+			status = http.StatusNotFound
+		}
+		h.log.ErrorWithFields("Failed to adopt external Xray", logger.Fields{
+			"pid":   pid,
+			"error": err.Error(),
+		})
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "接管外部 Xray 失败",
+			"error":   err.Error(),
+			"data": gin.H{
+				"imported": imported,
+				"adopt":    result,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "接管完成",
+		"data": gin.H{
+			"imported": imported,
+			"adopt":    result,
+		},
+	})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"v/logger"
+	"v/monitor"
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlertRulesHandler 将面板告警设置导出为 Prometheus 告警规则
+type AlertRulesHandler struct {
+	log      *logger.Logger
+	settings *settings.Manager
+}
+
+// NewAlertRulesHandler 创建告警规则导出处理器
+func NewAlertRulesHandler(log *logger.Logger, settingsMgr *settings.Manager) *AlertRulesHandler {
+	return &AlertRulesHandler{
+		log:      log,
+		settings: settingsMgr,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *AlertRulesHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/monitor/alert-rules", h.GetAlertRules)
+}
+
+// GetAlertRules 按当前告警设置生成规则文件，设置修改后内容和 ETag 随之变化，
+// 集中监控可以定期拉取并在 ETag 变化时重新加载。
+// 查询参数：format 为 prometheus（rule_files 规则文件，默认）或 kubernetes（PrometheusRule 资源），
+// selector 为附加到 node_exporter 指标上的标签匹配，如 job="node"
+func (h *AlertRulesHandler) GetAlertRules(c *gin.Context) {
+	format := c.DefaultQuery("format", monitor.RuleFormatPrometheus)
+	if format != monitor.RuleFormatPrometheus && format != monitor.RuleFormatKubernetes {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "不支持的规则格式",
+		})
+		return
+	}
+
+	group := monitor.BuildAlertRules(h.settings.Get().Monitor, c.Query("selector"))
+	data, err := monitor.RenderAlertRules(group, format)
+	if err != nil {
+		h.log.ErrorWithFields("Failed to render alert rules", logger.Fields{
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "生成告警规则失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if c.Query("download") == "1" {
+		c.Header("Content-Disposition", `attachment; filename="v-panel-alerts.yml"`)
+	}
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+}
@@ -7,11 +7,14 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/mux"
 
 	"v/db"
@@ -19,7 +22,9 @@ import (
 	"v/logger"
 	"v/middleware"
 	"v/model"
+	"v/monitor"
 	"v/settings"
+	"v/utils"
 	"v/xray"
 )
 
@@ -32,6 +37,7 @@ type Handler struct {
 	settings   *settings.Manager
 	xrayMgr    *xray.Manager
 	httpServer *http.Server
+	routesOnce sync.Once
 }
 
 // New creates a new API handler
@@ -46,30 +52,119 @@ func New(log *logger.Logger, db *db.DB, settingsMgr *settings.Manager, xrayMgr *
 	}
 }
 
-// Start starts the API server
-func (h *Handler) Start() error {
-	// Setup routes
-	h.Setup()
+// Routes sets up all API routes once and returns the router so it can be
+// mounted into the main server, which provides the middleware stack
+func (h *Handler) Routes() http.Handler {
+	h.routesOnce.Do(func() {
+		// Setup routes
+		h.Setup()
 
-	// Setup xray version endpoints
-	h.setupXrayEndpoints()
+		// Setup xray version endpoints
+		h.setupXrayEndpoints()
 
-	// Setup proxy sharing endpoints
-	h.setupShareEndpoints()
+		// Setup xray config snapshot endpoints
+		h.setupXraySnapshotEndpoints()
 
-	// Setup protocol settings endpoints
-	h.setupProtocolEndpoints()
+		// Setup proxy sharing endpoints
+		h.setupShareEndpoints()
 
-	// Setup inbound management endpoints
-	h.setupInboundEndpoints()
+		// Setup protocol settings endpoints
+		h.setupProtocolEndpoints()
 
-	// Setup system endpoints
-	h.setupSystemEndpoints()
+		// Setup inbound management endpoints
+		h.setupInboundEndpoints()
+
+		// Setup system endpoints
+		h.setupSystemEndpoints()
+
+		// Setup storage usage endpoints
+		h.setupStorageEndpoints()
+
+		// Setup pre-migration backup and rollback endpoints
+		h.setupMigrationEndpoints()
+	})
+	return h.router
+}
+
+// Mounted returns the routes for mounting on the main server. The main server
+// already provides CORS, recovery, logging and API versioning, so only the
+// rate limit from the standalone stack is applied here; authentication is
+// the caller's responsibility
+func (h *Handler) Mounted() http.Handler {
+	return middleware.RateLimit()(h.Routes())
+}
+
+// muxMethods 没有限定方法的 mux 路由在 gin 上按这些方法注册
+var muxMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+// RegisterRoutes registers every mux route on the gin groups explicitly so
+// each one goes through the group's authentication instead of a catch-all.
+// The SSE endpoint is registered on stream, whose middleware may accept a
+// query token because EventSource cannot send headers. Method and path pairs
+// listed in existing are already served by gin and are skipped
+func (h *Handler) RegisterRoutes(admin, stream *gin.RouterGroup, existing gin.RoutesInfo) error {
+	served := make(map[string]bool, len(existing))
+	for _, route := range existing {
+		served[route.Method+" "+route.Path] = true
+	}
+
+	mounted := gin.WrapH(h.Mounted())
+	return h.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = muxMethods
+		}
+
+		group := admin
+		if template == sseXrayEventsPath {
+			group = stream
+		}
+		path := muxPathToGin(template)
+		for _, method := range methods {
+			if served[method+" "+path] {
+				continue
+			}
+			group.Handle(method, strings.TrimPrefix(path, group.BasePath()), mounted)
+		}
+		return nil
+	})
+}
+
+// muxPathToGin 将 mux 路径模板中的 {name} 转换为 gin 的 :name
+func muxPathToGin(template string) string {
+	parts := strings.Split(template, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name, _, _ := strings.Cut(strings.Trim(part, "{}"), ":")
+			parts[i] = ":" + name
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Start starts a standalone API server with its own middleware stack on addr
+func (h *Handler) Start(addr string) error {
+	handler := h.Routes()
+	for _, m := range []middleware.Middleware{
+		middleware.RateLimit(),
+		middleware.NewCORSPolicy(h.settings).Middleware(),
+		middleware.Recovery(h.log),
+		middleware.Logging(h.log),
+		middleware.APIVersion(),
+	} {
+		handler = m(handler)
+	}
 
-	// Start HTTP server
 	h.httpServer = &http.Server{
-		Addr:    "0.0.0.0:9000",
-		Handler: h.router,
+		Addr:    addr,
+		Handler: handler,
 	}
 
 	go func() {
@@ -81,7 +176,7 @@ func (h *Handler) Start() error {
 	}()
 
 	h.log.Info("API server started", logger.Fields{
-		"address": "0.0.0.0:9000",
+		"address": addr,
 	})
 
 	return nil
@@ -102,12 +197,6 @@ func (h *Handler) Register(path string, handler http.HandlerFunc) {
 
 // Setup sets up the API routes
 func (h *Handler) Setup() {
-	// Add middleware
-	h.router.Use(middleware.ToMuxMiddleware(middleware.Logging(h.log)))
-	h.router.Use(middleware.ToMuxMiddleware(middleware.Recovery(h.log)))
-	h.router.Use(middleware.ToMuxMiddleware(middleware.CORS()))
-	h.router.Use(middleware.ToMuxMiddleware(middleware.RateLimit()))
-
 	// 设置SSE端点
 	h.setupSSEEndpoints()
 
@@ -276,6 +365,35 @@ func (h *Handler) setupXrayEndpoints() {
 		})
 	}).Methods("GET")
 
+	// List inbound port conflicts detected at startup
+	h.router.HandleFunc("/api/xray/port-conflicts", func(w http.ResponseWriter, r *http.Request) {
+		conflicts := h.xrayMgr.PortConflicts()
+		h.handleResponse(w, map[string]interface{}{
+			"conflicts": conflicts,
+			"total":     len(conflicts),
+		})
+	}).Methods("GET")
+
+	// Last abnormal exit report with the output captured before the crash
+	h.router.HandleFunc("/api/xray/crash", func(w http.ResponseWriter, r *http.Request) {
+		h.handleResponse(w, map[string]interface{}{
+			"crash": h.xrayMgr.LastCrash(),
+		})
+	}).Methods("GET")
+
+	// Re-enable inbounds disabled by port conflicts
+	h.router.HandleFunc("/api/xray/port-conflicts/restore", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.xrayMgr.RestoreConflictInbounds(); err != nil {
+			h.handleError(w, errors.WithMessage(errors.ErrInternalServerError, err.Error()))
+			return
+		}
+
+		h.handleResponse(w, map[string]interface{}{
+			"success": true,
+			"running": h.xrayMgr.IsRunning(),
+		})
+	}).Methods("POST")
+
 	// Update Xray settings
 	h.router.HandleFunc("/api/settings/xray", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
@@ -283,16 +401,42 @@ func (h *Handler) setupXrayEndpoints() {
 			CustomConfig  bool   `json:"custom_config"`
 			ConfigPath    string `json:"config_path"`
 			CheckInterval int    `json:"check_interval"`
+			// 以下字段为空时保持原值
+			DomainStrategy         *string           `json:"domain_strategy"`
+			OutboundDomainStrategy map[string]string `json:"outbound_domain_strategy"`
+			RoutingDomainStrategy  *string           `json:"routing_domain_strategy"`
+			DNSDisableCache        *bool             `json:"dns_disable_cache"`
+			SendThrough            *string           `json:"send_through"`
+			OutboundSendThrough    map[string]string `json:"outbound_send_through"`
+			GroupSendThrough       map[string]string `json:"group_send_through"`
+			// 资源限制，为空时保持原值，下次启动 xray 时生效
+			CPULimit      *float64 `json:"cpu_limit"`
+			MemoryLimitMB *int64   `json:"memory_limit_mb"`
+			Nice          *int     `json:"nice"`
+			IOClass       *string  `json:"io_class"`
+			IOPriority    *int     `json:"io_priority"`
 		}
 
 		if r.Method == "GET" {
 			// Get current settings
 			settings := h.settings.Get()
 			h.handleResponse(w, map[string]interface{}{
-				"auto_update":    settings.Xray.AutoUpdate,
-				"custom_config":  settings.Xray.CustomConfig,
-				"config_path":    settings.Xray.ConfigPath,
-				"check_interval": settings.Xray.CheckInterval / time.Hour,
+				"auto_update":              settings.Xray.AutoUpdate,
+				"custom_config":            settings.Xray.CustomConfig,
+				"config_path":              settings.Xray.ConfigPath,
+				"check_interval":           settings.Xray.CheckInterval / time.Hour,
+				"domain_strategy":          settings.Xray.OutboundStrategy(""),
+				"outbound_domain_strategy": settings.Xray.OutboundDomainStrategy,
+				"routing_domain_strategy":  settings.Xray.RoutingStrategy(),
+				"dns_disable_cache":        settings.Xray.DNSDisableCache,
+				"send_through":             settings.Xray.SendThrough,
+				"outbound_send_through":    settings.Xray.OutboundSendThrough,
+				"group_send_through":       settings.Xray.GroupSendThrough,
+				"cpu_limit":                settings.Xray.CPULimit,
+				"memory_limit_mb":          settings.Xray.MemoryLimitMB,
+				"nice":                     settings.Xray.Nice,
+				"io_class":                 settings.Xray.IOClass,
+				"io_priority":              settings.Xray.IOPriority,
 			})
 			return
 		}
@@ -304,7 +448,7 @@ func (h *Handler) setupXrayEndpoints() {
 		}
 
 		// 获取当前设置的完整拷贝
-		settings := h.settings.Get()
+		settings := h.settings.Clone()
 
 		// 更新Xray相关设置
 		settings.Xray.AutoUpdate = req.AutoUpdate
@@ -315,6 +459,54 @@ func (h *Handler) setupXrayEndpoints() {
 		if req.CheckInterval > 0 {
 			settings.Xray.CheckInterval = time.Duration(req.CheckInterval) * time.Hour
 		}
+		if req.DomainStrategy != nil {
+			settings.Xray.DomainStrategy = *req.DomainStrategy
+		}
+		if req.OutboundDomainStrategy != nil {
+			settings.Xray.OutboundDomainStrategy = req.OutboundDomainStrategy
+		}
+		if req.RoutingDomainStrategy != nil {
+			settings.Xray.RoutingDomainStrategy = *req.RoutingDomainStrategy
+		}
+		if req.DNSDisableCache != nil {
+			settings.Xray.DNSDisableCache = *req.DNSDisableCache
+		}
+		if req.SendThrough != nil {
+			settings.Xray.SendThrough = *req.SendThrough
+		}
+		if req.OutboundSendThrough != nil {
+			settings.Xray.OutboundSendThrough = req.OutboundSendThrough
+		}
+		if req.GroupSendThrough != nil {
+			settings.Xray.GroupSendThrough = req.GroupSendThrough
+		}
+		if req.CPULimit != nil {
+			settings.Xray.CPULimit = *req.CPULimit
+		}
+		if req.MemoryLimitMB != nil {
+			settings.Xray.MemoryLimitMB = *req.MemoryLimitMB
+		}
+		if req.Nice != nil {
+			settings.Xray.Nice = *req.Nice
+		}
+		if req.IOClass != nil {
+			settings.Xray.IOClass = *req.IOClass
+		}
+		if req.IOPriority != nil {
+			settings.Xray.IOPriority = *req.IOPriority
+		}
+		if err := settings.Xray.ValidateStrategies(); err != nil {
+			h.handleError(w, errors.WithMessage(errors.ErrInvalidParameter, err.Error()))
+			return
+		}
+		if err := settings.Xray.ValidateEgressHost(); err != nil {
+			h.handleError(w, errors.WithMessage(errors.ErrInvalidParameter, err.Error()))
+			return
+		}
+		if err := settings.Xray.ValidateResourceLimits(); err != nil {
+			h.handleError(w, errors.WithMessage(errors.ErrInvalidParameter, err.Error()))
+			return
+		}
 
 		// 使用Update方法更新并保存所有设置
 		if err := h.settings.Update(settings); err != nil {
@@ -327,6 +519,18 @@ func (h *Handler) setupXrayEndpoints() {
 		})
 	}).Methods("GET", "POST")
 
+	// List local addresses usable as egress IP
+	h.router.HandleFunc("/api/xray/egress-ips", func(w http.ResponseWriter, r *http.Request) {
+		ips, err := settings.LocalIPs()
+		if err != nil {
+			h.handleError(w, err)
+			return
+		}
+		h.handleResponse(w, map[string]interface{}{
+			"ips": ips,
+		})
+	}).Methods("GET")
+
 	// Test custom config
 	h.router.HandleFunc("/api/xray/test-config", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
@@ -369,6 +573,60 @@ func (h *Handler) setupXrayEndpoints() {
 	}).Methods("POST")
 }
 
+// setupXraySnapshotEndpoints sets up the xray config snapshot endpoints
+func (h *Handler) setupXraySnapshotEndpoints() {
+	// List applied config snapshots
+	h.router.HandleFunc("/api/xray/config/history", func(w http.ResponseWriter, r *http.Request) {
+		snapshots, err := h.xrayMgr.ListSnapshots()
+		if err != nil {
+			h.handleError(w, err)
+			return
+		}
+
+		h.handleResponse(w, map[string]interface{}{
+			"snapshots": snapshots,
+			"total":     len(snapshots),
+		})
+	}).Methods("GET")
+
+	// Download a snapshot
+	h.router.HandleFunc("/api/xray/config/history/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := h.getPathParam(r, "id")
+		data, err := h.xrayMgr.ReadSnapshot(id)
+		if err != nil {
+			h.handleError(w, snapshotError(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="xray-config-%s.json"`, id))
+		w.Write(data)
+	}).Methods("GET")
+
+	// Restore a snapshot as the custom config
+	h.router.HandleFunc("/api/xray/config/history/{id}/restore", func(w http.ResponseWriter, r *http.Request) {
+		id := h.getPathParam(r, "id")
+		if err := h.xrayMgr.RestoreSnapshot(id); err != nil {
+			h.handleError(w, snapshotError(err))
+			return
+		}
+
+		h.handleResponse(w, map[string]interface{}{
+			"success":     true,
+			"config_path": h.xrayMgr.RestoredConfigPath(),
+			"running":     h.xrayMgr.IsRunning(),
+		})
+	}).Methods("POST")
+}
+
+// snapshotError maps snapshot errors to API errors
+func snapshotError(err error) error {
+	if err == xray.ErrSnapshotNotFound {
+		return errors.ErrResourceNotFound
+	}
+	return errors.WithMessage(errors.ErrInternalServerError, err.Error())
+}
+
 // setupShareEndpoints sets up the proxy sharing endpoints
 func (h *Handler) setupShareEndpoints() {
 	// Get proxy share link
@@ -560,7 +818,7 @@ func (h *Handler) setupProtocolEndpoints() {
 		}
 
 		// 更新设置
-		settings := h.settings.Get()
+		settings := h.settings.Clone()
 		settings.Protocols = req.Protocols
 		settings.Transports = req.Transports
 
@@ -795,10 +1053,13 @@ func (h *Handler) setupInboundEndpoints() {
 	}).Methods("GET")
 }
 
+// sseXrayEventsPath Xray 下载和版本切换进度的 SSE 端点
+const sseXrayEventsPath = "/api/sse/xray-events"
+
 // setupSSEEndpoints 设置SSE（Server-Sent Events）端点
 func (h *Handler) setupSSEEndpoints() {
 	// 监听Xray下载和版本切换进度
-	h.router.HandleFunc("/api/sse/xray-events", func(w http.ResponseWriter, r *http.Request) {
+	h.router.HandleFunc(sseXrayEventsPath, func(w http.ResponseWriter, r *http.Request) {
 		// 设置SSE相关的HTTP头
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
@@ -889,6 +1150,64 @@ func (h *Handler) setupSystemEndpoints() {
 
 		h.handleResponse(w, response)
 	}).Methods("GET")
+
+	// Check certificate private key permissions
+	h.router.HandleFunc("/api/system/diagnostics/keys", func(w http.ResponseWriter, r *http.Request) {
+		certDir := h.settings.Get().SSL.CertDir
+		if certDir == "" {
+			certDir = "certs"
+		}
+
+		keys, err := filepath.Glob(filepath.Join(certDir, "*.key"))
+		if err != nil {
+			h.handleError(w, err)
+			return
+		}
+
+		statuses := make([]*utils.KeyFileStatus, 0, len(keys))
+		insecure := 0
+		for _, key := range keys {
+			status := utils.CheckKeyFile(key)
+			if !status.Secure() {
+				insecure++
+			}
+			statuses = append(statuses, status)
+		}
+
+		h.handleResponse(w, map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data": map[string]interface{}{
+				"cert_dir": certDir,
+				"keys":     statuses,
+				"insecure": insecure,
+			},
+		})
+	}).Methods("GET")
+
+	// Check clock skew against NTP servers
+	h.router.HandleFunc("/api/system/diagnostics/clock", func(w http.ResponseWriter, r *http.Request) {
+		s := h.settings.Get()
+		threshold := monitor.ClockSkewThreshold(s.Monitor.ClockSkewThreshold)
+
+		offset, err := utils.CheckClockSkew(s.Monitor.NTPServers, 5*time.Second)
+		if err != nil {
+			h.handleError(w, errors.WithMessage(errors.ErrInternalServerError, err.Error()))
+			return
+		}
+
+		h.handleResponse(w, map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data": map[string]interface{}{
+				"server":    offset.Server,
+				"offset":    offset.Offset.Seconds(),
+				"rtt":       offset.RTT.Seconds(),
+				"threshold": threshold.Seconds(),
+				"skewed":    threshold > 0 && offset.Skew() > threshold,
+			},
+		})
+	}).Methods("GET")
 }
 
 // ServeHTTP implements the http.Handler interface
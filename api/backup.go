@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"v/backup"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupHandler 远程备份处理器
+type BackupHandler struct {
+	manager *backup.Manager
+}
+
+// NewBackupHandler 创建远程备份处理器
+func NewBackupHandler(manager *backup.Manager) *BackupHandler {
+	return &BackupHandler{manager: manager}
+}
+
+// RegisterRoutes 注册路由，恢复会覆盖数据库，router 需要已要求管理员权限
+func (h *BackupHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/backups/remote/:target", h.ListRemote)
+	router.POST("/backups/remote/:target/:name/restore", h.RestoreRemote)
+}
+
+// ListRemote 列出远程目标上的备份
+func (h *BackupHandler) ListRemote(c *gin.Context) {
+	objects, err := h.manager.ListRemote(c.Param("target"))
+	if errors.Is(err, backup.ErrTargetNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "备份目标不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": "获取远程备份列表失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    objects,
+	})
+}
+
+// RestoreRemote 从远程目标下载备份并恢复
+func (h *BackupHandler) RestoreRemote(c *gin.Context) {
+	err := h.manager.RestoreRemote(c.Param("target"), c.Param("name"))
+	switch {
+	case errors.Is(err, backup.ErrTargetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "备份目标不存在",
+		})
+		return
+	case errors.Is(err, backup.ErrRemoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "远程备份不存在",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "恢复远程备份失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "备份已恢复",
+	})
+}
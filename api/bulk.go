@@ -0,0 +1,400 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"v/auth"
+	"v/bulk"
+	"v/logger"
+	"v/model"
+	"v/protocol"
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkUsers 单次批量导入的用户数量上限
+const maxBulkUsers = 1000
+
+// BulkHandler 批量导入用户、批量创建协议和修改分组策略。请求带 dry_run 时只校验并返回
+// 将要执行的变更和冲突，不保存任何数据；有冲突时整个请求不执行
+type BulkHandler struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	db       model.DB
+	mgr      *protocol.Manager
+
+	// importMu 串行化用户导入，校验和创建在同一把锁内完成，并发导入不会创建重复用户
+	importMu sync.Mutex
+}
+
+// NewBulkHandler 创建批量操作处理器
+func NewBulkHandler(log *logger.Logger, settingsMgr *settings.Manager, db model.DB, mgr *protocol.Manager) *BulkHandler {
+	return &BulkHandler{
+		log:      log,
+		settings: settingsMgr,
+		db:       db,
+		mgr:      mgr,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *BulkHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/users/import", h.ImportUsers)
+	router.POST("/protocols/bulk", h.ProvisionProtocols)
+	router.PUT("/routing/group-profiles", h.UpdateGroupProfiles)
+}
+
+// importUser 批量导入的用户
+type importUser struct {
+	Username     string     `json:"username"`
+	Password     string     `json:"password"`
+	Email        string     `json:"email"`
+	Role         string     `json:"role"` // 默认 user
+	TrafficLimit int64      `json:"traffic_limit"`
+	ExpireAt     *time.Time `json:"expire_at"`
+	Remark       string     `json:"remark"`
+}
+
+// importUsersRequest 批量导入用户请求
+type importUsersRequest struct {
+	Users  []importUser `json:"users"`
+	DryRun bool         `json:"dry_run"`
+}
+
+// ImportUsers 批量导入用户，检查用户名和邮箱是否与已有用户或同批用户重复。
+// 正式导入时在锁内重新校验并在一个事务中创建，结果与 dry run 的计划一致或整体失败
+func (h *BulkHandler) ImportUsers(c *gin.Context) {
+	var req importUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	h.importMu.Lock()
+	defer h.importMu.Unlock()
+
+	plan, err := h.planUsers(req.Users, req.DryRun)
+	if err != nil {
+		h.log.ErrorWithFields("Failed to plan user import", logger.Fields{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "校验用户失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if req.DryRun || plan.HasConflicts() {
+		h.respondPlan(c, plan)
+		return
+	}
+
+	users := make([]*model.User, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		user := change.After.(*model.User)
+		hashed, err := auth.HashPassword(req.Users[change.Index].Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "处理密码失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+		user.Password = hashed
+		users = append(users, user)
+	}
+	// 所有用户在一个事务中创建，失败时不会只导入一部分
+	if err := h.db.CreateUsers(users); err != nil {
+		h.log.ErrorWithFields("Failed to import users", logger.Fields{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "导入用户失败，没有创建任何用户",
+			"error":   err.Error(),
+			"data":    plan,
+		})
+		return
+	}
+	plan.Applied = true
+
+	h.log.WithFields("Users imported", logger.Fields{
+		"count":    len(plan.Changes),
+		"operator": c.GetString("username"),
+	})
+	h.respondPlan(c, plan)
+}
+
+// planUsers 校验导入的用户并生成计划
+func (h *BulkHandler) planUsers(users []importUser, dryRun bool) (*bulk.Plan, error) {
+	plan := bulk.New(dryRun, len(users))
+	if len(users) > maxBulkUsers {
+		plan.Conflict(-1, "users", "at most %d users can be imported at once", maxBulkUsers)
+		return plan, nil
+	}
+
+	minPassword := h.settings.Get().Security.MinPasswordLength
+	usernames := make(map[string]int)
+	emails := make(map[string]int)
+	for i, u := range users {
+		conflicts := len(plan.Conflicts)
+		username := strings.TrimSpace(u.Username)
+		email := strings.TrimSpace(u.Email)
+
+		if len(username) < 3 {
+			plan.Conflict(i, "username", "username must be at least 3 characters")
+		} else if j, ok := usernames[strings.ToLower(username)]; ok {
+			plan.Conflict(i, "username", "username %q is also used by user #%d", username, j)
+		} else {
+			usernames[strings.ToLower(username)] = i
+			existing, err := h.db.GetUserByUsername(username)
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil {
+				plan.Conflict(i, "username", "username %q already exists", username)
+			}
+		}
+
+		if email != "" {
+			if _, err := mail.ParseAddress(email); err != nil {
+				plan.Conflict(i, "email", "invalid email %q", email)
+			} else if j, ok := emails[strings.ToLower(email)]; ok {
+				plan.Conflict(i, "email", "email %q is also used by user #%d", email, j)
+			} else {
+				emails[strings.ToLower(email)] = i
+				existing, err := h.db.GetUserByEmail(email)
+				if err != nil {
+					return nil, err
+				}
+				if existing != nil {
+					plan.Conflict(i, "email", "email %q is already used by user %s", email, existing.Username)
+				}
+			}
+		}
+
+		if len(u.Password) < minPassword {
+			plan.Conflict(i, "password", "password must be at least %d characters", minPassword)
+		}
+		role := u.Role
+		if role == "" {
+			role = auth.RoleUser
+		}
+		if role != auth.RoleAdmin && role != auth.RoleUser {
+			plan.Conflict(i, "role", "invalid role %q", role)
+		}
+		if u.TrafficLimit < 0 {
+			plan.Conflict(i, "traffic_limit", "traffic_limit must not be negative")
+		}
+		if len(plan.Conflicts) > conflicts {
+			continue
+		}
+
+		plan.Add(&bulk.Change{
+			Index:  i,
+			Action: bulk.ActionCreate,
+			Target: "user " + username,
+			After: &model.User{
+				Username:     username,
+				Email:        email,
+				Role:         role,
+				IsAdmin:      role == auth.RoleAdmin,
+				Status:       "active",
+				Enabled:      true,
+				TrafficLimit: u.TrafficLimit,
+				ExpireAt:     u.ExpireAt,
+				Remark:       u.Remark,
+			},
+		})
+	}
+	return plan, nil
+}
+
+// provisionRequest 批量创建协议请求，端口为 0 的协议自动分配端口
+type provisionRequest struct {
+	Protocols []*model.Protocol `json:"protocols"`
+	DryRun    bool              `json:"dry_run"`
+}
+
+// ProvisionProtocols 批量创建协议，计划中包含分配的端口和将写入 Xray 的入站配置
+func (h *BulkHandler) ProvisionProtocols(c *gin.Context) {
+	var req provisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	plan, err := h.mgr.Provision(c.Request.Context(), req.Protocols, req.DryRun, c.GetString("username"))
+	if err != nil {
+		h.log.ErrorWithFields("Failed to provision protocols", logger.Fields{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "批量创建协议失败",
+			"error":   err.Error(),
+			"data":    plan,
+		})
+		return
+	}
+	if !plan.Applied {
+		h.respondPlan(c, plan)
+		return
+	}
+
+	change, err := h.mgr.RequestApply(fmt.Sprintf("provision %d protocols", len(plan.Changes)))
+	if err != nil {
+		h.log.ErrorWithFields("Failed to apply xray config", logger.Fields{"error": err.Error()})
+	}
+	h.log.WithFields("Protocols provisioned", logger.Fields{
+		"count":    len(plan.Changes),
+		"operator": c.GetString("username"),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "协议已批量创建",
+		"data":    plan,
+		"apply":   change,
+	})
+}
+
+// groupProfilesRequest 分组策略修改请求，GroupProfiles 为修改后完整的分组到分流方案的映射
+type groupProfilesRequest struct {
+	GroupProfiles map[string]string `json:"group_profiles"`
+	DryRun        bool              `json:"dry_run"`
+}
+
+// UpdateGroupProfiles 修改按分组指定的分流方案，计划中列出分流方案会变化的用户
+func (h *BulkHandler) UpdateGroupProfiles(c *gin.Context) {
+	var req groupProfilesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	next := h.settings.Clone()
+	current := next.Routing
+	next.Routing.GroupProfiles = req.GroupProfiles
+
+	plan := bulk.New(req.DryRun, len(req.GroupProfiles))
+	names := make(map[string]bool, len(current.Profiles))
+	for _, p := range current.Profiles {
+		names[p.Name] = true
+	}
+	groups := make([]string, 0, len(req.GroupProfiles))
+	for group := range req.GroupProfiles {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		if name := req.GroupProfiles[group]; !names[name] {
+			plan.Conflict(-1, "group_profiles."+group, "routing profile %q does not exist", name)
+		}
+	}
+
+	userGroups, err := h.mgr.UserGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取用户分组失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	userIDs := make([]int64, 0, len(userGroups))
+	for id := range userGroups {
+		userIDs = append(userIDs, id)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	for _, id := range userIDs {
+		before := profileName(current.ProfileFor(id, userGroups[id]))
+		after := profileName(next.Routing.ProfileFor(id, userGroups[id]))
+		if before == after {
+			continue
+		}
+		plan.Add(&bulk.Change{
+			Index:   -1,
+			Action:  bulk.ActionUpdate,
+			Target:  fmt.Sprintf("user %d", id),
+			Before:  before,
+			After:   after,
+			Details: map[string]interface{}{"groups": userGroups[id]},
+		})
+	}
+
+	if req.DryRun || plan.HasConflicts() {
+		h.respondPlan(c, plan)
+		return
+	}
+
+	if err := h.settings.ReplaceAs(next, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "更新分组策略失败",
+			"error":   err.Error(),
+			"data":    plan,
+		})
+		return
+	}
+	plan.Applied = true
+
+	// 服务端执行的分流方案写入 Xray 配置，需要重新加载
+	change, err := h.mgr.RequestApply("update routing group profiles")
+	if err != nil {
+		h.log.ErrorWithFields("Failed to apply xray config", logger.Fields{"error": err.Error()})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "分组策略已更新",
+		"data":    plan,
+		"apply":   change,
+	})
+}
+
+// respondPlan 返回计划。预演时总是返回 200，实际执行因冲突被拒绝时返回 409
+func (h *BulkHandler) respondPlan(c *gin.Context, plan *bulk.Plan) {
+	if plan.HasConflicts() && !plan.DryRun {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "存在冲突，未执行任何修改",
+			"error":   plan.Err().Error(),
+			"data":    plan,
+		})
+		return
+	}
+
+	message := "操作已完成"
+	if plan.HasConflicts() {
+		message = "预演发现冲突，执行时将被拒绝"
+	} else if plan.DryRun {
+		message = "预演完成，未保存任何修改"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    plan,
+	})
+}
+
+// profileName 返回分流方案名称，未使用方案时为空
+func profileName(p *settings.RoutingProfile) string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
@@ -1,9 +1,17 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"v/cert"
+	"v/protocol"
+	"v/settings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,12 +19,16 @@ import (
 // CertificateHandler SSL证书处理器
 type CertificateHandler struct {
 	certManager *cert.CertManager
+	protocols   *protocol.Manager
+	settings    *settings.Manager
 }
 
-// NewCertificateHandler 创建SSL证书处理器
-func NewCertificateHandler(certManager *cert.CertManager) *CertificateHandler {
+// NewCertificateHandler 创建SSL证书处理器，protocols 和 settingsMgr 用于批量签发时扫描入站和节点域名
+func NewCertificateHandler(certManager *cert.CertManager, protocols *protocol.Manager, settingsMgr *settings.Manager) *CertificateHandler {
 	return &CertificateHandler{
 		certManager: certManager,
+		protocols:   protocols,
+		settings:    settingsMgr,
 	}
 }
 
@@ -25,6 +37,9 @@ func (h *CertificateHandler) RegisterRoutes(router *gin.RouterGroup) {
 	certRouter := router.Group("/certificates")
 	{
 		certRouter.GET("", h.ListCertificates)
+		certRouter.POST("/issue-all", h.IssueAll)
+		certRouter.GET("/issue-all", h.ListIssueJobs)
+		certRouter.GET("/issue-all/:id", h.GetIssueJob)
 		certRouter.GET("/:domain", h.GetCertificate)
 		certRouter.POST("", h.CreateCertificate)
 		certRouter.DELETE("/:domain", h.DeleteCertificate)
@@ -132,3 +147,115 @@ func (h *CertificateHandler) RenewCertificate(c *gin.Context) {
 		"message": "Certificate renewed",
 	})
 }
+
+// IssueAll 扫描启用 TLS 的入站和延迟探测列表中的节点域名，在后台为缺少有效证书的域名逐个申请证书，
+// 通过返回的任务 ID 查询每个域名的进度和结果统计
+func (h *CertificateHandler) IssueAll(c *gin.Context) {
+	targets, err := h.collectDomains()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "扫描域名失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if len(targets) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "没有需要证书的域名",
+			"data":    []cert.BulkTarget{},
+		})
+		return
+	}
+
+	job, err := h.certManager.IssueAll(targets, c.GetString("username"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, cert.ErrBulkRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "无法开始批量签发",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("已开始为 %d 个域名签发证书", len(job.Domains)),
+		"data":    job,
+	})
+}
+
+// ListIssueJobs 返回最近的批量签发任务
+func (h *CertificateHandler) ListIssueJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.certManager.BulkJobs(),
+	})
+}
+
+// GetIssueJob 查询批量签发任务中各域名的状态
+func (h *CertificateHandler) GetIssueJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的任务ID",
+		})
+		return
+	}
+
+	job, ok := h.certManager.BulkJob(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "签发任务不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// collectDomains 汇总入站 TLS 域名和节点域名，同一域名的来源合并
+func (h *CertificateHandler) collectDomains() ([]cert.BulkTarget, error) {
+	sources := make(map[string][]string)
+
+	domains, err := h.protocols.TLSDomains()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range domains {
+		for _, id := range d.Protocols {
+			sources[d.Domain] = append(sources[d.Domain], fmt.Sprintf("protocol:%d", id))
+		}
+	}
+
+	for _, spec := range h.settings.Get().Nodes.Peers {
+		name, addr := strings.TrimSpace(spec), strings.TrimSpace(spec)
+		if i := strings.Index(spec, "="); i >= 0 {
+			name, addr = strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		}
+		host := addr
+		if hostOnly, _, err := net.SplitHostPort(addr); err == nil {
+			host = hostOnly
+		}
+		if domain := protocol.CertificateDomain(host); domain != "" {
+			sources[domain] = append(sources[domain], "node:"+name)
+		}
+	}
+
+	targets := make([]cert.BulkTarget, 0, len(sources))
+	for domain, src := range sources {
+		targets = append(targets, cert.BulkTarget{Domain: domain, Sources: src})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Domain < targets[j].Domain })
+	return targets, nil
+}
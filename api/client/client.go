@@ -0,0 +1,202 @@
+// Package client 面板 v1 API 的 Go 客户端，供自动化脚本调用用户、协议、流量和 Xray 控制接口，
+// 统一处理认证和 /api/v1 的响应结构，调用方不需要自己拼接 HTTP 请求。
+//
+// 基本用法：
+//
+//	c := client.New("https://panel.example.com", client.WithToken(os.Getenv("V_API_TOKEN")))
+//	protocols, err := c.ListProtocols(ctx, 1, 50)
+//
+// 面板设置了访问路径时，baseURL 需包含该路径，如 https://panel.example.com/k3x9q2m7。
+// 接口返回失败时错误为 *APIError，可通过 errors.As 取得状态码和服务端消息。
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIPrefix 客户端使用的版本化 API 前缀
+const APIPrefix = "/api/v1"
+
+// maxResponseSize 响应体大小上限
+const maxResponseSize = 32 << 20
+
+// Envelope /api/v1 的统一响应结构，与服务端 middleware.Envelope 一致
+type Envelope struct {
+	Success bool            `json:"success"`
+	Code    int             `json:"code"`
+	Message string          `json:"message,omitempty"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// APIError 接口返回的错误
+type APIError struct {
+	StatusCode int             // HTTP 状态码
+	Message    string          // 服务端返回的提示信息
+	Err        string          // 服务端返回的错误详情
+	Data       json.RawMessage // 错误响应附带的数据，如批量操作的冲突计划
+}
+
+// Error 实现 error 接口
+func (e *APIError) Error() string {
+	msg := e.Err
+	if msg == "" {
+		msg = e.Message
+	} else if e.Message != "" && e.Message != e.Err {
+		msg = e.Message + ": " + e.Err
+	}
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("v api: HTTP %d: %s", e.StatusCode, msg)
+}
+
+// IsNotFound 判断错误是否为资源不存在
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict 判断错误是否为冲突，如端口被占用或批量操作存在冲突
+func IsConflict(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// Client v1 API 客户端，可被多个 goroutine 并发使用
+type Client struct {
+	baseURL   string
+	token     string
+	userAgent string
+	http      *http.Client
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithToken 设置管理员令牌，以 Bearer 方式发送
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient 使用自定义的 HTTP 客户端，如需要自定义 TLS 或代理
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.http = hc
+		}
+	}
+}
+
+// WithUserAgent 设置 User-Agent，便于在面板的 API 使用统计中区分调用方
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// New 创建客户端，baseURL 为面板地址，如 http://127.0.0.1:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		userAgent: "v-api-client",
+		http:      &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetToken 更新令牌，如登录后或令牌轮换后
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Do 发送请求并将响应的 data 字段解码到 out。path 为 /api/v1 之后的路径，如 /users/1；
+// body 不为 nil 时编码为 JSON；out 为 nil 时忽略 data。供尚未封装的接口使用
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := c.baseURL + APIPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var env Envelope
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&env); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return &APIError{StatusCode: resp.StatusCode}
+		}
+		return fmt.Errorf("unexpected response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest || !env.Success {
+		status := resp.StatusCode
+		if status < http.StatusBadRequest && env.Code >= http.StatusBadRequest {
+			status = env.Code
+		}
+		return &APIError{
+			StatusCode: status,
+			Message:    env.Message,
+			Err:        env.Error,
+			Data:       env.Data,
+		}
+	}
+
+	if out == nil || len(env.Data) == 0 || string(env.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %v", method, path, err)
+	}
+	return nil
+}
+
+// get 发送 GET 请求
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// send 发送带 JSON 请求体的请求
+func (c *Client) send(ctx context.Context, method, path string, body, out interface{}) error {
+	return c.Do(ctx, method, path, nil, body, out)
+}
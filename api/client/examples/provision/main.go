@@ -0,0 +1,70 @@
+// provision 示例：先预演批量创建协议，没有冲突时再实际创建，并为用户设置流量限制。
+//
+//	V_URL=http://127.0.0.1:8080 V_API_TOKEN=... go run ./api/client/examples/provision -user 2 -count 3
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"v/api/client"
+	"v/model"
+)
+
+func main() {
+	userID := flag.Int64("user", 0, "owner user ID")
+	count := flag.Int("count", 1, "number of protocols to create")
+	protoType := flag.String("type", "vless", "protocol type")
+	limit := flag.Int64("limit", 100<<30, "traffic limit in bytes, 0 to keep unchanged")
+	flag.Parse()
+	if *userID <= 0 {
+		log.Fatal("-user is required")
+	}
+
+	c := client.New(os.Getenv("V_URL"), client.WithToken(os.Getenv("V_API_TOKEN")))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	protocols := make([]*model.Protocol, *count)
+	for i := range protocols {
+		protocols[i] = &model.Protocol{
+			Name:   fmt.Sprintf("%s-%d-%d", *protoType, *userID, i+1),
+			Type:   *protoType,
+			UserID: *userID,
+		}
+	}
+
+	plan, err := c.ProvisionProtocols(ctx, protocols, true)
+	if err != nil {
+		log.Fatalf("dry run failed: %v", err)
+	}
+	for _, conflict := range plan.Conflicts {
+		fmt.Printf("conflict #%d %s: %s\n", conflict.Index, conflict.Field, conflict.Message)
+	}
+	if plan.HasConflicts() {
+		os.Exit(1)
+	}
+
+	plan, err = c.ProvisionProtocols(ctx, protocols, false)
+	if err != nil {
+		if p, ok := client.PlanFromError(err); ok {
+			for _, conflict := range p.Conflicts {
+				fmt.Printf("conflict #%d %s: %s\n", conflict.Index, conflict.Field, conflict.Message)
+			}
+		}
+		log.Fatal(err)
+	}
+	for _, change := range plan.Changes {
+		fmt.Println("created", change.Target)
+	}
+
+	if *limit > 0 {
+		if _, err := c.PatchUser(ctx, *userID, client.UserPatch{TrafficLimit: limit}); err != nil {
+			log.Fatalf("failed to set traffic limit: %v", err)
+		}
+	}
+}
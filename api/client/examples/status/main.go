@@ -0,0 +1,48 @@
+// status 示例：输出面板和 Xray 的版本、运行状态和总流量，Xray 未运行时可选择启动。
+//
+//	V_URL=http://127.0.0.1:8080 V_API_TOKEN=... go run ./api/client/examples/status -start
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"v/api/client"
+)
+
+func main() {
+	start := flag.Bool("start", false, "start xray when it is not running")
+	flag.Parse()
+
+	c := client.New(os.Getenv("V_URL"), client.WithToken(os.Getenv("V_API_TOKEN")))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	v, err := c.Version(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("panel %s (%s), xray %s, up %s\n", v.Version, v.Commit, v.XrayVersion, v.Uptime.Round(time.Second))
+
+	status, err := c.XrayStatus(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("xray running: %v\n", status.Running)
+	if !status.Running && *start {
+		if err := c.StartXray(ctx); err != nil {
+			log.Fatalf("failed to start xray: %v", err)
+		}
+		fmt.Println("xray started")
+	}
+
+	stats, err := c.TrafficStats(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("traffic: up %d bytes, down %d bytes, %d active users\n", stats.TotalUpload, stats.TotalDownload, stats.ActiveUsers)
+}
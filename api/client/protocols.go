@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"v/bulk"
+	"v/model"
+)
+
+// ProtocolPage 协议分页列表
+type ProtocolPage struct {
+	Protocols  []*model.Protocol `json:"protocols"`
+	Total      int64             `json:"total"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	TotalPages int64             `json:"total_pages"`
+}
+
+// ListProtocols 分页列出协议，page 从 1 开始
+func (c *Client) ListProtocols(ctx context.Context, page, pageSize int) (*ProtocolPage, error) {
+	query := url.Values{}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if pageSize > 0 {
+		query.Set("page_size", strconv.Itoa(pageSize))
+	}
+	var result ProtocolPage
+	if err := c.get(ctx, "/protocols", query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetProtocol 获取指定协议
+func (c *Client) GetProtocol(ctx context.Context, id int64) (*model.Protocol, error) {
+	var p model.Protocol
+	if err := c.get(ctx, fmt.Sprintf("/protocols/%d", id), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateProtocol 创建协议，返回保存后的协议
+func (c *Client) CreateProtocol(ctx context.Context, p *model.Protocol) (*model.Protocol, error) {
+	var created model.Protocol
+	if err := c.send(ctx, http.MethodPost, "/protocols", p, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateProtocol 更新协议的全部字段，返回更新后的协议
+func (c *Client) UpdateProtocol(ctx context.Context, id int64, p *model.Protocol) (*model.Protocol, error) {
+	var updated model.Protocol
+	if err := c.send(ctx, http.MethodPut, fmt.Sprintf("/protocols/%d", id), p, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// PatchProtocol 按 JSON Merge Patch 修改协议的部分字段，如 {"port": 8443}
+func (c *Client) PatchProtocol(ctx context.Context, id int64, patch map[string]interface{}) (*model.Protocol, error) {
+	var updated model.Protocol
+	if err := c.send(ctx, http.MethodPatch, fmt.Sprintf("/protocols/%d", id), patch, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteOptions 删除协议的选项
+type DeleteOptions struct {
+	Confirm   bool // 确认删除最近有流量的协议
+	NoArchive bool // 直接删除统计数据，不归档
+}
+
+// DeleteProtocol 删除协议
+func (c *Client) DeleteProtocol(ctx context.Context, id int64, opts DeleteOptions) error {
+	query := url.Values{}
+	if opts.Confirm {
+		query.Set("confirm", "true")
+	}
+	if opts.NoArchive {
+		query.Set("archive", "false")
+	}
+	return c.Do(ctx, http.MethodDelete, fmt.Sprintf("/protocols/%d", id), query, nil, nil)
+}
+
+// CloneOptions 复制协议的选项，零值表示自动分配端口、沿用原用户和名称
+type CloneOptions struct {
+	Port   int    `json:"port,omitempty"`
+	UserID int64  `json:"user_id,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// CloneProtocol 以现有协议为模板创建新协议，新协议使用新的端口和凭据
+func (c *Client) CloneProtocol(ctx context.Context, id int64, opts CloneOptions) (*model.Protocol, error) {
+	var clone model.Protocol
+	if err := c.send(ctx, http.MethodPost, fmt.Sprintf("/protocols/%d/clone", id), opts, &clone); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// RollbackProtocol 将协议恢复到指定的历史版本
+func (c *Client) RollbackProtocol(ctx context.Context, id int64, version int) (*model.Protocol, error) {
+	var restored model.Protocol
+	path := fmt.Sprintf("/protocols/%d/rollback/%d", id, version)
+	if err := c.send(ctx, http.MethodPost, path, nil, &restored); err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
+
+// ProvisionProtocols 批量创建协议，端口为 0 的协议由面板分配端口。dryRun 为 true 时只返回计划；
+// 有冲突时不创建任何协议，返回 IsConflict 为 true 的错误，计划可通过 PlanFromError 取得
+func (c *Client) ProvisionProtocols(ctx context.Context, protocols []*model.Protocol, dryRun bool) (*bulk.Plan, error) {
+	body := map[string]interface{}{"protocols": protocols, "dry_run": dryRun}
+	var plan bulk.Plan
+	if err := c.send(ctx, http.MethodPost, "/protocols/bulk", body, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// PlanFromError 从批量操作的错误中取出服务端返回的计划，用于查看冲突详情
+func PlanFromError(err error) (*bulk.Plan, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || len(apiErr.Data) == 0 {
+		return nil, false
+	}
+	var plan bulk.Plan
+	if json.Unmarshal(apiErr.Data, &plan) != nil {
+		return nil, false
+	}
+	return &plan, true
+}
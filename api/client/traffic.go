@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"v/model"
+)
+
+// TrafficStats 获取全部用户的流量统计
+func (c *Client) TrafficStats(ctx context.Context) (*model.SystemTrafficStats, error) {
+	var stats model.SystemTrafficStats
+	if err := c.get(ctx, "/traffic/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// UserTraffic 获取用户每个协议的流量统计
+func (c *Client) UserTraffic(ctx context.Context, userID int64) ([]*model.ProtocolStats, error) {
+	var stats []*model.ProtocolStats
+	if err := c.get(ctx, fmt.Sprintf("/traffic/user/%d", userID), nil, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// SetTrafficLimit 设置用户的流量限制（字节），0 表示不限制
+func (c *Client) SetTrafficLimit(ctx context.Context, userID, limit int64) error {
+	body := map[string]int64{"traffic_limit": limit}
+	return c.send(ctx, http.MethodPost, fmt.Sprintf("/traffic/limits/user/%d", userID), body, nil)
+}
+
+// TrafficAdjustments 获取用户的流量调整记录
+func (c *Client) TrafficAdjustments(ctx context.Context, userID int64) ([]*model.Traffic, error) {
+	var adjustments []*model.Traffic
+	if err := c.get(ctx, fmt.Sprintf("/users/%d/traffic-adjustments", userID), nil, &adjustments); err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
+
+// AdjustTraffic 人工增加（正数）或扣减（负数）用户的流量用量，note 为必填的调整说明
+func (c *Client) AdjustTraffic(ctx context.Context, userID, upload, download int64, note string) (*model.Traffic, error) {
+	body := map[string]interface{}{"upload": upload, "download": download, "note": note}
+	var adjustment model.Traffic
+	path := fmt.Sprintf("/users/%d/traffic-adjustments", userID)
+	if err := c.send(ctx, http.MethodPost, path, body, &adjustment); err != nil {
+		return nil, err
+	}
+	return &adjustment, nil
+}
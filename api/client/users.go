@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"v/bulk"
+	"v/model"
+)
+
+// LoginResult 登录结果
+type LoginResult struct {
+	Token string      `json:"token"`
+	User  *model.User `json:"user"`
+}
+
+// Login 使用用户名和密码登录，成功后客户端改用返回的令牌
+func (c *Client) Login(ctx context.Context, username, password string) (*LoginResult, error) {
+	var result LoginResult
+	body := map[string]string{"username": username, "password": password}
+	if err := c.send(ctx, http.MethodPost, "/auth/login", body, &result); err != nil {
+		return nil, err
+	}
+	c.SetToken(result.Token)
+	return &result, nil
+}
+
+// ListUsers 列出用户
+func (c *Client) ListUsers(ctx context.Context) ([]*model.User, error) {
+	var result struct {
+		Users []*model.User `json:"users"`
+	}
+	if err := c.get(ctx, "/users", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Users, nil
+}
+
+// UserPatch 用户的部分修改，只发送非 nil 的字段。ClearExpireAt 为 true 时取消过期时间
+type UserPatch struct {
+	Email          *string
+	Role           *string
+	Status         *string
+	TrafficLimit   *int64
+	ExpireAt       *time.Time
+	ClearExpireAt  bool
+	IsAdmin        *bool
+	Remark         *string
+	ActivityOptOut *bool
+	EmailVerified  *bool
+}
+
+// mergePatch 转换为 JSON Merge Patch
+func (p *UserPatch) mergePatch() map[string]interface{} {
+	patch := make(map[string]interface{})
+	if p.Email != nil {
+		patch["email"] = *p.Email
+	}
+	if p.Role != nil {
+		patch["role"] = *p.Role
+	}
+	if p.Status != nil {
+		patch["status"] = *p.Status
+	}
+	if p.TrafficLimit != nil {
+		patch["traffic_limit"] = *p.TrafficLimit
+	}
+	if p.ClearExpireAt {
+		patch["expire_at"] = nil
+	} else if p.ExpireAt != nil {
+		patch["expire_at"] = p.ExpireAt
+	}
+	if p.IsAdmin != nil {
+		patch["is_admin"] = *p.IsAdmin
+	}
+	if p.Remark != nil {
+		patch["remark"] = *p.Remark
+	}
+	if p.ActivityOptOut != nil {
+		patch["activity_opt_out"] = *p.ActivityOptOut
+	}
+	if p.EmailVerified != nil {
+		patch["email_verified"] = *p.EmailVerified
+	}
+	return patch
+}
+
+// PatchUser 修改用户的部分字段，返回修改后的用户
+func (c *Client) PatchUser(ctx context.Context, id int64, patch UserPatch) (*model.User, error) {
+	var user model.User
+	if err := c.send(ctx, http.MethodPatch, fmt.Sprintf("/users/%d", id), patch.mergePatch(), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SendEmailVerification 向用户尚未验证的邮箱或等待验证的新邮箱发送验证邮件
+func (c *Client) SendEmailVerification(ctx context.Context, id int64) error {
+	return c.send(ctx, http.MethodPost, fmt.Sprintf("/users/%d/email/verification", id), nil, nil)
+}
+
+// ImportUser 批量导入的用户，Role 为空时为普通用户
+type ImportUser struct {
+	Username     string     `json:"username"`
+	Password     string     `json:"password"`
+	Email        string     `json:"email,omitempty"`
+	Role         string     `json:"role,omitempty"`
+	TrafficLimit int64      `json:"traffic_limit,omitempty"`
+	ExpireAt     *time.Time `json:"expire_at,omitempty"`
+	Remark       string     `json:"remark,omitempty"`
+}
+
+// ImportUsers 批量导入用户。dryRun 为 true 时只返回计划；有冲突时不导入任何用户，
+// 返回 IsConflict 为 true 的错误，计划可通过 PlanFromError 取得
+func (c *Client) ImportUsers(ctx context.Context, users []ImportUser, dryRun bool) (*bulk.Plan, error) {
+	body := map[string]interface{}{"users": users, "dry_run": dryRun}
+	var plan bulk.Plan
+	if err := c.send(ctx, http.MethodPost, "/users/import", body, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
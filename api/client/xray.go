@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"v/version"
+)
+
+// XrayStatus Xray 运行状态
+type XrayStatus struct {
+	Running        bool   `json:"running"`
+	CurrentVersion string `json:"current_version"`
+}
+
+// XrayVersions 当前版本和可切换的版本
+type XrayVersions struct {
+	CurrentVersion    string   `json:"current_version"`
+	SupportedVersions []string `json:"supported_versions"`
+}
+
+// SwitchResult 切换 Xray 版本的结果
+type SwitchResult struct {
+	PreviousVersion string `json:"previous_version"`
+	CurrentVersion  string `json:"current_version"`
+	WasRunning      bool   `json:"was_running"`
+	IsRunning       bool   `json:"is_running"`
+	Status          string `json:"status"` // unchanged、switched 或 switched_but_stopped
+}
+
+// Version 面板和代理内核的版本及启用的功能
+type Version struct {
+	version.Info
+	XrayVersion string                 `json:"xray_version"`
+	StartedAt   time.Time              `json:"started_at"`
+	Uptime      time.Duration          `json:"uptime"`
+	Features    map[string]interface{} `json:"features"`
+}
+
+// XrayStatus 获取 Xray 运行状态
+func (c *Client) XrayStatus(ctx context.Context) (*XrayStatus, error) {
+	var status XrayStatus
+	if err := c.get(ctx, "/xray/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// StartXray 启动 Xray
+func (c *Client) StartXray(ctx context.Context) error {
+	return c.send(ctx, http.MethodPost, "/xray/start", nil, nil)
+}
+
+// StopXray 停止 Xray
+func (c *Client) StopXray(ctx context.Context) error {
+	return c.send(ctx, http.MethodPost, "/xray/stop", nil, nil)
+}
+
+// XrayVersions 获取当前版本和可切换的版本
+func (c *Client) XrayVersions(ctx context.Context) (*XrayVersions, error) {
+	var versions XrayVersions
+	if err := c.get(ctx, "/xray/versions", nil, &versions); err != nil {
+		return nil, err
+	}
+	return &versions, nil
+}
+
+// SwitchXrayVersion 切换 Xray 版本，运行中的 Xray 会以新版本重启
+func (c *Client) SwitchXrayVersion(ctx context.Context, v string) (*SwitchResult, error) {
+	var result SwitchResult
+	if err := c.send(ctx, http.MethodPost, "/xray/version", map[string]string{"version": v}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Version 获取面板版本、Xray 版本和启用的功能
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	var v Version
+	if err := c.get(ctx, "/version", nil, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
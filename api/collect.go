@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"v/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CollectHandler 流量采集目标监控处理器
+type CollectHandler struct {
+	collector *stats.Collector
+}
+
+// NewCollectHandler 创建流量采集目标监控处理器
+func NewCollectHandler(collector *stats.Collector) *CollectHandler {
+	return &CollectHandler{
+		collector: collector,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *CollectHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/monitor/collect-targets", h.ListTargets)
+}
+
+// ListTargets 获取各采集目标的最近状态，stale 表示长时间没有成功采集
+func (h *CollectHandler) ListTargets(c *gin.Context) {
+	targets := h.collector.Status()
+
+	stale := 0
+	for _, t := range targets {
+		if t.Stale {
+			stale++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"targets": targets,
+			"stale":   stale,
+		},
+	})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"v/connlimit"
+	"v/protocol"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConnLimitHandler 入站并发连接数指标
+type ConnLimitHandler struct {
+	limiter *connlimit.Limiter
+	mgr     *protocol.Manager
+}
+
+// NewConnLimitHandler 创建入站连接数指标处理器
+func NewConnLimitHandler(limiter *connlimit.Limiter, mgr *protocol.Manager) *ConnLimitHandler {
+	return &ConnLimitHandler{
+		limiter: limiter,
+		mgr:     mgr,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *ConnLimitHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/stats/connections", h.ListGauges)
+	router.GET("/stats/connections/:id", h.GetGauge)
+}
+
+// ListGauges 返回所有限制连接数的入站的当前和峰值连接数
+func (h *ConnLimitHandler) ListGauges(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.limiter.Gauges(),
+	})
+}
+
+// GetGauge 返回入站的当前和峰值连接数
+func (h *ConnLimitHandler) GetGauge(c *gin.Context) {
+	id, ok := protocolIDParam(c, h.mgr)
+	if !ok {
+		return
+	}
+
+	gauge, ok := h.limiter.Gauge(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "该入站未限制连接数",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gauge,
+	})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"v/crash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CrashHandler 查看最近的崩溃报告，便于用户反馈问题时附带
+type CrashHandler struct {
+	reporter *crash.Reporter
+}
+
+// NewCrashHandler 创建崩溃报告处理器
+func NewCrashHandler(reporter *crash.Reporter) *CrashHandler {
+	return &CrashHandler{reporter: reporter}
+}
+
+// RegisterRoutes 注册路由
+func (h *CrashHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/system/crashes", h.ListCrashes)
+}
+
+// ListCrashes 返回最近的崩溃报告，按时间倒序排列。查询参数 limit 默认 10
+func (h *CrashHandler) ListCrashes(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的数量参数",
+		})
+		return
+	}
+
+	reports, err := h.reporter.List(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "读取崩溃报告失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    reports,
+	})
+}
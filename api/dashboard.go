@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"v/model"
+	"v/monitor"
+	"v/stats"
+	"v/xray"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardAlertLimit 实时状态中返回的最近告警数量
+const dashboardAlertLimit = 10
+
+// LiveXray Xray 运行状态
+type LiveXray struct {
+	Running bool   `json:"running"`
+	Version string `json:"version"`
+}
+
+// LiveTraffic 用户累计流量，客户端按两次请求的差值计算速率
+type LiveTraffic struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+}
+
+// LiveStatus 终端仪表盘一次刷新所需的全部数据
+type LiveStatus struct {
+	Time        time.Time          `json:"time"`
+	Xray        LiveXray           `json:"xray"`
+	System      *model.SystemStats `json:"system,omitempty"`
+	SystemError string             `json:"system_error,omitempty"`
+	Traffic     []*LiveTraffic     `json:"traffic"`
+	Alerts      []*monitor.Alert   `json:"alerts"`
+}
+
+// DashboardHandler 终端仪表盘（v top）使用的实时状态接口，一次请求返回所有数据，避免每秒请求多个接口
+type DashboardHandler struct {
+	db     model.DB
+	xray   *xray.Manager
+	stats  *stats.Manager
+	alerts *monitor.AlertManager
+	system *monitor.SystemStatsMonitor
+
+	mu    sync.Mutex
+	names map[int64]string // 用户名缓存
+}
+
+// NewDashboardHandler 创建实时状态处理器
+func NewDashboardHandler(db model.DB, xrayMgr *xray.Manager, statsMgr *stats.Manager, alerts *monitor.AlertManager,
+	system *monitor.SystemStatsMonitor) *DashboardHandler {
+	return &DashboardHandler{
+		db:     db,
+		xray:   xrayMgr,
+		stats:  statsMgr,
+		alerts: alerts,
+		system: system,
+		names:  make(map[int64]string),
+	}
+}
+
+// RegisterRoutes 注册路由，router 需要已通过管理员认证
+func (h *DashboardHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/dashboard/live", h.GetLiveStatus)
+}
+
+// GetLiveStatus 返回流量计数、Xray 状态、系统状态和最近告警
+func (h *DashboardHandler) GetLiveStatus(c *gin.Context) {
+	status := &LiveStatus{
+		Time: time.Now(),
+		Xray: LiveXray{
+			Running: h.xray.IsRunning(),
+			Version: h.xray.GetCurrentVersion(),
+		},
+		Traffic: []*LiveTraffic{},
+		Alerts:  h.alerts.RecentAlerts(dashboardAlertLimit),
+	}
+
+	if sys, err := h.system.GetSystemStats(); err != nil {
+		status.SystemError = err.Error()
+	} else {
+		status.System = sys
+	}
+
+	for _, t := range h.stats.Snapshot() {
+		status.Traffic = append(status.Traffic, &LiveTraffic{
+			UserID:   t.UserID,
+			Username: h.username(t.UserID),
+			Upload:   t.Upload,
+			Download: t.Download,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+// username 返回用户名，用户不存在时返回 #ID
+func (h *DashboardHandler) username(userID int64) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if name, ok := h.names[userID]; ok {
+		return name
+	}
+	name := "#" + strconv.FormatInt(userID, 10)
+	if user, err := h.db.GetUser(userID); err != nil {
+		return name
+	} else if user != nil {
+		name = user.Username
+	}
+	h.names[userID] = name
+	return name
+}
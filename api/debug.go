@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"sort"
+	"time"
+
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxGCPauses 运行时指标中返回的最近 GC 暂停次数
+const maxGCPauses = 32
+
+// RuntimeMetrics 面板进程的运行时指标
+type RuntimeMetrics struct {
+	Uptime       time.Duration   `json:"uptime"`
+	GoVersion    string          `json:"go_version"`
+	GOMAXPROCS   int             `json:"gomaxprocs"`
+	NumCPU       int             `json:"num_cpu"`
+	Goroutines   int             `json:"goroutines"`
+	HeapAlloc    uint64          `json:"heap_alloc"`    // 堆上存活对象占用的字节数
+	HeapInuse    uint64          `json:"heap_inuse"`    // 正在使用的堆内存
+	HeapIdle     uint64          `json:"heap_idle"`     // 空闲未归还系统的堆内存
+	HeapReleased uint64          `json:"heap_released"` // 已归还系统的堆内存
+	HeapObjects  uint64          `json:"heap_objects"`
+	StackInuse   uint64          `json:"stack_inuse"`
+	Sys          uint64          `json:"sys"` // 从系统获取的内存总量
+	TotalAlloc   uint64          `json:"total_alloc"`
+	NumGC        uint32          `json:"num_gc"`
+	NextGC       uint64          `json:"next_gc"`
+	LastGC       *time.Time      `json:"last_gc,omitempty"`
+	GCCPUPercent float64         `json:"gc_cpu_percent"`
+	PauseTotal   time.Duration   `json:"pause_total"`
+	PauseMax     time.Duration   `json:"pause_max"` // 最近 GC 暂停的最大值
+	PauseP99     time.Duration   `json:"pause_p99"`
+	RecentPauses []time.Duration `json:"recent_pauses"` // 最近的 GC 暂停，新的在前
+	MemoryLimit  int64           `json:"memory_limit"`  // GOMEMLIMIT，未设置时为 math.MaxInt64
+}
+
+// DebugHandler 面板性能诊断：pprof、运行时指标和协程转储。
+// 需要 Debug.Profiling 开启，并由调用方在路由组上限制为管理员访问
+type DebugHandler struct {
+	settings *settings.Manager
+	started  time.Time
+}
+
+// NewDebugHandler 创建性能诊断处理器
+func NewDebugHandler(settingsMgr *settings.Manager) *DebugHandler {
+	return &DebugHandler{
+		settings: settingsMgr,
+		started:  time.Now(),
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *DebugHandler) RegisterRoutes(router *gin.RouterGroup) {
+	group := router.Group("/debug", h.requireEnabled)
+	group.GET("/runtime", h.GetRuntime)
+	group.GET("/goroutines", h.DownloadGoroutines)
+	group.GET("/pprof/", gin.WrapF(pprof.Index))
+	group.GET("/pprof/:name", h.Profile)
+	group.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+}
+
+// requireEnabled 未开启性能诊断时返回 404，不暴露接口存在
+func (h *DebugHandler) requireEnabled(c *gin.Context) {
+	if !h.settings.Get().Debug.Profiling {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "性能诊断未开启",
+		})
+		return
+	}
+	c.Next()
+}
+
+// GetRuntime 返回协程数、堆内存和 GC 暂停等运行时指标
+func (h *DebugHandler) GetRuntime(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	metrics := &RuntimeMetrics{
+		Uptime:       time.Since(h.started),
+		GoVersion:    runtime.Version(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapIdle:     m.HeapIdle,
+		HeapReleased: m.HeapReleased,
+		HeapObjects:  m.HeapObjects,
+		StackInuse:   m.StackInuse,
+		Sys:          m.Sys,
+		TotalAlloc:   m.TotalAlloc,
+		NumGC:        m.NumGC,
+		NextGC:       m.NextGC,
+		GCCPUPercent: m.GCCPUFraction * 100,
+		PauseTotal:   time.Duration(m.PauseTotalNs),
+		MemoryLimit:  debug.SetMemoryLimit(-1),
+	}
+	if m.LastGC > 0 {
+		last := time.Unix(0, int64(m.LastGC))
+		metrics.LastGC = &last
+	}
+
+	// PauseNs 是环形缓冲区，最近一次 GC 位于 (NumGC+255)%256
+	n := int(m.NumGC)
+	if n > maxGCPauses {
+		n = maxGCPauses
+	}
+	metrics.RecentPauses = make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		idx := (int(m.NumGC) - 1 - i + len(m.PauseNs)) % len(m.PauseNs)
+		metrics.RecentPauses = append(metrics.RecentPauses, time.Duration(m.PauseNs[idx]))
+	}
+	if n > 0 {
+		sorted := append([]time.Duration(nil), metrics.RecentPauses...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		metrics.PauseMax = sorted[n-1]
+		metrics.PauseP99 = sorted[(n*99-1)/100]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    metrics,
+	})
+}
+
+// DownloadGoroutines 下载所有协程的调用栈，用于排查卡死和协程泄漏
+func (h *DebugHandler) DownloadGoroutines(c *gin.Context) {
+	filename := fmt.Sprintf("goroutines-%s.txt", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+	rpprof.Lookup("goroutine").WriteTo(c.Writer, 2)
+}
+
+// Profile 按名称返回 pprof 数据，如 profile?seconds=30、heap、goroutine?debug=1、trace?seconds=5
+func (h *DebugHandler) Profile(c *gin.Context) {
+	switch name := c.Param("name"); name {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		if rpprof.Lookup(name) == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "未知的性能分析类型",
+			})
+			return
+		}
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"v/auth"
+	"v/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmailVerificationHandler 邮箱验证和修改
+type EmailVerificationHandler struct {
+	verifier *auth.EmailVerifier
+	db       model.DB
+}
+
+// NewEmailVerificationHandler 创建邮箱验证处理器
+func NewEmailVerificationHandler(verifier *auth.EmailVerifier, db model.DB) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		verifier: verifier,
+		db:       db,
+	}
+}
+
+// RegisterRoutes 注册验证链接的路由，无需登录
+func (h *EmailVerificationHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/auth/email/verify", h.Verify)
+	router.POST("/auth/email/verify", h.Verify)
+}
+
+// RegisterAccountRoutes 注册当前账号的邮箱路由，router 需要已通过登录认证
+func (h *EmailVerificationHandler) RegisterAccountRoutes(router *gin.RouterGroup) {
+	router.GET("/me/email", h.Status)
+	router.PUT("/me/email", h.Change)
+	router.POST("/me/email/verification", h.Resend)
+}
+
+// Verify 校验验证链接中的令牌，令牌可以放在 token 查询参数或 JSON 请求体中
+func (h *EmailVerificationHandler) Verify(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" && c.Request.Method == http.MethodPost {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求参数",
+				"error":   err.Error(),
+			})
+			return
+		}
+		token = req.Token
+	}
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "缺少验证令牌",
+		})
+		return
+	}
+
+	user, err := h.verifier.Verify(token)
+	if err != nil {
+		respondEmailError(c, "邮箱验证失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "邮箱已验证",
+		"data":    emailStatus(user),
+	})
+}
+
+// Status 返回当前账号的邮箱和验证状态
+func (h *EmailVerificationHandler) Status(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    emailStatus(user),
+	})
+}
+
+// Change 申请修改当前账号的邮箱，如 {"email":"new@example.com"}，新邮箱验证通过后生效
+func (h *EmailVerificationHandler) Change(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "未登录",
+		})
+		return
+	}
+
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	user, err := h.verifier.RequestChange(userID, req.Email)
+	if err != nil {
+		respondEmailError(c, "修改邮箱失败", err)
+		return
+	}
+
+	message := "验证邮件已发送到新邮箱，验证后生效"
+	if user.PendingEmail == "" {
+		message = "邮箱未修改"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    emailStatus(user),
+	})
+}
+
+// Resend 重新发送当前账号的验证邮件
+func (h *EmailVerificationHandler) Resend(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.verifier.SendVerification(user); err != nil {
+		respondEmailError(c, "发送验证邮件失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "验证邮件已发送",
+		"data":    emailStatus(user),
+	})
+}
+
+// currentUser 获取当前登录的用户，失败时已写入响应
+func (h *EmailVerificationHandler) currentUser(c *gin.Context) (*model.User, bool) {
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "未登录",
+		})
+		return nil, false
+	}
+
+	user, err := h.db.GetUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取用户失败",
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+// emailStatus 邮箱验证状态
+func emailStatus(user *model.User) gin.H {
+	return gin.H{
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"pending_email":  user.PendingEmail,
+	}
+}
+
+// respondEmailError 按邮箱验证错误类型返回对应的状态码
+func respondEmailError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrVerificationInvalid), errors.Is(err, auth.ErrVerificationExpired),
+		errors.Is(err, auth.ErrEmailMissing), errors.Is(err, auth.ErrEmailAlreadyVerified), errors.Is(err, auth.ErrInvalidEmail):
+		status = http.StatusBadRequest
+	case errors.Is(err, auth.ErrEmailInUse):
+		status = http.StatusConflict
+	case errors.Is(err, auth.ErrVerificationThrottled):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, model.ErrNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": message,
+		"error":   err.Error(),
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"v/events"
+	"v/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultPollTimeout 长轮询默认等待时长，低于常见代理的空闲超时
+	defaultPollTimeout = 25 * time.Second
+	// maxPollTimeout 长轮询最长等待时长
+	maxPollTimeout = 60 * time.Second
+	// maxPollLimit 每次最多返回的事件数
+	maxPollLimit = 100
+)
+
+// EventsHandler 实时事件长轮询处理器，用于代理不支持推送连接时的降级
+type EventsHandler struct {
+	log     *logger.Logger
+	history *events.History
+}
+
+// NewEventsHandler 创建实时事件长轮询处理器
+func NewEventsHandler(log *logger.Logger, history *events.History) *EventsHandler {
+	return &EventsHandler{
+		log:     log,
+		history: history,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *EventsHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/events/poll", h.Poll)
+}
+
+// Poll 返回游标之后的事件，没有新事件时挂起直到有事件或超时。
+// 查询参数：cursor（上次返回的游标，为空表示从保留的最早事件开始）、timeout（秒，默认 25，最大 60）、limit
+func (h *EventsHandler) Poll(c *gin.Context) {
+	var cursor int64
+	if value := c.Query("cursor"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的游标",
+			})
+			return
+		}
+		cursor = parsed
+	}
+
+	timeout := defaultPollTimeout
+	if value := c.Query("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的超时时间",
+			})
+			return
+		}
+		timeout = min(time.Duration(seconds)*time.Second, maxPollTimeout)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(maxPollLimit)))
+	if err != nil || limit < 1 {
+		limit = maxPollLimit
+	}
+	limit = min(limit, maxPollLimit)
+
+	result, err := h.history.Poll(c.Request.Context(), cursor, limit, timeout)
+	if err != nil {
+		if errors.Is(err, c.Request.Context().Err()) {
+			// 客户端已断开
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取事件失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"v/ha"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HAHandler 查看主备模式下本实例的角色和当前主节点
+type HAHandler struct {
+	elector *ha.Elector
+}
+
+// NewHAHandler 创建主备状态处理器
+func NewHAHandler(elector *ha.Elector) *HAHandler {
+	return &HAHandler{elector: elector}
+}
+
+// RegisterRoutes 注册路由
+func (h *HAHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/ha/status", h.GetStatus)
+}
+
+// GetStatus 返回本实例的角色、当前主节点和租约到期时间
+func (h *HAHandler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.elector.Status(),
+	})
+}
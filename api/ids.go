@@ -0,0 +1,32 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"v/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userIDParam 解析路径参数 id 中的用户标识，支持自增 ID 和 UUID，失败时写入错误响应
+func userIDParam(c *gin.Context, db model.DB) (int64, bool) {
+	id, err := model.ResolveUserID(db, c.Param("id"))
+	if err == nil {
+		return id, true
+	}
+
+	status, message := http.StatusInternalServerError, "获取用户失败"
+	switch {
+	case errors.Is(err, model.ErrInvalidID):
+		status, message = http.StatusBadRequest, "无效的用户ID"
+	case errors.Is(err, model.ErrNotFound):
+		status, message = http.StatusNotFound, "用户不存在"
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": message,
+		"error":   err.Error(),
+	})
+	return 0, false
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"v/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIngestBodySize 单次上报请求体上限
+const maxIngestBodySize = 4 << 20
+
+// IngestHandler 外部节点流量上报处理器
+type IngestHandler struct {
+	ingestor *stats.Ingestor
+}
+
+// NewIngestHandler 创建外部节点流量上报处理器
+func NewIngestHandler(ingestor *stats.Ingestor) *IngestHandler {
+	return &IngestHandler{
+		ingestor: ingestor,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *IngestHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/ingest/traffic", h.IngestTraffic)
+}
+
+// IngestTraffic 接收外部采集器批量上报的按用户流量计数，签名密钥按请求体中的节点名称选择
+// 请求头：X-Ingest-Timestamp（Unix 秒），X-Ingest-Signature（sha256=HMAC 十六进制）
+func (h *IngestHandler) IngestTraffic(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIngestBodySize+1))
+	if err != nil || len(body) > maxIngestBodySize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"message": "请求体过大",
+		})
+		return
+	}
+
+	var batch stats.IngestBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求数据",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.ingestor.Verify(batch.Node, c.GetHeader("X-Ingest-Timestamp"), c.GetHeader("X-Ingest-Signature"), body, time.Now()); err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, stats.ErrIngestDisabled) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "签名验证失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.ingestor.Ingest(&batch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求数据",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
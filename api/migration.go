@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"v/database"
+	"v/errors"
+	"v/logger"
+)
+
+// setupMigrationEndpoints sets up the pre-migration backup and rollback endpoints
+func (h *Handler) setupMigrationEndpoints() {
+	// List database snapshots taken before schema migrations
+	h.router.HandleFunc("/api/system/db/migration-backups", func(w http.ResponseWriter, r *http.Request) {
+		backups, err := database.ListMigrationBackups()
+		if err != nil {
+			h.handleError(w, errors.WithMessage(errors.ErrInternalServerError, err.Error()))
+			return
+		}
+
+		current := 0
+		if d := database.GetDB(); d != nil {
+			if v, err := d.GetCurrentVersion(); err == nil {
+				current = v
+			}
+		}
+
+		h.handleResponse(w, map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data": map[string]interface{}{
+				"current_version": current,
+				"backups":         backups,
+			},
+		})
+	}).Methods("GET")
+
+	// Restore a pre-migration snapshot and revert the migration records,
+	// the latest snapshot is used when no id is given
+	h.router.HandleFunc("/api/system/db/rollback-migration", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID string `json:"id"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				h.handleError(w, errors.ErrInvalidRequestBody)
+				return
+			}
+		}
+
+		d := database.GetDB()
+		if d == nil {
+			h.handleError(w, errors.WithMessage(errors.ErrResourceUnavailable, "数据库未初始化"))
+			return
+		}
+
+		backup, err := d.RollbackMigration(req.ID)
+		if err != nil {
+			switch err {
+			case database.ErrMigrationBackupNotFound:
+				h.handleError(w, errors.WithMessage(errors.ErrResourceNotFound, "迁移前备份不存在"))
+			case database.ErrNothingToRollback:
+				h.handleError(w, errors.WithMessage(errors.ErrConflict, "当前数据库版本没有可回滚的迁移"))
+			default:
+				h.handleError(w, errors.WithMessage(errors.ErrInternalServerError, err.Error()))
+			}
+			return
+		}
+
+		h.log.WithFields("Rolled back database migration", logger.Fields{
+			"backup":       backup.ID,
+			"from_version": backup.ToVersion,
+			"to_version":   backup.FromVersion,
+		})
+
+		h.handleResponse(w, map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data": map[string]interface{}{
+				"backup":  backup,
+				"version": backup.FromVersion,
+			},
+		})
+	}).Methods("POST")
+}
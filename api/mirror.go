@@ -0,0 +1,186 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"v/logger"
+	"v/mirror"
+	"v/protocol"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MirrorHandler 入站调试模式，记录连接元数据用于排查连接问题
+type MirrorHandler struct {
+	log     *logger.Logger
+	mirrors *mirror.Manager
+	mgr     *protocol.Manager
+}
+
+// NewMirrorHandler 创建入站调试处理器，会话开始和结束时请求重新生成 Xray 配置
+func NewMirrorHandler(log *logger.Logger, mirrors *mirror.Manager, mgr *protocol.Manager) *MirrorHandler {
+	h := &MirrorHandler{
+		log:     log,
+		mirrors: mirrors,
+		mgr:     mgr,
+	}
+	mirrors.SetOnChange(func(protocolID int64) {
+		if _, err := mgr.RequestApply(fmt.Sprintf("mirror protocol %d", protocolID)); err != nil {
+			log.ErrorWithFields("Failed to apply xray config for inbound mirror", logger.Fields{
+				"protocol_id": protocolID,
+				"error":       err.Error(),
+			})
+		}
+	})
+	return h
+}
+
+// RegisterRoutes 注册路由
+func (h *MirrorHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/mirrors", h.ListSessions)
+	router.POST("/protocols/:id/mirror", h.StartSession)
+	router.GET("/protocols/:id/mirror", h.GetSession)
+	router.DELETE("/protocols/:id/mirror", h.StopSession)
+}
+
+// ListSessions 列出所有调试会话
+func (h *MirrorHandler) ListSessions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.mirrors.Sessions(),
+	})
+}
+
+// StartSession 开启入站调试模式，duration 为持续秒数，默认且最长 10 分钟
+func (h *MirrorHandler) StartSession(c *gin.Context) {
+	id, ok := protocolIDParam(c, h.mgr)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Duration int `json:"duration"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求参数",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+	if req.Duration < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "持续时间不能为负数",
+		})
+		return
+	}
+
+	p, err := h.mgr.GetProtocol(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取协议失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if p.Type == "relay" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "端口中转不支持调试模式",
+		})
+		return
+	}
+	host := protocol.NormalizeListen(p.Listen)
+	if strings.HasPrefix(host, "/") || strings.HasPrefix(host, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Unix 域套接字入站不支持调试模式",
+		})
+		return
+	}
+	if host == "" {
+		host = protocol.ListenAllIPv4
+	}
+
+	session, err := h.mirrors.Start(id, net.JoinHostPort(host, strconv.Itoa(p.Port)), time.Duration(req.Duration)*time.Second)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, mirror.ErrSessionActive) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "开启调试模式失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "调试模式已开启",
+		"data":    session,
+	})
+}
+
+// GetSession 返回调试会话和连接记录
+func (h *MirrorHandler) GetSession(c *gin.Context) {
+	id, ok := protocolIDParam(c, h.mgr)
+	if !ok {
+		return
+	}
+
+	session, records, ok := h.mirrors.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "该协议不在调试模式",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"session": session,
+			"records": records,
+		},
+	})
+}
+
+// StopSession 结束调试模式
+func (h *MirrorHandler) StopSession(c *gin.Context) {
+	id, ok := protocolIDParam(c, h.mgr)
+	if !ok {
+		return
+	}
+
+	if err := h.mirrors.Stop(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, mirror.ErrNoSession) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "结束调试模式失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "调试模式已结束",
+	})
+}
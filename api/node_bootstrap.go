@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"v/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NodeBootstrapHandler 通过 SSH 一键引导新节点
+type NodeBootstrapHandler struct {
+	bootstrapper *node.Bootstrapper
+}
+
+// NewNodeBootstrapHandler 创建节点引导处理器
+func NewNodeBootstrapHandler(bootstrapper *node.Bootstrapper) *NodeBootstrapHandler {
+	return &NodeBootstrapHandler{bootstrapper: bootstrapper}
+}
+
+// RegisterRoutes 注册路由
+func (h *NodeBootstrapHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/nodes/bootstrap", h.StartBootstrap)
+	router.GET("/nodes/bootstrap", h.ListBootstraps)
+	router.GET("/nodes/bootstrap/:id", h.GetBootstrap)
+}
+
+// StartBootstrap 开始引导新节点，引导在后台执行，通过返回的任务 ID 查询进度。
+// 请求中的密码和私钥只用于本次连接，不会保存
+func (h *NodeBootstrapHandler) StartBootstrap(c *gin.Context) {
+	var req node.BootstrapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	job, err := h.bootstrapper.Start(req, c.GetString("username"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, node.ErrBootstrapRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "无法开始引导节点",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "节点引导已开始",
+		"data":    job,
+	})
+}
+
+// ListBootstraps 列出最近的引导任务
+func (h *NodeBootstrapHandler) ListBootstraps(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.bootstrapper.Jobs(),
+	})
+}
+
+// GetBootstrap 查询引导任务的进度和各步骤输出
+func (h *NodeBootstrapHandler) GetBootstrap(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的任务ID",
+		})
+		return
+	}
+
+	job, ok := h.bootstrapper.Job(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "引导任务不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"v/node"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NodeBudgetHandler 本节点月流量预算处理器
+type NodeBudgetHandler struct {
+	budget *node.Budget
+}
+
+// NewNodeBudgetHandler 创建流量预算处理器
+func NewNodeBudgetHandler(budget *node.Budget) *NodeBudgetHandler {
+	return &NodeBudgetHandler{budget: budget}
+}
+
+// RegisterRoutes 注册路由
+func (h *NodeBudgetHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/nodes/budget", h.GetBudget)
+}
+
+// GetBudget 返回本周期的流量用量、预计用量和正在执行的处理
+func (h *NodeBudgetHandler) GetBudget(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.budget.Status(time.Now()),
+	})
+}
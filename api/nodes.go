@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"v/node"
+	"v/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLatencyReportSize 单次延迟上报请求体上限
+const maxLatencyReportSize = 1 << 20
+
+// NodeHandler 节点间延迟矩阵处理器
+type NodeHandler struct {
+	matrix   *node.Matrix
+	ingestor *stats.Ingestor
+}
+
+// NewNodeHandler 创建节点间延迟矩阵处理器，上报签名与外部流量上报使用相同的密钥校验
+func NewNodeHandler(matrix *node.Matrix, ingestor *stats.Ingestor) *NodeHandler {
+	return &NodeHandler{
+		matrix:   matrix,
+		ingestor: ingestor,
+	}
+}
+
+// RegisterRoutes 注册节点上报的路由，上报请求通过签名认证，无需登录
+func (h *NodeHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/ingest/latency", h.IngestLatency)
+}
+
+// RegisterAdminRoutes 注册查看延迟矩阵的路由，router 需要已通过管理员认证
+func (h *NodeHandler) RegisterAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/nodes/latency", h.GetMatrix)
+	router.GET("/nodes/latency/route", h.SuggestRoute)
+}
+
+// IngestLatency 接收节点上报的一轮延迟探测结果，引导的节点使用各自的专用密钥签名
+// 请求头：X-Ingest-Timestamp（Unix 秒），X-Ingest-Signature（sha256=HMAC 十六进制）
+func (h *NodeHandler) IngestLatency(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLatencyReportSize+1))
+	if err != nil || len(body) > maxLatencyReportSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"message": "请求体过大",
+		})
+		return
+	}
+
+	var report node.Report
+	if err := json.Unmarshal(body, &report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求数据",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.ingestor.Verify(report.Node, c.GetHeader("X-Ingest-Timestamp"), c.GetHeader("X-Ingest-Signature"), body, time.Now()); err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, stats.ErrIngestDisabled) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "签名验证失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.matrix.Record(&report, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求数据",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// GetMatrix 获取节点间延迟和丢包矩阵
+func (h *NodeHandler) GetMatrix(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.matrix.Snapshot(time.Now()),
+	})
+}
+
+// SuggestRoute 根据延迟矩阵建议从 from 到 to 的最优中转链路
+func (h *NodeHandler) SuggestRoute(c *gin.Context) {
+	route, err := h.matrix.SuggestRoute(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "节点之间没有可用的链路",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    route,
+	})
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"v/inbox"
+	"v/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxNotificationPageSize 通知列表每页最大条数
+const maxNotificationPageSize = 100
+
+// NotificationHandler 通知中心处理器
+type NotificationHandler struct {
+	inbox *inbox.Inbox
+}
+
+// NewNotificationHandler 创建通知中心处理器
+func NewNotificationHandler(box *inbox.Inbox) *NotificationHandler {
+	return &NotificationHandler{inbox: box}
+}
+
+// RegisterRoutes 注册路由
+func (h *NotificationHandler) RegisterRoutes(router *gin.RouterGroup) {
+	group := router.Group("/notifications")
+	{
+		group.GET("", h.List)
+		group.GET("/unread-count", h.UnreadCount)
+		group.POST("/read", h.MarkRead)
+		group.POST("/read-all", h.MarkAllRead)
+	}
+}
+
+// List 分页获取通知，最新的在前
+// 查询参数：category（alert、backup、certificate、update、job）、level（info、warning、error）、
+// unread=true 只返回未读、since 和 until（RFC3339）、page、page_size
+func (h *NotificationHandler) List(c *gin.Context) {
+	query, ok := notificationQuery(c)
+	if !ok {
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	query.Page = page
+	query.PageSize = min(pageSize, maxNotificationPageSize)
+
+	items, total, err := h.inbox.List(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取通知失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	unread, err := h.inbox.UnreadCount()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取未读通知数量失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"notifications": items,
+			"total":         total,
+			"unread":        unread,
+			"page":          query.Page,
+			"page_size":     query.PageSize,
+		},
+	})
+}
+
+// UnreadCount 获取未读通知数量，供界面显示角标
+func (h *NotificationHandler) UnreadCount(c *gin.Context) {
+	unread, err := h.inbox.UnreadCount()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取未读通知数量失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"unread": unread},
+	})
+}
+
+// MarkRead 将指定通知标记为已读，请求体：{"ids": [1, 2]}
+func (h *NotificationHandler) MarkRead(c *gin.Context) {
+	var req struct {
+		IDs []int64 `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请指定要标记的通知",
+		})
+		return
+	}
+
+	updated, err := h.inbox.MarkRead(req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "标记通知失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"updated": updated},
+	})
+}
+
+// MarkAllRead 将未读通知全部标记为已读，支持与列表相同的 category、level、since、until 过滤参数
+func (h *NotificationHandler) MarkAllRead(c *gin.Context) {
+	query, ok := notificationQuery(c)
+	if !ok {
+		return
+	}
+
+	updated, err := h.inbox.MarkAllRead(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "标记通知失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"updated": updated},
+	})
+}
+
+// notificationQuery 解析通知的过滤参数，参数无效时已写入响应并返回 false
+func notificationQuery(c *gin.Context) (*model.NotificationQuery, bool) {
+	query := &model.NotificationQuery{
+		Category: c.Query("category"),
+		Level:    c.Query("level"),
+		Unread:   c.Query("unread") == "true",
+	}
+	for param, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的时间格式",
+				"error":   err.Error(),
+			})
+			return nil, false
+		}
+		*target = t
+	}
+	return query, true
+}
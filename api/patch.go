@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mergePatchContentType JSON Merge Patch（RFC 7396）的媒体类型，同时接受 application/json
+const mergePatchContentType = "application/merge-patch+json"
+
+// maxPatchBody PATCH 请求体最大长度
+const maxPatchBody = 1 << 20
+
+// errInvalidPatch 补丁不是 JSON 对象
+var errInvalidPatch = errors.New("merge patch must be a JSON object")
+
+// mergePatch 按 RFC 7396 将补丁合并到 JSON 文档：对象逐字段递归合并，null 删除字段，其他值整体替换
+func mergePatch(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %v", err)
+	}
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode patch: %v", err)
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return nil, errInvalidPatch
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+// mergeValue 合并单个值
+func mergeValue(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergeValue(t[key], value)
+	}
+	return t
+}
+
+// patchKeys 返回补丁中的顶层字段
+func patchKeys(patch []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil || fields == nil {
+		return nil, errInvalidPatch
+	}
+	return fields, nil
+}
+
+// readOnlyField 返回补丁中第一个只读字段，没有时返回空字符串
+func readOnlyField(patch []byte, readOnly []string) string {
+	fields, err := patchKeys(patch)
+	if err != nil {
+		return ""
+	}
+	for _, name := range readOnly {
+		if _, ok := fields[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// readMergePatch 读取请求体中的合并补丁，检查媒体类型和格式，失败时写入错误响应
+func readMergePatch(c *gin.Context) ([]byte, bool) {
+	if ct := c.GetHeader("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != mergePatchContentType && mediaType != "application/json") {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"success": false,
+				"message": "不支持的补丁格式，请使用 " + mergePatchContentType,
+			})
+			return nil, false
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPatchBody+1))
+	if err == nil && len(body) > maxPatchBody {
+		err = fmt.Errorf("patch exceeds %d bytes", maxPatchBody)
+	}
+	if err == nil {
+		_, err = patchKeys(bytes.TrimSpace(body))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的补丁",
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	return body, true
+}
+
+// applyMergePatch 将补丁应用到 current 的 JSON 表示并解码到 out，out 应为新的零值对象
+func applyMergePatch(current interface{}, patch []byte, out interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("failed to encode current state: %v", err)
+	}
+	merged, err := mergePatch(doc, patch)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(merged, out); err != nil {
+		return fmt.Errorf("failed to decode patched state: %v", err)
+	}
+	return nil
+}
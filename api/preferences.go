@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+
+	"v/preferences"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreferencesHandler 当前登录账号的界面偏好设置
+type PreferencesHandler struct {
+	store *preferences.Store
+}
+
+// NewPreferencesHandler 创建偏好设置处理器
+func NewPreferencesHandler(store *preferences.Store) *PreferencesHandler {
+	return &PreferencesHandler{store: store}
+}
+
+// RegisterRoutes 注册路由，router 需要已通过登录认证
+func (h *PreferencesHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/me/preferences", h.Get)
+	router.PUT("/me/preferences", h.Update)
+}
+
+// Get 返回当前账号的偏好设置
+func (h *PreferencesHandler) Get(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "未登录",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.store.Get(userID),
+	})
+}
+
+// Update 合并更新当前账号的偏好设置，如 {"theme":"dark","page_size":50}，值为 null 的键会被删除
+func (h *PreferencesHandler) Update(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "未登录",
+		})
+		return
+	}
+
+	var patch preferences.Preferences
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	prefs, err := h.store.Update(userID, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "保存偏好设置失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "偏好设置已保存",
+		"data":    prefs,
+	})
+}
@@ -1,8 +1,13 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"v/logger"
 	"v/model"
@@ -33,9 +38,23 @@ func (h *ProtocolHandler) RegisterRoutes(router *gin.RouterGroup) {
 		protocolGroup.GET("/:id", h.GetProtocol)
 		protocolGroup.POST("", h.CreateProtocol)
 		protocolGroup.PUT("/:id", h.UpdateProtocol)
+		protocolGroup.PATCH("/:id", h.PatchProtocol)
 		protocolGroup.DELETE("/:id", h.DeleteProtocol)
 		protocolGroup.GET("/stats", h.GetProtocolStats)
 		protocolGroup.GET("/types", h.GetProtocolTypes)
+		protocolGroup.GET("/schema", h.GetProtocolSchema)
+		protocolGroup.GET("/apply", h.GetApplyStatus)
+		protocolGroup.GET("/apply/:change", h.GetApplyChange)
+		protocolGroup.GET("/search", h.SearchProtocols)
+		protocolGroup.POST("/cdn/check", h.CheckCDNDomain)
+		protocolGroup.POST("/lint", h.LintProtocol)
+		protocolGroup.GET("/:id/lint", h.LintSavedProtocol)
+		protocolGroup.GET("/:id/versions", h.ListProtocolVersions)
+		protocolGroup.POST("/:id/rollback/:version", h.RollbackProtocol)
+		protocolGroup.POST("/:id/clone", h.CloneProtocol)
+		protocolGroup.GET("/:id/schedule", h.GetProtocolSchedule)
+		protocolGroup.PUT("/:id/schedule", h.SaveProtocolSchedule)
+		protocolGroup.DELETE("/:id/schedule", h.DeleteProtocolSchedule)
 	}
 }
 
@@ -83,18 +102,44 @@ func (h *ProtocolHandler) ListProtocols(c *gin.Context) {
 	})
 }
 
-// GetProtocol 获取指定协议
-func (h *ProtocolHandler) GetProtocol(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
+// SearchProtocols 搜索协议，支持备注、标签、端口等字段的模糊匹配
+func (h *ProtocolHandler) SearchProtocols(c *gin.Context) {
+	query := c.Query("q")
+	if len(model.SearchTerms(query)) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "无效的协议ID",
+			"message": "搜索关键词不能为空",
+		})
+		return
+	}
+
+	results, err := h.mgr.SearchProtocols(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "搜索协议失败",
 			"error":   err.Error(),
 		})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"protocols": results,
+			"total":     len(results),
+			"terms":     model.SearchTerms(query),
+		},
+	})
+}
+
+// GetProtocol 获取指定协议
+func (h *ProtocolHandler) GetProtocol(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
 	protocol, err := h.mgr.GetProtocol(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -131,7 +176,33 @@ func (h *ProtocolHandler) CreateProtocol(c *gin.Context) {
 		return
 	}
 
-	if err := h.mgr.CreateProtocol(&protocol); err != nil {
+	warnings, err := applyCDNDefaults(&protocol)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "CDN 配置无效",
+			"error":   err.Error(),
+		})
+		return
+	}
+	lintWarnings, ok := h.lintBeforeSave(c, &protocol)
+	if !ok {
+		return
+	}
+	warnings = append(warnings, lintWarnings...)
+
+	if err := h.mgr.CreateProtocolAs(&protocol, c.GetString("username")); err != nil {
+		if isListenError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的监听地址",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if writePortError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "创建协议失败",
@@ -139,23 +210,21 @@ func (h *ProtocolHandler) CreateProtocol(c *gin.Context) {
 		})
 		return
 	}
+	change, warnings := h.requestApply(fmt.Sprintf("create protocol %d", protocol.ID), warnings)
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "协议创建成功",
-		"data":    protocol,
+		"success":  true,
+		"message":  "协议创建成功",
+		"data":     protocol,
+		"warnings": warnings,
+		"apply":    change,
 	})
 }
 
 // UpdateProtocol 更新协议
 func (h *ProtocolHandler) UpdateProtocol(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "无效的协议ID",
-			"error":   err.Error(),
-		})
+	id, ok := h.protocolID(c)
+	if !ok {
 		return
 	}
 
@@ -170,7 +239,33 @@ func (h *ProtocolHandler) UpdateProtocol(c *gin.Context) {
 	}
 
 	protocol.ID = id
-	if err := h.mgr.UpdateProtocol(&protocol); err != nil {
+	warnings, err := applyCDNDefaults(&protocol)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "CDN 配置无效",
+			"error":   err.Error(),
+		})
+		return
+	}
+	lintWarnings, ok := h.lintBeforeSave(c, &protocol)
+	if !ok {
+		return
+	}
+	warnings = append(warnings, lintWarnings...)
+
+	if err := h.mgr.UpdateProtocolAs(&protocol, c.GetString("username")); err != nil {
+		if isListenError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的监听地址",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if writePortError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "更新协议失败",
@@ -178,38 +273,305 @@ func (h *ProtocolHandler) UpdateProtocol(c *gin.Context) {
 		})
 		return
 	}
+	change, warnings := h.requestApply(fmt.Sprintf("update protocol %d", protocol.ID), warnings)
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "协议更新成功",
-		"data":    protocol,
+		"success":  true,
+		"message":  "协议更新成功",
+		"data":     protocol,
+		"warnings": warnings,
+		"apply":    change,
 	})
 }
 
-// DeleteProtocol 删除协议
-func (h *ProtocolHandler) DeleteProtocol(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+// protocolReadOnlyFields 由服务端维护、不能通过补丁修改的协议字段
+var protocolReadOnlyFields = []string{"id", "uuid", "created_at", "updated_at", "traffic_used", "last_active"}
+
+// protocolDocument 协议的补丁文档，settings 以 JSON 对象而不是 base64 呈现，便于只修改其中的单个字段
+type protocolDocument struct {
+	model.Protocol
+	Settings json.RawMessage `json:"settings"`
+}
+
+// PatchProtocol 按 JSON Merge Patch（RFC 7396）修改协议的部分字段，合并后的协议校验通过才会保存
+func (h *ProtocolHandler) PatchProtocol(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+	patch, ok := readMergePatch(c)
+	if !ok {
+		return
+	}
+	if field := readOnlyField(patch, protocolReadOnlyFields); field != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "字段不可修改：" + field,
+		})
+		return
+	}
+
+	current, err := h.mgr.GetProtocol(id)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取协议失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if current == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "协议不存在",
+		})
+		return
+	}
+
+	doc := protocolDocument{Protocol: *current}
+	if json.Valid(current.Settings) {
+		doc.Settings = json.RawMessage(current.Settings)
+	}
+	var patched protocolDocument
+	if err := applyMergePatch(doc, patch, &patched); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "无效的协议ID",
+			"message": "无效的补丁",
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	if err := h.mgr.DeleteProtocol(id); err != nil {
+	protocol := patched.Protocol
+	protocol.ID = current.ID
+	protocol.UUID = current.UUID
+	protocol.CreatedAt = current.CreatedAt
+	protocol.TrafficUsed = current.TrafficUsed
+	protocol.LastActive = current.LastActive
+	protocol.Settings, err = patchedSettings(patched.Settings)
+	if err == nil {
+		err = h.validatePatched(&protocol)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "修改后的协议无效",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	warnings, err := applyCDNDefaults(&protocol)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "CDN 配置无效",
+			"error":   err.Error(),
+		})
+		return
+	}
+	lintWarnings, ok := h.lintBeforeSave(c, &protocol)
+	if !ok {
+		return
+	}
+	warnings = append(warnings, lintWarnings...)
+
+	if err := h.mgr.UpdateProtocolAs(&protocol, c.GetString("username")); err != nil {
+		if isListenError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的监听地址",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if writePortError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"message": "删除协议失败",
+			"message": "更新协议失败",
 			"error":   err.Error(),
 		})
 		return
 	}
+	change, warnings := h.requestApply(fmt.Sprintf("update protocol %d", protocol.ID), warnings)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "协议更新成功",
+		"data":     protocol,
+		"warnings": warnings,
+		"apply":    change,
+	})
+}
+
+// patchedSettings 将补丁文档中的 settings 还原为保存格式，兼容 PUT 使用的 base64 字符串
+func patchedSettings(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var settings []byte
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, fmt.Errorf("invalid settings: %v", err)
+		}
+		return settings, nil
+	}
+	if raw[0] != '{' {
+		return nil, fmt.Errorf("settings must be a JSON object")
+	}
+	return []byte(raw), nil
+}
+
+// validatePatched 检查合并后的协议，监听地址由 UpdateProtocolAs 校验
+func (h *ProtocolHandler) validatePatched(p *model.Protocol) error {
+	supported := false
+	for _, t := range h.mgr.GetSupportedProtocolTypes() {
+		if p.Type == t {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("unsupported protocol type %q", p.Type)
+	}
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("port %d out of range", p.Port)
+	}
+	if p.TrafficLimit < 0 {
+		return fmt.Errorf("traffic_limit must not be negative")
+	}
+	if len(p.Settings) > 0 && !json.Valid(p.Settings) {
+		return fmt.Errorf("settings is not valid JSON")
+	}
+	return nil
+}
+
+// DeleteProtocol 删除协议
+func (h *ProtocolHandler) DeleteProtocol(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
+	// confirm=true 确认删除最近有流量的协议，archive=false 直接删除统计数据
+	opts := protocol.DeleteOptions{
+		Confirm: c.Query("confirm") == "true",
+		Archive: c.DefaultQuery("archive", "true") != "false",
+	}
+	change, err := h.mgr.DeleteProtocolWith(id, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, protocol.ErrDeleteConfirmationRequired):
+			c.JSON(http.StatusConflict, gin.H{
+				"success":          false,
+				"message":          "协议最近24小时内有流量，请确认后删除",
+				"error":            err.Error(),
+				"confirm_required": true,
+			})
+		case errors.Is(err, model.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "协议不存在",
+				"error":   err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "删除协议失败",
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "协议删除成功",
+		"apply":   change,
+	})
+}
+
+// cloneProtocolRequest 复制协议请求，字段均可省略
+type cloneProtocolRequest struct {
+	Port   int    `json:"port"`
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+// CloneProtocol 以现有协议为模板创建新协议，使用新端口和新凭据，可指定其他用户
+func (h *ProtocolHandler) CloneProtocol(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
+	var req cloneProtocolRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求参数",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	opts := protocol.CloneOptions{
+		Port:   req.Port,
+		UserID: req.UserID,
+		Name:   req.Name,
+	}
+	clone, err := h.mgr.CloneProtocolAs(id, opts, c.GetString("username"))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "协议或用户不存在",
+				"error":   err.Error(),
+			})
+		case errors.Is(err, protocol.ErrPortInUse):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "端口已被其他协议使用",
+				"error":   err.Error(),
+			})
+		case errors.Is(err, protocol.ErrInvalidPort):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的端口",
+				"error":   err.Error(),
+			})
+		case isListenError(err):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的监听地址",
+				"error":   err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "复制协议失败",
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	change, warnings := h.requestApply(fmt.Sprintf("clone protocol %d", id), nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "协议复制成功",
+		"data":     clone,
+		"warnings": warnings,
+		"apply":    change,
 	})
 }
 
@@ -239,3 +601,372 @@ func (h *ProtocolHandler) GetProtocolTypes(c *gin.Context) {
 		"data":    types,
 	})
 }
+
+// GetProtocolSchema 获取协议配置描述
+func (h *ProtocolHandler) GetProtocolSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.mgr.Schema(),
+	})
+}
+
+// ListProtocolVersions 获取协议配置历史
+func (h *ProtocolHandler) ListProtocolVersions(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.mgr.ListVersions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取协议历史版本失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    versions,
+	})
+}
+
+// RollbackProtocol 将协议回滚到指定版本
+func (h *ProtocolHandler) RollbackProtocol(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的版本号",
+		})
+		return
+	}
+
+	restored, change, err := h.mgr.Rollback(id, version, c.GetString("username"))
+	if err != nil {
+		if errors.Is(err, protocol.ErrVersionNotFound) || errors.Is(err, model.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "协议或版本不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if writePortError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "回滚协议失败",
+			"error":   err.Error(),
+			"data":    restored,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "协议回滚成功",
+		"data":    restored,
+		"apply":   change,
+	})
+}
+
+// GetProtocolSchedule 获取协议的定时启用计划
+func (h *ProtocolHandler) GetProtocolSchedule(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.mgr.GetSchedule(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取协议计划失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "协议没有定时计划",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schedule,
+	})
+}
+
+// SaveProtocolSchedule 设置协议的定时启用计划，下一次检查时按当前时段生效
+func (h *ProtocolHandler) SaveProtocolSchedule(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
+	var schedule model.ProtocolSchedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+	schedule.ProtocolID = id
+
+	if err := h.mgr.SaveSchedule(&schedule); err != nil {
+		status, message := http.StatusInternalServerError, "保存协议计划失败"
+		if errors.Is(err, model.ErrInvalidSchedule) {
+			status, message = http.StatusBadRequest, "无效的协议计划"
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": message,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "协议计划已保存",
+		"data":    schedule,
+	})
+}
+
+// DeleteProtocolSchedule 删除协议的定时启用计划，协议保持当前状态
+func (h *ProtocolHandler) DeleteProtocolSchedule(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.mgr.DeleteSchedule(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "删除协议计划失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "协议计划已删除",
+	})
+}
+
+// requestApply 保存成功后请求重新生成 Xray 配置，未使用队列且同步应用失败时追加到警告中
+func (h *ProtocolHandler) requestApply(reason string, warnings []string) (*protocol.ApplyChange, []string) {
+	change, err := h.mgr.RequestApply(reason)
+	if err != nil {
+		h.log.ErrorWithFields("Failed to apply xray config", logger.Fields{
+			"reason": reason,
+			"error":  err.Error(),
+		})
+		warnings = append(warnings, "protocol saved but xray config was not reloaded: "+err.Error())
+	}
+	return change, warnings
+}
+
+// GetApplyStatus 获取配置应用队列状态，包括等待中的变更数和最近变更的应用结果
+func (h *ProtocolHandler) GetApplyStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.mgr.ApplyStatus(),
+	})
+}
+
+// GetApplyChange 获取单次配置变更的应用状态
+func (h *ProtocolHandler) GetApplyChange(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("change"), 10, 64)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的变更ID",
+		})
+		return
+	}
+
+	change, ok := h.mgr.GetApplyChange(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "变更不存在或已过期",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    change,
+	})
+}
+
+// lintBeforeSave 保存前检查协议配置，不探测外部地址。有错误时写入 400 响应并返回 false，否则返回警告
+func (h *ProtocolHandler) lintBeforeSave(c *gin.Context, p *model.Protocol) ([]string, bool) {
+	report := h.mgr.Lint(c.Request.Context(), p, protocol.LintOptions{})
+	if report.HasErrors() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "协议配置有误",
+			"error":   report.Err().Error(),
+			"data":    report,
+		})
+		return nil, false
+	}
+	return report.WarningMessages(), true
+}
+
+// LintProtocol 检查请求中的协议配置而不保存，默认探测外部地址，probe=false 时只做静态检查
+func (h *ProtocolHandler) LintProtocol(c *gin.Context) {
+	var p model.Protocol
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	report := h.mgr.Lint(c.Request.Context(), &p, protocol.LintOptions{Probe: c.Query("probe") != "false"})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// LintSavedProtocol 检查已保存的协议配置
+func (h *ProtocolHandler) LintSavedProtocol(c *gin.Context) {
+	id, ok := h.protocolID(c)
+	if !ok {
+		return
+	}
+	p, err := h.mgr.GetProtocol(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取协议失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "协议不存在",
+		})
+		return
+	}
+
+	report := h.mgr.Lint(c.Request.Context(), p, protocol.LintOptions{Probe: c.Query("probe") != "false"})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// applyCDNDefaults 为 CDN 模式的协议补全推荐参数，处理函数中的局部变量会遮蔽 protocol 包名
+func applyCDNDefaults(p *model.Protocol) ([]string, error) {
+	return protocol.ApplyCDNDefaults(p)
+}
+
+// isListenError 判断是否为监听地址校验错误
+func isListenError(err error) bool {
+	return errors.Is(err, protocol.ErrInvalidListenAddress) || errors.Is(err, protocol.ErrListenAddressNotFound)
+}
+
+// writePortError 端口无效或与其他协议冲突时写入响应并返回 true
+func writePortError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, protocol.ErrPortInUse):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "端口已被其他协议使用",
+			"error":   err.Error(),
+		})
+	case errors.Is(err, protocol.ErrInvalidPort):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的端口",
+			"error":   err.Error(),
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// CheckCDNDomain 检查域名是否已通过 Cloudflare 代理
+func (h *ProtocolHandler) CheckCDNDomain(c *gin.Context) {
+	var req struct {
+		Domain string `json:"domain" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	result, err := protocol.VerifyCloudflareDomain(ctx, req.Domain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "域名检测失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// protocolID 解析路径中的协议标识，支持自增 ID 和 UUID，失败时写入错误响应
+func (h *ProtocolHandler) protocolID(c *gin.Context) (int64, bool) {
+	return protocolIDParam(c, h.mgr)
+}
+
+// protocolIDParam 解析路径中的协议 ID 或 UUID，失败时写入错误响应
+func protocolIDParam(c *gin.Context, mgr *protocol.Manager) (int64, bool) {
+	id, err := mgr.ResolveID(c.Param("id"))
+	if err == nil {
+		return id, true
+	}
+
+	status, message := http.StatusInternalServerError, "获取协议失败"
+	switch {
+	case errors.Is(err, model.ErrInvalidID):
+		status, message = http.StatusBadRequest, "无效的协议ID"
+	case errors.Is(err, model.ErrNotFound):
+		status, message = http.StatusNotFound, "协议不存在"
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": message,
+		"error":   err.Error(),
+	})
+	return 0, false
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+	"v/stats"
+	"v/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultTopTalkers 流量排行默认返回数量
+	defaultTopTalkers = 10
+	// maxTopTalkers 流量排行最大返回数量
+	maxTopTalkers = 100
+	// maxReportRange 报告支持的最长时间段
+	maxReportRange = 90 * 24 * time.Hour
+)
+
+// ReportHandler 运营报告处理器
+type ReportHandler struct {
+	log       *logger.Logger
+	settings  *settings.Manager
+	db        model.DB
+	geo       *stats.GeoStats
+	collector *stats.Collector
+}
+
+// NewReportHandler 创建运营报告处理器
+func NewReportHandler(log *logger.Logger, settingsMgr *settings.Manager, db model.DB, geo *stats.GeoStats) *ReportHandler {
+	return &ReportHandler{
+		log:      log,
+		settings: settingsMgr,
+		db:       db,
+		geo:      geo,
+	}
+}
+
+// SetCollector 设置流量采集器，报告中会列出使用采样模式的节点及其误差范围
+func (h *ReportHandler) SetCollector(collector *stats.Collector) {
+	h.collector = collector
+}
+
+// RegisterRoutes 注册路由
+func (h *ReportHandler) RegisterRoutes(router *gin.RouterGroup) {
+	reportGroup := router.Group("/reports")
+	{
+		reportGroup.GET("/top-talkers", h.GetTopTalkers)
+		reportGroup.GET("/countries", h.GetCountryStats)
+	}
+}
+
+// GetTopTalkers 获取时间段内流量最高的用户和协议，并与上一个等长时间段比较
+// 查询参数：range 时间段（如 24h、7d，默认 24h），limit 返回数量（默认 10，最大 100），
+// align=day 时按面板时区的自然日对齐，如 7d 表示今天零点起往前 7 个自然日
+func (h *ReportHandler) GetTopTalkers(c *gin.Context) {
+	period, err := parseReportRange(c.DefaultQuery("range", "24h"))
+	if err != nil || period <= 0 || period > maxReportRange {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的时间段",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultTopTalkers)))
+	if err != nil || limit < 1 {
+		limit = defaultTopTalkers
+	} else if limit > maxTopTalkers {
+		limit = maxTopTalkers
+	}
+
+	end := time.Now().In(h.settings.Location())
+	start := end.Add(-period)
+	if c.Query("align") == "day" {
+		days := int((period + 24*time.Hour - 1) / (24 * time.Hour))
+		start = utils.StartOfDay(end).AddDate(0, 0, 1-days)
+		period = end.Sub(start)
+	}
+	report := &model.TopTalkersReport{
+		Start:         start,
+		End:           end,
+		PreviousStart: start.Add(-period),
+	}
+
+	if report.Users, err = h.db.GetTopUsersByTraffic(start, end, limit); err != nil {
+		h.log.ErrorWithFields("Failed to get top users by traffic", logger.Fields{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取用户流量排行失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if report.Protocols, err = h.db.GetTopProtocolsByTraffic(start, end, limit); err != nil {
+		h.log.ErrorWithFields("Failed to get top protocols by traffic", logger.Fields{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取协议流量排行失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if h.collector != nil {
+		if sampled := h.collector.Sampling(); len(sampled) > 0 {
+			report.Sampled = sampled
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// GetCountryStats 获取按来源国家汇总的连接数和流量
+// 查询参数：group 分组方式（country 只按国家，inbound 按国家和入站，user 按国家和用户，默认 country）
+func (h *ReportHandler) GetCountryStats(c *gin.Context) {
+	group := c.DefaultQuery("group", stats.GroupCountry)
+	switch group {
+	case stats.GroupCountry, stats.GroupInbound, stats.GroupUser:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的分组方式",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.geo.Report(group),
+	})
+}
+
+// parseReportRange 解析时间段，除 Go duration 格式外还支持按天表示，如 7d
+func parseReportRange(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
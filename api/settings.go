@@ -29,6 +29,7 @@ func (h *SettingsHandler) RegisterRoutes(router *gin.RouterGroup) {
 	{
 		settingsGroup.GET("", h.GetSettings)
 		settingsGroup.PUT("", h.UpdateSettings)
+		settingsGroup.PATCH("", h.PatchSettings)
 		settingsGroup.GET("/sections/:section", h.GetSectionSettings)
 		settingsGroup.PUT("/sections/:section", h.UpdateSectionSettings)
 		settingsGroup.POST("/backup", h.BackupSettings)
@@ -72,6 +73,40 @@ func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
 	})
 }
 
+// PatchSettings 按 JSON Merge Patch（RFC 7396）修改部分设置，如 {"traffic": {"warning_percent": 90}}，
+// 未出现在补丁中的设置保持不变，合并后的设置校验通过才会保存
+func (h *SettingsHandler) PatchSettings(c *gin.Context) {
+	patch, ok := readMergePatch(c)
+	if !ok {
+		return
+	}
+
+	var settings stg.Settings
+	if err := applyMergePatch(h.settings.Get(), patch, &settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的补丁",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.settings.ReplaceAs(&settings, c.GetString("username")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "更新设置失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "设置已更新",
+		"data":    h.settings.Get(),
+	})
+}
+
 // GetSectionSettings 获取指定部分的设置
 func (h *SettingsHandler) GetSectionSettings(c *gin.Context) {
 	section := c.Param("section")
@@ -93,6 +128,8 @@ func (h *SettingsHandler) GetSectionSettings(c *gin.Context) {
 		sectionData = settings.Traffic
 	case "log":
 		sectionData = settings.Log
+	case "backup":
+		sectionData = settings.Backup
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -110,7 +147,7 @@ func (h *SettingsHandler) GetSectionSettings(c *gin.Context) {
 // UpdateSectionSettings 更新指定部分的设置
 func (h *SettingsHandler) UpdateSectionSettings(c *gin.Context) {
 	section := c.Param("section")
-	settings := h.settings.Get()
+	settings := h.settings.Clone()
 
 	switch section {
 	case "site":
@@ -123,6 +160,14 @@ func (h *SettingsHandler) UpdateSectionSettings(c *gin.Context) {
 			})
 			return
 		}
+		if err := siteSettings.ValidateTimezone(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的时区",
+				"error":   err.Error(),
+			})
+			return
+		}
 		settings.Site = siteSettings
 	case "admin":
 		var adminSettings stg.AdminSettings
@@ -190,6 +235,25 @@ func (h *SettingsHandler) UpdateSectionSettings(c *gin.Context) {
 			return
 		}
 		settings.Log = logSettings
+	case "backup":
+		var backupSettings stg.BackupSettings
+		if err := c.ShouldBindJSON(&backupSettings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求参数",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if err := backupSettings.ValidateTargets(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的远程备份目标",
+				"error":   err.Error(),
+			})
+			return
+		}
+		settings.Backup = backupSettings
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -198,7 +262,7 @@ func (h *SettingsHandler) UpdateSectionSettings(c *gin.Context) {
 		return
 	}
 
-	if err := h.settings.Update(settings); err != nil {
+	if err := h.settings.ReplaceAs(settings, c.GetString("username")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "更新设置失败",
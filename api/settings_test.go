@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"v/logger"
+	stg "v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSettingsRouter 使用临时设置文件创建路由，请求以管理员身份处理
+func newSettingsRouter(t *testing.T) (*gin.Engine, *stg.Manager) {
+	t.Helper()
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	settingsMgr := stg.NewWithPath(log, filepath.Join(t.TempDir(), "settings.json"))
+	next := settingsMgr.Clone()
+	next.Site.Name = "panel"
+	next.Traffic.WarningPercent = 80
+	if err := settingsMgr.Replace(next); err != nil {
+		t.Fatalf("Replace settings: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	admin := r.Group("/api", func(c *gin.Context) {
+		c.Set("username", "admin")
+		c.Set("is_admin", true)
+	})
+	NewSettingsHandler(log, settingsMgr).RegisterRoutes(admin)
+	return r, settingsMgr
+}
+
+func TestSettingsHandlerPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantWarning int
+	}{
+		{name: "merge patch changes one field", contentType: mergePatchContentType, body: `{"traffic":{"warning_percent":90}}`, want: http.StatusOK, wantWarning: 90},
+		{name: "plain json is accepted", contentType: "application/json", body: `{"traffic":{"warning_percent":70}}`, want: http.StatusOK, wantWarning: 70},
+		{name: "invalid json", contentType: mergePatchContentType, body: `{"traffic":`, want: http.StatusBadRequest, wantWarning: 80},
+		{name: "unsupported content type", contentType: "text/plain", body: `{"traffic":{"warning_percent":90}}`, want: http.StatusUnsupportedMediaType, wantWarning: 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, settingsMgr := newSettingsRouter(t)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/settings", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+
+			got := settingsMgr.Get()
+			if got.Traffic.WarningPercent != tt.wantWarning {
+				t.Errorf("warning_percent = %d, want %d", got.Traffic.WarningPercent, tt.wantWarning)
+			}
+			// 补丁未提及的字段保持不变
+			if got.Site.Name != "panel" {
+				t.Errorf("site name = %q, want it unchanged", got.Site.Name)
+			}
+		})
+	}
+}
+
+func TestSettingsHandlerGet(t *testing.T) {
+	r, _ := newSettingsRouter(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/settings", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp struct {
+		Success bool         `json:"success"`
+		Data    stg.Settings `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.Success || resp.Data.Site.Name != "panel" {
+		t.Errorf("response = %+v, want the current settings", resp)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"v/logger"
+	stg "v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SettingsTransferHandler 按分区导出和导入设置，用于让多个面板保持相同的配置
+type SettingsTransferHandler struct {
+	log      *logger.Logger
+	settings *stg.Manager
+}
+
+// NewSettingsTransferHandler 创建设置导出导入处理器
+func NewSettingsTransferHandler(log *logger.Logger, settings *stg.Manager) *SettingsTransferHandler {
+	return &SettingsTransferHandler{
+		log:      log,
+		settings: settings,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *SettingsTransferHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/settings/export", h.Export)
+	router.POST("/settings/import", h.Import)
+}
+
+// Export 导出指定分区的设置，不包含凭据
+// 查询参数：sections 分区名称，逗号分隔，如 notification,monitor
+func (h *SettingsTransferHandler) Export(c *gin.Context) {
+	var sections []string
+	for _, name := range strings.Split(c.Query("sections"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			sections = append(sections, name)
+		}
+	}
+
+	export, err := stg.ExportSections(h.settings.Get(), sections)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的设置分区",
+			"error":   err.Error(),
+			"data":    gin.H{"sections": stg.SectionNames()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    export,
+	})
+}
+
+// Import 导入导出的分区设置，请求体为 Export 返回的 data，可附加 "dry_run": true 只预览变化。
+// 导入的分区整体合并到当前设置，本机凭据保持不变；校验不通过时不保存任何修改
+func (h *SettingsTransferHandler) Import(c *gin.Context) {
+	var req struct {
+		Version  int                        `json:"version"`
+		Sections map[string]json.RawMessage `json:"sections" binding:"required"`
+		DryRun   bool                       `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if req.Version > stg.ExportVersion {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "不支持的导出文件版本，请升级面板后再导入",
+		})
+		return
+	}
+
+	sections := make([]string, 0, len(req.Sections))
+	for name := range req.Sections {
+		sections = append(sections, name)
+	}
+	sort.Strings(sections)
+	if err := stg.ValidateSections(sections); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的设置分区",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	current := h.settings.Get()
+	patch, err := json.Marshal(req.Sections)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数",
+			"error":   err.Error(),
+		})
+		return
+	}
+	var next stg.Settings
+	if err := applyMergePatch(current, patch, &next); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的设置内容",
+			"error":   err.Error(),
+		})
+		return
+	}
+	stg.KeepSecrets(current, &next, sections)
+	if err := next.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "导入的设置校验失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	changes := stg.DiffSections(current, &next, sections)
+	result := gin.H{
+		"dry_run":  req.DryRun,
+		"sections": sections,
+		"changes":  changes,
+	}
+	if req.DryRun || len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    result,
+		})
+		return
+	}
+
+	if err := h.settings.ReplaceAs(&next, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "保存设置失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	h.log.WithFields("Settings imported", logger.Fields{
+		"sections": strings.Join(sections, ","),
+		"changes":  len(changes),
+		"actor":    c.GetString("username"),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "设置已导入",
+		"data":    result,
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"v/protocol"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StaleHandler 闲置入站处理器
+type StaleHandler struct {
+	cleaner *protocol.StaleCleaner
+}
+
+// NewStaleHandler 创建闲置入站处理器
+func NewStaleHandler(cleaner *protocol.StaleCleaner) *StaleHandler {
+	return &StaleHandler{cleaner: cleaner}
+}
+
+// RegisterRoutes 注册路由
+func (h *StaleHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/protocols/stale", h.ListStale)
+	router.POST("/protocols/stale/cleanup", h.RunCleanup)
+}
+
+// ListStale 返回当前长期没有流量和连接的入站，以及已通知的入站计划处理的时间
+func (h *StaleHandler) ListStale(c *gin.Context) {
+	stale, err := h.cleaner.List(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "检测闲置入站失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    stale,
+	})
+}
+
+// RunCleanup 立即执行一轮闲置检测，按设置通知、停用或归档，不受 Cleanup.Enable 限制
+func (h *StaleHandler) RunCleanup(c *gin.Context) {
+	result, err := h.cleaner.Run(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "清理闲置入站失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"v/errors"
+	"v/logger"
+	"v/utils"
+)
+
+// logPurgeAge 清理日志时只删除超过该时间未修改的文件，正在写入的日志不受影响
+const logPurgeAge = 24 * time.Hour
+
+// storageItem 磁盘占用项
+type storageItem struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Files     int    `json:"files"`
+	Purgeable bool   `json:"purgeable"`
+	PurgeHint string `json:"purge_hint,omitempty"`
+
+	paths []string
+	purge func() (int, int64, error)
+}
+
+// storageItems 返回各项数据的路径和清理方式
+func (h *Handler) storageItems() []*storageItem {
+	s := h.settings.Get()
+
+	dbPath := s.Server.DatabasePath
+	if dbPath == "" {
+		dbPath = filepath.Join("data", "v.db")
+	}
+	logDir := "logs"
+	if s.Log.FilePath != "" {
+		logDir = filepath.Dir(s.Log.FilePath)
+	}
+	backupDir := s.Backup.Path
+	if backupDir == "" {
+		backupDir = "backups"
+	}
+	certDir := s.SSL.CertDir
+	if certDir == "" {
+		certDir = "certs"
+	}
+	binDir := h.xrayMgr.BinDir()
+	downloadDir := filepath.Join("xray", "downloads")
+	snapshotDir := h.xrayMgr.SnapshotDir()
+
+	return []*storageItem{
+		{
+			Name:  "database",
+			Path:  dbPath,
+			paths: []string{dbPath, dbPath + "-wal", dbPath + "-shm"},
+		},
+		{
+			Name:      "logs",
+			Path:      logDir,
+			Purgeable: true,
+			PurgeHint: "删除 24 小时内未写入的日志文件",
+			purge:     func() (int, int64, error) { return purgeOlderThan(logDir, logPurgeAge) },
+		},
+		{
+			Name:      "xray_binaries",
+			Path:      binDir,
+			Purgeable: true,
+			PurgeHint: "删除当前版本以外的 Xray 可执行文件",
+			purge: func() (int, int64, error) {
+				return purgeDirsExcept(binDir, h.xrayMgr.GetCurrentVersion())
+			},
+		},
+		{
+			Name:      "xray_downloads",
+			Path:      downloadDir,
+			Purgeable: true,
+			PurgeHint: "删除下载缓存",
+			purge:     func() (int, int64, error) { return purgeKeepNewest(downloadDir, 0) },
+		},
+		{
+			Name:      "xray_snapshots",
+			Path:      snapshotDir,
+			Purgeable: true,
+			PurgeHint: "只保留最新的配置快照",
+			purge:     func() (int, int64, error) { return purgeKeepNewest(snapshotDir, 1) },
+		},
+		{
+			Name:      "backups",
+			Path:      backupDir,
+			Purgeable: true,
+			PurgeHint: "只保留最新的备份",
+			purge:     func() (int, int64, error) { return purgeKeepNewest(backupDir, 1) },
+		},
+		{
+			Name: "certificates",
+			Path: certDir,
+		},
+	}
+}
+
+// setupStorageEndpoints sets up the storage usage endpoints
+func (h *Handler) setupStorageEndpoints() {
+	// Report disk usage by data category
+	h.router.HandleFunc("/api/system/storage", func(w http.ResponseWriter, r *http.Request) {
+		items := h.storageItems()
+		var total int64
+		for _, item := range items {
+			paths := item.paths
+			if len(paths) == 0 {
+				paths = []string{item.Path}
+			}
+			for _, path := range paths {
+				size, files, err := utils.DirSize(path)
+				if err != nil {
+					h.log.WarnWithFields("Failed to measure storage usage", logger.Fields{
+						"path":  path,
+						"error": err,
+					})
+				}
+				item.Size += size
+				item.Files += files
+			}
+			total += item.Size
+		}
+
+		data := map[string]interface{}{
+			"items": items,
+			"total": total,
+		}
+		if free, err := utils.FreeDiskSpace("."); err == nil {
+			data["disk_free"] = free
+		}
+
+		h.handleResponse(w, map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data":    data,
+		})
+	}).Methods("GET")
+
+	// Purge a storage item where it is safe to do so
+	h.router.HandleFunc("/api/system/storage/{item}/purge", func(w http.ResponseWriter, r *http.Request) {
+		name := h.getPathParam(r, "item")
+
+		var item *storageItem
+		for _, it := range h.storageItems() {
+			if it.Name == name {
+				item = it
+				break
+			}
+		}
+		if item == nil {
+			h.handleError(w, errors.ErrResourceNotFound)
+			return
+		}
+		if !item.Purgeable {
+			h.handleError(w, errors.WithMessage(errors.ErrForbidden, "该项不支持清理"))
+			return
+		}
+
+		removed, freed, err := item.purge()
+		if err != nil {
+			h.handleError(w, errors.WithMessage(errors.ErrInternalServerError, err.Error()))
+			return
+		}
+
+		h.log.WithFields("Purged storage item", logger.Fields{
+			"item":    item.Name,
+			"removed": removed,
+			"freed":   freed,
+		})
+
+		h.handleResponse(w, map[string]interface{}{
+			"code":    200,
+			"message": "success",
+			"data": map[string]interface{}{
+				"item":    item.Name,
+				"removed": removed,
+				"freed":   freed,
+			},
+		})
+	}).Methods("POST")
+}
+
+// purgeOlderThan 删除目录下超过 age 未修改的文件
+func purgeOlderThan(dir string, age time.Duration) (int, int64, error) {
+	entries, err := readDirIfExists(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var removed int
+	var freed int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < age {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err == nil {
+			removed++
+			freed += info.Size()
+		}
+	}
+	return removed, freed, nil
+}
+
+// purgeDirsExcept 删除目录下除 keep 以外的子目录
+func purgeDirsExcept(dir, keep string) (int, int64, error) {
+	entries, err := readDirIfExists(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var removed int
+	var freed int64
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == keep {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		size, _, _ := utils.DirSize(path)
+		if err := os.RemoveAll(path); err == nil {
+			removed++
+			freed += size
+		}
+	}
+	return removed, freed, nil
+}
+
+// purgeKeepNewest 按修改时间保留最新的 keep 项，删除其余文件和目录
+func purgeKeepNewest(dir string, keep int) (int, int64, error) {
+	entries, err := readDirIfExists(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type entryInfo struct {
+		path    string
+		modTime time.Time
+	}
+	list := make([]entryInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, entryInfo{filepath.Join(dir, entry.Name()), info.ModTime()})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].modTime.After(list[j].modTime)
+	})
+
+	var removed int
+	var freed int64
+	for i := keep; i < len(list); i++ {
+		size, _, _ := utils.DirSize(list[i].path)
+		if err := os.RemoveAll(list[i].path); err == nil {
+			removed++
+			freed += size
+		}
+	}
+	return removed, freed, nil
+}
+
+// readDirIfExists 读取目录，不存在时返回空列表
+func readDirIfExists(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return entries, err
+}
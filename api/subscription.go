@@ -0,0 +1,500 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/notification"
+	"v/protocol"
+	"v/settings"
+	"v/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSubscriptionUpdateInterval 未配置时建议客户端拉取订阅的间隔（小时）
+const defaultSubscriptionUpdateInterval = 12
+
+// UsageSource 提供用户实时上下行流量
+type UsageSource interface {
+	GetTraffic(userID int64) (*stats.TrafficStats, error)
+}
+
+// SubscriptionHandler 订阅拉取、客户端 webhook 注册和批量刷新处理器
+type SubscriptionHandler struct {
+	log       *logger.Logger
+	settings  *settings.Manager
+	db        model.DB
+	protocols *protocol.ProtocolManager
+	notifier  *notification.SubscriptionNotifier
+	activity  *notification.ActivityMonitor
+	usage     UsageSource
+}
+
+// NewSubscriptionHandler 创建订阅处理器，activity 可以为 nil
+func NewSubscriptionHandler(log *logger.Logger, settingsMgr *settings.Manager, db model.DB, protocols *protocol.ProtocolManager,
+	notifier *notification.SubscriptionNotifier, activity *notification.ActivityMonitor) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		log:       log,
+		settings:  settingsMgr,
+		db:        db,
+		protocols: protocols,
+		notifier:  notifier,
+		activity:  activity,
+	}
+}
+
+// SetUsageSource 设置实时流量来源，用于 subscription-userinfo 头，未设置时使用数据库中的统计
+func (h *SubscriptionHandler) SetUsageSource(usage UsageSource) {
+	h.usage = usage
+}
+
+// RegisterRoutes 注册客户端拉取订阅的路由，凭订阅令牌访问，无需登录
+func (h *SubscriptionHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/sub/:token", h.GetSubscriptionContent)
+}
+
+// RegisterUserRoutes 注册用户订阅管理的路由，router 需要已通过登录认证，
+// 用户只能管理自己的订阅，管理员可以管理所有用户的订阅
+func (h *SubscriptionHandler) RegisterUserRoutes(router *gin.RouterGroup) {
+	router.GET("/users/:id/subscription", h.GetUserSubscription)
+	router.PUT("/users/:id/subscription/webhook", h.SetWebhook)
+	router.POST("/users/:id/subscription/rotate", h.RotateToken)
+}
+
+// RegisterAdminRoutes 注册批量刷新订阅的路由，router 需要已通过管理员认证
+func (h *SubscriptionHandler) RegisterAdminRoutes(router *gin.RouterGroup) {
+	router.POST("/subscriptions/refresh", h.Refresh)
+}
+
+// GetSubscriptionContent 客户端拉取订阅。X-Profile-Version 和 ETag 随配置版本变化，
+// 客户端带 If-None-Match 拉取且版本未变时返回 304。配置签名密钥后校验 expires 和 sig 参数
+func (h *SubscriptionHandler) GetSubscriptionContent(c *gin.Context) {
+	token := c.Param("token")
+	sub, err := h.db.GetSubscriptionByToken(token)
+	if err != nil {
+		h.log.ErrorWithFields("Failed to get subscription", logger.Fields{"error": err})
+		c.String(http.StatusInternalServerError, "")
+		return
+	}
+	if sub == nil {
+		c.String(http.StatusNotFound, "")
+		return
+	}
+
+	// format 为 clash 或 sing-box 时返回带分流规则的完整客户端配置，默认返回 base64 编码的链接列表
+	format := c.Query("format")
+	switch format {
+	case "", protocol.ProfileClash, protocol.ProfileSingBox:
+	default:
+		c.String(http.StatusBadRequest, "unsupported format")
+		return
+	}
+	if !verifySubscriptionSignature(c, h.settings.Get().Subscription, token, format) {
+		c.String(http.StatusForbidden, "invalid or expired signature")
+		return
+	}
+
+	etag := fmt.Sprintf(`"v%d"`, sub.ProfileVersion)
+	if format != "" {
+		etag = fmt.Sprintf(`"v%d-%s"`, sub.ProfileVersion, format)
+	}
+	h.writeProfileHeaders(c, sub)
+	c.Header("ETag", etag)
+
+	now := time.Now()
+	sub.LastFetchedAt = &now
+	if err := h.db.SaveSubscription(sub); err != nil {
+		h.log.WarnWithFields("Failed to record subscription fetch", logger.Fields{
+			"user_id": sub.UserID,
+			"error":   err.Error(),
+		})
+	}
+	if h.activity != nil {
+		h.activity.ObserveAccess(sub.UserID, c.ClientIP(), notification.AccessSubscription)
+	}
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	protocols, err := h.db.GetProtocolsByUserID(sub.UserID)
+	if err != nil {
+		h.log.ErrorWithFields("Failed to get subscription protocols", logger.Fields{
+			"user_id": sub.UserID,
+			"error":   err,
+		})
+		c.String(http.StatusInternalServerError, "")
+		return
+	}
+	enabled := make([]*model.Protocol, 0, len(protocols))
+	for _, p := range protocols {
+		if p.Enable {
+			enabled = append(enabled, p)
+		}
+	}
+
+	if format == "" {
+		content, err := h.protocols.GenerateSubscriptionLink(enabled)
+		if err != nil {
+			h.log.ErrorWithFields("Failed to generate subscription", logger.Fields{
+				"user_id": sub.UserID,
+				"error":   err,
+			})
+			c.String(http.StatusInternalServerError, "")
+			return
+		}
+		c.String(http.StatusOK, content)
+		return
+	}
+
+	// 用户的分组为其协议标签的并集
+	var groups []string
+	seen := make(map[string]bool)
+	for _, p := range enabled {
+		for _, tag := range p.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				groups = append(groups, tag)
+			}
+		}
+	}
+	routing := h.settings.Get().Routing.ProfileFor(sub.UserID, groups)
+
+	var data []byte
+	contentType := "application/json; charset=utf-8"
+	if format == protocol.ProfileClash {
+		data, err = h.protocols.GenerateClashProfile(enabled, routing)
+		contentType = "text/yaml; charset=utf-8"
+	} else {
+		data, err = h.protocols.GenerateSingBoxProfile(enabled, routing)
+	}
+	if err != nil {
+		h.log.ErrorWithFields("Failed to generate subscription profile", logger.Fields{
+			"user_id": sub.UserID,
+			"format":  format,
+			"error":   err,
+		})
+		c.String(http.StatusInternalServerError, "")
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// writeProfileHeaders 写入 Clash Meta、v2rayN 等客户端识别的订阅响应头，设置中的 Headers 最后写入可覆盖默认值
+func (h *SubscriptionHandler) writeProfileHeaders(c *gin.Context, sub *model.Subscription) {
+	cfg := h.settings.Get().Subscription
+
+	interval := cfg.UpdateInterval
+	if interval <= 0 {
+		interval = defaultSubscriptionUpdateInterval
+	}
+	c.Header("Profile-Update-Interval", strconv.Itoa(interval))
+	c.Header("X-Profile-Version", strconv.FormatInt(sub.ProfileVersion, 10))
+
+	if cfg.ProfileTitle != "" {
+		c.Header("Profile-Title", "base64:"+base64.StdEncoding.EncodeToString([]byte(cfg.ProfileTitle)))
+		c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(cfg.ProfileTitle))
+	}
+
+	if !cfg.HideUserInfo {
+		if info, err := h.userInfo(sub.UserID); err != nil {
+			h.log.WarnWithFields("Failed to compute subscription userinfo", logger.Fields{
+				"user_id": sub.UserID,
+				"error":   err.Error(),
+			})
+		} else if info != "" {
+			c.Header("Subscription-Userinfo", info)
+		}
+	}
+
+	writeCacheHeaders(c, cfg, sub)
+
+	for name, value := range cfg.Headers {
+		c.Header(name, value)
+	}
+}
+
+// userInfo 根据用户的实时流量、流量上限和到期时间生成 subscription-userinfo 值，
+// 如 upload=1024; download=2048; total=10737418240; expire=1767225600。
+// 用户已用流量包含人工调整，非零时以其为准修正下行流量，使上下行之和等于已用流量
+func (h *SubscriptionHandler) userInfo(userID int64) (string, error) {
+	user, err := h.db.GetUser(userID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", nil
+	}
+
+	var upload, download int64
+	if h.usage != nil {
+		if live, err := h.usage.GetTraffic(userID); err == nil && live != nil {
+			upload, download = live.Upload, live.Download
+		}
+	}
+	if upload == 0 && download == 0 {
+		if recorded, err := h.db.GetTrafficStats(userID); err == nil && recorded != nil {
+			upload, download = recorded.Upload, recorded.Download
+		}
+	}
+	if used := user.TrafficUsed; used > 0 && used != upload+download {
+		upload = min(upload, used)
+		download = used - upload
+	}
+
+	var expire int64
+	if user.ExpireAt != nil && !user.ExpireAt.IsZero() {
+		expire = user.ExpireAt.Unix()
+	}
+	return fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", upload, download, max(user.TrafficLimit, 0), expire), nil
+}
+
+// GetUserSubscription 获取用户订阅，尚未创建时自动生成
+func (h *SubscriptionHandler) GetUserSubscription(c *gin.Context) {
+	sub, ok := h.loadSubscription(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.subscriptionView(sub),
+	})
+}
+
+// webhookRequest 客户端 webhook 注册请求，URL 为空表示取消注册
+type webhookRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// SetWebhook 注册或取消客户端 webhook，配置变化时推送通知
+func (h *SubscriptionHandler) SetWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求参数错误",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL != "" {
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的 webhook 地址",
+			})
+			return
+		}
+	}
+
+	sub, ok := h.loadSubscription(c)
+	if !ok {
+		return
+	}
+	sub.WebhookURL = req.URL
+	sub.WebhookSecret = req.Secret
+	sub.LastNotifyError = ""
+	if req.URL == "" {
+		sub.WebhookSecret = ""
+	}
+	if !h.saveSubscription(c, sub) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "webhook 已更新",
+		"data":    h.subscriptionView(sub),
+	})
+}
+
+// RotateToken 重置订阅令牌，旧订阅地址立即失效，并通知客户端拉取新地址
+func (h *SubscriptionHandler) RotateToken(c *gin.Context) {
+	sub, ok := h.loadSubscription(c)
+	if !ok {
+		return
+	}
+
+	token, err := newSubscriptionToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "生成订阅令牌失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	sub.Token = token
+	if !h.saveSubscription(c, sub) {
+		return
+	}
+
+	result, err := h.notifier.Refresh([]int64{sub.UserID}, "token_rotated")
+	if err != nil {
+		h.log.WarnWithFields("Failed to refresh rotated subscription", logger.Fields{
+			"user_id": sub.UserID,
+			"error":   err.Error(),
+		})
+	} else if result.Bumped > 0 {
+		sub.ProfileVersion++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "订阅令牌已重置",
+		"data":    h.subscriptionView(sub),
+	})
+}
+
+// refreshRequest 批量刷新请求，UserIDs 为空表示刷新全部订阅
+type refreshRequest struct {
+	UserIDs []int64 `json:"user_ids"`
+	Reason  string  `json:"reason"`
+}
+
+// Refresh 节点地址或凭据变化后批量递增订阅版本并推送客户端 webhook
+func (h *SubscriptionHandler) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	result, err := h.notifier.Refresh(req.UserIDs, strings.TrimSpace(req.Reason))
+	if err != nil {
+		h.log.ErrorWithFields("Failed to refresh subscriptions", logger.Fields{"error": err})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "刷新订阅失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "订阅已刷新",
+		"data":    result,
+	})
+}
+
+// loadSubscription 根据路径中的用户 ID 获取订阅，不存在时创建，失败时已写入响应。
+// 只有用户本人和管理员可以访问
+func (h *SubscriptionHandler) loadSubscription(c *gin.Context) (*model.Subscription, bool) {
+	userID, ok := userIDParam(c, h.db)
+	if !ok {
+		return nil, false
+	}
+	if c.GetInt64("user_id") != userID && !c.GetBool("is_admin") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "只能管理自己的订阅",
+		})
+		return nil, false
+	}
+
+	sub, err := h.db.GetSubscription(userID)
+	if err != nil {
+		h.log.ErrorWithFields("Failed to get subscription", logger.Fields{
+			"user_id": userID,
+			"error":   err,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取订阅失败",
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	if sub != nil {
+		return sub, true
+	}
+
+	user, err := h.db.GetUser(userID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return nil, false
+	}
+
+	token, err := newSubscriptionToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "生成订阅令牌失败",
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	sub = &model.Subscription{
+		UserID:         userID,
+		Token:          token,
+		ProfileVersion: 1,
+	}
+	if !h.saveSubscription(c, sub) {
+		return nil, false
+	}
+	return sub, true
+}
+
+// saveSubscription 保存订阅，失败时已写入响应
+func (h *SubscriptionHandler) saveSubscription(c *gin.Context, sub *model.Subscription) bool {
+	if err := h.db.SaveSubscription(sub); err != nil {
+		h.log.ErrorWithFields("Failed to save subscription", logger.Fields{
+			"user_id": sub.UserID,
+			"error":   err,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "保存订阅失败",
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// subscriptionView 订阅信息及拉取地址，配置签名密钥时附带可由 CDN 缓存的签名地址
+func (h *SubscriptionHandler) subscriptionView(sub *model.Subscription) gin.H {
+	view := gin.H{
+		"subscription": sub,
+		"path":         "/api/sub/" + sub.Token,
+	}
+	if cfg := h.settings.Get().Subscription; cfg.SigningKey != "" {
+		view["signed_path"] = signedSubscriptionPath(cfg, sub.Token, "", time.Now())
+	}
+	return view
+}
+
+// newSubscriptionToken 生成 32 位十六进制订阅令牌
+func newSubscriptionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"time"
+
+	"v/model"
+	"v/notification"
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultSignedURLTTL 未配置时签名订阅地址的有效期
+	defaultSignedURLTTL = 7 * 24 * time.Hour
+	// signedURLWindows 每个有效期内的时间窗口数，窗口越多剩余有效期越接近 TTL，CDN 缓存复用越少
+	signedURLWindows = 4
+)
+
+// signSubscriptionURL 计算订阅地址签名，签名覆盖令牌、格式和过期时间。
+// 使用从签名密钥派生的地址专用密钥，与缓存清除请求的签名互不通用
+func signSubscriptionURL(key, token, format string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(settings.DeriveSubscriptionKey(key, settings.SubscriptionKeyURL)))
+	mac.Write([]byte(token + "\n" + format + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedSubscriptionPath 生成带 expires 和 sig 参数的订阅地址。过期时间按 TTL 的四分之一对齐，
+// 同一时间窗口内生成的地址相同，CDN 可以复用缓存；剩余有效期在 TTL 的四分之三到 TTL 之间，不会超过 TTL
+func signedSubscriptionPath(cfg settings.SubscriptionSettings, token, format string, now time.Time) string {
+	ttl := cfg.SignedURLTTL
+	if ttl <= 0 {
+		ttl = defaultSignedURLTTL
+	}
+	window := ttl / signedURLWindows
+	if window < time.Second {
+		window = time.Second
+	}
+	expires := now.Truncate(window).Add(ttl).Unix()
+
+	q := url.Values{}
+	if format != "" {
+		q.Set("format", format)
+	}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", signSubscriptionURL(cfg.SigningKey, token, format, expires))
+	return "/api/sub/" + token + "?" + q.Encode()
+}
+
+// verifySubscriptionSignature 校验订阅请求的签名。未配置密钥时不校验；
+// 没有签名参数时只有开启 RequireSignature 才拒绝
+func verifySubscriptionSignature(c *gin.Context, cfg settings.SubscriptionSettings, token, format string) bool {
+	if cfg.SigningKey == "" {
+		return true
+	}
+	sig := c.Query("sig")
+	if sig == "" {
+		return !cfg.RequireSignature
+	}
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected := signSubscriptionURL(cfg.SigningKey, token, format, expires)
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
+
+// writeCacheHeaders 写入 CDN 缓存头。共享缓存只保留 CacheTTL，客户端每次都回源到 CDN；
+// Cache-Tag 和 Surrogate-Key 为用户的缓存键，订阅变化时按键清除
+func writeCacheHeaders(c *gin.Context, cfg settings.SubscriptionSettings, sub *model.Subscription) {
+	if cfg.CacheTTL > 0 {
+		c.Header("Cache-Control", "public, max-age=0, s-maxage="+strconv.Itoa(int(cfg.CacheTTL.Seconds())))
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	key := notification.SubscriptionCacheKey(sub.UserID)
+	c.Header("Cache-Tag", key)
+	c.Header("Surrogate-Key", key)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignedSubscriptionPath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := settings.SubscriptionSettings{SigningKey: "signing-key", SignedURLTTL: 8 * time.Hour}
+	// 窗口为 TTL 的四分之一，即 2 小时。使用未来的时间以便签名仍在有效期内
+	base := time.Now().Add(24 * time.Hour).Truncate(2 * time.Hour)
+
+	tests := []struct {
+		name string
+		now  time.Time
+	}{
+		{name: "start of window", now: base},
+		{name: "middle of window", now: base.Add(time.Hour)},
+		{name: "end of window", now: base.Add(2*time.Hour - time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := signedSubscriptionPath(cfg, "token", "clash", tt.now)
+			u, err := url.Parse(path)
+			if err != nil {
+				t.Fatalf("parse %q: %v", path, err)
+			}
+			expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+			if err != nil {
+				t.Fatalf("expires: %v", err)
+			}
+
+			// 剩余有效期不超过 TTL，且不少于 TTL 的四分之三
+			remaining := time.Unix(expires, 0).Sub(tt.now)
+			if remaining > cfg.SignedURLTTL || remaining <= cfg.SignedURLTTL*3/4 {
+				t.Errorf("remaining validity = %v, want within (%v, %v]", remaining, cfg.SignedURLTTL*3/4, cfg.SignedURLTTL)
+			}
+
+			// 签名使用派生的地址密钥，签名密钥本身和缓存清除密钥都不能直接算出
+			message := "token\nclash\n" + strconv.FormatInt(expires, 10)
+			for _, key := range []string{cfg.SigningKey, settings.DeriveSubscriptionKey(cfg.SigningKey, settings.SubscriptionKeyWebhook)} {
+				mac := hmac.New(sha256.New, []byte(key))
+				mac.Write([]byte(message))
+				if hex.EncodeToString(mac.Sum(nil)) == u.Query().Get("sig") {
+					t.Errorf("signature reproducible with key %q", key)
+				}
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", path, nil)
+			if !verifySubscriptionSignature(c, cfg, "token", "clash") {
+				t.Error("verifySubscriptionSignature rejected a freshly signed path")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"v/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIUsageHandler API 使用统计处理器
+type APIUsageHandler struct {
+	tracker *middleware.UsageTracker
+}
+
+// NewAPIUsageHandler 创建 API 使用统计处理器
+func NewAPIUsageHandler(tracker *middleware.UsageTracker) *APIUsageHandler {
+	return &APIUsageHandler{
+		tracker: tracker,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *APIUsageHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/system/api-usage", h.GetAPIUsage)
+}
+
+// GetAPIUsage 获取按时间分桶的 API 使用统计
+// 查询参数：since 统计时长（默认 1h），interval 分桶间隔（默认 1m），key 指定调用方（如 user:1、ip:1.2.3.4）
+func (h *APIUsageHandler) GetAPIUsage(c *gin.Context) {
+	since, err := time.ParseDuration(c.DefaultQuery("since", "1h"))
+	if err != nil || since <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的统计时长",
+		})
+		return
+	}
+
+	interval, err := time.ParseDuration(c.DefaultQuery("interval", "1m"))
+	if err != nil || interval <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的分桶间隔",
+		})
+		return
+	}
+
+	buckets, keys := h.tracker.Usage(time.Now().Add(-since), interval, c.Query("key"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"since":    since.String(),
+			"interval": interval.String(),
+			"buckets":  buckets,
+			"keys":     keys,
+		},
+	})
+}
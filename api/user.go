@@ -0,0 +1,222 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+
+	"v/auth"
+	"v/logger"
+	"v/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userPatchableFields 管理员可以通过补丁修改的用户字段，
+// 用户名、密码、流量用量和登录状态由各自的接口维护。email_verified 用于管理员人工确认邮箱，
+// 每次修改都会记录操作人
+var userPatchableFields = map[string]bool{
+	"email":            true,
+	"role":             true,
+	"status":           true,
+	"traffic_limit":    true,
+	"expire_at":        true,
+	"is_admin":         true,
+	"remark":           true,
+	"activity_opt_out": true,
+	"email_verified":   true,
+}
+
+// UserHandler 用户管理处理器
+type UserHandler struct {
+	log      *logger.Logger
+	db       model.DB
+	verifier *auth.EmailVerifier
+}
+
+// NewUserHandler 创建用户管理处理器
+func NewUserHandler(log *logger.Logger, db model.DB) *UserHandler {
+	return &UserHandler{
+		log: log,
+		db:  db,
+	}
+}
+
+// SetEmailVerifier 设置邮箱验证器，修改邮箱后向新邮箱发送验证邮件
+func (h *UserHandler) SetEmailVerifier(verifier *auth.EmailVerifier) {
+	h.verifier = verifier
+}
+
+// RegisterRoutes 注册路由
+func (h *UserHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.PATCH("/users/:id", h.PatchUser)
+	router.POST("/users/:id/email/verification", h.SendVerification)
+}
+
+// PatchUser 按 JSON Merge Patch（RFC 7396）修改用户的部分字段，如只修改 traffic_limit，
+// 合并后的用户校验通过才会保存
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	userID, ok := userIDParam(c, h.db)
+	if !ok {
+		return
+	}
+	patch, ok := readMergePatch(c)
+	if !ok {
+		return
+	}
+	fields, _ := patchKeys(patch)
+	for name := range fields {
+		if !userPatchableFields[name] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "字段不可修改：" + name,
+			})
+			return
+		}
+	}
+
+	current, err := h.db.GetUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取用户失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if current == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+
+	var patched model.User
+	if err := applyMergePatch(current, patch, &patched); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的补丁",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 只取可修改的字段，其余字段（包括不参与 JSON 的密码）保持原值
+	user := *current
+	user.Email = patched.Email
+	user.Role = patched.Role
+	user.Status = patched.Status
+	user.TrafficLimit = patched.TrafficLimit
+	user.ExpireAt = patched.ExpireAt
+	user.IsAdmin = patched.IsAdmin
+	user.Remark = patched.Remark
+	user.ActivityOptOut = patched.ActivityOptOut
+	user.EmailVerified = patched.EmailVerified
+	// 修改邮箱后需要重新验证，除非同时明确设置了 email_verified
+	emailChanged := user.Email != current.Email
+	if emailChanged {
+		user.PendingEmail = ""
+		if _, explicit := fields["email_verified"]; !explicit {
+			user.EmailVerified = false
+		}
+	}
+	if err := validatePatchedUser(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "修改后的用户无效",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.db.UpdateUser(&user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "更新用户失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if emailChanged && !user.EmailVerified && user.Email != "" && h.verifier != nil {
+		h.verifier.SendVerificationAsync(&user)
+	}
+
+	if _, explicit := fields["email_verified"]; explicit && user.EmailVerified != current.EmailVerified {
+		h.log.WarnWithFields("Email verification overridden by admin", logger.Fields{
+			"user_id":        user.ID,
+			"email_verified": user.EmailVerified,
+			"operator":       c.GetString("username"),
+			"operator_id":    c.GetInt64("user_id"),
+		})
+	}
+	h.log.WithFields("User patched", logger.Fields{
+		"user_id":  user.ID,
+		"operator": c.GetString("username"),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "用户已更新",
+		"data":    user,
+	})
+}
+
+// SendVerification 向用户尚未验证的邮箱或等待验证的新邮箱发送验证邮件
+func (h *UserHandler) SendVerification(c *gin.Context) {
+	if h.verifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "邮箱验证未启用",
+		})
+		return
+	}
+	userID, ok := userIDParam(c, h.db)
+	if !ok {
+		return
+	}
+
+	user, err := h.db.GetUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取用户失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+
+	if err := h.verifier.SendVerification(user); err != nil {
+		respondEmailError(c, "发送验证邮件失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "验证邮件已发送",
+		"data":    emailStatus(user),
+	})
+}
+
+// validatePatchedUser 检查合并后的用户
+func validatePatchedUser(u *model.User) error {
+	if u.Email != "" {
+		if _, err := mail.ParseAddress(u.Email); err != nil {
+			return fmt.Errorf("invalid email %q", u.Email)
+		}
+	}
+	if u.Role != "admin" && u.Role != "user" {
+		return fmt.Errorf("invalid role %q", u.Role)
+	}
+	if u.TrafficLimit < 0 {
+		return fmt.Errorf("traffic_limit must not be negative")
+	}
+	return nil
+}
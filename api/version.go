@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"v/logger"
+	"v/settings"
+	"v/version"
+	"v/xray"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Features 面板启用的功能
+type Features struct {
+	DBBackend  string   `json:"db_backend"`  // 数据库类型
+	CoreFlavor string   `json:"core_flavor"` // 代理内核
+	HA         bool     `json:"ha"`
+	Ingest     bool     `json:"ingest"`
+	OIDC       bool     `json:"oidc"`
+	Export     string   `json:"export,omitempty"` // 流量导出后端，未启用时为空
+	Profiling  bool     `json:"profiling"`
+	Protocols  []string `json:"protocols"`  // 启用的协议
+	Transports []string `json:"transports"` // 启用的传输方式
+}
+
+// VersionInfo 面板和代理内核的版本及启用的功能
+type VersionInfo struct {
+	*version.Info
+	XrayVersion string        `json:"xray_version"`
+	StartedAt   time.Time     `json:"started_at"`
+	Uptime      time.Duration `json:"uptime"`
+	Features    Features      `json:"features"`
+}
+
+// LogFields 启动日志中输出的字段
+func (v *VersionInfo) LogFields() logger.Fields {
+	return logger.Fields{
+		"version":      v.Version,
+		"commit":       v.ShortCommit(),
+		"modified":     v.Modified,
+		"build_date":   v.BuildDate,
+		"go_version":   v.GoVersion,
+		"os":           v.OS,
+		"arch":         v.Arch,
+		"xray_version": v.XrayVersion,
+		"db_backend":   v.Features.DBBackend,
+		"core_flavor":  v.Features.CoreFlavor,
+		"ha":           v.Features.HA,
+		"protocols":    v.Features.Protocols,
+	}
+}
+
+// VersionHandler 版本信息处理器
+type VersionHandler struct {
+	settings *settings.Manager
+	xray     *xray.Manager
+	started  time.Time
+}
+
+// NewVersionHandler 创建版本信息处理器
+func NewVersionHandler(settingsMgr *settings.Manager, xrayMgr *xray.Manager) *VersionHandler {
+	return &VersionHandler{
+		settings: settingsMgr,
+		xray:     xrayMgr,
+		started:  time.Now(),
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *VersionHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/version", h.GetVersion)
+}
+
+// Info 返回当前的版本信息
+func (h *VersionHandler) Info() *VersionInfo {
+	s := h.settings.Get()
+	features := Features{
+		DBBackend:  "sqlite",
+		CoreFlavor: "xray",
+		HA:         s.HA.Enable,
+		Ingest:     s.Ingest.Enable,
+		OIDC:       s.SSO.OIDCEnable,
+		Profiling:  s.Debug.Profiling,
+		Protocols:  enabledKeys(s.Protocols),
+		Transports: enabledKeys(s.Transports),
+	}
+	if s.Export.Enable {
+		features.Export = s.Export.Backend
+	}
+
+	return &VersionInfo{
+		Info:        version.Get(),
+		XrayVersion: h.xray.GetCurrentVersion(),
+		StartedAt:   h.started,
+		Uptime:      time.Since(h.started),
+		Features:    features,
+	}
+}
+
+// GetVersion 返回面板版本、git 提交、构建时间、Go 版本、Xray 版本和启用的功能，用于排查问题时确认服务器运行的构建
+func (h *VersionHandler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.Info(),
+	})
+}
+
+// enabledKeys 返回值为 true 的键，按名称排序
+func enabledKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k, enabled := range m {
+		if enabled {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -6,9 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"v/logger"
+	"v/privacy"
 )
 
 // Event represents an audit event
@@ -26,6 +28,7 @@ type Event struct {
 // Auditor represents an audit logger
 type Auditor struct {
 	log      *logger.Logger
+	mu       sync.Mutex
 	file     *os.File
 	filePath string
 }
@@ -53,6 +56,8 @@ func New(log *logger.Logger, filePath string) (*Auditor, error) {
 
 // Close closes the auditor
 func (a *Auditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	if a.file != nil {
 		return a.file.Close()
 	}
@@ -61,6 +66,9 @@ func (a *Auditor) Close() error {
 
 // Log logs an audit event
 func (a *Auditor) Log(event *Event) error {
+	// 按匿名化设置处理客户端 IP
+	event.IP = privacy.LiveIP(event.IP)
+
 	// Marshal event to JSON
 	data, err := json.Marshal(event)
 	if err != nil {
@@ -68,12 +76,15 @@ func (a *Auditor) Log(event *Event) error {
 	}
 
 	// Write to file
-	if _, err := a.file.Write(append(data, '\n')); err != nil {
+	a.mu.Lock()
+	_, err = a.file.Write(append(data, '\n'))
+	a.mu.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to write event: %v", err)
 	}
 
 	// Log to logger
-	a.log.Info("Audit event", logger.Fields{
+	a.log.WithFields("Audit event", logger.Fields{
 		"user_id":    event.UserID,
 		"action":     event.Action,
 		"resource":   event.Resource,
@@ -111,6 +122,67 @@ func (a *Auditor) Query(userID int64, startTime, endTime time.Time) ([]*Event, e
 	return filtered, nil
 }
 
+// AnonymizeBefore 匿名化早于 cutoff 的审计事件中的客户端 IP，重写审计文件，返回处理的事件数
+func (a *Auditor) AnonymizeBefore(cutoff time.Time, anonymize func(string) string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := os.ReadFile(a.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read audit file: %v", err)
+	}
+
+	count := 0
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		if !event.Timestamp.Before(cutoff) {
+			continue
+		}
+		ip := anonymize(event.IP)
+		if ip == event.IP {
+			continue
+		}
+		event.IP = ip
+		updated, err := json.Marshal(&event)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal event: %v", err)
+		}
+		lines[i] = string(updated)
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	// 写入临时文件后替换，再重新打开追加写入
+	tmp := a.filePath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write audit file: %v", err)
+	}
+	if err := os.Rename(tmp, a.filePath); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("failed to replace audit file: %v", err)
+	}
+	file, err := os.OpenFile(a.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit file: %v", err)
+	}
+	a.file.Close()
+	a.file = file
+
+	return count, nil
+}
+
 // readEvents reads all events from the audit file
 func (a *Auditor) readEvents() ([]*Event, error) {
 	// Read file
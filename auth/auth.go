@@ -14,8 +14,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte("your-secret-key") // 在实际应用中应该从配置文件读取
 var db model.DB
+var verifier *EmailVerifier
 
 // Common errors not already defined in auth/service.go
 var (
@@ -29,6 +29,11 @@ func Init(database model.DB) {
 	db = database
 }
 
+// SetEmailVerifier 设置注册后发送验证邮件的验证器，未设置时不发送
+func SetEmailVerifier(v *EmailVerifier) {
+	verifier = v
+}
+
 // Claims 自定义JWT声明
 type Claims struct {
 	UserID   int64  `json:"user_id"`
@@ -94,8 +99,7 @@ func (m *Manager) Login(username, password string) (string, error) {
 
 // Logout invalidates a token
 func (m *Manager) Logout(token string) error {
-	// JWT tokens are stateless, so we don't need to do anything here
-	return nil
+	return RevokeToken(token)
 }
 
 // ValidateToken checks if a token is valid and returns the associated user info
@@ -131,27 +135,80 @@ func (m *Manager) generateToken(t *Token) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// GenerateToken 生成JWT令牌
+// GenerateToken 生成JWT令牌，每个令牌对应一个会话
 func GenerateToken(user *model.User) (string, error) {
+	expiresAt := time.Now().Add(24 * time.Hour)
+	session, err := sessions.Create(user, expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %v", err)
+	}
+
 	claims := Claims{
 		UserID:   user.ID,
 		Username: user.Username,
 		IsAdmin:  user.IsAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        session.ID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	key, err := signingKey()
+	if err != nil {
+		sessions.Revoke(user.ID, session.ID)
+		return "", err
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString(key)
 }
 
-// ValidateToken 验证JWT令牌
+// signingKey 返回签发和校验令牌的密钥，与路由认证中间件使用同一个 Security.JWTSecret
+func signingKey() ([]byte, error) {
+	sessions.mu.Lock()
+	settingsMgr := sessions.settings
+	sessions.mu.Unlock()
+	if settingsMgr == nil || settingsMgr.Get().Security.JWTSecret == "" {
+		return nil, errors.New("jwt secret is not configured")
+	}
+	return []byte(settingsMgr.Get().Security.JWTSecret), nil
+}
+
+// ValidateToken 验证JWT令牌，并检查对应的会话未被注销或因无操作超时
 func ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	if _, err := sessions.Touch(claims.ID); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// RevokeToken 注销令牌对应的会话
+func RevokeToken(tokenString string) error {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return err
+	}
+	sessions.Revoke(claims.UserID, claims.ID)
+	return nil
+}
+
+// parseToken 校验JWT签名和有效期
+func parseToken(tokenString string) (*Claims, error) {
+	key, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -230,5 +287,13 @@ func Register(username, password, email string) error {
 		TrafficUsed:  0,
 	}
 
-	return db.CreateUser(user)
+	if err := db.CreateUser(user); err != nil {
+		return err
+	}
+
+	// 邮箱验证通过前不向其发送通知
+	if verifier != nil && user.Email != "" {
+		verifier.SendVerificationAsync(user)
+	}
+	return nil
 }
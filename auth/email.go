@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/notification"
+	"v/settings"
+)
+
+// 邮箱验证相关错误
+var (
+	ErrVerificationInvalid   = errors.New("invalid verification token")
+	ErrVerificationExpired   = errors.New("verification token has expired")
+	ErrVerificationThrottled = errors.New("verification email was sent recently, please wait")
+	ErrEmailMissing          = errors.New("user has no email address")
+	ErrEmailAlreadyVerified  = errors.New("email is already verified")
+	ErrEmailInUse            = errors.New("email is already used by another user")
+	ErrInvalidEmail          = errors.New("invalid email")
+)
+
+const (
+	// emailTokenDomain 验证令牌签名的用途标识
+	emailTokenDomain = "email-verification"
+	// defaultVerificationTTL 未配置时验证链接的有效期
+	defaultVerificationTTL = 24 * time.Hour
+	// verificationCooldown 同一用户两次发送验证邮件的最小间隔
+	verificationCooldown = time.Minute
+)
+
+// emailClaims 验证令牌的内容，令牌绑定用户和邮箱地址，地址变化后旧令牌自然失效
+type emailClaims struct {
+	UserID    int64  `json:"uid"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// EmailVerifier 邮箱双重确认。注册或修改邮箱后向该地址发送签名的验证链接，
+// 打开链接后邮箱才标记为已验证；修改邮箱时新地址验证通过前原邮箱保持不变
+type EmailVerifier struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	db       model.DB
+	notifier notification.Notifier
+
+	mu       sync.Mutex
+	lastSent map[int64]time.Time
+}
+
+// NewEmailVerifier 创建邮箱验证器
+func NewEmailVerifier(log *logger.Logger, settingsMgr *settings.Manager, db model.DB, notifier notification.Notifier) *EmailVerifier {
+	return &EmailVerifier{
+		log:      log,
+		settings: settingsMgr,
+		db:       db,
+		notifier: notifier,
+		lastSent: make(map[int64]time.Time),
+	}
+}
+
+// SendVerification 向等待验证的新邮箱发送验证邮件，没有新邮箱时发往尚未验证的当前邮箱
+func (v *EmailVerifier) SendVerification(user *model.User) error {
+	address := user.PendingEmail
+	if address == "" {
+		if user.Email == "" {
+			return ErrEmailMissing
+		}
+		if user.EmailVerified {
+			return ErrEmailAlreadyVerified
+		}
+		address = user.Email
+	}
+
+	v.mu.Lock()
+	if last, ok := v.lastSent[user.ID]; ok && time.Since(last) < verificationCooldown {
+		v.mu.Unlock()
+		return ErrVerificationThrottled
+	}
+	v.lastSent[user.ID] = time.Now()
+	v.mu.Unlock()
+
+	s := v.settings.Get()
+	ttl := s.Notification.VerificationTTL
+	if ttl <= 0 {
+		ttl = defaultVerificationTTL
+	}
+	token, err := signEmailToken(emailClaims{
+		UserID:    user.ID,
+		Email:     address,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	instruction := fmt.Sprintf(`<p>验证令牌：<code>%s</code></p>`, html.EscapeString(token))
+	if link := verificationLink(s.Notification.VerificationURL, token); link != "" {
+		instruction = fmt.Sprintf(`<p><a href="%s">点击此处验证邮箱</a></p>`, html.EscapeString(link))
+	}
+	body := fmt.Sprintf(`
+		<p>%s，您好：</p>
+		<p>请确认 %s 是您的邮箱，验证后才会向该地址发送通知。</p>%s
+		<p>链接在 %s 内有效。如果不是您本人的操作，请忽略此邮件。</p>
+		<p>%s</p>
+	`, html.EscapeString(user.Username), html.EscapeString(address), instruction, ttl, html.EscapeString(s.Site.Name))
+
+	if err := v.notifier.Send(&notification.Notification{
+		To:      []string{address},
+		Subject: "验证您的邮箱",
+		Body:    body,
+		Type:    notification.TypeEmailVerification,
+	}); err != nil {
+		v.mu.Lock()
+		delete(v.lastSent, user.ID)
+		v.mu.Unlock()
+		return err
+	}
+
+	v.log.WithFields("Verification email sent", logger.Fields{
+		"user_id": user.ID,
+		"pending": user.PendingEmail != "",
+	})
+	return nil
+}
+
+// SendVerificationAsync 在后台发送验证邮件，失败只记录日志，用户可以稍后重新发送
+func (v *EmailVerifier) SendVerificationAsync(user *model.User) {
+	go func() {
+		if err := v.SendVerification(user); err != nil {
+			v.log.WarnWithFields("Failed to send verification email", logger.Fields{
+				"user_id": user.ID,
+				"error":   err.Error(),
+			})
+		}
+	}()
+}
+
+// RequestChange 将新邮箱记为等待验证并发送验证邮件，验证通过前当前邮箱保持不变。
+// 当前邮箱已验证时同时通知当前邮箱，便于发现被盗用的账号
+func (v *EmailVerifier) RequestChange(userID int64, email string) (*model.User, error) {
+	address, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	user, err := v.db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, model.ErrNotFound
+	}
+
+	// 改回当前邮箱等同于取消修改
+	if strings.EqualFold(address, user.Email) {
+		if user.PendingEmail != "" {
+			user.PendingEmail = ""
+			if err := v.db.UpdateUser(user); err != nil {
+				return nil, err
+			}
+		}
+		if !user.EmailVerified {
+			return user, v.SendVerification(user)
+		}
+		return user, nil
+	}
+	if err := v.checkAvailable(userID, address); err != nil {
+		return nil, err
+	}
+
+	user.PendingEmail = address
+	if err := v.db.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	if err := v.SendVerification(user); err != nil {
+		return user, err
+	}
+
+	if user.EmailVerified {
+		v.notifyChange(user, address)
+	}
+	return user, nil
+}
+
+// Verify 校验令牌，通过后标记邮箱已验证，或将等待验证的新邮箱设为当前邮箱。
+// 令牌中的地址已不是用户的当前邮箱或等待验证的邮箱时视为无效
+func (v *EmailVerifier) Verify(token string) (*model.User, error) {
+	claims, err := parseEmailToken(token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := v.db.GetUser(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrVerificationInvalid
+	}
+
+	switch {
+	case user.PendingEmail != "" && strings.EqualFold(claims.Email, user.PendingEmail):
+		if err := v.checkAvailable(user.ID, user.PendingEmail); err != nil {
+			return nil, err
+		}
+		user.Email = user.PendingEmail
+		user.PendingEmail = ""
+		user.EmailVerified = true
+	case strings.EqualFold(claims.Email, user.Email):
+		if user.EmailVerified {
+			return user, nil
+		}
+		user.EmailVerified = true
+	default:
+		return nil, ErrVerificationInvalid
+	}
+	if err := v.db.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	delete(v.lastSent, user.ID)
+	v.mu.Unlock()
+
+	v.log.WithFields("Email verified", logger.Fields{
+		"user_id": user.ID,
+	})
+	return user, nil
+}
+
+// Deliverable 判断地址能否接收通知，实现 notification.RecipientFilter。
+// 不属于任何用户的地址（如管理员告警地址）不受限制，查询失败时不发送
+func (v *EmailVerifier) Deliverable(address string) bool {
+	user, err := v.db.GetUserByEmail(address)
+	if err != nil {
+		v.log.WarnWithFields("Failed to check email verification", logger.Fields{
+			"error": err.Error(),
+		})
+		return false
+	}
+	return user == nil || user.EmailVerified
+}
+
+// checkAvailable 检查邮箱是否已被其他用户使用
+func (v *EmailVerifier) checkAvailable(userID int64, address string) error {
+	other, err := v.db.GetUserByEmail(address)
+	if err != nil {
+		return err
+	}
+	if other != nil && other.ID != userID {
+		return ErrEmailInUse
+	}
+	return nil
+}
+
+// notifyChange 告知当前邮箱有修改邮箱的请求，失败只记录日志
+func (v *EmailVerifier) notifyChange(user *model.User, address string) {
+	body := fmt.Sprintf(`
+		<p>%s，您好：</p>
+		<p>您的账号申请将邮箱修改为 %s，新邮箱验证通过后生效。</p>
+		<p>如果不是您本人的操作，请尽快修改密码。</p>
+		<p>%s</p>
+	`, html.EscapeString(user.Username), html.EscapeString(address), html.EscapeString(v.settings.Get().Site.Name))
+
+	if err := v.notifier.Send(&notification.Notification{
+		To:      []string{user.Email},
+		Subject: "邮箱修改申请",
+		Body:    body,
+		Type:    "email_change",
+	}); err != nil {
+		v.log.WarnWithFields("Failed to send email change notice", logger.Fields{
+			"user_id": user.ID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// normalizeEmail 解析邮箱地址，去掉显示名称
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return "", fmt.Errorf("%w %q", ErrInvalidEmail, email)
+	}
+	return addr.Address, nil
+}
+
+// verificationLink 在验证页面地址上附加令牌，未配置地址时返回空字符串
+func verificationLink(base, token string) string {
+	if base == "" {
+		return ""
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// signEmailToken 生成验证令牌：base64url(JSON) + "." + 使用设置加密密钥计算的签名
+func signEmailToken(claims emailClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	signature := settings.KeyedHash(emailTokenDomain, payload)
+	if signature == "" {
+		return "", fmt.Errorf("settings secret key is not loaded")
+	}
+	return payload + "." + signature, nil
+}
+
+// parseEmailToken 校验签名和有效期并返回令牌内容
+func parseEmailToken(token string) (*emailClaims, error) {
+	payload, signature, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok {
+		return nil, ErrVerificationInvalid
+	}
+	expected := settings.KeyedHash(emailTokenDomain, payload)
+	if expected == "" || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrVerificationInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrVerificationInvalid
+	}
+	var claims emailClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.UserID <= 0 || claims.Email == "" {
+		return nil, ErrVerificationInvalid
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrVerificationExpired
+	}
+	return &claims, nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"v/settings"
+)
+
+// loadTestSecretKey 在测试期间使用固定的设置加密密钥，令牌签名依赖该密钥，结束后还原
+func loadTestSecretKey(t *testing.T, key byte) {
+	t.Helper()
+	previous := settings.SwapSecretKey(bytes.Repeat([]byte{key}, 32))
+	t.Cleanup(func() { settings.SwapSecretKey(previous) })
+}
+
+// signPayload 对任意内容签名，用于构造签名有效但内容无效的令牌
+func signPayload(payload string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + settings.KeyedHash(emailTokenDomain, encoded)
+}
+
+func TestParseEmailToken(t *testing.T) {
+	loadTestSecretKey(t, 'a')
+
+	sign := func(claims emailClaims) string {
+		token, err := signEmailToken(claims)
+		if err != nil {
+			t.Fatalf("signEmailToken: %v", err)
+		}
+		return token
+	}
+	future := time.Now().Add(time.Hour).Unix()
+	valid := sign(emailClaims{UserID: 42, Email: "alice@example.com", ExpiresAt: future})
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		want    *emailClaims
+		wantErr error
+	}{
+		{name: "valid", token: valid, want: &emailClaims{UserID: 42, Email: "alice@example.com", ExpiresAt: future}},
+		{name: "surrounding whitespace", token: " " + valid + "\n", want: &emailClaims{UserID: 42, Email: "alice@example.com", ExpiresAt: future}},
+		{name: "expired", token: sign(emailClaims{UserID: 42, Email: "alice@example.com", ExpiresAt: time.Now().Add(-time.Minute).Unix()}), wantErr: ErrVerificationExpired},
+		{name: "missing signature", token: payload, wantErr: ErrVerificationInvalid},
+		{name: "empty", token: "", wantErr: ErrVerificationInvalid},
+		{name: "tampered payload", token: base64.RawURLEncoding.EncodeToString([]byte(`{"uid":1,"email":"alice@example.com","exp":9999999999}`)) + "." + signature, wantErr: ErrVerificationInvalid},
+		{name: "tampered signature", token: payload + "." + strings.Repeat("0", len(signature)), wantErr: ErrVerificationInvalid},
+		{name: "signed payload is not json", token: signPayload("not json"), wantErr: ErrVerificationInvalid},
+		{name: "signed payload without user", token: signPayload(`{"email":"alice@example.com","exp":9999999999}`), wantErr: ErrVerificationInvalid},
+		{name: "signed payload without email", token: signPayload(`{"uid":42,"exp":9999999999}`), wantErr: ErrVerificationInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEmailToken(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseEmailToken error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && (got == nil || *got != *tt.want) {
+				t.Errorf("parseEmailToken = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// 更换密钥后旧令牌失效
+	loadTestSecretKey(t, 'b')
+	if _, err := parseEmailToken(valid); !errors.Is(err, ErrVerificationInvalid) {
+		t.Errorf("token signed with the old key: error = %v, want %v", err, ErrVerificationInvalid)
+	}
+}
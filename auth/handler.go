@@ -2,7 +2,9 @@ package auth
 
 import (
 	"net/http"
+	"strconv"
 	"v/model"
+	"v/notification"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,6 +12,7 @@ import (
 // Handler handles authentication-related HTTP requests
 type Handler struct {
 	authService *Service
+	activity    *notification.ActivityMonitor
 }
 
 // NewHandler creates a new authentication handler
@@ -17,6 +20,11 @@ func NewHandler(authService *Service) *Handler {
 	return &Handler{authService: authService}
 }
 
+// SetActivityMonitor enables new-location login alerts
+func (h *Handler) SetActivityMonitor(activity *notification.ActivityMonitor) {
+	h.activity = activity
+}
+
 // LoginRequest represents a login request
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
@@ -48,12 +56,18 @@ func (h *Handler) Login(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "account has expired"})
 		case ErrAccountDisabled:
 			c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
+		case ErrLocalLoginDisabled:
+			c.JSON(http.StatusForbidden, gin.H{"error": "local login is disabled"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
 		return
 	}
 
+	if h.activity != nil {
+		h.activity.ObserveAccess(user.ID, c.ClientIP(), notification.AccessLogin)
+	}
+
 	c.JSON(http.StatusOK, LoginResponse{
 		User:  user,
 		Token: token,
@@ -121,3 +135,181 @@ func (h *Handler) ResetPassword(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
 }
+
+// SSOHandler handles single sign-on HTTP requests
+type SSOHandler struct {
+	provider *SSOProvider
+	activity *notification.ActivityMonitor
+}
+
+// NewSSOHandler creates a new single sign-on handler
+func NewSSOHandler(provider *SSOProvider) *SSOHandler {
+	return &SSOHandler{provider: provider}
+}
+
+// SetActivityMonitor enables new-location login alerts
+func (h *SSOHandler) SetActivityMonitor(activity *notification.ActivityMonitor) {
+	h.activity = activity
+}
+
+// RegisterRoutes registers single sign-on routes
+func (h *SSOHandler) RegisterRoutes(router *gin.RouterGroup) {
+	sso := router.Group("/sso")
+	{
+		sso.GET("/providers", h.Providers)
+		sso.GET("/oidc/login", h.OIDCLogin)
+		sso.GET("/oidc/callback", h.OIDCCallback)
+		sso.POST("/ldap/login", h.LDAPLogin)
+	}
+}
+
+// Providers returns the enabled authentication sources
+func (h *SSOHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.provider.Providers()})
+}
+
+// OIDCLogin redirects the browser to the identity provider
+func (h *SSOHandler) OIDCLogin(c *gin.Context) {
+	authURL, err := h.provider.OIDCAuthURL(c.Request.Context())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback handles the identity provider callback
+func (h *SSOHandler) OIDCCallback(c *gin.Context) {
+	if errMsg := c.Query("error"); errMsg != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errMsg})
+		return
+	}
+
+	user, err := h.provider.OIDCCallback(c.Request.Context(), c.Query("code"), c.Query("state"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	h.respondWithToken(c, user)
+}
+
+// LDAPLogin handles LDAP login
+func (h *SSOHandler) LDAPLogin(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.provider.LDAPLogin(req.Username, req.Password)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	h.respondWithToken(c, user)
+}
+
+// respondWithToken issues a panel token for the authenticated user
+func (h *SSOHandler) respondWithToken(c *gin.Context, user *model.User) {
+	token, err := GenerateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	if h.activity != nil {
+		h.activity.ObserveAccess(user.ID, c.ClientIP(), notification.AccessLogin)
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		User:  user,
+		Token: token,
+	})
+}
+
+// handleError maps single sign-on errors to HTTP responses
+func (h *SSOHandler) handleError(c *gin.Context, err error) {
+	switch err {
+	case ErrSSODisabled:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case ErrSSOInvalidState, ErrInvalidCredentials:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case ErrSSOUserNotAllowed, ErrSSOUserNotProvisioned, ErrSSOUsernameTaken, ErrAccountDisabled:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+// SessionHandler handles panel session management requests
+type SessionHandler struct {
+	sessions *SessionStore
+}
+
+// NewSessionHandler creates a new session management handler
+func NewSessionHandler(sessions *SessionStore) *SessionHandler {
+	return &SessionHandler{sessions: sessions}
+}
+
+// RegisterRoutes registers session management routes; router must require login.
+// Users may manage only their own sessions, admins may manage anyone's
+func (h *SessionHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/users/:id/sessions", h.List)
+	router.DELETE("/users/:id/sessions", h.RevokeAll)
+	router.DELETE("/users/:id/sessions/:session_id", h.Revoke)
+}
+
+// List returns the active sessions of a user
+func (h *SessionHandler) List(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": h.sessions.List(userID)})
+}
+
+// RevokeAll logs out every session of a user, e.g. after a password change
+func (h *SessionHandler) RevokeAll(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "sessions revoked",
+		"revoked": h.sessions.RevokeUser(userID),
+	})
+}
+
+// Revoke logs out a single session of a user
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	userID, ok := h.userID(c)
+	if !ok {
+		return
+	}
+
+	if !h.sessions.Revoke(userID, c.Param("session_id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// userID parses the user ID path parameter and checks that the caller is that user or an admin
+func (h *SessionHandler) userID(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, false
+	}
+	if c.GetInt64("user_id") != userID && !c.GetBool("is_admin") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin privileges required to manage other users' sessions"})
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// LDAP 协议相关常量
+const (
+	ldapTagSequence       = 0x30
+	ldapTagSet            = 0x31
+	ldapTagBoolean        = 0x01
+	ldapTagInteger        = 0x02
+	ldapTagOctetString    = 0x04
+	ldapTagEnumerated     = 0x0a
+	ldapTagBindRequest    = 0x60
+	ldapTagBindResponse   = 0x61
+	ldapTagSearchRequest  = 0x63
+	ldapTagSearchEntry    = 0x64
+	ldapTagSearchDone     = 0x65
+	ldapTagSimpleAuth     = 0x80
+	ldapTagFilterEquality = 0xa3
+	ldapTagFilterPresent  = 0x87
+	ldapResultSuccess     = 0
+	ldapResultInvalidCrd  = 49
+
+	ldapScopeBase    = 0
+	ldapScopeSubtree = 2
+
+	// ldapTimeout 单次 LDAP 登录（连接、绑定和查询组）的最长时间
+	ldapTimeout = 10 * time.Second
+	// maxLDAPMessage 单条 LDAP 响应的最大长度
+	maxLDAPMessage = 16 << 20
+)
+
+// ldapEntry 查询结果中的一个条目
+type ldapEntry struct {
+	DN         string
+	Attributes map[string][]string // 属性名统一为小写
+}
+
+// ldapConn 一个 LDAP 连接，只实现登录需要的简单绑定和查询
+type ldapConn struct {
+	conn      net.Conn
+	messageID int
+}
+
+// ldapDial 连接 LDAP 服务器，整个连接的读写都受 ldapTimeout 限制
+func ldapDial(address string, useTLS bool) (*ldapConn, error) {
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap server: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(ldapTimeout))
+	return &ldapConn{conn: conn}, nil
+}
+
+// Close 关闭连接
+func (c *ldapConn) Close() error {
+	return c.conn.Close()
+}
+
+// bind 使用简单认证绑定，成功表示用户名密码有效
+func (c *ldapConn) bind(dn, password string) error {
+	// 空密码会被服务器当作匿名绑定，必须拒绝
+	if password == "" {
+		return ErrInvalidCredentials
+	}
+
+	// BindRequest ::= [APPLICATION 0] SEQUENCE { version, name, authentication }
+	bind := berEncode(ldapTagInteger, []byte{3})
+	bind = append(bind, berEncode(ldapTagOctetString, []byte(dn))...)
+	bind = append(bind, berEncode(ldapTagSimpleAuth, []byte(password))...)
+	if err := c.send(ldapTagBindRequest, bind); err != nil {
+		return fmt.Errorf("failed to send ldap bind request: %v", err)
+	}
+
+	tag, content, err := c.receive()
+	if err != nil {
+		return fmt.Errorf("failed to read ldap bind response: %v", err)
+	}
+	if tag != ldapTagBindResponse {
+		return errors.New("invalid ldap bind response")
+	}
+
+	switch code, err := ldapResultCode(content); {
+	case err != nil:
+		return err
+	case code == ldapResultSuccess:
+		return nil
+	case code == ldapResultInvalidCrd:
+		return ErrInvalidCredentials
+	default:
+		return fmt.Errorf("ldap bind failed with result code %d", code)
+	}
+}
+
+// search 查询 baseDN 下的条目。attr 为空时匹配所有条目（objectClass 存在），
+// 否则匹配 attr 等于 value 的条目，只返回 attributes 中列出的属性
+func (c *ldapConn) search(baseDN string, scope int, attr, value string, attributes []string) ([]ldapEntry, error) {
+	var filter []byte
+	if attr == "" {
+		filter = berEncode(ldapTagFilterPresent, []byte("objectClass"))
+	} else {
+		match := berEncode(ldapTagOctetString, []byte(attr))
+		match = append(match, berEncode(ldapTagOctetString, []byte(value))...)
+		filter = berEncode(ldapTagFilterEquality, match)
+	}
+	var attrs []byte
+	for _, name := range attributes {
+		attrs = append(attrs, berEncode(ldapTagOctetString, []byte(name))...)
+	}
+
+	// SearchRequest ::= [APPLICATION 3] SEQUENCE { baseObject, scope, derefAliases,
+	// sizeLimit, timeLimit, typesOnly, filter, attributes }
+	req := berEncode(ldapTagOctetString, []byte(baseDN))
+	req = append(req, berEncode(ldapTagEnumerated, []byte{byte(scope)})...)
+	req = append(req, berEncode(ldapTagEnumerated, []byte{0})...)
+	req = append(req, berEncode(ldapTagInteger, []byte{0})...)
+	req = append(req, berEncode(ldapTagInteger, []byte{byte(ldapTimeout / time.Second)})...)
+	req = append(req, berEncode(ldapTagBoolean, []byte{0})...)
+	req = append(req, filter...)
+	req = append(req, berEncode(ldapTagSequence, attrs)...)
+	if err := c.send(ldapTagSearchRequest, req); err != nil {
+		return nil, fmt.Errorf("failed to send ldap search request: %v", err)
+	}
+
+	var entries []ldapEntry
+	for {
+		tag, content, err := c.receive()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ldap search response: %v", err)
+		}
+		switch tag {
+		case ldapTagSearchEntry:
+			entry, err := parseLDAPEntry(content)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapTagSearchDone:
+			code, err := ldapResultCode(content)
+			if err != nil {
+				return nil, err
+			}
+			if code != ldapResultSuccess {
+				return nil, fmt.Errorf("ldap search failed with result code %d", code)
+			}
+			return entries, nil
+		}
+		// 其余响应（如 SearchResultReference）忽略
+	}
+}
+
+// send 发送一条 LDAP 消息
+func (c *ldapConn) send(tag byte, op []byte) error {
+	c.messageID++
+	msg := berEncode(ldapTagInteger, []byte{byte(c.messageID)})
+	msg = append(msg, berEncode(tag, op)...)
+	_, err := c.conn.Write(berEncode(ldapTagSequence, msg))
+	return err
+}
+
+// receive 读取一条 LDAP 消息，返回协议操作的标签和内容
+func (c *ldapConn) receive() (byte, []byte, error) {
+	tag, content, err := berRead(c.conn)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != ldapTagSequence {
+		return 0, nil, errors.New("invalid ldap response")
+	}
+
+	r := bytes.NewReader(content)
+	// 跳过 messageID
+	if _, _, err := berRead(r); err != nil {
+		return 0, nil, fmt.Errorf("invalid ldap response: %v", err)
+	}
+	return berRead(r)
+}
+
+// ldapResultCode 解析 LDAPResult 中的结果码
+func ldapResultCode(content []byte) (int, error) {
+	tag, code, err := berRead(bytes.NewReader(content))
+	if err != nil || tag != ldapTagEnumerated || len(code) == 0 {
+		return 0, errors.New("invalid ldap result")
+	}
+	return int(code[len(code)-1]), nil
+}
+
+// parseLDAPEntry 解析 SearchResultEntry ::= [APPLICATION 4] SEQUENCE { objectName, attributes }
+func parseLDAPEntry(content []byte) (ldapEntry, error) {
+	invalid := errors.New("invalid ldap search entry")
+	r := bytes.NewReader(content)
+	tag, dn, err := berRead(r)
+	if err != nil || tag != ldapTagOctetString {
+		return ldapEntry{}, invalid
+	}
+	tag, attrs, err := berRead(r)
+	if err != nil || tag != ldapTagSequence {
+		return ldapEntry{}, invalid
+	}
+
+	entry := ldapEntry{DN: string(dn), Attributes: make(map[string][]string)}
+	ar := bytes.NewReader(attrs)
+	for ar.Len() > 0 {
+		tag, attr, err := berRead(ar)
+		if err != nil || tag != ldapTagSequence {
+			return ldapEntry{}, invalid
+		}
+		pr := bytes.NewReader(attr)
+		tag, name, err := berRead(pr)
+		if err != nil || tag != ldapTagOctetString {
+			return ldapEntry{}, invalid
+		}
+		tag, vals, err := berRead(pr)
+		if err != nil || tag != ldapTagSet {
+			return ldapEntry{}, invalid
+		}
+		key := strings.ToLower(string(name))
+		vr := bytes.NewReader(vals)
+		for vr.Len() > 0 {
+			tag, val, err := berRead(vr)
+			if err != nil || tag != ldapTagOctetString {
+				return ldapEntry{}, invalid
+			}
+			entry.Attributes[key] = append(entry.Attributes[key], string(val))
+		}
+	}
+	return entry, nil
+}
+
+// ldapRDNValue 返回 DN 第一个 RDN 的值，如 cn=admins,ou=groups,dc=example,dc=com 返回 admins
+func ldapRDNValue(dn string) string {
+	rdn := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+			continue
+		}
+		if dn[i] == ',' {
+			rdn = dn[:i]
+			break
+		}
+	}
+	_, value, ok := strings.Cut(rdn, "=")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(value, "\\", ""))
+}
+
+// ldapEscapeDN 转义 DN 属性值中的特殊字符
+func ldapEscapeDN(value string) string {
+	var b strings.Builder
+	for i, c := range value {
+		switch {
+		case strings.ContainsRune(",+\"\\<>;=", c):
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		case i == 0 && (c == ' ' || c == '#'):
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// berEncode 编码一个 BER TLV
+func berEncode(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	n := len(content)
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+// berRead 读取一个 BER TLV
+func berRead(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		numBytes := length & 0x7f
+		if numBytes == 0 || numBytes > 4 {
+			return 0, nil, errors.New("unsupported ber length")
+		}
+		lenBytes := make([]byte, numBytes)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range lenBytes {
+			length = length<<8 | int(b)
+		}
+		if length > maxLDAPMessage {
+			return 0, nil, errors.New("ldap message too large")
+		}
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return header[0], content, nil
+}
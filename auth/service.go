@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 	"v/model"
 	"v/notification"
@@ -40,6 +41,11 @@ func NewAuthService(db model.DB, notification *notification.Manager, settings *s
 
 // Login authenticates a user and returns a session token
 func (s *Service) Login(username, password string) (*model.User, string, error) {
+	// Check if local password login is allowed
+	if s.settings.Get().SSO.DisableLocalLogin {
+		return nil, "", ErrLocalLoginDisabled
+	}
+
 	// Get user by username
 	user, err := s.db.GetUserByUsername(username)
 	if err != nil {
@@ -88,8 +94,7 @@ func (s *Service) Login(username, password string) (*model.User, string, error)
 
 // Logout invalidates a session token
 func (s *Service) Logout(token string) error {
-	// TODO: Implement token invalidation
-	return nil
+	return RevokeToken(strings.TrimPrefix(token, "Bearer "))
 }
 
 // ChangePassword changes a user's password
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	cryptoRand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"v/model"
+	"v/settings"
+)
+
+// 会话相关错误
+var (
+	ErrSessionNotFound = errors.New("session has been logged out")
+	ErrSessionIdle     = errors.New("session has expired due to inactivity")
+)
+
+// Session 面板登录会话，对应一个已签发的令牌
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username"`
+	IsAdmin    bool      `json:"is_admin"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SessionStore 记录已签发令牌对应的会话，实现无操作超时、管理员会话数限制和强制下线。
+// 会话只保存在内存中，面板重启后需要重新登录
+type SessionStore struct {
+	mu       sync.Mutex
+	settings *settings.Manager
+	sessions map[string]*Session
+}
+
+// sessions 全局会话记录，由 GenerateToken 和 ValidateToken 使用
+var sessions = NewSessionStore(nil)
+
+// InitSessions 设置会话策略来源，未调用时不限制无操作时长和会话数
+func InitSessions(settingsMgr *settings.Manager) {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	sessions.settings = settingsMgr
+}
+
+// Sessions 返回全局会话记录
+func Sessions() *SessionStore {
+	return sessions
+}
+
+// NewSessionStore 创建会话记录，settingsMgr 为 nil 时不限制无操作时长和会话数
+func NewSessionStore(settingsMgr *settings.Manager) *SessionStore {
+	return &SessionStore{
+		settings: settingsMgr,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Create 为用户创建会话。管理员会话数超过限制时注销最早的会话
+func (s *SessionStore) Create(user *model.User, expiresAt time.Time) (*Session, error) {
+	buf := make([]byte, 16)
+	if _, err := cryptoRand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:         hex.EncodeToString(buf),
+		UserID:     user.ID,
+		Username:   user.Username,
+		IsAdmin:    user.IsAdmin,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	if limit := s.security().MaxAdminSessions; user.IsAdmin && limit > 0 {
+		active := s.userSessions(user.ID)
+		for i := 0; i <= len(active)-limit; i++ {
+			delete(s.sessions, active[i].ID)
+		}
+	}
+	s.sessions[session.ID] = session
+	return session, nil
+}
+
+// Touch 检查会话是否有效并刷新最后活动时间
+func (s *SessionStore) Touch(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		delete(s.sessions, id)
+		return nil, ErrTokenExpired
+	}
+	if idle := s.security().SessionIdleTimeout; idle > 0 && now.Sub(session.LastSeenAt) > idle {
+		delete(s.sessions, id)
+		return nil, ErrSessionIdle
+	}
+
+	session.LastSeenAt = now
+	snapshot := *session
+	return &snapshot, nil
+}
+
+// List 返回用户的有效会话，按创建时间排序
+func (s *SessionStore) List(userID int64) []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+	active := s.userSessions(userID)
+	list := make([]*Session, 0, len(active))
+	for _, session := range active {
+		snapshot := *session
+		list = append(list, &snapshot)
+	}
+	return list
+}
+
+// Revoke 注销指定会话，会话不属于该用户时返回 false
+func (s *SessionStore) Revoke(userID int64, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.UserID != userID {
+		return false
+	}
+	delete(s.sessions, id)
+	return true
+}
+
+// RevokeUser 注销用户的全部会话，返回注销的会话数。修改密码后调用以强制所有设备重新登录
+func (s *SessionStore) RevokeUser(userID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+			count++
+		}
+	}
+	return count
+}
+
+// userSessions 返回用户的会话，按创建时间排序，调用方必须持有 s.mu
+func (s *SessionStore) userSessions(userID int64) []*Session {
+	var list []*Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			list = append(list, session)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// sweep 清理已过期和无操作超时的会话，调用方必须持有 s.mu
+func (s *SessionStore) sweep(now time.Time) {
+	idle := s.security().SessionIdleTimeout
+	for id, session := range s.sessions {
+		if now.After(session.ExpiresAt) || (idle > 0 && now.Sub(session.LastSeenAt) > idle) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// security 返回当前的安全设置
+func (s *SessionStore) security() settings.SecuritySettings {
+	if s.settings == nil {
+		return settings.SecuritySettings{}
+	}
+	return s.settings.Get().Security
+}
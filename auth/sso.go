@@ -0,0 +1,588 @@
+package auth
+
+import (
+	"context"
+	cryptoRand "crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 单点登录相关错误
+var (
+	ErrSSODisabled           = errors.New("single sign-on is disabled")
+	ErrSSOInvalidState       = errors.New("invalid or expired sso state")
+	ErrSSOUserNotAllowed     = errors.New("user is not a member of any allowed group")
+	ErrSSOUserNotProvisioned = errors.New("user does not exist and auto provisioning is disabled")
+	ErrSSOUsernameTaken      = errors.New("a local account with the same username already exists")
+	ErrLocalLoginDisabled    = errors.New("local password login is disabled")
+)
+
+// 面板角色
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// oidcDiscovery OpenID Provider 元数据
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// externalIdentity 外部身份，Issuer 和 Subject 一起唯一确定身份来源中的一个用户
+type externalIdentity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool // 身份提供者已验证邮箱
+	Groups        []string
+}
+
+// oidcState 一次授权请求的 state，nonce 单独生成，用于校验 ID Token 属于这次请求
+type oidcState struct {
+	nonce    string
+	expireAt time.Time
+}
+
+// SSOProvider 处理 OIDC 和 LDAP 认证，并将外部身份映射为面板账户。
+// 外部身份按 (Issuer, Subject) 关联到面板用户，不会按用户名或邮箱关联到已有的本地账号
+type SSOProvider struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	db       model.DB
+	client   *http.Client
+
+	mu          sync.Mutex
+	states      map[string]oidcState
+	discovery   *oidcDiscovery
+	keys        map[string]*rsa.PublicKey
+	refreshedAt time.Time
+}
+
+// NewSSOProvider 创建单点登录提供者
+func NewSSOProvider(log *logger.Logger, settingsMgr *settings.Manager, db model.DB) *SSOProvider {
+	return &SSOProvider{
+		log:      log,
+		settings: settingsMgr,
+		db:       db,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		states:   make(map[string]oidcState),
+	}
+}
+
+// LocalLoginAllowed 返回是否允许本地密码登录
+func (p *SSOProvider) LocalLoginAllowed() bool {
+	return !p.settings.Get().SSO.DisableLocalLogin
+}
+
+// Providers 返回已启用的认证来源
+func (p *SSOProvider) Providers() map[string]bool {
+	s := p.settings.Get().SSO
+	return map[string]bool{
+		"local": !s.DisableLocalLogin,
+		"oidc":  s.OIDCEnable,
+		"ldap":  s.LDAPEnable,
+	}
+}
+
+// OIDCAuthURL 生成跳转到身份提供者的授权地址
+func (p *SSOProvider) OIDCAuthURL(ctx context.Context) (string, error) {
+	s := p.settings.Get().SSO
+	if !s.OIDCEnable {
+		return "", ErrSSODisabled
+	}
+
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, nonce := generateSecureToken(), generateSecureToken()
+	p.mu.Lock()
+	p.cleanupStatesLocked()
+	p.states[state] = oidcState{nonce: nonce, expireAt: time.Now().Add(10 * time.Minute)}
+	p.mu.Unlock()
+
+	scopes := s.OIDCScopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", s.OIDCClientID)
+	query.Set("redirect_uri", s.OIDCRedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+
+	return disc.AuthorizationEndpoint + "?" + query.Encode(), nil
+}
+
+// OIDCCallback 用授权码换取 ID Token，并返回对应的面板用户
+func (p *SSOProvider) OIDCCallback(ctx context.Context, code, state string) (*model.User, error) {
+	s := p.settings.Get().SSO
+	if !s.OIDCEnable {
+		return nil, ErrSSODisabled
+	}
+
+	p.mu.Lock()
+	pending, ok := p.states[state]
+	delete(p.states, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(pending.expireAt) {
+		return nil, ErrSSOInvalidState
+	}
+
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 换取令牌
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.OIDCRedirectURL)
+	form.Set("client_id", s.OIDCClientID)
+	form.Set("client_secret", s.OIDCClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.New("token response does not contain id_token")
+	}
+
+	// 验证 ID Token
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenResp.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(disc.Issuer),
+		jwt.WithAudience(s.OIDCClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %v", err)
+	}
+	if nonce, _ := claims["nonce"].(string); nonce == "" || nonce != pending.nonce {
+		return nil, errors.New("invalid id token nonce")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("id token does not contain sub claim")
+	}
+
+	usernameClaim := s.OIDCUsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	username, _ := claims[usernameClaim].(string)
+	email, _ := claims["email"].(string)
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		return nil, fmt.Errorf("id token does not contain %s claim", usernameClaim)
+	}
+
+	groupsClaim := s.OIDCGroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	emailVerified, _ := claims["email_verified"].(bool)
+
+	return p.provisionUser(&externalIdentity{
+		Issuer:        disc.Issuer,
+		Subject:       subject,
+		Username:      username,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Groups:        claimStrings(claims[groupsClaim]),
+	})
+}
+
+// LDAPLogin 通过 LDAP 绑定认证用户
+func (p *SSOProvider) LDAPLogin(username, password string) (*model.User, error) {
+	s := p.settings.Get().SSO
+	if !s.LDAPEnable {
+		return nil, ErrSSODisabled
+	}
+	if username == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	dn := strings.Replace(s.LDAPBindDN, "%s", ldapEscapeDN(username), 1)
+	conn, err := ldapDial(s.LDAPAddress, s.LDAPUseTLS)
+	if err != nil {
+		return nil, fmt.Errorf("ldap authentication failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.bind(dn, password); err != nil {
+		p.log.WarnWithFields("LDAP login failed", logger.Fields{
+			"username": username,
+			"error":    err,
+		})
+		if err == ErrInvalidCredentials {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ldap authentication failed: %v", err)
+	}
+
+	groups, err := ldapGroups(conn, dn, s)
+	if err != nil {
+		p.log.WarnWithFields("Failed to read LDAP groups", logger.Fields{
+			"username": username,
+			"error":    err,
+		})
+		return nil, fmt.Errorf("failed to read ldap groups: %v", err)
+	}
+
+	return p.provisionUser(&externalIdentity{
+		Issuer:   "ldap://" + s.LDAPAddress,
+		Subject:  strings.ToLower(dn),
+		Username: username,
+		Groups:   groups,
+	})
+}
+
+// ldapGroups 以用户自己的身份读取所属的组：用户条目的 memberOf，以及配置了
+// LDAPGroupBaseDN 时在其下成员属性包含该用户 DN 的组。组的完整 DN 和第一个 RDN 的值（通常为 cn）都参与角色映射
+func ldapGroups(conn *ldapConn, dn string, s settings.SSOSettings) ([]string, error) {
+	var groups []string
+	entries, err := conn.search(dn, ldapScopeBase, "", "", []string{"memberOf"})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		for _, group := range entry.Attributes["memberof"] {
+			groups = append(groups, group)
+			if name := ldapRDNValue(group); name != "" {
+				groups = append(groups, name)
+			}
+		}
+	}
+
+	if s.LDAPGroupBaseDN == "" {
+		return groups, nil
+	}
+	memberAttr := s.LDAPGroupMember
+	if memberAttr == "" {
+		memberAttr = "member"
+	}
+	entries, err = conn.search(s.LDAPGroupBaseDN, ldapScopeSubtree, memberAttr, dn, []string{"cn"})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		groups = append(groups, entry.DN)
+		groups = append(groups, entry.Attributes["cn"]...)
+	}
+	return groups, nil
+}
+
+// MapRole 根据外部组映射面板角色
+func (p *SSOProvider) MapRole(groups []string) (string, error) {
+	s := p.settings.Get().SSO
+	if containsAny(groups, s.AdminGroups) {
+		return RoleAdmin, nil
+	}
+	// 未配置用户组时，所有通过认证的用户都是普通用户
+	if len(s.UserGroups) == 0 || containsAny(groups, s.UserGroups) {
+		return RoleUser, nil
+	}
+	return "", ErrSSOUserNotAllowed
+}
+
+// provisionUser 按外部身份查找或即时创建面板用户，并同步角色。
+// 只匹配此前由同一身份创建的用户；同名的本地账号已存在时拒绝登录，由管理员处理，避免冒用本地账号
+func (p *SSOProvider) provisionUser(identity *externalIdentity) (*model.User, error) {
+	role, err := p.MapRole(identity.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user, err := p.db.GetUserByIdentity(identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %v", err)
+	}
+	if user == nil {
+		if !p.settings.Get().SSO.AutoProvision {
+			return nil, ErrSSOUserNotProvisioned
+		}
+		existing, err := p.db.GetUserByUsername(identity.Username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up user: %v", err)
+		}
+		if existing != nil {
+			p.log.WarnWithFields("SSO user conflicts with a local account", logger.Fields{
+				"username": identity.Username,
+				"issuer":   identity.Issuer,
+			})
+			return nil, ErrSSOUsernameTaken
+		}
+		email, err := p.availableEmail(identity.Email, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		// 外部账户使用随机密码，无法通过本地密码登录
+		hashedPassword, err := HashPassword(generateSecureToken())
+		if err != nil {
+			return nil, err
+		}
+
+		user = &model.User{
+			Username:      identity.Username,
+			Password:      hashedPassword,
+			Email:         email,
+			EmailVerified: email != "" && identity.EmailVerified,
+			Role:          role,
+			IsAdmin:       role == RoleAdmin,
+			Status:        "active",
+			Enabled:       true,
+			LastLoginAt:   &now,
+			SSOIssuer:     identity.Issuer,
+			SSOSubject:    identity.Subject,
+		}
+		if err := p.db.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to provision user: %v", err)
+		}
+
+		p.log.WithFields("SSO user provisioned", logger.Fields{
+			"username": identity.Username,
+			"issuer":   identity.Issuer,
+			"role":     role,
+		})
+		return user, nil
+	}
+
+	if !user.Enabled {
+		return nil, ErrAccountDisabled
+	}
+
+	user.Role = role
+	user.IsAdmin = role == RoleAdmin
+	user.LastLoginAt = &now
+	if identity.Email != "" && !strings.EqualFold(identity.Email, user.Email) {
+		email, err := p.availableEmail(identity.Email, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if email != "" {
+			user.Email = email
+			user.EmailVerified = identity.EmailVerified
+		}
+	}
+	if err := p.db.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %v", err)
+	}
+
+	return user, nil
+}
+
+// availableEmail 返回可以使用的邮箱，已被其他用户使用时返回空字符串
+func (p *SSOProvider) availableEmail(email string, userID int64) (string, error) {
+	if email == "" {
+		return "", nil
+	}
+	other, err := p.db.GetUserByEmail(email)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up email: %v", err)
+	}
+	if other != nil && other.ID != userID {
+		return "", nil
+	}
+	return email, nil
+}
+
+// getDiscovery 获取并缓存 OIDC 元数据
+func (p *SSOProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	if p.discovery != nil && time.Since(p.refreshedAt) < time.Hour {
+		disc := p.discovery
+		p.mu.Unlock()
+		return disc, nil
+	}
+	p.mu.Unlock()
+
+	issuer := strings.TrimRight(p.settings.Get().SSO.OIDCIssuer, "/")
+	var disc oidcDiscovery
+	if err := p.getJSON(ctx, issuer+"/.well-known/openid-configuration", &disc); err != nil {
+		return nil, fmt.Errorf("failed to load oidc discovery: %v", err)
+	}
+
+	p.mu.Lock()
+	p.discovery = &disc
+	p.keys = nil
+	p.refreshedAt = time.Now()
+	p.mu.Unlock()
+
+	return &disc, nil
+}
+
+// getKey 获取用于验证 ID Token 的公钥
+func (p *SSOProvider) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, disc.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to load jwks: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key not found: %s", kid)
+}
+
+// getJSON 请求并解析 JSON
+func (p *SSOProvider) getJSON(ctx context.Context, rawURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// cleanupStatesLocked 清理过期的 state，调用方需持有锁
+func (p *SSOProvider) cleanupStatesLocked() {
+	now := time.Now()
+	for state, pending := range p.states {
+		if now.After(pending.expireAt) {
+			delete(p.states, state)
+		}
+	}
+}
+
+// claimStrings 将声明值转换为字符串列表
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		result := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// containsAny 判断两个列表是否有交集
+func containsAny(values, candidates []string) bool {
+	for _, v := range values {
+		for _, c := range candidates {
+			if strings.EqualFold(v, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generateSecureToken 生成随机的 URL 安全字符串
+func generateSecureToken() string {
+	b := make([]byte, 32)
+	cryptoRand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
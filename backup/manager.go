@@ -6,13 +6,16 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"v/config"
+	"v/heartbeat"
 	"v/logger"
 	"v/model"
 	"v/notification"
 	"v/settings"
+	"v/utils"
 )
 
 // Manager 备份管理器
@@ -21,12 +24,15 @@ type Manager struct {
 	db          model.DB
 	backupDir   string
 	settingsMgr *settings.Manager
-	notifyMgr   *notification.Manager
+	notifyMgr   notification.Notifier
 	config      *config.Config
+	stopCh      chan struct{}
+	remoteMu    sync.Mutex // 串行化远程上传
+	heartbeat   *heartbeat.Pinger
 }
 
 // New 创建备份管理器
-func New(log *logger.Logger, settingsMgr *settings.Manager, notifyMgr *notification.Manager, cfg *config.Config, db model.DB) *Manager {
+func New(log *logger.Logger, settingsMgr *settings.Manager, notifyMgr notification.Notifier, cfg *config.Config, db model.DB) *Manager {
 	return &Manager{
 		log:         log,
 		db:          db,
@@ -37,8 +43,33 @@ func New(log *logger.Logger, settingsMgr *settings.Manager, notifyMgr *notificat
 	}
 }
 
+// SetHeartbeat 设置外部心跳，自动备份成功后上报
+func (m *Manager) SetHeartbeat(h *heartbeat.Pinger) {
+	m.heartbeat = h
+}
+
+// estimateSize 估算备份文件大小。备份包含数据库记录和设置，以数据库文件和设置文件的大小之和估算
+func (m *Manager) estimateSize() uint64 {
+	var total int64
+	for _, path := range []string{m.config.Database.Path, m.settingsMgr.Path()} {
+		if path == "" {
+			continue
+		}
+		if size, _, err := utils.DirSize(path); err == nil {
+			total += size
+		}
+	}
+	return uint64(total)
+}
+
 // CreateBackup 创建备份
 func (m *Manager) CreateBackup() (*model.Backup, error) {
+	// 检查磁盘空间，写入备份后仍需保留最小可用空间
+	minFree := utils.MinFreeDiskBytes(m.settingsMgr.Get().Monitor.MinFreeDiskMB)
+	if err := utils.CheckDiskSpace(m.backupDir, m.estimateSize(), minFree); err != nil {
+		return nil, fmt.Errorf("refusing to create backup: %w", err)
+	}
+
 	// 创建备份目录
 	if err := os.MkdirAll(m.backupDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create backup directory: %v", err)
@@ -139,6 +170,20 @@ func (m *Manager) CreateBackup() (*model.Backup, error) {
 		Type:    "backup_created",
 	})
 
+	// 清理超出保留数量的本地备份
+	if deleted, err := m.pruneLocal(m.settingsMgr.Get().Backup.Retention); err != nil {
+		m.log.WarnWithFields("Failed to prune local backups", logger.Fields{
+			"error": err.Error(),
+		})
+	} else if deleted > 0 {
+		m.log.WithFields("Old local backups pruned", logger.Fields{
+			"deleted": deleted,
+		})
+	}
+
+	// 后台上传到远程目标，不阻塞备份请求
+	go m.uploadRemote(backup.Path)
+
 	return backup, nil
 }
 
@@ -168,13 +213,36 @@ func (m *Manager) RestoreBackup(backupID int64) error {
 		return err
 	}
 
+	if err := m.restoreFile(backup.Path); err != nil {
+		return err
+	}
+
+	// 记录恢复信息
+	m.log.Info("Backup restored successfully", logger.Fields{
+		"backup_id": backupID,
+		"timestamp": time.Now(),
+	})
+
+	// 发送通知
+	m.notifyMgr.Send(&notification.Notification{
+		To:      []string{m.settingsMgr.Get().Admin.Email},
+		Subject: "Backup Restored",
+		Body:    fmt.Sprintf("Backup %d restored successfully", backupID),
+		Type:    "backup_restored",
+	})
+
+	return nil
+}
+
+// restoreFile 从备份文件恢复用户、协议、证书和系统设置
+func (m *Manager) restoreFile(path string) error {
 	// 检查备份文件是否存在
-	if _, err := os.Stat(backup.Path); os.IsNotExist(err) {
-		return fmt.Errorf("backup file not found: %s", backup.Path)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("backup file not found: %s", path)
 	}
 
 	// 打开备份文件
-	file, err := os.Open(backup.Path)
+	file, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("failed to open backup file: %v", err)
 	}
@@ -182,10 +250,10 @@ func (m *Manager) RestoreBackup(backupID int64) error {
 
 	// 读取备份数据
 	var backupData struct {
-		Users        []*model.User          `json:"users"`
-		Protocols    []*model.Protocol      `json:"protocols"`
-		Certificates []*model.Certificate   `json:"certificates"`
-		Settings     map[string]interface{} `json:"settings"`
+		Users        []*model.User        `json:"users"`
+		Protocols    []*model.Protocol    `json:"protocols"`
+		Certificates []*model.Certificate `json:"certificates"`
+		Settings     json.RawMessage      `json:"settings"`
 	}
 
 	decoder := json.NewDecoder(file)
@@ -222,24 +290,17 @@ func (m *Manager) RestoreBackup(backupID int64) error {
 		}
 	}
 
-	// 恢复系统设置
-	if err := m.settingsMgr.Update(&settings.Settings{
-		Site:         backupData.Settings["site"].(settings.SiteSettings),
-		Traffic:      backupData.Settings["traffic"].(settings.TrafficSettings),
-		SSL:          backupData.Settings["ssl"].(settings.SSLSettings),
-		Proxy:        backupData.Settings["proxy"].(settings.ProxySettings),
-		Security:     backupData.Settings["security"].(settings.SecuritySettings),
-		Notification: backupData.Settings["notification"].(settings.NotificationSettings),
-		Backup:       backupData.Settings["backup"].(settings.BackupSettings),
-		Monitor:      backupData.Settings["monitor"].(settings.MonitorSettings),
-		Log:          backupData.Settings["log"].(settings.LogSettings),
-		Admin:        backupData.Settings["admin"].(settings.AdminSettings),
-		Xray:         backupData.Settings["xray"].(settings.XraySettings),
-		Protocols:    backupData.Settings["protocols"].(map[string]bool),
-		Transports:   backupData.Settings["transports"].(map[string]bool),
-	}); err != nil {
-		m.db.Rollback()
-		return fmt.Errorf("failed to restore settings: %v", err)
+	// 恢复系统设置，备份中的各部分覆盖当前设置，未包含的部分保持不变
+	if len(backupData.Settings) > 0 {
+		restored := m.settingsMgr.Clone()
+		if err := json.Unmarshal(backupData.Settings, restored); err != nil {
+			m.db.Rollback()
+			return fmt.Errorf("failed to decode backup settings: %v", err)
+		}
+		if err := m.settingsMgr.Replace(restored); err != nil {
+			m.db.Rollback()
+			return fmt.Errorf("failed to restore settings: %v", err)
+		}
 	}
 
 	// 提交事务
@@ -247,20 +308,6 @@ func (m *Manager) RestoreBackup(backupID int64) error {
 		return fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
-	// 记录恢复信息
-	m.log.Info("Backup restored successfully", logger.Fields{
-		"backup_id": backupID,
-		"timestamp": time.Now(),
-	})
-
-	// 发送通知
-	m.notifyMgr.Send(&notification.Notification{
-		To:      []string{m.settingsMgr.Get().Admin.Email},
-		Subject: "Backup Restored",
-		Body:    fmt.Sprintf("Backup %d restored successfully", backupID),
-		Type:    "backup_restored",
-	})
-
 	return nil
 }
 
@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"v/logger"
+	"v/notification"
+	"v/settings"
+)
+
+// remoteTimeout 单个远程目标上传、下载的超时时间
+const remoteTimeout = 30 * time.Minute
+
+// ErrTargetNotFound 远程备份目标不存在或未启用
+var ErrTargetNotFound = errors.New("backup target not found")
+
+// uploadRemote 将本地备份依次上传到所有启用的远程目标，并按保留数量清理远程旧备份。
+// 单个目标失败不影响其他目标
+func (m *Manager) uploadRemote(localPath string) {
+	m.remoteMu.Lock()
+	defer m.remoteMu.Unlock()
+
+	cfg := m.settingsMgr.Get().Backup
+	for _, target := range cfg.Targets {
+		if !target.Enable {
+			continue
+		}
+		deleted, err := m.uploadTarget(target, cfg.Retention, localPath)
+		if err != nil {
+			m.log.ErrorWithFields("Failed to upload backup to remote target", logger.Fields{
+				"target": target.Name,
+				"type":   target.Type,
+				"path":   localPath,
+				"error":  err.Error(),
+			})
+			m.notifyMgr.Send(&notification.Notification{
+				To:      []string{m.settingsMgr.Get().Admin.Email},
+				Subject: "Backup Upload Failed",
+				Body:    fmt.Sprintf("Failed to upload backup %s to remote target %s: %v", localPath, target.Name, err),
+				Type:    "backup_upload_failed",
+			})
+		} else {
+			m.log.WithFields("Backup uploaded to remote target", logger.Fields{
+				"target":  target.Name,
+				"type":    target.Type,
+				"path":    localPath,
+				"deleted": deleted,
+			})
+		}
+	}
+}
+
+// uploadTarget 上传到单个目标并清理旧备份，返回清理的数量
+func (m *Manager) uploadTarget(target settings.BackupTarget, retention int, localPath string) (int, error) {
+	store, err := newStorage(target)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+
+	if err := store.Put(ctx, filepath.Base(localPath), file, info.Size()); err != nil {
+		return 0, fmt.Errorf("failed to upload backup: %v", err)
+	}
+
+	if target.Retention > 0 {
+		retention = target.Retention
+	}
+	return pruneRemote(ctx, store, retention)
+}
+
+// pruneRemote 删除超出保留数量的远程备份，keep 不大于 0 时不清理
+func pruneRemote(ctx context.Context, store Storage, keep int) (int, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list remote backups: %v", err)
+	}
+	deleted := 0
+	for _, obj := range objects[min(len(objects), keep):] {
+		if err := store.Delete(ctx, obj.Name); err != nil {
+			return deleted, fmt.Errorf("failed to delete remote backup %s: %v", obj.Name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// pruneLocal 删除超出保留数量的本地备份，keep 不大于 0 时不清理
+func (m *Manager) pruneLocal(keep int) (int, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+	files, err := filepath.Glob(filepath.Join(m.backupDir, "backup_*.json"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list backups: %v", err)
+	}
+	// 文件名包含时间戳，按名称倒序即按时间倒序
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	deleted := 0
+	for _, file := range files[min(len(files), keep):] {
+		if err := os.Remove(file); err != nil {
+			return deleted, fmt.Errorf("failed to delete backup file: %v", err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// ListRemote 列出远程目标上的备份，按时间倒序排列
+func (m *Manager) ListRemote(targetName string) ([]RemoteObject, error) {
+	store, err := m.storage(targetName)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	return store.List(ctx)
+}
+
+// RestoreRemote 从远程目标下载备份并恢复，下载的文件保存在本地备份目录中
+func (m *Manager) RestoreRemote(targetName, name string) error {
+	if err := validRemoteName(name); err != nil {
+		return err
+	}
+	store, err := m.storage(targetName)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+
+	reader, err := store.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(m.backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	// 先写入临时文件，下载完整后再改名，避免留下不完整的备份
+	tmp, err := os.CreateTemp(m.backupDir, ".remote-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download backup: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write backup file: %v", err)
+	}
+	localPath := filepath.Join(m.backupDir, name)
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return fmt.Errorf("failed to save backup file: %v", err)
+	}
+
+	if err := m.restoreFile(localPath); err != nil {
+		return err
+	}
+
+	m.log.WithFields("Backup restored from remote target", logger.Fields{
+		"target": targetName,
+		"name":   name,
+	})
+	return nil
+}
+
+// storage 返回启用的远程目标对应的存储
+func (m *Manager) storage(targetName string) (Storage, error) {
+	for _, target := range m.settingsMgr.Get().Backup.Targets {
+		if target.Name == targetName && target.Enable {
+			return newStorage(target)
+		}
+	}
+	return nil, ErrTargetNotFound
+}
@@ -0,0 +1,244 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"v/settings"
+)
+
+// s3Storage S3 兼容对象存储，使用路径风格地址和 AWS Signature V4 签名
+type s3Storage struct {
+	endpoint  string
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// newS3Storage 创建 S3 存储
+func newS3Storage(target settings.BackupTarget) *s3Storage {
+	region := target.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	prefix := strings.Trim(target.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Storage{
+		endpoint:  strings.TrimRight(target.Endpoint, "/"),
+		region:    region,
+		bucket:    target.Bucket,
+		prefix:    prefix,
+		accessKey: target.Username,
+		secretKey: target.Password.String(),
+		client:    &http.Client{},
+	}
+}
+
+// Put 上传对象，请求体不参与签名以支持流式上传
+func (s *s3Storage) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, s.prefix+name, nil, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get 下载对象
+func (s *s3Storage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.prefix+name, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// List 列出前缀下的备份对象
+func (s *s3Storage) List(ctx context.Context) ([]RemoteObject, error) {
+	var objects []RemoteObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse s3 list response: %v", err)
+		}
+
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.prefix)
+			if strings.Contains(name, "/") || !isBackupFile(name) {
+				continue
+			}
+			objects = append(objects, RemoteObject{Name: name, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sortObjects(objects)
+	return objects, nil
+}
+
+// Delete 删除对象
+func (s *s3Storage) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.prefix+name, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do 发送签名请求，非 2xx 响应返回错误
+func (s *s3Storage) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s failed: %v", method, err)
+	}
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		resp.Body.Close()
+		return nil, ErrRemoteNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s failed: %s: %s", method, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// sign 使用 AWS Signature V4 签名请求
+func (s *s3Storage) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := "UNSIGNED-PAYLOAD"
+	if req.Body == nil {
+		sum := sha256.Sum256(nil)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 计算 HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery 按键排序并编码查询参数
+func s3CanonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape 按 RFC 3986 编码，只保留非保留字符，encodeSlash 为 false 时保留路径分隔符
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"time"
+
+	"v/heartbeat"
+	"v/logger"
+	"v/utils"
+)
+
+// scheduleRecheckInterval 自动备份未启用或配置无效时重新检查设置的间隔
+const scheduleRecheckInterval = time.Minute
+
+// Start 启动自动备份。设置了 Backup.Time 时每天在面板时区的该时刻备份，否则按 Interval 间隔备份。
+// 设置每轮重新读取，修改后无需重启
+func (m *Manager) Start() {
+	if m.stopCh != nil {
+		return
+	}
+	m.stopCh = make(chan struct{})
+	go m.run(m.stopCh)
+}
+
+// Stop 停止自动备份
+func (m *Manager) Stop() {
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
+}
+
+// run 自动备份循环
+func (m *Manager) run(stopCh chan struct{}) {
+	for {
+		wait, scheduled := m.nextRun()
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(wait):
+		}
+		if !scheduled {
+			continue
+		}
+
+		backup, err := m.CreateBackup()
+		if err != nil {
+			m.log.ErrorWithFields("Scheduled backup failed", logger.Fields{
+				"error": err.Error(),
+			})
+			m.heartbeat.Fail(heartbeat.JobBackup, err)
+			continue
+		}
+		m.heartbeat.Success(heartbeat.JobBackup)
+		m.log.WithFields("Scheduled backup created", logger.Fields{
+			"backup_id": backup.ID,
+			"path":      backup.Path,
+		})
+	}
+}
+
+// nextRun 返回距下一次自动备份的等待时间，scheduled 为 false 时只需等待后重新检查设置
+func (m *Manager) nextRun() (time.Duration, bool) {
+	cfg := m.settingsMgr.Get().Backup
+	if !cfg.Enable {
+		return scheduleRecheckInterval, false
+	}
+
+	if cfg.Time != "" {
+		now := time.Now().In(m.settingsMgr.Location())
+		next, err := utils.NextDailyRun(now, cfg.Time)
+		if err != nil {
+			m.log.WarnWithFields("Invalid backup time", logger.Fields{
+				"time":  cfg.Time,
+				"error": err.Error(),
+			})
+			return scheduleRecheckInterval, false
+		}
+		// 最多等待一个检查间隔，使时区和备份时间的修改及时生效
+		if wait := next.Sub(now); wait > scheduleRecheckInterval {
+			return scheduleRecheckInterval, false
+		}
+		return next.Sub(now), true
+	}
+
+	if cfg.Interval > 0 {
+		return cfg.Interval, true
+	}
+	return scheduleRecheckInterval, false
+}
@@ -0,0 +1,534 @@
+package backup
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"v/settings"
+)
+
+// SFTP 协议版本 3 使用的报文类型和常量
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpWrite   = 6
+	sftpOpenDir = 11
+	sftpReadDir = 12
+	sftpRemove  = 13
+	sftpMkdir   = 14
+	sftpStatus  = 101
+
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+
+	sftpStatusOK     = 0
+	sftpStatusEOF    = 1
+	sftpStatusNoFile = 2
+
+	sftpChunkSize   = 32 * 1024
+	sftpDialTimeout = 30 * time.Second
+)
+
+// errMalformedSFTP 报文格式错误
+var errMalformedSFTP = errors.New("malformed sftp packet")
+
+// sftpStorage 通过 SSH 的 SFTP 子系统存储备份，每次操作建立一个连接
+type sftpStorage struct {
+	addr       string
+	dir        string
+	username   string
+	password   string
+	privateKey string
+	hostKey    string
+}
+
+// newSFTPStorage 创建 SFTP 存储，Endpoint 为 host 或 host:port
+func newSFTPStorage(target settings.BackupTarget) *sftpStorage {
+	addr := target.Endpoint
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	dir := strings.TrimRight(target.Path, "/")
+	if dir == "" {
+		dir = "."
+	}
+	return &sftpStorage{
+		addr:       addr,
+		dir:        dir,
+		username:   target.Username,
+		password:   target.Password.String(),
+		privateKey: target.PrivateKey.String(),
+		hostKey:    target.HostKey,
+	}
+}
+
+// Put 上传文件，目录不存在时逐级创建
+func (s *sftpStorage) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	client.mkdirAll(s.dir)
+	handle, err := client.open(path.Join(s.dir, name), sftpFlagWrite|sftpFlagCreate|sftpFlagTrunc)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, sftpChunkSize)
+	var offset uint64
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if err := client.write(handle, offset, buf[:n]); err != nil {
+				client.closeHandle(handle)
+				return err
+			}
+			offset += uint64(n)
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			client.closeHandle(handle)
+			return rerr
+		}
+	}
+	return client.closeHandle(handle)
+}
+
+// Get 下载文件，关闭返回的读取器时断开连接
+func (s *sftpStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := client.open(path.Join(s.dir, name), sftpFlagRead)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &sftpFile{client: client, handle: handle}, nil
+}
+
+// List 列出目录下的备份文件
+func (s *sftpStorage) List(ctx context.Context) ([]RemoteObject, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	objects, err := client.readDir(s.dir)
+	if err == ErrRemoteNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortObjects(objects)
+	return objects, nil
+}
+
+// Delete 删除文件
+func (s *sftpStorage) Delete(ctx context.Context, name string) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, err = client.request(sftpRemove, sftpString(path.Join(s.dir, name)))
+	return err
+}
+
+// connect 建立 SSH 连接并启动 SFTP 子系统，ctx 取消时断开连接
+func (s *sftpStorage) connect(ctx context.Context) (*sftpClient, error) {
+	var auth []ssh.AuthMethod
+	if s.privateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(s.privateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sftp private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if s.password != "" {
+		auth = append(auth, ssh.Password(s.password))
+	}
+
+	// 必须校验服务器公钥，否则中间人可以拿到密码并篡改备份
+	if s.hostKey == "" {
+		return nil, fmt.Errorf("sftp host key is required")
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.hostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sftp host key: %v", err)
+	}
+	hostKeyCallback := ssh.FixedHostKey(key)
+
+	dialer := net.Dialer{Timeout: sftpDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to sftp server: %v", err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.addr, &ssh.ClientConfig{
+		User:            s.username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake failed: %v", err)
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	session, err := sshClient.NewSession()
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("failed to open ssh session: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("failed to start sftp subsystem: %v", err)
+	}
+
+	client := &sftpClient{ssh: sshClient, w: stdin, r: stdout, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			sshClient.Close()
+		case <-client.done:
+		}
+	}()
+
+	if err := client.init(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// sftpClient 最小的 SFTP v3 客户端，请求按顺序发送并等待响应
+type sftpClient struct {
+	ssh       *ssh.Client
+	w         io.Writer
+	r         io.Reader
+	mu        sync.Mutex
+	nextID    uint32
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Close 断开连接
+func (c *sftpClient) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.ssh.Close()
+}
+
+// init 协商协议版本
+func (c *sftpClient) init() error {
+	if err := c.send(sftpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return err
+	}
+	typ, _, err := c.recv()
+	if err != nil {
+		return err
+	}
+	if typ != sftpVersion {
+		return fmt.Errorf("unexpected sftp packet type %d", typ)
+	}
+	return nil
+}
+
+// open 打开文件，返回文件句柄
+func (c *sftpClient) open(name string, flags uint32) (string, error) {
+	payload := sftpString(name)
+	payload = binary.BigEndian.AppendUint32(payload, flags)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // 不设置属性
+	return c.handle(sftpOpen, payload)
+}
+
+// closeHandle 关闭文件或目录句柄
+func (c *sftpClient) closeHandle(handle string) error {
+	_, err := c.request(sftpClose, sftpString(handle))
+	return err
+}
+
+// write 在指定偏移处写入数据
+func (c *sftpClient) write(handle string, offset uint64, data []byte) error {
+	payload := sftpString(handle)
+	payload = binary.BigEndian.AppendUint64(payload, offset)
+	payload = append(payload, sftpString(string(data))...)
+	_, err := c.request(sftpWrite, payload)
+	return err
+}
+
+// read 从指定偏移处读取数据，文件结束时返回 io.EOF
+func (c *sftpClient) read(handle string, offset uint64, size uint32) ([]byte, error) {
+	payload := sftpString(handle)
+	payload = binary.BigEndian.AppendUint64(payload, offset)
+	payload = binary.BigEndian.AppendUint32(payload, size)
+	data, err := c.request(sftpRead, payload)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := sftpReadString(data)
+	return []byte(value), err
+}
+
+// mkdirAll 逐级创建目录，已存在的目录报错被忽略
+func (c *sftpClient) mkdirAll(dir string) {
+	if dir == "." || dir == "/" {
+		return
+	}
+	current := ""
+	if strings.HasPrefix(dir, "/") {
+		current = "/"
+	}
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		current = path.Join(current, part)
+		payload := binary.BigEndian.AppendUint32(sftpString(current), 0)
+		c.request(sftpMkdir, payload)
+	}
+}
+
+// readDir 列出目录中的备份文件
+func (c *sftpClient) readDir(dir string) ([]RemoteObject, error) {
+	handle, err := c.handle(sftpOpenDir, sftpString(dir))
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeHandle(handle)
+
+	var objects []RemoteObject
+	for {
+		data, err := c.request(sftpReadDir, sftpString(handle))
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 4 {
+			return nil, fmt.Errorf("malformed sftp name packet")
+		}
+		count := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		for i := uint32(0); i < count; i++ {
+			var name string
+			if name, data, err = sftpReadString(data); err != nil {
+				return nil, err
+			}
+			if _, data, err = sftpReadString(data); err != nil { // longname
+				return nil, err
+			}
+			var size int64
+			var mtime time.Time
+			if size, mtime, data, err = sftpReadAttrs(data); err != nil {
+				return nil, err
+			}
+			if isBackupFile(name) {
+				objects = append(objects, RemoteObject{Name: name, Size: size, ModTime: mtime})
+			}
+		}
+	}
+}
+
+// handle 发送返回句柄的请求
+func (c *sftpClient) handle(typ byte, payload []byte) (string, error) {
+	data, err := c.request(typ, payload)
+	if err != nil {
+		return "", err
+	}
+	handle, _, err := sftpReadString(data)
+	return handle, err
+}
+
+// request 发送请求并等待响应，返回响应数据（不含 ID）。
+// 状态为 EOF 时返回 io.EOF，文件不存在时返回 ErrRemoteNotFound
+func (c *sftpClient) request(typ byte, payload []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+	if err := c.send(typ, append(binary.BigEndian.AppendUint32(nil, id), payload...)); err != nil {
+		return nil, err
+	}
+	respType, data, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != id {
+		return nil, fmt.Errorf("unexpected sftp response id")
+	}
+	data = data[4:]
+
+	if respType != sftpStatus {
+		return data, nil
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("malformed sftp status packet")
+	}
+	switch code := binary.BigEndian.Uint32(data); code {
+	case sftpStatusOK:
+		return nil, nil
+	case sftpStatusEOF:
+		return nil, io.EOF
+	case sftpStatusNoFile:
+		return nil, ErrRemoteNotFound
+	default:
+		msg, _, _ := sftpReadString(data[4:])
+		return nil, fmt.Errorf("sftp error %d: %s", code, msg)
+	}
+}
+
+// send 写入一个报文
+func (c *sftpClient) send(typ byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, typ)
+	packet = append(packet, payload...)
+	if _, err := c.w.Write(packet); err != nil {
+		return fmt.Errorf("failed to send sftp packet: %v", err)
+	}
+	return nil
+}
+
+// recv 读取一个报文
+func (c *sftpClient) recv() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("failed to read sftp packet: %v", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > 1<<24 {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", length)
+	}
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return 0, nil, fmt.Errorf("failed to read sftp packet: %v", err)
+	}
+	return header[4], data, nil
+}
+
+// sftpFile 远程文件读取器
+type sftpFile struct {
+	client *sftpClient
+	handle string
+	offset uint64
+}
+
+// Read 实现io.Reader接口
+func (f *sftpFile) Read(p []byte) (int, error) {
+	size := len(p)
+	if size > sftpChunkSize {
+		size = sftpChunkSize
+	}
+	data, err := f.client.read(f.handle, f.offset, uint32(size))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	f.offset += uint64(n)
+	return n, nil
+}
+
+// Close 关闭文件并断开连接
+func (f *sftpFile) Close() error {
+	f.client.closeHandle(f.handle)
+	return f.client.Close()
+}
+
+// sftpString 编码长度前缀的字符串
+func sftpString(s string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(s))), s...)
+}
+
+// sftpReadString 解码长度前缀的字符串，返回剩余数据
+func sftpReadString(data []byte) (string, []byte, error) {
+	if len(data) < 4 {
+		return "", nil, errMalformedSFTP
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < n {
+		return "", nil, errMalformedSFTP
+	}
+	return string(data[4 : 4+n]), data[4+n:], nil
+}
+
+// sftpReadAttrs 解码文件属性，只返回大小和修改时间
+func sftpReadAttrs(data []byte) (int64, time.Time, []byte, error) {
+	var size int64
+	var mtime time.Time
+	if len(data) < 4 {
+		return 0, mtime, nil, errMalformedSFTP
+	}
+	flags := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if flags&0x1 != 0 { // size
+		if len(data) < 8 {
+			return 0, mtime, nil, errMalformedSFTP
+		}
+		size = int64(binary.BigEndian.Uint64(data))
+		data = data[8:]
+	}
+	if flags&0x2 != 0 { // uid, gid
+		if len(data) < 8 {
+			return 0, mtime, nil, errMalformedSFTP
+		}
+		data = data[8:]
+	}
+	if flags&0x4 != 0 { // permissions
+		if len(data) < 4 {
+			return 0, mtime, nil, errMalformedSFTP
+		}
+		data = data[4:]
+	}
+	if flags&0x8 != 0 { // atime, mtime
+		if len(data) < 8 {
+			return 0, mtime, nil, errMalformedSFTP
+		}
+		mtime = time.Unix(int64(binary.BigEndian.Uint32(data[4:8])), 0)
+		data = data[8:]
+	}
+	if flags&0x80000000 != 0 { // extended
+		if len(data) < 4 {
+			return 0, mtime, nil, errMalformedSFTP
+		}
+		count := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		for i := uint32(0); i < count*2; i++ {
+			var err error
+			if _, data, err = sftpReadString(data); err != nil {
+				return 0, mtime, nil, err
+			}
+		}
+	}
+	return size, mtime, data, nil
+}
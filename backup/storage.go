@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"v/settings"
+)
+
+// ErrRemoteNotFound 远程备份不存在
+var ErrRemoteNotFound = errors.New("remote backup not found")
+
+// RemoteObject 远程目标上的备份文件
+type RemoteObject struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Storage 远程备份存储，name 为不含目录的文件名
+type Storage interface {
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	List(ctx context.Context) ([]RemoteObject, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// newStorage 根据目标类型创建远程存储
+func newStorage(target settings.BackupTarget) (Storage, error) {
+	switch target.Type {
+	case settings.BackupTargetS3:
+		return newS3Storage(target), nil
+	case settings.BackupTargetWebDAV:
+		return newWebDAVStorage(target), nil
+	case settings.BackupTargetSFTP:
+		return newSFTPStorage(target), nil
+	default:
+		return nil, fmt.Errorf("unsupported backup target type: %s", target.Type)
+	}
+}
+
+// isBackupFile 判断是否为面板生成的备份文件，远程目录中的其他文件不参与列表和清理
+func isBackupFile(name string) bool {
+	return strings.HasPrefix(name, "backup_") && strings.HasSuffix(name, ".json")
+}
+
+// validRemoteName 检查远程文件名，防止通过名称访问目录之外的文件
+func validRemoteName(name string) error {
+	if name == "" || name != path.Base(name) || strings.ContainsAny(name, `/\`) || !isBackupFile(name) {
+		return fmt.Errorf("invalid backup name: %q", name)
+	}
+	return nil
+}
+
+// sortObjects 按修改时间倒序排列，时间相同时按名称倒序（名称包含时间戳）
+func sortObjects(objects []RemoteObject) {
+	sort.Slice(objects, func(i, j int) bool {
+		if !objects[i].ModTime.Equal(objects[j].ModTime) {
+			return objects[i].ModTime.After(objects[j].ModTime)
+		}
+		return objects[i].Name > objects[j].Name
+	})
+}
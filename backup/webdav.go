@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"v/settings"
+)
+
+// webdavStorage WebDAV 存储，使用 HTTP Basic 认证
+type webdavStorage struct {
+	base     *url.URL
+	dirs     []string // 备份目录及其上级目录的路径，目录不存在时按顺序创建
+	username string
+	password string
+	client   *http.Client
+}
+
+// newWebDAVStorage 创建 WebDAV 存储，Endpoint 与 Path 拼接为备份目录
+func newWebDAVStorage(target settings.BackupTarget) *webdavStorage {
+	base, err := url.Parse(target.Endpoint)
+	if err != nil {
+		base = &url.URL{Path: target.Endpoint}
+	}
+	dir := path.Join("/", base.Path)
+	dirs := []string{dir}
+	for _, part := range strings.Split(strings.Trim(target.Path, "/"), "/") {
+		if part != "" {
+			dir = path.Join(dir, part)
+			dirs = append(dirs, dir)
+		}
+	}
+	base.Path = strings.TrimRight(dir, "/") + "/"
+	base.RawPath = ""
+	return &webdavStorage{
+		base:     base,
+		dirs:     dirs,
+		username: target.Username,
+		password: target.Password.String(),
+		client:   &http.Client{},
+	}
+}
+
+// Put 上传文件，目录不存在时先创建
+func (s *webdavStorage) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if err := s.mkcol(ctx); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, name, r, size, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get 下载文件
+func (s *webdavStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, name, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// List 列出目录下的备份文件
+func (s *webdavStorage) List(ctx context.Context) ([]RemoteObject, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><getcontentlength/><getlastmodified/><resourcetype/></prop></propfind>`
+	resp, err := s.do(ctx, "PROPFIND", "", strings.NewReader(body), int64(len(body)), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err == ErrRemoteNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Responses []struct {
+			Href     string `xml:"href"`
+			Propstat []struct {
+				Prop struct {
+					ContentLength int64  `xml:"getcontentlength"`
+					LastModified  string `xml:"getlastmodified"`
+					ResourceType  struct {
+						Collection *struct{} `xml:"collection"`
+					} `xml:"resourcetype"`
+				} `xml:"prop"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse webdav response: %v", err)
+	}
+
+	var objects []RemoteObject
+	for _, r := range result.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			continue
+		}
+		name := path.Base(strings.TrimRight(href, "/"))
+		if !isBackupFile(name) {
+			continue
+		}
+		obj := RemoteObject{Name: name}
+		for _, ps := range r.Propstat {
+			if ps.Prop.ResourceType.Collection != nil {
+				obj.Name = ""
+				break
+			}
+			if ps.Prop.ContentLength > 0 {
+				obj.Size = ps.Prop.ContentLength
+			}
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				obj.ModTime = t
+			}
+		}
+		if obj.Name != "" {
+			objects = append(objects, obj)
+		}
+	}
+	sortObjects(objects)
+	return objects, nil
+}
+
+// Delete 删除文件
+func (s *webdavStorage) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, name, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// mkcol 创建备份目录，目录已存在时服务器返回 405，上级目录不存在时返回 409 并逐级创建
+func (s *webdavStorage) mkcol(ctx context.Context) error {
+	status, err := s.mkcolPath(ctx, s.base.Path)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusConflict {
+		for _, dir := range s.dirs {
+			if status, err = s.mkcolPath(ctx, dir+"/"); err != nil {
+				return err
+			}
+		}
+	}
+	if status/100 != 2 && status != http.StatusMethodNotAllowed {
+		return fmt.Errorf("webdav MKCOL failed: %d %s", status, http.StatusText(status))
+	}
+	return nil
+}
+
+// mkcolPath 创建单个目录，返回响应状态码
+func (s *webdavStorage) mkcolPath(ctx context.Context, dir string) (int, error) {
+	u := *s.base
+	u.Path = dir
+	req, err := http.NewRequestWithContext(ctx, "MKCOL", u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webdav MKCOL failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// do 发送请求，非 2xx 响应返回错误
+func (s *webdavStorage) do(ctx context.Context, method, name string, body io.Reader, size int64, headers map[string]string) (*http.Response, error) {
+	resp, err := s.request(ctx, method, name, body, size, headers)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrRemoteNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("webdav %s failed: %s", method, resp.Status)
+	}
+	return resp, nil
+}
+
+// request 发送请求，name 为空时请求备份目录本身
+func (s *webdavStorage) request(ctx context.Context, method, name string, body io.Reader, size int64, headers map[string]string) (*http.Response, error) {
+	u := *s.base
+	u.Path += name
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webdav %s failed: %v", method, err)
+	}
+	return resp, nil
+}
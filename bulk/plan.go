@@ -0,0 +1,88 @@
+package bulk
+
+import "fmt"
+
+// 计划中的变更类型
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+)
+
+// Plan 批量操作的执行计划。dry run 时只校验并返回计划，不保存任何数据；
+// 有冲突时整个操作不执行，避免只完成一部分
+type Plan struct {
+	DryRun    bool        `json:"dry_run"`
+	Applied   bool        `json:"applied"`
+	Summary   Summary     `json:"summary"`
+	Changes   []*Change   `json:"changes"`
+	Conflicts []*Conflict `json:"conflicts"`
+}
+
+// Summary 计划的统计
+type Summary struct {
+	Total     int `json:"total"` // 请求中的条目数
+	Creates   int `json:"creates"`
+	Updates   int `json:"updates"`
+	Conflicts int `json:"conflicts"`
+}
+
+// Change 一项将要执行的变更，Details 中为端口分配、生成的配置等附加信息
+type Change struct {
+	Index   int                    `json:"index"` // 对应请求中的序号，不对应单个条目时为 -1
+	Action  string                 `json:"action"`
+	Target  string                 `json:"target"`
+	Before  interface{}            `json:"before,omitempty"`
+	After   interface{}            `json:"after,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Conflict 导致操作无法执行的问题
+type Conflict struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// New 创建计划，total 为请求中的条目数
+func New(dryRun bool, total int) *Plan {
+	return &Plan{
+		DryRun:    dryRun,
+		Summary:   Summary{Total: total},
+		Changes:   []*Change{},
+		Conflicts: []*Conflict{},
+	}
+}
+
+// Add 添加变更
+func (p *Plan) Add(c *Change) {
+	p.Changes = append(p.Changes, c)
+	switch c.Action {
+	case ActionCreate:
+		p.Summary.Creates++
+	case ActionUpdate:
+		p.Summary.Updates++
+	}
+}
+
+// Conflict 添加冲突
+func (p *Plan) Conflict(index int, field, format string, args ...interface{}) {
+	p.Conflicts = append(p.Conflicts, &Conflict{
+		Index:   index,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+	p.Summary.Conflicts++
+}
+
+// HasConflicts 判断计划是否有冲突
+func (p *Plan) HasConflicts() bool {
+	return len(p.Conflicts) > 0
+}
+
+// Err 有冲突时返回汇总的错误
+func (p *Plan) Err() error {
+	if !p.HasConflicts() {
+		return nil
+	}
+	return fmt.Errorf("%d conflict(s), first: %s", len(p.Conflicts), p.Conflicts[0].Message)
+}
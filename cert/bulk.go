@@ -0,0 +1,248 @@
+package cert
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"v/logger"
+)
+
+// 批量签发任务和域名状态
+const (
+	BulkRunning  = "running"
+	BulkFinished = "finished"
+
+	BulkDomainPending = "pending"
+	BulkDomainIssuing = "issuing"
+	BulkDomainIssued  = "issued"
+	BulkDomainRenewed = "renewed"
+	BulkDomainSkipped = "skipped" // 已有有效证书
+	BulkDomainFailed  = "failed"
+)
+
+// maxBulkJobs 保留的批量签发任务数
+const maxBulkJobs = 10
+
+// ErrBulkRunning 已有批量签发任务在执行
+var ErrBulkRunning = errors.New("bulk certificate issuance already running")
+
+// BulkTarget 需要证书的域名及其来源，如 protocol:3（入站 ID）、node:hk（节点名称）
+type BulkTarget struct {
+	Domain  string   `json:"domain"`
+	Sources []string `json:"sources"`
+}
+
+// BulkDomain 批量签发中单个域名的状态
+type BulkDomain struct {
+	Domain     string     `json:"domain"`
+	Sources    []string   `json:"sources"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// BulkSummary 批量签发结果统计
+type BulkSummary struct {
+	Total   int `json:"total"`
+	Pending int `json:"pending"`
+	Issued  int `json:"issued"`
+	Renewed int `json:"renewed"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// BulkJob 批量签发任务，域名按顺序逐个申请，避免触发 ACME 频率限制
+type BulkJob struct {
+	ID         int64         `json:"id"`
+	Status     string        `json:"status"`
+	Actor      string        `json:"actor"`
+	Domains    []*BulkDomain `json:"domains"`
+	Summary    BulkSummary   `json:"summary"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+// IssueAll 在后台为缺少有效证书的域名逐个申请证书：没有证书的新建，已过期、即将过期或文件损坏的续期，
+// 有效的跳过。actor 为发起签发的管理员
+func (m *CertManager) IssueAll(targets []BulkTarget, actor string) (*BulkJob, error) {
+	m.bulkMu.Lock()
+	for _, job := range m.bulkJobs {
+		if job.Status == BulkRunning {
+			m.bulkMu.Unlock()
+			return nil, ErrBulkRunning
+		}
+	}
+
+	m.bulkNextID++
+	job := &BulkJob{
+		ID:        m.bulkNextID,
+		Status:    BulkRunning,
+		Actor:     actor,
+		Domains:   make([]*BulkDomain, 0, len(targets)),
+		StartedAt: time.Now(),
+	}
+	seen := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		domain := strings.ToLower(strings.TrimSpace(t.Domain))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		job.Domains = append(job.Domains, &BulkDomain{
+			Domain:  domain,
+			Sources: append([]string(nil), t.Sources...),
+			Status:  BulkDomainPending,
+		})
+	}
+	sort.Slice(job.Domains, func(i, j int) bool { return job.Domains[i].Domain < job.Domains[j].Domain })
+	job.Summary = summarizeBulk(job.Domains)
+
+	m.bulkJobs = append(m.bulkJobs, job)
+	if len(m.bulkJobs) > maxBulkJobs {
+		m.bulkJobs = m.bulkJobs[len(m.bulkJobs)-maxBulkJobs:]
+	}
+	copied := copyBulkJob(job)
+	m.bulkMu.Unlock()
+
+	m.log.WithFields("Bulk certificate issuance started", logger.Fields{
+		"job_id":  job.ID,
+		"domains": len(job.Domains),
+		"actor":   actor,
+	})
+	go m.runBulk(job)
+	return copied, nil
+}
+
+// BulkJob 查询批量签发任务
+func (m *CertManager) BulkJob(id int64) (*BulkJob, bool) {
+	m.bulkMu.Lock()
+	defer m.bulkMu.Unlock()
+
+	for _, job := range m.bulkJobs {
+		if job.ID == id {
+			return copyBulkJob(job), true
+		}
+	}
+	return nil, false
+}
+
+// BulkJobs 返回最近的批量签发任务，新的在前
+func (m *CertManager) BulkJobs() []*BulkJob {
+	m.bulkMu.Lock()
+	defer m.bulkMu.Unlock()
+
+	jobs := make([]*BulkJob, 0, len(m.bulkJobs))
+	for i := len(m.bulkJobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, copyBulkJob(m.bulkJobs[i]))
+	}
+	return jobs
+}
+
+// runBulk 逐个处理域名，单个域名失败不影响其他域名
+func (m *CertManager) runBulk(job *BulkJob) {
+	// 先从数据库同步已有证书，避免为已登记的域名重复创建记录
+	if err := m.loadCertificates(); err != nil {
+		m.log.WarnWithFields("Failed to load certificates before bulk issuance", logger.Fields{
+			"job_id": job.ID,
+			"error":  err.Error(),
+		})
+	}
+	for _, d := range job.Domains {
+		m.setBulkStatus(job, d, BulkDomainIssuing, nil)
+		status, err := m.issueDomain(d.Domain)
+		if err != nil {
+			m.log.ErrorWithFields("Failed to issue certificate", logger.Fields{
+				"job_id": job.ID,
+				"domain": d.Domain,
+				"error":  err.Error(),
+			})
+			status = BulkDomainFailed
+		}
+		m.setBulkStatus(job, d, status, err)
+	}
+
+	m.bulkMu.Lock()
+	now := time.Now()
+	job.Status = BulkFinished
+	job.FinishedAt = &now
+	summary := job.Summary
+	m.bulkMu.Unlock()
+
+	m.log.WithFields("Bulk certificate issuance finished", logger.Fields{
+		"job_id":  job.ID,
+		"issued":  summary.Issued,
+		"renewed": summary.Renewed,
+		"skipped": summary.Skipped,
+		"failed":  summary.Failed,
+	})
+}
+
+// issueDomain 为单个域名新建或续期证书，返回处理结果
+func (m *CertManager) issueDomain(domain string) (string, error) {
+	m.mu.RLock()
+	existing, ok := m.certs[domain]
+	m.mu.RUnlock()
+
+	if !ok {
+		if _, err := m.CreateCertificate(domain); err != nil {
+			return BulkDomainFailed, err
+		}
+		return BulkDomainIssued, nil
+	}
+	if status, err := m.checkCertificate(domain, existing); err == nil && status == CertificateStatusValid {
+		return BulkDomainSkipped, nil
+	}
+	if err := m.RenewCertificate(domain); err != nil {
+		return BulkDomainFailed, err
+	}
+	return BulkDomainRenewed, nil
+}
+
+// setBulkStatus 更新域名状态和任务统计
+func (m *CertManager) setBulkStatus(job *BulkJob, d *BulkDomain, status string, err error) {
+	m.bulkMu.Lock()
+	defer m.bulkMu.Unlock()
+
+	d.Status = status
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if status != BulkDomainIssuing {
+		now := time.Now()
+		d.FinishedAt = &now
+	}
+	job.Summary = summarizeBulk(job.Domains)
+}
+
+// summarizeBulk 统计各状态的域名数，签发中的计入待处理
+func summarizeBulk(domains []*BulkDomain) BulkSummary {
+	summary := BulkSummary{Total: len(domains)}
+	for _, d := range domains {
+		switch d.Status {
+		case BulkDomainIssued:
+			summary.Issued++
+		case BulkDomainRenewed:
+			summary.Renewed++
+		case BulkDomainSkipped:
+			summary.Skipped++
+		case BulkDomainFailed:
+			summary.Failed++
+		default:
+			summary.Pending++
+		}
+	}
+	return summary
+}
+
+// copyBulkJob 复制任务，避免返回后被后台签发修改
+func copyBulkJob(job *BulkJob) *BulkJob {
+	c := *job
+	c.Domains = make([]*BulkDomain, len(job.Domains))
+	for i, d := range job.Domains {
+		dc := *d
+		c.Domains[i] = &dc
+	}
+	return &c
+}
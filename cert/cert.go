@@ -18,6 +18,7 @@ import (
 	"v/logger"
 	"v/model"
 	"v/settings"
+	"v/utils"
 )
 
 // SelfSignedCertManager 自签名证书管理器
@@ -126,6 +127,11 @@ func (m *SelfSignedCertManager) CreateSelfSignedCertificate(domain string) (*mod
 		return nil, err
 	}
 
+	// 已存在的文件截断写入时不会修改权限
+	if err := utils.SecureKeyFile(keyFile); err != nil {
+		return nil, err
+	}
+
 	// 创建证书记录
 	certificate := &model.Certificate{
 		Domain:        domain,
@@ -14,6 +14,7 @@ import (
 	"v/model"
 	"v/notification"
 	"v/settings"
+	"v/utils"
 
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
@@ -49,6 +50,11 @@ type CertManager struct {
 	mu       sync.RWMutex
 	stopCh   chan struct{}
 	webRoot  string
+
+	// 批量签发任务
+	bulkMu     sync.Mutex
+	bulkNextID int64
+	bulkJobs   []*BulkJob
 }
 
 // NewCertManager 创建SSL证书管理器
@@ -71,6 +77,9 @@ func (m *CertManager) Start() error {
 		return fmt.Errorf("failed to load certificates: %v", err)
 	}
 
+	// 检查并修正私钥文件权限
+	m.verifyKeyPermissions()
+
 	// 启动证书检查循环
 	go m.checkLoop()
 
@@ -102,6 +111,40 @@ func (m *CertManager) loadCertificates() error {
 	return nil
 }
 
+// verifyKeyPermissions 检查所有证书私钥的权限和所有者，不符合要求时尝试修正
+func (m *CertManager) verifyKeyPermissions() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for domain, cert := range m.certs {
+		if cert.KeyFile == "" {
+			continue
+		}
+
+		status := utils.CheckKeyFile(cert.KeyFile)
+		if status.Error != "" || status.Secure() {
+			continue
+		}
+
+		if err := utils.SecureKeyFile(cert.KeyFile); err != nil {
+			m.log.ErrorWithFields("Certificate private key has insecure permissions", logger.Fields{
+				"domain":   domain,
+				"key_file": cert.KeyFile,
+				"mode":     status.Mode,
+				"uid":      status.UID,
+				"error":    err,
+			})
+			continue
+		}
+
+		m.log.WarnWithFields("Fixed certificate private key permissions", logger.Fields{
+			"domain":   domain,
+			"key_file": cert.KeyFile,
+			"old_mode": status.Mode,
+		})
+	}
+}
+
 // checkLoop 证书检查循环
 func (m *CertManager) checkLoop() {
 	s := m.settings.Get()
@@ -367,8 +410,7 @@ func (m *CertManager) renewCertificate(domain string, cert *model.Certificate) e
 		return err
 	}
 
-	err = ioutil.WriteFile(cert.KeyFile, certificates.PrivateKey, 0600)
-	if err != nil {
+	if err := utils.WriteKeyFile(cert.KeyFile, certificates.PrivateKey); err != nil {
 		return err
 	}
 
@@ -0,0 +1,424 @@
+// Package connlimit 入站并发连接数限制：限制连接数的 Xray 入站改为监听本机内部端口，
+// 由面板在原端口接收连接、计数并转发，超过上限的连接直接关闭，防止单个失控客户端拖垮小内存服务器。
+// 只限制 TCP 连接，UDP 和 QUIC 类传输不经过面板
+package connlimit
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/proxy"
+	"v/settings"
+)
+
+// 入口状态
+const (
+	StatusWaiting = "waiting" // 等待 Xray 释放原端口
+	StatusActive  = "active"
+)
+
+const (
+	// syncInterval 按设置同步需要限制的入站的间隔
+	syncInterval = 30 * time.Second
+	// bindRetryInterval 原端口仍被占用时的重试间隔
+	bindRetryInterval = 500 * time.Millisecond
+	dialTimeout       = 5 * time.Second
+)
+
+// ProtocolSource 读取入站的监听地址和端口
+type ProtocolSource interface {
+	GetProtocol(id int64) (*model.Protocol, error)
+}
+
+// Alerter 连接数达到上限时发送告警
+type Alerter interface {
+	ReportConnLimit(protocolID int64, name string, limit int)
+}
+
+// Gauge 入站的连接数指标
+type Gauge struct {
+	ProtocolID   int64      `json:"protocol_id"`
+	Name         string     `json:"name"`
+	Listen       string     `json:"listen"`
+	InternalPort int        `json:"internal_port"`
+	Status       string     `json:"status"`
+	Limit        int        `json:"limit"`
+	Current      int        `json:"current"`
+	Peak         int        `json:"peak"`     // 开始限制以来的最大并发连接数
+	Rejected     int64      `json:"rejected"` // 因超过上限被关闭的连接数
+	LastRejectAt *time.Time `json:"last_reject_at,omitempty"`
+	Error        string     `json:"error,omitempty"` // 最近一次绑定原端口失败的原因
+}
+
+// gate 一个限制连接数的入站入口
+type gate struct {
+	info     Gauge
+	listener net.Listener
+	stopCh   chan struct{}
+}
+
+// Limiter 管理各入站的连接数限制
+type Limiter struct {
+	log       *logger.Logger
+	settings  *settings.Manager
+	protocols ProtocolSource
+	alerter   Alerter
+
+	mu       sync.Mutex
+	gates    map[int64]*gate
+	onChange func(protocolID int64)
+	clients  map[string]string
+	extra    func() map[int64]int
+	stopCh   chan struct{}
+}
+
+// New 创建连接数限制器
+func New(log *logger.Logger, settingsMgr *settings.Manager, protocols ProtocolSource) *Limiter {
+	return &Limiter{
+		log:       log,
+		settings:  settingsMgr,
+		protocols: protocols,
+		gates:     make(map[int64]*gate),
+		clients:   make(map[string]string),
+	}
+}
+
+// SetAlerter 设置达到上限时的告警
+func (l *Limiter) SetAlerter(alerter Alerter) {
+	l.alerter = alerter
+}
+
+// SetOnChange 设置开始或停止限制某个入站时的回调，用于重新生成 Xray 配置
+func (l *Limiter) SetOnChange(fn func(protocolID int64)) {
+	l.onChange = fn
+}
+
+// ClientAddr 返回转发到 Xray 的本机地址对应的真实客户端地址。
+// 受限入站的连接由本机转发，Xray 访问日志中的来源是转发连接的本机地址
+func (l *Limiter) ClientAddr(local string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	addr, ok := l.clients[local]
+	return addr, ok
+}
+
+// SetExtraLimits 设置设置之外的临时上限来源，如流量预算将耗尽时的限流，
+// 与设置中的上限同时存在时取较小者
+func (l *Limiter) SetExtraLimits(fn func() map[int64]int) {
+	l.extra = fn
+}
+
+// Start 启动定期同步，设置每轮重新读取，修改后无需重启
+func (l *Limiter) Start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopCh != nil {
+		return
+	}
+	l.stopCh = make(chan struct{})
+	go l.run(l.stopCh)
+}
+
+// Stop 停止同步并关闭所有入口，入站恢复监听原端口
+func (l *Limiter) Stop() {
+	l.mu.Lock()
+	if l.stopCh != nil {
+		close(l.stopCh)
+		l.stopCh = nil
+	}
+	ids := make([]int64, 0, len(l.gates))
+	for id := range l.gates {
+		ids = append(ids, id)
+	}
+	l.mu.Unlock()
+
+	for _, id := range ids {
+		l.close(id)
+	}
+}
+
+// Redirect 返回限制连接数的入站应临时监听的本机端口，生成 Xray 配置时使用
+func (l *Limiter) Redirect(protocolID int64) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	g, ok := l.gates[protocolID]
+	if !ok {
+		return 0, false
+	}
+	return g.info.InternalPort, true
+}
+
+// Gauges 返回所有限制连接数的入站的指标，按协议 ID 排序
+func (l *Limiter) Gauges() []*Gauge {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	gauges := make([]*Gauge, 0, len(l.gates))
+	for _, g := range l.gates {
+		info := g.info
+		gauges = append(gauges, &info)
+	}
+	sort.Slice(gauges, func(i, j int) bool { return gauges[i].ProtocolID < gauges[j].ProtocolID })
+	return gauges
+}
+
+// Gauge 返回入站的连接数指标，未限制时返回 false
+func (l *Limiter) Gauge(protocolID int64) (*Gauge, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	g, ok := l.gates[protocolID]
+	if !ok {
+		return nil, false
+	}
+	info := g.info
+	return &info, true
+}
+
+// run 同步循环
+func (l *Limiter) run(stopCh chan struct{}) {
+	for {
+		l.Sync()
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(syncInterval):
+		}
+	}
+}
+
+// Sync 按设置和临时上限开始或停止限制入站，上限修改后立即生效
+func (l *Limiter) Sync() {
+	limits := l.settings.Get().Xray.InboundMaxConnections
+	wanted := make(map[int64]int, len(limits))
+	for key, limit := range limits {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || limit <= 0 {
+			continue
+		}
+		wanted[id] = limit
+	}
+	if l.extra != nil {
+		for id, limit := range l.extra() {
+			if current, ok := wanted[id]; limit > 0 && (!ok || limit < current) {
+				wanted[id] = limit
+			}
+		}
+	}
+
+	l.mu.Lock()
+	var remove []int64
+	for id, g := range l.gates {
+		if limit, ok := wanted[id]; ok {
+			g.info.Limit = limit
+			delete(wanted, id)
+			continue
+		}
+		remove = append(remove, id)
+	}
+	l.mu.Unlock()
+
+	for _, id := range remove {
+		l.close(id)
+	}
+	for id, limit := range wanted {
+		if err := l.open(id, limit); err != nil {
+			l.log.WarnWithFields("Failed to limit inbound connections", logger.Fields{
+				"protocol_id": id,
+				"limit":       limit,
+				"error":       err.Error(),
+			})
+		}
+	}
+}
+
+// open 开始限制入站：分配内部端口并在原端口等待 Xray 按新配置释放
+func (l *Limiter) open(protocolID int64, limit int) error {
+	p, err := l.protocols.GetProtocol(protocolID)
+	if err != nil {
+		return err
+	}
+	if p.Type == "relay" {
+		return fmt.Errorf("relay inbounds are not supported")
+	}
+	host := strings.Trim(strings.TrimSpace(p.Listen), "[]")
+	if strings.HasPrefix(host, "/") || strings.HasPrefix(host, "@") {
+		return fmt.Errorf("unix socket inbounds are not supported")
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	port, err := freeLoopbackPort()
+	if err != nil {
+		return err
+	}
+
+	g := &gate{
+		info: Gauge{
+			ProtocolID:   protocolID,
+			Name:         p.Name,
+			Listen:       net.JoinHostPort(host, strconv.Itoa(p.Port)),
+			InternalPort: port,
+			Status:       StatusWaiting,
+			Limit:        limit,
+		},
+		stopCh: make(chan struct{}),
+	}
+	l.mu.Lock()
+	if _, ok := l.gates[protocolID]; ok {
+		l.mu.Unlock()
+		return nil
+	}
+	l.gates[protocolID] = g
+	l.mu.Unlock()
+
+	go l.bind(g)
+	l.log.WithFields("Inbound connection limit enabled", logger.Fields{
+		"protocol_id":   protocolID,
+		"listen":        g.info.Listen,
+		"internal_port": port,
+		"limit":         limit,
+	})
+	l.changed(protocolID)
+	return nil
+}
+
+// close 停止限制入站，入站恢复监听原端口
+func (l *Limiter) close(protocolID int64) {
+	l.mu.Lock()
+	g, ok := l.gates[protocolID]
+	if !ok {
+		l.mu.Unlock()
+		return
+	}
+	delete(l.gates, protocolID)
+	close(g.stopCh)
+	if g.listener != nil {
+		g.listener.Close()
+	}
+	l.mu.Unlock()
+
+	l.log.WithFields("Inbound connection limit disabled", logger.Fields{
+		"protocol_id": protocolID,
+	})
+	l.changed(protocolID)
+}
+
+// changed 调用变更回调
+func (l *Limiter) changed(protocolID int64) {
+	if l.onChange != nil {
+		l.onChange(protocolID)
+	}
+}
+
+// bind 重试绑定原端口直到 Xray 按新配置释放该端口或停止限制
+func (l *Limiter) bind(g *gate) {
+	for {
+		ln, err := net.Listen("tcp", g.info.Listen)
+		l.mu.Lock()
+		select {
+		case <-g.stopCh:
+			l.mu.Unlock()
+			if err == nil {
+				ln.Close()
+			}
+			return
+		default:
+		}
+		if err == nil {
+			g.listener = ln
+			g.info.Status = StatusActive
+			g.info.Error = ""
+			l.mu.Unlock()
+			l.accept(g, ln)
+			return
+		}
+		g.info.Error = err.Error()
+		l.mu.Unlock()
+
+		select {
+		case <-g.stopCh:
+			return
+		case <-time.After(bindRetryInterval):
+		}
+	}
+}
+
+// accept 接收连接直到监听关闭，超过上限的连接直接关闭
+func (l *Limiter) accept(g *gate, ln net.Listener) {
+	target := net.JoinHostPort("127.0.0.1", strconv.Itoa(g.info.InternalPort))
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		l.mu.Lock()
+		if g.info.Current >= g.info.Limit {
+			now := time.Now()
+			g.info.Rejected++
+			g.info.LastRejectAt = &now
+			name, limit := g.info.Name, g.info.Limit
+			l.mu.Unlock()
+
+			conn.Close()
+			if l.alerter != nil {
+				l.alerter.ReportConnLimit(g.info.ProtocolID, name, limit)
+			}
+			continue
+		}
+		g.info.Current++
+		if g.info.Current > g.info.Peak {
+			g.info.Peak = g.info.Current
+		}
+		l.mu.Unlock()
+
+		go l.forward(g, conn, target)
+	}
+}
+
+// forward 转发连接到 Xray 入站，结束时释放计数
+func (l *Limiter) forward(g *gate, conn net.Conn, target string) {
+	defer func() {
+		l.mu.Lock()
+		g.info.Current--
+		l.mu.Unlock()
+	}()
+
+	upstream, err := net.DialTimeout("tcp", target, dialTimeout)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	local := upstream.LocalAddr().String()
+	l.mu.Lock()
+	l.clients[local] = conn.RemoteAddr().String()
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.clients, local)
+		l.mu.Unlock()
+	}()
+
+	var counter proxy.TrafficCounter
+	proxy.Relay(conn, upstream, &counter)
+}
+
+// freeLoopbackPort 选择一个本机空闲端口
+func freeLoopbackPort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,231 @@
+package crash
+
+import (
+	"bytes"
+	cryptoRand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+	"v/version"
+)
+
+// 默认值
+const (
+	defaultDir        = "logs/crashes"
+	defaultMaxReports = 20
+	defaultLogLines   = 100
+	uploadTimeout     = 5 * time.Second
+)
+
+// Report 崩溃报告
+type Report struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"` // 发生崩溃的位置，如 http 请求路径或后台任务名
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	Version   string    `json:"version"`
+	GoVersion string    `json:"go_version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	Logs      []string  `json:"logs"`     // 崩溃前的最近日志
+	Uploaded  bool      `json:"uploaded"` // 是否已上报到远程地址
+}
+
+// Reporter 收集崩溃报告，保存到本地目录并可选地上报到远程地址
+type Reporter struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	client   *http.Client
+	mu       sync.Mutex
+}
+
+// New 创建崩溃报告收集器
+func New(log *logger.Logger, settingsMgr *settings.Manager) *Reporter {
+	return &Reporter{
+		log:      log,
+		settings: settingsMgr,
+		client:   &http.Client{Timeout: uploadTimeout},
+	}
+}
+
+// Recover 在 defer 中调用，记录崩溃报告后继续 panic，进程仍按原样退出：
+//
+//	defer reporter.Recover("main")
+func (r *Reporter) Recover(source string) {
+	if value := recover(); value != nil {
+		r.Capture(source, value, debug.Stack())
+		panic(value)
+	}
+}
+
+// Go 在新的 goroutine 中运行 fn，发生 panic 时记录崩溃报告后继续 panic
+func (r *Reporter) Go(source string, fn func()) {
+	go func() {
+		defer r.Recover(source)
+		fn()
+	}()
+}
+
+// Capture 根据 panic 值和调用栈生成崩溃报告并保存，配置了上报地址时同步上报
+func (r *Reporter) Capture(source string, value interface{}, stack []byte) *Report {
+	cfg := r.config()
+
+	now := time.Now()
+	report := &Report{
+		ID:        newID(now),
+		Time:      now,
+		Source:    source,
+		Panic:     fmt.Sprint(value),
+		Stack:     string(stack),
+		Version:   version.Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Logs:      r.log.Recent(cfg.LogLines),
+	}
+
+	r.log.ErrorWithFields("Panic captured", logger.Fields{
+		"id":     report.ID,
+		"source": source,
+		"panic":  report.Panic,
+	})
+
+	if cfg.UploadURL != "" {
+		if err := r.upload(cfg.UploadURL, report); err != nil {
+			r.log.WarnWithFields("Failed to upload crash report", logger.Fields{
+				"id":    report.ID,
+				"error": err.Error(),
+			})
+		} else {
+			report.Uploaded = true
+		}
+	}
+
+	if err := r.save(cfg, report); err != nil {
+		r.log.ErrorWithFields("Failed to save crash report", logger.Fields{
+			"id":    report.ID,
+			"error": err.Error(),
+		})
+	}
+	return report
+}
+
+// List 返回最近的崩溃报告，按时间倒序排列，limit 不大于 0 时返回全部
+func (r *Reporter) List(limit int) ([]*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := reportFiles(r.config().Dir)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+	}
+
+	reports := make([]*Report, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			continue
+		}
+		reports = append(reports, &report)
+	}
+	return reports, nil
+}
+
+// save 写入崩溃报告并清理超出保留数量的旧报告
+func (r *Reporter) save(cfg settings.CrashSettings, report *Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create crash directory: %v", err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal crash report: %v", err)
+	}
+	path := filepath.Join(cfg.Dir, "crash-"+report.ID+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write crash report: %v", err)
+	}
+
+	files, err := reportFiles(cfg.Dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files[min(len(files), cfg.MaxReports):] {
+		os.Remove(file)
+	}
+	return nil
+}
+
+// upload 将崩溃报告以 JSON 上报到远程地址
+func (r *Reporter) upload(url string, report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal crash report: %v", err)
+	}
+	resp, err := r.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// config 返回补齐默认值的崩溃报告设置
+func (r *Reporter) config() settings.CrashSettings {
+	var cfg settings.CrashSettings
+	if r.settings != nil {
+		cfg = r.settings.Get().Crash
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = defaultDir
+	}
+	if cfg.MaxReports <= 0 {
+		cfg.MaxReports = defaultMaxReports
+	}
+	if cfg.LogLines <= 0 {
+		cfg.LogLines = defaultLogLines
+	}
+	return cfg
+}
+
+// reportFiles 列出目录中的崩溃报告文件，按时间倒序排列
+func reportFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list crash reports: %v", err)
+	}
+	// 文件名以时间开头，按名称倒序即按时间倒序
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files, nil
+}
+
+// newID 生成以时间开头的报告 ID，如 20060102-150405.000-1a2b3c4d
+func newID(t time.Time) string {
+	buf := make([]byte, 4)
+	cryptoRand.Read(buf)
+	return t.Format("20060102-150405.000") + "-" + hex.EncodeToString(buf)
+}
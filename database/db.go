@@ -475,7 +475,7 @@ func (db *Database) CreateProxy(proxy *common.Proxy) error {
 }
 
 // GetProxy returns a proxy by ID
-func (db *Database) GetProxy(id uint) (*common.Proxy, error) {
+func (db *Database) GetProxy(id int64) (*common.Proxy, error) {
 	var proxy common.Proxy
 	if err := db.First(&proxy, id).Error; err != nil {
 		return nil, err
@@ -484,7 +484,7 @@ func (db *Database) GetProxy(id uint) (*common.Proxy, error) {
 }
 
 // GetProxiesByUser returns proxies by user ID
-func (db *Database) GetProxiesByUser(userID uint) ([]*common.Proxy, error) {
+func (db *Database) GetProxiesByUser(userID int64) ([]*common.Proxy, error) {
 	var proxies []*common.Proxy
 	if err := db.Where("user_id = ?", userID).Find(&proxies).Error; err != nil {
 		return nil, err
@@ -498,7 +498,7 @@ func (db *Database) UpdateProxy(proxy *common.Proxy) error {
 }
 
 // DeleteProxy deletes a proxy
-func (db *Database) DeleteProxy(id uint) error {
+func (db *Database) DeleteProxy(id int64) error {
 	return db.Delete(&common.Proxy{}, id).Error
 }
 
@@ -512,7 +512,7 @@ func (db *Database) ListProxies(offset, limit int) ([]*common.Proxy, error) {
 }
 
 // UpdateTraffic updates traffic statistics for a proxy
-func (db *Database) UpdateTraffic(id uint, upload, download int64) error {
+func (db *Database) UpdateTraffic(id int64, upload, download int64) error {
 	return db.Model(&common.Proxy{}).Where("id = ?", id).Updates(map[string]interface{}{
 		"upload":   upload,
 		"download": download,
@@ -520,17 +520,17 @@ func (db *Database) UpdateTraffic(id uint, upload, download int64) error {
 }
 
 // Enable enables a proxy
-func (db *Database) Enable(id uint) error {
+func (db *Database) Enable(id int64) error {
 	return db.Model(&common.Proxy{}).Where("id = ?", id).Update("enabled", true).Error
 }
 
 // Disable disables a proxy
-func (db *Database) Disable(id uint) error {
+func (db *Database) Disable(id int64) error {
 	return db.Model(&common.Proxy{}).Where("id = ?", id).Update("enabled", false).Error
 }
 
 // UpdateLastActive updates the last active time for a proxy
-func (db *Database) UpdateLastActive(id uint) error {
+func (db *Database) UpdateLastActive(id int64) error {
 	return db.Model(&common.Proxy{}).Where("id = ?", id).Update("last_active_at", time.Now()).Error
 }
 
@@ -742,8 +742,257 @@ var Migrations = []Migration{
 			DROP TABLE IF EXISTS user_sessions;
 		`,
 	},
+	{
+		Version: 4,
+		Up: `
+			CREATE TABLE IF NOT EXISTS protocol_versions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				protocol_id INTEGER NOT NULL,
+				version INTEGER NOT NULL,
+				snapshot TEXT NOT NULL,
+				diff TEXT,
+				changed_by VARCHAR(255),
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (protocol_id, version)
+			);
+			CREATE INDEX IF NOT EXISTS idx_protocol_versions_protocol_id ON protocol_versions(protocol_id);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS protocol_versions;
+		`,
+	},
+	{
+		Version: 5,
+		Up: `
+			ALTER TABLE protocols ADD COLUMN listen VARCHAR(255) DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE protocols DROP COLUMN listen;
+		`,
+	},
+	{
+		Version: 6,
+		Up: `
+			CREATE TABLE IF NOT EXISTS protocol_stats_archive (
+				id INTEGER PRIMARY KEY,
+				protocol_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				upload INTEGER NOT NULL DEFAULT 0,
+				download INTEGER NOT NULL DEFAULT 0,
+				last_active TIMESTAMP,
+				archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_protocol_stats_archive_protocol_id ON protocol_stats_archive(protocol_id);
+			CREATE TABLE IF NOT EXISTS traffic_stats_archive (
+				id INTEGER PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				proxy_id INTEGER NOT NULL,
+				upload INTEGER NOT NULL DEFAULT 0,
+				download INTEGER NOT NULL DEFAULT 0,
+				total INTEGER NOT NULL DEFAULT 0,
+				archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_traffic_stats_archive_proxy_id ON traffic_stats_archive(proxy_id);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS traffic_stats_archive;
+			DROP TABLE IF EXISTS protocol_stats_archive;
+		`,
+	},
+	{
+		Version: 7,
+		Up: `
+			ALTER TABLE protocols ADD COLUMN remark TEXT DEFAULT '';
+			ALTER TABLE protocols ADD COLUMN tags TEXT DEFAULT '';
+			ALTER TABLE users ADD COLUMN remark TEXT DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE users DROP COLUMN remark;
+			ALTER TABLE protocols DROP COLUMN tags;
+			ALTER TABLE protocols DROP COLUMN remark;
+		`,
+	},
+	{
+		Version: 8,
+		Up: `
+			CREATE INDEX IF NOT EXISTS idx_traffic_created_at ON traffic(created_at, user_id, proxy_id, up, down);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_traffic_created_at;
+		`,
+	},
+	{
+		Version: 9,
+		Up: `
+			ALTER TABLE users ADD COLUMN activity_opt_out INTEGER DEFAULT 0;
+		`,
+		Down: `
+			ALTER TABLE users DROP COLUMN activity_opt_out;
+		`,
+	},
+	{
+		Version: 10,
+		Up: `
+			ALTER TABLE traffic ADD COLUMN kind TEXT DEFAULT '';
+			ALTER TABLE traffic ADD COLUMN note TEXT DEFAULT '';
+			ALTER TABLE traffic ADD COLUMN operator TEXT DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE traffic DROP COLUMN operator;
+			ALTER TABLE traffic DROP COLUMN note;
+			ALTER TABLE traffic DROP COLUMN kind;
+		`,
+	},
+	{
+		Version: 11,
+		Up: `
+			CREATE TABLE IF NOT EXISTS subscriptions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL UNIQUE,
+				token TEXT NOT NULL UNIQUE,
+				webhook_url TEXT DEFAULT '',
+				webhook_secret TEXT DEFAULT '',
+				profile_version INTEGER DEFAULT 1,
+				last_fetched_at DATETIME,
+				last_notified_at DATETIME,
+				last_notify_error TEXT DEFAULT '',
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS subscriptions;
+		`,
+	},
+	{
+		Version: 12,
+		Up: `
+			ALTER TABLE users ADD COLUMN uuid TEXT;
+			ALTER TABLE protocols ADD COLUMN uuid TEXT;
+			UPDATE users SET uuid = ` + sqlRandomUUID + ` WHERE uuid IS NULL OR uuid = '';
+			UPDATE protocols SET uuid = ` + sqlRandomUUID + ` WHERE uuid IS NULL OR uuid = '';
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_uuid ON users(uuid);
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_protocols_uuid ON protocols(uuid);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_protocols_uuid;
+			DROP INDEX IF EXISTS idx_users_uuid;
+			ALTER TABLE protocols DROP COLUMN uuid;
+			ALTER TABLE users DROP COLUMN uuid;
+		`,
+	},
+	{
+		Version: 13,
+		Up: `
+			CREATE TABLE IF NOT EXISTS protocol_schedules (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				protocol_id INTEGER NOT NULL UNIQUE,
+				enabled INTEGER NOT NULL DEFAULT 1,
+				rules TEXT NOT NULL DEFAULT '{}',
+				last_applied DATETIME,
+				last_state INTEGER,
+				last_error TEXT DEFAULT '',
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS protocol_schedules;
+		`,
+	},
+	{
+		Version: 14,
+		Up: `
+			CREATE TABLE IF NOT EXISTS stream_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				type TEXT NOT NULL,
+				data TEXT NOT NULL DEFAULT 'null',
+				created_at DATETIME NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS stream_events;
+		`,
+	},
+	{
+		Version: 15,
+		Up: `
+			ALTER TABLE users ADD COLUMN email_hash TEXT DEFAULT '';
+			CREATE INDEX IF NOT EXISTS idx_users_email_hash ON users(email_hash);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_users_email_hash;
+			ALTER TABLE users DROP COLUMN email_hash;
+		`,
+	},
+	{
+		Version: 16,
+		Up: `
+			CREATE TABLE IF NOT EXISTS leader_leases (
+				name TEXT PRIMARY KEY,
+				holder TEXT NOT NULL,
+				address TEXT NOT NULL DEFAULT '',
+				expires_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS leader_leases;
+		`,
+	},
+	{
+		Version: 17,
+		Up: `
+			CREATE TABLE IF NOT EXISTS notifications (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				category TEXT NOT NULL,
+				level TEXT NOT NULL DEFAULT 'info',
+				title TEXT NOT NULL,
+				body TEXT NOT NULL DEFAULT '',
+				source TEXT NOT NULL DEFAULT '',
+				dedup_key TEXT NOT NULL DEFAULT '',
+				is_read INTEGER NOT NULL DEFAULT 0,
+				read_at DATETIME,
+				created_at DATETIME NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(is_read, created_at);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_notifications_unread;
+			DROP TABLE IF EXISTS notifications;
+		`,
+	},
+	{
+		Version: 18,
+		Up: `
+			ALTER TABLE users ADD COLUMN email_verified INTEGER DEFAULT 0;
+			ALTER TABLE users ADD COLUMN pending_email TEXT DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE users DROP COLUMN pending_email;
+			ALTER TABLE users DROP COLUMN email_verified;
+		`,
+	},
+	{
+		Version: 19,
+		Up: `
+			ALTER TABLE users ADD COLUMN sso_issuer TEXT DEFAULT '';
+			ALTER TABLE users ADD COLUMN sso_subject TEXT DEFAULT '';
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_sso_identity ON users(sso_issuer, sso_subject) WHERE sso_subject != '';
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_users_sso_identity;
+			ALTER TABLE users DROP COLUMN sso_subject;
+			ALTER TABLE users DROP COLUMN sso_issuer;
+		`,
+	},
 }
 
+// sqlRandomUUID 在 SQLite 中生成随机 UUID（版本 4），用于为已有记录补齐公开标识
+const sqlRandomUUID = `lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+			substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))`
+
 // GetCurrentVersion returns the current database version
 func (db *Database) GetCurrentVersion() (int, error) {
 	var version int
@@ -764,6 +1013,13 @@ func (db *Database) MigrateUp() error {
 		return err
 	}
 
+	// 有待执行的迁移时先备份，失败时可通过 RollbackMigration 恢复；新数据库没有需要保留的数据
+	if target := latestMigrationVersion(); currentVersion > 0 && target > currentVersion {
+		if _, err := db.BackupBeforeMigration(currentVersion, target); err != nil {
+			return fmt.Errorf("failed to back up database before migration: %v", err)
+		}
+	}
+
 	// Get SQL DB
 	sqlDB, err := db.DB.DB()
 	if err != nil {
@@ -1218,16 +1474,31 @@ func (m *MockDB) CreateUser(user *model.User) error {
 	return nil
 }
 
+// CreateUsers 批量创建用户
+func (m *MockDB) CreateUsers(users []*model.User) error {
+	return nil
+}
+
 // GetUser 获取用户
 func (m *MockDB) GetUser(id int64) (*model.User, error) {
 	return &model.User{}, nil
 }
 
+// GetUserByUUID 通过公开的 UUID 获取用户
+func (m *MockDB) GetUserByUUID(uuid string) (*model.User, error) {
+	return &model.User{}, nil
+}
+
 // GetUserByUsername 通过用户名获取用户
 func (m *MockDB) GetUserByUsername(username string) (*model.User, error) {
 	return &model.User{}, nil
 }
 
+// GetUserByIdentity 通过单点登录身份获取用户
+func (m *MockDB) GetUserByIdentity(issuer, subject string) (*model.User, error) {
+	return nil, nil
+}
+
 // GetUserByEmail 通过邮箱获取用户
 func (m *MockDB) GetUserByEmail(email string) (*model.User, error) {
 	return &model.User{}, nil
@@ -1334,7 +1605,7 @@ func (m *MockDB) ListTrafficByProxyID(proxyID int64) ([]*common.TrafficStats, er
 }
 
 // GetTrafficStats 获取流量统计
-func (m *MockDB) GetTrafficStats(userID uint) (*model.TrafficStats, error) {
+func (m *MockDB) GetTrafficStats(userID int64) (*model.TrafficStats, error) {
 	return &model.TrafficStats{}, nil
 }
 
@@ -1343,11 +1614,56 @@ func (m *MockDB) CreateTrafficRecord(traffic *model.Traffic) error {
 	return nil
 }
 
+// AdjustUserTraffic 人工调整用户流量
+func (m *MockDB) AdjustUserTraffic(adjustment *model.Traffic) error {
+	return nil
+}
+
+// ListTrafficAdjustments 获取用户的流量调整记录
+func (m *MockDB) ListTrafficAdjustments(userID int64) ([]*model.Traffic, error) {
+	return []*model.Traffic{}, nil
+}
+
+// GetSubscription 获取用户订阅
+func (m *MockDB) GetSubscription(userID int64) (*model.Subscription, error) {
+	return nil, nil
+}
+
+// GetSubscriptionByToken 根据令牌获取订阅
+func (m *MockDB) GetSubscriptionByToken(token string) (*model.Subscription, error) {
+	return nil, nil
+}
+
+// ListSubscriptions 获取所有订阅
+func (m *MockDB) ListSubscriptions() ([]*model.Subscription, error) {
+	return []*model.Subscription{}, nil
+}
+
+// UpdateSubscriptionNotifyStatus 更新订阅的 webhook 推送结果
+func (m *MockDB) UpdateSubscriptionNotifyStatus(userID int64, notifiedAt *time.Time, notifyError string) error {
+	return nil
+}
+
+// SaveSubscription 保存订阅
+func (m *MockDB) SaveSubscription(sub *model.Subscription) error {
+	return nil
+}
+
 // CleanupTraffic 清理流量记录
 func (m *MockDB) CleanupTraffic(before time.Time) error {
 	return nil
 }
 
+// GetTopUsersByTraffic 获取流量排行前列的用户
+func (m *MockDB) GetTopUsersByTraffic(start, end time.Time, limit int) ([]*model.TopTalker, error) {
+	return []*model.TopTalker{}, nil
+}
+
+// GetTopProtocolsByTraffic 获取流量排行前列的协议
+func (m *MockDB) GetTopProtocolsByTraffic(start, end time.Time, limit int) ([]*model.TopTalker, error) {
+	return []*model.TopTalker{}, nil
+}
+
 // CreateProtocol 创建协议
 func (m *MockDB) CreateProtocol(protocol *model.Protocol) error {
 	return nil
@@ -1358,6 +1674,11 @@ func (m *MockDB) GetProtocol(id int64) (*model.Protocol, error) {
 	return &model.Protocol{}, nil
 }
 
+// GetProtocolByUUID 通过公开的 UUID 获取协议
+func (m *MockDB) GetProtocolByUUID(uuid string) (*model.Protocol, error) {
+	return &model.Protocol{}, nil
+}
+
 // GetProtocolsByUserID 获取用户协议
 func (m *MockDB) GetProtocolsByUserID(userID int64) ([]*model.Protocol, error) {
 	return nil, nil
@@ -1393,6 +1714,102 @@ func (m *MockDB) SearchProtocols(keyword string) ([]*model.Protocol, error) {
 	return nil, nil
 }
 
+// CreateProtocolVersion 创建协议版本记录
+func (m *MockDB) CreateProtocolVersion(version *model.ProtocolVersion) error {
+	return nil
+}
+
+// GetProtocolVersion 获取协议的指定版本
+func (m *MockDB) GetProtocolVersion(protocolID int64, version int) (*model.ProtocolVersion, error) {
+	return nil, nil
+}
+
+// ListProtocolVersions 获取协议的版本历史
+func (m *MockDB) ListProtocolVersions(protocolID int64) ([]*model.ProtocolVersion, error) {
+	return nil, nil
+}
+
+// GetProtocolSchedule 获取协议定时计划
+func (m *MockDB) GetProtocolSchedule(protocolID int64) (*model.ProtocolSchedule, error) {
+	return nil, nil
+}
+
+// ListProtocolSchedules 获取全部协议定时计划
+func (m *MockDB) ListProtocolSchedules() ([]*model.ProtocolSchedule, error) {
+	return nil, nil
+}
+
+// SaveProtocolSchedule 保存协议定时计划
+func (m *MockDB) SaveProtocolSchedule(schedule *model.ProtocolSchedule) error {
+	return nil
+}
+
+// DeleteProtocolSchedule 删除协议定时计划
+func (m *MockDB) DeleteProtocolSchedule(protocolID int64) error {
+	return nil
+}
+
+// AppendStreamEvent 追加实时事件
+func (m *MockDB) AppendStreamEvent(event *model.StreamEvent) error {
+	return nil
+}
+
+// ListStreamEvents 获取游标之后的实时事件
+func (m *MockDB) ListStreamEvents(after int64, limit int) ([]*model.StreamEvent, error) {
+	return nil, nil
+}
+
+// PruneStreamEvents 清理较早的实时事件
+func (m *MockDB) PruneStreamEvents(keep int) error {
+	return nil
+}
+
+// CreateNotification 保存通知
+func (m *MockDB) CreateNotification(n *model.Notification) error {
+	return nil
+}
+
+// ListNotifications 获取通知
+func (m *MockDB) ListNotifications(query *model.NotificationQuery) ([]*model.Notification, error) {
+	return nil, nil
+}
+
+// CountNotifications 统计通知数量
+func (m *MockDB) CountNotifications(query *model.NotificationQuery) (int64, error) {
+	return 0, nil
+}
+
+// MarkNotificationsRead 标记通知已读
+func (m *MockDB) MarkNotificationsRead(ids []int64) (int64, error) {
+	return 0, nil
+}
+
+// MarkAllNotificationsRead 标记全部通知已读
+func (m *MockDB) MarkAllNotificationsRead(query *model.NotificationQuery) (int64, error) {
+	return 0, nil
+}
+
+// PruneNotifications 清理较早的已读通知
+func (m *MockDB) PruneNotifications(before time.Time) error {
+	return nil
+}
+
+// AcquireLease 获取或续约主节点租约，单实例时总是成功
+func (m *MockDB) AcquireLease(name, holder, address string, ttl time.Duration) (*model.LeaderLease, error) {
+	now := time.Now()
+	return &model.LeaderLease{Name: name, Holder: holder, Address: address, ExpiresAt: now.Add(ttl), UpdatedAt: now}, nil
+}
+
+// ReleaseLease 释放主节点租约
+func (m *MockDB) ReleaseLease(name, holder string) error {
+	return nil
+}
+
+// DeleteProtocolCascade 删除协议及其统计数据
+func (m *MockDB) DeleteProtocolCascade(id int64, archive bool) error {
+	return nil
+}
+
 // CreateProtocolStats 创建协议统计
 func (m *MockDB) CreateProtocolStats(stats *model.ProtocolStats) error {
 	return nil
@@ -1519,7 +1936,7 @@ func (db *Database) CreateTrafficHistory(history *model.TrafficHistory) error {
 }
 
 // ListTrafficHistoryByDateRange returns traffic history records within a date range
-func (db *Database) ListTrafficHistoryByDateRange(userID uint, startDate, endDate string, histories *[]*model.TrafficHistory) error {
+func (db *Database) ListTrafficHistoryByDateRange(userID int64, startDate, endDate string, histories *[]*model.TrafficHistory) error {
 	return db.DB.Where("user_id = ? AND created_at BETWEEN ? AND ?", userID, startDate, endDate).Find(histories).Error
 }
 
@@ -0,0 +1,302 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// migrationBackupTimeLayout 迁移前快照文件名中的时间格式
+	migrationBackupTimeLayout = "20060102-150405"
+	// migrationBackupExt 迁移前快照文件扩展名
+	migrationBackupExt = ".db"
+)
+
+var (
+	// MigrationBackupDir 迁移前数据库快照目录
+	MigrationBackupDir = filepath.Join("data", "migration_backups")
+	// MigrationBackupKeep 保留的迁移前快照数量
+	MigrationBackupKeep = 5
+)
+
+var (
+	// ErrMigrationBackupNotFound 迁移前快照不存在
+	ErrMigrationBackupNotFound = errors.New("migration backup not found")
+	// ErrNothingToRollback 当前版本不高于快照的源版本，没有可回滚的迁移
+	ErrNothingToRollback = errors.New("no migration to roll back")
+)
+
+// MigrationBackup 执行迁移前的数据库快照
+type MigrationBackup struct {
+	ID          string    `json:"id"`
+	FromVersion int       `json:"from_version"` // 迁移前的版本
+	ToVersion   int       `json:"to_version"`   // 迁移的目标版本
+	CreatedAt   time.Time `json:"created_at"`
+	Size        int64     `json:"size"`
+}
+
+// latestMigrationVersion 返回已定义的最高迁移版本
+func latestMigrationVersion() int {
+	latest := 0
+	for _, m := range Migrations {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+	return latest
+}
+
+// BackupBeforeMigration 使用 VACUUM INTO 生成一致的数据库快照，文件名记录源版本和目标版本，
+// 随后只保留最近 MigrationBackupKeep 个快照
+func (db *Database) BackupBeforeMigration(from, to int) (*MigrationBackup, error) {
+	if err := os.MkdirAll(MigrationBackupDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create migration backup directory: %v", err)
+	}
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sql.DB: %v", err)
+	}
+
+	now := time.Now().UTC()
+	backup := &MigrationBackup{
+		ID:          fmt.Sprintf("v%d-v%d-%s", from, to, now.Format(migrationBackupTimeLayout)),
+		FromVersion: from,
+		ToVersion:   to,
+		CreatedAt:   now.Truncate(time.Second),
+	}
+	path := migrationBackupPath(backup.ID)
+	// VACUUM INTO 要求目标文件不存在
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale migration backup: %v", err)
+	}
+	if _, err := sqlDB.Exec("VACUUM INTO ?", path); err != nil {
+		return nil, fmt.Errorf("failed to snapshot database: %v", err)
+	}
+	// 快照包含用户凭据，仅所有者可读
+	if err := os.Chmod(path, 0600); err != nil {
+		return nil, fmt.Errorf("failed to protect migration backup: %v", err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		backup.Size = info.Size()
+	}
+
+	if err := pruneMigrationBackups(); err != nil {
+		return backup, err
+	}
+	return backup, nil
+}
+
+// ListMigrationBackups 按时间倒序列出迁移前快照
+func ListMigrationBackups() ([]*MigrationBackup, error) {
+	entries, err := os.ReadDir(MigrationBackupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*MigrationBackup{}, nil
+		}
+		return nil, fmt.Errorf("failed to read migration backup directory: %v", err)
+	}
+
+	backups := make([]*MigrationBackup, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), migrationBackupExt) {
+			continue
+		}
+		backup, ok := parseMigrationBackupID(strings.TrimSuffix(entry.Name(), migrationBackupExt))
+		if !ok {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			backup.Size = info.Size()
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// pruneMigrationBackups 删除超出保留数量的旧快照
+func pruneMigrationBackups() error {
+	backups, err := ListMigrationBackups()
+	if err != nil {
+		return err
+	}
+	keep := MigrationBackupKeep
+	if keep < 1 {
+		keep = 1
+	}
+	for _, backup := range backups[min(keep, len(backups)):] {
+		if err := os.Remove(migrationBackupPath(backup.ID)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove migration backup %s: %v", backup.ID, err)
+		}
+	}
+	return nil
+}
+
+// RollbackMigration 用迁移前快照替换当前数据库的全部表，并删除快照之后的迁移记录。
+// id 为空时使用最新的快照
+func (db *Database) RollbackMigration(id string) (*MigrationBackup, error) {
+	backups, err := ListMigrationBackups()
+	if err != nil {
+		return nil, err
+	}
+	var backup *MigrationBackup
+	for _, b := range backups {
+		if id == "" || b.ID == id {
+			backup = b
+			break
+		}
+	}
+	if backup == nil {
+		return nil, ErrMigrationBackupNotFound
+	}
+
+	currentVersion, err := db.GetCurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+	if currentVersion <= backup.FromVersion {
+		return nil, ErrNothingToRollback
+	}
+
+	if err := db.restoreSnapshot(migrationBackupPath(backup.ID), backup.FromVersion); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// restoreSnapshot 在同一连接上挂载快照，删除当前所有表后按快照重建表、索引和数据
+func (db *Database) restoreSnapshot(path string, version int) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get sql.DB: %v", err)
+	}
+
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+	defer conn.Close()
+
+	// 外键检查在事务内无法关闭，需在开始事务前设置
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return fmt.Errorf("failed to disable foreign keys: %v", err)
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS snapshot", path); err != nil {
+		return fmt.Errorf("failed to attach migration backup: %v", err)
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE snapshot")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT type, name FROM main.sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %v", err)
+	}
+	var drops []string
+	for rows.Next() {
+		var typ, name string
+		if err := rows.Scan(&typ, &name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan table name: %v", err)
+		}
+		drops = append(drops, fmt.Sprintf("DROP %s IF EXISTS main.%s", strings.ToUpper(typ), quoteIdent(name)))
+	}
+	rows.Close()
+	for _, stmt := range drops {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to drop table: %v", err)
+		}
+	}
+
+	// 先建表并复制数据，再建索引、视图和触发器
+	rows, err = tx.QueryContext(ctx, `SELECT type, name, sql FROM snapshot.sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 WHEN 'view' THEN 2 ELSE 3 END`)
+	if err != nil {
+		return fmt.Errorf("failed to read migration backup schema: %v", err)
+	}
+	type schemaObject struct {
+		typ, name, sql string
+	}
+	var objects []schemaObject
+	for rows.Next() {
+		var o schemaObject
+		if err := rows.Scan(&o.typ, &o.name, &o.sql); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan schema: %v", err)
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+
+	for _, o := range objects {
+		if _, err := tx.ExecContext(ctx, o.sql); err != nil {
+			return fmt.Errorf("failed to create %s %s: %v", o.typ, o.name, err)
+		}
+		if o.typ != "table" {
+			continue
+		}
+		copyStmt := fmt.Sprintf("INSERT INTO main.%s SELECT * FROM snapshot.%s", quoteIdent(o.name), quoteIdent(o.name))
+		if _, err := tx.ExecContext(ctx, copyStmt); err != nil {
+			return fmt.Errorf("failed to restore table %s: %v", o.name, err)
+		}
+	}
+
+	// 快照中的迁移记录已是源版本，这里再次确认以防快照在迁移过程中生成
+	if _, err := tx.ExecContext(ctx, "DELETE FROM migrations WHERE version > ?", version); err != nil {
+		return fmt.Errorf("failed to revert migration records: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rollback: %v", err)
+	}
+	return nil
+}
+
+// migrationBackupPath 返回快照文件路径
+func migrationBackupPath(id string) string {
+	return filepath.Join(MigrationBackupDir, id+migrationBackupExt)
+}
+
+// parseMigrationBackupID 从快照 ID（v源版本-v目标版本-时间）解析版本和创建时间，同时防止路径穿越
+func parseMigrationBackupID(id string) (*MigrationBackup, bool) {
+	var from, to int
+	parts := strings.SplitN(id, "-", 3)
+	if len(parts) != 3 {
+		return nil, false
+	}
+	if _, err := fmt.Sscanf(parts[0], "v%d", &from); err != nil {
+		return nil, false
+	}
+	if _, err := fmt.Sscanf(parts[1], "v%d", &to); err != nil {
+		return nil, false
+	}
+	stamp := parts[2]
+	createdAt, err := time.Parse(migrationBackupTimeLayout, stamp)
+	if err != nil {
+		return nil, false
+	}
+	if id != fmt.Sprintf("v%d-v%d-%s", from, to, stamp) {
+		return nil, false
+	}
+	return &MigrationBackup{ID: id, FromVersion: from, ToVersion: to, CreatedAt: createdAt}, true
+}
+
+// quoteIdent 转义 SQLite 标识符
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
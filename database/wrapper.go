@@ -38,16 +38,31 @@ func (w *DBWrapper) CreateUser(user *model.User) error {
 	return ErrNotImplemented
 }
 
+// CreateUsers implements model.DB.CreateUsers
+func (w *DBWrapper) CreateUsers(users []*model.User) error {
+	return ErrNotImplemented
+}
+
 // GetUser implements model.DB.GetUser
 func (w *DBWrapper) GetUser(id int64) (*model.User, error) {
 	return nil, ErrNotImplemented
 }
 
+// GetUserByUUID implements model.DB.GetUserByUUID
+func (w *DBWrapper) GetUserByUUID(uuid string) (*model.User, error) {
+	return nil, ErrNotImplemented
+}
+
 // GetUserByUsername implements model.DB.GetUserByUsername
 func (w *DBWrapper) GetUserByUsername(username string) (*model.User, error) {
 	return nil, ErrNotImplemented
 }
 
+// GetUserByIdentity implements model.DB.GetUserByIdentity
+func (w *DBWrapper) GetUserByIdentity(issuer, subject string) (*model.User, error) {
+	return nil, ErrNotImplemented
+}
+
 // GetUserByEmail implements model.DB.GetUserByEmail
 func (w *DBWrapper) GetUserByEmail(email string) (*model.User, error) {
 	return nil, ErrNotImplemented
@@ -154,7 +169,7 @@ func (w *DBWrapper) ListTrafficByProxyID(proxyID int64) ([]*common.TrafficStats,
 }
 
 // GetTrafficStats implements model.DB.GetTrafficStats
-func (w *DBWrapper) GetTrafficStats(userID uint) (*model.TrafficStats, error) {
+func (w *DBWrapper) GetTrafficStats(userID int64) (*model.TrafficStats, error) {
 	return nil, ErrNotImplemented
 }
 
@@ -163,11 +178,56 @@ func (w *DBWrapper) CreateTrafficRecord(traffic *model.Traffic) error {
 	return ErrNotImplemented
 }
 
+// AdjustUserTraffic implements model.DB.AdjustUserTraffic
+func (w *DBWrapper) AdjustUserTraffic(adjustment *model.Traffic) error {
+	return ErrNotImplemented
+}
+
+// ListTrafficAdjustments implements model.DB.ListTrafficAdjustments
+func (w *DBWrapper) ListTrafficAdjustments(userID int64) ([]*model.Traffic, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetSubscription implements model.DB.GetSubscription
+func (w *DBWrapper) GetSubscription(userID int64) (*model.Subscription, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetSubscriptionByToken implements model.DB.GetSubscriptionByToken
+func (w *DBWrapper) GetSubscriptionByToken(token string) (*model.Subscription, error) {
+	return nil, ErrNotImplemented
+}
+
+// ListSubscriptions implements model.DB.ListSubscriptions
+func (w *DBWrapper) ListSubscriptions() ([]*model.Subscription, error) {
+	return nil, ErrNotImplemented
+}
+
+// UpdateSubscriptionNotifyStatus implements model.DB.UpdateSubscriptionNotifyStatus
+func (w *DBWrapper) UpdateSubscriptionNotifyStatus(userID int64, notifiedAt *time.Time, notifyError string) error {
+	return ErrNotImplemented
+}
+
+// SaveSubscription implements model.DB.SaveSubscription
+func (w *DBWrapper) SaveSubscription(sub *model.Subscription) error {
+	return ErrNotImplemented
+}
+
 // CleanupTraffic implements model.DB.CleanupTraffic
 func (w *DBWrapper) CleanupTraffic(before time.Time) error {
 	return ErrNotImplemented
 }
 
+// GetTopUsersByTraffic implements model.DB.GetTopUsersByTraffic
+func (w *DBWrapper) GetTopUsersByTraffic(start, end time.Time, limit int) ([]*model.TopTalker, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetTopProtocolsByTraffic implements model.DB.GetTopProtocolsByTraffic
+func (w *DBWrapper) GetTopProtocolsByTraffic(start, end time.Time, limit int) ([]*model.TopTalker, error) {
+	return nil, ErrNotImplemented
+}
+
 // Begin implements model.DB.Begin
 func (w *DBWrapper) Begin() error {
 	return ErrNotImplemented
@@ -198,6 +258,11 @@ func (w *DBWrapper) GetProtocol(id int64) (*model.Protocol, error) {
 	return nil, ErrNotImplemented
 }
 
+// GetProtocolByUUID implements model.DB.GetProtocolByUUID
+func (w *DBWrapper) GetProtocolByUUID(uuid string) (*model.Protocol, error) {
+	return nil, ErrNotImplemented
+}
+
 // GetProtocolsByUserID implements model.DB.GetProtocolsByUserID
 func (w *DBWrapper) GetProtocolsByUserID(userID int64) ([]*model.Protocol, error) {
 	return nil, ErrNotImplemented
@@ -233,6 +298,101 @@ func (w *DBWrapper) SearchProtocols(keyword string) ([]*model.Protocol, error) {
 	return nil, ErrNotImplemented
 }
 
+// CreateProtocolVersion implements model.DB.CreateProtocolVersion
+func (w *DBWrapper) CreateProtocolVersion(version *model.ProtocolVersion) error {
+	return ErrNotImplemented
+}
+
+// GetProtocolVersion implements model.DB.GetProtocolVersion
+func (w *DBWrapper) GetProtocolVersion(protocolID int64, version int) (*model.ProtocolVersion, error) {
+	return nil, ErrNotImplemented
+}
+
+// ListProtocolVersions implements model.DB.ListProtocolVersions
+func (w *DBWrapper) ListProtocolVersions(protocolID int64) ([]*model.ProtocolVersion, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetProtocolSchedule implements model.DB.GetProtocolSchedule
+func (w *DBWrapper) GetProtocolSchedule(protocolID int64) (*model.ProtocolSchedule, error) {
+	return nil, ErrNotImplemented
+}
+
+// ListProtocolSchedules implements model.DB.ListProtocolSchedules
+func (w *DBWrapper) ListProtocolSchedules() ([]*model.ProtocolSchedule, error) {
+	return nil, ErrNotImplemented
+}
+
+// SaveProtocolSchedule implements model.DB.SaveProtocolSchedule
+func (w *DBWrapper) SaveProtocolSchedule(schedule *model.ProtocolSchedule) error {
+	return ErrNotImplemented
+}
+
+// DeleteProtocolSchedule implements model.DB.DeleteProtocolSchedule
+func (w *DBWrapper) DeleteProtocolSchedule(protocolID int64) error {
+	return ErrNotImplemented
+}
+
+// AppendStreamEvent implements model.DB.AppendStreamEvent
+func (w *DBWrapper) AppendStreamEvent(event *model.StreamEvent) error {
+	return ErrNotImplemented
+}
+
+// ListStreamEvents implements model.DB.ListStreamEvents
+func (w *DBWrapper) ListStreamEvents(after int64, limit int) ([]*model.StreamEvent, error) {
+	return nil, ErrNotImplemented
+}
+
+// PruneStreamEvents implements model.DB.PruneStreamEvents
+func (w *DBWrapper) PruneStreamEvents(keep int) error {
+	return ErrNotImplemented
+}
+
+// CreateNotification implements model.DB.CreateNotification
+func (w *DBWrapper) CreateNotification(n *model.Notification) error {
+	return ErrNotImplemented
+}
+
+// ListNotifications implements model.DB.ListNotifications
+func (w *DBWrapper) ListNotifications(query *model.NotificationQuery) ([]*model.Notification, error) {
+	return nil, ErrNotImplemented
+}
+
+// CountNotifications implements model.DB.CountNotifications
+func (w *DBWrapper) CountNotifications(query *model.NotificationQuery) (int64, error) {
+	return 0, ErrNotImplemented
+}
+
+// MarkNotificationsRead implements model.DB.MarkNotificationsRead
+func (w *DBWrapper) MarkNotificationsRead(ids []int64) (int64, error) {
+	return 0, ErrNotImplemented
+}
+
+// MarkAllNotificationsRead implements model.DB.MarkAllNotificationsRead
+func (w *DBWrapper) MarkAllNotificationsRead(query *model.NotificationQuery) (int64, error) {
+	return 0, ErrNotImplemented
+}
+
+// PruneNotifications implements model.DB.PruneNotifications
+func (w *DBWrapper) PruneNotifications(before time.Time) error {
+	return ErrNotImplemented
+}
+
+// AcquireLease implements model.DB.AcquireLease
+func (w *DBWrapper) AcquireLease(name, holder, address string, ttl time.Duration) (*model.LeaderLease, error) {
+	return nil, ErrNotImplemented
+}
+
+// ReleaseLease implements model.DB.ReleaseLease
+func (w *DBWrapper) ReleaseLease(name, holder string) error {
+	return ErrNotImplemented
+}
+
+// DeleteProtocolCascade implements model.DB.DeleteProtocolCascade
+func (w *DBWrapper) DeleteProtocolCascade(id int64, archive bool) error {
+	return ErrNotImplemented
+}
+
 // CreateProtocolStats implements model.DB.CreateProtocolStats
 func (w *DBWrapper) CreateProtocolStats(stats *model.ProtocolStats) error {
 	return ErrNotImplemented
@@ -421,7 +581,7 @@ func (w *DBWrapper) CreateTrafficHistory(history *model.TrafficHistory) error {
 }
 
 // ListTrafficHistoryByDateRange implements model.DB.ListTrafficHistoryByDateRange
-func (w *DBWrapper) ListTrafficHistoryByDateRange(userID uint, startDate, endDate string, histories *[]*model.TrafficHistory) error {
+func (w *DBWrapper) ListTrafficHistoryByDateRange(userID int64, startDate, endDate string, histories *[]*model.TrafficHistory) error {
 	return w.db.ListTrafficHistoryByDateRange(userID, startDate, endDate, histories)
 }
 
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+)
+
+// 事件类型
+const (
+	TypeXray         = "xray"
+	TypeSettings     = "settings"
+	TypeNotification = "notification"
+)
+
+const (
+	// maxHistory 保留的事件数量，更早的事件被清理，游标落后太多的客户端会收到 truncated
+	maxHistory = 1000
+	// pruneEvery 每追加若干条事件清理一次
+	pruneEvery = 100
+)
+
+// PollResult 一次长轮询的结果
+type PollResult struct {
+	Events    []*model.StreamEvent `json:"events"`
+	Cursor    int64                `json:"cursor"`    // 下次请求使用的游标
+	HasMore   bool                 `json:"has_more"`  // 还有更多事件，应立即再次请求
+	Truncated bool                 `json:"truncated"` // 游标之后的部分事件已被清理，客户端应重新加载完整状态
+}
+
+// History 持久化的实时事件历史，供无法建立推送连接的客户端通过长轮询获取事件
+type History struct {
+	log *logger.Logger
+	db  model.DB
+
+	mu       sync.Mutex
+	wake     chan struct{}
+	appended int
+}
+
+// NewHistory 创建事件历史
+func NewHistory(log *logger.Logger, db model.DB) *History {
+	return &History{
+		log:  log,
+		db:   db,
+		wake: make(chan struct{}),
+	}
+}
+
+// WatchSettings 将之后的设置变更写入事件历史
+func (h *History) WatchSettings(mgr *settings.Manager) {
+	mgr.OnChange(func(prev, next *settings.Settings, actor string) {
+		sections := settings.ChangedSections(prev, next)
+		if len(sections) == 0 {
+			return
+		}
+		// 回调持有设置写锁，写库放到后台
+		go h.PublishQuietly(TypeSettings, map[string]interface{}{
+			"sections": sections,
+			"actor":    actor,
+		})
+	})
+}
+
+// PublishQuietly 写入事件，失败时只记录日志
+func (h *History) PublishQuietly(typ string, data interface{}) {
+	if err := h.Publish(typ, data); err != nil {
+		h.log.WarnWithFields("Failed to record stream event", logger.Fields{
+			"type":  typ,
+			"error": err.Error(),
+		})
+	}
+}
+
+// Publish 写入一条事件并唤醒等待中的长轮询
+func (h *History) Publish(typ string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream event: %v", err)
+	}
+	event := &model.StreamEvent{Type: typ, Data: raw, CreatedAt: time.Now()}
+	if err := h.db.AppendStreamEvent(event); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	close(h.wake)
+	h.wake = make(chan struct{})
+	h.appended++
+	prune := h.appended%pruneEvery == 0
+	h.mu.Unlock()
+
+	if prune {
+		if err := h.db.PruneStreamEvents(maxHistory); err != nil {
+			h.log.WarnWithFields("Failed to prune stream events", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// Poll 返回游标之后的事件，没有新事件时最多等待 timeout，超时返回空结果和原游标
+func (h *History) Poll(ctx context.Context, cursor int64, limit int, timeout time.Duration) (*PollResult, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		// 先取唤醒通道再查询，避免查询和等待之间写入的事件被错过
+		h.mu.Lock()
+		wake := h.wake
+		h.mu.Unlock()
+
+		// 多取一条用于判断是否还有更多事件
+		events, err := h.db.ListStreamEvents(cursor, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 {
+			result := &PollResult{
+				Events:    events,
+				Truncated: cursor > 0 && events[0].ID > cursor+1,
+			}
+			if len(events) > limit {
+				result.Events = events[:limit]
+				result.HasMore = true
+			}
+			result.Cursor = result.Events[len(result.Events)-1].ID
+			return result, nil
+		}
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return &PollResult{Events: []*model.StreamEvent{}, Cursor: cursor}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
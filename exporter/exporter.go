@@ -0,0 +1,415 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// 支持的导出后端
+const (
+	BackendClickHouse = "clickhouse"
+	BackendInfluxDB   = "influxdb"
+)
+
+// 事件类型
+const (
+	EventTraffic    = "traffic"
+	EventConnection = "connection"
+)
+
+// validTableName ClickHouse 库名和表名允许的格式，表名直接拼接在插入语句中
+var validTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// Event 导出的流量或连接事件
+type Event struct {
+	Type       string    `json:"type"`
+	Timestamp  time.Time `json:"timestamp"`
+	UserID     int64     `json:"user_id"`
+	ProtocolID int64     `json:"protocol_id"`
+	Upload     int64     `json:"upload"`
+	Download   int64     `json:"download"`
+	SourceIP   string    `json:"source_ip,omitempty"`
+	Target     string    `json:"target,omitempty"`
+}
+
+// Exporter 将流量事件批量写入外部分析数据库
+type Exporter struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	client   *http.Client
+	queue    chan *Event
+	watch    sync.Once
+	mu       sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	closed   bool
+	dropped  atomic.Int64
+	exported atomic.Int64
+}
+
+// New 创建流量导出器
+func New(log *logger.Logger, settingsMgr *settings.Manager) *Exporter {
+	s := settingsMgr.Get().Export
+	queueSize := s.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+
+	return &Exporter{
+		log:      log,
+		settings: settingsMgr,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan *Event, queueSize),
+	}
+}
+
+// Start starts the exporter and restarts it whenever the export settings change
+func (e *Exporter) Start() error {
+	e.watch.Do(func() {
+		e.settings.OnChange(func(prev, next *settings.Settings, actor string) {
+			if prev.Export != next.Export {
+				// 回调持有设置写锁，在新协程中等待旧的发送协程结束
+				go func() {
+					if err := e.reload(); err != nil {
+						e.log.ErrorWithFields("Failed to restart traffic exporter", logger.Fields{
+							"error": err.Error(),
+						})
+					}
+				}()
+			}
+		})
+	})
+	return e.reload()
+}
+
+// Stop stops the exporter and flushes pending events, safe to call more than once
+func (e *Exporter) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	e.stopLocked()
+}
+
+// reload 按当前设置停止并重新启动发送协程，未启用时只停止
+func (e *Exporter) reload() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.stopLocked()
+
+	s := e.settings.Get().Export
+	if !s.Enable {
+		return nil
+	}
+	if err := validate(&s); err != nil {
+		return err
+	}
+
+	e.stop, e.done = make(chan struct{}), make(chan struct{})
+	go e.run(&s, e.stop, e.done)
+
+	e.log.WithFields("Traffic exporter started", logger.Fields{
+		"backend": s.Backend,
+		"url":     s.URL,
+	})
+
+	return nil
+}
+
+// stopLocked 停止正在运行的发送协程并等待剩余事件发送完毕，调用方需持有 mu
+func (e *Exporter) stopLocked() {
+	if e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+	e.stop, e.done = nil, nil
+}
+
+// validate 检查导出设置是否完整
+func validate(s *settings.ExportSettings) error {
+	if s.Backend != BackendClickHouse && s.Backend != BackendInfluxDB {
+		return fmt.Errorf("unsupported export backend: %s", s.Backend)
+	}
+	if s.URL == "" {
+		return fmt.Errorf("export url is not configured")
+	}
+	if s.Backend != BackendClickHouse {
+		return nil
+	}
+	if s.Table != "" && !validTableName.MatchString(s.Table) {
+		return fmt.Errorf("invalid export table name: %s", s.Table)
+	}
+	if s.Database != "" && !validTableName.MatchString(s.Database) {
+		return fmt.Errorf("invalid export database name: %s", s.Database)
+	}
+	return nil
+}
+
+// Record 记录一个事件，队列满时直接丢弃，避免影响面板
+func (e *Exporter) Record(event *Event) {
+	if !e.settings.Get().Export.Enable {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// RecordTraffic 记录流量事件
+func (e *Exporter) RecordTraffic(userID, protocolID, upload, download int64) {
+	e.Record(&Event{
+		Type:       EventTraffic,
+		UserID:     userID,
+		ProtocolID: protocolID,
+		Upload:     upload,
+		Download:   download,
+	})
+}
+
+// RecordConnection 记录连接事件
+func (e *Exporter) RecordConnection(userID, protocolID int64, sourceIP, target string) {
+	e.Record(&Event{
+		Type:       EventConnection,
+		UserID:     userID,
+		ProtocolID: protocolID,
+		SourceIP:   sourceIP,
+		Target:     target,
+	})
+}
+
+// Stats 返回已导出和已丢弃的事件数
+func (e *Exporter) Stats() (exported, dropped int64) {
+	return e.exported.Load(), e.dropped.Load()
+}
+
+// run 批量发送事件，直到 stop 关闭
+func (e *Exporter) run(s *settings.ExportSettings, stop, done chan struct{}) {
+	defer close(done)
+
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	interval := s.FlushInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(s, batch); err != nil {
+			e.dropped.Add(int64(len(batch)))
+			e.log.ErrorWithFields("Failed to export traffic events", logger.Fields{
+				"count": len(batch),
+				"error": err,
+			})
+		} else {
+			e.exported.Add(int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event := <-e.queue:
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			// 发送队列中剩余的事件
+			for {
+				select {
+				case event := <-e.queue:
+					batch = append(batch, event)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send 根据后端类型发送一批事件
+func (e *Exporter) send(s *settings.ExportSettings, events []*Event) error {
+	var req *http.Request
+	var err error
+	switch s.Backend {
+	case BackendClickHouse:
+		req, err = buildClickHouseRequest(s, events)
+	case BackendInfluxDB:
+		req, err = buildInfluxDBRequest(s, events)
+	default:
+		return fmt.Errorf("unsupported export backend: %s", s.Backend)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to send events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("export backend returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// buildClickHouseRequest 构造 ClickHouse JSONEachRow 批量插入请求
+func buildClickHouseRequest(s *settings.ExportSettings, events []*Event) (*http.Request, error) {
+	table := s.Table
+	if table == "" {
+		table = "traffic_events"
+	}
+	if s.Database != "" {
+		table = s.Database + "." + table
+	}
+	if !validTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid export table name: %s", table)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		row := map[string]interface{}{
+			"type":        event.Type,
+			"timestamp":   event.Timestamp.UTC().Format("2006-01-02 15:04:05"),
+			"user_id":     event.UserID,
+			"protocol_id": event.ProtocolID,
+			"upload":      event.Upload,
+			"download":    event.Download,
+			"source_ip":   event.SourceIP,
+			"target":      event.Target,
+		}
+		if err := encoder.Encode(row); err != nil {
+			return nil, fmt.Errorf("failed to encode event: %v", err)
+		}
+	}
+
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", table))
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(s.URL, "/")+"/?"+query.Encode(), &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if s.Username != "" {
+		req.Header.Set("X-ClickHouse-User", s.Username)
+		req.Header.Set("X-ClickHouse-Key", s.Password)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// buildInfluxDBRequest 构造 InfluxDB 行协议写入请求
+func buildInfluxDBRequest(s *settings.ExportSettings, events []*Event) (*http.Request, error) {
+	measurement := s.Table
+	if measurement == "" {
+		measurement = "traffic_events"
+	}
+
+	var buf bytes.Buffer
+	for _, event := range events {
+		fmt.Fprintf(&buf, "%s,type=%s,user_id=%d,protocol_id=%d upload=%di,download=%di",
+			escapeInfluxMeasurement(measurement), escapeInfluxKey(event.Type),
+			event.UserID, event.ProtocolID, event.Upload, event.Download)
+		if event.SourceIP != "" {
+			fmt.Fprintf(&buf, ",source_ip=%s", quoteInfluxString(event.SourceIP))
+		}
+		if event.Target != "" {
+			fmt.Fprintf(&buf, ",target=%s", quoteInfluxString(event.Target))
+		}
+		fmt.Fprintf(&buf, " %d\n", event.Timestamp.UnixNano())
+	}
+
+	// 配置了 org 时使用 v2 写入接口，否则使用 v1 接口
+	query := url.Values{}
+	endpoint := strings.TrimRight(s.URL, "/")
+	if s.Org != "" {
+		endpoint += "/api/v2/write"
+		query.Set("org", s.Org)
+		query.Set("bucket", s.Database)
+	} else {
+		endpoint += "/write"
+		query.Set("db", s.Database)
+	}
+	query.Set("precision", "ns")
+
+	req, err := http.NewRequest(http.MethodPost, endpoint+"?"+query.Encode(), &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	// v1 的用户名密码放在请求头中，避免出现在代理和服务端的访问日志里
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	} else if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	return req, nil
+}
+
+// 行协议各部分需要转义的字符，换行会截断当前行，统一替换为空格后转义
+var (
+	influxMeasurementEscaper = strings.NewReplacer("\n", `\ `, "\r", `\ `, ",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer("\n", `\ `, "\r", `\ `, ",", `\,`, " ", `\ `, "=", `\=`)
+	influxStringEscaper      = strings.NewReplacer("\n", " ", "\r", " ", `\`, `\\`, `"`, `\"`)
+)
+
+// escapeInfluxMeasurement 转义行协议中的度量名
+func escapeInfluxMeasurement(s string) string {
+	return influxMeasurementEscaper.Replace(s)
+}
+
+// escapeInfluxKey 转义行协议中的标签键和标签值
+func escapeInfluxKey(s string) string {
+	return influxKeyEscaper.Replace(s)
+}
+
+// quoteInfluxString 转义并加引号，生成行协议中的字符串字段值
+func quoteInfluxString(s string) string {
+	return `"` + influxStringEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"v/settings"
+)
+
+func TestBuildInfluxDBRequest(t *testing.T) {
+	event := &Event{
+		Type:       EventConnection,
+		Timestamp:  time.Unix(1700000000, 0),
+		ProtocolID: 3,
+		SourceIP:   `203.0.113.7`,
+		Target:     "tcp:example.com:443\"\\\nnext",
+	}
+
+	tests := []struct {
+		name     string
+		cfg      settings.ExportSettings
+		wantLine string
+		wantURL  string
+		wantAuth string
+	}{
+		{
+			name:     "v1 with credentials",
+			cfg:      settings.ExportSettings{URL: "http://influx:8086/", Database: "v", Table: "traffic events,v", Username: "alice", Password: "p@ss"},
+			wantLine: `traffic\ events\,v,type=connection,user_id=0,protocol_id=3 upload=0i,download=0i,source_ip="203.0.113.7",target="tcp:example.com:443\"\\ next" 1700000000000000000`,
+			wantURL:  "http://influx:8086/write?db=v&precision=ns",
+		},
+		{
+			name:     "v2 with token",
+			cfg:      settings.ExportSettings{URL: "http://influx:8086", Database: "bucket", Org: "org", Token: "secret"},
+			wantLine: `traffic_events,type=connection,user_id=0,protocol_id=3 upload=0i,download=0i,source_ip="203.0.113.7",target="tcp:example.com:443\"\\ next" 1700000000000000000`,
+			wantURL:  "http://influx:8086/api/v2/write?bucket=bucket&org=org&precision=ns",
+			wantAuth: "Token secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := buildInfluxDBRequest(&tt.cfg, []*Event{event})
+			if err != nil {
+				t.Fatalf("buildInfluxDBRequest: %v", err)
+			}
+			body, _ := io.ReadAll(req.Body)
+			if got := strings.TrimSuffix(string(body), "\n"); got != tt.wantLine {
+				t.Errorf("line = %s\nwant   %s", got, tt.wantLine)
+			}
+			if got := req.URL.String(); got != tt.wantURL {
+				t.Errorf("url = %s, want %s", got, tt.wantURL)
+			}
+
+			// v1 凭据只出现在 Basic 认证头中
+			if tt.cfg.Username != "" {
+				user, pass, ok := req.BasicAuth()
+				if !ok || user != tt.cfg.Username || pass != tt.cfg.Password {
+					t.Errorf("basic auth = %q, %q, %v; want %q, %q", user, pass, ok, tt.cfg.Username, tt.cfg.Password)
+				}
+				if strings.Contains(req.URL.RawQuery, tt.cfg.Password) {
+					t.Errorf("password leaked into query %q", req.URL.RawQuery)
+				}
+			} else if got := req.Header.Get("Authorization"); got != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", got, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestBuildClickHouseRequestTableName(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		table    string
+		wantErr  bool
+	}{
+		{name: "default table", table: ""},
+		{name: "database and table", database: "analytics", table: "traffic_events"},
+		{name: "dotted table", table: "analytics.events_v2"},
+		{name: "injection", table: "events FORMAT CSV; DROP TABLE users", wantErr: true},
+		{name: "leading digit", table: "1events", wantErr: true},
+		{name: "quoted database", database: "`analytics`", table: "events", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := settings.ExportSettings{Backend: BackendClickHouse, URL: "http://clickhouse:8123", Database: tt.database, Table: tt.table}
+			_, err := buildClickHouseRequest(&cfg, []*Event{{Type: EventTraffic}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("buildClickHouseRequest error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := validate(&cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validate error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
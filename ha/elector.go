@@ -0,0 +1,299 @@
+package ha
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+)
+
+// leaseName 控制端主节点租约的名称
+const leaseName = "controller"
+
+// defaultLeaseTTL 未配置租约时长时的默认值
+const defaultLeaseTTL = 15 * time.Second
+
+// 实例角色
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// LeaseStore 保存主节点租约，所有实例必须使用同一个存储，model.DB 实现了该接口
+type LeaseStore interface {
+	AcquireLease(name, holder, address string, ttl time.Duration) (*model.LeaderLease, error)
+	ReleaseLease(name, holder string) error
+}
+
+// task 只在主节点上运行的后台任务
+type task struct {
+	name  string
+	start func() error
+	stop  func()
+}
+
+// Status 当前实例的主备状态
+type Status struct {
+	Enabled        bool       `json:"enabled"`
+	NodeID         string     `json:"node_id"`
+	Role           string     `json:"role"`
+	Since          time.Time  `json:"since"`                      // 进入当前角色的时间
+	Leader         string     `json:"leader,omitempty"`           // 当前主节点的实例 ID
+	LeaderAddress  string     `json:"leader_address,omitempty"`   // 当前主节点的面板访问地址
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"` // 主节点租约到期时间
+}
+
+// Elector 多个面板实例共用数据库时通过数据库租约选举主节点。
+// 主节点运行定时任务、流量采集和配置同步，备用实例只提供只读 API，
+// 主节点超过租约时长未续约时由备用实例接管。未启用时本实例始终为主节点
+type Elector struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	db       LeaseStore
+	nodeID   string
+
+	mu        sync.Mutex
+	tasks     []task
+	leader    bool
+	since     time.Time
+	lease     *model.LeaderLease
+	lastRenew time.Time
+	stopCh    chan struct{}
+	done      chan struct{}
+}
+
+// New 创建主节点选举器，db 为所有实例共用的租约存储
+func New(log *logger.Logger, settingsMgr *settings.Manager, db LeaseStore) *Elector {
+	nodeID := settingsMgr.Get().HA.NodeID
+	if nodeID == "" {
+		// 同一主机上可能运行多个实例，未配置时附加进程号
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "panel"
+		}
+		nodeID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	return &Elector{
+		log:      log,
+		settings: settingsMgr,
+		db:       db,
+		nodeID:   nodeID,
+		since:    time.Now(),
+	}
+}
+
+// NodeID 返回本实例 ID
+func (e *Elector) NodeID() string {
+	return e.nodeID
+}
+
+// Run 注册只在主节点上运行的任务，本实例已是主节点时立即启动
+func (e *Elector) Run(name string, start func() error, stop func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := task{name: name, start: start, stop: stop}
+	e.tasks = append(e.tasks, t)
+	if e.leader {
+		e.startTask(t)
+	}
+}
+
+// Start 开始竞选。未启用主备模式时直接成为主节点
+func (e *Elector) Start() {
+	e.mu.Lock()
+	if e.stopCh != nil {
+		e.mu.Unlock()
+		return
+	}
+	if !e.settings.Get().HA.Enable {
+		e.promote()
+		e.mu.Unlock()
+		return
+	}
+	e.stopCh = make(chan struct{})
+	e.done = make(chan struct{})
+	stopCh, done := e.stopCh, e.done
+	e.mu.Unlock()
+
+	e.log.WithFields("Warm standby enabled, campaigning for leadership", logger.Fields{
+		"node_id": e.nodeID,
+	})
+	go e.run(stopCh, done)
+}
+
+// Stop 停止竞选和主节点任务，持有租约时主动释放，备用实例可以立即接管
+func (e *Elector) Stop() {
+	e.mu.Lock()
+	stopCh, done := e.stopCh, e.done
+	e.stopCh, e.done = nil, nil
+	e.mu.Unlock()
+
+	if stopCh != nil {
+		close(stopCh)
+		<-done
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	wasLeader := e.leader
+	e.demote("shutdown")
+	if wasLeader && stopCh != nil {
+		if err := e.db.ReleaseLease(leaseName, e.nodeID); err != nil {
+			e.log.WarnWithFields("Failed to release leader lease", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// IsLeader 判断本实例当前是否为主节点
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// LeaderAddress 返回当前主节点的面板访问地址，未知时为空
+func (e *Elector) LeaderAddress() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lease == nil {
+		return ""
+	}
+	return e.lease.Address
+}
+
+// Status 返回当前实例的主备状态
+func (e *Elector) Status() *Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := &Status{
+		Enabled: e.settings.Get().HA.Enable,
+		NodeID:  e.nodeID,
+		Role:    RoleFollower,
+		Since:   e.since,
+	}
+	if e.leader {
+		status.Role = RoleLeader
+	}
+	if e.lease != nil {
+		expires := e.lease.ExpiresAt
+		status.Leader = e.lease.Holder
+		status.LeaderAddress = e.lease.Address
+		status.LeaseExpiresAt = &expires
+	}
+	return status
+}
+
+// run 竞选循环，启动时立即竞选一次
+func (e *Elector) run(stopCh, done chan struct{}) {
+	defer close(done)
+
+	for {
+		ttl, interval := e.timing()
+		e.campaign(ttl, interval)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// timing 返回租约时长和续约间隔，续约间隔必须小于租约时长
+func (e *Elector) timing() (time.Duration, time.Duration) {
+	cfg := e.settings.Get().HA
+	ttl := cfg.LeaseTTL
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+	interval := cfg.RenewInterval
+	if interval <= 0 || interval >= ttl {
+		interval = ttl / 3
+	}
+	return ttl, interval
+}
+
+// campaign 获取或续约租约，并按结果切换角色
+func (e *Elector) campaign(ttl, interval time.Duration) {
+	lease, err := e.db.AcquireLease(leaseName, e.nodeID, e.settings.Get().HA.AdvertiseURL, ttl)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		e.log.WarnWithFields("Failed to renew leader lease", logger.Fields{
+			"node_id": e.nodeID,
+			"error":   err.Error(),
+		})
+		// 无法续约时在租约到期前主动退位，避免与接管的实例同时运行任务
+		if e.leader && time.Since(e.lastRenew) >= ttl-interval {
+			e.demote("lease renewal failed")
+		}
+		return
+	}
+
+	e.lease = lease
+	if lease.Holder == e.nodeID {
+		e.lastRenew = time.Now()
+		if !e.leader {
+			e.promote()
+		}
+		return
+	}
+	if e.leader {
+		e.demote("lease taken by " + lease.Holder)
+	}
+}
+
+// promote 成为主节点并启动所有任务，调用方必须持有 e.mu
+func (e *Elector) promote() {
+	e.leader = true
+	e.since = time.Now()
+	e.log.WithFields("Became leader", logger.Fields{
+		"node_id": e.nodeID,
+	})
+	for _, t := range e.tasks {
+		e.startTask(t)
+	}
+}
+
+// demote 退为备用实例并按注册的逆序停止任务，调用方必须持有 e.mu
+func (e *Elector) demote(reason string) {
+	if !e.leader {
+		return
+	}
+	e.leader = false
+	e.since = time.Now()
+	e.log.WarnWithFields("Stepped down to follower", logger.Fields{
+		"node_id": e.nodeID,
+		"reason":  reason,
+	})
+	for i := len(e.tasks) - 1; i >= 0; i-- {
+		if e.tasks[i].stop != nil {
+			e.tasks[i].stop()
+		}
+	}
+}
+
+// startTask 启动单个任务，失败时只记录日志
+func (e *Elector) startTask(t task) {
+	if t.start == nil {
+		return
+	}
+	if err := t.start(); err != nil {
+		e.log.ErrorWithFields("Failed to start leader task", logger.Fields{
+			"task":  t.name,
+			"error": err.Error(),
+		})
+	}
+}
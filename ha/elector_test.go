@@ -0,0 +1,170 @@
+package ha
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+)
+
+// memoryLeases 多个选举器共用的内存租约存储，行为与 SQLite 实现一致
+type memoryLeases struct {
+	mu     sync.Mutex
+	leases map[string]*model.LeaderLease
+	err    error
+}
+
+func (s *memoryLeases) AcquireLease(name, holder, address string, ttl time.Duration) (*model.LeaderLease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	now := time.Now()
+	current := s.leases[name]
+	if current == nil || current.Holder == holder || !current.ExpiresAt.After(now) {
+		current = &model.LeaderLease{Name: name, Holder: holder, Address: address, ExpiresAt: now.Add(ttl), UpdatedAt: now}
+		s.leases[name] = current
+	}
+	copied := *current
+	return &copied, nil
+}
+
+func (s *memoryLeases) ReleaseLease(name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current := s.leases[name]; current != nil && current.Holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+// expire 使当前租约立即过期，模拟主节点停止续约
+func (s *memoryLeases) expire(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current := s.leases[name]; current != nil {
+		current.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+// taskCounter 记录主节点任务的启动和停止次数
+type taskCounter struct {
+	started, stopped int
+}
+
+func newTestElector(t *testing.T, store LeaseStore, nodeID string, tasks *taskCounter) *Elector {
+	t.Helper()
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	e := New(log, settings.New(log), store)
+	e.nodeID = nodeID
+	e.Run("test", func() error {
+		tasks.started++
+		return nil
+	}, func() {
+		tasks.stopped++
+	})
+	return e
+}
+
+func TestElector(t *testing.T) {
+	const ttl, interval = 3 * time.Second, time.Second
+
+	tests := []struct {
+		name string
+		// run 在 a 已成为主节点、b 为备用实例后执行
+		run          func(store *memoryLeases, a, b *Elector)
+		wantLeaderA  bool
+		wantLeaderB  bool
+		wantStoppedA int
+	}{
+		{
+			name:        "follower does not take a live lease",
+			run:         func(store *memoryLeases, a, b *Elector) {},
+			wantLeaderA: true,
+		},
+		{
+			name: "follower takes over an expired lease and old leader steps down",
+			run: func(store *memoryLeases, a, b *Elector) {
+				store.expire(leaseName)
+				b.campaign(ttl, interval)
+				a.campaign(ttl, interval)
+			},
+			wantLeaderB:  true,
+			wantStoppedA: 1,
+		},
+		{
+			name: "leader keeps running while renewal failures are within the lease",
+			run: func(store *memoryLeases, a, b *Elector) {
+				store.err = errors.New("database is locked")
+				a.campaign(ttl, interval)
+			},
+			wantLeaderA: true,
+		},
+		{
+			name: "leader steps down before the lease expires when renewal keeps failing",
+			run: func(store *memoryLeases, a, b *Elector) {
+				store.err = errors.New("database is locked")
+				a.mu.Lock()
+				a.lastRenew = time.Now().Add(-(ttl - interval))
+				a.mu.Unlock()
+				a.campaign(ttl, interval)
+			},
+			wantStoppedA: 1,
+		},
+		{
+			name: "released lease is taken over immediately",
+			run: func(store *memoryLeases, a, b *Elector) {
+				store.ReleaseLease(leaseName, a.NodeID())
+				b.campaign(ttl, interval)
+				a.campaign(ttl, interval)
+			},
+			wantLeaderB:  true,
+			wantStoppedA: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryLeases{leases: make(map[string]*model.LeaderLease)}
+			var tasksA, tasksB taskCounter
+			a := newTestElector(t, store, "node-a", &tasksA)
+			b := newTestElector(t, store, "node-b", &tasksB)
+
+			a.campaign(ttl, interval)
+			b.campaign(ttl, interval)
+			if !a.IsLeader() || b.IsLeader() {
+				t.Fatalf("initial roles: a leader=%v, b leader=%v", a.IsLeader(), b.IsLeader())
+			}
+			if tasksA.started != 1 || tasksB.started != 0 {
+				t.Fatalf("initial tasks: a started %d, b started %d", tasksA.started, tasksB.started)
+			}
+
+			tt.run(store, a, b)
+
+			if a.IsLeader() != tt.wantLeaderA || b.IsLeader() != tt.wantLeaderB {
+				t.Errorf("roles: a leader=%v, b leader=%v; want %v, %v", a.IsLeader(), b.IsLeader(), tt.wantLeaderA, tt.wantLeaderB)
+			}
+			if a.IsLeader() && b.IsLeader() {
+				t.Error("both instances are leaders")
+			}
+			if tasksA.stopped != tt.wantStoppedA {
+				t.Errorf("a tasks stopped %d times, want %d", tasksA.stopped, tt.wantStoppedA)
+			}
+			wantStartedB := 0
+			if tt.wantLeaderB {
+				wantStartedB = 1
+			}
+			if tasksB.started != wantStartedB {
+				t.Errorf("b tasks started %d times, want %d", tasksB.started, wantStartedB)
+			}
+			if got := b.Status().Leader; tt.wantLeaderA && got != "node-a" {
+				t.Errorf("b sees leader %q, want node-a", got)
+			}
+		})
+	}
+}
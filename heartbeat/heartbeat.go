@@ -0,0 +1,166 @@
+// Package heartbeat 在后台任务成功后请求外部检查地址（healthchecks.io 风格的 dead man's switch），
+// 面板停止运行或任务长时间不成功时由外部服务发出告警，弥补内置告警无法报告自身故障的不足
+package heartbeat
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// 上报心跳的任务
+const (
+	JobBackup    = "backup"
+	JobStats     = "stats"
+	JobScheduler = "scheduler"
+)
+
+// 默认值
+const (
+	defaultMinInterval = time.Minute
+	pingTimeout        = 10 * time.Second
+	// maxFailBody 失败请求附带的错误信息长度上限，healthchecks.io 会显示在事件详情中
+	maxFailBody = 1000
+)
+
+// Pinger 请求外部检查地址，请求在后台进行，不阻塞调用方。
+// nil Pinger 的方法不做任何事，组件可以不设置
+type Pinger struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	client   *http.Client
+
+	mu   sync.Mutex
+	last map[string]time.Time // 按地址记录最近一次成功请求的时间
+}
+
+// New 创建心跳上报器
+func New(log *logger.Logger, settingsMgr *settings.Manager) *Pinger {
+	return &Pinger{
+		log:      log,
+		settings: settingsMgr,
+		client:   &http.Client{Timeout: pingTimeout},
+		last:     make(map[string]time.Time),
+	}
+}
+
+// Success 任务成功完成，同一地址在最小间隔内只请求一次
+func (p *Pinger) Success(job string) {
+	if p == nil {
+		return
+	}
+	cfg, url := p.target(job)
+	if url == "" {
+		return
+	}
+
+	interval := cfg.MinInterval
+	if interval <= 0 {
+		interval = defaultMinInterval
+	}
+	now := time.Now()
+	p.mu.Lock()
+	if last, ok := p.last[url]; ok && now.Sub(last) < interval {
+		p.mu.Unlock()
+		return
+	}
+	p.last[url] = now
+	p.mu.Unlock()
+
+	go p.ping(job, url, "")
+}
+
+// Fail 任务失败，设置了 ReportFail 时请求地址的 /fail 路径，否则等待外部服务超时告警。
+// 不论是否配置了检查地址，都会通知 OnFail 注册的回调
+func (p *Pinger) Fail(job string, err error) {
+	notifyFail(job, err)
+	if p == nil {
+		return
+	}
+	cfg, url := p.target(job)
+	if url == "" || !cfg.ReportFail {
+		return
+	}
+
+	msg := err.Error()
+	if len(msg) > maxFailBody {
+		msg = msg[:maxFailBody]
+	}
+	// 失败后下一次成功立即上报，使外部服务尽快恢复状态
+	p.mu.Lock()
+	delete(p.last, url)
+	p.mu.Unlock()
+
+	go p.ping(job, strings.TrimRight(url, "/")+"/fail", msg)
+}
+
+// FailListener 后台任务失败后的回调。回调同步调用，耗时操作应放到后台
+type FailListener func(job string, err error)
+
+// failListeners 全局的任务失败回调，各组件各自创建 Pinger，回调注册在包级别以覆盖所有实例
+var failListeners struct {
+	sync.RWMutex
+	fns []FailListener
+}
+
+// OnFail 注册后台任务失败的回调，如把失败记入面板的通知中心
+func OnFail(fn FailListener) {
+	failListeners.Lock()
+	defer failListeners.Unlock()
+	failListeners.fns = append(failListeners.fns, fn)
+}
+
+// notifyFail 通知所有回调
+func notifyFail(job string, err error) {
+	failListeners.RLock()
+	fns := failListeners.fns
+	failListeners.RUnlock()
+
+	for _, fn := range fns {
+		fn(job, err)
+	}
+}
+
+// target 返回任务使用的检查地址，未启用或没有地址时返回空字符串
+func (p *Pinger) target(job string) (settings.HeartbeatSettings, string) {
+	cfg := p.settings.Get().Heartbeat
+	if !cfg.Enable {
+		return cfg, ""
+	}
+	var url string
+	switch job {
+	case JobBackup:
+		url = cfg.BackupURL
+	case JobStats:
+		url = cfg.StatsURL
+	case JobScheduler:
+		url = cfg.SchedulerURL
+	}
+	if url == "" {
+		url = cfg.URL
+	}
+	return cfg, url
+}
+
+// ping 发送请求，失败只记录日志，外部服务会在没有收到心跳时告警
+func (p *Pinger) ping(job, url, body string) {
+	resp, err := p.client.Post(url, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		p.log.WarnWithFields("Failed to send heartbeat", logger.Fields{
+			"job":   job,
+			"error": err.Error(),
+		})
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		p.log.WarnWithFields("Heartbeat rejected", logger.Fields{
+			"job":    job,
+			"status": resp.Status,
+		})
+	}
+}
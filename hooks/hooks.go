@@ -0,0 +1,279 @@
+// Package hooks 在面板事件发生时执行管理员配置的本地脚本或请求 HTTP 地址，事件以 JSON 从标准输入
+// 或请求体传入，用于实现面板本身不提供的站点自动化，如用户超限后同步到计费系统
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"v/logger"
+	"v/settings"
+
+	"github.com/google/uuid"
+)
+
+// 事件类型
+const (
+	EventUserQuotaExceeded = "user.quota_exceeded"
+	EventProtocolCreated   = "protocol.created"
+	EventProtocolDeleted   = "protocol.deleted"
+	EventNodeDown          = "node.down"
+	EventNodeUp            = "node.up"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// maxConcurrent 同时执行的事件数量上限，事件突增时其余事件排队，避免同时启动大量进程
+	maxConcurrent = 4
+	// maxOutput 失败时日志中保留的脚本输出或响应内容长度
+	maxOutput = 2048
+	// killDelay 超时后等待脚本子进程关闭输出的时间
+	killDelay = 2 * time.Second
+)
+
+// Event 传给钩子的事件
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// QuotaExceeded user.quota_exceeded 事件数据
+type QuotaExceeded struct {
+	UserID       int64  `json:"user_id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	TrafficLimit int64  `json:"traffic_limit"`
+	TrafficUsed  int64  `json:"traffic_used"`
+}
+
+// ProtocolChange protocol.created 和 protocol.deleted 事件数据，不包含协议凭据
+type ProtocolChange struct {
+	ProtocolID int64  `json:"protocol_id"`
+	UUID       string `json:"uuid,omitempty"`
+	UserID     int64  `json:"user_id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Port       int    `json:"port"`
+	Listen     string `json:"listen,omitempty"`
+}
+
+// NodeState node.down 和 node.up 事件数据，From 为上报探测结果的节点
+type NodeState struct {
+	Node    string  `json:"node"`
+	From    string  `json:"from"`
+	Latency float64 `json:"latency_ms"`
+	Loss    float64 `json:"loss"`
+}
+
+// Runner 按设置执行事件钩子。钩子在后台执行，失败和超时只记录日志，不影响触发事件的操作。
+// nil Runner 的方法不做任何事
+type Runner struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	client   *http.Client
+	slots    chan struct{}
+}
+
+// New 创建钩子执行器
+func New(log *logger.Logger, settingsMgr *settings.Manager) *Runner {
+	return &Runner{
+		log:      log,
+		settings: settingsMgr,
+		client: &http.Client{
+			// 钩子地址由管理员配置，不跟随重定向，避免签名请求被转发到其他地址
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		slots: make(chan struct{}, maxConcurrent),
+	}
+}
+
+// Fire 触发事件，匹配的钩子在后台按配置顺序执行
+func (r *Runner) Fire(typ string, data interface{}) {
+	if r == nil {
+		return
+	}
+	cfg := r.settings.Get().Hooks
+	if !cfg.Enable {
+		return
+	}
+	var matched []settings.Hook
+	for _, hook := range cfg.Hooks {
+		if hook.Enable && Matches(hook.Events, typ) {
+			matched = append(matched, hook)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+
+	event := &Event{
+		ID:   uuid.NewString(),
+		Type: typ,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		r.log.WarnWithFields("Failed to encode hook event", logger.Fields{
+			"event": typ,
+			"error": err.Error(),
+		})
+		return
+	}
+	go r.run(matched, cfg.Timeout, event, body)
+}
+
+// Matches 判断事件是否匹配钩子订阅的事件，支持 * 和 node.* 形式的前缀匹配
+func Matches(patterns []string, typ string) bool {
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "*" || p == typ {
+			return true
+		}
+		if strings.HasSuffix(p, ".*") && strings.HasPrefix(typ, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// run 依次执行匹配的钩子
+func (r *Runner) run(hooks []settings.Hook, timeout time.Duration, event *Event, body []byte) {
+	r.slots <- struct{}{}
+	defer func() { <-r.slots }()
+
+	for _, hook := range hooks {
+		d := hook.Timeout
+		if d <= 0 {
+			d = timeout
+		}
+		if d <= 0 {
+			d = defaultTimeout
+		}
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		var err error
+		if hook.Command != "" {
+			err = r.exec(ctx, hook, event, body)
+		} else {
+			err = r.post(ctx, hook, event, body)
+		}
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %v", d, err)
+		}
+		cancel()
+
+		fields := logger.Fields{
+			"hook":     hook.Name,
+			"event":    event.Type,
+			"event_id": event.ID,
+			"duration": time.Since(start).Round(time.Millisecond).String(),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+			r.log.WarnWithFields("Event hook failed", fields)
+			continue
+		}
+		r.log.DebugWithFields("Event hook finished", fields)
+	}
+}
+
+// exec 执行本地命令，事件从标准输入传入，事件类型和 ID 同时通过环境变量传入
+func (r *Runner) exec(ctx context.Context, hook settings.Hook, event *Event, body []byte) error {
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "V_EVENT="+event.Type, "V_EVENT_ID="+event.ID)
+	cmd.WaitDelay = killDelay
+	out := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		if output := strings.TrimSpace(out.String()); output != "" {
+			return fmt.Errorf("%v: %s", err, output)
+		}
+		return err
+	}
+	return nil
+}
+
+// post 以 POST 发送事件，设置了密钥时在 X-V-Signature 头中附带签名，接收方应校验签名和时间戳
+func (r *Runner) post(ctx context.Context, hook settings.Hook, event *Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "v-hooks")
+	req.Header.Set("X-V-Event", event.Type)
+	req.Header.Set("X-V-Event-ID", event.ID)
+	req.Header.Set("X-V-Timestamp", timestamp)
+	if secret := hook.Secret.String(); secret != "" {
+		req.Header.Set("X-V-Signature", "sha256="+Sign(secret, timestamp, body))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutput))
+		if msg := strings.TrimSpace(string(data)); msg != "" {
+			return fmt.Errorf("unexpected status %s: %s", resp.Status, msg)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxOutput))
+	return nil
+}
+
+// Sign 计算 HTTP 钩子签名的十六进制值：HMAC-SHA256(secret, timestamp + "." + body)
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// limitedBuffer 只保留前 limit 字节的输出，其余丢弃
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+// Write 实现 io.Writer，超出部分丢弃但仍报告写入成功，避免脚本因管道错误退出
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if rest := b.limit - b.buf.Len(); rest > 0 {
+		if len(p) > rest {
+			b.buf.Write(p[:rest])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// String 返回保留的输出
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
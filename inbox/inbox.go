@@ -0,0 +1,245 @@
+// Package inbox 管理后台的通知中心。告警、备份结果、证书续期、版本更新和后台任务失败都保存到
+// notifications 表，带已读状态，邮件或其他渠道未配置时管理员也能在面板中看到
+package inbox
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"v/events"
+	"v/heartbeat"
+	"v/logger"
+	"v/model"
+	"v/notification"
+)
+
+// 通知分类
+const (
+	CategoryAlert       = "alert"
+	CategoryBackup      = "backup"
+	CategoryCertificate = "certificate"
+	CategoryUpdate      = "update"
+	CategoryJob         = "job"
+)
+
+const (
+	// retention 已读通知的保留时间，未读通知一直保留
+	retention = 90 * 24 * time.Hour
+	// pruneInterval 清理已读通知的间隔
+	pruneInterval = 24 * time.Hour
+	// maxBodyLength 通知正文的长度上限
+	maxBodyLength = 4000
+)
+
+// kind 邮件通知类型对应的分类和级别
+type kind struct {
+	category string
+	level    string
+}
+
+// sourceKinds 记入通知中心的邮件通知类型，其余类型（如发给用户的流量提醒）不记录
+var sourceKinds = map[string]kind{
+	"system_alert":             {CategoryAlert, model.NotificationWarning},
+	"system_alert_recovered":   {CategoryAlert, model.NotificationInfo},
+	"test_alert":               {CategoryAlert, model.NotificationInfo},
+	"stale_protocols":          {CategoryAlert, model.NotificationInfo},
+	"backup":                   {CategoryBackup, model.NotificationInfo},
+	"backup_created":           {CategoryBackup, model.NotificationInfo},
+	"backup_restored":          {CategoryBackup, model.NotificationInfo},
+	"backup_deleted":           {CategoryBackup, model.NotificationInfo},
+	"backup_upload_failed":     {CategoryBackup, model.NotificationError},
+	"certificate_warning":      {CategoryCertificate, model.NotificationWarning},
+	"certificate_expiring":     {CategoryCertificate, model.NotificationWarning},
+	"certificate_expired":      {CategoryCertificate, model.NotificationError},
+	"certificate_renewed":      {CategoryCertificate, model.NotificationInfo},
+	"certificate_renew_failed": {CategoryCertificate, model.NotificationError},
+}
+
+// Inbox 通知中心
+type Inbox struct {
+	log    *logger.Logger
+	db     model.DB
+	events *events.History
+	stopCh chan struct{}
+}
+
+// New 创建通知中心
+func New(log *logger.Logger, db model.DB) *Inbox {
+	return &Inbox{
+		log: log,
+		db:  db,
+	}
+}
+
+// SetEvents 设置实时事件历史，新通知同时作为 notification 事件推送，界面可以及时更新未读数
+func (b *Inbox) SetEvents(history *events.History) {
+	b.events = history
+}
+
+// Add 保存一条通知。设置了去重键且已有相同键的通知时跳过，返回 false
+func (b *Inbox) Add(n *model.Notification) (bool, error) {
+	if n.Level == "" {
+		n.Level = model.NotificationInfo
+	}
+	if len(n.Body) > maxBodyLength {
+		n.Body = strings.ToValidUTF8(n.Body[:maxBodyLength], "") + "…"
+	}
+	if n.Key != "" {
+		count, err := b.db.CountNotifications(&model.NotificationQuery{Key: n.Key})
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, nil
+		}
+	}
+	if err := b.db.CreateNotification(n); err != nil {
+		return false, err
+	}
+	if b.events != nil {
+		b.events.PublishQuietly(events.TypeNotification, n)
+	}
+	return true, nil
+}
+
+// AddQuietly 保存一条通知，失败时只记录日志
+func (b *Inbox) AddQuietly(n *model.Notification) {
+	if _, err := b.Add(n); err != nil {
+		b.log.WarnWithFields("Failed to save notification", logger.Fields{
+			"category": n.Category,
+			"source":   n.Source,
+			"error":    err.Error(),
+		})
+	}
+}
+
+// Watch 把之后发送的管理员邮件通知和后台任务失败记入通知中心
+func (b *Inbox) Watch() {
+	notification.OnSend(func(n *notification.Notification) {
+		k, ok := sourceKinds[n.Type]
+		if !ok {
+			return
+		}
+		// 回调在发送通知的调用方中同步执行，写库放到后台
+		go b.AddQuietly(&model.Notification{
+			Category: k.category,
+			Level:    k.level,
+			Title:    n.Subject,
+			Body:     PlainText(n.Body),
+			Source:   n.Type,
+		})
+	})
+	heartbeat.OnFail(b.JobFailed)
+}
+
+// JobFailed 记录后台任务失败
+func (b *Inbox) JobFailed(job string, err error) {
+	go b.AddQuietly(&model.Notification{
+		Category: CategoryJob,
+		Level:    model.NotificationError,
+		Title:    fmt.Sprintf("后台任务 %s 执行失败", job),
+		Body:     err.Error(),
+		Source:   "job_failed",
+	})
+}
+
+// UpdateAvailable 记录组件有可用的新版本，同一版本只记录一次
+func (b *Inbox) UpdateAvailable(component, current, latest string) {
+	go b.AddQuietly(&model.Notification{
+		Category: CategoryUpdate,
+		Level:    model.NotificationInfo,
+		Title:    fmt.Sprintf("%s 有可用更新 %s", component, latest),
+		Body:     fmt.Sprintf("当前版本 %s，可更新到 %s。", current, latest),
+		Source:   "update_available",
+		Key:      "update:" + component + ":" + latest,
+	})
+}
+
+// List 按条件分页获取通知，同时返回符合条件的总数
+func (b *Inbox) List(query *model.NotificationQuery) ([]*model.Notification, int64, error) {
+	items, err := b.db.ListNotifications(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := b.db.CountNotifications(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	if items == nil {
+		items = []*model.Notification{}
+	}
+	return items, total, nil
+}
+
+// UnreadCount 返回未读通知数量
+func (b *Inbox) UnreadCount() (int64, error) {
+	return b.db.CountNotifications(&model.NotificationQuery{Unread: true})
+}
+
+// MarkRead 将指定通知标记为已读，返回更新的数量
+func (b *Inbox) MarkRead(ids []int64) (int64, error) {
+	return b.db.MarkNotificationsRead(ids)
+}
+
+// MarkAllRead 将符合条件的未读通知全部标记为已读，返回更新的数量
+func (b *Inbox) MarkAllRead(query *model.NotificationQuery) (int64, error) {
+	return b.db.MarkAllNotificationsRead(query)
+}
+
+// Start 启动已读通知的定期清理
+func (b *Inbox) Start() {
+	b.stopCh = make(chan struct{})
+	go b.run(b.stopCh)
+}
+
+// Stop 停止定期清理
+func (b *Inbox) Stop() {
+	if b.stopCh != nil {
+		close(b.stopCh)
+		b.stopCh = nil
+	}
+}
+
+// run 清理循环
+func (b *Inbox) run(stopCh chan struct{}) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := b.db.PruneNotifications(time.Now().Add(-retention)); err != nil {
+				b.log.WarnWithFields("Failed to prune notifications", logger.Fields{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
+
+var (
+	// lineBreaks 转为换行的 HTML 标签
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	// tags 其余 HTML 标签
+	tags = regexp.MustCompile(`<[^>]*>`)
+)
+
+// PlainText 将邮件通知的 HTML 正文转为纯文本，去掉空行和行首尾空白
+func PlainText(body string) string {
+	text := lineBreaks.ReplaceAllString(body, "\n")
+	text = html.UnescapeString(tags.ReplaceAllString(text, ""))
+
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,403 @@
+// Package loadtest 对独立的测试实例做压力和长时间稳定性测试：
+// 模拟用户拉取订阅、统计数据定时写入和管理员并发操作，报告各类操作的延迟分位数和数据库争用情况
+package loadtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"v/api"
+	"v/logger"
+	"v/model"
+	"v/protocol"
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 操作名称，与报告中的行对应
+const (
+	OpSubscription = "subscription_fetch"
+	OpStatsFlush   = "stats_flush"
+	OpAdminList    = "admin_list_users"
+	OpAdminUpdate  = "admin_update_user"
+	OpAdminTraffic = "admin_user_traffic"
+)
+
+// statsFlushBatch 每次统计写入包含的用户数，与采集器一次刷新的规模相当
+const statsFlushBatch = 50
+
+// Config 压测参数
+type Config struct {
+	Users       int           // 模拟拉取订阅的用户数，每个用户一个并发连接
+	FetchDelay  time.Duration // 每个用户两次拉取之间的间隔，0 表示不间断拉取
+	StatsRate   int           // 每秒统计写入次数
+	Admins      int           // 并发执行管理操作的管理员数
+	Duration    time.Duration // 压测时长
+	DBPath      string        // 测试实例的数据库路径，为空时在临时目录新建，结束后删除
+	HTTPTimeout time.Duration // 单次订阅请求超时
+}
+
+// Runner 压测执行器
+type Runner struct {
+	log *logger.Logger
+	cfg Config
+
+	db      model.DB
+	server  *httptest.Server
+	client  *http.Client
+	tokens  []string
+	userIDs []int64
+
+	recorders map[string]*recorder
+	overruns  int64 // 上一次统计写入未完成而跳过的次数
+}
+
+// New 创建压测执行器
+func New(log *logger.Logger, cfg Config) *Runner {
+	if cfg.Users <= 0 {
+		cfg.Users = 100
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = 30 * time.Second
+	}
+	if cfg.HTTPTimeout <= 0 {
+		cfg.HTTPTimeout = 10 * time.Second
+	}
+	r := &Runner{
+		log:       log,
+		cfg:       cfg,
+		recorders: make(map[string]*recorder),
+	}
+	for _, op := range []string{OpSubscription, OpStatsFlush, OpAdminList, OpAdminUpdate, OpAdminTraffic} {
+		r.recorders[op] = &recorder{}
+	}
+	return r
+}
+
+// Run 准备测试实例并执行压测，ctx 取消时提前结束并返回已收集的结果
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	dbPath := r.cfg.DBPath
+	if dbPath == "" {
+		dir, err := os.MkdirTemp("", "v-loadtest-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		dbPath = filepath.Join(dir, "loadtest.db")
+	}
+
+	db, err := model.OpenDB(dbPath, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	r.db = db
+
+	if err := r.seed(); err != nil {
+		return nil, fmt.Errorf("failed to seed test data: %v", err)
+	}
+	r.startServer()
+	defer r.server.Close()
+
+	r.log.Info("Load test started", logger.Fields{
+		"users":      r.cfg.Users,
+		"stats_rate": r.cfg.StatsRate,
+		"admins":     r.cfg.Admins,
+		"duration":   r.cfg.Duration.String(),
+		"database":   dbPath,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Duration)
+	defer cancel()
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < len(r.tokens); i++ {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			r.fetchLoop(ctx, token)
+		}(r.tokens[i])
+	}
+	for i := 0; i < r.cfg.Admins; i++ {
+		wg.Add(1)
+		go func(admin int) {
+			defer wg.Done()
+			r.adminLoop(ctx, admin)
+		}(i)
+	}
+	if r.cfg.StatsRate > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.statsLoop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return r.report(time.Since(started)), nil
+}
+
+// seed 创建用户、协议和订阅
+func (r *Runner) seed() error {
+	for i := 0; i < r.cfg.Users; i++ {
+		user := &model.User{
+			Username: fmt.Sprintf("loadtest-%d", i),
+			Email:    fmt.Sprintf("loadtest-%d@example.com", i),
+			Role:     "user",
+			Status:   "active",
+			Enabled:  true,
+		}
+		if err := r.db.CreateUser(user); err != nil {
+			return err
+		}
+
+		settingsJSON, err := json.Marshal(&model.VMessSettings{
+			UUID:    user.UUID,
+			Network: "ws",
+			Host:    "loadtest.example.com",
+			Path:    "/ws",
+			TLS:     true,
+		})
+		if err != nil {
+			return err
+		}
+		if err := r.db.CreateProtocol(&model.Protocol{
+			UserID:   user.ID,
+			Type:     string(model.ProtocolVMess),
+			Name:     user.Username,
+			Port:     20000 + i%40000,
+			Settings: settingsJSON,
+			Enable:   true,
+		}); err != nil {
+			return err
+		}
+
+		token, err := randomToken()
+		if err != nil {
+			return err
+		}
+		if err := r.db.SaveSubscription(&model.Subscription{UserID: user.ID, Token: token}); err != nil {
+			return err
+		}
+		r.tokens = append(r.tokens, token)
+		r.userIDs = append(r.userIDs, user.ID)
+	}
+	return nil
+}
+
+// startServer 启动只包含订阅接口的测试实例，订阅请求经过完整的 HTTP 栈
+func (r *Runner) startServer() {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	settingsMgr := settings.New(r.log)
+	protocols := protocol.NewProtocolManager(r.log, settingsMgr, r.db)
+	api.NewSubscriptionHandler(r.log, settingsMgr, r.db, protocols, nil, nil).RegisterRoutes(engine.Group("/api"))
+
+	r.server = httptest.NewServer(engine)
+	r.client = &http.Client{
+		Timeout: r.cfg.HTTPTimeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        r.cfg.Users,
+			MaxIdleConnsPerHost: r.cfg.Users,
+		},
+	}
+}
+
+// fetchLoop 模拟一个用户反复拉取订阅
+func (r *Runner) fetchLoop(ctx context.Context, token string) {
+	url := r.server.URL + "/api/sub/" + token
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := r.fetch(ctx, url)
+		if ctx.Err() != nil {
+			return
+		}
+		r.recorders[OpSubscription].observe(time.Since(start), err)
+
+		if r.cfg.FetchDelay > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.cfg.FetchDelay):
+			}
+		}
+	}
+}
+
+// fetch 拉取一次订阅并读完响应体
+func (r *Runner) fetch(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// statsLoop 按设定频率写入统计，上一次写入未完成时跳过并记为超时
+func (r *Runner) statsLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second / time.Duration(r.cfg.StatsRate))
+	defer ticker.Stop()
+
+	// 同时进行的写入不超过每秒次数，超出说明写入跟不上
+	inflight := make(chan struct{}, r.cfg.StatsRate)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	offset := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		select {
+		case inflight <- struct{}{}:
+		default:
+			atomic.AddInt64(&r.overruns, 1)
+			continue
+		}
+
+		batch := r.nextBatch(offset)
+		offset += len(batch)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inflight }()
+			start := time.Now()
+			err := r.flushStats(batch)
+			r.recorders[OpStatsFlush].observe(time.Since(start), err)
+		}()
+	}
+}
+
+// nextBatch 从 offset 开始轮流选取一批用户
+func (r *Runner) nextBatch(offset int) []int64 {
+	n := statsFlushBatch
+	if n > len(r.userIDs) {
+		n = len(r.userIDs)
+	}
+	batch := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		batch = append(batch, r.userIDs[(offset+i)%len(r.userIDs)])
+	}
+	return batch
+}
+
+// flushStats 为一批用户写入流量记录，与采集器刷新时的写入方式相同
+func (r *Runner) flushStats(batch []int64) error {
+	for _, userID := range batch {
+		if err := r.db.CreateTrafficRecord(&model.Traffic{
+			UserID: userID,
+			Up:     4096,
+			Down:   65536,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adminLoop 模拟管理员在面板中轮流浏览用户列表、修改用户和查看用户流量
+func (r *Runner) adminLoop(ctx context.Context, admin int) {
+	for i := admin; ctx.Err() == nil; i++ {
+		userID := r.userIDs[i%len(r.userIDs)]
+		op := []string{OpAdminList, OpAdminUpdate, OpAdminTraffic}[i%3]
+
+		start := time.Now()
+		var err error
+		switch op {
+		case OpAdminList:
+			_, err = r.db.ListUsers(1+i%10, 20)
+		case OpAdminUpdate:
+			err = r.updateUser(userID, i)
+		case OpAdminTraffic:
+			_, err = r.db.GetTrafficStats(userID)
+		}
+		r.recorders[op].observe(time.Since(start), err)
+	}
+}
+
+// updateUser 读取并修改用户备注
+func (r *Runner) updateUser(userID int64, n int) error {
+	user, err := r.db.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %d not found", userID)
+	}
+	user.Remark = fmt.Sprintf("loadtest update %d", n)
+	return r.db.UpdateUser(user)
+}
+
+// report 汇总结果
+func (r *Runner) report(elapsed time.Duration) *Report {
+	report := &Report{
+		Config:   r.cfg,
+		Duration: elapsed,
+	}
+	for _, op := range []string{OpSubscription, OpStatsFlush, OpAdminList, OpAdminUpdate, OpAdminTraffic} {
+		if stats := r.recorders[op].summary(op, elapsed); stats.Count > 0 || stats.Errors > 0 {
+			report.Operations = append(report.Operations, stats)
+		}
+	}
+
+	for _, rec := range r.recorders {
+		report.Contention.LockErrors += atomic.LoadInt64(&rec.lockErrors)
+	}
+	report.Contention.StatsOverruns = atomic.LoadInt64(&r.overruns)
+	if pool, ok := r.db.(interface{ PoolStats() sql.DBStats }); ok {
+		stats := pool.PoolStats()
+		report.Contention.PoolWaits = stats.WaitCount
+		report.Contention.PoolWaitTime = stats.WaitDuration
+		report.Contention.MaxOpenConns = stats.MaxOpenConnections
+	}
+	return report
+}
+
+// isLockError 判断是否为 SQLite 锁冲突
+func isLockError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "SQLITE_BUSY")
+}
+
+// randomToken 生成订阅令牌
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,134 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// OpStats 一类操作的统计
+type OpStats struct {
+	Name   string        `json:"name"`
+	Count  int           `json:"count"`
+	Errors int64         `json:"errors"`
+	Rate   float64       `json:"rate"` // 每秒成功次数
+	P50    time.Duration `json:"p50"`
+	P90    time.Duration `json:"p90"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+}
+
+// Contention 数据库争用情况
+type Contention struct {
+	LockErrors    int64         `json:"lock_errors"`    // SQLite 返回 database is locked 的次数
+	PoolWaits     int64         `json:"pool_waits"`     // 等待空闲连接的次数
+	PoolWaitTime  time.Duration `json:"pool_wait_time"` // 等待空闲连接的总时间
+	MaxOpenConns  int           `json:"max_open_conns"`
+	StatsOverruns int64         `json:"stats_overruns"` // 统计写入跟不上设定频率而跳过的次数
+}
+
+// Report 压测结果
+type Report struct {
+	Config     Config        `json:"config"`
+	Duration   time.Duration `json:"duration"`
+	Operations []*OpStats    `json:"operations"`
+	Contention Contention    `json:"contention"`
+}
+
+// ErrorCount 所有操作的失败次数
+func (r *Report) ErrorCount() int64 {
+	var n int64
+	for _, op := range r.Operations {
+		n += op.Errors
+	}
+	return n
+}
+
+// Print 以表格形式输出结果
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "duration: %s, users: %d, stats flushes/s: %d, admins: %d\n\n",
+		r.Duration.Round(time.Millisecond), r.Config.Users, r.Config.StatsRate, r.Config.Admins)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tCOUNT\tERRORS\tRATE/S\tP50\tP90\tP99\tMAX")
+	for _, op := range r.Operations {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\n", op.Name, op.Count, op.Errors, op.Rate,
+			roundLatency(op.P50), roundLatency(op.P90), roundLatency(op.P99), roundLatency(op.Max))
+	}
+	tw.Flush()
+
+	c := r.Contention
+	fmt.Fprintf(w, "\ndb lock errors: %d, pool waits: %d (%s), max open conns: %d, stats overruns: %d\n",
+		c.LockErrors, c.PoolWaits, c.PoolWaitTime.Round(time.Millisecond), c.MaxOpenConns, c.StatsOverruns)
+}
+
+// roundLatency 按量级保留精度
+func roundLatency(d time.Duration) time.Duration {
+	if d >= 10*time.Millisecond {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// recorder 记录一类操作的耗时，成功的操作才计入延迟分布
+type recorder struct {
+	mu         sync.Mutex
+	samples    []time.Duration
+	errors     int64
+	lockErrors int64
+}
+
+// observe 记录一次操作
+func (r *recorder) observe(d time.Duration, err error) {
+	if err != nil {
+		atomic.AddInt64(&r.errors, 1)
+		if isLockError(err) {
+			atomic.AddInt64(&r.lockErrors, 1)
+		}
+		return
+	}
+	r.mu.Lock()
+	r.samples = append(r.samples, d)
+	r.mu.Unlock()
+}
+
+// summary 计算分位数
+func (r *recorder) summary(name string, elapsed time.Duration) *OpStats {
+	r.mu.Lock()
+	samples := append([]time.Duration(nil), r.samples...)
+	r.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	stats := &OpStats{
+		Name:   name,
+		Count:  len(samples),
+		Errors: atomic.LoadInt64(&r.errors),
+	}
+	if len(samples) == 0 {
+		return stats
+	}
+	if elapsed > 0 {
+		stats.Rate = float64(len(samples)) / elapsed.Seconds()
+	}
+	stats.P50 = percentile(samples, 0.50)
+	stats.P90 = percentile(samples, 0.90)
+	stats.P99 = percentile(samples, 0.99)
+	stats.Max = samples[len(samples)-1]
+	return stats
+}
+
+// percentile 返回已排序样本的分位数（最近秩法）
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
@@ -8,6 +8,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"testing"
+	"time"
+
+	"v/utils"
 )
 
 // LogLevel 日志级别
@@ -44,6 +48,24 @@ func (l LogLevel) String() string {
 	}
 }
 
+// ParseLevel 解析 debug、info、warn、error、fatal 形式的日志级别，不区分大小写
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warn", "warning":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	case "fatal":
+		return FATAL, nil
+	default:
+		return INFO, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
 // Configuration 日志配置
 type Configuration struct {
 	// Level 日志级别
@@ -68,21 +90,24 @@ type Logger struct {
 	config     Configuration
 	writer     io.Writer
 	fileWriter *RotateWriter
+	recent     *recentLines
 }
 
-// NewLogger creates a new logger instance with default configuration
+// NewLogger creates a new logger instance with default configuration.
+// 在 go test 中不写日志文件，避免包级别的日志在各包目录下生成 logs/app.log
 func NewLogger() *Logger {
 	return NewLoggerWithConfig(Configuration{
 		Level:    INFO,
 		Console:  true,
-		File:     true,
+		File:     !testing.Testing(),
 		FilePath: filepath.Join("logs", "app.log"),
 		Rotation: RotationConfig{
-			MaxSize:    50,
-			MaxAge:     7,
-			MaxBackups: 10,
-			LocalTime:  true,
-			Compress:   true,
+			MaxSize:      50,
+			MaxAge:       7,
+			MaxBackups:   10,
+			LocalTime:    true,
+			Compress:     true,
+			MinFreeSpace: utils.MinFreeDiskBytes(0),
 		},
 	})
 }
@@ -124,12 +149,12 @@ func NewLoggerWithConfig(config Configuration) *Logger {
 		}
 	}
 
-	// 创建多写入器
-	if len(writers) > 0 {
-		writer = NewMultiWriter(writers...)
-	} else {
-		writer = os.Stdout
+	// 保留最近的日志行，崩溃报告时附带
+	if len(writers) == 0 {
+		writers = append(writers, os.Stdout)
 	}
+	recent := newRecentLines(recentCapacity)
+	writer = NewMultiWriter(append([]io.Writer{recent}, writers...)...)
 
 	return &Logger{
 		logger:     log.New(writer, "", log.LstdFlags),
@@ -137,6 +162,7 @@ func NewLoggerWithConfig(config Configuration) *Logger {
 		config:     config,
 		writer:     writer,
 		fileWriter: fileWriter,
+		recent:     recent,
 	}
 }
 
@@ -145,14 +171,48 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
+// SetMinFreeSpace 修改日志文件所在磁盘的最小保留空间（字节），0 表示不检查。
+// 日志在设置加载前创建，加载后由调用方按监控设置更新
+func (l *Logger) SetMinFreeSpace(bytes uint64) {
+	if l.fileWriter != nil {
+		l.fileWriter.SetMinFreeSpace(bytes)
+	}
+}
+
 // log 记录日志（内部方法）
 func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
 	if level < l.level {
 		return
 	}
 
+	// 格式化消息，以参数传入的字段同样处理客户端 IP
+	var message string
+	if len(args) > 0 {
+		for i, arg := range args {
+			if fields, ok := arg.(Fields); ok {
+				args[i] = filterFields(fields)
+			}
+		}
+		message = fmt.Sprintf(format, args...)
+	} else {
+		message = format
+	}
+
+	l.output(level, message, nil)
+}
+
+// logFields 记录带字段的日志（内部方法）
+func (l *Logger) logFields(level LogLevel, message string, fields Fields) {
+	if level < l.level {
+		return
+	}
+	l.output(level, message, filterFields(fields))
+}
+
+// output 写入日志并交给外发目标。调用层级固定为：调用方 -> Info 等 -> log 或 logFields -> output
+func (l *Logger) output(level LogLevel, message string, fields Fields) {
 	// 获取调用堆栈
-	pc, file, line, ok := runtime.Caller(2)
+	pc, file, line, ok := runtime.Caller(3)
 	if !ok {
 		file = "???"
 		line = 0
@@ -172,16 +232,33 @@ func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
 	// 只保留文件名，不包含路径
 	filename := filepath.Base(file)
 
-	// 格式化消息
-	var message string
-	if len(args) > 0 {
-		message = fmt.Sprintf(format, args...)
-	} else {
-		message = format
+	// 格式化字段
+	text := message
+	var shipped map[string]string
+	if len(fields) > 0 {
+		shipped = make(map[string]string, len(fields))
+		fieldParts := make([]string, 0, len(fields))
+		for k, v := range fields {
+			value := fmt.Sprintf("%v", v)
+			shipped[k] = value
+			fieldParts = append(fieldParts, k+"="+value)
+		}
+		text += " " + strings.Join(fieldParts, " ")
 	}
 
 	// 记录日志
-	l.logger.Printf("[%s] %s:%d %s() %s", level.String(), filename, line, funcName, message)
+	l.logger.Printf("[%s] %s:%d %s() %s", level.String(), filename, line, funcName, text)
+
+	Ship(&Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Source:  SourcePanel,
+		File:    filename,
+		Line:    line,
+		Func:    funcName,
+		Message: message,
+		Fields:  shipped,
+	})
 }
 
 // Debug logs a debug message
@@ -207,71 +284,36 @@ func (l *Logger) Error(format string, args ...interface{}) {
 // Fatal logs a fatal message and exits
 func (l *Logger) Fatal(format string, args ...interface{}) {
 	l.log(FATAL, format, args...)
+	flushShipper(fatalFlushTimeout)
 	os.Exit(1)
 }
 
 // WithFields logs a message with fields
 func (l *Logger) WithFields(message string, fields Fields) {
-	// 格式化字段
-	var fieldString string
-	if len(fields) > 0 {
-		fieldParts := make([]string, 0, len(fields))
-		for k, v := range fields {
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%v", k, v))
-		}
-		fieldString = " " + strings.Join(fieldParts, " ")
-	}
-
-	// 记录日志
-	l.Info("%s%s", message, fieldString)
+	l.logFields(INFO, message, fields)
 }
 
 // DebugWithFields logs a debug message with fields
 func (l *Logger) DebugWithFields(message string, fields Fields) {
-	// 格式化字段
-	var fieldString string
-	if len(fields) > 0 {
-		fieldParts := make([]string, 0, len(fields))
-		for k, v := range fields {
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%v", k, v))
-		}
-		fieldString = " " + strings.Join(fieldParts, " ")
-	}
-
-	// 记录日志
-	l.Debug("%s%s", message, fieldString)
+	l.logFields(DEBUG, message, fields)
 }
 
 // ErrorWithFields logs an error message with fields
 func (l *Logger) ErrorWithFields(message string, fields Fields) {
-	// 格式化字段
-	var fieldString string
-	if len(fields) > 0 {
-		fieldParts := make([]string, 0, len(fields))
-		for k, v := range fields {
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%v", k, v))
-		}
-		fieldString = " " + strings.Join(fieldParts, " ")
-	}
-
-	// 记录日志
-	l.Error("%s%s", message, fieldString)
+	l.logFields(ERROR, message, fields)
 }
 
 // WarnWithFields logs a warning message with fields
 func (l *Logger) WarnWithFields(message string, fields Fields) {
-	// 格式化字段
-	var fieldString string
-	if len(fields) > 0 {
-		fieldParts := make([]string, 0, len(fields))
-		for k, v := range fields {
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%v", k, v))
-		}
-		fieldString = " " + strings.Join(fieldParts, " ")
-	}
+	l.logFields(WARN, message, fields)
+}
 
-	// 记录日志
-	l.Warn("%s%s", message, fieldString)
+// Recent 返回最近记录的 n 行日志，n 不大于 0 时返回全部保留的日志
+func (l *Logger) Recent(n int) []string {
+	if l.recent == nil {
+		return nil
+	}
+	return l.recent.last(n)
 }
 
 // Close closes the logger
@@ -291,3 +333,11 @@ func (l *Logger) Start() error {
 func (l *Logger) Stop() error {
 	return l.Close()
 }
+
+// FilePath 返回日志文件路径，未输出到文件时返回空字符串
+func (l *Logger) FilePath() string {
+	if l.fileWriter == nil {
+		return ""
+	}
+	return l.config.FilePath
+}
@@ -76,7 +76,7 @@ func (m *Manager) Log(level, module, message string, details interface{}, userID
 		Details:   string(detailsJSON),
 		UserID:    userID,
 		Username:  username,
-		IP:        ip,
+		IP:        FilterIP(ip),
 		UserAgent: userAgent,
 	}
 
@@ -0,0 +1,75 @@
+package logger
+
+import "sync/atomic"
+
+// ipFieldNames 记录客户端 IP 的日志字段
+var ipFieldNames = map[string]bool{
+	"ip":          true,
+	"client_ip":   true,
+	"remote_addr": true,
+	"source_ip":   true,
+}
+
+// ipFilter 写入日志前对客户端 IP 的处理
+var ipFilter atomic.Pointer[func(string) string]
+
+// SetIPFilter 设置写入日志前对客户端 IP 字段的处理（如匿名化），nil 表示原样写入
+func SetIPFilter(fn func(string) string) {
+	if fn == nil {
+		ipFilter.Store(nil)
+		return
+	}
+	ipFilter.Store(&fn)
+}
+
+// IPFieldNames 返回记录客户端 IP 的日志字段名
+func IPFieldNames() []string {
+	names := make([]string, 0, len(ipFieldNames))
+	for name := range ipFieldNames {
+		names = append(names, name)
+	}
+	return names
+}
+
+// FilterIP 按 SetIPFilter 设置的处理转换客户端 IP
+func FilterIP(ip string) string {
+	if fn := ipFilter.Load(); fn != nil && ip != "" {
+		return (*fn)(ip)
+	}
+	return ip
+}
+
+// filterField 字段记录客户端 IP 时按设置处理
+func filterField(key string, value interface{}) interface{} {
+	if !ipFieldNames[key] {
+		return value
+	}
+	if ip, ok := value.(string); ok {
+		return FilterIP(ip)
+	}
+	return value
+}
+
+// filterFields 返回处理过客户端 IP 字段的副本，没有需要处理的字段时返回原值
+func filterFields(fields Fields) Fields {
+	if ipFilter.Load() == nil {
+		return fields
+	}
+	var filtered Fields
+	for key, value := range fields {
+		if !ipFieldNames[key] {
+			continue
+		}
+		if filtered == nil {
+			filtered = make(Fields, len(fields))
+			for k, v := range fields {
+				filtered[k] = v
+			}
+		}
+		filtered[key] = filterField(key, value)
+	}
+	if filtered == nil {
+		return fields
+	}
+	return filtered
+}
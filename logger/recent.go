@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+)
+
+// recentCapacity 内存中保留的最近日志行数
+const recentCapacity = 500
+
+// recentLines 保存最近写入的日志行，用于崩溃报告
+type recentLines struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// newRecentLines 创建最近日志记录
+func newRecentLines(capacity int) *recentLines {
+	return &recentLines{lines: make([]string, capacity)}
+}
+
+// Write 实现io.Writer接口
+func (r *recentLines) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		r.lines[r.next] = line
+		r.next = (r.next + 1) % len(r.lines)
+		if r.next == 0 {
+			r.full = true
+		}
+	}
+	return len(p), nil
+}
+
+// last 返回最近的 n 行日志，按写入顺序排列
+func (r *recentLines) last(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.lines)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	out := make([]string, 0, n)
+	for i := n; i > 0; i-- {
+		out = append(out, r.lines[(r.next-i+len(r.lines))%len(r.lines)])
+	}
+	return out
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"sync"
 	"time"
+
+	"v/utils"
 )
 
 // RotationConfig 日志轮转配置
@@ -21,6 +23,8 @@ type RotationConfig struct {
 	LocalTime bool `json:"local_time"`
 	// Compress 是否压缩
 	Compress bool `json:"compress"`
+	// MinFreeSpace 磁盘最小保留空间（字节），低于该值时停止轮转，继续写入当前文件
+	MinFreeSpace uint64 `json:"min_free_space"`
 }
 
 // RotateWriter 旋转日志写入器
@@ -32,6 +36,8 @@ type RotateWriter struct {
 	mu         sync.Mutex
 	startTime  time.Time
 	lastRotate time.Time
+	lastCheck  time.Time
+	lowSpace   bool
 }
 
 // NewRotateWriter 创建旋转日志写入器
@@ -86,8 +92,8 @@ func (w *RotateWriter) Write(p []byte) (n int, err error) {
 	// 更新大小
 	w.size += int64(n)
 
-	// 检查是否需要轮转
-	if w.shouldRotate() {
+	// 检查是否需要轮转，磁盘空间不足时暂缓轮转，继续写入当前文件
+	if w.shouldRotate() && !w.lowDiskSpace() {
 		if err := w.rotate(); err != nil {
 			return n, err
 		}
@@ -96,6 +102,16 @@ func (w *RotateWriter) Write(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// SetMinFreeSpace 修改磁盘最小保留空间（字节），下一次轮转时重新检查
+func (w *RotateWriter) SetMinFreeSpace(bytes uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.config.MinFreeSpace = bytes
+	w.lastCheck = time.Time{}
+	w.lowSpace = false
+}
+
 // Close 关闭日志文件
 func (w *RotateWriter) Close() error {
 	w.mu.Lock()
@@ -104,6 +120,19 @@ func (w *RotateWriter) Close() error {
 	return w.file.Close()
 }
 
+// lowDiskSpace 检查磁盘可用空间是否低于保留值，结果缓存一段时间以避免频繁查询
+func (w *RotateWriter) lowDiskSpace() bool {
+	if w.config.MinFreeSpace == 0 {
+		return false
+	}
+
+	if time.Since(w.lastCheck) >= 30*time.Second {
+		w.lastCheck = time.Now()
+		w.lowSpace = utils.CheckDiskSpace(filepath.Dir(w.filename), 0, w.config.MinFreeSpace) != nil
+	}
+	return w.lowSpace
+}
+
 // shouldRotate 检查是否需要轮转
 func (w *RotateWriter) shouldRotate() bool {
 	// 检查文件大小
@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 日志来源
+const (
+	SourcePanel = "panel"
+	SourceXray  = "xray"
+)
+
+// fatalFlushTimeout 致命错误退出前等待外发日志发送完成的时间
+const fatalFlushTimeout = 2 * time.Second
+
+// Entry 一条外发的日志，字段保持结构化
+type Entry struct {
+	Time    time.Time
+	Level   LogLevel
+	Source  string // 日志来源：panel 或 xray
+	File    string // 调用位置的文件名，Xray 日志为空
+	Line    int
+	Func    string // 调用函数，Xray 日志为空
+	Message string
+	Fields  map[string]string // 格式化后的字段，已按 SetIPFilter 处理客户端 IP
+}
+
+// Shipper 日志外发目标，Ship 不能阻塞
+type Shipper interface {
+	Ship(entry *Entry)
+	// Flush 等待已接收的日志发送完成，最多等待 timeout
+	Flush(timeout time.Duration)
+}
+
+// shipper 当前的日志外发目标
+var shipper atomic.Pointer[Shipper]
+
+// SetShipper 设置日志外发目标，所有 Logger 写入的日志同时交给它，nil 表示不外发
+func SetShipper(s Shipper) {
+	if s == nil {
+		shipper.Store(nil)
+		return
+	}
+	shipper.Store(&s)
+}
+
+// Ship 将日志交给外发目标，未设置时忽略。用于转发 Xray 等外部进程的输出
+func Ship(entry *Entry) {
+	if s := shipper.Load(); s != nil {
+		(*s).Ship(entry)
+	}
+}
+
+// flushShipper 等待外发目标发送完已接收的日志
+func flushShipper(timeout time.Duration) {
+	if s := shipper.Load(); s != nil {
+		(*s).Flush(timeout)
+	}
+}
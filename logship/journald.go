@@ -0,0 +1,131 @@
+package logship
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+
+	"v/logger"
+)
+
+const (
+	// journalSocket journald 接收原生协议日志的套接字
+	journalSocket = "/run/systemd/journal/socket"
+	// maxJournalMessage 单条日志消息的最大长度，超出部分截断，保证数据报不超过系统限制
+	maxJournalMessage = 32 * 1024
+	// maxJournalValue 单个字段值的最大长度
+	maxJournalValue = 4 * 1024
+	// journalFieldPrefix 与 journald 保留字段冲突或不合法的字段名前缀
+	journalFieldPrefix = "V_"
+)
+
+// journalReserved 外发器自己写入的字段，日志字段同名时加前缀
+var journalReserved = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// journaldSink 使用 journald 原生协议发送，日志字段作为独立的结构化字段保存
+type journaldSink struct {
+	appName string
+	conn    *net.UnixConn
+}
+
+// newJournaldSink 创建 journald 发送目标
+func newJournaldSink(appName string) *journaldSink {
+	return &journaldSink{appName: appName}
+}
+
+// send 发送一条日志，连接失败时下次发送重新连接
+func (j *journaldSink) send(entry *logger.Entry) error {
+	if j.conn == nil {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		j.conn = conn
+	}
+
+	if _, err := j.conn.Write(j.encode(entry)); err != nil {
+		j.conn.Close()
+		j.conn = nil
+		return err
+	}
+	return nil
+}
+
+// close 关闭连接
+func (j *journaldSink) close() error {
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+// encode 按 journald 原生协议编码：每行 NAME=value，值包含换行时使用 NAME\n<64 位小端长度>value\n
+func (j *journaldSink) encode(entry *logger.Entry) []byte {
+	var buf bytes.Buffer
+	message := entry.Message
+	if len(message) > maxJournalMessage {
+		message = strings.ToValidUTF8(message[:maxJournalMessage], "")
+	}
+	writeJournalField(&buf, "MESSAGE", message)
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(severity(entry.Level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", identifier(entry, j.appName))
+	if entry.File != "" {
+		writeJournalField(&buf, "CODE_FILE", entry.File)
+		writeJournalField(&buf, "CODE_LINE", strconv.Itoa(entry.Line))
+		writeJournalField(&buf, "CODE_FUNC", entry.Func)
+	}
+	for k, v := range entry.Fields {
+		if len(v) > maxJournalValue {
+			v = strings.ToValidUTF8(v[:maxJournalValue], "")
+		}
+		writeJournalField(&buf, journalFieldName(k), v)
+	}
+	return buf.Bytes()
+}
+
+// writeJournalField 写入一个字段
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName 将日志字段名转为 journald 字段名：大写字母、数字和下划线，不能以下划线或数字开头
+func journalFieldName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+	if name == "" || name[0] == '_' || (name[0] >= '0' && name[0] <= '9') || journalReserved[name] {
+		name = journalFieldPrefix + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
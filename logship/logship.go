@@ -0,0 +1,319 @@
+// Package logship 将面板和 Xray 的日志外发到远程 syslog 服务器（RFC 5424，UDP、TCP 或 TLS）或本机 journald，
+// 主机被入侵或磁盘损坏后日志仍保留在外部，也便于接入已有的 SIEM
+package logship
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+const (
+	// queueSize 等待发送的日志条数，发送跟不上时丢弃新日志
+	queueSize = 4096
+	// minRetryDelay 发送失败后的首次重试间隔
+	minRetryDelay = time.Second
+	// maxRetryDelay 发送失败后的最长重试间隔
+	maxRetryDelay = time.Minute
+	// drainTimeout 停止时发送剩余日志的最长时间
+	drainTimeout = 2 * time.Second
+	// defaultAppName 未配置时的 syslog APP-NAME 和 journald SYSLOG_IDENTIFIER
+	defaultAppName = "v"
+)
+
+// sink 日志发送目标，只在发送协程中调用
+type sink interface {
+	send(entry *logger.Entry) error
+	close() error
+}
+
+// config 日志外发相关的设置
+type config struct {
+	target   string
+	level    string
+	xray     bool
+	address  string
+	network  string
+	facility string
+	appName  string
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+// configOf 提取日志外发相关的设置
+func configOf(s settings.LogSettings) config {
+	return config{
+		target:   s.ShipTarget,
+		level:    s.ShipLevel,
+		xray:     s.ShipXray,
+		address:  s.SyslogAddress,
+		network:  s.SyslogNetwork,
+		facility: s.SyslogFacility,
+		appName:  s.SyslogAppName,
+		caFile:   s.SyslogCAFile,
+		certFile: s.SyslogCertFile,
+		keyFile:  s.SyslogKeyFile,
+	}
+}
+
+// state 一次启动的外发状态，设置变更后整体替换
+type state struct {
+	cfg     config
+	level   logger.LogLevel
+	queue   chan *logger.Entry
+	pending atomic.Int64
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// Shipper 按日志设置外发日志，实现 logger.Shipper
+type Shipper struct {
+	log      *logger.Logger
+	settings *settings.Manager
+
+	mu      sync.Mutex // 串行化启动和停止
+	state   atomic.Pointer[state]
+	dropped atomic.Int64
+}
+
+// New 创建日志外发器
+func New(log *logger.Logger, settingsMgr *settings.Manager) *Shipper {
+	return &Shipper{
+		log:      log,
+		settings: settingsMgr,
+	}
+}
+
+// Start 按当前设置开始外发，未配置外发目标时不启动
+func (s *Shipper) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start()
+}
+
+// start 启动外发，调用方持有 mu
+func (s *Shipper) start() error {
+	if s.state.Load() != nil {
+		return nil
+	}
+	cfg := configOf(s.settings.Get().Log)
+	if cfg.target == "" {
+		return nil
+	}
+
+	out, err := newSink(cfg)
+	if err != nil {
+		return err
+	}
+	level := logger.INFO
+	if cfg.level != "" {
+		if level, err = logger.ParseLevel(cfg.level); err != nil {
+			return err
+		}
+	}
+
+	st := &state{
+		cfg:    cfg,
+		level:  level,
+		queue:  make(chan *logger.Entry, queueSize),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run(st, out)
+	s.state.Store(st)
+	logger.SetShipper(s)
+
+	s.log.WithFields("Log shipping started", logger.Fields{
+		"target":  cfg.target,
+		"address": cfg.address,
+	})
+	return nil
+}
+
+// Stop 停止外发，尽量发送完已接收的日志
+func (s *Shipper) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+// stop 停止外发，调用方持有 mu
+func (s *Shipper) stop() {
+	st := s.state.Swap(nil)
+	if st == nil {
+		return
+	}
+	close(st.stopCh)
+	<-st.done
+}
+
+// Watch 日志外发设置变更后按新设置重新启动
+func (s *Shipper) Watch() {
+	s.settings.OnChange(func(prev, next *settings.Settings, actor string) {
+		if configOf(prev.Log) == configOf(next.Log) {
+			return
+		}
+		// 回调持有设置写锁，重新连接放到后台
+		go s.restart()
+	})
+}
+
+// restart 停止后按当前设置重新启动
+func (s *Shipper) restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stop()
+	if err := s.start(); err != nil {
+		s.log.ErrorWithFields("Failed to restart log shipping", logger.Fields{
+			"error": err.Error(),
+		})
+	}
+}
+
+// Ship 将日志放入发送队列，队列已满时丢弃
+func (s *Shipper) Ship(entry *logger.Entry) {
+	st := s.state.Load()
+	if st == nil || entry.Level < st.level {
+		return
+	}
+	if entry.Source == logger.SourceXray && !st.cfg.xray {
+		return
+	}
+
+	st.pending.Add(1)
+	select {
+	case st.queue <- entry:
+	default:
+		st.pending.Add(-1)
+		s.dropped.Add(1)
+	}
+}
+
+// Flush 等待队列中的日志发送完成，最多等待 timeout
+func (s *Shipper) Flush(timeout time.Duration) {
+	st := s.state.Load()
+	if st == nil {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for st.pending.Load() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// run 发送循环。发送失败时按递增的间隔重试同一条日志，期间新日志在队列中等待或被丢弃
+func (s *Shipper) run(st *state, out sink) {
+	defer close(st.done)
+	defer out.close()
+
+	failing := false
+	delay := minRetryDelay
+	for {
+		var entry *logger.Entry
+		select {
+		case <-st.stopCh:
+			s.drain(st, out)
+			return
+		case entry = <-st.queue:
+		}
+
+		for {
+			err := out.send(entry)
+			if err == nil {
+				break
+			}
+			if !failing {
+				failing = true
+				s.log.WarnWithFields("Failed to ship logs, will retry", logger.Fields{
+					"target": st.cfg.target,
+					"error":  err.Error(),
+				})
+			}
+			select {
+			case <-st.stopCh:
+				st.pending.Add(-1)
+				s.drain(st, out)
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxRetryDelay)
+		}
+		st.pending.Add(-1)
+
+		if failing {
+			failing = false
+			delay = minRetryDelay
+			s.log.WithFields("Log shipping recovered", logger.Fields{
+				"target":  st.cfg.target,
+				"dropped": s.dropped.Swap(0),
+			})
+		}
+	}
+}
+
+// drain 停止前发送队列中剩余的日志，失败或超时后放弃
+func (s *Shipper) drain(st *state, out sink) {
+	deadline := time.After(drainTimeout)
+	for {
+		select {
+		case entry := <-st.queue:
+			err := out.send(entry)
+			st.pending.Add(-1)
+			if err != nil {
+				st.pending.Store(0)
+				return
+			}
+		case <-deadline:
+			st.pending.Store(0)
+			return
+		default:
+			return
+		}
+	}
+}
+
+// newSink 按设置创建发送目标，不在此时建立连接
+func newSink(cfg config) (sink, error) {
+	appName := cfg.appName
+	if appName == "" {
+		appName = defaultAppName
+	}
+	switch cfg.target {
+	case settings.LogShipSyslog:
+		return newSyslogSink(cfg, appName)
+	case settings.LogShipJournald:
+		return newJournaldSink(appName), nil
+	default:
+		return nil, fmt.Errorf("unsupported log ship target %q", cfg.target)
+	}
+}
+
+// identifier 日志的程序名，Xray 日志固定为 xray
+func identifier(entry *logger.Entry, appName string) string {
+	if entry.Source == logger.SourceXray {
+		return logger.SourceXray
+	}
+	return appName
+}
+
+// severity 日志级别对应的 syslog 严重程度
+func severity(level logger.LogLevel) int {
+	switch level {
+	case logger.DEBUG:
+		return 7
+	case logger.INFO:
+		return 6
+	case logger.WARN:
+		return 4
+	case logger.ERROR:
+		return 3
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,225 @@
+package logship
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+const (
+	// dialTimeout 连接 syslog 服务器的超时
+	dialTimeout = 5 * time.Second
+	// writeTimeout 单条日志的发送超时
+	writeTimeout = 5 * time.Second
+	// maxUDPMessage UDP 传输时单条日志的最大长度，超出部分截断
+	maxUDPMessage = 8192
+	// sdID 结构化数据的 SD-ID，32473 为 IANA 保留给示例和私有用途的企业编号
+	sdID = "v@32473"
+	// defaultFacility 未配置时的 syslog facility
+	defaultFacility = "daemon"
+)
+
+// syslogSink 按 RFC 5424 格式发送到远程 syslog 服务器。TCP 和 TLS 使用 RFC 6587 的长度前缀分帧
+type syslogSink struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	facility  int
+	appName   string
+	hostname  string
+	pid       int
+	conn      net.Conn
+}
+
+// newSyslogSink 创建 syslog 发送目标，TLS 证书在此时加载
+func newSyslogSink(cfg config, appName string) (*syslogSink, error) {
+	network := cfg.network
+	if network == "" {
+		network = "udp"
+	}
+	facilityName := cfg.facility
+	if facilityName == "" {
+		facilityName = defaultFacility
+	}
+	facility, ok := settings.SyslogFacilities[facilityName]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facilityName)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogSink{
+		network:  network,
+		address:  cfg.address,
+		facility: facility,
+		appName:  appName,
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+
+	if network == "tls" {
+		host, _, err := net.SplitHostPort(cfg.address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address %q: %v", cfg.address, err)
+		}
+		s.tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if cfg.caFile != "" {
+			pem, err := os.ReadFile(cfg.caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read syslog CA file: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in syslog CA file %s", cfg.caFile)
+			}
+			s.tlsConfig.RootCAs = pool
+		}
+		if cfg.certFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load syslog client certificate: %v", err)
+			}
+			s.tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	return s, nil
+}
+
+// send 发送一条日志，连接断开时下次发送重新连接
+func (s *syslogSink) send(entry *logger.Entry) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	msg := s.format(entry)
+	if s.network == "udp" {
+		if len(msg) > maxUDPMessage {
+			msg = strings.ToValidUTF8(msg[:maxUDPMessage], "")
+		}
+	} else {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// dial 连接 syslog 服务器
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+// close 关闭连接
+func (s *syslogSink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// format 生成 RFC 5424 格式的日志：<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG。
+// 调用位置和日志字段写入结构化数据，MSGID 为日志来源
+func (s *syslogSink) format(entry *logger.Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ",
+		s.facility*8+severity(entry.Level),
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(s.hostname, 255),
+		headerField(identifier(entry, s.appName), 48),
+		s.pid,
+		headerField(entry.Source, 32),
+	)
+
+	params := make(map[string]string, len(entry.Fields)+2)
+	for k, v := range entry.Fields {
+		params[paramName(k)] = v
+	}
+	if entry.File != "" {
+		params["caller"] = entry.File + ":" + strconv.Itoa(entry.Line)
+		params["func"] = entry.Func
+	}
+	if len(params) == 0 {
+		b.WriteString("-")
+	} else {
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("[" + sdID)
+		for _, name := range names {
+			b.WriteString(" " + name + `="` + escapeParam(params[name]) + `"`)
+		}
+		b.WriteString("]")
+	}
+
+	if entry.Message != "" {
+		b.WriteString(" " + entry.Message)
+	}
+	return b.String()
+}
+
+// headerField 将头部字段限制为不含空格的可打印 ASCII，为空时使用 -
+func headerField(s string, maxLen int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// paramName 将字段名转为合法的 PARAM-NAME：不含 =、空格、]、"，最长 32 个字符
+func paramName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// escapeParam 转义 PARAM-VALUE 中的 "、\ 和 ]
+func escapeParam(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
@@ -2,21 +2,57 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"v/activity"
 	"v/api"
+	"v/audit"
+	"v/auth"
+	"v/backup"
+	"v/cert"
 	"v/common"
+	"v/config"
+	"v/connlimit"
+	"v/crash"
+	"v/events"
+	"v/exporter"
+	"v/ha"
+	"v/heartbeat"
+	"v/hooks"
+	"v/inbox"
+	"v/loadtest"
 	"v/logger"
+	"v/logship"
+	"v/middleware"
+	"v/mirror"
 	"v/model"
 	"v/monitor"
+	"v/node"
+	"v/notification"
+	"v/preferences"
+	"v/privacy"
+	"v/protocol"
 	"v/settings"
+	"v/stats"
+	"v/top"
+	"v/traffic"
+	"v/utils"
+	"v/version"
 	"v/xray"
 
 	"github.com/gin-gonic/gin"
@@ -27,6 +63,18 @@ var (
 	systemMonitor *monitor.SystemStatsMonitor
 	// Mock DB for testing
 	mockDB *MockDB
+
+	// 面板访问相关的命令行选项，执行后退出
+	showPanel      = flag.Bool("show-panel", false, "显示面板监听地址和访问路径后退出")
+	randomBasePath = flag.Bool("random-base-path", false, "生成随机的面板访问路径并保存，其他路径返回 404")
+	randomPort     = flag.Bool("random-port", false, "为面板选择随机端口并保存，重启后生效")
+	encryptDB      = flag.Bool("encrypt-db", false, "使用设置加密密钥加密数据库中已有的用户邮箱和协议凭据后退出")
+)
+
+// 面板 HTTP 服务器的连接超时，请求体读取和处理时间由 middleware.Limits 按路由限制
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
 )
 
 // Add parseFlags function
@@ -73,17 +121,20 @@ func (m *MockDB) Close() error {
 
 // Stub implementation of other DB interface methods - not implementing all for brevity
 // In a real implementation, these methods would need to be completed
-func (m *MockDB) CreateUser(user *model.User) error                      { return nil }
-func (m *MockDB) GetUser(id int64) (*model.User, error)                  { return nil, nil }
-func (m *MockDB) GetUserByUsername(username string) (*model.User, error) { return nil, nil }
-func (m *MockDB) GetUserByEmail(email string) (*model.User, error)       { return nil, nil }
-func (m *MockDB) UpdateUser(user *model.User) error                      { return nil }
-func (m *MockDB) DeleteUser(id int64) error                              { return nil }
-func (m *MockDB) ListUsers(page, pageSize int) ([]*model.User, error)    { return nil, nil }
-func (m *MockDB) GetTotalUsers() (int64, error)                          { return 0, nil }
-func (m *MockDB) SearchUsers(keyword string) ([]*model.User, error)      { return nil, nil }
-func (m *MockDB) GetSettings(key string) (string, error)                 { return "", nil }
-func (m *MockDB) SetSettings(key, value string) error                    { return nil }
+func (m *MockDB) CreateUser(user *model.User) error                             { return nil }
+func (m *MockDB) CreateUsers(users []*model.User) error                         { return nil }
+func (m *MockDB) GetUser(id int64) (*model.User, error)                         { return nil, nil }
+func (m *MockDB) GetUserByUUID(uuid string) (*model.User, error)                { return nil, nil }
+func (m *MockDB) GetUserByUsername(username string) (*model.User, error)        { return nil, nil }
+func (m *MockDB) GetUserByIdentity(issuer, subject string) (*model.User, error) { return nil, nil }
+func (m *MockDB) GetUserByEmail(email string) (*model.User, error)              { return nil, nil }
+func (m *MockDB) UpdateUser(user *model.User) error                             { return nil }
+func (m *MockDB) DeleteUser(id int64) error                                     { return nil }
+func (m *MockDB) ListUsers(page, pageSize int) ([]*model.User, error)           { return nil, nil }
+func (m *MockDB) GetTotalUsers() (int64, error)                                 { return 0, nil }
+func (m *MockDB) SearchUsers(keyword string) ([]*model.User, error)             { return nil, nil }
+func (m *MockDB) GetSettings(key string) (string, error)                        { return "", nil }
+func (m *MockDB) SetSettings(key, value string) error                           { return nil }
 
 // Implement CreateProxy and related methods
 func (m *MockDB) CreateProxy(proxy *common.Proxy) error                    { return nil }
@@ -103,21 +154,73 @@ func (m *MockDB) UpdateTraffic(traffic *common.TrafficStats) error
 func (m *MockDB) DeleteTraffic(id int64) error                                       { return nil }
 func (m *MockDB) ListTrafficByUserID(userID int64) ([]*common.TrafficStats, error)   { return nil, nil }
 func (m *MockDB) ListTrafficByProxyID(proxyID int64) ([]*common.TrafficStats, error) { return nil, nil }
-func (m *MockDB) GetTrafficStats(userID uint) (*model.TrafficStats, error)           { return nil, nil }
+func (m *MockDB) GetTrafficStats(userID int64) (*model.TrafficStats, error)          { return nil, nil }
 func (m *MockDB) CreateTrafficRecord(traffic *model.Traffic) error                   { return nil }
-func (m *MockDB) CleanupTraffic(before time.Time) error                              { return nil }
+func (m *MockDB) AdjustUserTraffic(adjustment *model.Traffic) error                  { return nil }
+func (m *MockDB) ListTrafficAdjustments(userID int64) ([]*model.Traffic, error)      { return nil, nil }
+func (m *MockDB) GetSubscription(userID int64) (*model.Subscription, error)          { return nil, nil }
+func (m *MockDB) GetSubscriptionByToken(token string) (*model.Subscription, error)   { return nil, nil }
+func (m *MockDB) ListSubscriptions() ([]*model.Subscription, error)                  { return nil, nil }
+func (m *MockDB) SaveSubscription(sub *model.Subscription) error                     { return nil }
+func (m *MockDB) UpdateSubscriptionNotifyStatus(userID int64, notifiedAt *time.Time, notifyError string) error {
+	return nil
+}
+func (m *MockDB) GetProtocolSchedule(protocolID int64) (*model.ProtocolSchedule, error) {
+	return nil, nil
+}
+func (m *MockDB) ListProtocolSchedules() ([]*model.ProtocolSchedule, error)   { return nil, nil }
+func (m *MockDB) SaveProtocolSchedule(schedule *model.ProtocolSchedule) error { return nil }
+func (m *MockDB) DeleteProtocolSchedule(protocolID int64) error               { return nil }
+func (m *MockDB) AppendStreamEvent(event *model.StreamEvent) error            { return nil }
+func (m *MockDB) ListStreamEvents(after int64, limit int) ([]*model.StreamEvent, error) {
+	return nil, nil
+}
+func (m *MockDB) PruneStreamEvents(keep int) error { return nil }
+func (m *MockDB) AcquireLease(name, holder, address string, ttl time.Duration) (*model.LeaderLease, error) {
+	now := time.Now()
+	return &model.LeaderLease{Name: name, Holder: holder, Address: address, ExpiresAt: now.Add(ttl), UpdatedAt: now}, nil
+}
+func (m *MockDB) ReleaseLease(name, holder string) error         { return nil }
+func (m *MockDB) CreateNotification(n *model.Notification) error { return nil }
+func (m *MockDB) ListNotifications(query *model.NotificationQuery) ([]*model.Notification, error) {
+	return nil, nil
+}
+func (m *MockDB) CountNotifications(query *model.NotificationQuery) (int64, error) { return 0, nil }
+func (m *MockDB) MarkNotificationsRead(ids []int64) (int64, error)                 { return 0, nil }
+func (m *MockDB) MarkAllNotificationsRead(query *model.NotificationQuery) (int64, error) {
+	return 0, nil
+}
+func (m *MockDB) PruneNotifications(before time.Time) error { return nil }
+func (m *MockDB) CleanupTraffic(before time.Time) error     { return nil }
+func (m *MockDB) GetTopUsersByTraffic(start, end time.Time, limit int) ([]*model.TopTalker, error) {
+	return nil, nil
+}
+func (m *MockDB) GetTopProtocolsByTraffic(start, end time.Time, limit int) ([]*model.TopTalker, error) {
+	return nil, nil
+}
 
 // Implement protocol-related methods
 func (m *MockDB) CreateProtocol(protocol *model.Protocol) error                { return nil }
 func (m *MockDB) GetProtocol(id int64) (*model.Protocol, error)                { return nil, nil }
+func (m *MockDB) GetProtocolByUUID(uuid string) (*model.Protocol, error)       { return nil, nil }
 func (m *MockDB) GetProtocolsByUserID(userID int64) ([]*model.Protocol, error) { return nil, nil }
 func (m *MockDB) UpdateProtocol(protocol *model.Protocol) error                { return nil }
 func (m *MockDB) DeleteProtocol(id int64) error                                { return nil }
+func (m *MockDB) DeleteProtocolCascade(id int64, archive bool) error           { return nil }
 func (m *MockDB) GetProtocolsByPort(port int) ([]*model.Protocol, error)       { return nil, nil }
 func (m *MockDB) ListProtocols(page, pageSize int) ([]*model.Protocol, error)  { return nil, nil }
 func (m *MockDB) GetTotalProtocols() (int64, error)                            { return 0, nil }
 func (m *MockDB) SearchProtocols(keyword string) ([]*model.Protocol, error)    { return nil, nil }
 
+// Implement protocol version methods
+func (m *MockDB) CreateProtocolVersion(version *model.ProtocolVersion) error { return nil }
+func (m *MockDB) GetProtocolVersion(protocolID int64, version int) (*model.ProtocolVersion, error) {
+	return nil, nil
+}
+func (m *MockDB) ListProtocolVersions(protocolID int64) ([]*model.ProtocolVersion, error) {
+	return nil, nil
+}
+
 // Implement protocol stats methods
 func (m *MockDB) CreateProtocolStats(stats *model.ProtocolStats) error    { return nil }
 func (m *MockDB) GetProtocolStats(id int64) (*model.ProtocolStats, error) { return nil, nil }
@@ -172,7 +275,7 @@ func (m *MockDB) ListAlertRecords(out *[]*model.AlertRecord) error  { return nil
 
 // Implement traffic history methods
 func (m *MockDB) CreateTrafficHistory(history *model.TrafficHistory) error { return nil }
-func (m *MockDB) ListTrafficHistoryByDateRange(userID uint, startDate, endDate string, histories *[]*model.TrafficHistory) error {
+func (m *MockDB) ListTrafficHistoryByDateRange(userID int64, startDate, endDate string, histories *[]*model.TrafficHistory) error {
 	return nil
 }
 
@@ -188,6 +291,16 @@ func main() {
 	log.Start()
 	defer log.Stop()
 
+	// v loadtest：在独立的测试实例上压测，不读取也不修改面板数据
+	if flag.Arg(0) == "loadtest" {
+		if err := runLoadTest(log, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			log.Stop()
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 初始化设置管理器
 	settingsManager := settings.New(log)
 	if err := settingsManager.Start(); err != nil {
@@ -197,6 +310,59 @@ func main() {
 	}
 	defer settingsManager.Stop()
 
+	// 数据库中的用户邮箱和协议凭据使用设置加密密钥加密保存
+	model.SetFieldCipher(settings.RowCipher{})
+
+	// 按设置匿名化日志和访问记录中的客户端 IP
+	privacy.Init(settingsManager)
+
+	// 按设置将面板和 Xray 日志外发到远程 syslog 或 journald
+	logShipper := logship.New(log, settingsManager)
+	if err := logShipper.Start(); err != nil {
+		log.ErrorWithFields("Failed to start log shipping", logger.Fields{
+			"error": err.Error(),
+		})
+	}
+	logShipper.Watch()
+	defer logShipper.Stop()
+
+	// 日志文件的磁盘保留空间与监控设置一致，修改后立即生效
+	log.SetMinFreeSpace(utils.MinFreeDiskBytes(settingsManager.Get().Monitor.MinFreeDiskMB))
+	settingsManager.OnChange(func(prev, next *settings.Settings, actor string) {
+		if prev.Monitor.MinFreeDiskMB != next.Monitor.MinFreeDiskMB {
+			log.SetMinFreeSpace(utils.MinFreeDiskBytes(next.Monitor.MinFreeDiskMB))
+		}
+	})
+
+	// 崩溃报告，主 goroutine 的 panic 记录后照常退出
+	crashReporter := crash.New(log, settingsManager)
+	defer crashReporter.Recover("main")
+
+	if *encryptDB {
+		if err := runEncryptDatabase(settingsManager); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// v top：终端实时仪表盘，连接本机面板 API
+	if flag.Arg(0) == "top" {
+		if err := runTop(settingsManager, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *showPanel || *randomBasePath || *randomPort {
+		if err := runPanelCommand(settingsManager, *randomBasePath, *randomPort); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 初始化xray版本管理器
 	xrayManager := xray.New(log, settingsManager)
 	if err := xrayManager.Initialize(); err != nil {
@@ -207,42 +373,334 @@ func main() {
 	// 确保xray在应用退出时停止
 	defer xrayManager.Stop()
 
+	// 启动时输出构建信息，排查问题时确认服务器运行的版本
+	versionHandler := api.NewVersionHandler(settingsManager, xrayManager)
+	log.WithFields("Panel starting", versionHandler.Info().LogFields())
+
 	// 初始化模拟数据库
 	mockDB = &MockDB{log: log}
+	xrayManager.SetLogStore(mockDB)
+
+	// 主备模式下只有主节点运行定时任务、流量采集和配置同步，未启用时本实例即主节点。
+	// 租约必须保存在所有实例共享的数据库中，由数据库保证同一时刻只有一个实例持有租约
+	var leaseStore ha.LeaseStore = mockDB
+	if haSettings := settingsManager.Get().HA; haSettings.Enable {
+		if err := haSettings.ValidateHA(); err != nil {
+			log.Fatal("Invalid HA settings", logger.Fields{
+				"error": err,
+			})
+		}
+		leaseDB, err := model.OpenDB(haSettings.LeaseDB, slog.Default())
+		if err != nil {
+			log.Fatal("Failed to open HA lease database", logger.Fields{
+				"path":  haSettings.LeaseDB,
+				"error": err,
+			})
+		}
+		defer leaseDB.Close()
+		leaseStore = leaseDB
+	}
+	elector := ha.New(log, settingsManager, leaseStore)
+	defer elector.Stop()
+
+	// 主备模式下只有主节点运行 xray，退为备用实例时停止，避免两个实例同时对外提供同一组入站
+	if settingsManager.Get().HA.Enable {
+		elector.Run("xray", xrayManager.Start, func() {
+			if err := xrayManager.Stop(); err != nil {
+				log.WarnWithFields("Failed to stop xray after stepping down", logger.Fields{
+					"error": err.Error(),
+				})
+			}
+		})
+	}
 
 	// 创建系统监控
 	systemMonitor = monitor.NewSystemStatsMonitor(mockDB)
 
-	// 启动API服务器
-	apiHandler := api.New(log, nil, settingsManager, xrayManager)
-	if err := apiHandler.Start(); err != nil {
-		log.Fatal("Failed to start API server", logger.Fields{
-			"error": err,
+	// 后台任务成功后请求外部检查地址，面板停止运行时由外部服务告警
+	heartbeatPinger := heartbeat.New(log, settingsManager)
+
+	// 流量统计，本地采集和外部节点上报共用
+	statsManager := stats.New(log, settingsManager, nil)
+	statsManager.SetHeartbeat(heartbeatPinger)
+
+	// 流量和连接事件导出到外部分析数据库（ClickHouse、InfluxDB），未启用时不记录
+	trafficExporter := exporter.New(log, settingsManager)
+	if err := trafficExporter.Start(); err != nil {
+		log.ErrorWithFields("Failed to start traffic exporter", logger.Fields{
+			"error": err.Error(),
 		})
 	}
-	defer apiHandler.Stop()
+	defer trafficExporter.Stop()
+	statsManager.SetExporter(trafficExporter)
+	if settingsManager.Get().Traffic.StatsInterval > 0 {
+		elector.Run("stats", statsManager.Start, statsManager.Stop)
+	}
 
-	// 设置Gin为发布模式
-	gin.SetMode(gin.ReleaseMode)
+	// 定期检查系统时钟偏差，偏差过大时 VMess 和两步验证会失败
+	alertManager := monitor.NewAlertManager(log, settingsManager, notification.New(log, settingsManager), mockDB)
+	clockMonitor := monitor.NewClockMonitor(log, settingsManager, alertManager)
+	clockMonitor.Start()
+	defer clockMonitor.Stop()
 
-	// 创建Gin路由器
-	r := gin.New()
-	r.Use(gin.Recovery())
+	// 定期采集 CPU、内存和磁盘状态，超过阈值时告警
+	systemMonitor.Start(log, settingsManager, alertManager)
+	defer systemMonitor.Stop()
 
-	// 添加CORS中间件
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+	// 设置了匿名化延迟时定期处理超过延迟的日志和访问记录，每个实例处理自己的记录
+	ipSweeper := privacy.NewSweeper(log)
+	if path := log.FilePath(); path != "" {
+		ipSweeper.Add("app_log", privacy.NewLogFiles(path))
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+	// 管理员变更动态，合并审计事件、设置变更、xray 事件和告警
+	activityFeed := activity.New(log, mockDB)
+	activityFeed.WatchSettings(settingsManager)
+	if auditor, err := audit.New(log, filepath.Join("logs", "audit.log")); err != nil {
+		log.WarnWithFields("Failed to open audit log", logger.Fields{
+			"error": err.Error(),
+		})
+	} else {
+		defer auditor.Close()
+		activityFeed.SetAuditor(auditor)
+		ipSweeper.Add("audit_log", auditor)
+	}
+	// 实时事件历史，供无法建立推送连接的客户端长轮询
+	eventHistory := events.NewHistory(log, mockDB)
+	eventHistory.WatchSettings(settingsManager)
+
+	// 通知中心，保存告警、备份结果、证书续期、版本更新和后台任务失败，邮件未配置时也能在面板中查看
+	notificationInbox := inbox.New(log, mockDB)
+	notificationInbox.SetEvents(eventHistory)
+	notificationInbox.Watch()
+	elector.Run("notification_prune", func() error {
+		notificationInbox.Start()
+		return nil
+	}, notificationInbox.Stop)
+	if current, latest := xrayManager.GetCurrentVersion(), xray.LatestVersion(); strings.HasPrefix(current, "v") && xray.CompareVersions(latest, current) > 0 {
+		notificationInbox.UpdateAvailable("Xray", current, latest)
+	}
+
+	// xray 事件写入变更动态和事件历史，因入站端口被占用启动失败或异常退出时发送告警
+	xrayEvents := xrayManager.SubscribeEvents()
+	defer xrayManager.UnsubscribeEvents(xrayEvents)
+	go func() {
+		for event := range xrayEvents {
+			activityFeed.RecordXray(event.Type, event.Status, event.Version, event.Message, event.Details)
+			eventHistory.PublishQuietly(events.TypeXray, event)
+			switch details := event.Details.(type) {
+			case []*xray.PortConflict:
+				if event.Type != "port_conflict" {
+					continue
+				}
+				hints := make([]string, 0, len(details))
+				for _, c := range details {
+					hints = append(hints, c.Hint)
+				}
+				alertManager.ReportPortConflicts(hints)
+			case *xray.CrashReport:
+				alertManager.ReportXrayCrash(details.ExitError, details.Lines)
+			}
+		}
+	}()
+
+	// 并行拉取各节点 xray API 的流量计数
+	trafficCollector := stats.NewCollector(log, settingsManager, statsManager)
+	trafficCollector.SetTargets(stats.ParseCollectTargets(settingsManager.Get().Traffic.CollectTargets, func() string {
+		return xrayManager.GetExecutablePath(xrayManager.GetCurrentVersion())
+	}))
+	elector.Run("traffic_collector", func() error {
+		trafficCollector.Start()
+		return nil
+	}, trafficCollector.Stop)
+
+	// 按来源国家汇总节点上报的在线客户端，未配置地理位置查询时计入未知国家
+	geoStats := stats.NewGeoStats(log, nil)
+
+	// 多节点部署时定期探测到其他节点的延迟和丢包，链路劣化时告警
+	latencyMatrix := node.NewMatrix(log, settingsManager, alertManager)
+
+	// 用户超限、协议创建和删除、节点不可达时执行管理员配置的钩子脚本
+	hookRunner := hooks.New(log, settingsManager)
+	traffic.OnQuotaExceeded(func(user *model.User, used int64) {
+		hookRunner.Fire(hooks.EventUserQuotaExceeded, &hooks.QuotaExceeded{
+			UserID:       user.ID,
+			Username:     user.Username,
+			Email:        user.Email,
+			TrafficLimit: user.TrafficLimit,
+			TrafficUsed:  used,
+		})
+	})
+	protocol.OnProtocolChange(func(p *model.Protocol, reason string) {
+		var event string
+		switch reason {
+		case protocol.ChangeCreated:
+			event = hooks.EventProtocolCreated
+		case protocol.ChangeDeleted:
+			event = hooks.EventProtocolDeleted
+		default:
 			return
 		}
+		hookRunner.Fire(event, &hooks.ProtocolChange{
+			ProtocolID: p.ID,
+			UUID:       p.UUID,
+			UserID:     p.UserID,
+			Name:       p.Name,
+			Type:       p.Type,
+			Port:       p.Port,
+			Listen:     p.Listen,
+		})
+	})
+	latencyMatrix.SetDownListener(func(link node.Link, down bool) {
+		event := hooks.EventNodeUp
+		if down {
+			event = hooks.EventNodeDown
+		}
+		hookRunner.Fire(event, &hooks.NodeState{
+			Node:    link.To,
+			From:    link.From,
+			Latency: link.Latency,
+			Loss:    link.Loss,
+		})
+	})
 
-		c.Next()
+	latencyProber := node.NewProber(log, settingsManager, latencyMatrix)
+	elector.Run("latency_prober", func() error {
+		latencyProber.Start()
+		return nil
+	}, latencyProber.Stop)
+
+	// 按计划定时启用和停用协议
+	protocolScheduler := protocol.NewScheduler(log, protocol.New(log, settingsManager, mockDB))
+	protocolScheduler.SetHeartbeat(heartbeatPinger)
+	elector.Run("protocol_scheduler", func() error {
+		protocolScheduler.Start()
+		return nil
+	}, protocolScheduler.Stop)
+
+	// 入站并发连接数限制，限制期间入站改为监听本机内部端口，由面板计数并转发
+	connLimiter := connlimit.New(log, settingsManager, mockDB)
+	connLimiter.SetAlerter(alertManager)
+
+	// 连接事件来自 Xray 访问日志，覆盖所有入站。受限入站的来源是本机转发地址，换成真实客户端地址
+	xrayManager.SetAccessObserver(func(entry xray.AccessEntry) {
+		idText, ok := strings.CutPrefix(entry.InboundTag, "inbound-")
+		if !ok {
+			return
+		}
+		protocolID, err := strconv.ParseInt(idText, 10, 64)
+		if err != nil {
+			return
+		}
+		source := entry.Source
+		if host, _, err := net.SplitHostPort(source); err == nil && net.ParseIP(host).IsLoopback() {
+			if client, ok := connLimiter.ClientAddr(source); ok {
+				source = client
+			}
+		}
+		if host, _, err := net.SplitHostPort(source); err == nil {
+			source = host
+		}
+		trafficExporter.RecordConnection(0, protocolID, source, entry.Target)
 	})
+	// 访问日志只在启用导出时打开，开关变化后重新生成 Xray 配置
+	settingsManager.OnChange(func(prev, next *settings.Settings, actor string) {
+		if prev.Export.Enable == next.Export.Enable {
+			return
+		}
+		go func() {
+			if err := reconcileXray(elector, xrayManager)(); err != nil {
+				log.ErrorWithFields("Failed to apply xray config for traffic export", logger.Fields{
+					"error": err.Error(),
+				})
+			}
+		}()
+	})
+	connLimiterProtocols := protocol.New(log, settingsManager, mockDB)
+	connLimiter.SetOnChange(func(protocolID int64) {
+		if _, err := connLimiterProtocols.RequestApply(fmt.Sprintf("connection limit protocol %d", protocolID)); err != nil {
+			log.ErrorWithFields("Failed to apply xray config for connection limit", logger.Fields{
+				"protocol_id": protocolID,
+				"error":       err.Error(),
+			})
+		}
+	})
+	elector.Run("conn_limiter", func() error {
+		connLimiter.Start()
+		return nil
+	}, connLimiter.Stop)
+
+	// 本节点月流量预算，将耗尽时限流或停用非优先入站
+	budgetProtocols := protocol.New(log, settingsManager, mockDB)
+	bandwidthBudget := node.NewBudget(log, settingsManager, budgetProtocols)
+	bandwidthBudget.SetAlerter(alertManager)
+	bandwidthBudget.SetThrottler(connLimiter)
+	bandwidthBudget.SetOnApply(func(reason string) {
+		if _, err := budgetProtocols.RequestApply(reason); err != nil {
+			log.ErrorWithFields("Failed to apply xray config for bandwidth budget", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+	})
+	connLimiter.SetExtraLimits(bandwidthBudget.ThrottleLimits)
+	elector.Run("bandwidth_budget", func() error {
+		bandwidthBudget.Start()
+		return nil
+	}, bandwidthBudget.Stop)
+
+	// 定期检测长期没有流量和连接的入站，通知后按设置停用或归档
+	staleCleaner := protocol.NewStaleCleaner(log, protocol.New(log, settingsManager, mockDB), notification.New(log, settingsManager))
+	staleCleaner.SetConnCounter(func(protocolID int64) int {
+		if gauge, ok := connLimiter.Gauge(protocolID); ok {
+			return gauge.Current
+		}
+		return 0
+	})
+	elector.Run("stale_cleanup", func() error {
+		staleCleaner.Start()
+		return nil
+	}, staleCleaner.Stop)
+
+	elector.Start()
+
+	// 入站调试会话，调试期间入站改为监听本机内部端口
+	inboundMirrors := mirror.New(log)
+
+	// 生成 Xray 入站配置的协议管理器，调试模式和限制连接数的入站改为监听本机内部端口
+	protocolManager := protocol.NewProtocolManager(log, settingsManager, mockDB)
+	protocolManager.SetMirror(inboundMirrors)
+	protocolManager.SetConnLimiter(connLimiter)
+
+	// 新位置登录和设备数超限提醒
+	activityMonitor := notification.NewActivityMonitor(log, settingsManager, notification.New(log, settingsManager), mockDB, nil)
+	ipSweeper.Add("activity_monitor", activityMonitor)
+	ipSweeper.Add("geo_stats", geoStats)
+	ipSweeper.Start()
+	defer ipSweeper.Stop()
+
+	// 创建单点登录提供者
+	ssoProvider := auth.NewSSOProvider(log, settingsManager, mockDB)
+
+	// 会话无操作超时和管理员会话数限制
+	auth.InitSessions(settingsManager)
+
+	// 注册和修改邮箱时的双重确认，未验证的用户邮箱不接收通知
+	emailVerifier := auth.NewEmailVerifier(log, settingsManager, mockDB, notification.New(log, settingsManager))
+	auth.SetEmailVerifier(emailVerifier)
+	notification.SetRecipientFilter(emailVerifier.Deliverable)
+
+	// API处理器，路由挂载到主服务器上，共用同一套中间件并保留原有的速率限制
+	apiHandler := api.New(log, nil, settingsManager, xrayManager)
+
+	// 设置Gin为发布模式
+	gin.SetMode(gin.ReleaseMode)
+
+	// 创建Gin路由器
+	r := gin.New()
+	r.Use(middleware.CrashRecovery(crashReporter))
+
+	// 添加CORS中间件
+	r.Use(middleware.NewCORSPolicy(settingsManager).Handler())
 
 	// 添加中间件
 	r.Use(func(c *gin.Context) {
@@ -271,7 +729,7 @@ func main() {
 		clientIP := c.ClientIP()
 
 		// 日志格式
-		log.Info("HTTP Request", logger.Fields{
+		log.WithFields("HTTP Request", logger.Fields{
 			"time":      endTime.Format("2006/01/02 - 15:04:05"),
 			"status":    statusCode,
 			"latency":   latencyTime,
@@ -281,9 +739,170 @@ func main() {
 		})
 	})
 
+	// API使用统计和按密钥限速
+	usageTracker := middleware.NewUsageTracker(settingsManager)
+
 	// API路由组
 	apiGroup := r.Group("/api")
+	apiGroup.Use(usageTracker.Handler())
+	// 管理接口需要登录且为管理员，JWT 密钥每次请求时读取以支持热更新
+	adminGroup := apiGroup.Group("", func(c *gin.Context) {
+		middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+	}, middleware.AdminMiddleware())
+	// 只需登录的接口，处理器自行检查操作的是否为当前用户的资源
+	userGroup := apiGroup.Group("", func(c *gin.Context) {
+		middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+	})
 	{
+		// 版本和构建信息
+		versionHandler.RegisterRoutes(apiGroup)
+
+		// API使用统计，包含各调用方的用户 ID 和客户端 IP，仅管理员可用
+		api.NewAPIUsageHandler(usageTracker).RegisterRoutes(adminGroup)
+
+		// 外部节点流量上报
+		ingestor := stats.NewIngestor(log, settingsManager, statsManager)
+		ingestor.SetGeoStats(geoStats)
+		api.NewIngestHandler(ingestor).RegisterRoutes(apiGroup)
+
+		// 节点间延迟矩阵上报、查看和中转建议
+		nodeHandler := api.NewNodeHandler(latencyMatrix, ingestor)
+		nodeHandler.RegisterRoutes(apiGroup)
+		nodeHandler.RegisterAdminRoutes(adminGroup)
+
+		// 通过 SSH 引导新节点，仅管理员
+		api.NewNodeBootstrapHandler(node.NewBootstrapper(log, settingsManager)).RegisterRoutes(adminGroup)
+
+		// 本节点月流量预算
+		api.NewNodeBudgetHandler(bandwidthBudget).RegisterRoutes(adminGroup)
+
+		// SSL 证书管理，可为所有入站和节点域名批量签发
+		certManager := cert.NewCertManager(log, settingsManager, notification.New(log, settingsManager), mockDB, filepath.Join("data", "acme"))
+		api.NewCertificateHandler(certManager, protocol.New(log, settingsManager, mockDB), settingsManager).RegisterRoutes(adminGroup)
+
+		// 流量采集目标状态
+		api.NewCollectHandler(trafficCollector).RegisterRoutes(adminGroup)
+
+		// 流量排行报告
+		reportHandler := api.NewReportHandler(log, settingsManager, mockDB, geoStats)
+		reportHandler.SetCollector(trafficCollector)
+		reportHandler.RegisterRoutes(adminGroup)
+
+		// 用户流量人工调整，仅管理员，记录操作人
+		api.NewTrafficAdjustmentHandler(log, mockDB).RegisterRoutes(adminGroup)
+
+		// 用户部分字段修改，修改邮箱后发送验证邮件，仅管理员
+		userHandler := api.NewUserHandler(log, mockDB)
+		userHandler.SetEmailVerifier(emailVerifier)
+		userHandler.RegisterRoutes(adminGroup)
+
+		// 邮箱验证链接和当前账号的邮箱修改，后者需登录
+		emailHandler := api.NewEmailVerificationHandler(emailVerifier, mockDB)
+		emailHandler.RegisterRoutes(apiGroup)
+		emailHandler.RegisterAccountRoutes(apiGroup.Group("", func(c *gin.Context) {
+			middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+		}))
+
+		// 批量导入用户、批量创建协议和修改分组策略，支持 dry_run 预演，仅管理员
+		api.NewBulkHandler(log, settingsManager, mockDB, protocol.New(log, settingsManager, mockDB)).RegisterRoutes(adminGroup)
+
+		// 告警规则导出为 Prometheus 规则
+		api.NewAlertRulesHandler(log, settingsManager).RegisterRoutes(adminGroup)
+
+		// 检测并接管外部 xray
+		api.NewXrayAdoptionHandler(log, xrayManager, protocol.New(log, settingsManager, mockDB)).RegisterRoutes(adminGroup)
+
+		// 管理员变更动态
+		api.NewActivityHandler(activityFeed).RegisterRoutes(adminGroup)
+
+		// 实时事件长轮询
+		api.NewEventsHandler(log, eventHistory).RegisterRoutes(adminGroup)
+
+		// 最近的崩溃报告
+		api.NewCrashHandler(crashReporter).RegisterRoutes(adminGroup)
+
+		// 主备状态
+		api.NewHAHandler(elector).RegisterRoutes(adminGroup)
+
+		// 性能诊断，仅管理员可用，JWT 密钥每次请求重新读取
+		api.NewDebugHandler(settingsManager).RegisterRoutes(apiGroup.Group("", func(c *gin.Context) {
+			middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+		}, middleware.AdminMiddleware()))
+
+		// 系统设置的读取和修改，支持 JSON Merge Patch，仅管理员可用
+		api.NewSettingsHandler(log, settingsManager).RegisterRoutes(adminGroup)
+
+		// 按分区导出和导入设置，仅管理员可用
+		api.NewSettingsTransferHandler(log, settingsManager).RegisterRoutes(apiGroup.Group("", func(c *gin.Context) {
+			middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+		}, middleware.AdminMiddleware()))
+
+		// 通知中心，仅管理员可用
+		api.NewNotificationHandler(notificationInbox).RegisterRoutes(apiGroup.Group("", func(c *gin.Context) {
+			middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+		}, middleware.AdminMiddleware()))
+
+		// 终端仪表盘（v top）的实时状态，仅管理员可用
+		api.NewDashboardHandler(mockDB, xrayManager, statsManager, alertManager, systemMonitor).RegisterRoutes(apiGroup.Group("", func(c *gin.Context) {
+			middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+		}, middleware.AdminMiddleware()))
+
+		// 当前账号的界面偏好设置，需登录，JWT 密钥每次请求重新读取
+		api.NewPreferencesHandler(preferences.New(log, filepath.Join("data", "preferences.json"))).RegisterRoutes(apiGroup.Group("", func(c *gin.Context) {
+			middleware.AuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+		}))
+
+		// 协议管理，仅管理员可用，修改后由主节点重新生成并加载 Xray 配置
+		protocols := protocol.New(log, settingsManager, mockDB)
+		protocols.SetReconciler(reconcileXray(elector, xrayManager))
+		api.NewProtocolHandler(log, protocols).RegisterRoutes(adminGroup)
+
+		// 入站调试模式，仅管理员可用
+		api.NewMirrorHandler(log, inboundMirrors, protocols).RegisterRoutes(adminGroup)
+
+		// 入站并发连接数指标
+		api.NewConnLimitHandler(connLimiter, protocol.New(log, settingsManager, mockDB)).RegisterRoutes(adminGroup)
+
+		// 闲置入站检测和清理
+		api.NewStaleHandler(staleCleaner).RegisterRoutes(adminGroup)
+
+		// 远程备份列表和恢复，恢复会覆盖数据库，仅管理员可用
+		backupDir := settingsManager.Get().Backup.Path
+		if backupDir == "" {
+			backupDir = "backups"
+		}
+		backupManager := backup.New(log, settingsManager, notification.New(log, settingsManager), &config.Config{BackupDir: backupDir}, mockDB)
+		api.NewBackupHandler(backupManager).RegisterRoutes(adminGroup)
+
+		// 登录会话查看和强制下线，普通用户只能管理自己的会话
+		auth.NewSessionHandler(auth.Sessions()).RegisterRoutes(userGroup)
+
+		// 订阅拉取和客户端更新通知
+		subscriptionNotifier := notification.NewSubscriptionNotifier(log, settingsManager, mockDB)
+		subscriptionHandler := api.NewSubscriptionHandler(log, settingsManager, mockDB, protocolManager,
+			subscriptionNotifier, activityMonitor)
+		// 协议或凭据变化时递增订阅版本并清除 CDN 缓存
+		protocol.OnChange(func(userID int64, reason string) {
+			if userID == 0 {
+				return
+			}
+			go func() {
+				if _, err := subscriptionNotifier.Refresh([]int64{userID}, reason); err != nil {
+					log.WarnWithFields("Failed to refresh subscription after protocol change", logger.Fields{
+						"user_id": userID,
+						"reason":  reason,
+						"error":   err.Error(),
+					})
+				}
+			}()
+		})
+		// 节点地址或分流方案变化时刷新全部订阅
+		subscriptionNotifier.Watch()
+		subscriptionHandler.SetUsageSource(statsManager)
+		subscriptionHandler.RegisterRoutes(apiGroup)
+		subscriptionHandler.RegisterUserRoutes(userGroup)
+		subscriptionHandler.RegisterAdminRoutes(adminGroup)
+
 		// 健康检查
 		apiGroup.GET("/health", func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{
@@ -310,6 +929,14 @@ func main() {
 					"username": req.Username,
 				})
 
+				// 禁用本地密码登录时只允许单点登录
+				if !ssoProvider.LocalLoginAllowed() {
+					c.JSON(http.StatusForbidden, gin.H{
+						"error": "Local login is disabled",
+					})
+					return
+				}
+
 				// 特殊处理admin用户
 				if req.Username == "admin" {
 					if req.Password != "admin123" {
@@ -319,8 +946,19 @@ func main() {
 						return
 					}
 
-					// 生成一个简单的token
-					token := "admin_token_" + time.Now().Format("20060102150405")
+					// 签发带登录会话的 JWT，与其他登录方式一样经 AuthMiddleware 校验
+					admin := &model.User{Username: "admin", Role: "admin", IsAdmin: true}
+					admin.ID = 1
+					token, err := auth.GenerateToken(admin)
+					if err != nil {
+						log.Error("Failed to generate token", logger.Fields{
+							"error": err,
+						})
+						c.JSON(http.StatusInternalServerError, gin.H{
+							"error": "Failed to generate token",
+						})
+						return
+					}
 
 					c.JSON(http.StatusOK, gin.H{
 						"token": token,
@@ -340,6 +978,11 @@ func main() {
 				})
 			})
 
+			// 单点登录
+			ssoHandler := auth.NewSSOHandler(ssoProvider)
+			ssoHandler.SetActivityMonitor(activityMonitor)
+			ssoHandler.RegisterRoutes(authGroup)
+
 			// 注册
 			authGroup.POST("/register", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{
@@ -505,6 +1148,7 @@ func main() {
 						"diskInfo":    diskInfo,
 						"diskUsage":   diskUsage,
 						"processes":   getProcessInfo(),
+						"clock":       clockMonitor.Last(),
 					},
 				}
 
@@ -557,6 +1201,7 @@ func main() {
 					"diskInfo":    diskInfo,
 					"diskUsage":   diskUsage, // 使用默认或真实磁盘使用率
 					"processes":   processes,
+					"clock":       clockMonitor.Last(),
 				},
 			}
 
@@ -709,7 +1354,7 @@ func main() {
 						<li>重启服务</li>
 					</ol>
 					<div class="status">服务器运行正常，API 接口可用</div>
-					<p class="info">当前版本: 1.0.0 | 服务器时间: `+time.Now().Format("2006-01-02 15:04:05")+`</p>
+					<p class="info">当前版本: `+version.Version+` | 服务器时间: `+time.Now().Format("2006-01-02 15:04:05")+`</p>
 				</div>
 			</body>
 			</html>
@@ -719,17 +1364,66 @@ func main() {
 		// 如果存在dist目录，则提供静态文件服务
 		r.StaticFS("/assets", http.Dir(filepath.Join(distDir, "assets")))
 		r.StaticFile("/favicon.ico", filepath.Join(distDir, "favicon.ico"))
+	}
 
-		// 处理所有前端路由
-		r.NoRoute(func(c *gin.Context) {
-			c.File(filepath.Join(distDir, "index.html"))
+	// 原 mux 路由均为管理接口（xray 控制、入站、系统诊断等），逐条注册到 adminGroup。
+	// SSE 端点的 EventSource 无法设置请求头，改用 /api/sse/token 签发的短期查询参数令牌
+	streamGroup := apiGroup.Group("", func(c *gin.Context) {
+		middleware.StreamAuthMiddleware(settingsManager.Get().Security.JWTSecret)(c)
+	}, middleware.AdminMiddleware())
+	adminGroup.POST("/sse/token", func(c *gin.Context) {
+		token, err := middleware.StreamToken(c, settingsManager.Get().Security.JWTSecret)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token":      token,
+			"expires_in": int(middleware.StreamTokenTTL.Seconds()),
+		})
+	})
+	if err := apiHandler.RegisterRoutes(adminGroup, streamGroup, r.Routes()); err != nil {
+		log.Fatal("Failed to register API routes", logger.Fields{
+			"error": err,
 		})
 	}
 
+	// 未注册的路由：/api 下返回 404，其余返回前端页面
+	r.NoRoute(func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		if _, err := os.Stat(distDir); err == nil {
+			c.File(filepath.Join(distDir, "index.html"))
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	})
+
 	// 创建HTTP服务器
+	serverSettings := settingsManager.Get().Server
+	listen := serverSettings.Listen
+	if listen == "" {
+		listen = ":8080"
+	}
+	handler := middleware.BasePath(settingsManager)(middleware.APIVersion()(middleware.Display(settingsManager)(middleware.Limits(settingsManager)(middleware.Standby(elector)(r)))))
 	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: r,
+		Addr:              listen,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	// 兼容旧版 API 端口的第二个监听地址，与主服务器共用路由
+	var legacySrv *http.Server
+	if serverSettings.LegacyListen != "" && serverSettings.LegacyListen != listen {
+		legacySrv = &http.Server{
+			Addr:              serverSettings.LegacyListen,
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+			IdleTimeout:       idleTimeout,
+		}
 	}
 
 	// 优雅关闭
@@ -743,8 +1437,20 @@ func main() {
 		}
 	}()
 
+	if legacySrv != nil {
+		go func() {
+			if err := legacySrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("Legacy HTTP server error", logger.Fields{
+					"error": err,
+				})
+			}
+		}()
+	}
+
 	log.Info("Server started", logger.Fields{
-		"address": ":8080",
+		"address":        listen,
+		"legacy_address": serverSettings.LegacyListen,
+		"base_path":      settings.NormalizeBasePath(serverSettings.BasePath),
 	})
 
 	// 确保信号通道被正确初始化
@@ -755,6 +1461,7 @@ func main() {
 	// 等待中断信号
 	<-quit
 	log.Info("Server shutting down")
+	inboundMirrors.StopAll()
 
 	// 设置关闭超时时间
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -766,10 +1473,212 @@ func main() {
 			"error": err,
 		})
 	}
+	if legacySrv != nil {
+		if err := legacySrv.Shutdown(ctx); err != nil {
+			log.Error("Legacy server forced to shutdown", logger.Fields{
+				"error": err,
+			})
+		}
+	}
 
 	log.Info("Server exited")
 }
 
+// runPanelCommand 按命令行选项生成随机的面板访问路径和端口，保存后打印面板访问地址
+func runPanelCommand(settingsMgr *settings.Manager, newBasePath, newPort bool) error {
+	if newBasePath || newPort {
+		next := settingsMgr.Clone()
+		if newBasePath {
+			path, err := settings.RandomBasePath()
+			if err != nil {
+				return err
+			}
+			next.Server.BasePath = path
+		}
+		if newPort {
+			listen, err := randomListen(next.Server.Listen)
+			if err != nil {
+				return err
+			}
+			next.Server.Listen = listen
+		}
+		if err := settingsMgr.Replace(next); err != nil {
+			return err
+		}
+	}
+
+	server := settingsMgr.Get().Server
+	listen := server.Listen
+	if listen == "" {
+		listen = ":8080"
+	}
+	basePath := settings.NormalizeBasePath(server.BasePath)
+	fmt.Printf("面板监听地址: %s\n", listen)
+	if basePath == "" {
+		fmt.Println("面板访问路径: 未设置，可使用 -random-base-path 生成")
+	} else {
+		fmt.Printf("面板访问路径: %s/\n", basePath)
+	}
+	if _, port, err := net.SplitHostPort(listen); err == nil {
+		fmt.Printf("访问地址: http://<服务器IP>:%s%s/\n", port, basePath)
+	}
+	if newBasePath || newPort {
+		fmt.Println("设置已保存，重启面板后生效")
+	}
+	return nil
+}
+
+// runEncryptDatabase 加密数据库中加密功能启用前写入的敏感列，可重复执行
+func runEncryptDatabase(settingsMgr *settings.Manager) error {
+	dbPath := settingsMgr.Get().Server.DatabasePath
+	if dbPath == "" {
+		dbPath = filepath.Join("data", "v.db")
+	}
+	db, err := model.OpenDB(dbPath, slog.Default())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	sqliteDB, ok := db.(*model.SQLiteDB)
+	if !ok {
+		return fmt.Errorf("database does not support column encryption")
+	}
+	result, err := sqliteDB.EncryptSensitiveColumns()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已加密: 用户 %d 个，协议 %d 个，协议版本 %d 个\n", result.Users, result.Protocols, result.Versions)
+	return nil
+}
+
+// runTop 解析 top 子命令参数并运行终端仪表盘。默认连接本机面板监听端口，
+// 未指定 -token 时使用设置中的 JWT 密钥签发短期管理员令牌
+func runTop(settingsMgr *settings.Manager, args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	panelURL := fs.String("url", "", "面板地址，默认根据设置连接本机，如 http://127.0.0.1:8080")
+	token := fs.String("token", os.Getenv("V_API_TOKEN"), "管理员令牌，默认使用本机设置签发")
+	interval := fs.Duration("interval", time.Second, "刷新间隔")
+	users := fs.Int("users", 10, "显示的用户数")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	server := settingsMgr.Get().Server
+	if *panelURL == "" {
+		listen := server.Listen
+		if listen == "" {
+			listen = ":8080"
+		}
+		host, port, err := net.SplitHostPort(listen)
+		if err != nil {
+			return fmt.Errorf("invalid listen address %q: %v", listen, err)
+		}
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		*panelURL = "http://" + net.JoinHostPort(host, port) + settings.NormalizeBasePath(server.BasePath)
+	}
+	if *token == "" {
+		t, err := middleware.LocalAdminToken(settingsMgr.Get().Security.JWTSecret, time.Hour)
+		if err != nil {
+			return fmt.Errorf("failed to issue admin token: %v", err)
+		}
+		*token = t
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	return top.New(top.Config{
+		URL:      *panelURL,
+		Token:    *token,
+		Interval: *interval,
+		Users:    *users,
+	}, os.Stdout).Run(ctx, os.Stdin)
+}
+
+// runLoadTest 解析 loadtest 子命令参数并执行压测，有操作失败时返回错误以便在 CI 中使用
+func runLoadTest(log *logger.Logger, args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	users := fs.Int("users", 100, "模拟拉取订阅的用户数")
+	fetchDelay := fs.Duration("fetch-delay", 0, "每个用户两次拉取订阅之间的间隔")
+	statsRate := fs.Int("stats-rate", 10, "每秒统计写入次数")
+	admins := fs.Int("admins", 4, "并发管理员数")
+	duration := fs.Duration("duration", 30*time.Second, "压测时长")
+	dbPath := fs.String("db", "", "测试实例数据库路径，默认使用临时数据库")
+	jsonOut := fs.Bool("json", false, "以 JSON 输出结果，便于对比多次运行")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := loadtest.New(log, loadtest.Config{
+		Users:      *users,
+		FetchDelay: *fetchDelay,
+		StatsRate:  *statsRate,
+		Admins:     *admins,
+		Duration:   *duration,
+		DBPath:     *dbPath,
+	}).Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		report.Print(os.Stdout)
+	}
+	if n := report.ErrorCount(); n > 0 {
+		return fmt.Errorf("%d operations failed", n)
+	}
+	return nil
+}
+
+// randomListen 保留监听地址中的主机部分，随机选择一个当前空闲的 10000-65535 端口
+func randomListen(listen string) (string, error) {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		host = ""
+	}
+	for i := 0; i < 20; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(55536))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate port: %v", err)
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(10000+int(n.Int64())))
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			continue
+		}
+		l.Close()
+		return addr, nil
+	}
+	return "", fmt.Errorf("failed to find a free port")
+}
+
+// reconcileXray 返回重新生成并写入 Xray 配置的同步函数，xray 运行中时由 UpdateConfig 重启生效。
+// 只有主节点控制 xray，备用实例上直接跳过
+func reconcileXray(elector *ha.Elector, xrayManager *xray.Manager) func() error {
+	return func() error {
+		if !elector.IsLeader() {
+			return nil
+		}
+		config, err := xrayManager.GenerateConfig()
+		if err != nil {
+			return err
+		}
+		return xrayManager.UpdateConfig(config)
+	}
+}
+
 // getProcessInfo 返回进程信息列表，根据操作系统返回不同的进程列表
 func getProcessInfo() []gin.H {
 	// 根据不同操作系统显示不同的典型进程
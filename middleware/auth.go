@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
 
@@ -17,6 +18,9 @@ type Claims struct {
 
 // generateToken 生成JWT令牌
 func generateToken(userID int64, username string, isAdmin bool, expiration time.Duration, secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("jwt secret is not configured")
+	}
 	// 设置JWT claims
 	claims := Claims{
 		UserID:   userID,
@@ -36,8 +40,83 @@ func generateToken(userID int64, username string, isAdmin bool, expiration time.
 	return token.SignedString([]byte(secret))
 }
 
+// localTokenSubject 本机命令行令牌的 subject，这类令牌没有登录会话
+const localTokenSubject = "local-cli"
+
+// maxLocalTokenTTL 没有会话的本机令牌允许的最长有效期
+const maxLocalTokenTTL = time.Hour
+
+// LocalAdminToken 为本机命令行工具（如 v top）签发短期管理员令牌，只有能读取面板设置中 JWT 密钥的用户才能使用
+func LocalAdminToken(secret string, expiration time.Duration) (string, error) {
+	if secret == "" {
+		return "", errors.New("jwt secret is not configured")
+	}
+	if expiration > maxLocalTokenTTL {
+		expiration = maxLocalTokenTTL
+	}
+	now := time.Now()
+	claims := Claims{
+		Username: "cli",
+		IsAdmin:  true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   localTokenSubject,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// isLocalToken 判断是否为 LocalAdminToken 签发的短期令牌
+func isLocalToken(claims *Claims) bool {
+	if claims.Subject != localTokenSubject || claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return false
+	}
+	return claims.ExpiresAt.Sub(claims.IssuedAt.Time) <= maxLocalTokenTTL
+}
+
+// streamTokenSubject 流令牌的 subject，只能通过 StreamAuthMiddleware 的查询参数使用
+const streamTokenSubject = "stream"
+
+// StreamTokenTTL 流令牌的有效期，只需覆盖前端拿到令牌到建立连接的时间
+const StreamTokenTTL = time.Minute
+
+// StreamToken 为已登录的请求签发短期流令牌，令牌沿用当前会话，会话注销后同样失效
+func StreamToken(c *gin.Context, secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("jwt secret is not configured")
+	}
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		return "", errors.New("request has no login session")
+	}
+	now := time.Now()
+	claims := Claims{
+		UserID:   c.GetInt64("user_id"),
+		Username: c.GetString("username"),
+		IsAdmin:  c.GetBool("is_admin"),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			Subject:   streamTokenSubject,
+			ExpiresAt: jwt.NewNumericDate(now.Add(StreamTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// isStreamToken 判断是否为 StreamToken 签发的令牌
+func isStreamToken(claims *Claims) bool {
+	return claims.Subject == streamTokenSubject
+}
+
 // validateToken 验证JWT令牌
 func validateToken(tokenString string, secret string) (*Claims, error) {
+	if secret == "" {
+		return nil, errors.New("jwt secret is not configured")
+	}
 	// 解析JWT令牌
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// 验证签名方法
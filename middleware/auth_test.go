@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"v/auth"
+	"v/logger"
+	"v/model"
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// newSession 在全局会话记录中为管理员创建会话，测试结束后注销
+func newSession(t *testing.T) *auth.Session {
+	t.Helper()
+	user := &model.User{Username: "admin", IsAdmin: true}
+	user.ID = 1
+	session, err := auth.Sessions().Create(user, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	t.Cleanup(func() { auth.Sessions().Revoke(user.ID, session.ID) })
+	return session
+}
+
+// signWithKey 用任意密钥签发带会话的管理员令牌，模拟攻击者自行构造的令牌
+func signWithKey(t *testing.T, key, sessionID string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:   1,
+		Username: "admin",
+		IsAdmin:  true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	signed, err := token.SignedString([]byte(key))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+// adminRouter 返回一个需要管理员登录的路由
+func adminRouter(secret string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin", AuthMiddleware(secret), AdminMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+// get 带令牌请求 /admin，返回状态码
+func get(r *gin.Engine, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAuthMiddlewareSecret(t *testing.T) {
+	session := newSession(t)
+
+	tests := []struct {
+		name    string
+		secret  string
+		signKey string
+		want    int
+	}{
+		{name: "token signed with the configured secret", secret: "configured", signKey: "configured", want: http.StatusOK},
+		{name: "token signed with another secret", secret: "configured", signKey: "guessed", want: http.StatusUnauthorized},
+		{name: "empty secret rejects empty-key token", secret: "", signKey: "", want: http.StatusUnauthorized},
+		{name: "empty secret rejects any token", secret: "", signKey: "anything", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(adminRouter(tt.secret), signWithKey(t, tt.signKey, session.ID)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LocalAdminToken("", time.Minute); err == nil {
+		t.Error("LocalAdminToken signed a token with an empty secret")
+	}
+}
+
+func TestAuthMiddlewareSession(t *testing.T) {
+	const secret = "configured"
+	r := adminRouter(secret)
+
+	session := newSession(t)
+	token := signWithKey(t, secret, session.ID)
+	if got := get(r, token); got != http.StatusOK {
+		t.Fatalf("active session: status = %d, want %d", got, http.StatusOK)
+	}
+
+	// 强制下线后同一令牌立即失效
+	if !auth.Sessions().Revoke(1, session.ID) {
+		t.Fatal("revoke session failed")
+	}
+	if got := get(r, token); got != http.StatusUnauthorized {
+		t.Errorf("revoked session: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	// 签名有效但没有会话的令牌不被接受
+	if got := get(r, signWithKey(t, secret, "")); got != http.StatusUnauthorized {
+		t.Errorf("token without session: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	// 本机命令行的短期令牌没有会话
+	local, err := LocalAdminToken(secret, time.Minute)
+	if err != nil {
+		t.Fatalf("LocalAdminToken: %v", err)
+	}
+	if got := get(r, local); got != http.StatusOK {
+		t.Errorf("local cli token: status = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestAuthMiddlewareAcceptsPanelTokens(t *testing.T) {
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	settingsMgr := settings.NewWithPath(log, filepath.Join(t.TempDir(), "settings.json"))
+	next := settingsMgr.Clone()
+	next.Security.JWTSecret = "configured"
+	if err := settingsMgr.Replace(next); err != nil {
+		t.Fatalf("Replace settings: %v", err)
+	}
+	auth.InitSessions(settingsMgr)
+	t.Cleanup(func() { auth.InitSessions(nil) })
+
+	// 单点登录和本地登录都通过 auth.GenerateToken 签发，路由使用同一个密钥校验
+	user := &model.User{Username: "sso-admin", IsAdmin: true}
+	user.ID = 2
+	token, err := auth.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if got := get(adminRouter("configured"), token); got != http.StatusOK {
+		t.Errorf("panel token: status = %d, want %d", got, http.StatusOK)
+	}
+	if got := get(adminRouter("your-secret-key"), token); got != http.StatusUnauthorized {
+		t.Errorf("token accepted with another secret: status = %d", got)
+	}
+
+	auth.InitSessions(nil)
+	if _, err := auth.GenerateToken(user); err == nil {
+		t.Error("GenerateToken signed a token without a configured secret")
+	}
+}
+
+func TestStreamAuthMiddleware(t *testing.T) {
+	const secret = "configured"
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/sse/token", AuthMiddleware(secret), func(c *gin.Context) {
+		token, err := StreamToken(c, secret)
+		if err != nil {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.String(http.StatusOK, token)
+	})
+	r.GET("/sse", StreamAuthMiddleware(secret), AdminMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/admin", AuthMiddleware(secret), AdminMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	session := newSession(t)
+	login := signWithKey(t, secret, session.ID)
+	req := httptest.NewRequest(http.MethodPost, "/sse/token", nil)
+	req.Header.Set("Authorization", "Bearer "+login)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("issue stream token: status = %d", w.Code)
+	}
+	stream := w.Body.String()
+
+	serve := func(target, bearer string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		bearer string
+		want   int
+	}{
+		{name: "stream token in query", target: "/sse?token=" + stream, want: http.StatusOK},
+		{name: "login token in header", target: "/sse", bearer: login, want: http.StatusOK},
+		{name: "no token", target: "/sse", want: http.StatusUnauthorized},
+		// 登录令牌不能出现在 URL 中，流令牌也不能当作普通登录令牌
+		{name: "login token in query", target: "/sse?token=" + login, want: http.StatusUnauthorized},
+		{name: "stream token in header", target: "/admin", bearer: stream, want: http.StatusUnauthorized},
+		{name: "stream token signed with another secret", target: "/sse?token=" + signWithKey(t, "guessed", session.ID), want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(tt.target, tt.bearer); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 流令牌沿用登录会话，注销后失效
+	auth.Sessions().Revoke(1, session.ID)
+	if got := serve("/sse?token="+stream, ""); got != http.StatusUnauthorized {
+		t.Errorf("stream token after logout: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"v/settings"
+)
+
+// basePathCookie 访问过面板路径后用于放行后续请求的 cookie
+const basePathCookie = "v_panel"
+
+// basePathPublicPrefixes 不受面板访问路径限制的路径，订阅链接会分发给客户端，不能暴露面板路径
+var basePathPublicPrefixes = []string{
+	APIPrefix + "sub/",
+	APIV1Prefix + "sub/",
+}
+
+// BasePath 只允许通过设置的面板访问路径进入面板，其他请求一律返回 404，避免扫描器发现管理界面。
+// 打开访问路径时写入 cookie 并跳转到首页，带 cookie 的请求按原路径处理，前端无需感知访问路径；
+// 脚本也可以直接在 API 路径前加上访问路径调用。未设置访问路径时不做处理。
+// 每次请求读取最新设置，必须包裹在 APIVersion 外层
+func BasePath(settingsMgr *settings.Manager) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			base := settings.NormalizeBasePath(settingsMgr.Get().Server.BasePath)
+			if base == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			path := r.URL.Path
+			token := basePathToken(base)
+			switch {
+			case path == base || path == base+"/":
+				http.SetCookie(w, &http.Cookie{
+					Name:     basePathCookie,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteStrictMode,
+				})
+				http.Redirect(w, r, "/", http.StatusFound)
+			case strings.HasPrefix(path, base+"/"):
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = strings.TrimPrefix(path, base)
+				r2.URL.RawPath = ""
+				r2.RequestURI = r2.URL.RequestURI()
+				next.ServeHTTP(w, r2)
+			case hasBasePathCookie(r, token) || isBasePathPublic(path):
+				next.ServeHTTP(w, r)
+			default:
+				http.NotFound(w, r)
+			}
+		})
+	}
+}
+
+// basePathToken 由访问路径生成 cookie 值，修改访问路径后旧 cookie 失效
+func basePathToken(base string) string {
+	sum := sha256.Sum256([]byte("v-panel:" + base))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasBasePathCookie 判断请求是否带有当前访问路径的 cookie
+func hasBasePathCookie(r *http.Request, token string) bool {
+	cookie, err := r.Cookie(basePathCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+}
+
+// isBasePathPublic 判断路径是否不受面板访问路径限制
+func isBasePathPublic(path string) bool {
+	for _, prefix := range basePathPublicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// defaultCORSMethods 未配置时允许的请求方法
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	// defaultCORSHeaders 未配置时允许的请求头
+	defaultCORSHeaders = []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "Accept", "Origin", "Cache-Control", "X-Requested-With", "X-API-Key"}
+)
+
+// CORSPolicy 根据设置生成跨域响应头，每次请求读取最新设置
+type CORSPolicy struct {
+	settings *settings.Manager
+}
+
+// NewCORSPolicy 创建跨域策略
+func NewCORSPolicy(settingsMgr *settings.Manager) *CORSPolicy {
+	return &CORSPolicy{settings: settingsMgr}
+}
+
+// Handler 返回 gin 中间件
+func (p *CORSPolicy) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !p.apply(c.Writer.Header(), c.Request) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if isPreflight(c.Request) {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware 返回标准 HTTP 中间件
+func (p *CORSPolicy) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !p.apply(w.Header(), r) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if isPreflight(r) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apply 写入跨域响应头，来源不被允许的预检请求返回 false
+func (p *CORSPolicy) apply(header http.Header, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	var cfg settings.CORSSettings
+	if p.settings != nil {
+		cfg = p.settings.Get().CORS
+	}
+
+	header.Add("Vary", "Origin")
+	if !originAllowed(cfg.AllowedOrigins, origin) {
+		// 普通请求交给浏览器拦截，预检请求直接拒绝
+		return !isPreflight(r)
+	}
+
+	// 允许携带凭证时不能使用通配符
+	if len(cfg.AllowedOrigins) == 0 && !cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if isPreflight(r) {
+		methods := cfg.AllowedMethods
+		if len(methods) == 0 {
+			methods = defaultCORSMethods
+		}
+		headers := cfg.AllowedHeaders
+		if len(headers) == 0 {
+			headers = defaultCORSHeaders
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		if cfg.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+		}
+	}
+
+	return true
+}
+
+// isPreflight 判断是否为预检请求
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// originAllowed 判断来源是否在允许列表中，列表为空表示允许所有。
+// 支持 * 和 https://*.example.com 形式的子域名通配
+func originAllowed(allowed []string, origin string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+
+		i := strings.Index(pattern, "*.")
+		if i < 0 {
+			continue
+		}
+
+		// 未写协议的规则匹配任意协议
+		target := origin
+		if !strings.Contains(pattern, "://") {
+			if j := strings.Index(target, "://"); j >= 0 {
+				target = target[j+3:]
+			}
+		}
+
+		prefix, suffix := pattern[:i], pattern[i+1:]
+		if len(target) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(target, prefix) &&
+			strings.HasSuffix(target, suffix) &&
+			!strings.Contains(target[len(prefix):len(target)-len(suffix)], "/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"v/crash"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CrashRecovery 恢复请求处理中的 panic 并生成崩溃报告，请求返回 500，面板继续运行
+func CrashRecovery(reporter *crash.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				report := reporter.Capture(c.Request.Method+" "+c.Request.URL.Path, err, debug.Stack())
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"success":  false,
+					"message":  "服务器内部错误",
+					"crash_id": report.ID,
+				})
+			}
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"v/settings"
+)
+
+// DisplayLocale 展示字符串的本地化格式
+type DisplayLocale struct {
+	Tag      string // 语言标签，如 zh、en
+	Decimal  string // 小数点
+	Group    string // 千位分隔符
+	DateTime string // 日期时间格式（Go 时间格式）
+	Date     string // 日期格式
+}
+
+// displayLocales 支持的展示语言，第一个为默认语言
+var displayLocales = []DisplayLocale{
+	{Tag: "zh", Decimal: ".", Group: ",", DateTime: "2006年1月2日 15:04:05", Date: "2006年1月2日"},
+	{Tag: "en", Decimal: ".", Group: ",", DateTime: "Jan 2, 2006 15:04:05", Date: "Jan 2, 2006"},
+	{Tag: "de", Decimal: ",", Group: ".", DateTime: "02.01.2006 15:04:05", Date: "02.01.2006"},
+	{Tag: "fr", Decimal: ",", Group: " ", DateTime: "02/01/2006 15:04:05", Date: "02/01/2006"},
+	{Tag: "ru", Decimal: ",", Group: " ", DateTime: "02.01.2006 15:04:05", Date: "02.01.2006"},
+}
+
+// displaySuffix 展示字段名后缀，如 upload 对应 upload_display
+const displaySuffix = "_display"
+
+// byteFields 按字节计的流量和容量字段
+var byteFields = map[string]bool{
+	"upload": true, "download": true, "up": true, "down": true,
+	"total_upload": true, "total_download": true, "daily_upload": true, "daily_download": true,
+	"traffic_limit": true, "traffic_used": true, "used": true,
+	"bytes_sent": true, "bytes_recv": true, "network_bytes_sent": true, "network_bytes_received": true,
+	"memory_used": true, "memory_total": true, "disk_used": true, "disk_total": true,
+}
+
+// rateFields 按字节每秒计的速率字段
+var rateFields = map[string]bool{
+	"up_speed": true, "down_speed": true,
+}
+
+// timeFields 不以 _at 结尾的时间字段
+var timeFields = map[string]bool{
+	"time": true, "timestamp": true, "date": true, "start_time": true, "end_time": true, "start": true, "end": true,
+}
+
+// Display 为带 display 查询参数的 GET 请求在 JSON 响应中追加展示字符串：流量字段（如 upload）追加
+// upload_display（如 "1.5 GB"），时间字段（如 created_at）追加 created_at_display，原始值保持不变，
+// 便于轻量前端和机器人直接展示。display=1 时按 Accept-Language 选择语言，也可直接指定如 display=en；
+// tz 参数指定时区，默认使用面板时区。应包裹在 APIVersion 内层，展示字段会随数据一起被统一包装
+func Display(settingsMgr *settings.Manager) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			value, ok := query["display"]
+			if !ok || r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, APIPrefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			loc := settingsMgr.Location()
+			if tz := query.Get("tz"); tz != "" {
+				if l, err := time.LoadLocation(tz); err == nil {
+					loc = l
+				}
+			}
+			f := &displayFormatter{
+				locale: resolveDisplayLocale(value[0], r.Header.Get("Accept-Language")),
+				loc:    loc,
+			}
+
+			dw := &displayWriter{ResponseWriter: w, status: http.StatusOK}
+			w.Header().Set("Content-Language", f.locale.Tag)
+			next.ServeHTTP(dw, r)
+			dw.finish(f)
+		})
+	}
+}
+
+// resolveDisplayLocale 按 display 参数或 Accept-Language 选择展示语言，都不支持时使用默认语言
+func resolveDisplayLocale(param, acceptLanguage string) DisplayLocale {
+	if locale, ok := lookupDisplayLocale(param); ok {
+		return locale
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if locale, ok := lookupDisplayLocale(tag); ok {
+			return locale
+		}
+	}
+	return displayLocales[0]
+}
+
+// lookupDisplayLocale 按语言标签的主标签查找，如 en-US 匹配 en
+func lookupDisplayLocale(tag string) (DisplayLocale, bool) {
+	primary := strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(primary, "-_"); i >= 0 {
+		primary = primary[:i]
+	}
+	for _, locale := range displayLocales {
+		if locale.Tag == primary {
+			return locale, true
+		}
+	}
+	return DisplayLocale{}, false
+}
+
+// parseAcceptLanguage 解析 Accept-Language，按权重从高到低返回语言标签
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// displayFormatter 按语言和时区生成展示字符串
+type displayFormatter struct {
+	locale DisplayLocale
+	loc    *time.Location
+}
+
+// annotate 递归为对象中可识别的字段追加展示字符串，已有同名展示字段时不覆盖
+func (f *displayFormatter) annotate(v interface{}) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			f.annotate(item)
+		}
+	case map[string]interface{}:
+		// total 只有与 upload/download 同时出现时才表示流量，其他地方（如任务统计）通常是计数
+		_, hasUp := v["upload"]
+		_, hasDown := v["download"]
+		trafficTotal := hasUp || hasDown
+
+		display := make(map[string]string)
+		for key, value := range v {
+			if strings.HasSuffix(key, displaySuffix) {
+				continue
+			}
+			f.annotate(value)
+			if s, ok := f.format(key, value, trafficTotal); ok {
+				display[key+displaySuffix] = s
+			}
+		}
+		for key, s := range display {
+			if _, exists := v[key]; !exists {
+				v[key] = s
+			}
+		}
+	}
+}
+
+// format 返回字段的展示字符串，无法识别的字段返回 false
+func (f *displayFormatter) format(key string, value interface{}, trafficTotal bool) (string, bool) {
+	switch value := value.(type) {
+	case json.Number:
+		n, err := value.Float64()
+		if err != nil {
+			return "", false
+		}
+		switch {
+		case byteFields[key] || strings.HasSuffix(key, "_bytes") || (key == "total" && trafficTotal):
+			return f.bytes(n), true
+		case rateFields[key]:
+			return f.bytes(n) + "/s", true
+		}
+	case string:
+		if !strings.HasSuffix(key, "_at") && !timeFields[key] {
+			return "", false
+		}
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			if t.IsZero() {
+				return "", false
+			}
+			return t.In(f.loc).Format(f.locale.DateTime), true
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t.Format(f.locale.Date), true
+		}
+	}
+	return "", false
+}
+
+// bytes 按 1024 进制格式化字节数，如 1.5 GB，流量调整记录可为负数
+func (f *displayFormatter) bytes(n float64) string {
+	const unit = 1024
+	if n < 0 {
+		return "-" + f.bytes(-n)
+	}
+	if n < unit {
+		return f.number(n, 0) + " B"
+	}
+	div, exp := float64(unit), 0
+	for v := n / unit; v >= unit && exp < 5; v /= unit {
+		div *= unit
+		exp++
+	}
+	return f.number(n/div, 2) + " " + string("KMGTPE"[exp]) + "B"
+}
+
+// number 按语言的小数点和千位分隔符格式化数字，去掉末尾多余的 0
+func (f *displayFormatter) number(n float64, decimals int) string {
+	s := strconv.FormatFloat(n, 'f', decimals, 64)
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	fracPart = strings.TrimRight(fracPart, "0")
+
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(f.locale.Group)
+		}
+		b.WriteRune(c)
+	}
+	if fracPart != "" {
+		b.WriteString(f.locale.Decimal)
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+// displayWriter 缓冲 JSON 响应以便追加展示字段，非 JSON 和流式响应直接透传
+type displayWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+// WriteHeader 记录状态码，JSON 响应延迟到 finish 时写出
+func (w *displayWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	contentType := w.Header().Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "json") {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write 缓冲 JSON 响应
+func (w *displayWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// Flush 流式响应无法改写，切换为透传
+func (w *displayWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 支持 WebSocket 升级
+func (w *displayWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.passthrough = true
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// finish 写出追加展示字段后的响应，解析失败或出错的响应原样写出
+func (w *displayWriter) finish(f *displayFormatter) {
+	if w.passthrough {
+		return
+	}
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+	}
+
+	body := w.buf.Bytes()
+	if w.status < http.StatusBadRequest {
+		// 使用 json.Number 保留原始数值的精度和格式
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var raw interface{}
+		if err := dec.Decode(&raw); err == nil {
+			f.annotate(raw)
+			if annotated, err := json.Marshal(raw); err == nil {
+				body = annotated
+			}
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
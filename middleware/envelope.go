@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// APIPrefix 旧版 API 前缀
+	APIPrefix = "/api/"
+	// APIV1Prefix 版本化 API 前缀
+	APIV1Prefix = "/api/v1/"
+	// APISunset 旧版 API 计划下线时间（RFC 8594）
+	APISunset = "Wed, 30 Jun 2027 23:59:59 GMT"
+)
+
+// Envelope 统一的 API 响应结构
+type Envelope struct {
+	Success bool        `json:"success"`
+	Code    int         `json:"code"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// APIVersion 将 /api/v1/* 请求转发到现有的 /api/* 处理器并统一响应结构，
+// 同时为旧的 /api/* 路径添加弃用响应头。必须包裹在路由器外层，以便在路由匹配前改写路径。
+func APIVersion() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if path == "/api/v1" || strings.HasPrefix(path, APIV1Prefix) {
+				rest := strings.TrimPrefix(strings.TrimPrefix(path, "/api/v1"), "/")
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = APIPrefix + rest
+				r2.URL.RawPath = ""
+				r2.RequestURI = r2.URL.RequestURI()
+
+				ew := &envelopeWriter{ResponseWriter: w, status: http.StatusOK}
+				w.Header().Set("X-API-Version", "v1")
+				next.ServeHTTP(ew, r2)
+				ew.finish()
+				return
+			}
+
+			if strings.HasPrefix(path, APIPrefix) {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Sunset", APISunset)
+				w.Header().Set("Link", "<"+APIV1Prefix+strings.TrimPrefix(path, APIPrefix)+`>; rel="successor-version"`)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// envelopeWriter 缓冲 JSON 响应并在结束时包装成统一结构，
+// 非 JSON 响应（如 SSE、文件下载）直接透传
+type envelopeWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+// WriteHeader 记录状态码，JSON 响应延迟到 finish 时写出
+func (w *envelopeWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	contentType := w.Header().Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "json") {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write 缓冲 JSON 响应
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// Flush 流式响应无法包装，切换为透传
+func (w *envelopeWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 支持 WebSocket 升级
+func (w *envelopeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.passthrough = true
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// finish 写出包装后的响应
+func (w *envelopeWriter) finish() {
+	if w.passthrough {
+		return
+	}
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+	}
+
+	body, err := json.Marshal(NormalizeEnvelope(w.status, w.buf.Bytes()))
+	if err != nil {
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buf.Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
+
+// NormalizeEnvelope 将现有处理器的各种响应格式（{success,message,data}、{code,message,data}、
+// {error} 或裸对象）转换为统一结构
+func NormalizeEnvelope(status int, body []byte) *Envelope {
+	env := &Envelope{
+		Success: status < http.StatusBadRequest,
+		Code:    status,
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return env
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		env.Data = string(body)
+		return env
+	}
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		env.Data = raw
+		return env
+	}
+
+	_, hasSuccess := obj["success"]
+	_, hasCode := obj["code"]
+	_, hasData := obj["data"]
+	_, hasError := obj["error"]
+	if !hasSuccess && !hasCode && !hasData && !hasError {
+		env.Data = obj
+		return env
+	}
+
+	if success, ok := obj["success"].(bool); ok {
+		env.Success = success && env.Success
+	}
+	if code, ok := obj["code"].(float64); ok && code >= http.StatusBadRequest {
+		env.Success = false
+	}
+	if message, ok := obj["message"].(string); ok {
+		env.Message = message
+	}
+	if e, ok := obj["error"].(string); ok && e != "" {
+		env.Error = e
+		env.Success = false
+	}
+
+	if hasData {
+		env.Data = obj["data"]
+		return env
+	}
+
+	// 没有 data 字段时，其余字段作为数据返回
+	data := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		switch k {
+		case "success", "code", "message", "error":
+			continue
+		}
+		data[k] = v
+	}
+	if len(data) > 0 {
+		env.Data = data
+	}
+	return env
+}
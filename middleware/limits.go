@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"v/settings"
+)
+
+// 请求限制的默认值
+const (
+	defaultMaxBodySize    int64 = 1 << 20  // 普通 JSON 请求 1MB
+	defaultMaxUploadSize  int64 = 64 << 20 // 证书、配置备份等上传 64MB
+	defaultRequestTimeout       = 30 * time.Second
+	defaultUploadTimeout        = 5 * time.Minute
+)
+
+// routeClass 路由的限制类别
+type routeClass int
+
+const (
+	routeNormal routeClass = iota // 普通请求，使用 MaxBodySize 和 RequestTimeout
+	routeUpload                   // 上传文件，使用 MaxUploadSize 和 UploadTimeout
+	routeLong                     // 耗时操作（下载 xray、申请证书等），使用 UploadTimeout
+	routeStream                   // 长连接和文件下载，不限制处理时间
+)
+
+// routeRule 按路径前缀和方法匹配的路由类别，Methods 为空时匹配所有方法
+type routeRule struct {
+	Prefix  string
+	Methods []string
+	Class   routeClass
+}
+
+// routeRules 按顺序匹配，未匹配的请求按普通请求处理
+var routeRules = []routeRule{
+	{Prefix: APIPrefix + "sse/", Class: routeStream},
+	{Prefix: "/ws", Class: routeStream},
+	{Prefix: APIPrefix + "logs/export", Class: routeStream},
+	{Prefix: APIPrefix + "debug/", Class: routeStream},
+	// 长轮询由处理器自行限制最长等待时间（见 api/events.go 的 maxPollTimeout），不能受普通请求超时截断
+	{Prefix: APIPrefix + "events/poll", Methods: []string{http.MethodGet}, Class: routeStream},
+	{Prefix: APIPrefix + "backups/", Methods: []string{http.MethodGet}, Class: routeStream},
+	{Prefix: APIPrefix + "certificates", Methods: []string{http.MethodPost}, Class: routeUpload},
+	{Prefix: APIPrefix + "ssl", Methods: []string{http.MethodPost}, Class: routeUpload},
+	{Prefix: APIPrefix + "settings/restore", Class: routeUpload},
+	{Prefix: APIPrefix + "xray/version", Class: routeLong},
+	{Prefix: APIPrefix + "xray/switch-version", Class: routeLong},
+	{Prefix: APIPrefix + "xray/external/", Class: routeLong},
+	{Prefix: APIPrefix + "backups", Methods: []string{http.MethodPost}, Class: routeLong},
+}
+
+// Limits 按路由限制请求体大小和处理时间，防止超大请求和慢速连接占满资源。
+// 声明的长度超过上限时直接返回 413，读取时超过上限会出错；处理超时返回 503，
+// 同时为连接设置读取截止时间，避免慢速发送请求体的连接长期占用。
+// 每次请求读取最新设置，应包裹在 APIVersion 内层以便按规范化后的路径匹配
+func Limits(settingsMgr *settings.Manager) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			maxBody, timeout := routeLimits(settingsMgr.Get().Server, classifyRoute(r))
+
+			if r.ContentLength > maxBody {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// 不支持设置截止时间的连接（如 HTTP/2 之外的测试环境）忽略错误
+			http.NewResponseController(w).SetReadDeadline(time.Now().Add(timeout))
+			http.TimeoutHandler(next, timeout, `{"success":false,"message":"请求处理超时"}`).ServeHTTP(w, r)
+		})
+	}
+}
+
+// classifyRoute 返回请求所属的限制类别
+func classifyRoute(r *http.Request) routeClass {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return routeStream
+	}
+	for _, rule := range routeRules {
+		if !strings.HasPrefix(r.URL.Path, rule.Prefix) {
+			continue
+		}
+		if len(rule.Methods) > 0 && !containsMethod(rule.Methods, r.Method) {
+			continue
+		}
+		return rule.Class
+	}
+	return routeNormal
+}
+
+// routeLimits 返回类别对应的请求体上限和处理超时，超时为 0 表示不限制
+func routeLimits(s settings.ServerSettings, class routeClass) (int64, time.Duration) {
+	maxBody, maxUpload := s.MaxBodySize, s.MaxUploadSize
+	if maxBody <= 0 {
+		maxBody = defaultMaxBodySize
+	}
+	if maxUpload <= 0 {
+		maxUpload = defaultMaxUploadSize
+	}
+	requestTimeout, uploadTimeout := s.RequestTimeout, s.UploadTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	if uploadTimeout <= 0 {
+		uploadTimeout = defaultUploadTimeout
+	}
+
+	switch class {
+	case routeUpload:
+		return maxUpload, uploadTimeout
+	case routeLong:
+		return maxBody, uploadTimeout
+	case routeStream:
+		return maxBody, 0
+	default:
+		return maxBody, requestTimeout
+	}
+}
+
+// containsMethod 判断方法是否在列表中
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+func TestLimitsRequestTimeout(t *testing.T) {
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	settingsMgr := settings.NewWithPath(log, filepath.Join(t.TempDir(), "settings.json"))
+	next := settingsMgr.Clone()
+	next.Server.RequestTimeout = 20 * time.Millisecond
+	if err := settingsMgr.Replace(next); err != nil {
+		t.Fatalf("Replace settings: %v", err)
+	}
+
+	// 处理时间超过普通请求超时
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := Limits(settingsMgr)(slow)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{name: "normal request times out", method: http.MethodGet, path: "/api/system/info", want: http.StatusServiceUnavailable},
+		{name: "long poll waits past the request timeout", method: http.MethodGet, path: "/api/events/poll", want: http.StatusOK},
+		{name: "sse stream is not limited", method: http.MethodGet, path: "/api/sse/xray-events", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
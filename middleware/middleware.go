@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"v/auth"
 	"v/errors"
 	"v/logger"
 
@@ -15,6 +16,14 @@ import (
 // AuthMiddleware handles authentication
 func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 空密钥签名的令牌任何人都能伪造，未配置密钥时拒绝所有认证
+		if jwtSecret == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication is not configured",
+			})
+			return
+		}
+
 		// Get token from header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -33,21 +42,64 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		// Validate token
-		token := parts[1]
-		claims, err := validateToken(token, jwtSecret)
-		if err != nil {
+		authenticate(c, parts[1], jwtSecret, false)
+	}
+}
+
+// StreamAuthMiddleware 用于 SSE 等浏览器无法设置请求头的长连接，除 Authorization 头外
+// 还接受 token 查询参数，查询参数只能是 StreamToken 签发的短期令牌
+func StreamAuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	header := AuthMiddleware(jwtSecret)
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			header(c)
+			return
+		}
+		if jwtSecret == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
+				"error": "Authentication is not configured",
 			})
 			return
 		}
+		authenticate(c, token, jwtSecret, true)
+	}
+}
 
-		// Set user info in context
-		c.Set("user_id", claims.UserID)
-		c.Set("is_admin", claims.IsAdmin)
-		c.Next()
+// authenticate 校验令牌和登录会话并写入用户信息。stream 为 true 时只接受流令牌，
+// 否则拒绝流令牌，避免出现在 URL 和访问日志中的令牌被当作普通登录令牌使用
+func authenticate(c *gin.Context, token, jwtSecret string, stream bool) {
+	claims, err := validateToken(token, jwtSecret)
+	if err != nil || isStreamToken(claims) != stream {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid token",
+		})
+		return
 	}
+
+	// 登录令牌对应一个会话，注销、无操作超时或超出管理员会话数后立即失效。
+	// 只有本机命令行的短期令牌没有会话
+	if !isLocalToken(claims) {
+		if claims.ID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid token",
+			})
+			return
+		}
+		if _, err := auth.Sessions().Touch(claims.ID); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Session expired",
+			})
+			return
+		}
+	}
+
+	// Set user info in context
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("is_admin", claims.IsAdmin)
+	c.Set("session_id", claims.ID)
+	c.Next()
 }
 
 // AdminMiddleware ensures the user is an admin
@@ -140,22 +192,6 @@ func ErrorMiddleware(log *logger.Logger) gin.HandlerFunc {
 	}
 }
 
-// CORSMiddleware handles CORS
-func CORSMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	}
-}
-
 // RecoveryMiddleware recovers from panics
 func RecoveryMiddleware(log *logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
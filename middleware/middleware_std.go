@@ -69,24 +69,6 @@ func Recovery(log *logger.Logger) Middleware {
 	}
 }
 
-// CORS 跨域资源共享中间件
-func CORS() Middleware {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusNoContent)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
 // 速率限制器
 var limiter = rate.NewLimiter(1, 5) // 默认1个请求/秒，突发最多5个请求
 
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// LeaderHeader 备用实例拒绝写请求时返回主节点地址的响应头
+const LeaderHeader = "X-Leader-Address"
+
+// LeaderChecker 判断本实例是否为主节点
+type LeaderChecker interface {
+	IsLeader() bool
+	LeaderAddress() string
+}
+
+// standbyWritablePrefixes 备用实例上仍允许写请求的路径，登录会话保存在各实例本地
+var standbyWritablePrefixes = []string{
+	APIPrefix + "auth/",
+}
+
+// Standby 主备模式下备用实例只提供只读 API，写请求返回 503 并在响应头中给出主节点地址，
+// 客户端或前置负载均衡可以据此重试到主节点。应包裹在 APIVersion 内层以便按规范化后的路径匹配
+func Standby(checker LeaderChecker) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isStandbyBlocked(r) || checker.IsLeader() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			leader := checker.LeaderAddress()
+			if leader != "" {
+				w.Header().Set(LeaderHeader, leader)
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "当前实例为备用节点，只提供只读访问",
+				"leader":  leader,
+			})
+		})
+	}
+}
+
+// isStandbyBlocked 判断请求是否为备用实例上不允许的写请求
+func isStandbyBlocked(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if !strings.HasPrefix(r.URL.Path, APIPrefix) {
+		return false
+	}
+	for _, prefix := range standbyWritablePrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,453 @@
+package middleware
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// usageBucketSize 统计数据的最小时间粒度
+	usageBucketSize = time.Minute
+	// defaultUsageRetention 未配置时统计数据的保留时长
+	defaultUsageRetention = 24 * time.Hour
+	// errorWindow 计算错误率的时间窗口
+	errorWindow = 5 * time.Minute
+	// minErrorSamples 计算错误率所需的最少请求数
+	minErrorSamples = 20
+	// penaltyFactor 错误率过高时限速收紧的倍数
+	penaltyFactor = 4
+	// maxTrackedKeys 同时保留限速器和错误率的调用方数量上限，超出时淘汰最久未出现的调用方
+	maxTrackedKeys = 10000
+	// maxBucketEntries 单个时间桶内的统计条目上限，超出后新的调用方计入 overflowKey
+	maxBucketEntries = 10000
+	// overflowKey 超出统计条目上限时使用的调用方标识
+	overflowKey = "other"
+)
+
+// usageKey 统计维度
+type usageKey struct {
+	key   string
+	route string
+}
+
+// usageCounter 单个时间桶内的计数
+type usageCounter struct {
+	requests   int64
+	errors     int64
+	throttled  int64
+	latency    time.Duration
+	maxLatency time.Duration
+}
+
+// errorSlots 错误率窗口覆盖的时间桶数量，窗口起点按时间桶取整，需要多留一个
+const errorSlots = int(errorWindow/usageBucketSize) + 1
+
+// errorSlot 单个时间桶内某个密钥的请求数和错误数
+type errorSlot struct {
+	start    int64
+	requests int64
+	errors   int64
+}
+
+// errorCounts 密钥最近几个时间桶的请求数和错误数，按时间桶循环复用，
+// 计算错误率时不需要遍历全部统计数据
+type errorCounts struct {
+	slots    [errorSlots]errorSlot
+	lastSeen time.Time
+}
+
+// keyLimiter 单个 API 密钥的限速器
+type keyLimiter struct {
+	limiter   *rate.Limiter
+	penalized bool
+	lastSeen  time.Time
+}
+
+// UsageBucket 时间桶内某个密钥和路由的使用统计
+type UsageBucket struct {
+	Start        time.Time `json:"start"`
+	Key          string    `json:"key"`
+	Route        string    `json:"route"`
+	Requests     int64     `json:"requests"`
+	Errors       int64     `json:"errors"`
+	Throttled    int64     `json:"throttled"`
+	ErrorRate    float64   `json:"error_rate"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	MaxLatencyMs float64   `json:"max_latency_ms"`
+}
+
+// KeyUsage 某个密钥在查询区间内的汇总
+type KeyUsage struct {
+	Key          string  `json:"key"`
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	Throttled    int64   `json:"throttled"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	Penalized    bool    `json:"penalized"`
+}
+
+// UsageTracker 按 API 密钥和路由统计请求数、错误率和延迟，并按密钥限速
+type UsageTracker struct {
+	settings *settings.Manager
+
+	mu       sync.Mutex
+	buckets  map[int64]map[usageKey]*usageCounter
+	limiters map[string]*keyLimiter
+	errors   map[string]*errorCounts
+	// recent 按最近出现时间排列的调用方，用于限制 limiters 和 errors 的大小
+	recent   *list.List
+	recentAt map[string]*list.Element
+}
+
+// NewUsageTracker 创建 API 使用统计
+func NewUsageTracker(settingsMgr *settings.Manager) *UsageTracker {
+	return &UsageTracker{
+		settings: settingsMgr,
+		buckets:  make(map[int64]map[usageKey]*usageCounter),
+		limiters: make(map[string]*keyLimiter),
+		errors:   make(map[string]*errorCounts),
+		recent:   list.New(),
+		recentAt: make(map[string]*list.Element),
+	}
+}
+
+// Handler 返回统计和限速中间件
+func (t *UsageTracker) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		key := t.RequestKey(c)
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		if !t.allow(key, start) {
+			t.record(key, route, start, 0, false, true)
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": "请求过于频繁",
+				"error":   "Rate limit exceeded",
+			})
+			return
+		}
+
+		c.Next()
+
+		failed := c.Writer.Status() >= http.StatusInternalServerError ||
+			(c.Writer.Status() >= http.StatusBadRequest && c.Writer.Status() != http.StatusNotFound)
+		t.record(key, route, start, time.Since(start), failed, false)
+	}
+}
+
+// RequestKey 返回请求的统计标识：签名有效的 Bearer 令牌按用户统计，其余请求按客户端 IP。
+// 未经校验的请求头不作为标识，否则每次换一个随机值就能绕过限速并撑大统计数据
+func (t *UsageTracker) RequestKey(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		secret := t.settings.Get().Security.JWTSecret
+		if claims, err := validateToken(strings.TrimPrefix(header, "Bearer "), secret); err == nil {
+			if isLocalToken(claims) {
+				return "local:" + claims.Username
+			}
+			return "user:" + strconv.FormatInt(claims.UserID, 10)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// allow 检查密钥是否超出限速
+func (t *UsageTracker) allow(key string, now time.Time) bool {
+	s := t.settings.Get().Security
+	if s.APIRateLimit <= 0 {
+		return true
+	}
+
+	burst := s.APIRateBurst
+	if burst <= 0 {
+		burst = int(math.Ceil(s.APIRateLimit))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.limiters[key]
+	if !ok {
+		l = &keyLimiter{limiter: rate.NewLimiter(rate.Limit(s.APIRateLimit), burst)}
+		t.limiters[key] = l
+	}
+	l.lastSeen = now
+	t.touchLocked(key)
+
+	// 错误率过高的密钥收紧限速，恢复后还原
+	penalize := s.APIErrorThreshold > 0 && t.errorRateLocked(key, now) > s.APIErrorThreshold
+	limit := rate.Limit(s.APIRateLimit)
+	if penalize {
+		limit /= penaltyFactor
+	}
+	if l.limiter.Limit() != limit || l.limiter.Burst() != burst {
+		l.limiter.SetLimitAt(now, limit)
+		l.limiter.SetBurstAt(now, burst)
+	}
+	l.penalized = penalize
+
+	return l.limiter.AllowN(now, 1)
+}
+
+// errorRateLocked 计算密钥最近一段时间的错误率，调用方需持有锁
+func (t *UsageTracker) errorRateLocked(key string, now time.Time) float64 {
+	counts, ok := t.errors[key]
+	if !ok {
+		return 0
+	}
+	from := now.Add(-errorWindow).Truncate(usageBucketSize).Unix()
+	var requests, errors int64
+	for _, slot := range counts.slots {
+		if slot.start >= from {
+			requests += slot.requests
+			errors += slot.errors
+		}
+	}
+	if requests < minErrorSamples {
+		return 0
+	}
+	return float64(errors) / float64(requests)
+}
+
+// record 记录一次请求
+func (t *UsageTracker) record(key, route string, now time.Time, latency time.Duration, failed, throttled bool) {
+	bucket := now.Truncate(usageBucketSize).Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counters, ok := t.buckets[bucket]
+	if !ok {
+		counters = make(map[usageKey]*usageCounter)
+		t.buckets[bucket] = counters
+		t.pruneLocked(now)
+	}
+
+	k := usageKey{key: key, route: route}
+	counter, ok := counters[k]
+	if !ok {
+		if len(counters) >= maxBucketEntries {
+			k.key = overflowKey
+			counter, ok = counters[k]
+		}
+		if !ok {
+			counter = &usageCounter{}
+			counters[k] = counter
+		}
+	}
+
+	if throttled {
+		counter.throttled++
+		return
+	}
+	counter.requests++
+	if failed {
+		counter.errors++
+	}
+	t.countErrorLocked(key, bucket, now, failed)
+	counter.latency += latency
+	if latency > counter.maxLatency {
+		counter.maxLatency = latency
+	}
+}
+
+// countErrorLocked 将请求计入密钥的错误率窗口，调用方需持有锁
+func (t *UsageTracker) countErrorLocked(key string, bucket int64, now time.Time, failed bool) {
+	counts, ok := t.errors[key]
+	if !ok {
+		counts = &errorCounts{}
+		t.errors[key] = counts
+	}
+	counts.lastSeen = now
+	t.touchLocked(key)
+
+	slot := &counts.slots[int(bucket/int64(usageBucketSize/time.Second))%errorSlots]
+	if slot.start != bucket {
+		*slot = errorSlot{start: bucket}
+	}
+	slot.requests++
+	if failed {
+		slot.errors++
+	}
+}
+
+// touchLocked 将调用方移到最近出现的位置，超出 maxTrackedKeys 时淘汰最久未出现的调用方，调用方需持有锁
+func (t *UsageTracker) touchLocked(key string) {
+	if e, ok := t.recentAt[key]; ok {
+		t.recent.MoveToFront(e)
+		return
+	}
+	t.recentAt[key] = t.recent.PushFront(key)
+	for t.recent.Len() > maxTrackedKeys {
+		t.forgetLocked(t.recent.Back().Value.(string))
+	}
+}
+
+// forgetLocked 删除调用方的限速器和错误率，调用方需持有锁
+func (t *UsageTracker) forgetLocked(key string) {
+	if e, ok := t.recentAt[key]; ok {
+		t.recent.Remove(e)
+		delete(t.recentAt, key)
+	}
+	delete(t.limiters, key)
+	delete(t.errors, key)
+}
+
+// pruneLocked 清理过期的统计数据和闲置的限速器，调用方需持有锁
+func (t *UsageTracker) pruneLocked(now time.Time) {
+	retention := t.settings.Get().Security.APIUsageRetention
+	if retention <= 0 {
+		retention = defaultUsageRetention
+	}
+
+	cutoff := now.Add(-retention).Unix()
+	for start := range t.buckets {
+		if start < cutoff {
+			delete(t.buckets, start)
+		}
+	}
+
+	for key, l := range t.limiters {
+		if now.Sub(l.lastSeen) > errorWindow {
+			delete(t.limiters, key)
+		}
+	}
+	for key, counts := range t.errors {
+		if now.Sub(counts.lastSeen) > errorWindow {
+			delete(t.errors, key)
+		}
+	}
+	for key := range t.recentAt {
+		if _, ok := t.limiters[key]; ok {
+			continue
+		}
+		if _, ok := t.errors[key]; !ok {
+			t.forgetLocked(key)
+		}
+	}
+}
+
+// Usage 返回 since 之后按 interval 聚合的使用统计，key 为空时返回所有密钥
+func (t *UsageTracker) Usage(since time.Time, interval time.Duration, key string) ([]*UsageBucket, []*KeyUsage) {
+	if interval < usageBucketSize {
+		interval = usageBucketSize
+	}
+	from := since.Truncate(usageBucketSize).Unix()
+
+	type aggKey struct {
+		start int64
+		usageKey
+	}
+	agg := make(map[aggKey]*usageCounter)
+	totals := make(map[string]*usageCounter)
+
+	t.mu.Lock()
+	for start, counters := range t.buckets {
+		if start < from {
+			continue
+		}
+		slot := time.Unix(start, 0).Truncate(interval).Unix()
+		for k, counter := range counters {
+			if key != "" && k.key != key {
+				continue
+			}
+			merge(agg, aggKey{slot, k}, counter)
+			merge(totals, k.key, counter)
+		}
+	}
+	penalized := make(map[string]bool, len(t.limiters))
+	for k, l := range t.limiters {
+		penalized[k] = l.penalized
+	}
+	t.mu.Unlock()
+
+	buckets := make([]*UsageBucket, 0, len(agg))
+	for k, c := range agg {
+		errRate, avg := c.rates()
+		buckets = append(buckets, &UsageBucket{
+			Start:        time.Unix(k.start, 0),
+			Key:          k.key,
+			Route:        k.route,
+			Requests:     c.requests,
+			Errors:       c.errors,
+			Throttled:    c.throttled,
+			ErrorRate:    errRate,
+			AvgLatencyMs: avg,
+			MaxLatencyMs: float64(c.maxLatency) / float64(time.Millisecond),
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if !buckets[i].Start.Equal(buckets[j].Start) {
+			return buckets[i].Start.Before(buckets[j].Start)
+		}
+		if buckets[i].Key != buckets[j].Key {
+			return buckets[i].Key < buckets[j].Key
+		}
+		return buckets[i].Route < buckets[j].Route
+	})
+
+	keys := make([]*KeyUsage, 0, len(totals))
+	for k, c := range totals {
+		errRate, avg := c.rates()
+		keys = append(keys, &KeyUsage{
+			Key:          k,
+			Requests:     c.requests,
+			Errors:       c.errors,
+			Throttled:    c.throttled,
+			ErrorRate:    errRate,
+			AvgLatencyMs: avg,
+			Penalized:    penalized[k],
+		})
+	}
+	// 请求最多的密钥排在前面，便于定位异常调用方
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Requests+keys[i].Throttled != keys[j].Requests+keys[j].Throttled {
+			return keys[i].Requests+keys[i].Throttled > keys[j].Requests+keys[j].Throttled
+		}
+		return keys[i].Key < keys[j].Key
+	})
+
+	return buckets, keys
+}
+
+// merge 合并计数
+func merge[K comparable](m map[K]*usageCounter, k K, c *usageCounter) {
+	dst, ok := m[k]
+	if !ok {
+		dst = &usageCounter{}
+		m[k] = dst
+	}
+	dst.requests += c.requests
+	dst.errors += c.errors
+	dst.throttled += c.throttled
+	dst.latency += c.latency
+	if c.maxLatency > dst.maxLatency {
+		dst.maxLatency = c.maxLatency
+	}
+}
+
+// rates 返回错误率和平均延迟（毫秒）
+func (c *usageCounter) rates() (float64, float64) {
+	if c.requests == 0 {
+		return 0, 0
+	}
+	errRate := math.Round(float64(c.errors)/float64(c.requests)*10000) / 10000
+	avg := float64(c.latency) / float64(c.requests) / float64(time.Millisecond)
+	return errRate, avg
+}
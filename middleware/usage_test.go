@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"v/logger"
+	"v/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestTracker 使用临时设置文件创建统计，secret 为 JWT 密钥
+func newTestTracker(t *testing.T, secret string, rateLimit float64) *UsageTracker {
+	t.Helper()
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	settingsMgr := settings.NewWithPath(log, filepath.Join(t.TempDir(), "settings.json"))
+	next := settingsMgr.Clone()
+	next.Security.JWTSecret = secret
+	next.Security.APIRateLimit = rateLimit
+	next.Security.APIRateBurst = 1
+	if err := settingsMgr.Replace(next); err != nil {
+		t.Fatalf("Replace settings: %v", err)
+	}
+	return NewUsageTracker(settingsMgr)
+}
+
+func TestUsageTrackerRequestKey(t *testing.T) {
+	const secret = "configured"
+	tracker := newTestTracker(t, secret, 0)
+	local, err := LocalAdminToken(secret, time.Minute)
+	if err != nil {
+		t.Fatalf("LocalAdminToken: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   string
+	}{
+		{name: "verified token", header: map[string]string{"Authorization": "Bearer " + signWithKey(t, secret, "session")}, want: "user:1"},
+		{name: "local cli token", header: map[string]string{"Authorization": "Bearer " + local}, want: "local:cli"},
+		// 伪造的令牌和未经校验的 API 密钥都按客户端 IP 统计
+		{name: "forged token", header: map[string]string{"Authorization": "Bearer " + signWithKey(t, "guessed", "session")}, want: "ip:192.0.2.1"},
+		{name: "random bearer value", header: map[string]string{"Authorization": "Bearer random"}, want: "ip:192.0.2.1"},
+		{name: "unverified api key", header: map[string]string{"X-API-Key": "random"}, want: "ip:192.0.2.1"},
+		{name: "anonymous", want: "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/system/info", nil)
+			c.Request.RemoteAddr = "192.0.2.1:1234"
+			for k, v := range tt.header {
+				c.Request.Header.Set(k, v)
+			}
+			if got := tracker.RequestKey(c); got != tt.want {
+				t.Errorf("RequestKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageTrackerEvictsLeastRecentKeys(t *testing.T) {
+	tracker := newTestTracker(t, "configured", 1)
+	now := time.Now()
+
+	// 第一个调用方用完突发配额后被限速
+	if !tracker.allow("ip:first", now) || tracker.allow("ip:first", now) {
+		t.Fatal("first key: want one allowed request followed by a throttled one")
+	}
+	for i := 0; i < maxTrackedKeys; i++ {
+		tracker.allow("ip:"+strconv.Itoa(i), now)
+	}
+
+	tracker.mu.Lock()
+	limiters, recent := len(tracker.limiters), tracker.recent.Len()
+	_, tracked := tracker.limiters["ip:first"]
+	tracker.mu.Unlock()
+	if limiters != maxTrackedKeys || recent != maxTrackedKeys {
+		t.Fatalf("tracked %d limiters and %d recent keys, want %d", limiters, recent, maxTrackedKeys)
+	}
+	if tracked {
+		t.Fatal("least recently seen key was not evicted")
+	}
+}
@@ -0,0 +1,137 @@
+package mirror
+
+import "encoding/binary"
+
+// TLS 记录和握手类型
+const (
+	recordTypeHandshake  = 0x16
+	handshakeClientHello = 0x01
+	extensionServerName  = 0
+	extensionALPN        = 16
+)
+
+// parseClientHello 从 TLS 记录中解析 ClientHello 的 SNI 和 ALPN，数据不完整或格式不符时 ok 为 false
+func parseClientHello(data []byte) (sni string, alpn []string, ok bool) {
+	if len(data) < 5 || data[0] != recordTypeHandshake {
+		return "", nil, false
+	}
+	recordLen := int(binary.BigEndian.Uint16(data[3:5]))
+	data = data[5:]
+	if len(data) > recordLen {
+		data = data[:recordLen]
+	}
+	if len(data) < 4 || data[0] != handshakeClientHello {
+		return "", nil, false
+	}
+	data = data[4:]
+
+	// 版本（2）和随机数（32）
+	if len(data) < 34 {
+		return "", nil, false
+	}
+	data = data[34:]
+
+	// 会话 ID
+	data, ok = skipVector(data, 1)
+	if !ok {
+		return "", nil, false
+	}
+	// 加密套件
+	data, ok = skipVector(data, 2)
+	if !ok {
+		return "", nil, false
+	}
+	// 压缩方法
+	data, ok = skipVector(data, 1)
+	if !ok {
+		return "", nil, false
+	}
+
+	if len(data) < 2 {
+		// 没有扩展
+		return "", nil, true
+	}
+	extLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < extLen {
+		return "", nil, false
+	}
+	data = data[:extLen]
+
+	for len(data) >= 4 {
+		extType := binary.BigEndian.Uint16(data)
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		data = data[4:]
+		if len(data) < length {
+			return "", nil, false
+		}
+		ext := data[:length]
+		data = data[length:]
+
+		switch extType {
+		case extensionServerName:
+			sni = parseServerName(ext)
+		case extensionALPN:
+			alpn = parseALPN(ext)
+		}
+	}
+	return sni, alpn, true
+}
+
+// skipVector 跳过以 n 字节长度开头的向量
+func skipVector(data []byte, n int) ([]byte, bool) {
+	if len(data) < n {
+		return nil, false
+	}
+	var length int
+	if n == 1 {
+		length = int(data[0])
+	} else {
+		length = int(binary.BigEndian.Uint16(data))
+	}
+	data = data[n:]
+	if len(data) < length {
+		return nil, false
+	}
+	return data[length:], true
+}
+
+// parseServerName 返回 server_name 扩展中的主机名
+func parseServerName(ext []byte) string {
+	if len(ext) < 2 {
+		return ""
+	}
+	list := ext[2:]
+	for len(list) >= 3 {
+		nameType := list[0]
+		length := int(binary.BigEndian.Uint16(list[1:]))
+		list = list[3:]
+		if len(list) < length {
+			return ""
+		}
+		if nameType == 0 {
+			return string(list[:length])
+		}
+		list = list[length:]
+	}
+	return ""
+}
+
+// parseALPN 返回 ALPN 扩展中的协议列表
+func parseALPN(ext []byte) []string {
+	if len(ext) < 2 {
+		return nil
+	}
+	list := ext[2:]
+	var protocols []string
+	for len(list) >= 1 {
+		length := int(list[0])
+		list = list[1:]
+		if len(list) < length {
+			break
+		}
+		protocols = append(protocols, string(list[:length]))
+		list = list[length:]
+	}
+	return protocols
+}
@@ -0,0 +1,371 @@
+// Package mirror 入站调试模式：临时把 Xray 入站移到本机内部端口，由面板在原端口接收连接并转发，
+// 记录每个连接的来源 IP、SNI、ALPN、流量和时长（不记录内容），用于排查“客户端能连上但无法使用”的问题
+package mirror
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"v/logger"
+)
+
+// 调试会话状态
+const (
+	StatusWaiting = "waiting" // 等待 Xray 释放原端口
+	StatusActive  = "active"
+)
+
+const (
+	// MaxDuration 调试模式的最长持续时间
+	MaxDuration = 10 * time.Minute
+	// maxRecords 每个会话保留的连接记录数
+	maxRecords = 500
+	// helloTimeout 等待客户端发送第一个数据包的时间
+	helloTimeout = 10 * time.Second
+	// helloPeekSize 读取 ClientHello 的最大长度
+	helloPeekSize = 16 * 1024
+	// bindRetryInterval 原端口仍被占用时的重试间隔
+	bindRetryInterval = 500 * time.Millisecond
+	dialTimeout       = 5 * time.Second
+)
+
+var (
+	// ErrSessionActive 该入站已在调试模式
+	ErrSessionActive = errors.New("mirror session already active for this inbound")
+	// ErrNoSession 该入站不在调试模式
+	ErrNoSession = errors.New("no mirror session for this inbound")
+)
+
+// Record 一个连接的元数据
+type Record struct {
+	Time     time.Time     `json:"time"`
+	Source   string        `json:"source"`
+	TLS      bool          `json:"tls"`
+	SNI      string        `json:"sni,omitempty"`
+	ALPN     []string      `json:"alpn,omitempty"`
+	Upload   int64         `json:"upload"`   // 客户端发送的字节数
+	Download int64         `json:"download"` // 返回给客户端的字节数
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Session 调试会话
+type Session struct {
+	ProtocolID   int64     `json:"protocol_id"`
+	Listen       string    `json:"listen"`        // 面板接收连接的原地址
+	InternalPort int       `json:"internal_port"` // Xray 入站临时监听的本机端口
+	Status       string    `json:"status"`
+	StartedAt    time.Time `json:"started_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Connections  int64     `json:"connections"`
+	Error        string    `json:"error,omitempty"` // 最近一次绑定原端口失败的原因
+}
+
+// session 运行中的调试会话
+type session struct {
+	info     Session
+	records  []*Record
+	next     int
+	listener net.Listener
+	stopCh   chan struct{}
+	timer    *time.Timer
+}
+
+// Manager 管理各入站的调试会话
+type Manager struct {
+	log *logger.Logger
+
+	mu       sync.Mutex
+	sessions map[int64]*session
+	onChange func(protocolID int64)
+}
+
+// New 创建调试会话管理器
+func New(log *logger.Logger) *Manager {
+	return &Manager{
+		log:      log,
+		sessions: make(map[int64]*session),
+	}
+}
+
+// SetOnChange 设置会话开始和结束时的回调，用于重新生成 Xray 配置
+func (m *Manager) SetOnChange(fn func(protocolID int64)) {
+	m.onChange = fn
+}
+
+// Start 为入站开启调试模式，listen 为入站的原监听地址（host:port），duration 超过 MaxDuration 时截断
+func (m *Manager) Start(protocolID int64, listen string, duration time.Duration) (*Session, error) {
+	if duration <= 0 || duration > MaxDuration {
+		duration = MaxDuration
+	}
+	port, err := freeLoopbackPort()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if _, ok := m.sessions[protocolID]; ok {
+		m.mu.Unlock()
+		return nil, ErrSessionActive
+	}
+	now := time.Now()
+	s := &session{
+		info: Session{
+			ProtocolID:   protocolID,
+			Listen:       listen,
+			InternalPort: port,
+			Status:       StatusWaiting,
+			StartedAt:    now,
+			ExpiresAt:    now.Add(duration),
+		},
+		stopCh: make(chan struct{}),
+	}
+	s.timer = time.AfterFunc(duration, func() {
+		m.Stop(protocolID)
+	})
+	m.sessions[protocolID] = s
+	info := s.info
+	m.mu.Unlock()
+
+	go m.bind(s)
+	m.log.WithFields("Inbound mirror started", logger.Fields{
+		"protocol_id":   protocolID,
+		"listen":        listen,
+		"internal_port": port,
+		"expires_at":    info.ExpiresAt,
+	})
+	m.changed(protocolID)
+	return &info, nil
+}
+
+// Stop 结束调试模式，入站恢复监听原端口
+func (m *Manager) Stop(protocolID int64) error {
+	m.mu.Lock()
+	s, ok := m.sessions[protocolID]
+	if !ok {
+		m.mu.Unlock()
+		return ErrNoSession
+	}
+	delete(m.sessions, protocolID)
+	s.timer.Stop()
+	close(s.stopCh)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	connections := s.info.Connections
+	m.mu.Unlock()
+
+	m.log.WithFields("Inbound mirror stopped", logger.Fields{
+		"protocol_id": protocolID,
+		"connections": connections,
+	})
+	m.changed(protocolID)
+	return nil
+}
+
+// StopAll 结束所有调试会话，退出前调用
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	ids := make([]int64, 0, len(m.sessions))
+	for id := range m.sessions {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	for _, id := range ids {
+		m.Stop(id)
+	}
+}
+
+// Get 返回会话和连接记录，记录按时间从新到旧排列
+func (m *Manager) Get(protocolID int64) (*Session, []*Record, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[protocolID]
+	if !ok {
+		return nil, nil, false
+	}
+	info := s.info
+	records := make([]*Record, 0, len(s.records))
+	for i := 0; i < len(s.records); i++ {
+		idx := (s.next - 1 - i + len(s.records)) % len(s.records)
+		r := *s.records[idx]
+		records = append(records, &r)
+	}
+	return &info, records, true
+}
+
+// Sessions 返回所有调试会话
+func (m *Manager) Sessions() []*Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		info := s.info
+		sessions = append(sessions, &info)
+	}
+	return sessions
+}
+
+// Redirect 返回调试中的入站应临时监听的本机端口，生成 Xray 配置时使用
+func (m *Manager) Redirect(protocolID int64) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[protocolID]
+	if !ok {
+		return 0, false
+	}
+	return s.info.InternalPort, true
+}
+
+// changed 调用变更回调
+func (m *Manager) changed(protocolID int64) {
+	if m.onChange != nil {
+		m.onChange(protocolID)
+	}
+}
+
+// bind 重试绑定原端口直到 Xray 按新配置释放该端口或会话结束
+func (m *Manager) bind(s *session) {
+	for {
+		l, err := net.Listen("tcp", s.info.Listen)
+		m.mu.Lock()
+		select {
+		case <-s.stopCh:
+			m.mu.Unlock()
+			if err == nil {
+				l.Close()
+			}
+			return
+		default:
+		}
+		if err == nil {
+			s.listener = l
+			s.info.Status = StatusActive
+			s.info.Error = ""
+			m.mu.Unlock()
+			m.accept(s, l)
+			return
+		}
+		s.info.Error = err.Error()
+		m.mu.Unlock()
+
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(bindRetryInterval):
+		}
+	}
+}
+
+// accept 接收连接直到监听关闭
+func (m *Manager) accept(s *session, l net.Listener) {
+	target := net.JoinHostPort("127.0.0.1", fmt.Sprint(s.info.InternalPort))
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go m.handle(s, conn, target)
+	}
+}
+
+// handle 读取 ClientHello 后转发到 Xray 入站，连接结束时记录元数据
+func (m *Manager) handle(s *session, conn net.Conn, target string) {
+	start := time.Now()
+	record := &Record{
+		Time:   start,
+		Source: conn.RemoteAddr().String(),
+	}
+	defer func() {
+		record.Duration = time.Since(start)
+		m.add(s, record)
+	}()
+	defer conn.Close()
+
+	reader := bufio.NewReaderSize(conn, helloPeekSize)
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	first, err := reader.Peek(1)
+	if err != nil {
+		record.Error = "client sent no data: " + err.Error()
+		return
+	}
+	if first[0] == recordTypeHandshake {
+		record.TLS = true
+		if header, err := reader.Peek(5); err == nil {
+			n := 5 + (int(header[3])<<8 | int(header[4]))
+			if n > helloPeekSize {
+				n = helloPeekSize
+			}
+			if hello, err := reader.Peek(n); err == nil {
+				record.SNI, record.ALPN, _ = parseClientHello(hello)
+			}
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	upstream, err := net.DialTimeout("tcp", target, dialTimeout)
+	if err != nil {
+		record.Error = "xray inbound unreachable: " + err.Error()
+		return
+	}
+	defer upstream.Close()
+
+	var upload, download atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		n, _ := io.Copy(upstream, reader)
+		upload.Store(n)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		close(done)
+	}()
+	n, err := io.Copy(conn, upstream)
+	download.Store(n)
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	<-done
+
+	record.Upload, record.Download = upload.Load(), download.Load()
+	if err != nil {
+		record.Error = err.Error()
+	} else if record.Download == 0 {
+		// 入站没有返回任何数据，通常是认证失败或协议、传输配置不一致
+		record.Error = "inbound closed the connection without a response"
+	}
+}
+
+// add 写入环形缓冲区
+func (m *Manager) add(s *session, r *Record) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.info.Connections++
+	if len(s.records) < maxRecords {
+		s.records = append(s.records, r)
+		s.next = len(s.records) % maxRecords
+		return
+	}
+	s.records[s.next] = r
+	s.next = (s.next + 1) % maxRecords
+}
+
+// freeLoopbackPort 选择一个本机空闲端口
+func freeLoopbackPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -48,4 +48,7 @@ var (
 
 	// ErrUnsupportedProtocol 不支持的协议
 	ErrUnsupportedProtocol = errors.New("unsupported protocol")
+
+	// ErrInvalidID 既不是数字 ID 也不是 UUID
+	ErrInvalidID = errors.New("invalid id: expected numeric id or uuid")
 )
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FieldCipher 数据库敏感列的加解密接口，由设置的加密密钥实现。
+// Decrypt 需要原样返回未加密的值，以便兼容加密前写入的记录
+type FieldCipher interface {
+	Encrypt(plain string) (string, error)
+	Decrypt(value string) (string, error)
+	IsEncrypted(value string) bool
+	// Hash 返回带密钥的摘要，用于在加密列上按值精确查找
+	Hash(value string) string
+}
+
+var (
+	fieldCipherMu sync.RWMutex
+	fieldCipher   FieldCipher
+)
+
+// SetFieldCipher 设置敏感列的加密方式，为 nil 时新写入的数据不加密，已加密的数据无法读取
+func SetFieldCipher(c FieldCipher) {
+	fieldCipherMu.Lock()
+	defer fieldCipherMu.Unlock()
+	fieldCipher = c
+}
+
+// currentFieldCipher 返回当前的加密方式
+func currentFieldCipher() FieldCipher {
+	fieldCipherMu.RLock()
+	defer fieldCipherMu.RUnlock()
+	return fieldCipher
+}
+
+// sealField 加密写入数据库的敏感值，空值和未设置加密方式时原样返回
+func sealField(value string) (string, error) {
+	c := currentFieldCipher()
+	if c == nil || value == "" || c.IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := c.Encrypt(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt column: %v", err)
+	}
+	return sealed, nil
+}
+
+// openField 解密从数据库读取的敏感值，未加密的值原样返回
+func openField(value string) (string, error) {
+	c := currentFieldCipher()
+	if c == nil || value == "" || !c.IsEncrypted(value) {
+		return value, nil
+	}
+	plain, err := c.Decrypt(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt column: %v", err)
+	}
+	return plain, nil
+}
+
+// sealBytes 加密 BLOB 形式的敏感值
+func sealBytes(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	sealed, err := sealField(string(value))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealed), nil
+}
+
+// openBytes 解密 BLOB 形式的敏感值
+func openBytes(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	plain, err := openField(string(value))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(plain), nil
+}
+
+// emailHash 返回邮箱的查找摘要，不区分大小写，未设置加密方式时为空
+func emailHash(email string) string {
+	c := currentFieldCipher()
+	if c == nil || email == "" {
+		return ""
+	}
+	return c.Hash(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// openProtocolVersion 解密协议版本中的快照和差异，其中包含协议凭据
+func openProtocolVersion(v *ProtocolVersion) error {
+	snapshot, err := openBytes(v.Snapshot)
+	if err != nil {
+		return err
+	}
+	diff, err := openField(v.Diff)
+	if err != nil {
+		return err
+	}
+	v.Snapshot, v.Diff = snapshot, diff
+	return nil
+}
@@ -0,0 +1,222 @@
+package model
+
+import (
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCipher 可逆的测试加密方式，密文为前缀加 base64，行为与设置中的 RowCipher 一致
+type fakeCipher struct{}
+
+const fakePrefix = "fake:"
+
+func (fakeCipher) Encrypt(plain string) (string, error) {
+	return fakePrefix + base64.StdEncoding.EncodeToString([]byte(plain)), nil
+}
+
+func (fakeCipher) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, fakePrefix) {
+		return value, nil
+	}
+	plain, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, fakePrefix))
+	return string(plain), err
+}
+
+func (fakeCipher) IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, fakePrefix)
+}
+
+func (fakeCipher) Hash(value string) string {
+	return "hash:" + value
+}
+
+// useFieldCipher 在测试期间设置加密方式，结束后还原
+func useFieldCipher(t *testing.T, c FieldCipher) {
+	t.Helper()
+	previous := currentFieldCipher()
+	SetFieldCipher(c)
+	t.Cleanup(func() { SetFieldCipher(previous) })
+}
+
+// testSchema 测试用到的表，只包含加密相关查询读写的列，完整结构由 database 包的迁移维护
+const testSchema = `
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT, uuid TEXT, username TEXT, email TEXT, email_hash TEXT DEFAULT '',
+	password TEXT, salt TEXT, role TEXT, status TEXT, traffic_limit INTEGER, traffic_used INTEGER,
+	last_login_at TEXT, login_attempts INTEGER, locked_until TEXT, is_admin BOOLEAN, expire_at TEXT,
+	created_at TEXT, updated_at TEXT, remark TEXT, activity_opt_out BOOLEAN, email_verified BOOLEAN,
+	pending_email TEXT, sso_issuer TEXT, sso_subject TEXT
+);
+CREATE TABLE protocols (
+	id INTEGER PRIMARY KEY AUTOINCREMENT, uuid TEXT, user_id INTEGER, type TEXT, settings BLOB, port INTEGER,
+	listen TEXT, remark TEXT, tags TEXT, status TEXT, traffic_limit INTEGER, created_at TEXT, updated_at TEXT
+);
+CREATE TABLE protocol_versions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT, protocol_id INTEGER, version INTEGER, snapshot BLOB, diff TEXT,
+	changed_by TEXT, created_at TEXT, updated_at TEXT
+);`
+
+func newTestDB(t *testing.T) *SQLiteDB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sqliteDB := db.(*SQLiteDB)
+	if _, err := sqliteDB.db.Exec(testSchema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	return sqliteDB
+}
+
+func TestSealAndOpenField(t *testing.T) {
+	sealed, _ := fakeCipher{}.Encrypt("secret")
+
+	tests := []struct {
+		name       string
+		cipher     FieldCipher
+		value      string
+		wantSealed string
+	}{
+		{name: "plaintext is encrypted", cipher: fakeCipher{}, value: "secret", wantSealed: sealed},
+		{name: "empty value is kept", cipher: fakeCipher{}, value: "", wantSealed: ""},
+		{name: "encrypted value is not encrypted twice", cipher: fakeCipher{}, value: sealed, wantSealed: sealed},
+		{name: "no cipher keeps plaintext", cipher: nil, value: "secret", wantSealed: "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFieldCipher(t, tt.cipher)
+
+			got, err := sealField(tt.value)
+			if err != nil {
+				t.Fatalf("sealField: %v", err)
+			}
+			if got != tt.wantSealed {
+				t.Fatalf("sealField(%q) = %q, want %q", tt.value, got, tt.wantSealed)
+			}
+
+			plain, err := openField(got)
+			if err != nil {
+				t.Fatalf("openField: %v", err)
+			}
+			want := tt.value
+			if tt.cipher != nil && tt.cipher.IsEncrypted(want) {
+				want, _ = tt.cipher.Decrypt(want)
+			}
+			if plain != want {
+				t.Errorf("openField(%q) = %q, want %q", got, plain, want)
+			}
+		})
+	}
+}
+
+func TestGetUserByEmailWithEncryptedColumn(t *testing.T) {
+	useFieldCipher(t, fakeCipher{})
+	db := newTestDB(t)
+
+	user := &User{Username: "alice", Email: "Alice@Example.com", Password: "x", Salt: "y", Role: "user", Status: "active"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	var stored, hash string
+	if err := db.db.QueryRow(`SELECT email, email_hash FROM users WHERE id = ?`, user.ID).Scan(&stored, &hash); err != nil {
+		t.Fatalf("read raw row: %v", err)
+	}
+	if !strings.HasPrefix(stored, fakePrefix) {
+		t.Fatalf("email stored as %q, want encrypted", stored)
+	}
+	if hash != "hash:alice@example.com" {
+		t.Fatalf("email_hash = %q, want hash of the normalized address", hash)
+	}
+
+	tests := []struct {
+		email string
+		found bool
+	}{
+		{email: "Alice@Example.com", found: true},
+		{email: "alice@example.com", found: true},
+		{email: "ALICE@EXAMPLE.COM", found: true},
+		{email: "bob@example.com", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			got, err := db.GetUserByEmail(tt.email)
+			if err != nil {
+				t.Fatalf("GetUserByEmail: %v", err)
+			}
+			if (got != nil) != tt.found {
+				t.Fatalf("GetUserByEmail(%q) found = %v, want %v", tt.email, got != nil, tt.found)
+			}
+			if got != nil && got.Email != "Alice@Example.com" {
+				t.Errorf("email = %q, want decrypted Alice@Example.com", got.Email)
+			}
+		})
+	}
+}
+
+func TestEncryptSensitiveColumnsIsIdempotent(t *testing.T) {
+	useFieldCipher(t, nil)
+	db := newTestDB(t)
+
+	// 启用加密前写入的明文记录
+	user := &User{Username: "alice", Email: "alice@example.com", Password: "x", Salt: "y", Role: "user", Status: "active"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	protocol := &Protocol{Type: "vmess", Port: 10086, Settings: []byte(`{"uuid":"secret"}`)}
+	if err := db.CreateProtocol(protocol); err != nil {
+		t.Fatalf("CreateProtocol: %v", err)
+	}
+	version := &ProtocolVersion{ProtocolID: protocol.ID, Snapshot: []byte(`{"uuid":"secret"}`), Diff: "uuid changed"}
+	if err := db.CreateProtocolVersion(version); err != nil {
+		t.Fatalf("CreateProtocolVersion: %v", err)
+	}
+
+	SetFieldCipher(fakeCipher{})
+
+	tests := []struct {
+		name string
+		want EncryptionResult
+	}{
+		{name: "first run encrypts plaintext rows", want: EncryptionResult{Users: 1, Protocols: 1, Versions: 1}},
+		{name: "second run skips encrypted rows", want: EncryptionResult{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.EncryptSensitiveColumns()
+			if err != nil {
+				t.Fatalf("EncryptSensitiveColumns: %v", err)
+			}
+			if *got != tt.want {
+				t.Fatalf("result = %+v, want %+v", *got, tt.want)
+			}
+
+			var email, settings string
+			if err := db.db.QueryRow(`SELECT email FROM users WHERE id = ?`, user.ID).Scan(&email); err != nil {
+				t.Fatalf("read user: %v", err)
+			}
+			if err := db.db.QueryRow(`SELECT settings FROM protocols WHERE id = ?`, protocol.ID).Scan(&settings); err != nil {
+				t.Fatalf("read protocol: %v", err)
+			}
+			if !strings.HasPrefix(email, fakePrefix) || !strings.HasPrefix(settings, fakePrefix) {
+				t.Fatalf("columns not encrypted: email %q, settings %q", email, settings)
+			}
+
+			found, err := db.GetUserByEmail("Alice@example.com")
+			if err != nil || found == nil || found.Email != user.Email {
+				t.Fatalf("GetUserByEmail = %v, %v; want the decrypted user", found, err)
+			}
+			p, err := db.GetProtocol(protocol.ID)
+			if err != nil || string(p.Settings) != string(protocol.Settings) {
+				t.Fatalf("GetProtocol settings = %q, %v; want %q", p.Settings, err, protocol.Settings)
+			}
+		})
+	}
+}
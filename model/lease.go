@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// LeaderLease 多个面板实例共用数据库时的主节点租约，持有者在到期前续约，
+// 到期未续约时其他实例可以接管
+type LeaderLease struct {
+	Name      string    `json:"name" db:"name"`
+	Holder    string    `json:"holder" db:"holder"`   // 持有租约的实例 ID
+	Address   string    `json:"address" db:"address"` // 持有者的面板访问地址，供备用实例提示
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Expired 判断租约在指定时间是否已过期
+func (l *LeaderLease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
@@ -22,22 +22,29 @@ type Base struct {
 // User 用户
 type User struct {
 	Base
-	Username      string                 `json:"username" db:"username"`
-	Password      string                 `json:"-" db:"password"`
-	Salt          string                 `json:"-" db:"salt"`
-	Email         string                 `json:"email" db:"email"`
-	Key           crypto.PrivateKey      `json:"-"`
-	Registration  *registration.Resource `json:"-"`
-	Role          string                 `json:"role" db:"role"`
-	Status        string                 `json:"status" db:"status"`
-	LastLoginAt   *time.Time             `json:"last_login_at" db:"last_login_at"`
-	LoginAttempts int                    `json:"-" db:"login_attempts"`
-	LockedUntil   *time.Time             `json:"locked_until" db:"locked_until"`
-	IsAdmin       bool                   `json:"is_admin" db:"is_admin"`
-	TrafficLimit  int64                  `json:"traffic_limit" db:"traffic_limit"`
-	TrafficUsed   int64                  `json:"traffic_used" db:"traffic_used"`
-	ExpireAt      *time.Time             `json:"expire_at" db:"expire_at"`
-	Enabled       bool                   `json:"enabled" db:"enabled"` // 用户是否启用
+	UUID           string                 `json:"uuid" db:"uuid"` // 对外公开的稳定标识，集成方应使用它而不是自增 ID
+	Username       string                 `json:"username" db:"username"`
+	Password       string                 `json:"-" db:"password"`
+	Salt           string                 `json:"-" db:"salt"`
+	Email          string                 `json:"email" db:"email"`
+	Key            crypto.PrivateKey      `json:"-"`
+	Registration   *registration.Resource `json:"-"`
+	Role           string                 `json:"role" db:"role"`
+	Status         string                 `json:"status" db:"status"`
+	LastLoginAt    *time.Time             `json:"last_login_at" db:"last_login_at"`
+	LoginAttempts  int                    `json:"-" db:"login_attempts"`
+	LockedUntil    *time.Time             `json:"locked_until" db:"locked_until"`
+	IsAdmin        bool                   `json:"is_admin" db:"is_admin"`
+	TrafficLimit   int64                  `json:"traffic_limit" db:"traffic_limit"`
+	TrafficUsed    int64                  `json:"traffic_used" db:"traffic_used"`
+	ExpireAt       *time.Time             `json:"expire_at" db:"expire_at"`
+	Enabled        bool                   `json:"enabled" db:"enabled"` // 用户是否启用
+	Remark         string                 `json:"remark" db:"remark"`
+	ActivityOptOut bool                   `json:"activity_opt_out" db:"activity_opt_out"` // 不接收新设备登录和异常使用提醒
+	EmailVerified  bool                   `json:"email_verified" db:"email_verified"`     // 邮箱已通过验证，未验证的邮箱不接收通知
+	PendingEmail   string                 `json:"pending_email" db:"pending_email"`       // 等待验证的新邮箱，验证通过后替换 Email
+	SSOIssuer      string                 `json:"sso_issuer,omitempty" db:"sso_issuer"`   // 单点登录的身份来源，如 OIDC issuer 或 LDAP 服务器地址
+	SSOSubject     string                 `json:"sso_subject,omitempty" db:"sso_subject"` // 身份来源内不变的用户标识，如 OIDC sub 或 LDAP DN
 }
 
 // GetEmail 获取用户邮箱
@@ -63,17 +70,20 @@ type CertificateConfig struct {
 // Protocol 协议
 type Protocol struct {
 	Base
+	UUID         string    `json:"uuid" db:"uuid"` // 对外公开的稳定标识，集成方应使用它而不是自增 ID
 	UserID       int64     `json:"user_id" db:"user_id"`
 	Type         string    `json:"type" db:"type"`
 	Name         string    `json:"name" db:"name"`
 	Settings     []byte    `json:"settings" db:"settings"`
 	Status       string    `json:"status" db:"status"`
 	Port         int       `json:"port" db:"port"`
+	Listen       string    `json:"listen" db:"listen"` // 监听地址，为空时监听所有 IPv4 地址，"::" 为双栈
 	TrafficLimit int64     `json:"traffic_limit" db:"traffic_limit"`
 	TrafficUsed  int64     `json:"traffic_used" db:"traffic_used"`
 	ExpireAt     time.Time `json:"expire_at" db:"expire_at"`
 	Enable       bool      `json:"enable" db:"enable"`
 	Tags         []string  `json:"tags" db:"tags"`
+	Remark       string    `json:"remark" db:"remark"`
 	LastActive   time.Time `json:"last_active" db:"last_active"`
 }
 
@@ -87,6 +97,16 @@ type ProtocolStats struct {
 	LastActive time.Time `json:"last_active" db:"last_active"`
 }
 
+// ProtocolVersion 协议配置历史版本
+type ProtocolVersion struct {
+	Base
+	ProtocolID int64  `json:"protocol_id" db:"protocol_id"`
+	Version    int    `json:"version" db:"version"`
+	Snapshot   []byte `json:"snapshot" db:"snapshot"`     // 协议配置的 JSON 快照
+	Diff       string `json:"diff" db:"diff"`             // 与上一版本的差异
+	ChangedBy  string `json:"changed_by" db:"changed_by"` // 修改人
+}
+
 // Certificate SSL证书信息
 type Certificate struct {
 	Base
@@ -102,12 +122,18 @@ type Certificate struct {
 // Traffic 流量统计
 type Traffic struct {
 	Base
-	UserID  int64 `json:"user_id" db:"user_id"`
-	ProxyID int64 `json:"proxy_id" db:"proxy_id"`
-	Up      int64 `json:"up" db:"up"`     // 上传流量（字节）
-	Down    int64 `json:"down" db:"down"` // 下载流量（字节）
+	UserID   int64  `json:"user_id" db:"user_id"`
+	ProxyID  int64  `json:"proxy_id" db:"proxy_id"`
+	Up       int64  `json:"up" db:"up"`                       // 上传流量（字节），调整记录可为负数
+	Down     int64  `json:"down" db:"down"`                   // 下载流量（字节），调整记录可为负数
+	Kind     string `json:"kind,omitempty" db:"kind"`         // 记录类型，空表示正常采集
+	Note     string `json:"note,omitempty" db:"note"`         // 人工调整说明
+	Operator string `json:"operator,omitempty" db:"operator"` // 执行调整的管理员
 }
 
+// TrafficKindAdjustment 管理员人工调整流量的记录类型
+const TrafficKindAdjustment = "adjustment"
+
 // TrafficStats 流量统计
 type TrafficStats struct {
 	Base
@@ -155,9 +181,12 @@ type TrafficHistory struct {
 type DB interface {
 	// 用户相关
 	CreateUser(user *User) error
+	CreateUsers(users []*User) error
 	GetUser(id int64) (*User, error)
+	GetUserByUUID(uuid string) (*User, error)
 	GetUserByUsername(username string) (*User, error)
 	GetUserByEmail(email string) (*User, error)
+	GetUserByIdentity(issuer, subject string) (*User, error)
 	UpdateUser(user *User) error
 	DeleteUser(id int64) error
 	ListUsers(page, pageSize int) ([]*User, error)
@@ -182,21 +211,63 @@ type DB interface {
 	DeleteTraffic(id int64) error
 	ListTrafficByUserID(userID int64) ([]*common.TrafficStats, error)
 	ListTrafficByProxyID(proxyID int64) ([]*common.TrafficStats, error)
-	GetTrafficStats(userID uint) (*TrafficStats, error)
+	GetTrafficStats(userID int64) (*TrafficStats, error)
 	CreateTrafficRecord(traffic *Traffic) error
+	AdjustUserTraffic(adjustment *Traffic) error
+	ListTrafficAdjustments(userID int64) ([]*Traffic, error)
+
+	// 订阅相关
+	GetSubscription(userID int64) (*Subscription, error)
+	GetSubscriptionByToken(token string) (*Subscription, error)
+	ListSubscriptions() ([]*Subscription, error)
+	SaveSubscription(sub *Subscription) error
+	UpdateSubscriptionNotifyStatus(userID int64, notifiedAt *time.Time, notifyError string) error
+
+	// 协议定时计划
+	GetProtocolSchedule(protocolID int64) (*ProtocolSchedule, error)
+	ListProtocolSchedules() ([]*ProtocolSchedule, error)
+	SaveProtocolSchedule(schedule *ProtocolSchedule) error
+	DeleteProtocolSchedule(protocolID int64) error
+
+	// 实时事件历史
+	AppendStreamEvent(event *StreamEvent) error
+	ListStreamEvents(after int64, limit int) ([]*StreamEvent, error)
+	PruneStreamEvents(keep int) error
+
+	// 主备实例租约
+	AcquireLease(name, holder, address string, ttl time.Duration) (*LeaderLease, error)
+	ReleaseLease(name, holder string) error
+
+	// 通知中心
+	CreateNotification(n *Notification) error
+	ListNotifications(query *NotificationQuery) ([]*Notification, error)
+	CountNotifications(query *NotificationQuery) (int64, error)
+	MarkNotificationsRead(ids []int64) (int64, error)
+	MarkAllNotificationsRead(query *NotificationQuery) (int64, error)
+	PruneNotifications(before time.Time) error
+
 	CleanupTraffic(before time.Time) error
+	GetTopUsersByTraffic(start, end time.Time, limit int) ([]*TopTalker, error)
+	GetTopProtocolsByTraffic(start, end time.Time, limit int) ([]*TopTalker, error)
 
 	// 协议相关
 	CreateProtocol(protocol *Protocol) error
 	GetProtocol(id int64) (*Protocol, error)
+	GetProtocolByUUID(uuid string) (*Protocol, error)
 	GetProtocolsByUserID(userID int64) ([]*Protocol, error)
 	UpdateProtocol(protocol *Protocol) error
 	DeleteProtocol(id int64) error
+	DeleteProtocolCascade(id int64, archive bool) error
 	GetProtocolsByPort(port int) ([]*Protocol, error)
 	ListProtocols(page, pageSize int) ([]*Protocol, error)
 	GetTotalProtocols() (int64, error)
 	SearchProtocols(keyword string) ([]*Protocol, error)
 
+	// 协议版本历史
+	CreateProtocolVersion(version *ProtocolVersion) error // Version 为 0 时由数据库分配下一个版本号
+	GetProtocolVersion(protocolID int64, version int) (*ProtocolVersion, error)
+	ListProtocolVersions(protocolID int64) ([]*ProtocolVersion, error)
+
 	// 协议统计相关
 	CreateProtocolStats(stats *ProtocolStats) error
 	GetProtocolStats(id int64) (*ProtocolStats, error)
@@ -252,7 +323,7 @@ type DB interface {
 
 	// 流量历史
 	CreateTrafficHistory(history *TrafficHistory) error
-	ListTrafficHistoryByDateRange(userID uint, startDate, endDate string, histories *[]*TrafficHistory) error
+	ListTrafficHistoryByDateRange(userID int64, startDate, endDate string, histories *[]*TrafficHistory) error
 
 	// 系统设置
 	GetSettings(key string) (string, error)
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// 通知级别
+const (
+	NotificationInfo    = "info"
+	NotificationWarning = "warning"
+	NotificationError   = "error"
+)
+
+// Notification 管理后台通知中心的通知，邮件等渠道未配置时管理员也能在面板中查看
+type Notification struct {
+	ID        int64      `json:"id" db:"id"`
+	Category  string     `json:"category" db:"category"` // alert、backup、certificate、update、job
+	Level     string     `json:"level" db:"level"`       // info、warning、error
+	Title     string     `json:"title" db:"title"`
+	Body      string     `json:"body" db:"body"`
+	Source    string     `json:"source" db:"source"`   // 产生通知的事件类型，如 system_alert、certificate_renewed
+	Key       string     `json:"-" db:"dedup_key"`     // 去重键，已有相同键的通知时不重复添加
+	Read      bool       `json:"read" db:"is_read"`    // 是否已读
+	ReadAt    *time.Time `json:"read_at" db:"read_at"` // 标记已读的时间
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// NotificationQuery 通知查询条件，零值的条件不参与过滤
+type NotificationQuery struct {
+	Category string    `json:"category"`
+	Level    string    `json:"level"`
+	Unread   bool      `json:"unread"` // 只查询未读通知
+	Key      string    `json:"-"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+}
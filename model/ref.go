@@ -0,0 +1,58 @@
+package model
+
+import (
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// ResolveUserID 解析 API 中的用户标识，支持自增 ID 和公开的 UUID。
+// ID 不是正数或 UUID 对应的用户不存在时返回 ErrNotFound，格式错误时返回 ErrInvalidID
+func ResolveUserID(db DB, ref string) (int64, error) {
+	if id, ok := parseNumericID(ref); ok {
+		return positiveID(id)
+	}
+	if _, err := uuid.Parse(ref); err != nil {
+		return 0, ErrInvalidID
+	}
+	user, err := db.GetUserByUUID(ref)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, ErrNotFound
+	}
+	return user.ID, nil
+}
+
+// ResolveProtocolID 解析 API 中的协议标识，支持自增 ID 和公开的 UUID，未找到时的错误与 ResolveUserID 相同
+func ResolveProtocolID(db DB, ref string) (int64, error) {
+	if id, ok := parseNumericID(ref); ok {
+		return positiveID(id)
+	}
+	if _, err := uuid.Parse(ref); err != nil {
+		return 0, ErrInvalidID
+	}
+	protocol, err := db.GetProtocolByUUID(ref)
+	if err != nil {
+		return 0, err
+	}
+	if protocol == nil {
+		return 0, ErrNotFound
+	}
+	return protocol.ID, nil
+}
+
+// parseNumericID 解析整数 ID
+func parseNumericID(ref string) (int64, bool) {
+	id, err := strconv.ParseInt(ref, 10, 64)
+	return id, err == nil
+}
+
+// positiveID 自增 ID 从 1 开始，0 和负数不对应任何记录
+func positiveID(id int64) (int64, error) {
+	if id <= 0 {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
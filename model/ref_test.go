@@ -0,0 +1,36 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveNumericID(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    int64
+		wantErr error
+	}{
+		{ref: "42", want: 42},
+		{ref: "0", wantErr: ErrNotFound},
+		{ref: "-1", wantErr: ErrNotFound},
+		{ref: "abc", wantErr: ErrInvalidID},
+		{ref: "", wantErr: ErrInvalidID},
+	}
+
+	resolvers := map[string]func(DB, string) (int64, error){
+		"user":     ResolveUserID,
+		"protocol": ResolveProtocolID,
+	}
+	for name, resolve := range resolvers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.ref, func(t *testing.T) {
+				// 数字 ID 和格式错误的标识不查询数据库
+				got, err := resolve(nil, tt.ref)
+				if !errors.Is(err, tt.wantErr) || got != tt.want {
+					t.Errorf("resolve(%q) = %d, %v; want %d, %v", tt.ref, got, err, tt.want, tt.wantErr)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// TopTalker 时间段内的流量排行项，Previous 为上一个等长时间段的总流量
+type TopTalker struct {
+	ID           int64    `json:"id"`
+	Name         string   `json:"name"`
+	Upload       int64    `json:"upload"`
+	Download     int64    `json:"download"`
+	Total        int64    `json:"total"`
+	Previous     int64    `json:"previous"`
+	Delta        int64    `json:"delta"`
+	DeltaPercent *float64 `json:"delta_percent"` // 上一时间段无流量时为 null
+}
+
+// TopTalkersReport 流量排行报告
+type TopTalkersReport struct {
+	Start         time.Time    `json:"start"`
+	End           time.Time    `json:"end"`
+	PreviousStart time.Time    `json:"previous_start"`
+	Users         []*TopTalker `json:"users"`
+	Protocols     []*TopTalker `json:"protocols"`
+	// Sampled 使用采样模式的节点，这些节点的流量为按比例外推的估计值
+	Sampled []*SamplingAccuracy `json:"sampled,omitempty"`
+}
+
+// SamplingAccuracy 采样模式节点自采集器启动以来的外推结果和误差范围
+type SamplingAccuracy struct {
+	Target        string    `json:"target"`
+	Ratio         float64   `json:"ratio"`          // 采样比例
+	Windows       int       `json:"windows"`        // 已外推的采样窗口数
+	MeasuredBytes int64     `json:"measured_bytes"` // 实际计数的字节数
+	RecordedBytes int64     `json:"recorded_bytes"` // 外推后记入的字节数
+	ErrorBound    int64     `json:"error_bound"`    // 记入字节数 95% 置信区间的半宽
+	ErrorPercent  float64   `json:"error_percent"`  // 误差范围占记入字节数的百分比
+	Since         time.Time `json:"since"`
+}
+
+// fillDelta 计算与上一时间段相比的变化量
+func (t *TopTalker) fillDelta() {
+	t.Total = t.Upload + t.Download
+	t.Delta = t.Total - t.Previous
+	if t.Previous > 0 {
+		percent := float64(t.Delta) / float64(t.Previous) * 100
+		t.DeltaPercent = &percent
+	}
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// dateLayout 计划中日期的格式
+const dateLayout = "2006-01-02"
+
+// ErrInvalidSchedule 协议计划格式错误
+var ErrInvalidSchedule = errors.New("invalid protocol schedule")
+
+// ScheduleWindow 每日启用时段，End 早于 Start 时表示跨越午夜，如 22:00-06:00
+type ScheduleWindow struct {
+	Start string `json:"start"` // HH:MM
+	End   string `json:"end"`   // HH:MM
+}
+
+// ProtocolSchedule 协议定时启用和停用计划，时间按面板时区计算。
+// 时段、星期、日期和有效期作为 JSON 保存在 rules 列中
+type ProtocolSchedule struct {
+	Base
+	ProtocolID    int64            `json:"protocol_id" db:"protocol_id"`
+	Enabled       bool             `json:"enabled" db:"enabled"`                     // 计划是否生效，停用后协议保持当前状态
+	Windows       []ScheduleWindow `json:"windows" db:"-"`                           // 每日启用时段，为空表示全天
+	Weekdays      []int            `json:"weekdays" db:"-"`                          // 启用的星期，0 为周日，为空表示每天
+	DisabledDates []string         `json:"disabled_dates" db:"-"`                    // 停用的日期，YYYY-MM-DD
+	ActiveFrom    *time.Time       `json:"active_from,omitempty" db:"-"`             // 临时授权的开始时间
+	ActiveUntil   *time.Time       `json:"active_until,omitempty" db:"-"`            // 临时授权的结束时间
+	LastApplied   *time.Time       `json:"last_applied,omitempty" db:"last_applied"` // 最近一次按计划修改协议状态的时间
+	LastState     *bool            `json:"last_state,omitempty" db:"last_state"`     // 最近一次按计划设置的状态
+	LastError     string           `json:"last_error,omitempty" db:"last_error"`     // 最近一次执行失败的原因
+}
+
+// Validate 检查计划格式
+func (s *ProtocolSchedule) Validate() error {
+	for _, w := range s.Windows {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return fmt.Errorf("%w: window %s-%s is empty", ErrInvalidSchedule, w.Start, w.End)
+		}
+	}
+	for _, d := range s.Weekdays {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("%w: weekday %d out of range", ErrInvalidSchedule, d)
+		}
+	}
+	for _, d := range s.DisabledDates {
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return fmt.Errorf("%w: invalid date %q", ErrInvalidSchedule, d)
+		}
+	}
+	if s.ActiveFrom != nil && s.ActiveUntil != nil && !s.ActiveUntil.After(*s.ActiveFrom) {
+		return fmt.Errorf("%w: active_until must be after active_from", ErrInvalidSchedule)
+	}
+	return nil
+}
+
+// ActiveAt 返回协议在 t 时刻按计划是否应启用，t 应已转换为面板时区
+func (s *ProtocolSchedule) ActiveAt(t time.Time) bool {
+	if s.ActiveFrom != nil && t.Before(*s.ActiveFrom) {
+		return false
+	}
+	if s.ActiveUntil != nil && !t.Before(*s.ActiveUntil) {
+		return false
+	}
+	if len(s.Windows) == 0 {
+		return s.activeDay(t)
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s.Windows {
+		start, _ := parseClock(w.Start)
+		end, _ := parseClock(w.End)
+		if start < end {
+			if minute >= start && minute < end && s.activeDay(t) {
+				return true
+			}
+			continue
+		}
+		// 跨越午夜的时段，午夜后的部分属于开始的那一天
+		if minute >= start && s.activeDay(t) {
+			return true
+		}
+		if minute < end && s.activeDay(t.AddDate(0, 0, -1)) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeDay 判断某一天是否在启用的星期内且不是停用日期
+func (s *ProtocolSchedule) activeDay(t time.Time) bool {
+	date := t.Format(dateLayout)
+	for _, d := range s.DisabledDates {
+		if d == date {
+			return false
+		}
+	}
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range s.Weekdays {
+		if time.Weekday(d) == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock 将 HH:MM 解析为当天的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid time %q", ErrInvalidSchedule, s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
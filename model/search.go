@@ -0,0 +1,241 @@
+package model
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxSearchTerms 单次搜索最多使用的关键词数
+	maxSearchTerms = 5
+	// minFuzzyTermLength 启用按字符顺序模糊匹配的最短关键词长度
+	minFuzzyTermLength = 3
+)
+
+// SearchMatch 搜索命中信息，Start/End 为字段值中的字符偏移（按 rune 计，End 不含），
+// 模糊匹配时 Indexes 为逐个命中的字符位置
+type SearchMatch struct {
+	Field   string `json:"field"`
+	Term    string `json:"term"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Fuzzy   bool   `json:"fuzzy,omitempty"`
+	Indexes []int  `json:"indexes,omitempty"`
+}
+
+// ProtocolSearchResult 协议搜索结果
+type ProtocolSearchResult struct {
+	*Protocol
+	Score   int           `json:"score"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+// UserSearchResult 用户搜索结果
+type UserSearchResult struct {
+	*User
+	Score   int           `json:"score"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+// searchField 参与匹配和高亮的字段
+type searchField struct {
+	name  string
+	value string
+}
+
+// SearchTerms 规范化搜索关键词：去除首尾空白、全角转半角、转小写，按空白和逗号拆分并去重
+func SearchTerms(keyword string) []string {
+	normalized := strings.Map(func(r rune) rune {
+		// 全角 ASCII 字符和全角空格
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		} else if r == 0x3000 {
+			r = ' '
+		}
+		return unicode.ToLower(r)
+	}, strings.TrimSpace(keyword))
+
+	seen := make(map[string]bool)
+	var terms []string
+	for _, term := range strings.FieldsFunc(normalized, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	}) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		terms = append(terms, term)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// searchClause 生成 WHERE 条件：每个关键词至少命中一列，多个关键词之间为 AND。
+// exact 列做子串匹配，fuzzy 列在关键词足够长时按字符顺序匹配，列表达式需已转为小写。
+// 仅使用标准 LIKE，SQLite 可用；如增加 Postgres 实现可改用 pg_trgm 的相似度排序
+func searchClause(terms []string, exact, fuzzy []string) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for _, term := range terms {
+		var ors []string
+		for _, col := range exact {
+			ors = append(ors, col+` LIKE ? ESCAPE '\'`)
+			args = append(args, likeContains(term))
+		}
+		for _, col := range fuzzy {
+			ors = append(ors, col+` LIKE ? ESCAPE '\'`)
+			if utf8.RuneCountInString(term) >= minFuzzyTermLength {
+				args = append(args, likeFuzzy(term))
+			} else {
+				args = append(args, likeContains(term))
+			}
+		}
+		clauses = append(clauses, "("+strings.Join(ors, " OR ")+")")
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// likeEscape 转义 LIKE 通配符
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// likeContains 子串匹配模式
+func likeContains(term string) string {
+	return "%" + likeEscape(term) + "%"
+}
+
+// likeFuzzy 按字符顺序匹配模式，如 vms 匹配 vmess
+func likeFuzzy(term string) string {
+	var b strings.Builder
+	b.WriteByte('%')
+	for _, r := range term {
+		b.WriteString(likeEscape(string(r)))
+		b.WriteByte('%')
+	}
+	return b.String()
+}
+
+// matchFields 计算关键词在各字段中的命中位置和得分：完全相等 > 前缀 > 子串 > 模糊
+func matchFields(terms []string, fields []searchField) (int, []SearchMatch) {
+	score := 0
+	matches := []SearchMatch{}
+	for _, term := range terms {
+		termRunes := []rune(term)
+		for _, field := range fields {
+			if field.value == "" {
+				continue
+			}
+			value := []rune(strings.ToLower(field.value))
+
+			if i := runeIndex(value, termRunes); i >= 0 {
+				matches = append(matches, SearchMatch{Field: field.name, Term: term, Start: i, End: i + len(termRunes)})
+				switch {
+				case len(value) == len(termRunes):
+					score += 20
+				case i == 0:
+					score += 15
+				default:
+					score += 10
+				}
+				continue
+			}
+
+			if len(termRunes) >= minFuzzyTermLength {
+				if indexes := subsequenceIndexes(value, termRunes); indexes != nil {
+					matches = append(matches, SearchMatch{
+						Field:   field.name,
+						Term:    term,
+						Start:   indexes[0],
+						End:     indexes[len(indexes)-1] + 1,
+						Fuzzy:   true,
+						Indexes: indexes,
+					})
+					score += 2
+				}
+			}
+		}
+	}
+	return score, matches
+}
+
+// runeIndex 返回 sub 在 s 中首次出现的位置
+func runeIndex(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		found := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return i
+		}
+	}
+	return -1
+}
+
+// subsequenceIndexes 返回 sub 的每个字符按顺序在 s 中的位置，不匹配时返回 nil
+func subsequenceIndexes(s, sub []rune) []int {
+	indexes := make([]int, 0, len(sub))
+	j := 0
+	for i, r := range s {
+		if j < len(sub) && r == sub[j] {
+			indexes = append(indexes, i)
+			j++
+		}
+	}
+	if j < len(sub) {
+		return nil
+	}
+	return indexes
+}
+
+// RankProtocols 为协议搜索结果计算命中信息并按得分排序
+func RankProtocols(terms []string, protocols []*Protocol) []*ProtocolSearchResult {
+	results := make([]*ProtocolSearchResult, 0, len(protocols))
+	for _, p := range protocols {
+		fields := []searchField{
+			{"name", p.Name},
+			{"remark", p.Remark},
+			{"type", p.Type},
+			{"port", strconv.Itoa(p.Port)},
+			{"listen", p.Listen},
+			{"status", p.Status},
+		}
+		for _, tag := range p.Tags {
+			fields = append(fields, searchField{"tags", tag})
+		}
+		score, matches := matchFields(terms, fields)
+		results = append(results, &ProtocolSearchResult{Protocol: p, Score: score, Matches: matches})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// RankUsers 为用户搜索结果计算命中信息并按得分排序
+func RankUsers(terms []string, users []*User) []*UserSearchResult {
+	results := make([]*UserSearchResult, 0, len(users))
+	for _, u := range users {
+		score, matches := matchFields(terms, []searchField{
+			{"username", u.Username},
+			{"email", u.Email},
+			{"remark", u.Remark},
+			{"role", u.Role},
+			{"status", u.Status},
+		})
+		results = append(results, &UserSearchResult{User: u, Score: score, Matches: matches})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"v/common"
+
+	"github.com/google/uuid"
 )
 
 // SQLiteDB is the SQLite implementation of the DB interface
@@ -78,6 +81,11 @@ func (db *SQLiteDB) Close() error {
 	return db.db.Close()
 }
 
+// PoolStats 返回连接池统计，WaitCount 和 WaitDuration 反映连接争用
+func (db *SQLiteDB) PoolStats() sql.DBStats {
+	return db.db.Stats()
+}
+
 // AutoMigrate 执行自动迁移
 func (db *SQLiteDB) AutoMigrate() error {
 	db.logger.Info("执行自定义表创建，跳过自动迁移")
@@ -89,6 +97,17 @@ func (db *SQLiteDB) AutoMigrate() error {
 func (db *SQLiteDB) InitTables() error {
 	// 使用定制表创建语句，避免使用SQLite中的保留关键词
 	db.logger.Info("执行自定义表初始化")
+
+	// 主备模式的租约可以保存在单独的共享数据库中，该库不经过迁移，在此确保租约表存在
+	if _, err := db.db.Exec(`CREATE TABLE IF NOT EXISTS leader_leases (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		address TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create leader_leases table: %v", err)
+	}
 	return nil
 }
 
@@ -181,7 +200,7 @@ func (db *SQLiteDB) ListProtocolStatsByUserID(userID int64) ([]*ProtocolStats, e
 // GetAllUsers returns all users
 func (db *SQLiteDB) GetAllUsers() ([]*User, error) {
 	query := `SELECT 
-		id, username, email, password, salt, role, 
+		id, COALESCE(uuid, ''), username, email, password, salt, role, 
 		status, traffic_limit, traffic_used, expire_at, 
 		last_login_at, login_attempts, locked_until, is_admin,
 		created_at, updated_at
@@ -200,6 +219,7 @@ func (db *SQLiteDB) GetAllUsers() ([]*User, error) {
 
 		err := rows.Scan(
 			&user.ID,
+			&user.UUID,
 			&user.Username,
 			&user.Email,
 			&user.Password,
@@ -220,6 +240,10 @@ func (db *SQLiteDB) GetAllUsers() ([]*User, error) {
 			return nil, err
 		}
 
+		if user.Email, err = openField(user.Email); err != nil {
+			return nil, err
+		}
+
 		// Parse time fields
 		if expireAtStr != "" {
 			parsedTime, _ := time.Parse("2006-01-02 15:04:05", expireAtStr)
@@ -249,6 +273,61 @@ func (db *SQLiteDB) CleanupTraffic(before time.Time) error {
 	return err
 }
 
+// GetTopUsersByTraffic returns the users with the most traffic between start and end,
+// with totals for the preceding period of the same length
+func (db *SQLiteDB) GetTopUsersByTraffic(start, end time.Time, limit int) ([]*TopTalker, error) {
+	return db.topTalkers("user_id", "LEFT JOIN users n ON n.id = t.id", "COALESCE(n.username, '')", start, end, limit)
+}
+
+// GetTopProtocolsByTraffic returns the protocols with the most traffic between start and end,
+// with totals for the preceding period of the same length
+func (db *SQLiteDB) GetTopProtocolsByTraffic(start, end time.Time, limit int) ([]*TopTalker, error) {
+	return db.topTalkers("proxy_id", "LEFT JOIN protocols n ON n.id = t.id",
+		"COALESCE(NULLIF(n.remark, ''), n.type || ':' || n.port, '')", start, end, limit)
+}
+
+// topTalkers aggregates the current and previous period in a single range scan
+// over idx_traffic_created_at, grouped by groupCol
+func (db *SQLiteDB) topTalkers(groupCol, join, nameExpr string, start, end time.Time, limit int) ([]*TopTalker, error) {
+	const layout = "2006-01-02 15:04:05"
+	// created_at is stored in server local time
+	start, end = start.Local(), end.Local()
+	prevStart := start.Add(-end.Sub(start)).Format(layout)
+	startStr := start.Format(layout)
+
+	query := `SELECT t.id, ` + nameExpr + `, t.upload, t.download, t.previous
+	FROM (
+		SELECT ` + groupCol + ` AS id,
+			SUM(CASE WHEN created_at >= ? THEN up ELSE 0 END) AS upload,
+			SUM(CASE WHEN created_at >= ? THEN down ELSE 0 END) AS download,
+			SUM(CASE WHEN created_at < ? THEN up + down ELSE 0 END) AS previous
+		FROM traffic
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY ` + groupCol + `
+	) t
+	` + join + `
+	WHERE t.upload + t.download > 0
+	ORDER BY t.upload + t.download DESC
+	LIMIT ?`
+
+	rows, err := db.db.Query(query, startStr, startStr, startStr, prevStart, end.Format(layout), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top talkers: %w", err)
+	}
+	defer rows.Close()
+
+	talkers := []*TopTalker{}
+	for rows.Next() {
+		t := &TopTalker{}
+		if err := rows.Scan(&t.ID, &t.Name, &t.Upload, &t.Download, &t.Previous); err != nil {
+			return nil, fmt.Errorf("failed to scan top talker: %w", err)
+		}
+		t.fillDelta()
+		talkers = append(talkers, t)
+	}
+	return talkers, rows.Err()
+}
+
 // CreateAlert creates a new alert record
 func (db *SQLiteDB) CreateAlert(alert *AlertRecord) error {
 	now := time.Now().Format("2006-01-02 15:04:05")
@@ -635,30 +714,46 @@ func (db *SQLiteDB) ExportLogs(query *LogQuery) (string, error) {
 func (db *SQLiteDB) CreateProtocol(protocol *Protocol) error {
 	now := time.Now().Format("2006-01-02 15:04:05")
 
+	if protocol.UUID == "" {
+		protocol.UUID = uuid.NewString()
+	}
+	settings, err := sealBytes(protocol.Settings)
+	if err != nil {
+		return err
+	}
+
 	query := `INSERT INTO protocols (
-		user_id, type, settings, port, status, traffic_limit, 
+		uuid, user_id, type, settings, port, listen, remark, tags, status, traffic_limit, 
 		created_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := db.db.Exec(
+	result, err := db.db.Exec(
 		query,
+		protocol.UUID,
 		protocol.UserID,
 		protocol.Type,
-		protocol.Settings,
+		settings,
 		protocol.Port,
+		protocol.Listen,
+		protocol.Remark,
+		tagList(protocol.Tags).String(),
 		protocol.Status,
 		protocol.TrafficLimit,
 		now,
 		now,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	protocol.ID, _ = result.LastInsertId()
+	return nil
 }
 
 // GetProtocol retrieves a protocol by ID
 func (db *SQLiteDB) GetProtocol(id int64) (*Protocol, error) {
 	query := `SELECT 
-		id, user_id, type, settings, port, status, traffic_limit, 
+		id, COALESCE(uuid, ''), user_id, type, settings, port, COALESCE(listen, ''), COALESCE(remark, ''), COALESCE(tags, ''), status, traffic_limit, 
 		created_at, updated_at
 	FROM protocols WHERE id = ?`
 
@@ -669,10 +764,14 @@ func (db *SQLiteDB) GetProtocol(id int64) (*Protocol, error) {
 
 	err := row.Scan(
 		&protocol.ID,
+		&protocol.UUID,
 		&protocol.UserID,
 		&protocol.Type,
 		&protocol.Settings,
 		&protocol.Port,
+		&protocol.Listen,
+		&protocol.Remark,
+		(*tagList)(&protocol.Tags),
 		&protocol.Status,
 		&protocol.TrafficLimit,
 		&createdAtStr,
@@ -686,6 +785,10 @@ func (db *SQLiteDB) GetProtocol(id int64) (*Protocol, error) {
 		return nil, err
 	}
 
+	if protocol.Settings, err = openBytes(protocol.Settings); err != nil {
+		return nil, err
+	}
+
 	// Parse time fields
 	protocol.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
 	protocol.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAtStr)
@@ -693,10 +796,23 @@ func (db *SQLiteDB) GetProtocol(id int64) (*Protocol, error) {
 	return protocol, nil
 }
 
+// GetProtocolByUUID retrieves a protocol by its public UUID
+func (db *SQLiteDB) GetProtocolByUUID(publicID string) (*Protocol, error) {
+	var id int64
+	err := db.db.QueryRow(`SELECT id FROM protocols WHERE uuid = ?`, publicID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return db.GetProtocol(id)
+}
+
 // GetProtocolsByUserID retrieves all protocols for a user
 func (db *SQLiteDB) GetProtocolsByUserID(userID int64) ([]*Protocol, error) {
 	query := `SELECT 
-		id, user_id, type, settings, port, status, traffic_limit, 
+		id, COALESCE(uuid, ''), user_id, type, settings, port, COALESCE(listen, ''), COALESCE(remark, ''), COALESCE(tags, ''), status, traffic_limit, 
 		created_at, updated_at
 	FROM protocols WHERE user_id = ?`
 
@@ -713,10 +829,14 @@ func (db *SQLiteDB) GetProtocolsByUserID(userID int64) ([]*Protocol, error) {
 
 		err := rows.Scan(
 			&protocol.ID,
+			&protocol.UUID,
 			&protocol.UserID,
 			&protocol.Type,
 			&protocol.Settings,
 			&protocol.Port,
+			&protocol.Listen,
+			&protocol.Remark,
+			(*tagList)(&protocol.Tags),
 			&protocol.Status,
 			&protocol.TrafficLimit,
 			&createdAtStr,
@@ -727,6 +847,10 @@ func (db *SQLiteDB) GetProtocolsByUserID(userID int64) ([]*Protocol, error) {
 			return nil, err
 		}
 
+		if protocol.Settings, err = openBytes(protocol.Settings); err != nil {
+			return nil, err
+		}
+
 		// Parse time fields
 		protocol.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
 		protocol.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAtStr)
@@ -744,18 +868,25 @@ func (db *SQLiteDB) GetProtocolsByUserID(userID int64) ([]*Protocol, error) {
 // UpdateProtocol updates a protocol
 func (db *SQLiteDB) UpdateProtocol(protocol *Protocol) error {
 	now := time.Now().Format("2006-01-02 15:04:05")
+	settings, err := sealBytes(protocol.Settings)
+	if err != nil {
+		return err
+	}
 
 	query := `UPDATE protocols SET
-		user_id = ?, type = ?, settings = ?, port = ?, status = ?, 
+		user_id = ?, type = ?, settings = ?, port = ?, listen = ?, remark = ?, tags = ?, status = ?, 
 		traffic_limit = ?, updated_at = ?
 	WHERE id = ?`
 
-	_, err := db.db.Exec(
+	_, err = db.db.Exec(
 		query,
 		protocol.UserID,
 		protocol.Type,
-		protocol.Settings,
+		settings,
 		protocol.Port,
+		protocol.Listen,
+		protocol.Remark,
+		tagList(protocol.Tags).String(),
 		protocol.Status,
 		protocol.TrafficLimit,
 		now,
@@ -775,7 +906,7 @@ func (db *SQLiteDB) DeleteProtocol(id int64) error {
 // GetProtocolsByPort retrieves protocols by port
 func (db *SQLiteDB) GetProtocolsByPort(port int) ([]*Protocol, error) {
 	query := `SELECT 
-		id, user_id, type, settings, port, status, traffic_limit, 
+		id, COALESCE(uuid, ''), user_id, type, settings, port, COALESCE(listen, ''), COALESCE(remark, ''), COALESCE(tags, ''), status, traffic_limit, 
 		created_at, updated_at
 	FROM protocols WHERE port = ?`
 
@@ -792,10 +923,14 @@ func (db *SQLiteDB) GetProtocolsByPort(port int) ([]*Protocol, error) {
 
 		err := rows.Scan(
 			&protocol.ID,
+			&protocol.UUID,
 			&protocol.UserID,
 			&protocol.Type,
 			&protocol.Settings,
 			&protocol.Port,
+			&protocol.Listen,
+			&protocol.Remark,
+			(*tagList)(&protocol.Tags),
 			&protocol.Status,
 			&protocol.TrafficLimit,
 			&createdAtStr,
@@ -806,6 +941,10 @@ func (db *SQLiteDB) GetProtocolsByPort(port int) ([]*Protocol, error) {
 			return nil, err
 		}
 
+		if protocol.Settings, err = openBytes(protocol.Settings); err != nil {
+			return nil, err
+		}
+
 		// Parse time fields
 		protocol.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
 		protocol.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAtStr)
@@ -825,7 +964,7 @@ func (db *SQLiteDB) ListProtocols(page, pageSize int) ([]*Protocol, error) {
 	offset := (page - 1) * pageSize
 
 	query := `SELECT 
-		id, user_id, type, settings, port, status, traffic_limit, 
+		id, COALESCE(uuid, ''), user_id, type, settings, port, COALESCE(listen, ''), COALESCE(remark, ''), COALESCE(tags, ''), status, traffic_limit, 
 		created_at, updated_at
 	FROM protocols ORDER BY id DESC LIMIT ? OFFSET ?`
 
@@ -842,10 +981,14 @@ func (db *SQLiteDB) ListProtocols(page, pageSize int) ([]*Protocol, error) {
 
 		err := rows.Scan(
 			&protocol.ID,
+			&protocol.UUID,
 			&protocol.UserID,
 			&protocol.Type,
 			&protocol.Settings,
 			&protocol.Port,
+			&protocol.Listen,
+			&protocol.Remark,
+			(*tagList)(&protocol.Tags),
 			&protocol.Status,
 			&protocol.TrafficLimit,
 			&createdAtStr,
@@ -856,6 +999,10 @@ func (db *SQLiteDB) ListProtocols(page, pageSize int) ([]*Protocol, error) {
 			return nil, err
 		}
 
+		if protocol.Settings, err = openBytes(protocol.Settings); err != nil {
+			return nil, err
+		}
+
 		// Parse time fields
 		protocol.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
 		protocol.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAtStr)
@@ -870,19 +1017,28 @@ func (db *SQLiteDB) ListProtocols(page, pageSize int) ([]*Protocol, error) {
 	return protocols, nil
 }
 
-// SearchProtocols searches protocols by keyword
+// SearchProtocols searches protocols by keyword, case-insensitive across type, remark,
+// tags, port, listen, status and settings (only when stored unencrypted); longer keywords also match fuzzily by
+// character order. Use RankProtocols to order results and get highlight metadata.
 func (db *SQLiteDB) SearchProtocols(keyword string) ([]*Protocol, error) {
-	// Use LIKE for simple searching
+	terms := SearchTerms(keyword)
+	if len(terms) == 0 {
+		return []*Protocol{}, nil
+	}
+
+	where, args := searchClause(terms,
+		[]string{"LOWER(type)", "LOWER(status)", "LOWER(COALESCE(listen, ''))", "CAST(port AS TEXT)", "LOWER(CAST(settings AS TEXT))"},
+		[]string{"LOWER(COALESCE(remark, ''))", "LOWER(COALESCE(tags, ''))"},
+	)
+
 	query := `SELECT 
-		id, user_id, type, settings, port, status, traffic_limit, 
+		id, COALESCE(uuid, ''), user_id, type, settings, port, COALESCE(listen, ''), COALESCE(remark, ''), COALESCE(tags, ''), status, traffic_limit, 
 		created_at, updated_at
 	FROM protocols 
-	WHERE type LIKE ? OR settings LIKE ? OR status LIKE ?
+	WHERE ` + where + `
 	ORDER BY id DESC`
 
-	likeParam := "%" + keyword + "%"
-
-	rows, err := db.db.Query(query, likeParam, likeParam, likeParam)
+	rows, err := db.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -895,10 +1051,14 @@ func (db *SQLiteDB) SearchProtocols(keyword string) ([]*Protocol, error) {
 
 		err := rows.Scan(
 			&protocol.ID,
+			&protocol.UUID,
 			&protocol.UserID,
 			&protocol.Type,
 			&protocol.Settings,
 			&protocol.Port,
+			&protocol.Listen,
+			&protocol.Remark,
+			(*tagList)(&protocol.Tags),
 			&protocol.Status,
 			&protocol.TrafficLimit,
 			&createdAtStr,
@@ -909,6 +1069,10 @@ func (db *SQLiteDB) SearchProtocols(keyword string) ([]*Protocol, error) {
 			return nil, err
 		}
 
+		if protocol.Settings, err = openBytes(protocol.Settings); err != nil {
+			return nil, err
+		}
+
 		// Parse time fields
 		protocol.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
 		protocol.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAtStr)
@@ -1669,7 +1833,7 @@ func (db *SQLiteDB) ListTrafficByProxyID(proxyID int64) ([]*common.TrafficStats,
 }
 
 // GetTrafficStats retrieves traffic statistics for a user
-func (db *SQLiteDB) GetTrafficStats(userID uint) (*TrafficStats, error) {
+func (db *SQLiteDB) GetTrafficStats(userID int64) (*TrafficStats, error) {
 	query := `SELECT 
 		id, user_id, upload, download, total, traffic_limit, expire_at, last_reset_at, created_at, updated_at
 	FROM traffic_stats WHERE user_id = ?`
@@ -1713,8 +1877,8 @@ func (db *SQLiteDB) CreateTrafficRecord(traffic *Traffic) error {
 	now := time.Now().Format("2006-01-02 15:04:05")
 
 	query := `INSERT INTO traffic (
-		user_id, proxy_id, up, down, created_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?)`
+		user_id, proxy_id, up, down, kind, note, operator, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	result, err := db.db.Exec(
 		query,
@@ -1722,6 +1886,9 @@ func (db *SQLiteDB) CreateTrafficRecord(traffic *Traffic) error {
 		traffic.ProxyID,
 		traffic.Up,
 		traffic.Down,
+		traffic.Kind,
+		traffic.Note,
+		traffic.Operator,
 		now,
 		now,
 	)
@@ -1738,6 +1905,565 @@ func (db *SQLiteDB) CreateTrafficRecord(traffic *Traffic) error {
 	return nil
 }
 
+// AdjustUserTraffic records a manual traffic adjustment and applies it to the
+// user's usage in one transaction; usage never drops below zero
+func (db *SQLiteDB) AdjustUserTraffic(adjustment *Traffic) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	nowStr := now.Format("2006-01-02 15:04:05")
+
+	result, err := tx.Exec(`UPDATE users SET traffic_used = MAX(0, traffic_used + ?), updated_at = ? WHERE id = ?`,
+		adjustment.Up+adjustment.Down, nowStr, adjustment.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to adjust user traffic: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	adjustment.Kind = TrafficKindAdjustment
+	result, err = tx.Exec(`INSERT INTO traffic (
+		user_id, proxy_id, up, down, kind, note, operator, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		adjustment.UserID, adjustment.ProxyID, adjustment.Up, adjustment.Down,
+		adjustment.Kind, adjustment.Note, adjustment.Operator, nowStr, nowStr)
+	if err != nil {
+		return fmt.Errorf("failed to record traffic adjustment: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	adjustment.ID = id
+	adjustment.CreatedAt = now
+	adjustment.UpdatedAt = now
+	return nil
+}
+
+// ListTrafficAdjustments returns the manual traffic adjustments of a user, newest first
+func (db *SQLiteDB) ListTrafficAdjustments(userID int64) ([]*Traffic, error) {
+	rows, err := db.db.Query(`SELECT id, user_id, proxy_id, up, down, kind, note, operator, created_at, updated_at
+	FROM traffic WHERE user_id = ? AND kind = ? ORDER BY created_at DESC, id DESC`, userID, TrafficKindAdjustment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query traffic adjustments: %v", err)
+	}
+	defer rows.Close()
+
+	adjustments := []*Traffic{}
+	for rows.Next() {
+		t := &Traffic{}
+		var createdAtStr, updatedAtStr string
+		if err := rows.Scan(&t.ID, &t.UserID, &t.ProxyID, &t.Up, &t.Down, &t.Kind, &t.Note, &t.Operator,
+			&createdAtStr, &updatedAtStr); err != nil {
+			return nil, fmt.Errorf("failed to scan traffic adjustment: %v", err)
+		}
+		t.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		t.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAtStr)
+		adjustments = append(adjustments, t)
+	}
+	return adjustments, rows.Err()
+}
+
+// subscriptionColumns 订阅查询的列
+const subscriptionColumns = `id, user_id, token, COALESCE(webhook_url, ''), COALESCE(webhook_secret, ''),
+	profile_version, last_fetched_at, last_notified_at, COALESCE(last_notify_error, ''), created_at, updated_at`
+
+// GetSubscription returns the subscription of a user, or nil if the user has none
+func (db *SQLiteDB) GetSubscription(userID int64) (*Subscription, error) {
+	return db.querySubscription(`SELECT `+subscriptionColumns+` FROM subscriptions WHERE user_id = ?`, userID)
+}
+
+// GetSubscriptionByToken returns the subscription with the given token, or nil if none matches
+func (db *SQLiteDB) GetSubscriptionByToken(token string) (*Subscription, error) {
+	return db.querySubscription(`SELECT `+subscriptionColumns+` FROM subscriptions WHERE token = ?`, token)
+}
+
+// querySubscription scans a single subscription row
+func (db *SQLiteDB) querySubscription(query string, args ...interface{}) (*Subscription, error) {
+	sub, err := scanSubscription(db.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %v", err)
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns all subscriptions
+func (db *SQLiteDB) ListSubscriptions() ([]*Subscription, error) {
+	rows, err := db.db.Query(`SELECT ` + subscriptionColumns + ` FROM subscriptions ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	subs := []*Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// SaveSubscription inserts or updates the subscription of sub.UserID
+func (db *SQLiteDB) SaveSubscription(sub *Subscription) error {
+	now := time.Now()
+	nowStr := now.Format("2006-01-02 15:04:05")
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = now
+	}
+	if sub.ProfileVersion <= 0 {
+		sub.ProfileVersion = 1
+	}
+
+	result, err := db.db.Exec(`INSERT INTO subscriptions (
+		user_id, token, webhook_url, webhook_secret, profile_version,
+		last_fetched_at, last_notified_at, last_notify_error, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		token = excluded.token,
+		webhook_url = excluded.webhook_url,
+		webhook_secret = excluded.webhook_secret,
+		profile_version = excluded.profile_version,
+		last_fetched_at = excluded.last_fetched_at,
+		last_notified_at = excluded.last_notified_at,
+		last_notify_error = excluded.last_notify_error,
+		updated_at = excluded.updated_at`,
+		sub.UserID, sub.Token, sub.WebhookURL, sub.WebhookSecret, sub.ProfileVersion,
+		formatNullTime(sub.LastFetchedAt), formatNullTime(sub.LastNotifiedAt), sub.LastNotifyError,
+		sub.CreatedAt.Format("2006-01-02 15:04:05"), nowStr)
+	if err != nil {
+		return fmt.Errorf("failed to save subscription: %v", err)
+	}
+
+	if sub.ID == 0 {
+		if id, err := result.LastInsertId(); err == nil {
+			sub.ID = id
+		}
+	}
+	sub.UpdatedAt = now
+	return nil
+}
+
+// UpdateSubscriptionNotifyStatus 只更新 webhook 推送结果，notifiedAt 为 nil 时保留上次成功推送的时间，
+// 不会覆盖推送期间修改的令牌、webhook 地址和版本号
+func (db *SQLiteDB) UpdateSubscriptionNotifyStatus(userID int64, notifiedAt *time.Time, notifyError string) error {
+	_, err := db.db.Exec(`UPDATE subscriptions SET
+		last_notified_at = COALESCE(?, last_notified_at),
+		last_notify_error = ?,
+		updated_at = ?
+	WHERE user_id = ?`,
+		formatNullTime(notifiedAt), notifyError, time.Now().Format("2006-01-02 15:04:05"), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update subscription notify status: %v", err)
+	}
+	return nil
+}
+
+// scanSubscription scans a subscription from a row
+func scanSubscription(row interface{ Scan(...interface{}) error }) (*Subscription, error) {
+	sub := &Subscription{}
+	var lastFetchedAt, lastNotifiedAt, createdAt, updatedAt sql.NullTime
+	if err := row.Scan(&sub.ID, &sub.UserID, &sub.Token, &sub.WebhookURL, &sub.WebhookSecret,
+		&sub.ProfileVersion, &lastFetchedAt, &lastNotifiedAt, &sub.LastNotifyError, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if lastFetchedAt.Valid {
+		sub.LastFetchedAt = &lastFetchedAt.Time
+	}
+	if lastNotifiedAt.Valid {
+		sub.LastNotifiedAt = &lastNotifiedAt.Time
+	}
+	sub.CreatedAt = createdAt.Time
+	sub.UpdatedAt = updatedAt.Time
+	return sub, nil
+}
+
+// formatNullTime formats an optional time for storage
+func formatNullTime(t *time.Time) interface{} {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// scheduleColumns 协议计划查询的列
+const scheduleColumns = `id, protocol_id, enabled, COALESCE(rules, '{}'), last_applied, last_state,
+	COALESCE(last_error, ''), created_at, updated_at`
+
+// scheduleRules 协议计划中以 JSON 保存的规则
+type scheduleRules struct {
+	Windows       []ScheduleWindow `json:"windows,omitempty"`
+	Weekdays      []int            `json:"weekdays,omitempty"`
+	DisabledDates []string         `json:"disabled_dates,omitempty"`
+	ActiveFrom    *time.Time       `json:"active_from,omitempty"`
+	ActiveUntil   *time.Time       `json:"active_until,omitempty"`
+}
+
+// GetProtocolSchedule returns the schedule of a protocol, or nil if it has none
+func (db *SQLiteDB) GetProtocolSchedule(protocolID int64) (*ProtocolSchedule, error) {
+	s, err := scanProtocolSchedule(db.db.QueryRow(`SELECT `+scheduleColumns+` FROM protocol_schedules WHERE protocol_id = ?`, protocolID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get protocol schedule: %v", err)
+	}
+	return s, nil
+}
+
+// ListProtocolSchedules returns all protocol schedules
+func (db *SQLiteDB) ListProtocolSchedules() ([]*ProtocolSchedule, error) {
+	rows, err := db.db.Query(`SELECT ` + scheduleColumns + ` FROM protocol_schedules ORDER BY protocol_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query protocol schedules: %v", err)
+	}
+	defer rows.Close()
+
+	schedules := []*ProtocolSchedule{}
+	for rows.Next() {
+		s, err := scanProtocolSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan protocol schedule: %v", err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// SaveProtocolSchedule inserts or updates the schedule of s.ProtocolID
+func (db *SQLiteDB) SaveProtocolSchedule(s *ProtocolSchedule) error {
+	rules, err := json.Marshal(scheduleRules{
+		Windows:       s.Windows,
+		Weekdays:      s.Weekdays,
+		DisabledDates: s.DisabledDates,
+		ActiveFrom:    s.ActiveFrom,
+		ActiveUntil:   s.ActiveUntil,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule rules: %v", err)
+	}
+
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	var lastState interface{}
+	if s.LastState != nil {
+		lastState = *s.LastState
+	}
+
+	result, err := db.db.Exec(`INSERT INTO protocol_schedules (
+		protocol_id, enabled, rules, last_applied, last_state, last_error, created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(protocol_id) DO UPDATE SET
+		enabled = excluded.enabled,
+		rules = excluded.rules,
+		last_applied = excluded.last_applied,
+		last_state = excluded.last_state,
+		last_error = excluded.last_error,
+		updated_at = excluded.updated_at`,
+		s.ProtocolID, s.Enabled, string(rules), formatNullTime(s.LastApplied), lastState, s.LastError,
+		s.CreatedAt.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("failed to save protocol schedule: %v", err)
+	}
+
+	if s.ID == 0 {
+		if id, err := result.LastInsertId(); err == nil {
+			s.ID = id
+		}
+	}
+	s.UpdatedAt = now
+	return nil
+}
+
+// DeleteProtocolSchedule deletes the schedule of a protocol
+func (db *SQLiteDB) DeleteProtocolSchedule(protocolID int64) error {
+	if _, err := db.db.Exec(`DELETE FROM protocol_schedules WHERE protocol_id = ?`, protocolID); err != nil {
+		return fmt.Errorf("failed to delete protocol schedule: %v", err)
+	}
+	return nil
+}
+
+// scanProtocolSchedule scans a protocol schedule from a row
+func scanProtocolSchedule(row interface{ Scan(...interface{}) error }) (*ProtocolSchedule, error) {
+	s := &ProtocolSchedule{}
+	var rules string
+	var lastApplied, createdAt, updatedAt sql.NullTime
+	var lastState sql.NullBool
+	if err := row.Scan(&s.ID, &s.ProtocolID, &s.Enabled, &rules, &lastApplied, &lastState,
+		&s.LastError, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	var r scheduleRules
+	if err := json.Unmarshal([]byte(rules), &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule rules: %v", err)
+	}
+	s.Windows = r.Windows
+	s.Weekdays = r.Weekdays
+	s.DisabledDates = r.DisabledDates
+	s.ActiveFrom = r.ActiveFrom
+	s.ActiveUntil = r.ActiveUntil
+
+	if lastApplied.Valid {
+		s.LastApplied = &lastApplied.Time
+	}
+	if lastState.Valid {
+		s.LastState = &lastState.Bool
+	}
+	s.CreatedAt = createdAt.Time
+	s.UpdatedAt = updatedAt.Time
+	return s, nil
+}
+
+// AppendStreamEvent appends an event to the stream history and sets its ID
+func (db *SQLiteDB) AppendStreamEvent(event *StreamEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	data := event.Data
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	result, err := db.db.Exec(`INSERT INTO stream_events (type, data, created_at) VALUES (?, ?, ?)`,
+		event.Type, string(data), event.CreatedAt.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("failed to append stream event: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get stream event id: %v", err)
+	}
+	event.ID = id
+	return nil
+}
+
+// ListStreamEvents returns up to limit events with ID greater than after, oldest first
+func (db *SQLiteDB) ListStreamEvents(after int64, limit int) ([]*StreamEvent, error) {
+	rows, err := db.db.Query(`SELECT id, type, data, created_at FROM stream_events
+		WHERE id > ? ORDER BY id LIMIT ?`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stream events: %v", err)
+	}
+	defer rows.Close()
+
+	events := []*StreamEvent{}
+	for rows.Next() {
+		event := &StreamEvent{}
+		var data string
+		var createdAt sql.NullTime
+		if err := rows.Scan(&event.ID, &event.Type, &data, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan stream event: %v", err)
+		}
+		event.Data = json.RawMessage(data)
+		event.CreatedAt = createdAt.Time
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// PruneStreamEvents keeps only the newest keep events
+func (db *SQLiteDB) PruneStreamEvents(keep int) error {
+	if _, err := db.db.Exec(`DELETE FROM stream_events WHERE id <= (SELECT COALESCE(MAX(id), 0) FROM stream_events) - ?`, keep); err != nil {
+		return fmt.Errorf("failed to prune stream events: %v", err)
+	}
+	return nil
+}
+
+// leaseTimeLayout 租约时间统一按 UTC 保存，多个实例的时区不同时也能直接比较
+const leaseTimeLayout = "2006-01-02 15:04:05"
+
+// AcquireLease 获取或续约租约：没有租约、租约已过期或由 holder 持有时写入新的到期时间，
+// 返回写入后的当前租约，调用方比较 Holder 判断是否取得租约
+func (db *SQLiteDB) AcquireLease(name, holder, address string, ttl time.Duration) (*LeaderLease, error) {
+	now := time.Now().UTC()
+	_, err := db.db.Exec(`INSERT INTO leader_leases (name, holder, address, expires_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET holder = excluded.holder, address = excluded.address,
+			expires_at = excluded.expires_at, updated_at = excluded.updated_at
+		WHERE leader_leases.holder = excluded.holder OR leader_leases.expires_at <= ?`,
+		name, holder, address, now.Add(ttl).Format(leaseTimeLayout), now.Format(leaseTimeLayout), now.Format(leaseTimeLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lease: %v", err)
+	}
+
+	lease := &LeaderLease{Name: name}
+	var expiresAt, updatedAt sql.NullTime
+	err = db.db.QueryRow(`SELECT holder, address, expires_at, updated_at FROM leader_leases WHERE name = ?`, name).
+		Scan(&lease.Holder, &lease.Address, &expiresAt, &updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lease: %v", err)
+	}
+	lease.ExpiresAt = expiresAt.Time
+	lease.UpdatedAt = updatedAt.Time
+	return lease, nil
+}
+
+// ReleaseLease 释放 holder 持有的租约，其他实例可以立即接管
+func (db *SQLiteDB) ReleaseLease(name, holder string) error {
+	if _, err := db.db.Exec(`DELETE FROM leader_leases WHERE name = ? AND holder = ?`, name, holder); err != nil {
+		return fmt.Errorf("failed to release lease: %v", err)
+	}
+	return nil
+}
+
+// notificationTimeLayout 通知时间的保存格式
+const notificationTimeLayout = "2006-01-02 15:04:05"
+
+// notificationFilter 根据查询条件生成通知的 WHERE 子句和参数
+func notificationFilter(query *NotificationQuery) (string, []interface{}) {
+	where := " WHERE 1=1"
+	var args []interface{}
+	if query == nil {
+		return where, args
+	}
+	if query.Category != "" {
+		where += " AND category = ?"
+		args = append(args, query.Category)
+	}
+	if query.Level != "" {
+		where += " AND level = ?"
+		args = append(args, query.Level)
+	}
+	if query.Unread {
+		where += " AND is_read = 0"
+	}
+	if query.Key != "" {
+		where += " AND dedup_key = ?"
+		args = append(args, query.Key)
+	}
+	if !query.Since.IsZero() {
+		where += " AND created_at >= ?"
+		args = append(args, query.Since.UTC().Format(notificationTimeLayout))
+	}
+	if !query.Until.IsZero() {
+		where += " AND created_at <= ?"
+		args = append(args, query.Until.UTC().Format(notificationTimeLayout))
+	}
+	return where, args
+}
+
+// CreateNotification 保存通知并设置 ID
+func (db *SQLiteDB) CreateNotification(n *Notification) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	result, err := db.db.Exec(`INSERT INTO notifications (category, level, title, body, source, dedup_key, is_read, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?)`,
+		n.Category, n.Level, n.Title, n.Body, n.Source, n.Key, n.CreatedAt.UTC().Format(notificationTimeLayout))
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get notification id: %v", err)
+	}
+	n.ID = id
+	n.Read = false
+	n.ReadAt = nil
+	return nil
+}
+
+// ListNotifications 按查询条件获取通知，最新的在前
+func (db *SQLiteDB) ListNotifications(query *NotificationQuery) ([]*Notification, error) {
+	where, args := notificationFilter(query)
+	sqlQuery := `SELECT id, category, level, title, body, source, dedup_key, is_read, read_at, created_at
+		FROM notifications` + where + ` ORDER BY id DESC`
+	if query != nil && query.Page > 0 && query.PageSize > 0 {
+		sqlQuery += " LIMIT ? OFFSET ?"
+		args = append(args, query.PageSize, (query.Page-1)*query.PageSize)
+	}
+
+	rows, err := db.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %v", err)
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		var readAt, createdAt sql.NullString
+		if err := rows.Scan(&n.ID, &n.Category, &n.Level, &n.Title, &n.Body, &n.Source, &n.Key, &n.Read, &readAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %v", err)
+		}
+		if readAt.Valid {
+			if t, err := time.Parse(notificationTimeLayout, readAt.String); err == nil {
+				n.ReadAt = &t
+			}
+		}
+		if createdAt.Valid {
+			n.CreatedAt, _ = time.Parse(notificationTimeLayout, createdAt.String)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountNotifications 统计符合查询条件的通知数量，忽略分页
+func (db *SQLiteDB) CountNotifications(query *NotificationQuery) (int64, error) {
+	where, args := notificationFilter(query)
+	var count int64
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM notifications`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %v", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationsRead 将指定的未读通知标记为已读，返回更新的数量
+func (db *SQLiteDB) MarkNotificationsRead(ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := []interface{}{time.Now().UTC().Format(notificationTimeLayout)}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	result, err := db.db.Exec(`UPDATE notifications SET is_read = 1, read_at = ?
+		WHERE is_read = 0 AND id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// MarkAllNotificationsRead 将符合查询条件的未读通知全部标记为已读，返回更新的数量
+func (db *SQLiteDB) MarkAllNotificationsRead(query *NotificationQuery) (int64, error) {
+	where, args := notificationFilter(query)
+	args = append([]interface{}{time.Now().UTC().Format(notificationTimeLayout)}, args...)
+	result, err := db.db.Exec(`UPDATE notifications SET is_read = 1, read_at = ?`+where+` AND is_read = 0`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// PruneNotifications 删除早于 before 的已读通知，未读通知一直保留
+func (db *SQLiteDB) PruneNotifications(before time.Time) error {
+	if _, err := db.db.Exec(`DELETE FROM notifications WHERE is_read = 1 AND created_at < ?`,
+		before.UTC().Format(notificationTimeLayout)); err != nil {
+		return fmt.Errorf("failed to prune notifications: %v", err)
+	}
+	return nil
+}
+
 // CreateTrafficHistory creates traffic history record
 func (db *SQLiteDB) CreateTrafficHistory(history *TrafficHistory) error {
 	now := time.Now().Format("2006-01-02 15:04:05")
@@ -1771,6 +2497,28 @@ func (db *SQLiteDB) CreateTrafficHistory(history *TrafficHistory) error {
 
 // CreateUser creates a new user
 func (db *SQLiteDB) CreateUser(user *User) error {
+	return insertUser(db.db, user)
+}
+
+// CreateUsers 在一个事务中创建多个用户，任一用户失败时全部回滚
+func (db *SQLiteDB) CreateUsers(users []*User) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := insertUser(tx, user); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to create user %s: %w", user.Username, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// insertUser 插入用户，可在事务中执行
+func insertUser(exec interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, user *User) error {
 	now := time.Now().Format("2006-01-02 15:04:05")
 
 	var expireAtStr string
@@ -1788,16 +2536,30 @@ func (db *SQLiteDB) CreateUser(user *User) error {
 		lockedUntilStr = user.LockedUntil.Format("2006-01-02 15:04:05")
 	}
 
+	if user.UUID == "" {
+		user.UUID = uuid.NewString()
+	}
+	email, err := sealField(user.Email)
+	if err != nil {
+		return err
+	}
+	pendingEmail, err := sealField(user.PendingEmail)
+	if err != nil {
+		return err
+	}
+
 	query := `INSERT INTO users (
-		username, email, password, salt, role, status, traffic_limit, traffic_used,
+		uuid, username, email, email_hash, password, salt, role, status, traffic_limit, traffic_used,
 		last_login_at, login_attempts, locked_until, is_admin, expire_at, 
-		created_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		created_at, updated_at, remark, activity_opt_out, email_verified, pending_email, sso_issuer, sso_subject
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := db.db.Exec(
+	result, err := exec.Exec(
 		query,
+		user.UUID,
 		user.Username,
-		user.Email,
+		email,
+		emailHash(user.Email),
 		user.Password,
 		user.Salt,
 		user.Role,
@@ -1811,6 +2573,12 @@ func (db *SQLiteDB) CreateUser(user *User) error {
 		expireAtStr,
 		now,
 		now,
+		user.Remark,
+		boolToInt(user.ActivityOptOut),
+		boolToInt(user.EmailVerified),
+		pendingEmail,
+		user.SSOIssuer,
+		user.SSOSubject,
 	)
 	if err != nil {
 		return err
@@ -1919,17 +2687,20 @@ func (db *SQLiteDB) GetTotalUsers() (int64, error) {
 
 // GetUser 根据ID获取用户
 func (db *SQLiteDB) GetUser(id int64) (*User, error) {
-	query := `SELECT id, username, email, password, salt, role, status, traffic_limit, traffic_used, 
-              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at 
+	query := `SELECT id, COALESCE(uuid, ''), username, email, password, salt, role, status, traffic_limit, traffic_used, 
+              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at,
+              COALESCE(remark, ''), COALESCE(activity_opt_out, 0), COALESCE(email_verified, 0), COALESCE(pending_email, ''),
+              COALESCE(sso_issuer, ''), COALESCE(sso_subject, '')
               FROM users WHERE id = ?`
 
 	user := &User{}
 	var lastLoginAt, lockedUntil, expireAt, createdAt, updatedAt sql.NullString
 
 	err := db.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
+		&user.ID, &user.UUID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
 		&user.TrafficLimit, &user.TrafficUsed, &lastLoginAt, &user.LoginAttempts, &lockedUntil,
-		&user.IsAdmin, &expireAt, &createdAt, &updatedAt,
+		&user.IsAdmin, &expireAt, &createdAt, &updatedAt, &user.Remark, &user.ActivityOptOut,
+		&user.EmailVerified, &user.PendingEmail, &user.SSOIssuer, &user.SSOSubject,
 	)
 
 	if err != nil {
@@ -1939,6 +2710,13 @@ func (db *SQLiteDB) GetUser(id int64) (*User, error) {
 		return nil, err
 	}
 
+	if user.Email, err = openField(user.Email); err != nil {
+		return nil, err
+	}
+	if user.PendingEmail, err = openField(user.PendingEmail); err != nil {
+		return nil, err
+	}
+
 	// 处理可空时间字段
 	if lastLoginAt.Valid {
 		lastLogin, err := time.Parse("2006-01-02 15:04:05", lastLoginAt.String)
@@ -1972,19 +2750,48 @@ func (db *SQLiteDB) GetUser(id int64) (*User, error) {
 	return user, nil
 }
 
+// GetUserByUUID 根据公开的 UUID 获取用户
+func (db *SQLiteDB) GetUserByUUID(publicID string) (*User, error) {
+	var id int64
+	err := db.db.QueryRow(`SELECT id FROM users WHERE uuid = ?`, publicID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // 用户不存在
+		}
+		return nil, err
+	}
+	return db.GetUser(id)
+}
+
+// GetUserByIdentity 根据单点登录的身份来源和用户标识获取用户
+func (db *SQLiteDB) GetUserByIdentity(issuer, subject string) (*User, error) {
+	var id int64
+	err := db.db.QueryRow(`SELECT id FROM users WHERE sso_issuer = ? AND sso_subject = ?`, issuer, subject).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // 用户不存在
+		}
+		return nil, err
+	}
+	return db.GetUser(id)
+}
+
 // GetUserByEmail 根据邮箱获取用户
 func (db *SQLiteDB) GetUserByEmail(email string) (*User, error) {
-	query := `SELECT id, username, email, password, salt, role, status, traffic_limit, traffic_used, 
-              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at 
-              FROM users WHERE email = ?`
+	query := `SELECT id, COALESCE(uuid, ''), username, email, password, salt, role, status, traffic_limit, traffic_used, 
+              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at,
+              COALESCE(remark, ''), COALESCE(activity_opt_out, 0), COALESCE(email_verified, 0), COALESCE(pending_email, ''),
+              COALESCE(sso_issuer, ''), COALESCE(sso_subject, '')
+              FROM users WHERE email = ? OR (email_hash != '' AND email_hash = ?)`
 
 	user := &User{}
 	var lastLoginAt, lockedUntil, expireAt, createdAt, updatedAt sql.NullString
 
-	err := db.db.QueryRow(query, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
+	err := db.db.QueryRow(query, email, emailHash(email)).Scan(
+		&user.ID, &user.UUID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
 		&user.TrafficLimit, &user.TrafficUsed, &lastLoginAt, &user.LoginAttempts, &lockedUntil,
-		&user.IsAdmin, &expireAt, &createdAt, &updatedAt,
+		&user.IsAdmin, &expireAt, &createdAt, &updatedAt, &user.Remark, &user.ActivityOptOut,
+		&user.EmailVerified, &user.PendingEmail, &user.SSOIssuer, &user.SSOSubject,
 	)
 
 	if err != nil {
@@ -1994,6 +2801,13 @@ func (db *SQLiteDB) GetUserByEmail(email string) (*User, error) {
 		return nil, err
 	}
 
+	if user.Email, err = openField(user.Email); err != nil {
+		return nil, err
+	}
+	if user.PendingEmail, err = openField(user.PendingEmail); err != nil {
+		return nil, err
+	}
+
 	// 处理可空时间字段
 	if lastLoginAt.Valid {
 		lastLogin, err := time.Parse("2006-01-02 15:04:05", lastLoginAt.String)
@@ -2029,17 +2843,20 @@ func (db *SQLiteDB) GetUserByEmail(email string) (*User, error) {
 
 // GetUserByUsername 根据用户名获取用户
 func (db *SQLiteDB) GetUserByUsername(username string) (*User, error) {
-	query := `SELECT id, username, email, password, salt, role, status, traffic_limit, traffic_used, 
-              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at 
+	query := `SELECT id, COALESCE(uuid, ''), username, email, password, salt, role, status, traffic_limit, traffic_used, 
+              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at,
+              COALESCE(remark, ''), COALESCE(activity_opt_out, 0), COALESCE(email_verified, 0), COALESCE(pending_email, ''),
+              COALESCE(sso_issuer, ''), COALESCE(sso_subject, '')
               FROM users WHERE username = ?`
 
 	user := &User{}
 	var lastLoginAt, lockedUntil, expireAt, createdAt, updatedAt sql.NullString
 
 	err := db.db.QueryRow(query, username).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
+		&user.ID, &user.UUID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
 		&user.TrafficLimit, &user.TrafficUsed, &lastLoginAt, &user.LoginAttempts, &lockedUntil,
-		&user.IsAdmin, &expireAt, &createdAt, &updatedAt,
+		&user.IsAdmin, &expireAt, &createdAt, &updatedAt, &user.Remark, &user.ActivityOptOut,
+		&user.EmailVerified, &user.PendingEmail, &user.SSOIssuer, &user.SSOSubject,
 	)
 
 	if err != nil {
@@ -2049,6 +2866,13 @@ func (db *SQLiteDB) GetUserByUsername(username string) (*User, error) {
 		return nil, err
 	}
 
+	if user.Email, err = openField(user.Email); err != nil {
+		return nil, err
+	}
+	if user.PendingEmail, err = openField(user.PendingEmail); err != nil {
+		return nil, err
+	}
+
 	// 处理可空时间字段
 	if lastLoginAt.Valid {
 		lastLogin, err := time.Parse("2006-01-02 15:04:05", lastLoginAt.String)
@@ -2277,7 +3101,7 @@ func (db *SQLiteDB) ListDailyStatsByUserID(userID int64) ([]*DailyStats, error)
 }
 
 // ListTrafficHistoryByDateRange 根据日期范围获取用户的流量历史
-func (db *SQLiteDB) ListTrafficHistoryByDateRange(userID uint, startDate, endDate string, histories *[]*TrafficHistory) error {
+func (db *SQLiteDB) ListTrafficHistoryByDateRange(userID int64, startDate, endDate string, histories *[]*TrafficHistory) error {
 	query := `SELECT id, user_id, protocol, upload, download, date, created_at, updated_at 
               FROM traffic_history 
               WHERE user_id = ? AND date BETWEEN ? AND ? 
@@ -2315,8 +3139,10 @@ func (db *SQLiteDB) ListTrafficHistoryByDateRange(userID uint, startDate, endDat
 // ListUsers 分页获取用户列表
 func (db *SQLiteDB) ListUsers(page, pageSize int) ([]*User, error) {
 	offset := (page - 1) * pageSize
-	query := `SELECT id, username, email, password, salt, role, status, traffic_limit, traffic_used, 
-              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at 
+	query := `SELECT id, COALESCE(uuid, ''), username, email, password, salt, role, status, traffic_limit, traffic_used, 
+              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at,
+              COALESCE(remark, ''), COALESCE(activity_opt_out, 0), COALESCE(email_verified, 0), COALESCE(pending_email, ''),
+              COALESCE(sso_issuer, ''), COALESCE(sso_subject, '')
               FROM users ORDER BY id DESC LIMIT ? OFFSET ?`
 
 	rows, err := db.db.Query(query, pageSize, offset)
@@ -2331,14 +3157,22 @@ func (db *SQLiteDB) ListUsers(page, pageSize int) ([]*User, error) {
 		var lastLoginAt, lockedUntil, expireAt, createdAt, updatedAt sql.NullString
 
 		err := rows.Scan(
-			&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
+			&user.ID, &user.UUID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
 			&user.TrafficLimit, &user.TrafficUsed, &lastLoginAt, &user.LoginAttempts, &lockedUntil,
-			&user.IsAdmin, &expireAt, &createdAt, &updatedAt,
+			&user.IsAdmin, &expireAt, &createdAt, &updatedAt, &user.Remark, &user.ActivityOptOut,
+			&user.EmailVerified, &user.PendingEmail, &user.SSOIssuer, &user.SSOSubject,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		if user.Email, err = openField(user.Email); err != nil {
+			return nil, err
+		}
+		if user.PendingEmail, err = openField(user.PendingEmail); err != nil {
+			return nil, err
+		}
+
 		// 处理可空时间字段
 		if lastLoginAt.Valid {
 			lastLogin, err := time.Parse("2006-01-02 15:04:05", lastLoginAt.String)
@@ -2496,18 +3330,32 @@ func (db *SQLiteDB) GetCertificate(domain string) (*Certificate, error) {
 	return cert, nil
 }
 
-// SearchUsers 根据关键词搜索用户
+// SearchUsers 根据关键词搜索用户，不区分大小写匹配用户名、邮箱、备注、角色和状态，
+// 较长的关键词还会按字符顺序模糊匹配。加密保存的邮箱只能按完整地址匹配。使用 RankUsers 排序并获取高亮信息
 func (db *SQLiteDB) SearchUsers(keyword string) ([]*User, error) {
-	// 使用LIKE进行简单搜索，匹配用户名和邮箱
-	query := `SELECT id, username, email, password, salt, role, status, traffic_limit, traffic_used, 
-              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at 
+	terms := SearchTerms(keyword)
+	if len(terms) == 0 {
+		return []*User{}, nil
+	}
+
+	where, args := searchClause(terms,
+		[]string{"LOWER(role)", "LOWER(status)"},
+		[]string{"LOWER(username)", "LOWER(email)", "LOWER(COALESCE(remark, ''))"},
+	)
+	if hash := emailHash(keyword); hash != "" {
+		where = "(" + where + ") OR email_hash = ?"
+		args = append(args, hash)
+	}
+
+	query := `SELECT id, COALESCE(uuid, ''), username, email, password, salt, role, status, traffic_limit, traffic_used, 
+              last_login_at, login_attempts, locked_until, is_admin, expire_at, created_at, updated_at,
+              COALESCE(remark, ''), COALESCE(activity_opt_out, 0), COALESCE(email_verified, 0), COALESCE(pending_email, ''),
+              COALESCE(sso_issuer, ''), COALESCE(sso_subject, '')
               FROM users 
-              WHERE username LIKE ? OR email LIKE ? OR role LIKE ? OR status LIKE ?
+              WHERE ` + where + `
               ORDER BY id DESC`
 
-	// 构造模糊查询参数
-	likeParam := "%" + keyword + "%"
-	rows, err := db.db.Query(query, likeParam, likeParam, likeParam, likeParam)
+	rows, err := db.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -2519,14 +3367,22 @@ func (db *SQLiteDB) SearchUsers(keyword string) ([]*User, error) {
 		var lastLoginAt, lockedUntil, expireAt, createdAt, updatedAt sql.NullString
 
 		err := rows.Scan(
-			&user.ID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
+			&user.ID, &user.UUID, &user.Username, &user.Email, &user.Password, &user.Salt, &user.Role, &user.Status,
 			&user.TrafficLimit, &user.TrafficUsed, &lastLoginAt, &user.LoginAttempts, &lockedUntil,
-			&user.IsAdmin, &expireAt, &createdAt, &updatedAt,
+			&user.IsAdmin, &expireAt, &createdAt, &updatedAt, &user.Remark, &user.ActivityOptOut,
+			&user.EmailVerified, &user.PendingEmail, &user.SSOIssuer, &user.SSOSubject,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		if user.Email, err = openField(user.Email); err != nil {
+			return nil, err
+		}
+		if user.PendingEmail, err = openField(user.PendingEmail); err != nil {
+			return nil, err
+		}
+
 		// 处理可空时间字段
 		if lastLoginAt.Valid {
 			lastLogin, err := time.Parse("2006-01-02 15:04:05", lastLoginAt.String)
@@ -2627,17 +3483,27 @@ func (db *SQLiteDB) UpdateUser(user *User) error {
 	if user.ExpireAt != nil {
 		expireAtStr = user.ExpireAt.Format("2006-01-02 15:04:05")
 	}
+	email, err := sealField(user.Email)
+	if err != nil {
+		return err
+	}
+	pendingEmail, err := sealField(user.PendingEmail)
+	if err != nil {
+		return err
+	}
 
 	query := `UPDATE users SET
-		username = ?, email = ?, password = ?, salt = ?, role = ?, status = ?,
+		username = ?, email = ?, email_hash = ?, password = ?, salt = ?, role = ?, status = ?,
 		traffic_limit = ?, traffic_used = ?, last_login_at = ?, login_attempts = ?,
-		locked_until = ?, is_admin = ?, expire_at = ?, updated_at = ?
+		locked_until = ?, is_admin = ?, expire_at = ?, updated_at = ?, remark = ?,
+		activity_opt_out = ?, email_verified = ?, pending_email = ?
 	WHERE id = ?`
 
-	_, err := db.db.Exec(
+	_, err = db.db.Exec(
 		query,
 		user.Username,
-		user.Email,
+		email,
+		emailHash(user.Email),
 		user.Password,
 		user.Salt,
 		user.Role,
@@ -2650,6 +3516,10 @@ func (db *SQLiteDB) UpdateUser(user *User) error {
 		boolToInt(user.IsAdmin),
 		expireAtStr,
 		now,
+		user.Remark,
+		boolToInt(user.ActivityOptOut),
+		boolToInt(user.EmailVerified),
+		pendingEmail,
 		user.ID,
 	)
 
@@ -2689,3 +3559,313 @@ func (db *SQLiteDB) UpdateTrafficStats(stats *TrafficStats) error {
 
 	return err
 }
+
+// CreateProtocolVersion 创建协议版本记录。Version 为 0 时在同一条插入语句中分配下一个版本号，
+// 并发修改同一协议时不会因为先查询再插入而违反 (protocol_id, version) 唯一约束
+func (db *SQLiteDB) CreateProtocolVersion(version *ProtocolVersion) error {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	snapshot, err := sealBytes(version.Snapshot)
+	if err != nil {
+		return err
+	}
+	diff, err := sealField(version.Diff)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO protocol_versions (
+		protocol_id, version, snapshot, diff, changed_by, created_at, updated_at
+	) SELECT ?, CASE WHEN ? > 0 THEN ? ELSE COALESCE(MAX(version), 0) + 1 END, ?, ?, ?, ?, ?
+	FROM protocol_versions WHERE protocol_id = ?`
+
+	result, err := db.db.Exec(
+		query,
+		version.ProtocolID,
+		version.Version,
+		version.Version,
+		snapshot,
+		diff,
+		version.ChangedBy,
+		now,
+		now,
+		version.ProtocolID,
+	)
+	if err != nil {
+		return err
+	}
+
+	version.ID, _ = result.LastInsertId()
+	if version.Version <= 0 {
+		if err := db.db.QueryRow(`SELECT version FROM protocol_versions WHERE id = ?`, version.ID).Scan(&version.Version); err != nil {
+			return err
+		}
+	}
+	version.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", now)
+	version.UpdatedAt = version.CreatedAt
+	return nil
+}
+
+// GetProtocolVersion 获取协议的指定版本
+func (db *SQLiteDB) GetProtocolVersion(protocolID int64, version int) (*ProtocolVersion, error) {
+	query := `SELECT id, protocol_id, version, snapshot, diff, changed_by, created_at, updated_at
+		FROM protocol_versions WHERE protocol_id = ? AND version = ?`
+
+	v := &ProtocolVersion{}
+	var createdAt, updatedAt string
+	err := db.db.QueryRow(query, protocolID, version).Scan(
+		&v.ID, &v.ProtocolID, &v.Version, &v.Snapshot, &v.Diff, &v.ChangedBy,
+		&createdAt, &updatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := openProtocolVersion(v); err != nil {
+		return nil, err
+	}
+
+	v.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	v.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	return v, nil
+}
+
+// ListProtocolVersions 获取协议的版本历史，按版本号降序
+func (db *SQLiteDB) ListProtocolVersions(protocolID int64) ([]*ProtocolVersion, error) {
+	query := `SELECT id, protocol_id, version, snapshot, diff, changed_by, created_at, updated_at
+		FROM protocol_versions WHERE protocol_id = ? ORDER BY version DESC`
+
+	rows, err := db.db.Query(query, protocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*ProtocolVersion
+	for rows.Next() {
+		v := &ProtocolVersion{}
+		var createdAt, updatedAt string
+		if err := rows.Scan(
+			&v.ID, &v.ProtocolID, &v.Version, &v.Snapshot, &v.Diff, &v.ChangedBy,
+			&createdAt, &updatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := openProtocolVersion(v); err != nil {
+			return nil, err
+		}
+
+		v.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		v.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// DeleteProtocolCascade 在一个事务中删除协议及其统计和版本历史，archive 为 true 时先将统计数据归档
+func (db *SQLiteDB) DeleteProtocolCascade(id int64, archive bool) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	var statements []string
+	if archive {
+		statements = append(statements,
+			`INSERT OR REPLACE INTO protocol_stats_archive (id, protocol_id, user_id, upload, download, last_active, archived_at)
+			SELECT id, protocol_id, user_id, upload, download, last_active, ? FROM protocol_stats WHERE protocol_id = ?`,
+			`INSERT OR REPLACE INTO traffic_stats_archive (id, user_id, proxy_id, upload, download, total, archived_at)
+			SELECT id, user_id, proxy_id, upload, download, total, ? FROM traffic_stats WHERE proxy_id = ?`,
+		)
+	}
+	for _, query := range statements {
+		if _, err := tx.Exec(query, now, id); err != nil {
+			return fmt.Errorf("failed to archive protocol stats: %v", err)
+		}
+	}
+
+	for _, query := range []string{
+		`DELETE FROM protocol_stats WHERE protocol_id = ?`,
+		`DELETE FROM traffic_stats WHERE proxy_id = ?`,
+		`DELETE FROM protocol_versions WHERE protocol_id = ?`,
+		`DELETE FROM protocol_schedules WHERE protocol_id = ?`,
+		`DELETE FROM protocols WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return fmt.Errorf("failed to delete protocol data: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// tagList 以逗号分隔存储的标签列表
+type tagList []string
+
+// Scan implements sql.Scanner
+func (t *tagList) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	case nil:
+		*t = nil
+		return nil
+	default:
+		return fmt.Errorf("unsupported tags type %T", src)
+	}
+
+	*t = nil
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			*t = append(*t, tag)
+		}
+	}
+	return nil
+}
+
+// String 返回存储格式
+func (t tagList) String() string {
+	return strings.Join(t, ",")
+}
+
+// EncryptionResult 加密已有记录的结果
+type EncryptionResult struct {
+	Users     int `json:"users"`
+	Protocols int `json:"protocols"`
+	Versions  int `json:"versions"`
+}
+
+// EncryptSensitiveColumns encrypts plaintext user emails, protocol settings and protocol
+// version snapshots written before encryption was enabled, and fills in email_hash.
+// Already encrypted rows are skipped, so it is safe to run repeatedly.
+func (db *SQLiteDB) EncryptSensitiveColumns() (*EncryptionResult, error) {
+	c := currentFieldCipher()
+	if c == nil {
+		return nil, fmt.Errorf("field cipher not configured")
+	}
+
+	type pending struct {
+		id     int64
+		values []interface{}
+	}
+	collect := func(query string, build func(rows *sql.Rows) (*pending, error)) ([]*pending, error) {
+		rows, err := db.db.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var list []*pending
+		for rows.Next() {
+			p, err := build(rows)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				list = append(list, p)
+			}
+		}
+		return list, rows.Err()
+	}
+
+	users, err := collect(`SELECT id, COALESCE(email, ''), COALESCE(email_hash, '') FROM users`, func(rows *sql.Rows) (*pending, error) {
+		var id int64
+		var email, hash string
+		if err := rows.Scan(&id, &email, &hash); err != nil {
+			return nil, err
+		}
+		plain, err := openField(email)
+		if err != nil {
+			return nil, err
+		}
+		if plain == "" || (c.IsEncrypted(email) && hash == emailHash(plain)) {
+			return nil, nil
+		}
+		sealed, err := sealField(email)
+		if err != nil {
+			return nil, err
+		}
+		return &pending{id: id, values: []interface{}{sealed, emailHash(plain)}}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %v", err)
+	}
+
+	protocols, err := collect(`SELECT id, COALESCE(settings, '') FROM protocols`, func(rows *sql.Rows) (*pending, error) {
+		var id int64
+		var settings string
+		if err := rows.Scan(&id, &settings); err != nil {
+			return nil, err
+		}
+		if settings == "" || c.IsEncrypted(settings) {
+			return nil, nil
+		}
+		sealed, err := sealField(settings)
+		if err != nil {
+			return nil, err
+		}
+		return &pending{id: id, values: []interface{}{[]byte(sealed)}}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protocols: %v", err)
+	}
+
+	versions, err := collect(`SELECT id, COALESCE(snapshot, ''), COALESCE(diff, '') FROM protocol_versions`, func(rows *sql.Rows) (*pending, error) {
+		var id int64
+		var snapshot, diff string
+		if err := rows.Scan(&id, &snapshot, &diff); err != nil {
+			return nil, err
+		}
+		if (snapshot == "" || c.IsEncrypted(snapshot)) && (diff == "" || c.IsEncrypted(diff)) {
+			return nil, nil
+		}
+		sealedSnapshot, err := sealField(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		sealedDiff, err := sealField(diff)
+		if err != nil {
+			return nil, err
+		}
+		return &pending{id: id, values: []interface{}{[]byte(sealedSnapshot), sealedDiff}}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protocol versions: %v", err)
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, step := range []struct {
+		query string
+		rows  []*pending
+	}{
+		{`UPDATE users SET email = ?, email_hash = ? WHERE id = ?`, users},
+		{`UPDATE protocols SET settings = ? WHERE id = ?`, protocols},
+		{`UPDATE protocol_versions SET snapshot = ?, diff = ? WHERE id = ?`, versions},
+	} {
+		for _, p := range step.rows {
+			if _, err := tx.Exec(step.query, append(p.values, p.id)...); err != nil {
+				return nil, fmt.Errorf("failed to encrypt row %d: %v", p.id, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &EncryptionResult{
+		Users:     len(users),
+		Protocols: len(protocols),
+		Versions:  len(versions),
+	}, nil
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StreamEvent 持久化的实时事件，自增 ID 作为长轮询的游标
+type StreamEvent struct {
+	ID        int64           `json:"id" db:"id"`
+	Type      string          `json:"type" db:"type"`
+	Data      json.RawMessage `json:"data" db:"data"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
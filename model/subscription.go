@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Subscription 用户订阅，ProfileVersion 在节点地址或凭据变化时递增，客户端据此判断是否需要重新拉取
+type Subscription struct {
+	Base
+	UserID          int64      `json:"user_id" db:"user_id"`
+	Token           string     `json:"token" db:"token"`
+	WebhookURL      string     `json:"webhook_url" db:"webhook_url"`           // 客户端注册的更新通知地址
+	WebhookSecret   string     `json:"-" db:"webhook_secret"`                  // 通知请求的 HMAC-SHA256 签名密钥
+	ProfileVersion  int64      `json:"profile_version" db:"profile_version"`   // 配置版本号
+	LastFetchedAt   *time.Time `json:"last_fetched_at" db:"last_fetched_at"`   // 客户端最近一次拉取订阅的时间
+	LastNotifiedAt  *time.Time `json:"last_notified_at" db:"last_notified_at"` // 最近一次成功推送通知的时间
+	LastNotifyError string     `json:"last_notify_error,omitempty" db:"last_notify_error"`
+}
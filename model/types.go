@@ -11,52 +11,119 @@ const (
 	ProtocolDokodemo    ProtocolType = "dokodemo-door"
 	ProtocolSocks       ProtocolType = "socks"
 	ProtocolHTTP        ProtocolType = "http"
+	ProtocolRelay       ProtocolType = "relay"
 )
 
 // VMessSettings VMess 协议配置
 type VMessSettings struct {
-	UUID          string `json:"uuid"`
-	AlterID       int    `json:"alterId"`
-	Security      string `json:"security"`
-	Network       string `json:"network"`
-	Host          string `json:"host"`
-	Path          string `json:"path"`
-	TLS           bool   `json:"tls"`
-	AllowInsecure bool   `json:"allowInsecure"`
+	UUID          string           `json:"uuid"`
+	AlterID       int              `json:"alterId"`
+	Security      string           `json:"security"`
+	Network       string           `json:"network"`
+	Host          string           `json:"host"`
+	Path          string           `json:"path"`
+	TLS           bool             `json:"tls"`
+	AllowInsecure bool             `json:"allowInsecure"`
+	CertFile      string           `json:"certFile,omitempty"`    // TLS 证书路径
+	KeyFile       string           `json:"keyFile,omitempty"`     // TLS 私钥路径，必须为 0600
+	CDN           bool             `json:"cdn,omitempty"`         // 通过 CDN（如 Cloudflare）中转
+	CDNAddress    string           `json:"cdnAddress,omitempty"`  // 客户端连接的 CDN 优选地址，为空时使用 Host
+	SNI           string           `json:"sni,omitempty"`         // TLS 证书域名，为空时使用 Host
+	Fingerprint   string           `json:"fingerprint,omitempty"` // 客户端 uTLS 指纹，如 chrome、firefox、safari、random，为空时使用 chrome
+	ALPN          []string         `json:"alpn,omitempty"`        // TLS ALPN 列表，如 ["h2", "http/1.1"]，为空时使用 Xray 默认值
+	QUIC          *QUICSettings    `json:"quic,omitempty"`        // network 为 quic 时的 QUIC 传输配置（实验性）
+	Sockopt       *SockoptSettings `json:"sockopt,omitempty"`     // 入站连接的 socket 调优选项
 }
 
 // VLESSSettings VLESS 协议配置
 type VLESSSettings struct {
-	UUID          string `json:"uuid"`
-	Flow          string `json:"flow"`
-	Network       string `json:"network"`
-	Host          string `json:"host"`
-	Path          string `json:"path"`
-	TLS           bool   `json:"tls"`
-	AllowInsecure bool   `json:"allowInsecure"`
+	UUID          string           `json:"uuid"`
+	Flow          string           `json:"flow"`
+	Network       string           `json:"network"`
+	Host          string           `json:"host"`
+	Path          string           `json:"path"`
+	TLS           bool             `json:"tls"`
+	AllowInsecure bool             `json:"allowInsecure"`
+	CertFile      string           `json:"certFile,omitempty"`    // TLS 证书路径
+	KeyFile       string           `json:"keyFile,omitempty"`     // TLS 私钥路径，必须为 0600
+	CDN           bool             `json:"cdn,omitempty"`         // 通过 CDN（如 Cloudflare）中转
+	CDNAddress    string           `json:"cdnAddress,omitempty"`  // 客户端连接的 CDN 优选地址，为空时使用 Host
+	Fallbacks     []Fallback       `json:"fallbacks,omitempty"`   // 非代理流量的回落目标，仅 TCP+TLS 时生效
+	Reality       *RealitySettings `json:"reality,omitempty"`     // 使用 REALITY 代替 TLS，设置后忽略 TLS 和证书配置
+	SNI           string           `json:"sni,omitempty"`         // TLS 证书域名，为空时使用 Host
+	Fingerprint   string           `json:"fingerprint,omitempty"` // 客户端 uTLS 指纹，如 chrome、firefox、safari、random，为空时使用 chrome
+	ALPN          []string         `json:"alpn,omitempty"`        // TLS ALPN 列表，如 ["h2", "http/1.1"]，为空时使用 Xray 默认值
+	QUIC          *QUICSettings    `json:"quic,omitempty"`        // network 为 quic 时的 QUIC 传输配置（实验性）
+	Sockopt       *SockoptSettings `json:"sockopt,omitempty"`     // 入站连接的 socket 调优选项
 }
 
 // TrojanSettings Trojan 协议配置
 type TrojanSettings struct {
-	Password string `json:"password"`
-	Network  string `json:"network"`
-	Host     string `json:"host"`
-	Path     string `json:"path"`
-	TLS      bool   `json:"tls"`
-	SNI      string `json:"sni"`
+	Password    string           `json:"password"`
+	Network     string           `json:"network"`
+	Host        string           `json:"host"`
+	Path        string           `json:"path"`
+	TLS         bool             `json:"tls"`
+	SNI         string           `json:"sni"`
+	CertFile    string           `json:"certFile,omitempty"`    // TLS 证书路径
+	KeyFile     string           `json:"keyFile,omitempty"`     // TLS 私钥路径，必须为 0600
+	CDN         bool             `json:"cdn,omitempty"`         // 通过 CDN（如 Cloudflare）中转
+	CDNAddress  string           `json:"cdnAddress,omitempty"`  // 客户端连接的 CDN 优选地址，为空时使用 Host
+	Fallbacks   []Fallback       `json:"fallbacks,omitempty"`   // 非代理流量的回落目标，仅 TCP 传输时生效
+	Fingerprint string           `json:"fingerprint,omitempty"` // 客户端 uTLS 指纹，如 chrome、firefox、safari、random，为空时使用 chrome
+	ALPN        []string         `json:"alpn,omitempty"`        // TLS ALPN 列表，如 ["h2", "http/1.1"]，为空时使用 Xray 默认值
+	QUIC        *QUICSettings    `json:"quic,omitempty"`        // network 为 quic 时的 QUIC 传输配置（实验性）
+	Sockopt     *SockoptSettings `json:"sockopt,omitempty"`     // 入站连接的 socket 调优选项
+}
+
+// QUICSettings QUIC 传输配置，QUIC 基于 UDP 且必须启用 TLS
+type QUICSettings struct {
+	Security   string `json:"security,omitempty"`   // 数据包加密：none、aes-128-gcm、chacha20-poly1305，为空时为 none
+	Key        string `json:"key,omitempty"`        // 加密密钥，security 不为 none 时必填
+	HeaderType string `json:"headerType,omitempty"` // 数据包伪装：none、srtp、utp、wechat-video、dtls、wireguard，为空时为 none
+}
+
+// SockoptSettings 入站的 socket 调优选项，对应 Xray streamSettings.sockopt，零值使用系统默认值。
+// tcpFastOpen 和保活选项各平台都支持，其余选项只在 Linux 上生效
+type SockoptSettings struct {
+	TCPFastOpen          bool   `json:"tcpFastOpen,omitempty"`          // 启用 TCP Fast Open
+	TCPKeepAliveInterval int    `json:"tcpKeepAliveInterval,omitempty"` // TCP 保活探测间隔（秒）
+	TCPKeepAliveIdle     int    `json:"tcpKeepAliveIdle,omitempty"`     // 连接空闲多久后开始保活探测（秒）
+	TCPUserTimeout       int    `json:"tcpUserTimeout,omitempty"`       // 已发送的数据多久未被确认时断开连接（毫秒）
+	TCPMaxSeg            int    `json:"tcpMaxSeg,omitempty"`            // TCP 最大分段大小（MSS），隧道、PPPoE 等 MTU 较小的线路可调低
+	TCPCongestion        string `json:"tcpCongestion,omitempty"`        // 拥塞控制算法：bbr、cubic、reno
+	TCPMptcp             bool   `json:"tcpMptcp,omitempty"`             // 启用 Multipath TCP，需要内核支持
+	Mark                 int    `json:"mark,omitempty"`                 // 连接的 SO_MARK，用于策略路由
+}
+
+// Fallback 回落目标，与 Xray 入站 fallbacks 的格式相同
+type Fallback struct {
+	Dest string `json:"dest"`           // 回落地址，如 80 或 127.0.0.1:8080
+	Path string `json:"path,omitempty"` // 按 HTTP 路径匹配，必须以 / 开头
+	Alpn string `json:"alpn,omitempty"` // 按 ALPN 匹配，如 h2
+	Xver int    `json:"xver,omitempty"` // PROXY protocol 版本，0 不发送
+}
+
+// RealitySettings VLESS 入站的 REALITY 配置，握手转发给 Dest 指向的真实网站
+type RealitySettings struct {
+	Dest        string   `json:"dest"`        // 目标网站地址，如 www.example.com:443，必须支持 TLS 1.3
+	ServerNames []string `json:"serverNames"` // 客户端可用的 SNI
+	PrivateKey  string   `json:"privateKey"`
+	ShortIDs    []string `json:"shortIds"`
 }
 
 // ShadowsocksSettings Shadowsocks 协议配置
 type ShadowsocksSettings struct {
-	Method        string `json:"method"`
-	Password      string `json:"password"`
-	Network       string `json:"network"`
-	Host          string `json:"host"`
-	Port          int    `json:"port"`
-	Path          string `json:"path"`
-	Plugin        string `json:"plugin,omitempty"`
-	PluginOpts    string `json:"plugin_opts,omitempty"`
-	AllowInsecure bool   `json:"allow_insecure"`
+	Method        string           `json:"method"`
+	Password      string           `json:"password"`
+	Network       string           `json:"network"`
+	Host          string           `json:"host"`
+	Port          int              `json:"port"`
+	Path          string           `json:"path"`
+	Plugin        string           `json:"plugin,omitempty"`
+	PluginOpts    string           `json:"plugin_opts,omitempty"`
+	AllowInsecure bool             `json:"allow_insecure"`
+	Sockopt       *SockoptSettings `json:"sockopt,omitempty"` // 入站连接的 socket 调优选项
 }
 
 // DokodemoSettings Dokodemo-door 协议配置
@@ -68,6 +135,16 @@ type DokodemoSettings struct {
 	FollowRedirect bool   `json:"follow_redirect"`
 }
 
+// RelaySettings 端口中转配置，将本机端口收到的流量原样转发到另一节点的入站
+type RelaySettings struct {
+	TargetHost     string           `json:"target_host"`
+	TargetPort     int              `json:"target_port"`
+	Network        string           `json:"network"`           // tcp、udp 或 tcp,udp
+	TLSPassthrough bool             `json:"tls_passthrough"`   // 不解密 TLS，只读取 SNI 用于路由和日志
+	Timeout        int              `json:"timeout"`           // 空闲超时（秒），0 使用 Xray 默认值
+	Sockopt        *SockoptSettings `json:"sockopt,omitempty"` // 入站连接的 socket 调优选项
+}
+
 // SocksSettings Socks 协议配置
 type SocksSettings struct {
 	Auth          string `json:"auth"`
@@ -2,12 +2,16 @@ package monitor
 
 import (
 	"fmt"
+	"html"
+	"strings"
+	"sync"
 	"time"
 
 	"v/logger"
 	"v/model"
 	"v/notification"
 	"v/settings"
+	"v/utils"
 )
 
 // AlertType 告警类型
@@ -20,26 +24,94 @@ const (
 	AlertMemoryUsage AlertType = "memory_usage"
 	// AlertDiskUsage 磁盘使用率告警
 	AlertDiskUsage AlertType = "disk_usage"
+	// AlertDiskSpace 磁盘可用空间不足告警
+	AlertDiskSpace AlertType = "disk_space"
 	// AlertTrafficUsage 流量使用率告警
 	AlertTrafficUsage AlertType = "traffic_usage"
+	// AlertClockSkew 时钟偏差告警
+	AlertClockSkew AlertType = "clock_skew"
+	// AlertPortConflict 入站端口被占用告警
+	AlertPortConflict AlertType = "port_conflict"
+	// AlertNodeLink 节点间链路劣化告警
+	AlertNodeLink AlertType = "node_link"
+	// AlertXrayCrash Xray 进程异常退出告警
+	AlertXrayCrash AlertType = "xray_crash"
+	// AlertConnLimit 入站并发连接数达到上限告警
+	AlertConnLimit AlertType = "conn_limit"
+	// AlertBandwidthBudget 节点月流量预算告警
+	AlertBandwidthBudget AlertType = "bandwidth_budget"
 )
 
 // Alert 告警信息
 type Alert struct {
-	Type      AlertType
-	Value     float64
-	Threshold float64
-	Message   string
-	Timestamp time.Time
+	Type      AlertType `json:"type"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	Recovered bool      `json:"recovered"` // 告警恢复事件
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// recentAlertLimit 内存中保留的最近告警数量
+const recentAlertLimit = 50
+
+// alertTransition 告警状态变化
+type alertTransition int
+
+const (
+	transitionNone alertTransition = iota
+	transitionTriggered
+	transitionRecovered
+)
+
+// defaultClearMargin 未配置恢复阈值时，恢复阈值与触发阈值的差值
+const defaultClearMargin = 5.0
+
+// alertState 单个指标的告警状态
+type alertState struct {
+	active       bool
+	pendingSince time.Time
+	triggeredAt  time.Time
+}
+
+// evaluate 根据触发阈值、恢复阈值和最短持续时间更新告警状态
+func (st *alertState) evaluate(value, trigger, clear float64, minDuration time.Duration, now time.Time) alertTransition {
+	if st.active {
+		if value <= clear {
+			st.active = false
+			st.pendingSince = time.Time{}
+			return transitionRecovered
+		}
+		return transitionNone
+	}
+
+	if value < trigger {
+		st.pendingSince = time.Time{}
+		return transitionNone
+	}
+
+	if st.pendingSince.IsZero() {
+		st.pendingSince = now
+	}
+	if now.Sub(st.pendingSince) < minDuration {
+		return transitionNone
+	}
+
+	st.active = true
+	st.triggeredAt = now
+	return transitionTriggered
 }
 
 // AlertManager 告警管理器
 type AlertManager struct {
+	mu        sync.Mutex
 	log       *logger.Logger
 	settings  *settings.Manager
 	notifier  notification.Notifier
 	lastAlert map[AlertType]time.Time
+	states    map[AlertType]*alertState
 	db        model.DB
+	recent    []*Alert // 最近发送的告警和恢复事件，按时间先后排列
 }
 
 // NewAlertManager 创建告警管理器
@@ -49,49 +121,236 @@ func NewAlertManager(log *logger.Logger, settings *settings.Manager, notifier no
 		settings:  settings,
 		notifier:  notifier,
 		lastAlert: make(map[AlertType]time.Time),
+		states:    make(map[AlertType]*alertState),
 		db:        db,
 	}
 }
 
 // CheckSystemStats 检查系统状态是否触发告警
 func (m *AlertManager) CheckSystemStats(stats *model.SystemStats) error {
+	m.mu.Lock()
 	s := m.settings.Get()
 
-	// 检查CPU使用率
-	if s.Monitor.EnableCPUAlert && stats.CPUUsage >= s.Monitor.CPUThreshold {
-		if err := m.sendAlert(AlertCPUUsage, stats.CPUUsage, s.Monitor.CPUThreshold,
-			fmt.Sprintf("CPU使用率过高: %.2f%%", stats.CPUUsage)); err != nil {
-			m.log.Error("Failed to send CPU usage alert", logger.Fields{
-				"error": err.Error(),
-			})
-		}
+	pending := []*pendingAlert{
+		m.checkMetric(AlertCPUUsage, s.Monitor.EnableCPUAlert, stats.CPUUsage,
+			s.Monitor.CPUThreshold, s.Monitor.CPUClearThreshold, "CPU使用率"),
+		m.checkMetric(AlertMemoryUsage, s.Monitor.EnableMemoryAlert, stats.MemoryUsage,
+			s.Monitor.MemoryThreshold, s.Monitor.MemoryClearThreshold, "内存使用率"),
+		m.checkMetric(AlertDiskUsage, s.Monitor.EnableDiskAlert, stats.DiskUsage,
+			s.Monitor.DiskThreshold, s.Monitor.DiskClearThreshold, "磁盘使用率"),
 	}
 
-	// 检查内存使用率
-	if s.Monitor.EnableMemoryAlert && stats.MemoryUsage >= s.Monitor.MemoryThreshold {
-		if err := m.sendAlert(AlertMemoryUsage, stats.MemoryUsage, s.Monitor.MemoryThreshold,
-			fmt.Sprintf("内存使用率过高: %.2f%%", stats.MemoryUsage)); err != nil {
-			m.log.Error("Failed to send memory usage alert", logger.Fields{
-				"error": err.Error(),
-			})
+	// 检查可用空间是否低于保留下限
+	if minFree := utils.MinFreeDiskBytes(s.Monitor.MinFreeDiskMB); minFree > 0 && stats.DiskTotal > 0 && stats.DiskFree < minFree {
+		pending = append(pending, m.prepareAlert(AlertDiskSpace, float64(stats.DiskFree)/1024/1024, float64(minFree)/1024/1024,
+			fmt.Sprintf("磁盘可用空间不足: 剩余 %s，最低要求 %s", utils.FormatBytes(stats.DiskFree), utils.FormatBytes(minFree))))
+	}
+	m.mu.Unlock()
+
+	m.deliver(pending...)
+	return nil
+}
+
+// CheckClockSkew 检查时钟偏差是否超过阈值，偏差回落到阈值一半以下时发送恢复通知
+func (m *AlertManager) CheckClockSkew(offset *utils.ClockOffset) {
+	m.mu.Lock()
+	pending := m.checkClockSkew(offset)
+	m.mu.Unlock()
+
+	m.deliver(pending)
+}
+
+// checkClockSkew 更新时钟偏差告警状态并返回需要发送的通知，调用方必须持有 m.mu
+func (m *AlertManager) checkClockSkew(offset *utils.ClockOffset) *pendingAlert {
+	threshold := ClockSkewThreshold(m.settings.Get().Monitor.ClockSkewThreshold)
+	st, ok := m.states[AlertClockSkew]
+	if !ok {
+		st = &alertState{}
+		m.states[AlertClockSkew] = st
+	}
+	if threshold <= 0 || offset == nil {
+		*st = alertState{}
+		return nil
+	}
+
+	skew := offset.Skew().Seconds()
+	trigger := threshold.Seconds()
+	clear := trigger / 2
+
+	// 时钟偏差不会自行抖动，无需等待持续时间
+	switch st.evaluate(skew, trigger, clear, 0, time.Now()) {
+	case transitionTriggered:
+		delete(m.lastAlert, AlertClockSkew)
+		fallthrough
+	case transitionNone:
+		if !st.active {
+			return nil
 		}
+		return m.prepareAlert(AlertClockSkew, skew, trigger,
+			fmt.Sprintf("系统时钟与 %s 偏差 %s，VMess 和两步验证可能失败，请检查时间同步", offset.Server, offset.Offset.Round(time.Millisecond)))
+	case transitionRecovered:
+		return m.prepareRecovery(AlertClockSkew, skew, clear, st.triggeredAt,
+			fmt.Sprintf("系统时钟偏差已恢复: %s", offset.Offset.Round(time.Millisecond)))
 	}
+	return nil
+}
 
-	// 检查磁盘使用率
-	if s.Monitor.EnableDiskAlert && stats.DiskUsage >= s.Monitor.DiskThreshold {
-		if err := m.sendAlert(AlertDiskUsage, stats.DiskUsage, s.Monitor.DiskThreshold,
-			fmt.Sprintf("磁盘使用率过高: %.2f%%", stats.DiskUsage)); err != nil {
-			m.log.Error("Failed to send disk usage alert", logger.Fields{
-				"error": err.Error(),
-			})
+// ReportPortConflicts 发送入站端口被占用告警，hints 为每个冲突端口的处理建议。
+// 每次启动失败都是独立事件，不受告警间隔限制
+func (m *AlertManager) ReportPortConflicts(hints []string) {
+	if len(hints) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	delete(m.lastAlert, AlertPortConflict)
+	pending := m.prepareAlert(AlertPortConflict, float64(len(hints)), 0,
+		"Xray 启动失败，入站端口被占用：<br>"+strings.Join(hints, "<br>"))
+	m.mu.Unlock()
+
+	m.deliver(pending)
+}
+
+// ReportXrayCrash 发送 Xray 异常退出告警，附带退出前的错误输出。
+// 受告警间隔限制，避免反复崩溃时重复通知
+func (m *AlertManager) ReportXrayCrash(exitError string, lines []string) {
+	message := "Xray 进程异常退出: " + html.EscapeString(exitError)
+	if len(lines) > 0 {
+		escaped := make([]string, len(lines))
+		for i, line := range lines {
+			escaped[i] = html.EscapeString(line)
 		}
+		message += "<br>退出前的输出：<br>" + strings.Join(escaped, "<br>")
+	}
+
+	m.mu.Lock()
+	pending := m.prepareAlert(AlertXrayCrash, 1, 0, message)
+	m.mu.Unlock()
+
+	m.deliver(pending)
+}
+
+// ReportConnLimit 发送入站并发连接数达到上限告警，受告警间隔限制
+func (m *AlertManager) ReportConnLimit(protocolID int64, name string, limit int) {
+	message := fmt.Sprintf("入站 %s（ID %d）并发连接数达到上限 %d，新连接已被拒绝", html.EscapeString(name), protocolID, limit)
+
+	m.mu.Lock()
+	pending := m.prepareAlert(AlertConnLimit, float64(limit), float64(limit), message)
+	m.mu.Unlock()
+
+	m.deliver(pending)
+}
+
+// ReportBandwidthBudget 发送节点流量预算告警，percent 为当前用量百分比。
+// 每个阈值每周期只由流量预算上报一次，不受告警间隔限制
+func (m *AlertManager) ReportBandwidthBudget(percent, threshold float64, message string) {
+	m.mu.Lock()
+	delete(m.lastAlert, AlertBandwidthBudget)
+	pending := m.prepareAlert(AlertBandwidthBudget, percent, threshold, html.EscapeString(message))
+	m.mu.Unlock()
+
+	m.deliver(pending)
+}
+
+// ReportNodeLink 发送节点间链路劣化或恢复通知，value 和 threshold 为延迟（毫秒），since 为开始劣化的时间。
+// 链路状态由延迟矩阵判断，每次状态变化都是独立事件，不受告警间隔限制
+func (m *AlertManager) ReportNodeLink(degraded bool, value, threshold float64, since time.Time, message string) {
+	m.mu.Lock()
+	delete(m.lastAlert, AlertNodeLink)
+	var pending *pendingAlert
+	if degraded {
+		pending = m.prepareAlert(AlertNodeLink, value, threshold, message)
+	} else {
+		pending = m.prepareRecovery(AlertNodeLink, value, threshold, since, message)
 	}
+	m.mu.Unlock()
 
+	m.deliver(pending)
+}
+
+// checkMetric 检查单个指标，处理告警触发、持续告警和恢复，返回需要发送的通知。调用方必须持有 m.mu
+func (m *AlertManager) checkMetric(alertType AlertType, enabled bool, value, trigger, clear float64, name string) *pendingAlert {
+	st, ok := m.states[alertType]
+	if !ok {
+		st = &alertState{}
+		m.states[alertType] = st
+	}
+
+	// 告警被关闭时清除状态
+	if !enabled {
+		*st = alertState{}
+		return nil
+	}
+
+	if clear <= 0 || clear > trigger {
+		clear = trigger - defaultClearMargin
+	}
+
+	switch st.evaluate(value, trigger, clear, m.settings.Get().Monitor.AlertMinDuration, time.Now()) {
+	case transitionTriggered:
+		// 新的告警不受告警间隔限制
+		delete(m.lastAlert, alertType)
+		fallthrough
+	case transitionNone:
+		if !st.active {
+			return nil
+		}
+		return m.prepareAlert(alertType, value, trigger, fmt.Sprintf("%s过高: %.2f%%", name, value))
+	case transitionRecovered:
+		return m.prepareRecovery(alertType, value, clear, st.triggeredAt, fmt.Sprintf("%s已恢复: %.2f%%", name, value))
+	}
 	return nil
 }
 
-// sendAlert 发送告警通知
-func (m *AlertManager) sendAlert(alertType AlertType, value, threshold float64, message string) error {
+// pendingAlert 在锁内生成、解锁后保存和发送的告警或恢复通知，
+// 数据库写入和邮件发送可能很慢，不能阻塞其他告警检查
+type pendingAlert struct {
+	alertType    AlertType
+	recovered    bool
+	record       *model.AlertRecord
+	notification *notification.Notification
+}
+
+// prepareRecovery 记录告警恢复事件并生成恢复通知，调用方必须持有 m.mu
+func (m *AlertManager) prepareRecovery(alertType AlertType, value, threshold float64, since time.Time, message string) *pendingAlert {
+	s := m.settings.Get()
+	delete(m.lastAlert, alertType)
+	m.remember(alertType, value, threshold, message, true)
+
+	m.log.WithFields("Alert recovered", logger.Fields{
+		"type":     alertType,
+		"value":    value,
+		"duration": time.Since(since).Round(time.Second),
+	})
+
+	return &pendingAlert{
+		alertType: alertType,
+		recovered: true,
+		record: &model.AlertRecord{
+			Type:      string(alertType) + "_recovered",
+			Value:     value,
+			Threshold: threshold,
+			Message:   message,
+		},
+		notification: &notification.Notification{
+			To:      []string{s.Admin.Email},
+			Subject: fmt.Sprintf("系统告警恢复: %s", alertType),
+			Body: fmt.Sprintf(`
+			<p>尊敬的管理员：</p>
+			<p>系统%s告警已恢复。</p>
+			<p>%s</p>
+			<p>当前值：%s</p>
+			<p>恢复阈值：%s</p>
+			<p>告警开始时间：%s</p>
+			<p>恢复时间：%s</p>
+		`, alertType, message, formatAlertValue(alertType, value), formatAlertValue(alertType, threshold), m.settings.FormatTime(since), m.settings.FormatTime(time.Now())),
+			Type: "system_alert_recovered",
+		},
+	}
+}
+
+// prepareAlert 检查告警间隔并生成告警通知，间隔内重复的告警返回 nil。调用方必须持有 m.mu
+func (m *AlertManager) prepareAlert(alertType AlertType, value, threshold float64, message string) *pendingAlert {
 	s := m.settings.Get()
 
 	// 检查告警间隔
@@ -103,37 +362,93 @@ func (m *AlertManager) sendAlert(alertType AlertType, value, threshold float64,
 
 	// 更新最后告警时间
 	m.lastAlert[alertType] = time.Now()
+	m.remember(alertType, value, threshold, message, false)
 
-	// 创建告警记录
-	alert := &model.AlertRecord{
-		Type:      string(alertType),
-		Value:     value,
-		Threshold: threshold,
-		Message:   message,
-	}
-
-	// 保存告警记录
-	if err := m.db.CreateAlert(alert); err != nil {
-		return fmt.Errorf("failed to save alert record: %v", err)
-	}
-
-	// 发送告警通知
-	notification := &notification.Notification{
-		To:      []string{s.Admin.Email},
-		Subject: fmt.Sprintf("系统告警: %s", alertType),
-		Body: fmt.Sprintf(`
+	return &pendingAlert{
+		alertType: alertType,
+		record: &model.AlertRecord{
+			Type:      string(alertType),
+			Value:     value,
+			Threshold: threshold,
+			Message:   message,
+		},
+		notification: &notification.Notification{
+			To:      []string{s.Admin.Email},
+			Subject: fmt.Sprintf("系统告警: %s", alertType),
+			Body: fmt.Sprintf(`
 			<p>尊敬的管理员：</p>
 			<p>系统触发了%s告警。</p>
 			<p>%s</p>
-			<p>当前值：%.2f%%</p>
-			<p>阈值：%.2f%%</p>
+			<p>当前值：%s</p>
+			<p>阈值：%s</p>
 			<p>时间：%s</p>
 			<p>请及时处理！</p>
-		`, alertType, message, value, threshold, time.Now().Format("2006-01-02 15:04:05")),
-		Type: "system_alert",
+		`, alertType, message, formatAlertValue(alertType, value), formatAlertValue(alertType, threshold), m.settings.FormatTime(time.Now())),
+			Type: "system_alert",
+		},
+	}
+}
+
+// deliver 保存告警记录并发送通知，不能在持有 m.mu 时调用
+func (m *AlertManager) deliver(pending ...*pendingAlert) {
+	for _, p := range pending {
+		if p == nil {
+			continue
+		}
+		if err := m.send(p); err != nil {
+			message := "Failed to send alert"
+			if p.recovered {
+				message = "Failed to send recovery notification"
+			}
+			m.log.ErrorWithFields(message, logger.Fields{
+				"type":  p.alertType,
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// send 保存一条告警记录并发送通知
+func (m *AlertManager) send(p *pendingAlert) error {
+	if err := m.db.CreateAlert(p.record); err != nil {
+		if p.recovered {
+			return fmt.Errorf("failed to save recovery record: %v", err)
+		}
+		return fmt.Errorf("failed to save alert record: %v", err)
+	}
+	return m.notifier.Send(p.notification)
+}
+
+// remember 记录最近的告警，超出数量时丢弃最早的
+func (m *AlertManager) remember(alertType AlertType, value, threshold float64, message string, recovered bool) {
+	m.recent = append(m.recent, &Alert{
+		Type:      alertType,
+		Value:     value,
+		Threshold: threshold,
+		Message:   message,
+		Recovered: recovered,
+		Timestamp: time.Now(),
+	})
+	if len(m.recent) > recentAlertLimit {
+		m.recent = m.recent[len(m.recent)-recentAlertLimit:]
 	}
+}
+
+// RecentAlerts 返回最近的告警和恢复事件，最新的在前，limit 不大于 0 时返回全部保留的记录
+func (m *AlertManager) RecentAlerts(limit int) []*Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return m.notifier.Send(notification)
+	n := len(m.recent)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	result := make([]*Alert, 0, n)
+	for i := len(m.recent) - 1; i >= 0 && len(result) < n; i-- {
+		a := *m.recent[i]
+		result = append(result, &a)
+	}
+	return result
 }
 
 // SendTestAlert 发送测试告警
@@ -159,3 +474,19 @@ func (m *AlertManager) SendTestAlert() error {
 
 	return nil
 }
+
+// formatAlertValue 按告警类型格式化数值
+func formatAlertValue(alertType AlertType, value float64) string {
+	switch alertType {
+	case AlertDiskSpace:
+		return fmt.Sprintf("%.0f MB", value)
+	case AlertClockSkew:
+		return fmt.Sprintf("%.3f 秒", value)
+	case AlertPortConflict:
+		return fmt.Sprintf("%.0f 个端口", value)
+	case AlertNodeLink:
+		return fmt.Sprintf("%.0f 毫秒", value)
+	default:
+		return fmt.Sprintf("%.2f%%", value)
+	}
+}
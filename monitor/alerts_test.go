@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertState_Hysteresis(t *testing.T) {
+	st := &alertState{}
+	now := time.Now()
+
+	steps := []struct {
+		value float64
+		want  alertTransition
+	}{
+		{85, transitionNone},
+		{91, transitionTriggered},
+		{89, transitionNone}, // 低于触发阈值但高于恢复阈值，保持告警
+		{92, transitionNone},
+		{84, transitionRecovered},
+		{89, transitionNone},
+		{90, transitionTriggered},
+	}
+
+	for i, step := range steps {
+		got := st.evaluate(step.value, 90, 85, 0, now.Add(time.Duration(i)*time.Minute))
+		if got != step.want {
+			t.Errorf("step %d (value %.0f): got transition %d, want %d", i, step.value, got, step.want)
+		}
+	}
+}
+
+func TestAlertState_MinDuration(t *testing.T) {
+	st := &alertState{}
+	now := time.Now()
+
+	if got := st.evaluate(95, 90, 85, 5*time.Minute, now); got != transitionNone {
+		t.Fatalf("expected no transition before min duration, got %d", got)
+	}
+	if got := st.evaluate(95, 90, 85, 5*time.Minute, now.Add(3*time.Minute)); got != transitionNone {
+		t.Fatalf("expected no transition before min duration, got %d", got)
+	}
+
+	// 指标回落后重新计时
+	if got := st.evaluate(80, 90, 85, 5*time.Minute, now.Add(4*time.Minute)); got != transitionNone {
+		t.Fatalf("expected no transition after drop, got %d", got)
+	}
+	if got := st.evaluate(95, 90, 85, 5*time.Minute, now.Add(6*time.Minute)); got != transitionNone {
+		t.Fatalf("expected pending timer to restart, got %d", got)
+	}
+	if got := st.evaluate(95, 90, 85, 5*time.Minute, now.Add(11*time.Minute)); got != transitionTriggered {
+		t.Fatalf("expected trigger after min duration, got %d", got)
+	}
+}
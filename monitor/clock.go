@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+	"v/utils"
+)
+
+const (
+	// DefaultClockSkewThreshold 未配置时的时钟偏差告警阈值，VMess 允许 120 秒，TOTP 单个窗口为 30 秒
+	DefaultClockSkewThreshold = 30 * time.Second
+	// defaultClockCheckInterval 未配置时的时钟检查间隔
+	defaultClockCheckInterval = time.Hour
+	// ntpTimeout 单个 NTP 服务器的查询超时
+	ntpTimeout = 5 * time.Second
+)
+
+// ClockSkewThreshold 返回生效的时钟偏差阈值，0 表示使用默认值，负数表示不检查
+func ClockSkewThreshold(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	if d == 0 {
+		return DefaultClockSkewThreshold
+	}
+	return d
+}
+
+// ClockStatus 最近一次时钟检查结果
+type ClockStatus struct {
+	*utils.ClockOffset
+	Threshold time.Duration `json:"threshold"`
+	Skewed    bool          `json:"skewed"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ClockMonitor 定期通过 NTP 检查本机时钟偏差
+type ClockMonitor struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	alerts   *AlertManager
+
+	mu     sync.RWMutex
+	last   *ClockStatus
+	stopCh chan struct{}
+}
+
+// NewClockMonitor 创建时钟监控，alerts 为 nil 时只记录结果不发送告警
+func NewClockMonitor(log *logger.Logger, settings *settings.Manager, alerts *AlertManager) *ClockMonitor {
+	return &ClockMonitor{
+		log:      log,
+		settings: settings,
+		alerts:   alerts,
+	}
+}
+
+// Start 启动定期检查，阈值为负数时不启动
+func (m *ClockMonitor) Start() {
+	if ClockSkewThreshold(m.settings.Get().Monitor.ClockSkewThreshold) <= 0 {
+		return
+	}
+
+	m.stopCh = make(chan struct{})
+	go m.run(m.stopCh)
+}
+
+// Stop 停止定期检查
+func (m *ClockMonitor) Stop() {
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
+}
+
+// run 检查循环，间隔每轮从设置中读取
+func (m *ClockMonitor) run(stopCh chan struct{}) {
+	for {
+		m.Check()
+
+		interval := m.settings.Get().Monitor.ClockCheckInterval
+		if interval <= 0 {
+			interval = defaultClockCheckInterval
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Check 立即执行一次检查并返回结果
+func (m *ClockMonitor) Check() *ClockStatus {
+	s := m.settings.Get()
+	status := &ClockStatus{
+		Threshold: ClockSkewThreshold(s.Monitor.ClockSkewThreshold),
+	}
+
+	offset, err := utils.CheckClockSkew(s.Monitor.NTPServers, ntpTimeout)
+	if err != nil {
+		status.Error = err.Error()
+		m.log.WarnWithFields("Failed to check clock skew", logger.Fields{
+			"error": err.Error(),
+		})
+	} else {
+		status.ClockOffset = offset
+		status.Skewed = status.Threshold > 0 && offset.Skew() > status.Threshold
+		if status.Skewed {
+			m.log.WarnWithFields("System clock is skewed", logger.Fields{
+				"server": offset.Server,
+				"offset": offset.Offset.String(),
+			})
+		}
+		if m.alerts != nil {
+			m.alerts.CheckClockSkew(offset)
+		}
+	}
+
+	m.mu.Lock()
+	m.last = status
+	m.mu.Unlock()
+	return status
+}
+
+// Last 返回最近一次检查结果，尚未检查时返回 nil
+func (m *ClockMonitor) Last() *ClockStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.last
+}
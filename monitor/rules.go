@@ -0,0 +1,194 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"v/settings"
+	"v/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// AlertRuleGroup 导出的 Prometheus 规则组名
+	AlertRuleGroup = "v-panel"
+	// AlertRuleSource 导出规则的 source 标签值
+	AlertRuleSource = "v-panel"
+)
+
+// 导出规则的格式
+const (
+	// RuleFormatPrometheus Prometheus rule_files 规则文件
+	RuleFormatPrometheus = "prometheus"
+	// RuleFormatKubernetes prometheus-operator 的 PrometheusRule 资源
+	RuleFormatKubernetes = "kubernetes"
+)
+
+// PrometheusRule 单条 Prometheus 告警规则
+type PrometheusRule struct {
+	Alert       string            `yaml:"alert" json:"alert"`
+	Expr        string            `yaml:"expr" json:"expr"`
+	For         string            `yaml:"for,omitempty" json:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+}
+
+// PrometheusRuleGroup Prometheus 规则组
+type PrometheusRuleGroup struct {
+	Name     string            `yaml:"name" json:"name"`
+	Interval string            `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Rules    []*PrometheusRule `yaml:"rules" json:"rules"`
+}
+
+// prometheusRuleFile Prometheus 规则文件
+type prometheusRuleFile struct {
+	Groups []*PrometheusRuleGroup `yaml:"groups"`
+}
+
+// prometheusRuleResource prometheus-operator 的 PrometheusRule 资源
+type prometheusRuleResource struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name   string            `yaml:"name"`
+		Labels map[string]string `yaml:"labels,omitempty"`
+	} `yaml:"metadata"`
+	Spec prometheusRuleFile `yaml:"spec"`
+}
+
+// BuildAlertRules 将面板的告警设置转换为基于 node_exporter 指标的 Prometheus 告警规则，
+// 只包含已启用的告警。selector 为附加到指标上的标签匹配，如 job="node",instance="1.2.3.4:9100"。
+// 流量和端口冲突告警依赖面板内部状态，没有对应的通用指标，不会导出
+func BuildAlertRules(s settings.MonitorSettings, selector string) *PrometheusRuleGroup {
+	group := &PrometheusRuleGroup{
+		Name:  AlertRuleGroup,
+		Rules: []*PrometheusRule{},
+	}
+	if s.Interval > 0 {
+		group.Interval = s.Interval.String()
+	}
+
+	selector = strings.Trim(strings.TrimSpace(selector), "{},")
+	match := func(matchers ...string) string {
+		if selector != "" {
+			matchers = append(matchers, selector)
+		}
+		return "{" + strings.Join(matchers, ",") + "}"
+	}
+	forDuration := ""
+	if s.AlertMinDuration > 0 {
+		forDuration = s.AlertMinDuration.String()
+	}
+	rootfs := `mountpoint="/",fstype!~"tmpfs|overlay"`
+
+	if s.EnableCPUAlert {
+		group.Rules = append(group.Rules, usageRule(AlertCPUUsage, "CPU使用率",
+			fmt.Sprintf(`100 - avg by (instance) (rate(node_cpu_seconds_total%s[5m])) * 100`, match(`mode="idle"`)),
+			s.CPUThreshold, s.CPUClearThreshold, forDuration))
+	}
+	if s.EnableMemoryAlert {
+		group.Rules = append(group.Rules, usageRule(AlertMemoryUsage, "内存使用率",
+			fmt.Sprintf(`(1 - node_memory_MemAvailable_bytes%s / node_memory_MemTotal_bytes%s) * 100`, match(), match()),
+			s.MemoryThreshold, s.MemoryClearThreshold, forDuration))
+	}
+	if s.EnableDiskAlert {
+		group.Rules = append(group.Rules, usageRule(AlertDiskUsage, "磁盘使用率",
+			fmt.Sprintf(`(1 - node_filesystem_avail_bytes%s / node_filesystem_size_bytes%s) * 100`, match(rootfs), match(rootfs)),
+			s.DiskThreshold, s.DiskClearThreshold, forDuration))
+	}
+	if minFree := utils.MinFreeDiskBytes(s.MinFreeDiskMB); minFree > 0 {
+		group.Rules = append(group.Rules, &PrometheusRule{
+			Alert:  alertRuleName(AlertDiskSpace),
+			Expr:   fmt.Sprintf(`node_filesystem_avail_bytes%s < %d`, match(rootfs), minFree),
+			For:    forDuration,
+			Labels: alertRuleLabels(AlertDiskSpace),
+			Annotations: map[string]string{
+				"summary":     "磁盘可用空间不足",
+				"description": fmt.Sprintf("磁盘剩余 {{ $value | humanize1024 }}B，最低要求 %s", utils.FormatBytes(minFree)),
+			},
+		})
+	}
+	if threshold := ClockSkewThreshold(s.ClockSkewThreshold); threshold > 0 {
+		group.Rules = append(group.Rules, &PrometheusRule{
+			Alert:  alertRuleName(AlertClockSkew),
+			Expr:   fmt.Sprintf(`abs(node_timex_offset_seconds%s) > %g`, match(), threshold.Seconds()),
+			Labels: alertRuleLabels(AlertClockSkew),
+			Annotations: map[string]string{
+				"summary":     "系统时钟偏差过大",
+				"description": "系统时钟偏差 {{ $value | humanizeDuration }}，VMess 和两步验证可能失败，请检查时间同步",
+			},
+		})
+	}
+
+	return group
+}
+
+// RenderAlertRules 按格式输出告警规则的 YAML
+func RenderAlertRules(group *PrometheusRuleGroup, format string) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case "", RuleFormatPrometheus:
+		doc = &prometheusRuleFile{Groups: []*PrometheusRuleGroup{group}}
+	case RuleFormatKubernetes:
+		resource := &prometheusRuleResource{
+			APIVersion: "monitoring.coreos.com/v1",
+			Kind:       "PrometheusRule",
+			Spec:       prometheusRuleFile{Groups: []*PrometheusRuleGroup{group}},
+		}
+		resource.Metadata.Name = AlertRuleGroup + "-alerts"
+		resource.Metadata.Labels = map[string]string{"app.kubernetes.io/name": AlertRuleSource}
+		doc = resource
+	default:
+		return nil, fmt.Errorf("unsupported rule format %q", format)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal alert rules: %v", err)
+	}
+	enc.Close()
+	return buf.Bytes(), nil
+}
+
+// usageRule 生成使用率告警规则，恢复阈值写入注解供参考，Prometheus 规则本身没有回差
+func usageRule(alertType AlertType, name, expr string, trigger, clear float64, forDuration string) *PrometheusRule {
+	if clear <= 0 || clear > trigger {
+		clear = trigger - defaultClearMargin
+	}
+	return &PrometheusRule{
+		Alert:  alertRuleName(alertType),
+		Expr:   fmt.Sprintf("%s > %g", expr, trigger),
+		For:    forDuration,
+		Labels: alertRuleLabels(alertType),
+		Annotations: map[string]string{
+			"summary":         name + "过高",
+			"description":     name + `过高: {{ $value | printf "%.2f" }}%`,
+			"clear_threshold": fmt.Sprintf("%g", clear),
+		},
+	}
+}
+
+// alertRuleName 将告警类型转换为 Prometheus 告警名，如 cpu_usage 转为 VPanelCpuUsage
+func alertRuleName(alertType AlertType) string {
+	var b strings.Builder
+	b.WriteString("VPanel")
+	for _, part := range strings.Split(string(alertType), "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// alertRuleLabels 导出规则的标签
+func alertRuleLabels(alertType AlertType) map[string]string {
+	return map[string]string{
+		"severity":   "warning",
+		"source":     AlertRuleSource,
+		"alert_type": string(alertType),
+	}
+}
@@ -3,7 +3,10 @@ package monitor
 import (
 	"runtime"
 	"time"
+
+	"v/logger"
 	"v/model"
+	"v/settings"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
@@ -11,9 +14,13 @@ import (
 	"github.com/shirou/gopsutil/v3/net"
 )
 
+// defaultSystemCheckInterval is used when Monitor.Interval is not configured
+const defaultSystemCheckInterval = time.Minute
+
 // SystemStatsMonitor handles system monitoring
 type SystemStatsMonitor struct {
-	db model.DB
+	db     model.DB
+	stopCh chan struct{}
 }
 
 // NewSystemStatsMonitor creates a new system monitor
@@ -23,6 +30,48 @@ func NewSystemStatsMonitor(db model.DB) *SystemStatsMonitor {
 	}
 }
 
+// Start periodically collects system statistics and checks them against the
+// alert thresholds. The interval is re-read from settings on every tick
+func (m *SystemStatsMonitor) Start(log *logger.Logger, settingsMgr *settings.Manager, alerts *AlertManager) {
+	if m.stopCh != nil {
+		return
+	}
+	m.stopCh = make(chan struct{})
+	go m.run(m.stopCh, log, settingsMgr, alerts)
+}
+
+// Stop stops the periodic checks
+func (m *SystemStatsMonitor) Stop() {
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
+}
+
+// run is the check loop started by Start
+func (m *SystemStatsMonitor) run(stopCh chan struct{}, log *logger.Logger, settingsMgr *settings.Manager, alerts *AlertManager) {
+	for {
+		interval := settingsMgr.Get().Monitor.Interval
+		if interval <= 0 {
+			interval = defaultSystemCheckInterval
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
+
+		stats, err := m.GetSystemStats()
+		if err != nil {
+			log.WarnWithFields("Failed to collect system stats", logger.Fields{
+				"error": err.Error(),
+			})
+			continue
+		}
+		alerts.CheckSystemStats(stats)
+	}
+}
+
 // GetSystemStats returns current system statistics
 func (m *SystemStatsMonitor) GetSystemStats() (*model.SystemStats, error) {
 	stats := &model.SystemStats{}
@@ -0,0 +1,519 @@
+package node
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// 引导任务和步骤状态
+const (
+	BootstrapRunning   = "running"
+	BootstrapSucceeded = "succeeded"
+	BootstrapFailed    = "failed"
+	BootstrapSkipped   = "skipped"
+)
+
+const (
+	// bootstrapTimeout 单个引导任务的最长时间，包括下载 agent 和 Xray
+	bootstrapTimeout = 20 * time.Minute
+	// maxBootstrapJobs 保留的最近引导任务数
+	maxBootstrapJobs = 50
+
+	agentBinary   = "/usr/local/bin/v-agent"
+	agentEnvFile  = "/etc/v-agent/agent.env"
+	agentDataDir  = "/var/lib/v-agent"
+	agentUnitFile = "/etc/systemd/system/v-agent.service"
+	// agentListen 节点上的面板只监听本机，节点不对外提供管理界面
+	agentListen = "127.0.0.1:8080"
+
+	xrayInstallScript = "https://github.com/XTLS/Xray-install/raw/main/install-release.sh"
+)
+
+// agentUnit 节点 agent 的 systemd 服务
+const agentUnit = `[Unit]
+Description=V node agent
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+EnvironmentFile=` + agentEnvFile + `
+WorkingDirectory=` + agentDataDir + `
+ExecStart=` + agentBinary + `
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// ErrBootstrapRunning 该主机已有进行中的引导任务
+var ErrBootstrapRunning = errors.New("a bootstrap job is already running for this host")
+
+// BootstrapRequest 引导新节点的参数。密码和私钥只用于本次连接，不保存也不出现在任务状态中
+type BootstrapRequest struct {
+	Name          string `json:"name"`           // 节点名称，在延迟矩阵中标识该节点
+	Host          string `json:"host"`           // 服务器地址
+	Port          int    `json:"port"`           // SSH 端口，默认 22，同时作为延迟探测的目标端口
+	Username      string `json:"username"`       // SSH 用户，默认 root，其他用户需要免密 sudo
+	Password      string `json:"password"`       // SSH 密码，与私钥二选一
+	PrivateKey    string `json:"private_key"`    // SSH 私钥（PEM）
+	HostKey       string `json:"host_key"`       // 服务器公钥（authorized_keys 格式），必填，与实际公钥不一致时拒绝连接
+	ControllerURL string `json:"controller_url"` // 节点上报用的控制端地址，默认 HA.AdvertiseURL
+	Ports         []int  `json:"ports"`          // 需要在防火墙放行的入站端口（TCP 和 UDP）
+}
+
+// BootstrapStep 引导步骤的执行结果
+type BootstrapStep struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// BootstrapJob 引导任务
+type BootstrapJob struct {
+	ID         int64            `json:"id"`
+	Name       string           `json:"name"`
+	Host       string           `json:"host"`
+	Status     string           `json:"status"`
+	Arch       string           `json:"arch,omitempty"`
+	HostKey    string           `json:"host_key,omitempty"` // 实际连接的服务器公钥
+	Peer       string           `json:"peer,omitempty"`     // 登记到延迟探测列表的条目
+	Steps      []*BootstrapStep `json:"steps"`
+	Error      string           `json:"error,omitempty"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+// Bootstrapper 通过 SSH 引导新节点：安装 agent 和 Xray、写入上报配置、放行端口并登记到延迟探测列表。
+// 每个节点使用单独生成的上报密钥，全局密钥不会下发到节点
+type Bootstrapper struct {
+	log      *logger.Logger
+	settings *settings.Manager
+
+	mu     sync.Mutex
+	nextID int64
+	jobs   []*BootstrapJob
+}
+
+// NewBootstrapper 创建节点引导器
+func NewBootstrapper(log *logger.Logger, settingsMgr *settings.Manager) *Bootstrapper {
+	return &Bootstrapper{
+		log:      log,
+		settings: settingsMgr,
+	}
+}
+
+// Start 校验参数并在后台开始引导，actor 为发起引导的管理员，用于记录设置修改人
+func (b *Bootstrapper) Start(req BootstrapRequest, actor string) (*BootstrapJob, error) {
+	if err := b.normalize(&req); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	for _, job := range b.jobs {
+		if job.Host == req.Host && job.Status == BootstrapRunning {
+			b.mu.Unlock()
+			return nil, ErrBootstrapRunning
+		}
+	}
+	b.nextID++
+	job := &BootstrapJob{
+		ID:        b.nextID,
+		Name:      req.Name,
+		Host:      req.Host,
+		Status:    BootstrapRunning,
+		StartedAt: time.Now(),
+	}
+	b.jobs = append(b.jobs, job)
+	if len(b.jobs) > maxBootstrapJobs {
+		b.jobs = b.jobs[len(b.jobs)-maxBootstrapJobs:]
+	}
+	copied := copyJob(job)
+	b.mu.Unlock()
+
+	b.log.WithFields("Node bootstrap started", logger.Fields{
+		"job_id": job.ID,
+		"name":   req.Name,
+		"host":   req.Host,
+		"actor":  actor,
+	})
+	go b.run(job, req, actor)
+	return copied, nil
+}
+
+// Job 查询引导任务
+func (b *Bootstrapper) Job(id int64) (*BootstrapJob, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, job := range b.jobs {
+		if job.ID == id {
+			return copyJob(job), true
+		}
+	}
+	return nil, false
+}
+
+// Jobs 返回最近的引导任务，新的在前
+func (b *Bootstrapper) Jobs() []*BootstrapJob {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	jobs := make([]*BootstrapJob, 0, len(b.jobs))
+	for i := len(b.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, copyJob(b.jobs[i]))
+	}
+	return jobs
+}
+
+// normalize 校验参数并填充默认值
+func (b *Bootstrapper) normalize(req *BootstrapRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Host = strings.TrimSpace(req.Host)
+	if req.Name == "" || strings.ContainsAny(req.Name, "=, \t\n") {
+		return fmt.Errorf("invalid node name %q", req.Name)
+	}
+	if req.Host == "" {
+		return errors.New("host is required")
+	}
+	if req.Port == 0 {
+		req.Port = 22
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		return fmt.Errorf("invalid ssh port %d", req.Port)
+	}
+	if req.Username == "" {
+		req.Username = "root"
+	}
+	if req.Password == "" && req.PrivateKey == "" {
+		return errors.New("password or private key is required")
+	}
+	if strings.TrimSpace(req.HostKey) == "" {
+		return errors.New("host key is required, run ssh-keyscan on a trusted network to obtain it")
+	}
+	for _, port := range req.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+
+	cfg := b.settings.Get()
+	if req.ControllerURL == "" {
+		req.ControllerURL = cfg.HA.AdvertiseURL
+	}
+	if req.ControllerURL == "" {
+		return errors.New("controller url is required when ha.advertise_url is not set")
+	}
+	if u, err := url.Parse(req.ControllerURL); err != nil || u.Host == "" {
+		return fmt.Errorf("invalid controller url %q", req.ControllerURL)
+	}
+	if !cfg.Ingest.Enable {
+		return errors.New("ingest is disabled, nodes cannot report to this controller")
+	}
+	return nil
+}
+
+// run 依次执行引导步骤，任一步骤失败即停止
+func (b *Bootstrapper) run(job *BootstrapJob, req BootstrapRequest, actor string) {
+	ctx, cancel := context.WithTimeout(context.Background(), bootstrapTimeout)
+	defer cancel()
+
+	err := b.bootstrap(ctx, job, req, actor)
+
+	b.mu.Lock()
+	now := time.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = BootstrapFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = BootstrapSucceeded
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		b.log.ErrorWithFields("Node bootstrap failed", logger.Fields{
+			"job_id": job.ID,
+			"name":   req.Name,
+			"host":   req.Host,
+			"error":  err.Error(),
+		})
+		return
+	}
+	b.log.WithFields("Node bootstrap finished", logger.Fields{
+		"job_id":   job.ID,
+		"name":     req.Name,
+		"host":     req.Host,
+		"duration": now.Sub(job.StartedAt).String(),
+	})
+}
+
+// bootstrap 执行引导步骤
+func (b *Bootstrapper) bootstrap(ctx context.Context, job *BootstrapJob, req BootstrapRequest, actor string) error {
+	var r *remote
+	err := b.step(job, "connect", func() (string, error) {
+		var err error
+		r, err = dialRemote(ctx, net.JoinHostPort(req.Host, strconv.Itoa(req.Port)), req.Username, req.Password, req.PrivateKey, req.HostKey)
+		if err != nil {
+			return "", err
+		}
+		b.mu.Lock()
+		job.HostKey = r.hostKey
+		b.mu.Unlock()
+		return "", nil
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var arch string
+	err = b.step(job, "detect", func() (string, error) {
+		out, err := r.run("uname -m", nil)
+		if err != nil {
+			return out, err
+		}
+		arch = goArch(out)
+		if arch == "" {
+			return out, fmt.Errorf("unsupported architecture %q", out)
+		}
+		b.mu.Lock()
+		job.Arch = arch
+		b.mu.Unlock()
+		if out, err := r.run("command -v systemctl", nil); err != nil {
+			return out, errors.New("systemd is required on the node")
+		}
+		return out, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.step(job, "install_agent", func() (string, error) {
+		return b.installAgent(r, arch)
+	}); err != nil {
+		return err
+	}
+
+	if err := b.step(job, "install_xray", func() (string, error) {
+		return r.run(fmt.Sprintf(`command -v xray >/dev/null 2>&1 && xray version | head -n 1 && exit 0
+curl -fsSL %s -o /tmp/xray-install.sh && bash /tmp/xray-install.sh install; status=$?; rm -f /tmp/xray-install.sh; exit $status`,
+			shellQuote(xrayInstallScript)), nil)
+	}); err != nil {
+		return err
+	}
+
+	secret, err := nodeSecret()
+	if err != nil {
+		return err
+	}
+	if err := b.step(job, "configure_agent", func() (string, error) {
+		return b.configureAgent(r, req, secret)
+	}); err != nil {
+		return err
+	}
+
+	if len(req.Ports) == 0 {
+		b.skip(job, "open_ports")
+	} else if err := b.step(job, "open_ports", func() (string, error) {
+		return r.run(openPortsScript(req.Ports), nil)
+	}); err != nil {
+		return err
+	}
+
+	return b.step(job, "register", func() (string, error) {
+		peer, err := b.register(req, secret, actor)
+		if err != nil {
+			return "", err
+		}
+		b.mu.Lock()
+		job.Peer = peer
+		b.mu.Unlock()
+		return peer, nil
+	})
+}
+
+// installAgent 安装 agent。设置了 Nodes.AgentURL 时在节点上下载，否则上传当前程序（要求架构相同）
+func (b *Bootstrapper) installAgent(r *remote, arch string) (string, error) {
+	install := fmt.Sprintf("chmod 755 %[1]s.new && mv -f %[1]s.new %[1]s", agentBinary)
+	if agentURL := b.settings.Get().Nodes.AgentURL; agentURL != "" {
+		agentURL = strings.ReplaceAll(agentURL, "{arch}", arch)
+		return r.run(fmt.Sprintf("mkdir -p /usr/local/bin && curl -fsSL %s -o %s.new && %s",
+			shellQuote(agentURL), agentBinary, install), nil)
+	}
+
+	if arch != runtime.GOARCH || runtime.GOOS != "linux" {
+		return "", fmt.Errorf("node architecture %s differs from the controller (%s/%s), set nodes.agent_url to download a matching build",
+			arch, runtime.GOOS, runtime.GOARCH)
+	}
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate agent binary: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open agent binary: %v", err)
+	}
+	defer f.Close()
+	return r.run(fmt.Sprintf("mkdir -p /usr/local/bin && cat > %s.new && %s", agentBinary, install), f)
+}
+
+// configureAgent 写入 agent 的上报配置和 systemd 服务并启动，secret 为该节点专用的上报密钥
+func (b *Bootstrapper) configureAgent(r *remote, req BootstrapRequest, secret string) (string, error) {
+	cfg := b.settings.Get()
+	env := strings.Join([]string{
+		"NODE_NAME=" + req.Name,
+		"NODE_CONTROLLER_URL=" + req.ControllerURL,
+		"NODE_PEERS=" + strings.Join(agentPeers(cfg.Nodes, req), ","),
+		"INGEST_SECRET=" + secret,
+		"SERVER_LISTEN=" + agentListen,
+	}, "\n") + "\n"
+
+	dir := agentEnvFile[:strings.LastIndex(agentEnvFile, "/")]
+	if out, err := r.run(fmt.Sprintf("mkdir -p %s %s && umask 077 && cat > %s", dir, agentDataDir, agentEnvFile), strings.NewReader(env)); err != nil {
+		return out, err
+	}
+	if out, err := r.run("cat > "+agentUnitFile, strings.NewReader(agentUnit)); err != nil {
+		return out, err
+	}
+	return r.run("systemctl daemon-reload && systemctl enable v-agent >/dev/null 2>&1 && systemctl restart v-agent && systemctl is-active v-agent", nil)
+}
+
+// register 将节点登记到控制端的延迟探测列表并保存节点的上报密钥，已有同名节点时替换
+func (b *Bootstrapper) register(req BootstrapRequest, secret, actor string) (string, error) {
+	peer := req.Name + "=" + net.JoinHostPort(req.Host, strconv.Itoa(req.Port))
+
+	next := b.settings.Clone()
+	replaced := false
+	for i, spec := range next.Nodes.Peers {
+		if name, _, ok := strings.Cut(strings.TrimSpace(spec), "="); ok && name == req.Name {
+			next.Nodes.Peers[i] = peer
+			replaced = true
+		}
+	}
+	if !replaced {
+		next.Nodes.Peers = append(next.Nodes.Peers, peer)
+	}
+	if next.Ingest.NodeSecrets == nil {
+		next.Ingest.NodeSecrets = make(map[string]string)
+	}
+	next.Ingest.NodeSecrets[req.Name] = secret
+	if err := b.settings.ReplaceAs(next, actor); err != nil {
+		return "", err
+	}
+	return peer, nil
+}
+
+// skip 记录跳过的步骤
+func (b *Bootstrapper) skip(job *BootstrapJob, name string) {
+	b.mu.Lock()
+	job.Steps = append(job.Steps, &BootstrapStep{Name: name, Status: BootstrapSkipped})
+	b.mu.Unlock()
+}
+
+// step 执行一个步骤并记录结果
+func (b *Bootstrapper) step(job *BootstrapJob, name string, fn func() (string, error)) error {
+	step := &BootstrapStep{Name: name, Status: BootstrapRunning}
+	b.mu.Lock()
+	job.Steps = append(job.Steps, step)
+	b.mu.Unlock()
+
+	start := time.Now()
+	out, err := fn()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	step.Duration = time.Since(start)
+	step.Output = truncateOutput(out)
+	if err != nil {
+		step.Status = BootstrapFailed
+		step.Error = err.Error()
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	step.Status = BootstrapSucceeded
+	return nil
+}
+
+// nodeSecret 生成节点专用的上报密钥
+func nodeSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate node secret: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// agentPeers 返回新节点需要探测的节点：控制端已登记的其他节点，以及配置了名称的控制端本身
+func agentPeers(cfg settings.NodeSettings, req BootstrapRequest) []string {
+	var peers []string
+	for _, spec := range cfg.Peers {
+		spec = strings.TrimSpace(spec)
+		if name, _, _ := strings.Cut(spec, "="); spec == "" || name == req.Name {
+			continue
+		}
+		peers = append(peers, spec)
+	}
+	if cfg.Name != "" {
+		if u, err := url.Parse(req.ControllerURL); err == nil {
+			port := u.Port()
+			if port == "" {
+				port = "443"
+				if u.Scheme == "http" {
+					port = "80"
+				}
+			}
+			peers = append(peers, cfg.Name+"="+net.JoinHostPort(u.Hostname(), port))
+		}
+	}
+	return peers
+}
+
+// openPortsScript 生成放行端口的脚本，依次尝试 ufw、firewalld 和 iptables，都不可用时不做处理
+func openPortsScript(ports []int) string {
+	var ufw, firewalld, iptables []string
+	for _, port := range ports {
+		for _, proto := range []string{"tcp", "udp"} {
+			ufw = append(ufw, fmt.Sprintf("ufw allow %d/%s", port, proto))
+			firewalld = append(firewalld, fmt.Sprintf("firewall-cmd --permanent --add-port=%d/%s", port, proto))
+			iptables = append(iptables, fmt.Sprintf("(iptables -C INPUT -p %[2]s --dport %[1]d -j ACCEPT 2>/dev/null || iptables -I INPUT -p %[2]s --dport %[1]d -j ACCEPT)", port, proto))
+		}
+	}
+	return fmt.Sprintf(`set -e
+if command -v ufw >/dev/null 2>&1 && ufw status | grep -q "Status: active"; then
+%s
+elif command -v firewall-cmd >/dev/null 2>&1 && firewall-cmd --state >/dev/null 2>&1; then
+%s
+firewall-cmd --reload
+elif command -v iptables >/dev/null 2>&1; then
+%s
+else
+echo "no firewall found, nothing to do"
+fi`, strings.Join(ufw, "\n"), strings.Join(firewalld, "\n"), strings.Join(iptables, "\n"))
+}
+
+// copyJob 返回任务的副本
+func copyJob(job *BootstrapJob) *BootstrapJob {
+	copied := *job
+	copied.Steps = make([]*BootstrapStep, len(job.Steps))
+	for i, step := range job.Steps {
+		s := *step
+		copied.Steps[i] = &s
+	}
+	return &copied
+}
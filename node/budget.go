@@ -0,0 +1,618 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+	"v/utils"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// 流量预算的处理方式
+const (
+	BudgetActionNone     = "none"
+	BudgetActionThrottle = "throttle"
+	BudgetActionDisable  = "disable"
+)
+
+// 流量预算的默认值
+const (
+	defaultBudgetResetDay      = 1
+	defaultBudgetActionPercent = 95
+	defaultBudgetThrottleConns = 4
+	defaultBudgetPriorityTag   = "priority"
+
+	// budgetSampleInterval 读取网卡计数的间隔
+	budgetSampleInterval = time.Minute
+	// budgetActor 按流量预算修改入站时记录的修改人
+	budgetActor = "bandwidth_budget"
+	// budgetPageSize 列出入站时的分页大小
+	budgetPageSize = 100
+)
+
+// defaultBudgetAlertPercents 未设置告警阈值时使用的百分比
+var defaultBudgetAlertPercents = []int{80, 90, 100}
+
+// budgetStatePath 本周期用量的保存位置，重启后继续累计
+var budgetStatePath = filepath.Join("data", "bandwidth_budget.json")
+
+// BudgetProtocols 读取和停用入站
+type BudgetProtocols interface {
+	ListProtocols(page, pageSize int) ([]*model.Protocol, error)
+	GetProtocol(id int64) (*model.Protocol, error)
+	UpdateProtocolAs(protocol *model.Protocol, changedBy string) error
+}
+
+// BudgetAlerter 用量达到告警阈值或执行处理时发送告警
+type BudgetAlerter interface {
+	ReportBandwidthBudget(percent, threshold float64, message string)
+}
+
+// Throttler 限流入站变化后立即同步连接数限制
+type Throttler interface {
+	Sync()
+}
+
+// ifaceCounter 单个网卡的累计计数
+type ifaceCounter struct {
+	Sent     uint64 `json:"sent"`
+	Received uint64 `json:"received"`
+}
+
+// budgetState 本周期的用量和处理状态
+type budgetState struct {
+	PeriodStart time.Time               `json:"period_start"`
+	Sent        uint64                  `json:"sent"`
+	Received    uint64                  `json:"received"`
+	Last        map[string]ifaceCounter `json:"last"` // 上次读取的网卡计数，用于计算增量
+	Alerted     []int                   `json:"alerted"`
+	Action      string                  `json:"action"` // 正在执行的处理，未执行时为空
+	ActionSince *time.Time              `json:"action_since,omitempty"`
+	Affected    []int64                 `json:"affected"` // 被限流或停用的入站
+	UpdatedAt   time.Time               `json:"updated_at"`
+}
+
+// BudgetStatus 本节点的流量预算使用情况
+type BudgetStatus struct {
+	Node        string     `json:"node"`
+	Budget      int64      `json:"budget"` // 每月预算（字节），0 表示不限制
+	Direction   string     `json:"direction"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+	Sent        uint64     `json:"sent"`
+	Received    uint64     `json:"received"`
+	Used        uint64     `json:"used"` // 按计费方向统计的用量
+	Percent     float64    `json:"percent"`
+	Projected   uint64     `json:"projected"` // 按本周期平均速度预计的周期总用量
+	Alerted     []int      `json:"alerted"`
+	Action      string     `json:"action"`
+	ActionSince *time.Time `json:"action_since,omitempty"`
+	Affected    []int64    `json:"affected"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// budgetAlert 一条待发送的预算告警
+type budgetAlert struct {
+	threshold float64
+	message   string
+}
+
+// Budget 按网卡计数统计本节点每月流量，达到告警阈值时告警，
+// 将耗尽时按设置限流或停用非优先入站，避免超出服务商的流量套餐
+type Budget struct {
+	log       *logger.Logger
+	settings  *settings.Manager
+	protocols BudgetProtocols
+	alerter   BudgetAlerter
+	throttler Throttler
+	onApply   func(reason string)
+
+	mu     sync.Mutex
+	state  *budgetState
+	stopCh chan struct{}
+}
+
+// NewBudget 创建流量预算
+func NewBudget(log *logger.Logger, settingsMgr *settings.Manager, protocols BudgetProtocols) *Budget {
+	return &Budget{
+		log:       log,
+		settings:  settingsMgr,
+		protocols: protocols,
+	}
+}
+
+// SetAlerter 设置告警
+func (b *Budget) SetAlerter(alerter BudgetAlerter) {
+	b.alerter = alerter
+}
+
+// SetThrottler 设置连接数限制，限流入站变化后立即同步
+func (b *Budget) SetThrottler(t Throttler) {
+	b.throttler = t
+}
+
+// SetOnApply 设置停用或恢复入站后的回调，用于重新生成 Xray 配置
+func (b *Budget) SetOnApply(fn func(reason string)) {
+	b.onApply = fn
+}
+
+// Start 启动定期统计，启动时先读取上次保存的用量
+func (b *Budget) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopCh != nil {
+		return
+	}
+	if b.state == nil {
+		b.state = b.load()
+	}
+	b.stopCh = make(chan struct{})
+	go b.run(b.stopCh)
+}
+
+// Stop 停止定期统计，已执行的处理保持到下次启动后按用量重新判断
+func (b *Budget) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopCh != nil {
+		close(b.stopCh)
+		b.stopCh = nil
+	}
+}
+
+// Status 返回本周期的用量
+func (b *Budget) Status(now time.Time) *BudgetStatus {
+	cfg := b.settings.Get().Nodes
+	start := budgetPeriodStart(now.In(b.settings.Location()), cfg.BudgetResetDay)
+	end := start.AddDate(0, 1, 0)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := &BudgetStatus{
+		Node:        cfg.Name,
+		Budget:      cfg.BandwidthBudget,
+		Direction:   budgetDirection(cfg.BudgetDirection),
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Alerted:     []int{},
+		Affected:    []int64{},
+	}
+	st := b.state
+	if st == nil || !st.PeriodStart.Equal(start) {
+		return status
+	}
+	status.Sent, status.Received = st.Sent, st.Received
+	status.Used = budgetUsed(status.Direction, st.Sent, st.Received)
+	status.Percent = budgetPercent(status.Used, cfg.BandwidthBudget)
+	if elapsed := now.Sub(start); elapsed > 0 {
+		status.Projected = uint64(float64(status.Used) * float64(end.Sub(start)) / float64(elapsed))
+	}
+	status.Alerted = append(status.Alerted, st.Alerted...)
+	status.Action = st.Action
+	status.ActionSince = st.ActionSince
+	status.Affected = append(status.Affected, st.Affected...)
+	status.UpdatedAt = st.UpdatedAt
+	return status
+}
+
+// ThrottleLimits 返回限流中的入站及其最大并发连接数，供连接数限制合并使用
+func (b *Budget) ThrottleLimits() map[int64]int {
+	conns := b.settings.Get().Nodes.BudgetThrottleConns
+	if conns <= 0 {
+		conns = defaultBudgetThrottleConns
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == nil || b.state.Action != BudgetActionThrottle {
+		return nil
+	}
+	limits := make(map[int64]int, len(b.state.Affected))
+	for _, id := range b.state.Affected {
+		limits[id] = conns
+	}
+	return limits
+}
+
+// run 统计循环
+func (b *Budget) run(stopCh chan struct{}) {
+	ticker := time.NewTicker(budgetSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.Sample(time.Now()); err != nil {
+			b.log.WarnWithFields("Failed to sample bandwidth budget", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample 读取网卡计数累计本周期用量，按用量发送告警并执行或撤销处理
+func (b *Budget) Sample(now time.Time) error {
+	cfg := b.settings.Get().Nodes
+	counters, err := readIfaceCounters(cfg.BudgetExcludeInterfaces)
+	if err != nil {
+		return fmt.Errorf("failed to read interface counters: %v", err)
+	}
+	start := budgetPeriodStart(now.In(b.settings.Location()), cfg.BudgetResetDay)
+
+	b.mu.Lock()
+	if b.state == nil {
+		b.state = b.load()
+	}
+	st := b.state
+	prevAction := st.Action
+	if !st.PeriodStart.Equal(start) {
+		if !st.PeriodStart.IsZero() {
+			b.log.WithFields("Bandwidth budget period reset", logger.Fields{
+				"period_start": start,
+				"sent":         st.Sent,
+				"received":     st.Received,
+			})
+		}
+		st.PeriodStart = start
+		st.Sent, st.Received = 0, 0
+		st.Alerted = nil
+	}
+	for name, c := range counters {
+		if last, ok := st.Last[name]; ok {
+			st.Sent += counterDelta(last.Sent, c.Sent)
+			st.Received += counterDelta(last.Received, c.Received)
+		}
+	}
+	st.Last = counters
+	st.UpdatedAt = now
+
+	used := budgetUsed(budgetDirection(cfg.BudgetDirection), st.Sent, st.Received)
+	percent := budgetPercent(used, cfg.BandwidthBudget)
+	alerts := b.checkThresholds(st, cfg, used, percent)
+	alerts = append(alerts, b.checkAction(st, cfg, percent, now)...)
+	saveErr := b.save(st)
+	action := st.Action
+	b.mu.Unlock()
+
+	if b.alerter != nil {
+		for _, a := range alerts {
+			b.alerter.ReportBandwidthBudget(percent, a.threshold, a.message)
+		}
+	}
+	if action != prevAction {
+		if (action == BudgetActionThrottle || prevAction == BudgetActionThrottle) && b.throttler != nil {
+			b.throttler.Sync()
+		}
+		if (action == BudgetActionDisable || prevAction == BudgetActionDisable) && b.onApply != nil {
+			b.onApply("bandwidth budget")
+		}
+	}
+	return saveErr
+}
+
+// checkThresholds 返回本周期首次达到的告警阈值，每个阈值每周期只告警一次
+func (b *Budget) checkThresholds(st *budgetState, cfg settings.NodeSettings, used uint64, percent float64) []budgetAlert {
+	if cfg.BandwidthBudget <= 0 {
+		return nil
+	}
+	thresholds := cfg.BudgetAlertPercents
+	if len(thresholds) == 0 {
+		thresholds = defaultBudgetAlertPercents
+	}
+
+	highest := 0
+	for _, t := range thresholds {
+		if t <= 0 || percent < float64(t) || containsInt(st.Alerted, t) {
+			continue
+		}
+		st.Alerted = append(st.Alerted, t)
+		if t > highest {
+			highest = t
+		}
+	}
+	if highest == 0 {
+		return nil
+	}
+	sort.Ints(st.Alerted)
+
+	b.log.WarnWithFields("Bandwidth budget threshold reached", logger.Fields{
+		"used":      used,
+		"budget":    cfg.BandwidthBudget,
+		"percent":   percent,
+		"threshold": highest,
+	})
+	message := fmt.Sprintf("%s本月流量已使用 %s / %s（%.1f%%），达到 %d%% 告警阈值",
+		budgetNodeLabel(cfg.Name), utils.FormatBytes(used), utils.FormatBytes(uint64(cfg.BandwidthBudget)), percent, highest)
+	return []budgetAlert{{threshold: float64(highest), message: message}}
+}
+
+// checkAction 用量达到处理阈值时限流或停用非优先入站，用量回落（新周期或预算调高）或处理方式修改后撤销
+func (b *Budget) checkAction(st *budgetState, cfg settings.NodeSettings, percent float64, now time.Time) []budgetAlert {
+	want := cfg.BudgetAction
+	if want != BudgetActionThrottle && want != BudgetActionDisable {
+		want = ""
+	}
+	trigger := cfg.BudgetActionPercent
+	if trigger <= 0 {
+		trigger = defaultBudgetActionPercent
+	}
+	if cfg.BandwidthBudget <= 0 || percent < float64(trigger) {
+		want = ""
+	}
+	if st.Action == want {
+		return nil
+	}
+
+	var alerts []budgetAlert
+	if st.Action != "" {
+		restored := b.release(st)
+		b.log.WithFields("Bandwidth budget action released", logger.Fields{
+			"action":   st.Action,
+			"percent":  percent,
+			"affected": len(st.Affected),
+		})
+		alerts = append(alerts, budgetAlert{
+			threshold: float64(trigger),
+			message:   fmt.Sprintf("%s流量预算处理已撤销，%d 个入站已恢复", budgetNodeLabel(cfg.Name), restored),
+		})
+		st.Action, st.ActionSince, st.Affected = "", nil, nil
+	}
+	if want == "" {
+		return alerts
+	}
+
+	affected, err := b.candidates(cfg)
+	if err != nil {
+		b.log.ErrorWithFields("Failed to list inbounds for bandwidth budget", logger.Fields{
+			"error": err.Error(),
+		})
+		return alerts
+	}
+	if want == BudgetActionDisable {
+		affected = b.disable(affected)
+	}
+	since := now
+	st.Action, st.ActionSince, st.Affected = want, &since, affected
+
+	b.log.WarnWithFields("Bandwidth budget action applied", logger.Fields{
+		"action":   want,
+		"percent":  percent,
+		"affected": len(affected),
+	})
+	var message string
+	if want == BudgetActionThrottle {
+		conns := cfg.BudgetThrottleConns
+		if conns <= 0 {
+			conns = defaultBudgetThrottleConns
+		}
+		message = fmt.Sprintf("%s流量已使用 %.1f%%，已将 %d 个非优先入站的并发连接数限制为 %d", budgetNodeLabel(cfg.Name), percent, len(affected), conns)
+	} else {
+		message = fmt.Sprintf("%s流量已使用 %.1f%%，已停用 %d 个非优先入站", budgetNodeLabel(cfg.Name), percent, len(affected))
+	}
+	return append(alerts, budgetAlert{threshold: float64(trigger), message: message})
+}
+
+// candidates 返回启用中的非优先入站
+func (b *Budget) candidates(cfg settings.NodeSettings) ([]int64, error) {
+	tag := cfg.BudgetPriorityTag
+	if tag == "" {
+		tag = defaultBudgetPriorityTag
+	}
+
+	var ids []int64
+	for page := 1; ; page++ {
+		list, err := b.protocols.ListProtocols(page, budgetPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			if containsString(item.Tags, tag) {
+				continue
+			}
+			// 列表不含启用状态，逐个读取完整记录
+			p, err := b.protocols.GetProtocol(item.ID)
+			if err != nil || p == nil || !p.Enable || p.Type == "relay" {
+				continue
+			}
+			ids = append(ids, p.ID)
+		}
+		if len(list) < budgetPageSize {
+			break
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// disable 停用入站，返回实际停用的入站
+func (b *Budget) disable(ids []int64) []int64 {
+	var disabled []int64
+	for _, id := range ids {
+		p, err := b.protocols.GetProtocol(id)
+		if err != nil || p == nil || !p.Enable {
+			continue
+		}
+		p.Enable = false
+		if err := b.protocols.UpdateProtocolAs(p, budgetActor); err != nil {
+			b.log.ErrorWithFields("Failed to disable inbound for bandwidth budget", logger.Fields{
+				"protocol_id": id,
+				"error":       err.Error(),
+			})
+			continue
+		}
+		disabled = append(disabled, id)
+	}
+	return disabled
+}
+
+// release 撤销处理，重新启用因预算停用的入站，返回恢复的入站数
+func (b *Budget) release(st *budgetState) int {
+	if st.Action != BudgetActionDisable {
+		return len(st.Affected)
+	}
+	restored := 0
+	for _, id := range st.Affected {
+		p, err := b.protocols.GetProtocol(id)
+		if err != nil || p == nil || p.Enable {
+			continue
+		}
+		p.Enable = true
+		if err := b.protocols.UpdateProtocolAs(p, budgetActor); err != nil {
+			b.log.ErrorWithFields("Failed to re-enable inbound after bandwidth budget", logger.Fields{
+				"protocol_id": id,
+				"error":       err.Error(),
+			})
+			continue
+		}
+		restored++
+	}
+	return restored
+}
+
+// load 读取上次保存的用量，文件不存在或损坏时从零开始
+func (b *Budget) load() *budgetState {
+	st := &budgetState{}
+	data, err := os.ReadFile(budgetStatePath)
+	if err != nil {
+		return st
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		b.log.WarnWithFields("Failed to parse bandwidth budget state", logger.Fields{
+			"error": err.Error(),
+		})
+		return &budgetState{}
+	}
+	return st
+}
+
+// save 保存本周期用量
+func (b *Budget) save(st *budgetState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bandwidth budget state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(budgetStatePath), 0755); err != nil {
+		return fmt.Errorf("failed to create bandwidth budget directory: %v", err)
+	}
+	if err := os.WriteFile(budgetStatePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write bandwidth budget state: %v", err)
+	}
+	return nil
+}
+
+// readIfaceCounters 读取各网卡的累计计数，排除回环网卡和设置中排除的网卡
+func readIfaceCounters(exclude []string) (map[string]ifaceCounter, error) {
+	stats, err := net.IOCounters(true)
+	if err != nil {
+		return nil, err
+	}
+	counters := make(map[string]ifaceCounter, len(stats))
+	for _, s := range stats {
+		if strings.HasPrefix(s.Name, "lo") || containsString(exclude, s.Name) {
+			continue
+		}
+		counters[s.Name] = ifaceCounter{Sent: s.BytesSent, Received: s.BytesRecv}
+	}
+	return counters, nil
+}
+
+// counterDelta 计算计数增量，计数变小说明系统重启或网卡重建，从零重新计数
+func counterDelta(last, current uint64) uint64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+// budgetPeriodStart 返回 now 所在计费周期的开始时间，重置日超出范围时使用每月 1 日
+func budgetPeriodStart(now time.Time, resetDay int) time.Time {
+	if resetDay < 1 || resetDay > 28 {
+		resetDay = defaultBudgetResetDay
+	}
+	start := time.Date(now.Year(), now.Month(), resetDay, 0, 0, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// budgetDirection 规范化计费方向
+func budgetDirection(direction string) string {
+	switch direction {
+	case "out", "in", "max":
+		return direction
+	default:
+		return "both"
+	}
+}
+
+// budgetUsed 按计费方向计算用量
+func budgetUsed(direction string, sent, received uint64) uint64 {
+	switch direction {
+	case "out":
+		return sent
+	case "in":
+		return received
+	case "max":
+		if sent > received {
+			return sent
+		}
+		return received
+	default:
+		return sent + received
+	}
+}
+
+// budgetPercent 计算用量占预算的百分比，未设置预算时为 0
+func budgetPercent(used uint64, budget int64) float64 {
+	if budget <= 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(budget)
+}
+
+// budgetNodeLabel 告警消息中的节点名称
+func budgetNodeLabel(name string) string {
+	if name == "" {
+		return "本节点"
+	}
+	return "节点 " + name + " "
+}
+
+// containsInt 判断列表是否包含 v
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString 判断列表是否包含 s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// 延迟探测的默认值
+const (
+	defaultProbeInterval   = time.Minute
+	defaultProbeCount      = 5
+	defaultProbeTimeout    = 2 * time.Second
+	defaultDegradedLatency = 300 * time.Millisecond
+	defaultDegradedLoss    = 20.0
+
+	// staleIntervals 超过若干探测周期没有更新的链路视为过期，不参与路由建议
+	staleIntervals = 3
+	// recoverRatio 劣化的链路需回落到阈值的该比例以下才恢复，避免在阈值附近反复告警
+	recoverRatio = 0.8
+)
+
+// ErrInvalidReport 上报数据格式错误
+var ErrInvalidReport = errors.New("invalid latency report")
+
+// Sample 一轮探测中到单个节点的结果
+type Sample struct {
+	To       string  `json:"to"`
+	Latency  float64 `json:"latency_ms"` // 成功探测的平均延迟（毫秒）
+	Loss     float64 `json:"loss"`       // 丢包率（%）
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+}
+
+// Report 节点上报的一轮探测结果
+type Report struct {
+	Node    string   `json:"node"`
+	Samples []Sample `json:"samples"`
+}
+
+// Link 延迟矩阵中的一条有向链路
+type Link struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Latency   float64   `json:"latency_ms"`
+	Loss      float64   `json:"loss"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Degraded  bool      `json:"degraded"`
+	Since     time.Time `json:"since"` // 开始劣化的时间，未劣化时为零值
+	Down      bool      `json:"down"`  // 最近一轮探测全部丢包，终点节点从起点不可达
+	Stale     bool      `json:"stale"`
+}
+
+// MatrixView 延迟矩阵快照
+type MatrixView struct {
+	Nodes []string `json:"nodes"`
+	Links []Link   `json:"links"`
+}
+
+// LinkAlerter 链路劣化和恢复的通知接口
+type LinkAlerter interface {
+	ReportNodeLink(degraded bool, value, threshold float64, since time.Time, message string)
+}
+
+// DownListener 链路不可达或恢复可达时的回调，在持有矩阵锁时同步调用，耗时操作应放到后台
+type DownListener func(link Link, down bool)
+
+// linkKey 有向链路
+type linkKey struct {
+	from, to string
+}
+
+// Matrix 控制端保存的节点间延迟矩阵，每条链路只保留最近一轮探测结果
+type Matrix struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	alerter  LinkAlerter
+	onDown   DownListener
+
+	mu    sync.Mutex
+	links map[linkKey]*Link
+}
+
+// NewMatrix 创建延迟矩阵，alerter 为 nil 时不发送链路告警
+func NewMatrix(log *logger.Logger, settingsMgr *settings.Manager, alerter LinkAlerter) *Matrix {
+	return &Matrix{
+		log:      log,
+		settings: settingsMgr,
+		alerter:  alerter,
+		links:    make(map[linkKey]*Link),
+	}
+}
+
+// SetDownListener 设置链路不可达和恢复的回调
+func (m *Matrix) SetDownListener(fn DownListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onDown = fn
+}
+
+// Record 记录节点上报的探测结果，链路劣化或恢复时发送通知
+func (m *Matrix) Record(report *Report, now time.Time) error {
+	if report.Node == "" {
+		return fmt.Errorf("%w: node is required", ErrInvalidReport)
+	}
+	for _, s := range report.Samples {
+		if s.To == "" || s.To == report.Node {
+			return fmt.Errorf("%w: invalid peer %q", ErrInvalidReport, s.To)
+		}
+		if s.Loss < 0 || s.Loss > 100 || s.Latency < 0 {
+			return fmt.Errorf("%w: sample out of range for %s", ErrInvalidReport, s.To)
+		}
+	}
+
+	latencyLimit, lossLimit := m.thresholds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range report.Samples {
+		key := linkKey{report.Node, s.To}
+		link, ok := m.links[key]
+		if !ok {
+			link = &Link{From: report.Node, To: s.To}
+			m.links[key] = link
+		}
+		link.Latency = s.Latency
+		link.Loss = s.Loss
+		link.UpdatedAt = now
+
+		if link.Degraded {
+			if s.Latency <= latencyLimit*recoverRatio && s.Loss <= lossLimit*recoverRatio {
+				m.notify(link, false, latencyLimit)
+				link.Degraded = false
+				link.Since = time.Time{}
+			}
+		} else if s.Latency > latencyLimit || s.Loss > lossLimit {
+			link.Degraded = true
+			link.Since = now
+			m.notify(link, true, latencyLimit)
+		}
+
+		if down := s.Loss >= 100; down != link.Down {
+			link.Down = down
+			if m.onDown != nil {
+				m.onDown(*link, down)
+			}
+		}
+	}
+	return nil
+}
+
+// notify 记录链路状态变化并通知
+func (m *Matrix) notify(link *Link, degraded bool, latencyLimit float64) {
+	fields := logger.Fields{
+		"from":       link.From,
+		"to":         link.To,
+		"latency_ms": link.Latency,
+		"loss":       link.Loss,
+	}
+	var message string
+	if degraded {
+		m.log.WarnWithFields("Inter-node link degraded", fields)
+		message = fmt.Sprintf("节点 %s → %s 链路劣化：延迟 %.0f 毫秒，丢包率 %.1f%%", link.From, link.To, link.Latency, link.Loss)
+	} else {
+		m.log.WithFields("Inter-node link recovered", fields)
+		message = fmt.Sprintf("节点 %s → %s 链路已恢复：延迟 %.0f 毫秒，丢包率 %.1f%%", link.From, link.To, link.Latency, link.Loss)
+	}
+	if m.alerter != nil {
+		m.alerter.ReportNodeLink(degraded, link.Latency, latencyLimit, link.Since, message)
+	}
+}
+
+// Snapshot 返回当前延迟矩阵，链路按起点和终点排序
+func (m *Matrix) Snapshot(now time.Time) *MatrixView {
+	staleAfter := staleIntervals * m.interval()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make(map[string]bool)
+	view := &MatrixView{Links: make([]Link, 0, len(m.links))}
+	for _, link := range m.links {
+		l := *link
+		l.Stale = now.Sub(l.UpdatedAt) > staleAfter
+		view.Links = append(view.Links, l)
+		nodes[l.From] = true
+		nodes[l.To] = true
+	}
+	sort.Slice(view.Links, func(i, j int) bool {
+		if view.Links[i].From != view.Links[j].From {
+			return view.Links[i].From < view.Links[j].From
+		}
+		return view.Links[i].To < view.Links[j].To
+	})
+	view.Nodes = make([]string, 0, len(nodes))
+	for name := range nodes {
+		view.Nodes = append(view.Nodes, name)
+	}
+	sort.Strings(view.Nodes)
+	return view
+}
+
+// thresholds 返回链路劣化的延迟（毫秒）和丢包率阈值
+func (m *Matrix) thresholds() (float64, float64) {
+	cfg := m.settings.Get().Nodes
+	latency := cfg.DegradedLatency
+	if latency <= 0 {
+		latency = defaultDegradedLatency
+	}
+	loss := cfg.DegradedLoss
+	if loss <= 0 {
+		loss = defaultDegradedLoss
+	}
+	return float64(latency) / float64(time.Millisecond), loss
+}
+
+// interval 返回探测间隔
+func (m *Matrix) interval() time.Duration {
+	if d := m.settings.Get().Nodes.ProbeInterval; d > 0 {
+		return d
+	}
+	return defaultProbeInterval
+}
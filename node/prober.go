@@ -0,0 +1,204 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+	"v/stats"
+)
+
+// reportTimeout 向控制端上报的超时时间
+const reportTimeout = 10 * time.Second
+
+// peer 需要探测的节点
+type peer struct {
+	name string
+	addr string
+}
+
+// Prober 定期探测到其他节点的延迟和丢包。配置了控制端地址时将结果签名后上报，
+// 否则本节点即控制端，直接写入本地延迟矩阵
+type Prober struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	matrix   *Matrix
+	client   *http.Client
+
+	mu     sync.Mutex
+	stopCh chan struct{}
+}
+
+// NewProber 创建延迟探测器
+func NewProber(log *logger.Logger, settingsMgr *settings.Manager, matrix *Matrix) *Prober {
+	return &Prober{
+		log:      log,
+		settings: settingsMgr,
+		matrix:   matrix,
+		client:   &http.Client{Timeout: reportTimeout},
+	}
+}
+
+// Start 启动定期探测，设置每轮重新读取，修改后无需重启
+func (p *Prober) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopCh != nil {
+		return
+	}
+	p.stopCh = make(chan struct{})
+	go p.run(p.stopCh)
+}
+
+// Stop 停止定期探测
+func (p *Prober) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopCh != nil {
+		close(p.stopCh)
+		p.stopCh = nil
+	}
+}
+
+// run 探测循环
+func (p *Prober) run(stopCh chan struct{}) {
+	for {
+		timer := time.NewTimer(p.matrix.interval())
+		select {
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := p.ProbeOnce(context.Background()); err != nil {
+			p.log.WarnWithFields("Node latency probe failed", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// ProbeOnce 并行探测所有节点并提交结果，没有配置节点时返回 nil
+func (p *Prober) ProbeOnce(ctx context.Context) (*Report, error) {
+	cfg := p.settings.Get().Nodes
+	peers := parsePeers(cfg.Peers)
+	if len(peers) == 0 {
+		return nil, nil
+	}
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("node name is not configured")
+	}
+
+	count := cfg.ProbeCount
+	if count <= 0 {
+		count = defaultProbeCount
+	}
+	timeout := cfg.ProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	report := &Report{Node: cfg.Name, Samples: make([]Sample, len(peers))}
+	var wg sync.WaitGroup
+	for i, target := range peers {
+		wg.Add(1)
+		go func(i int, target peer) {
+			defer wg.Done()
+			report.Samples[i] = probePeer(ctx, target, count, timeout)
+		}(i, target)
+	}
+	wg.Wait()
+
+	if cfg.ControllerURL == "" {
+		return report, p.matrix.Record(report, time.Now())
+	}
+	return report, p.send(ctx, cfg.ControllerURL, p.settings.Get().Ingest.Secret, report)
+}
+
+// probePeer 依次建立 count 次 TCP 连接，按握手耗时计算平均延迟，连接失败计为丢包
+func probePeer(ctx context.Context, target peer, count int, timeout time.Duration) Sample {
+	sample := Sample{To: target.name, Sent: count}
+	dialer := net.Dialer{Timeout: timeout}
+	var total time.Duration
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", target.addr)
+		if err != nil {
+			continue
+		}
+		total += time.Since(start)
+		conn.Close()
+		sample.Received++
+	}
+	if sample.Received > 0 {
+		sample.Latency = float64(total) / float64(sample.Received) / float64(time.Millisecond)
+	}
+	sample.Loss = float64(sample.Sent-sample.Received) / float64(sample.Sent) * 100
+	return sample
+}
+
+// send 将探测结果签名后上报到控制端，签名方式与外部流量上报相同
+func (p *Prober) send(ctx context.Context, controllerURL, secret string, report *Report) error {
+	if secret == "" {
+		return fmt.Errorf("ingest secret is not configured")
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal latency report: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+
+	url := strings.TrimRight(controllerURL, "/") + "/api/ingest/latency"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ingest-Timestamp", timestamp)
+	req.Header.Set("X-Ingest-Signature", "sha256="+hex.EncodeToString(stats.SignIngest(secret, timestamp, body)))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send latency report: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("controller rejected latency report: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// parsePeers 解析 name=host:port 格式的节点列表，缺少名称时以地址作为名称
+func parsePeers(specs []string) []peer {
+	peers := make([]peer, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, addr := spec, spec
+		if i := strings.Index(spec, "="); i >= 0 {
+			name, addr = spec[:i], spec[i+1:]
+		}
+		peers = append(peers, peer{name: name, addr: addr})
+	}
+	return peers
+}
@@ -0,0 +1,94 @@
+package node
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrNoRoute 两个节点之间没有可用的链路
+var ErrNoRoute = errors.New("no route between nodes")
+
+// Route 建议的中转链路
+type Route struct {
+	Path    []string `json:"path"`       // 依次经过的节点，包含起点和终点
+	Latency float64  `json:"latency_ms"` // 各段延迟之和（毫秒）
+	Loss    float64  `json:"loss"`       // 各段丢包叠加后的丢包率（%）
+	Direct  *Link    `json:"direct,omitempty"`
+	Relay   bool     `json:"relay"` // 是否需要经其他节点中转
+}
+
+// SuggestRoute 根据延迟矩阵计算从 from 到 to 代价最小的链路。
+// 每段代价为延迟除以送达率，即计入重传的期望延迟；过期和完全不通的链路不参与计算
+func (m *Matrix) SuggestRoute(from, to string, now time.Time) (*Route, error) {
+	if from == "" || to == "" || from == to {
+		return nil, ErrNoRoute
+	}
+
+	staleAfter := staleIntervals * m.interval()
+
+	m.mu.Lock()
+	edges := make(map[string][]Link)
+	var direct *Link
+	for _, link := range m.links {
+		if now.Sub(link.UpdatedAt) > staleAfter || link.Loss >= 100 {
+			continue
+		}
+		edges[link.From] = append(edges[link.From], *link)
+		if link.From == from && link.To == to {
+			l := *link
+			direct = &l
+		}
+	}
+	m.mu.Unlock()
+
+	// 节点数量很少，使用简单的 Dijkstra
+	cost := map[string]float64{from: 0}
+	prev := make(map[string]Link)
+	done := make(map[string]bool)
+	for {
+		current, best := "", math.Inf(1)
+		for name, c := range cost {
+			if !done[name] && c < best {
+				current, best = name, c
+			}
+		}
+		if current == "" || current == to {
+			break
+		}
+		done[current] = true
+		for _, link := range edges[current] {
+			c := best + linkCost(link)
+			if old, ok := cost[link.To]; !ok || c < old {
+				cost[link.To] = c
+				prev[link.To] = link
+			}
+		}
+	}
+	if _, ok := cost[to]; !ok {
+		return nil, ErrNoRoute
+	}
+
+	route := &Route{Direct: direct}
+	delivered := 1.0
+	path := []string{to}
+	for node := to; node != from; {
+		link := prev[node]
+		route.Latency += link.Latency
+		delivered *= 1 - link.Loss/100
+		path = append(path, link.From)
+		node = link.From
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	route.Path = path
+	route.Loss = (1 - delivered) * 100
+	route.Relay = len(path) > 2
+	return route, nil
+}
+
+// linkCost 链路代价，丢包越多期望延迟越高
+func linkCost(link Link) float64 {
+	return link.Latency / (1 - link.Loss/100)
+}
@@ -0,0 +1,127 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshDialTimeout = 30 * time.Second
+	// maxStepOutput 每个步骤保留的输出长度
+	maxStepOutput = 4096
+)
+
+// remote 引导过程中的 SSH 连接
+type remote struct {
+	client  *ssh.Client
+	sudo    bool   // 非 root 用户，命令通过 sudo -n 执行
+	hostKey string // 服务器公钥，authorized_keys 格式
+}
+
+// dialRemote 使用一次性提供的密码或私钥建立 SSH 连接，服务器公钥必须与 hostKey 一致
+func dialRemote(ctx context.Context, addr, username, password, privateKey, hostKey string) (*remote, error) {
+	var auth []ssh.AuthMethod
+	if privateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh host key: %v", err)
+	}
+	r := &remote{
+		sudo:    username != "root",
+		hostKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+	}
+
+	dialer := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: ssh.FixedHostKey(key),
+		Timeout:         sshDialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake failed: %v", err)
+	}
+	r.client = ssh.NewClient(sshConn, chans, reqs)
+
+	// ctx 取消时断开连接，使正在执行的命令返回
+	go func() {
+		<-ctx.Done()
+		r.client.Close()
+	}()
+	return r, nil
+}
+
+// Close 断开连接
+func (r *remote) Close() error {
+	return r.client.Close()
+}
+
+// run 执行命令并返回合并后的标准输出和标准错误，stdin 不为空时作为命令输入
+func (r *remote) run(command string, stdin io.Reader) (string, error) {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open ssh session: %v", err)
+	}
+	defer session.Close()
+
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+	session.Stdin = stdin
+	if r.sudo {
+		command = "sudo -n sh -c " + shellQuote(command)
+	}
+	err = session.Run(command)
+	return truncateOutput(output.String()), err
+}
+
+// shellQuote 用单引号包裹参数
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// truncateOutput 只保留输出的末尾部分，错误信息通常在最后
+func truncateOutput(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxStepOutput {
+		s = "..." + s[len(s)-maxStepOutput:]
+	}
+	return s
+}
+
+// goArch 将 uname -m 的输出转换为 GOARCH
+func goArch(machine string) string {
+	switch strings.TrimSpace(machine) {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "armv7l", "armv6l":
+		return "arm"
+	case "i386", "i686":
+		return "386"
+	}
+	return ""
+}
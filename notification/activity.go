@@ -0,0 +1,278 @@
+package notification
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/privacy"
+	"v/settings"
+)
+
+const (
+	// AccessLogin 登录面板
+	AccessLogin = "login"
+	// AccessSubscription 拉取订阅
+	AccessSubscription = "subscription"
+
+	// defaultActivityCooldown 同一用户同类提醒的默认最小间隔
+	defaultActivityCooldown = time.Hour
+	// maxKnownAddresses 每个用户记住的地址数量
+	maxKnownAddresses = 50
+	// knownAddressTTL 地址多久未出现后视为新地址
+	knownAddressTTL = 30 * 24 * time.Hour
+)
+
+// GeoLookup 根据 IP 查询国家代码，未配置时只按 IP 判断
+type GeoLookup interface {
+	Country(ip string) (string, error)
+}
+
+// UserGetter 查询用户邮箱和提醒偏好
+type UserGetter interface {
+	GetUser(id int64) (*model.User, error)
+}
+
+// knownAddress 用户出现过的地址
+type knownAddress struct {
+	country  string
+	lastSeen time.Time
+}
+
+// ActivityMonitor 检测用户从新 IP/国家访问或超出设备数，并发送邮件提醒。
+// 首次看到某个用户时只记录地址不提醒，地址记录保存在内存中，按匿名化设置保存处理后的地址
+type ActivityMonitor struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	notifier Notifier
+	users    UserGetter
+	geo      GeoLookup
+
+	mu        sync.Mutex
+	known     map[int64]map[string]*knownAddress
+	lastAlert map[string]time.Time
+}
+
+// NewActivityMonitor 创建异常活动提醒，geo 可以为 nil
+func NewActivityMonitor(log *logger.Logger, settingsMgr *settings.Manager, notifier Notifier, users UserGetter, geo GeoLookup) *ActivityMonitor {
+	return &ActivityMonitor{
+		log:       log,
+		settings:  settingsMgr,
+		notifier:  notifier,
+		users:     users,
+		geo:       geo,
+		known:     make(map[int64]map[string]*knownAddress),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// ObserveAccess 记录一次登录或订阅拉取。配置了 GeoLookup 时来自新国家才提醒，否则来自新 IP 即提醒
+func (m *ActivityMonitor) ObserveAccess(userID int64, ip, kind string) {
+	if !m.enabled() || net.ParseIP(ip) == nil {
+		return
+	}
+
+	country := m.country(ip)
+	now := time.Now()
+	key := privacy.LiveIP(ip)
+	anonymized := privacy.Anonymize(ip)
+
+	m.mu.Lock()
+	addrs, seenUser := m.known[userID]
+	if !seenUser {
+		addrs = make(map[string]*knownAddress)
+		m.known[userID] = addrs
+	}
+
+	newIP, newCountry := true, country != ""
+	for addr, known := range addrs {
+		if now.Sub(known.lastSeen) > knownAddressTTL {
+			delete(addrs, addr)
+			continue
+		}
+		// 超过延迟的地址已被匿名化，和匿名化后的当前地址比较
+		if addr == key || addr == anonymized {
+			newIP = false
+		}
+		if country != "" && known.country == country {
+			newCountry = false
+		}
+	}
+	if key != anonymized {
+		delete(addrs, anonymized)
+	}
+	addrs[key] = &knownAddress{country: country, lastSeen: now}
+	trimKnownAddresses(addrs)
+	m.mu.Unlock()
+
+	unusual := newIP
+	if m.geo != nil && country != "" {
+		unusual = newCountry
+	}
+	if !seenUser || !unusual {
+		return
+	}
+
+	location := ip
+	if country != "" {
+		location = fmt.Sprintf("%s (%s)", ip, country)
+	}
+	action := "登录了面板"
+	if kind == AccessSubscription {
+		action = "拉取了订阅"
+	}
+	m.alert(userID, "new_location", "新位置访问提醒", fmt.Sprintf(`
+			<p>您的账户于 %s 从新的位置 %s %s。</p>
+			<p>如果不是您本人操作，请尽快修改密码并重置订阅。</p>`,
+		m.settings.FormatTime(now), html.EscapeString(location), action))
+}
+
+// ObserveOnline 根据在线客户端的来源 IP 检查设备数是否超过上限
+func (m *ActivityMonitor) ObserveOnline(userID int64, ips []string) {
+	if !m.enabled() {
+		return
+	}
+	maxDevices := m.settings.Get().Notification.MaxDevices
+	if maxDevices <= 0 {
+		return
+	}
+
+	unique := make(map[string]bool)
+	for _, ip := range ips {
+		if net.ParseIP(ip) != nil {
+			unique[ip] = true
+		}
+	}
+	if len(unique) <= maxDevices {
+		return
+	}
+
+	list := make([]string, 0, len(unique))
+	for ip := range unique {
+		list = append(list, html.EscapeString(ip))
+	}
+	sort.Strings(list)
+
+	m.alert(userID, "device_limit", "设备数超限提醒", fmt.Sprintf(`
+			<p>您的账户当前有 %d 个设备同时在线，超过了允许的 %d 个。</p>
+			<p>在线地址：%s</p>
+			<p>如果不是您本人的设备，请尽快修改密码并重置订阅。</p>`,
+		len(unique), maxDevices, strings.Join(list, ", ")))
+}
+
+// enabled 是否开启了异常活动提醒
+func (m *ActivityMonitor) enabled() bool {
+	s := m.settings.Get().Notification
+	return s.EnableEmail && s.ActivityAlerts
+}
+
+// country 查询 IP 所在国家，失败时返回空字符串
+func (m *ActivityMonitor) country(ip string) string {
+	if m.geo == nil {
+		return ""
+	}
+	country, err := m.geo.Country(ip)
+	if err != nil {
+		m.log.DebugWithFields("Geo lookup failed", logger.Fields{
+			"ip":    ip,
+			"error": err,
+		})
+		return ""
+	}
+	return country
+}
+
+// alert 在冷却时间之外异步发送提醒，用户关闭提醒或没有邮箱时跳过
+func (m *ActivityMonitor) alert(userID int64, kind, subject, content string) {
+	cooldown := m.settings.Get().Notification.ActivityCooldown
+	if cooldown <= 0 {
+		cooldown = defaultActivityCooldown
+	}
+
+	key := fmt.Sprintf("%d:%s", userID, kind)
+	m.mu.Lock()
+	if last, ok := m.lastAlert[key]; ok && time.Since(last) < cooldown {
+		m.mu.Unlock()
+		return
+	}
+	m.lastAlert[key] = time.Now()
+	m.mu.Unlock()
+
+	go func() {
+		user, err := m.users.GetUser(userID)
+		if err != nil || user == nil {
+			m.log.WarnWithFields("Failed to get user for activity alert", logger.Fields{
+				"user_id": userID,
+				"error":   err,
+			})
+			return
+		}
+		if user.ActivityOptOut || user.Email == "" {
+			return
+		}
+
+		body := fmt.Sprintf(`
+			<p>%s，您好：</p>%s
+			<p>如需关闭此类提醒，请在个人设置中修改。</p>
+			<p>%s</p>
+		`, html.EscapeString(user.Username), content, html.EscapeString(m.settings.Get().Site.Name))
+
+		if err := m.notifier.Send(&Notification{
+			To:      []string{user.Email},
+			Subject: subject,
+			Body:    body,
+			Type:    "activity_" + kind,
+		}); err != nil {
+			m.log.WarnWithFields("Failed to send activity alert", logger.Fields{
+				"user_id": userID,
+				"type":    kind,
+				"error":   err,
+			})
+		}
+	}()
+}
+
+// AnonymizeBefore 匿名化最后出现时间早于 cutoff 的已知地址，匿名化后相同的地址合并，返回处理的地址数
+func (m *ActivityMonitor) AnonymizeBefore(cutoff time.Time, anonymize func(string) string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, addrs := range m.known {
+		for addr, known := range addrs {
+			if !known.lastSeen.Before(cutoff) {
+				continue
+			}
+			anonymized := anonymize(addr)
+			if anonymized == addr {
+				continue
+			}
+			delete(addrs, addr)
+			if existing, ok := addrs[anonymized]; ok && existing.lastSeen.After(known.lastSeen) {
+				known = existing
+			}
+			addrs[anonymized] = known
+			count++
+		}
+	}
+	return count, nil
+}
+
+// trimKnownAddresses 只保留最近出现的地址
+func trimKnownAddresses(addrs map[string]*knownAddress) {
+	for len(addrs) > maxKnownAddresses {
+		var oldest string
+		for addr, known := range addrs {
+			if oldest == "" || known.lastSeen.Before(addrs[oldest].lastSeen) {
+				oldest = addr
+			}
+		}
+		delete(addrs, oldest)
+	}
+}
@@ -30,15 +30,16 @@ func NewEmailNotifier(host string, port int, username, password, from, fromName
 
 // Send 发送通知
 func (n *EmailNotifier) Send(notification *Notification) error {
-	// 如果没有收件人，则跳过
-	if len(notification.To) == 0 {
+	// 如果没有收件人（包括未验证的用户邮箱被过滤），则跳过
+	to := deliverable(notification)
+	if len(to) == 0 {
 		return nil
 	}
 
 	// 构建邮件头
 	headers := make(map[string]string)
 	headers["From"] = fmt.Sprintf("%s <%s>", n.fromName, n.from)
-	headers["To"] = strings.Join(notification.To, ", ")
+	headers["To"] = strings.Join(to, ", ")
 	headers["Subject"] = notification.Subject
 	headers["MIME-Version"] = "1.0"
 	headers["Content-Type"] = "text/html; charset=UTF-8"
@@ -55,7 +56,7 @@ func (n *EmailNotifier) Send(notification *Notification) error {
 	addr := fmt.Sprintf("%s:%d", n.host, n.port)
 
 	// 发送邮件
-	err := smtp.SendMail(addr, auth, n.from, notification.To, []byte(message))
+	err := smtp.SendMail(addr, auth, n.from, to, []byte(message))
 	if err != nil {
 		return fmt.Errorf("failed to send email: %v", err)
 	}
@@ -0,0 +1,30 @@
+package notification
+
+import "sync"
+
+// SendListener 通知发送前的回调，不论邮件是否配置都会调用。回调同步调用，耗时操作应放到后台
+type SendListener func(n *Notification)
+
+// sendListeners 全局的发送回调，面板中存在多个 Manager 实例，回调注册在包级别以覆盖所有实例
+var sendListeners struct {
+	sync.RWMutex
+	fns []SendListener
+}
+
+// OnSend 注册通知发送前的回调，如把管理员通知记入面板的通知中心
+func OnSend(fn SendListener) {
+	sendListeners.Lock()
+	defer sendListeners.Unlock()
+	sendListeners.fns = append(sendListeners.fns, fn)
+}
+
+// notifySend 通知所有回调
+func notifySend(n *Notification) {
+	sendListeners.RLock()
+	fns := sendListeners.fns
+	sendListeners.RUnlock()
+
+	for _, fn := range fns {
+		fn(n)
+	}
+}
@@ -39,6 +39,9 @@ func New(log *logger.Logger, settings *settings.Manager) Notifier {
 
 // Send sends a notification
 func (m *Manager) Send(notification *Notification) error {
+	// 邮件未开启时同样通知回调，通知不会因此丢失
+	notifySend(notification)
+
 	// Get notification settings
 	s := m.settings.Get()
 	if !s.Notification.EnableEmail {
@@ -50,14 +53,26 @@ func (m *Manager) Send(notification *Notification) error {
 		return fmt.Errorf("SMTP settings are not configured")
 	}
 
+	// 未验证的用户邮箱不接收通知，收件人全部被过滤时跳过
+	to := deliverable(notification)
+	if len(to) == 0 && len(notification.To) > 0 {
+		m.log.DebugWithFields("Notification skipped, no verified recipients", logger.Fields{
+			"type":       notification.Type,
+			"recipients": len(notification.To),
+		})
+		return nil
+	}
+	filtered := *notification
+	filtered.To = to
+
 	// Send email
-	if err := m.sendEmail(notification); err != nil {
+	if err := m.sendEmail(&filtered); err != nil {
 		return fmt.Errorf("failed to send email: %v", err)
 	}
 
 	m.log.Info("Notification sent", logger.Fields{
 		"type":      notification.Type,
-		"to":        notification.To,
+		"to":        filtered.To,
 		"subject":   notification.Subject,
 		"timestamp": time.Now(),
 	})
@@ -139,7 +154,7 @@ func (m *Manager) SendExpirationWarning(userID int64, username string, expireAt
 			<p>Expiration date: %s</p>
 			<p>Please renew your account to continue using our services.</p>
 			<p>Best regards,<br>%s</p>
-		`, username, daysLeft, expireAt.Format("2006-01-02"), m.settings.Get().Site.Name)
+		`, username, daysLeft, expireAt.In(m.settings.Location()).Format("2006-01-02"), m.settings.Get().Site.Name)
 
 		notification := &Notification{
 			To:      []string{username},
@@ -165,7 +180,7 @@ func (m *Manager) SendCertificateExpirationWarning(domain string, expireAt time.
 			<p>Expiration date: %s</p>
 			<p>Please renew the certificate to maintain secure connections.</p>
 			<p>Best regards,<br>%s</p>
-		`, domain, daysLeft, expireAt.Format("2006-01-02"), m.settings.Get().Site.Name)
+		`, domain, daysLeft, expireAt.In(m.settings.Location()).Format("2006-01-02"), m.settings.Get().Site.Name)
 
 		notification := &Notification{
 			To:      []string{m.settings.Get().SSL.Email},
@@ -195,7 +210,7 @@ func (m *Manager) SendBackupNotification(success bool, path string, size int64)
 		<p>Backup size: %.2f GB</p>
 		<p>Timestamp: %s</p>
 		<p>Best regards,<br>%s</p>
-	`, status, path, float64(size)/1024/1024/1024, time.Now().Format("2006-01-02 15:04:05"), m.settings.Get().Site.Name)
+	`, status, path, float64(size)/1024/1024/1024, m.settings.FormatTime(time.Now()), m.settings.Get().Site.Name)
 
 	notification := &Notification{
 		To:      []string{m.settings.Get().SSL.Email},
@@ -0,0 +1,40 @@
+package notification
+
+import "sync"
+
+// TypeEmailVerification 邮箱验证邮件的类型，发往尚未验证的地址，不经过收件人过滤
+const TypeEmailVerification = "email_verification"
+
+// RecipientFilter 判断地址能否接收通知，如属于某个用户但尚未验证时返回 false
+type RecipientFilter func(address string) bool
+
+// recipientFilter 全局的收件人过滤，与发送回调一样注册在包级别以覆盖所有通知实例
+var recipientFilter struct {
+	sync.RWMutex
+	fn RecipientFilter
+}
+
+// SetRecipientFilter 设置发送前对收件人的过滤，nil 表示不过滤
+func SetRecipientFilter(fn RecipientFilter) {
+	recipientFilter.Lock()
+	defer recipientFilter.Unlock()
+	recipientFilter.fn = fn
+}
+
+// deliverable 返回通知中可以接收的收件人，邮箱验证邮件不过滤
+func deliverable(n *Notification) []string {
+	recipientFilter.RLock()
+	fn := recipientFilter.fn
+	recipientFilter.RUnlock()
+
+	if fn == nil || n.Type == TypeEmailVerification {
+		return n.To
+	}
+	to := make([]string, 0, len(n.To))
+	for _, address := range n.To {
+		if fn(address) {
+			to = append(to, address)
+		}
+	}
+	return to
+}
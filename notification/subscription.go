@@ -0,0 +1,310 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+)
+
+const (
+	// defaultWebhookTimeout 未配置时单个 webhook 请求的超时
+	defaultWebhookTimeout = 10 * time.Second
+	// defaultWebhookConcurrency 未配置时同时推送的 webhook 数
+	defaultWebhookConcurrency = 8
+	// SubscriptionUpdatedEvent 订阅更新通知的事件名
+	SubscriptionUpdatedEvent = "subscription.updated"
+	// webhookAttempts 单个 webhook 最多推送的次数，包括第一次
+	webhookAttempts = 3
+)
+
+// webhookRetryDelay 第一次重试前的等待时间，之后每次翻倍
+var webhookRetryDelay = 2 * time.Second
+
+// errWebhookAddress webhook 地址指向本机或内网
+var errWebhookAddress = errors.New("webhook address is not a public address")
+
+// webhookStatusError webhook 返回的非 2xx 状态码
+type webhookStatusError int
+
+func (e webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook returned status %d", int(e))
+}
+
+// retryableWebhookError 网络错误、5xx 和 429 可以重试；地址被拒绝和其他 4xx 重试也不会成功
+func retryableWebhookError(err error) bool {
+	if errors.Is(err, errWebhookAddress) {
+		return false
+	}
+	var status webhookStatusError
+	if errors.As(err, &status) {
+		return status >= 500 || status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// SubscriptionStore 读写用户订阅
+type SubscriptionStore interface {
+	ListSubscriptions() ([]*model.Subscription, error)
+	SaveSubscription(sub *model.Subscription) error
+	UpdateSubscriptionNotifyStatus(userID int64, notifiedAt *time.Time, notifyError string) error
+}
+
+// SubscriptionEvent 推送给客户端 webhook 的内容
+type SubscriptionEvent struct {
+	Event          string    `json:"event"`
+	UserID         int64     `json:"user_id"`
+	Token          string    `json:"token"`
+	ProfileVersion int64     `json:"profile_version"`
+	Reason         string    `json:"reason,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// RefreshResult 一次批量刷新的结果，Queued 为排队推送 webhook 的订阅数
+type RefreshResult struct {
+	Bumped int `json:"bumped"`
+	Queued int `json:"queued"`
+	Failed int `json:"failed"`
+}
+
+// SubscriptionNotifier 在节点地址或凭据变化时递增订阅版本号，通知客户端注册的 webhook 立即重新拉取，
+// 并请求清除 CDN 中的订阅缓存
+type SubscriptionNotifier struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	store    SubscriptionStore
+	client   *http.Client
+	// webhookClient 推送用户注册的 webhook，只允许连接公网地址
+	webhookClient *http.Client
+}
+
+// NewSubscriptionNotifier 创建订阅更新通知
+func NewSubscriptionNotifier(log *logger.Logger, settingsMgr *settings.Manager, store SubscriptionStore) *SubscriptionNotifier {
+	return &SubscriptionNotifier{
+		log:      log,
+		settings: settingsMgr,
+		store:    store,
+		client:   &http.Client{},
+		webhookClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{Timeout: defaultWebhookTimeout, Control: publicAddressOnly}).DialContext,
+			},
+		},
+	}
+}
+
+// Watch 节点地址或分流方案变化后刷新全部订阅，让客户端重新拉取
+func (n *SubscriptionNotifier) Watch() {
+	n.settings.OnChange(func(prev, next *settings.Settings, actor string) {
+		var reason string
+		switch {
+		case !slices.Equal(prev.Nodes.Peers, next.Nodes.Peers):
+			reason = "nodes_changed"
+		case !reflect.DeepEqual(prev.Routing, next.Routing):
+			reason = "routing_changed"
+		default:
+			return
+		}
+		// 回调持有设置写锁，刷新放到后台
+		go func() {
+			if _, err := n.Refresh(nil, reason); err != nil {
+				n.log.WarnWithFields("Failed to refresh subscriptions after settings change", logger.Fields{
+					"reason": reason,
+					"error":  err.Error(),
+				})
+			}
+		}()
+	})
+}
+
+// Refresh 递增指定用户订阅的版本号，userIDs 为空时刷新全部订阅。
+// 版本号同步写入，webhook 在后台推送，推送结果记录在订阅上
+func (n *SubscriptionNotifier) Refresh(userIDs []int64, reason string) (*RefreshResult, error) {
+	subs, err := n.store.ListSubscriptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %v", err)
+	}
+
+	selected := make(map[int64]bool, len(userIDs))
+	for _, id := range userIDs {
+		selected[id] = true
+	}
+
+	cfg := n.settings.Get().Subscription
+	result := &RefreshResult{}
+	var pending []*model.Subscription
+	var bumped []int64
+	for _, sub := range subs {
+		if len(selected) > 0 && !selected[sub.UserID] {
+			continue
+		}
+		sub.ProfileVersion++
+		if err := n.store.SaveSubscription(sub); err != nil {
+			result.Failed++
+			n.log.ErrorWithFields("Failed to bump subscription version", logger.Fields{
+				"user_id": sub.UserID,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		result.Bumped++
+		bumped = append(bumped, sub.UserID)
+		if cfg.WebhookEnable && sub.WebhookURL != "" {
+			pending = append(pending, sub)
+		}
+	}
+
+	result.Queued = len(pending)
+	if len(pending) > 0 {
+		go n.push(pending, reason)
+	}
+	// 版本号变化后旧内容不能再由 CDN 返回
+	if cfg.CachePurgeURL != "" && len(bumped) > 0 {
+		go n.purgeCache(bumped, reason)
+	}
+
+	n.log.WithFields("Subscriptions refreshed", logger.Fields{
+		"bumped": result.Bumped,
+		"queued": result.Queued,
+		"failed": result.Failed,
+		"reason": reason,
+	})
+	return result, nil
+}
+
+// push 并行推送 webhook，并发数和单个请求超时来自设置
+func (n *SubscriptionNotifier) push(subs []*model.Subscription, reason string) {
+	cfg := n.settings.Get().Subscription
+	concurrency := cfg.WebhookConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultWebhookConcurrency
+	}
+	timeout := cfg.WebhookTimeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(sub *model.Subscription) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			n.notify(sub, reason, timeout)
+		}(sub)
+	}
+	wg.Wait()
+}
+
+// notify 推送单个 webhook 并记录结果，可重试的失败按指数退避重试，每次重新签名。
+// 只更新推送结果，推送期间订阅可能已被修改
+func (n *SubscriptionNotifier) notify(sub *model.Subscription, reason string, timeout time.Duration) {
+	var notifiedAt *time.Time
+	notifyError := ""
+	err := n.send(sub, reason, timeout)
+	delay := webhookRetryDelay
+	for attempt := 1; attempt < webhookAttempts && err != nil && retryableWebhookError(err); attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = n.send(sub, reason, timeout)
+	}
+	if err != nil {
+		notifyError = err.Error()
+		n.log.WarnWithFields("Failed to notify subscription webhook", logger.Fields{
+			"user_id": sub.UserID,
+			"error":   err.Error(),
+		})
+	} else {
+		now := time.Now()
+		notifiedAt = &now
+	}
+
+	if err := n.store.UpdateSubscriptionNotifyStatus(sub.UserID, notifiedAt, notifyError); err != nil {
+		n.log.ErrorWithFields("Failed to save subscription notify status", logger.Fields{
+			"user_id": sub.UserID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// send 发送通知请求。配置了密钥时签名为 hex(HMAC-SHA256(secret, timestamp + "." + body))
+func (n *SubscriptionNotifier) send(sub *model.Subscription, reason string, timeout time.Duration) error {
+	now := time.Now()
+	body, err := json.Marshal(&SubscriptionEvent{
+		Event:          SubscriptionUpdatedEvent,
+		UserID:         sub.UserID,
+		Token:          sub.Token,
+		ProfileVersion: sub.ProfileVersion,
+		Reason:         reason,
+		Timestamp:      now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Subscription-Event", SubscriptionUpdatedEvent)
+	req.Header.Set("X-Subscription-Timestamp", timestamp)
+	if sub.WebhookSecret != "" {
+		req.Header.Set("X-Subscription-Signature", "sha256="+SignSubscriptionEvent(sub.WebhookSecret, timestamp, body))
+	}
+
+	client := *n.webhookClient
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return webhookStatusError(resp.StatusCode)
+	}
+	return nil
+}
+
+// publicAddressOnly 拒绝连接回环、内网、链路本地等地址，在解析域名之后检查，域名指向内网时同样拒绝
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+// SignSubscriptionEvent 计算 webhook 请求签名的十六进制值
+func SignSubscriptionEvent(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
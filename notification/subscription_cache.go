@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// SubscriptionPurgeEvent CDN 缓存清除请求的事件名
+const SubscriptionPurgeEvent = "subscription.purge"
+
+// SubscriptionPurge 订阅变化时发送到缓存清除地址的内容，Keys 与订阅响应的 Cache-Tag 和 Surrogate-Key 头相同
+type SubscriptionPurge struct {
+	Event     string    `json:"event"`
+	Keys      []string  `json:"keys"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SubscriptionCacheKey 返回用户订阅在 CDN 中的缓存键
+func SubscriptionCacheKey(userID int64) string {
+	return "sub-" + strconv.FormatInt(userID, 10)
+}
+
+// purgeCache 请求清除 CDN 中的订阅缓存。配置了签名密钥时签名方式与 webhook 相同，
+// 密钥为从签名密钥派生的清除请求专用密钥，不能用来伪造订阅地址签名
+func (n *SubscriptionNotifier) purgeCache(userIDs []int64, reason string) {
+	cfg := n.settings.Get().Subscription
+	if cfg.CachePurgeURL == "" || len(userIDs) == 0 {
+		return
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = SubscriptionCacheKey(id)
+	}
+	var secret string
+	if cfg.SigningKey != "" {
+		secret = settings.DeriveSubscriptionKey(cfg.SigningKey, settings.SubscriptionKeyWebhook)
+	}
+	if err := n.sendPurge(cfg.CachePurgeURL, secret, keys, reason, cfg.WebhookTimeout); err != nil {
+		n.log.WarnWithFields("Failed to purge subscription cache", logger.Fields{
+			"keys":  len(keys),
+			"error": err.Error(),
+		})
+		return
+	}
+	n.log.WithFields("Subscription cache purged", logger.Fields{
+		"keys":   len(keys),
+		"reason": reason,
+	})
+}
+
+// sendPurge 发送缓存清除请求
+func (n *SubscriptionNotifier) sendPurge(url, secret string, keys []string, reason string, timeout time.Duration) error {
+	now := time.Now()
+	body, err := json.Marshal(&SubscriptionPurge{
+		Event:     SubscriptionPurgeEvent,
+		Keys:      keys,
+		Reason:    reason,
+		Timestamp: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal purge payload: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create purge request: %v", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Subscription-Event", SubscriptionPurgeEvent)
+	req.Header.Set("X-Subscription-Timestamp", timestamp)
+	if secret != "" {
+		req.Header.Set("X-Subscription-Signature", "sha256="+SignSubscriptionEvent(secret, timestamp, body))
+	}
+
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	client := *n.client
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("purge request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("purge endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
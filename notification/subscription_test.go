@@ -0,0 +1,157 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"v/logger"
+	"v/model"
+)
+
+func TestSignSubscriptionEvent(t *testing.T) {
+	body := []byte(`{"event":"updated"}`)
+	reference := SignSubscriptionEvent("secret", "1700000000", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		want      string
+	}{
+		// 标准 HMAC-SHA256 独立计算的结果，客户端按文档实现的校验应得到相同的值
+		{name: "known vector", secret: "secret", timestamp: "1700000000", body: body, want: "7ff92a1849400d4757708d2ac50ef492014189e7462ebd0bd10e33c237c4141e"},
+		{name: "empty secret and body", secret: "", timestamp: "1700000000", body: nil, want: "c1da1b6c6b8e9da7f4bbb90f7cab0820f271ad19ccbf80c88479c4e14f37d1c6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignSubscriptionEvent(tt.secret, tt.timestamp, tt.body); got != tt.want {
+				t.Errorf("SignSubscriptionEvent = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	changed := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+	}{
+		{name: "different secret", secret: "other", timestamp: "1700000000", body: body},
+		{name: "different timestamp", secret: "secret", timestamp: "1700000001", body: body},
+		{name: "different body", secret: "secret", timestamp: "1700000000", body: []byte(`{"event":"deleted"}`)},
+		// 分隔符使时间戳和请求体的边界固定，挪动字节不会得到相同的签名
+		{name: "shifted boundary", secret: "secret", timestamp: "17", body: []byte(`00000000.{"event":"updated"}`)},
+	}
+	for _, tt := range changed {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignSubscriptionEvent(tt.secret, tt.timestamp, tt.body); got == reference {
+				t.Errorf("signature unchanged: %s", got)
+			}
+		})
+	}
+}
+
+// notifyStore 记录推送结果，其余方法不会被调用
+type notifyStore struct {
+	SubscriptionStore
+	mu         sync.Mutex
+	notifiedAt *time.Time
+	notifyErr  string
+}
+
+func (s *notifyStore) UpdateSubscriptionNotifyStatus(userID int64, notifiedAt *time.Time, notifyError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifiedAt, s.notifyErr = notifiedAt, notifyError
+	return nil
+}
+
+func TestSubscriptionWebhookDelivery(t *testing.T) {
+	previous := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = previous })
+
+	tests := []struct {
+		name         string
+		statuses     []int // 每次请求返回的状态码，最后一个用于之后的所有请求
+		wantRequests int
+		wantError    string
+	}{
+		{name: "delivered", statuses: []int{http.StatusNoContent}, wantRequests: 1},
+		{name: "retried after server error", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, wantRequests: 2},
+		{name: "gives up after all attempts", statuses: []int{http.StatusBadGateway}, wantRequests: webhookAttempts, wantError: "webhook returned status 502"},
+		{name: "client error is not retried", statuses: []int{http.StatusGone}, wantRequests: 1, wantError: "webhook returned status 410"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				timestamp := r.Header.Get("X-Subscription-Timestamp")
+				if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+					t.Errorf("X-Subscription-Timestamp = %q, want unix seconds", timestamp)
+				}
+				// 接收方按文档用密钥、时间戳和原始请求体重新计算签名
+				want := "sha256=" + SignSubscriptionEvent("webhook-secret", timestamp, body)
+				if got := r.Header.Get("X-Subscription-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+					t.Errorf("X-Subscription-Signature = %q, want %q", got, want)
+				}
+				var event SubscriptionEvent
+				if err := json.Unmarshal(body, &event); err != nil || event.Event != SubscriptionUpdatedEvent || event.UserID != 42 || event.ProfileVersion != 3 {
+					t.Errorf("payload = %s, %v", body, err)
+				}
+
+				mu.Lock()
+				status := tt.statuses[min(requests, len(tt.statuses)-1)]
+				requests++
+				mu.Unlock()
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			store := &notifyStore{}
+			n := NewSubscriptionNotifier(logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR}), nil, store)
+			// 测试服务器监听在本机，替换只允许公网地址的客户端
+			n.webhookClient = srv.Client()
+
+			sub := &model.Subscription{UserID: 42, Token: "token", WebhookURL: srv.URL, WebhookSecret: "webhook-secret", ProfileVersion: 3}
+			n.notify(sub, "nodes_changed", time.Second)
+
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+			if store.notifyErr != tt.wantError {
+				t.Errorf("notify error = %q, want %q", store.notifyErr, tt.wantError)
+			}
+			if (store.notifiedAt != nil) != (tt.wantError == "") {
+				t.Errorf("notified at = %v, want it set only on success", store.notifiedAt)
+			}
+		})
+	}
+}
+
+func TestSubscriptionWebhookRejectsLocalAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook to a loopback address was delivered")
+	}))
+	defer srv.Close()
+
+	store := &notifyStore{}
+	n := NewSubscriptionNotifier(logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR}), nil, store)
+	n.notify(&model.Subscription{UserID: 42, WebhookURL: srv.URL}, "nodes_changed", time.Second)
+
+	if store.notifiedAt != nil || !strings.Contains(store.notifyErr, errWebhookAddress.Error()) {
+		t.Errorf("notify status = %v, %q; want %q", store.notifiedAt, store.notifyErr, errWebhookAddress)
+	}
+}
@@ -0,0 +1,267 @@
+package preferences
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"v/logger"
+)
+
+// 偏好设置的数量和大小限制
+const (
+	maxKeys        = 64
+	maxValueSize   = 16 << 10
+	maxTotalSize   = 64 << 10
+	minPageSize    = 1
+	maxPageSize    = 500
+	maxLanguageLen = 35
+)
+
+// 已知的偏好设置项，其余键按任意 JSON 值保存
+const (
+	KeyPageSize        = "page_size"        // 列表默认每页条数
+	KeyTheme           = "theme"            // 界面主题：light、dark、auto
+	KeyLanguage        = "language"         // 界面语言，如 zh-CN、en
+	KeyDashboardLayout = "dashboard_layout" // 仪表盘组件布局，由前端定义格式
+)
+
+// Themes 支持的界面主题
+var Themes = []string{"light", "dark", "auto"}
+
+var (
+	keyPattern      = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+	languagePattern = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+)
+
+// Preferences 单个面板账号的偏好设置
+type Preferences map[string]json.RawMessage
+
+// Store 按面板账号保存界面偏好设置，数据保存在一个 JSON 文件中
+type Store struct {
+	log  *logger.Logger
+	path string
+
+	mu    sync.Mutex
+	users map[int64]Preferences
+}
+
+// New 创建偏好设置存储并加载已保存的数据
+func New(log *logger.Logger, path string) *Store {
+	s := &Store{
+		log:   log,
+		path:  path,
+		users: make(map[int64]Preferences),
+	}
+	s.load()
+	return s
+}
+
+// Get 返回账号的偏好设置，未设置时返回空集合
+func (s *Store) Get(userID int64) Preferences {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyPreferences(s.users[userID])
+}
+
+// Update 合并写入账号的偏好设置，值为 null 的键会被删除，返回更新后的完整设置
+func (s *Store) Update(userID int64, patch Preferences) (Preferences, error) {
+	for key, value := range patch {
+		if isNull(value) {
+			continue
+		}
+		if err := validate(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := copyPreferences(s.users[userID])
+	for key, value := range patch {
+		if isNull(value) {
+			delete(next, key)
+			continue
+		}
+		next[key] = compact(value)
+	}
+
+	if len(next) > maxKeys {
+		return nil, fmt.Errorf("too many preferences, at most %d keys are allowed", maxKeys)
+	}
+	size := 0
+	for key, value := range next {
+		size += len(key) + len(value)
+	}
+	if size > maxTotalSize {
+		return nil, fmt.Errorf("preferences too large, at most %d bytes are allowed", maxTotalSize)
+	}
+
+	prev, existed := s.users[userID]
+	if len(next) == 0 {
+		delete(s.users, userID)
+	} else {
+		s.users[userID] = next
+	}
+	if err := s.save(); err != nil {
+		if existed {
+			s.users[userID] = prev
+		} else {
+			delete(s.users, userID)
+		}
+		return nil, err
+	}
+	return copyPreferences(next), nil
+}
+
+// Delete 删除账号的全部偏好设置，用于删除账号时清理
+func (s *Store) Delete(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return nil
+	}
+	delete(s.users, userID)
+	return s.save()
+}
+
+// validate 检查键名、值大小和已知设置项的取值
+func validate(key string, value json.RawMessage) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid preference key %q", key)
+	}
+	if len(value) > maxValueSize {
+		return fmt.Errorf("preference %q is too large, at most %d bytes are allowed", key, maxValueSize)
+	}
+	if !json.Valid(value) {
+		return fmt.Errorf("preference %q is not valid JSON", key)
+	}
+
+	switch key {
+	case KeyPageSize:
+		n, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+		if err != nil || n < minPageSize || n > maxPageSize {
+			return fmt.Errorf("%s must be an integer between %d and %d", key, minPageSize, maxPageSize)
+		}
+	case KeyTheme:
+		var theme string
+		if err := json.Unmarshal(value, &theme); err != nil || !contains(Themes, theme) {
+			return fmt.Errorf("%s must be one of %v", key, Themes)
+		}
+	case KeyLanguage:
+		var lang string
+		if err := json.Unmarshal(value, &lang); err != nil || len(lang) > maxLanguageLen || !languagePattern.MatchString(lang) {
+			return fmt.Errorf("%s must be a language tag such as zh-CN or en", key)
+		}
+	case KeyDashboardLayout:
+		var layout interface{}
+		json.Unmarshal(value, &layout)
+		switch layout.(type) {
+		case []interface{}, map[string]interface{}:
+		default:
+			return fmt.Errorf("%s must be a JSON array or object", key)
+		}
+	}
+	return nil
+}
+
+// load 从文件加载偏好设置，文件不存在时为空
+func (s *Store) load() {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.log.WarnWithFields("Failed to read preferences", logger.Fields{
+				"path":  s.path,
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	var stored map[string]Preferences
+	if err := json.Unmarshal(data, &stored); err != nil {
+		s.log.WarnWithFields("Failed to parse preferences", logger.Fields{
+			"path":  s.path,
+			"error": err.Error(),
+		})
+		return
+	}
+	for id, prefs := range stored {
+		userID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || len(prefs) == 0 {
+			continue
+		}
+		s.users[userID] = prefs
+	}
+}
+
+// save 写入临时文件后替换，避免写入中断导致文件损坏
+func (s *Store) save() error {
+	stored := make(map[string]Preferences, len(s.users))
+	ids := make([]int64, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		stored[strconv.FormatInt(id, 10)] = s.users[id]
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal preferences: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create preferences directory: %v", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write preferences: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace preferences: %v", err)
+	}
+	return nil
+}
+
+// copyPreferences 复制偏好设置，避免调用方修改内部数据
+func copyPreferences(prefs Preferences) Preferences {
+	c := make(Preferences, len(prefs))
+	for key, value := range prefs {
+		c[key] = append(json.RawMessage(nil), value...)
+	}
+	return c
+}
+
+// compact 去掉值中多余的空白
+func compact(value json.RawMessage) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return append(json.RawMessage(nil), value...)
+	}
+	return buf.Bytes()
+}
+
+// isNull 判断值是否为 JSON null
+func isNull(value json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(value)
+	return len(trimmed) == 0 || string(trimmed) == "null"
+}
+
+// contains 判断列表是否包含 s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package privacy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+)
+
+// LogFiles 应用日志轮转后的备份文件。正在写入的日志文件不处理，轮转后最后修改时间早于
+// 截止时间的备份整体处理，已处理的文件按路径和修改时间记住，不会重复读取
+type LogFiles struct {
+	path    string
+	pattern *regexp.Regexp
+
+	mu   sync.Mutex
+	done map[string]time.Time
+}
+
+// NewLogFiles 创建日志备份处理，path 为正在写入的日志文件路径
+func NewLogFiles(path string) *LogFiles {
+	names := logger.IPFieldNames()
+	for i, name := range names {
+		names[i] = regexp.QuoteMeta(name)
+	}
+	return &LogFiles{
+		path:    path,
+		pattern: regexp.MustCompile(`\b(` + strings.Join(names, "|") + `)=(\S+)`),
+		done:    make(map[string]time.Time),
+	}
+}
+
+// AnonymizeBefore 实现 Target，返回处理的文件数
+func (f *LogFiles) AnonymizeBefore(cutoff time.Time, anonymize func(string) string) (int, error) {
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(f.path, ext)
+	matches, err := filepath.Glob(prefix + "-*" + ext)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+	seen := make(map[string]bool, len(matches))
+	for _, path := range matches {
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if done, ok := f.done[path]; ok && done.Equal(info.ModTime()) {
+			continue
+		}
+		if err := f.rewrite(path, info, anonymize); err != nil {
+			return count, fmt.Errorf("%s: %v", path, err)
+		}
+		f.done[path] = info.ModTime()
+		count++
+	}
+
+	// 忘记已被轮转清理的文件
+	for path := range f.done {
+		if !seen[path] {
+			delete(f.done, path)
+		}
+	}
+	return count, nil
+}
+
+// rewrite 替换文件中的客户端 IP 字段，保留原修改时间，使轮转清理仍按原时间计算
+func (f *LogFiles) rewrite(path string, info os.FileInfo, anonymize func(string) string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	replaced := f.pattern.ReplaceAllStringFunc(string(data), func(match string) string {
+		parts := f.pattern.FindStringSubmatch(match)
+		return parts[1] + "=" + anonymize(parts[2])
+	})
+	if replaced == string(data) {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(replaced), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Chtimes(path, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,106 @@
+// Package privacy 按设置匿名化日志、登录和访问记录、在线客户端记录中的客户端 IP。
+// 未设置延迟时写入前即匿名化；设置了延迟时先保留完整 IP，由 Sweeper 定期处理超过延迟的记录
+package privacy
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+const (
+	defaultIPv4Prefix = 24
+	defaultIPv6Prefix = 48
+	// hashPrefix 哈希后的地址前缀，便于和真实地址区分
+	hashPrefix = "anon-"
+	// hashLength 哈希后的地址保留的十六进制长度
+	hashLength = 16
+)
+
+// policy 当前生效的设置，未初始化时不做任何处理
+var policy atomic.Pointer[settings.Manager]
+
+// Init 使用设置管理器初始化匿名化策略，并让日志写入前按策略处理客户端 IP 字段
+func Init(settingsMgr *settings.Manager) {
+	policy.Store(settingsMgr)
+	logger.SetIPFilter(LiveIP)
+}
+
+// current 返回当前的匿名化设置，未初始化或未开启时返回 false
+func current() (settings.PrivacySettings, bool) {
+	mgr := policy.Load()
+	if mgr == nil {
+		return settings.PrivacySettings{}, false
+	}
+	s := mgr.Get().Privacy
+	return s, s.AnonymizeIPs
+}
+
+// LiveIP 处理即将写入的客户端 IP：开启了匿名化且没有设置延迟时返回匿名化后的地址，否则原样返回
+func LiveIP(ip string) string {
+	s, ok := current()
+	if !ok || s.Delay > 0 {
+		return ip
+	}
+	return anonymize(s, ip)
+}
+
+// Anonymize 按当前设置匿名化客户端 IP，不论是否设置了延迟。未开启匿名化时原样返回
+func Anonymize(ip string) string {
+	s, ok := current()
+	if !ok {
+		return ip
+	}
+	return anonymize(s, ip)
+}
+
+// Cutoff 返回需要匿名化的记录的时间上限，早于该时间的记录应当匿名化。
+// 未开启匿名化或未设置延迟（写入时已匿名化）时返回 false
+func Cutoff(now time.Time) (time.Time, bool) {
+	s, ok := current()
+	if !ok || s.Delay <= 0 {
+		return time.Time{}, false
+	}
+	return now.Add(-s.Delay), true
+}
+
+// anonymize 按设置截断或哈希 IP，带端口的地址只保留处理后的 IP。
+// 不是 IP 的值（包括已经哈希过的地址）原样返回，因此重复处理结果不变
+func anonymize(s settings.PrivacySettings, value string) string {
+	host := value
+	if h, _, err := net.SplitHostPort(value); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip == nil {
+		return value
+	}
+
+	if s.Mode == settings.PrivacyModeHash {
+		if sum := settings.KeyedHash("privacy-ip", ip.String()); sum != "" {
+			return hashPrefix + sum[:hashLength]
+		}
+		// 密钥未加载时退回到截断，避免写入完整地址
+	}
+	return truncate(s, ip)
+}
+
+// truncate 只保留 IP 的网段部分
+func truncate(s settings.PrivacySettings, ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		bits := s.IPv4Prefix
+		if bits <= 0 {
+			bits = defaultIPv4Prefix
+		}
+		return v4.Mask(net.CIDRMask(bits, 32)).String()
+	}
+	bits := s.IPv6Prefix
+	if bits <= 0 {
+		bits = defaultIPv6Prefix
+	}
+	return ip.Mask(net.CIDRMask(bits, 128)).String()
+}
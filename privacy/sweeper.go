@@ -0,0 +1,109 @@
+package privacy
+
+import (
+	"sync"
+	"time"
+
+	"v/logger"
+)
+
+// sweepInterval 检查超过延迟的记录的间隔
+const sweepInterval = time.Hour
+
+// Target 保存客户端 IP 的记录，AnonymizeBefore 用 anonymize 处理早于 cutoff 的记录中的 IP，
+// 返回处理的记录数。实现需要能重复处理同一批记录
+type Target interface {
+	AnonymizeBefore(cutoff time.Time, anonymize func(string) string) (int, error)
+}
+
+// Sweeper 定期匿名化超过延迟的记录。各实例的日志和内存记录互不共享，因此每个实例都需要运行
+type Sweeper struct {
+	log *logger.Logger
+
+	mu      sync.Mutex
+	names   []string
+	targets map[string]Target
+	stopCh  chan struct{}
+}
+
+// NewSweeper 创建匿名化任务
+func NewSweeper(log *logger.Logger) *Sweeper {
+	return &Sweeper{
+		log:     log,
+		targets: make(map[string]Target),
+	}
+}
+
+// Add 添加需要处理的记录，name 用于日志
+func (s *Sweeper) Add(name string, target Target) {
+	if target == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.targets[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.targets[name] = target
+}
+
+// Start 启动定期处理
+func (s *Sweeper) Start() {
+	s.stopCh = make(chan struct{})
+	go s.run(s.stopCh)
+}
+
+// Stop 停止定期处理
+func (s *Sweeper) Stop() {
+	if s.stopCh != nil {
+		close(s.stopCh)
+		s.stopCh = nil
+	}
+}
+
+// run 处理循环，启动时立即处理一次
+func (s *Sweeper) run(stopCh chan struct{}) {
+	for {
+		s.Sweep(time.Now())
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(sweepInterval):
+		}
+	}
+}
+
+// Sweep 立即处理早于 now 减去延迟的记录，未开启匿名化或未设置延迟时不做任何事
+func (s *Sweeper) Sweep(now time.Time) {
+	cutoff, ok := Cutoff(now)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	names := append([]string(nil), s.names...)
+	targets := make(map[string]Target, len(s.targets))
+	for name, target := range s.targets {
+		targets[name] = target
+	}
+	s.mu.Unlock()
+
+	for _, name := range names {
+		n, err := targets[name].AnonymizeBefore(cutoff, Anonymize)
+		if err != nil {
+			s.log.WarnWithFields("Failed to anonymize client IPs", logger.Fields{
+				"target": name,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		if n > 0 {
+			s.log.DebugWithFields("Anonymized client IPs", logger.Fields{
+				"target":  name,
+				"records": n,
+				"cutoff":  cutoff.Format(time.RFC3339),
+			})
+		}
+	}
+}
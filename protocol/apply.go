@@ -0,0 +1,270 @@
+package protocol
+
+import (
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// 配置变更的应用状态
+const (
+	ApplyQueued   = "queued"   // 等待合并后应用
+	ApplyApplying = "applying" // 正在重新生成并加载配置
+	ApplyApplied  = "applied"
+	ApplyFailed   = "failed"
+)
+
+const (
+	// defaultApplyDelay 未设置 Xray.ApplyDelay 时的合并等待时间
+	defaultApplyDelay = 2 * time.Second
+	// applyMaxWaitFactor 持续有修改时最多推迟到第一次修改后 delay 的该倍数，避免一直不应用
+	applyMaxWaitFactor = 5
+	// applyHistorySize 保留的最近变更数，用于查询变更状态
+	applyHistorySize = 200
+)
+
+// ApplyChange 一次配置变更的应用状态，合并到同一次应用的变更 Batch 相同
+type ApplyChange struct {
+	ID        int64      `json:"id"`
+	Reason    string     `json:"reason"`
+	Status    string     `json:"status"`
+	Batch     int64      `json:"batch,omitempty"`
+	QueuedAt  time.Time  `json:"queued_at"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ApplyQueueStatus 应用队列状态
+type ApplyQueueStatus struct {
+	Pending     int            `json:"pending"`
+	Applying    bool           `json:"applying"`
+	NextApplyAt *time.Time     `json:"next_apply_at,omitempty"`
+	Recent      []*ApplyChange `json:"recent"` // 最近的变更，新的在前
+}
+
+// ApplyQueue 合并短时间内的多次协议修改，在最后一次修改后等待 Xray.ApplyDelay 再统一重新生成配置，
+// 应用过程串行执行，应用期间的修改进入下一批
+type ApplyQueue struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	apply    func() error
+
+	runMu sync.Mutex // 串行化应用
+
+	mu        sync.Mutex
+	nextID    int64
+	nextBatch int64
+	pending   []*ApplyChange
+	first     time.Time // 当前批次第一次修改的时间
+	timer     *time.Timer
+	deadline  time.Time
+	applying  bool
+	history   []*ApplyChange
+}
+
+// NewApplyQueue 创建配置应用队列，apply 重新生成并加载 Xray 配置
+func NewApplyQueue(log *logger.Logger, settingsMgr *settings.Manager, apply func() error) *ApplyQueue {
+	return &ApplyQueue{
+		log:      log,
+		settings: settingsMgr,
+		apply:    apply,
+	}
+}
+
+// Enqueue 登记一次配置变更并返回其当前状态
+func (q *ApplyQueue) Enqueue(reason string) *ApplyChange {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	q.nextID++
+	change := &ApplyChange{
+		ID:       q.nextID,
+		Reason:   reason,
+		Status:   ApplyQueued,
+		QueuedAt: now,
+	}
+	if len(q.pending) == 0 {
+		q.first = now
+	}
+	q.pending = append(q.pending, change)
+	q.history = append(q.history, change)
+	if len(q.history) > applyHistorySize {
+		q.history = q.history[len(q.history)-applyHistorySize:]
+	}
+
+	delay := q.delay()
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	if delay <= 0 {
+		q.deadline = now
+		go q.run()
+	} else {
+		at := now.Add(delay)
+		if limit := q.first.Add(delay * applyMaxWaitFactor); at.After(limit) {
+			at = limit
+		}
+		q.deadline = at
+		q.timer = time.AfterFunc(at.Sub(now), q.run)
+	}
+
+	copied := *change
+	return &copied
+}
+
+// Flush 立即应用等待中的变更，例如退出前调用
+func (q *ApplyQueue) Flush() {
+	q.mu.Lock()
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	q.mu.Unlock()
+	q.run()
+}
+
+// Get 查询变更状态，变更过旧已被清理时返回 false
+func (q *ApplyQueue) Get(id int64) (*ApplyChange, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, change := range q.history {
+		if change.ID == id {
+			copied := *change
+			return &copied, true
+		}
+	}
+	return nil, false
+}
+
+// Status 返回队列状态
+func (q *ApplyQueue) Status() *ApplyQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := &ApplyQueueStatus{
+		Pending:  len(q.pending),
+		Applying: q.applying,
+		Recent:   make([]*ApplyChange, 0, len(q.history)),
+	}
+	if len(q.pending) > 0 {
+		deadline := q.deadline
+		status.NextApplyAt = &deadline
+	}
+	for i := len(q.history) - 1; i >= 0; i-- {
+		copied := *q.history[i]
+		status.Recent = append(status.Recent, &copied)
+	}
+	return status
+}
+
+// delay 返回合并等待时间
+func (q *ApplyQueue) delay() time.Duration {
+	if q.settings == nil {
+		return defaultApplyDelay
+	}
+	delay := q.settings.Get().Xray.ApplyDelay
+	if delay == 0 {
+		return defaultApplyDelay
+	}
+	return delay
+}
+
+// run 取出等待中的变更并应用一次
+func (q *ApplyQueue) run() {
+	q.runMu.Lock()
+	defer q.runMu.Unlock()
+
+	q.mu.Lock()
+	batch := q.pending
+	q.pending = nil
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	if len(batch) == 0 {
+		q.mu.Unlock()
+		return
+	}
+	q.nextBatch++
+	batchID := q.nextBatch
+	for _, change := range batch {
+		change.Status = ApplyApplying
+		change.Batch = batchID
+	}
+	q.applying = true
+	q.mu.Unlock()
+
+	start := time.Now()
+	err := q.apply()
+
+	q.mu.Lock()
+	now := time.Now()
+	for _, change := range batch {
+		change.AppliedAt = &now
+		if err != nil {
+			change.Status = ApplyFailed
+			change.Error = err.Error()
+		} else {
+			change.Status = ApplyApplied
+		}
+	}
+	q.applying = false
+	q.mu.Unlock()
+
+	if err != nil {
+		q.log.ErrorWithFields("Failed to apply xray config", logger.Fields{
+			"batch":   batchID,
+			"changes": len(batch),
+			"error":   err.Error(),
+		})
+		return
+	}
+	q.log.WithFields("Applied xray config", logger.Fields{
+		"batch":    batchID,
+		"changes":  len(batch),
+		"duration": time.Since(start).String(),
+	})
+}
+
+// SetApplyQueue 设置配置应用队列，设置后协议修改合并后异步应用，未设置时每次修改立即调用同步函数
+func (m *Manager) SetApplyQueue(q *ApplyQueue) {
+	m.applyQueue = q
+}
+
+// RequestApply 协议修改后请求重新生成 Xray 配置，返回变更的应用状态。
+// 没有队列和同步函数时返回 nil
+func (m *Manager) RequestApply(reason string) (*ApplyChange, error) {
+	if m.applyQueue != nil {
+		return m.applyQueue.Enqueue(reason), nil
+	}
+	if m.reconcile == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	if err := m.reconcile(); err != nil {
+		return nil, err
+	}
+	applied := time.Now()
+	return &ApplyChange{Reason: reason, Status: ApplyApplied, QueuedAt: now, AppliedAt: &applied}, nil
+}
+
+// ApplyStatus 返回配置应用队列状态，未使用队列时返回 nil
+func (m *Manager) ApplyStatus() *ApplyQueueStatus {
+	if m.applyQueue == nil {
+		return nil
+	}
+	return m.applyQueue.Status()
+}
+
+// GetApplyChange 查询配置变更的应用状态
+func (m *Manager) GetApplyChange(id int64) (*ApplyChange, bool) {
+	if m.applyQueue == nil {
+		return nil, false
+	}
+	return m.applyQueue.Get(id)
+}
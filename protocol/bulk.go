@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"v/bulk"
+	"v/model"
+)
+
+// BulkPortStart 批量创建时未指定端口的协议从该端口开始分配
+const BulkPortStart = 10000
+
+// MaxBulkProtocols 单次批量创建的协议数量上限
+const MaxBulkProtocols = 500
+
+// PlanProvision 校验批量创建的协议并生成计划：分配端口、检查端口和监听地址冲突、
+// 检查所属用户，并生成将写入 Xray 的入站配置。不保存任何数据，未指定端口的协议会被写入分配的端口
+func (m *Manager) PlanProvision(ctx context.Context, protocols []*model.Protocol, dryRun bool) (*bulk.Plan, error) {
+	plan := bulk.New(dryRun, len(protocols))
+	if len(protocols) > MaxBulkProtocols {
+		plan.Conflict(-1, "protocols", "at most %d protocols can be created at once", MaxBulkProtocols)
+		return plan, nil
+	}
+
+	generator := NewProtocolManager(m.log, m.settings, m.db)
+	users := make(map[int64]bool)
+	reserved := make(map[int]int) // 本次请求中已占用的端口及其序号
+	next := BulkPortStart
+	for i, p := range protocols {
+		if p == nil {
+			plan.Conflict(i, "", "protocol is empty")
+			continue
+		}
+		conflicts := len(plan.Conflicts)
+
+		if _, ok := protocolSpecs[p.Type]; !ok {
+			plan.Conflict(i, "type", "unsupported protocol type %q", p.Type)
+		}
+		if p.UserID <= 0 {
+			plan.Conflict(i, "user_id", "user_id is required")
+		} else if exists, ok := users[p.UserID]; !ok {
+			user, err := m.db.GetUser(p.UserID)
+			if err != nil {
+				return nil, err
+			}
+			users[p.UserID] = user != nil
+			if user == nil {
+				plan.Conflict(i, "user_id", "user %d does not exist", p.UserID)
+			}
+		} else if !exists {
+			plan.Conflict(i, "user_id", "user %d does not exist", p.UserID)
+		}
+
+		p.Listen = NormalizeListen(p.Listen)
+		if err := ValidateListenAddress(p.Listen); err != nil {
+			plan.Conflict(i, "listen", "%v", err)
+		}
+
+		allocated := p.Port == 0
+		if allocated {
+			port, err := m.nextBulkPort(next, reserved)
+			if err != nil {
+				return nil, err
+			}
+			p.Port = port
+			next = port + 1
+			if data, err := setSettingsPort(p.Settings, port); err != nil {
+				plan.Conflict(i, "settings", "%v", err)
+			} else {
+				p.Settings = data
+			}
+		} else if j, ok := reserved[p.Port]; ok {
+			plan.Conflict(i, "port", "port %d is also requested by protocol #%d", p.Port, j)
+		} else if err := m.checkPortFree(p.Port); err != nil {
+			if !errors.Is(err, ErrPortInUse) && !errors.Is(err, ErrInvalidPort) {
+				return nil, err
+			}
+			plan.Conflict(i, "port", "port %d: %v", p.Port, err)
+		}
+		reserved[p.Port] = i
+
+		report := m.Lint(ctx, p, LintOptions{})
+		for _, issue := range report.Errors {
+			plan.Conflict(i, issue.Field, "%s", issue.Message)
+		}
+		if len(plan.Conflicts) > conflicts {
+			continue
+		}
+
+		config, err := generator.GenerateXrayConfig(p)
+		if err != nil {
+			plan.Conflict(i, "settings", "failed to generate xray config: %v", err)
+			continue
+		}
+		plan.Add(&bulk.Change{
+			Index:  i,
+			Action: bulk.ActionCreate,
+			Target: fmt.Sprintf("%s %s:%d", p.Type, p.Name, p.Port),
+			After:  p,
+			Details: map[string]interface{}{
+				"port":           p.Port,
+				"port_allocated": allocated,
+				"inbounds":       config.Inbounds,
+				"warnings":       report.WarningMessages(),
+			},
+		})
+	}
+	return plan, nil
+}
+
+// Provision 批量创建协议。dryRun 为 true 或计划有冲突时只返回计划；
+// 否则按顺序创建，中途失败时返回已创建前的计划和错误，已创建的协议保留
+func (m *Manager) Provision(ctx context.Context, protocols []*model.Protocol, dryRun bool, changedBy string) (*bulk.Plan, error) {
+	plan, err := m.PlanProvision(ctx, protocols, dryRun)
+	if err != nil || dryRun || plan.HasConflicts() {
+		return plan, err
+	}
+
+	for _, c := range plan.Changes {
+		p := protocols[c.Index]
+		if err := m.CreateProtocolAs(p, changedBy); err != nil {
+			return plan, fmt.Errorf("failed to create protocol #%d: %v", c.Index, err)
+		}
+		c.Target = fmt.Sprintf("%s %s:%d (id %d)", p.Type, p.Name, p.Port, p.ID)
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+// nextBulkPort 从 start 开始选择第一个未被协议使用、也未被本次请求占用的端口
+func (m *Manager) nextBulkPort(start int, reserved map[int]int) (int, error) {
+	for port := start; port <= 65535; port++ {
+		if _, ok := reserved[port]; ok {
+			continue
+		}
+		err := m.checkPortFree(port)
+		if err == nil {
+			return port, nil
+		}
+		if !errors.Is(err, ErrPortInUse) {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("no free port after %d", start)
+}
+
+// setSettingsPort 协议配置中带有 port 字段时改为分配的端口
+func setSettingsPort(data []byte, port int) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse protocol settings: %v", err)
+	}
+	if _, ok := settings["port"]; !ok {
+		return data, nil
+	}
+	settings["port"] = port
+	return json.Marshal(settings)
+}
+
+// bulkPageSize 遍历协议时的分页大小
+const bulkPageSize = 200
+
+// UserGroups 返回每个用户的分组，即其协议标签的并集，没有标签的用户分组为空
+func (m *Manager) UserGroups() (map[int64][]string, error) {
+	groups := make(map[int64][]string)
+	seen := make(map[int64]map[string]bool)
+	for page := 1; ; page++ {
+		list, err := m.db.ListProtocols(page, bulkPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			if _, ok := groups[p.UserID]; !ok {
+				groups[p.UserID] = []string{}
+				seen[p.UserID] = make(map[string]bool)
+			}
+			for _, tag := range p.Tags {
+				if !seen[p.UserID][tag] {
+					seen[p.UserID][tag] = true
+					groups[p.UserID] = append(groups[p.UserID], tag)
+				}
+			}
+		}
+		if len(list) < bulkPageSize {
+			break
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,291 @@
+package protocol
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"v/model"
+)
+
+var (
+	// ErrCDNInvalidHost CDN 模式需要域名
+	ErrCDNInvalidHost = errors.New("cdn mode requires a domain name as host")
+	// ErrCDNUnsupportedProtocol 协议不支持 CDN 模式
+	ErrCDNUnsupportedProtocol = errors.New("protocol does not support cdn mode")
+)
+
+// Cloudflare 代理的端口
+var (
+	cloudflareHTTPSPorts = map[int]bool{443: true, 2053: true, 2083: true, 2087: true, 2096: true, 8443: true}
+	cloudflareHTTPPorts  = map[int]bool{80: true, 8080: true, 8880: true, 2052: true, 2082: true, 2086: true, 2095: true}
+)
+
+// cloudflareRanges Cloudflare 公布的 IP 段 https://www.cloudflare.com/ips/
+var cloudflareRanges = mustParseCIDRs(
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+	"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+)
+
+// CDNCheckResult 域名 CDN 检测结果
+type CDNCheckResult struct {
+	Domain        string   `json:"domain"`
+	Proxied       bool     `json:"proxied"` // 解析结果全部为 Cloudflare 地址
+	IPs           []string `json:"ips"`
+	CloudflareIPs []string `json:"cloudflare_ips"`
+	HTTPVerified  bool     `json:"http_verified"` // HTTP 响应来自 Cloudflare
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+// IsCloudflareIP 判断 IP 是否属于 Cloudflare
+func IsCloudflareIP(ip net.IP) bool {
+	for _, n := range cloudflareRanges {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCloudflareDomain 检查域名是否已开启 Cloudflare 代理（橙色云朵）
+func VerifyCloudflareDomain(ctx context.Context, domain string) (*CDNCheckResult, error) {
+	domain = strings.TrimSpace(strings.ToLower(domain))
+	if domain == "" || net.ParseIP(domain) != nil {
+		return nil, ErrCDNInvalidHost
+	}
+
+	result := &CDNCheckResult{Domain: domain}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", domain, err)
+	}
+	for _, addr := range addrs {
+		result.IPs = append(result.IPs, addr.IP.String())
+		if IsCloudflareIP(addr.IP) {
+			result.CloudflareIPs = append(result.CloudflareIPs, addr.IP.String())
+		}
+	}
+
+	result.Proxied = len(result.IPs) > 0 && len(result.CloudflareIPs) == len(result.IPs)
+	switch {
+	case len(result.CloudflareIPs) == 0:
+		result.Warnings = append(result.Warnings, "domain does not resolve to Cloudflare, proxy (orange cloud) is probably disabled")
+	case !result.Proxied:
+		result.Warnings = append(result.Warnings, "domain resolves to both Cloudflare and non-Cloudflare addresses")
+	}
+
+	// Cloudflare 代理的域名会响应 /cdn-cgi/trace 并带有 CF-RAY 头
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+"/cdn-cgi/trace", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("https check failed: %v", err))
+		return result, nil
+	}
+	resp.Body.Close()
+
+	result.HTTPVerified = resp.Header.Get("CF-RAY") != "" ||
+		strings.EqualFold(resp.Header.Get("Server"), "cloudflare")
+	if !result.HTTPVerified {
+		result.Warnings = append(result.Warnings, "https response was not served by Cloudflare")
+	}
+
+	return result, nil
+}
+
+// ApplyCDNDefaults 为开启 CDN 模式的协议设置推荐参数，返回需要提示用户的警告
+func ApplyCDNDefaults(protocol *model.Protocol) ([]string, error) {
+	var target interface{}
+	switch protocol.Type {
+	case string(model.ProtocolVMess):
+		target = &model.VMessSettings{}
+	case string(model.ProtocolVLESS):
+		target = &model.VLESSSettings{}
+	case string(model.ProtocolTrojan):
+		target = &model.TrojanSettings{}
+	default:
+		return nil, nil
+	}
+
+	if len(protocol.Settings) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(protocol.Settings, target); err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	var err error
+	switch s := target.(type) {
+	case *model.VMessSettings:
+		if !s.CDN {
+			return nil, nil
+		}
+		warnings, err = applyCDN(&s.Network, &s.Path, s.Host, s.TLS, protocol.Port)
+		if s.AllowInsecure {
+			s.AllowInsecure = false
+			warnings = append(warnings, "allowInsecure disabled: Cloudflare serves a trusted certificate")
+		}
+	case *model.VLESSSettings:
+		if !s.CDN {
+			return nil, nil
+		}
+		warnings, err = applyCDN(&s.Network, &s.Path, s.Host, s.TLS, protocol.Port)
+		if s.Flow != "" {
+			warnings = append(warnings, fmt.Sprintf("flow %q removed: XTLS flows cannot pass through a CDN", s.Flow))
+			s.Flow = ""
+		}
+		if s.AllowInsecure {
+			s.AllowInsecure = false
+			warnings = append(warnings, "allowInsecure disabled: Cloudflare serves a trusted certificate")
+		}
+	case *model.TrojanSettings:
+		if !s.CDN {
+			return nil, nil
+		}
+		// Trojan 入站始终启用 TLS
+		warnings, err = applyCDN(&s.Network, &s.Path, s.Host, true, protocol.Port)
+		if s.SNI != "" && s.SNI != s.Host {
+			warnings = append(warnings, "sni differs from host: Cloudflare routes by SNI, using host instead")
+			s.SNI = s.Host
+		}
+	}
+	if err != nil {
+		return warnings, err
+	}
+
+	data, err := json.Marshal(target)
+	if err != nil {
+		return warnings, err
+	}
+	protocol.Settings = data
+
+	return warnings, nil
+}
+
+// applyCDN 检查并补全 CDN 模式下的传输参数
+func applyCDN(network, path *string, host string, tls bool, port int) ([]string, error) {
+	if host == "" || net.ParseIP(host) != nil {
+		return nil, ErrCDNInvalidHost
+	}
+
+	var warnings []string
+	switch *network {
+	case "ws", "grpc":
+	case "", "tcp":
+		warnings = append(warnings, fmt.Sprintf("network %q cannot pass through a CDN, switched to ws", *network))
+		*network = "ws"
+	default:
+		return nil, fmt.Errorf("%w: network %s", ErrCDNUnsupportedProtocol, *network)
+	}
+
+	if *path == "" || *path == "/" {
+		suffix, err := randomHex(6)
+		if err != nil {
+			return nil, err
+		}
+		if *network == "grpc" {
+			*path = "grpc-" + suffix
+		} else {
+			*path = "/" + suffix
+		}
+		warnings = append(warnings, fmt.Sprintf("path set to %s", *path))
+	}
+
+	switch {
+	case cloudflareHTTPSPorts[port]:
+	case cloudflareHTTPPorts[port]:
+		if tls {
+			warnings = append(warnings, fmt.Sprintf("port %d is an HTTP port on Cloudflare, inbound TLS will not be used by the CDN", port))
+		}
+		if *network == "grpc" {
+			warnings = append(warnings, "grpc through Cloudflare requires an HTTPS port")
+		}
+	default:
+		warnings = append(warnings, fmt.Sprintf("port %d is not proxied by Cloudflare, use 443, 2053, 2083, 2087, 2096 or 8443", port))
+	}
+
+	if *network == "grpc" {
+		warnings = append(warnings, "enable gRPC in the Cloudflare dashboard (Network > gRPC)")
+	}
+	if !tls && cloudflareHTTPSPorts[port] {
+		warnings = append(warnings, "inbound TLS is disabled, Cloudflare SSL mode must be Flexible")
+	}
+
+	return warnings, nil
+}
+
+// cdnAddress 客户端连接的地址
+func cdnAddress(cdnAddr, host string) string {
+	if cdnAddr != "" {
+		return cdnAddr
+	}
+	return host
+}
+
+// cdnSecurity 客户端到 CDN 的连接是否使用 TLS，由端口决定
+func cdnSecurity(port int) string {
+	if cloudflareHTTPPorts[port] {
+		return "none"
+	}
+	return "tls"
+}
+
+// cdnLinkParams 生成 CDN 模式下 VLESS/Trojan 链接的参数
+func cdnLinkParams(network, host, path string, port int, fingerprint string, alpn []string) []string {
+	params := []string{
+		"security=" + cdnSecurity(port),
+		"type=" + network,
+		"host=" + url.QueryEscape(host),
+	}
+	if cdnSecurity(port) == "tls" {
+		params = append(params, "sni="+url.QueryEscape(host), "fp="+clientFingerprint(fingerprint))
+		if len(alpn) > 0 {
+			params = append(params, "alpn="+url.QueryEscape(strings.Join(alpn, ",")))
+		}
+	}
+	if network == "grpc" {
+		params = append(params, "serviceName="+url.QueryEscape(path), "mode=gun")
+	} else {
+		params = append(params, "path="+url.QueryEscape(path))
+	}
+	return params
+}
+
+// randomHex 生成随机十六进制字符串
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random path: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// mustParseCIDRs 解析 CIDR 列表
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"v/logger"
+	"v/model"
+	"v/utils"
+)
+
+// tlsDomainPageSize 扫描入站域名时的分页大小
+const tlsDomainPageSize = 100
+
+// xrayCertificates 生成入站 TLS 证书配置，私钥可被其他用户读取时拒绝使用，
+// 除非设置中显式允许
+func (m *ProtocolManager) xrayCertificates(certFile, keyFile string) ([]XrayCertificateConfig, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("certificate file and key file must be set together")
+	}
+
+	if err := utils.VerifyKeyFile(keyFile); err != nil {
+		if !errors.Is(err, utils.ErrKeyFileInsecure) || m.settings == nil || !m.settings.Get().SSL.AllowInsecureKeys {
+			return nil, err
+		}
+		if m.logger != nil {
+			m.logger.WarnWithFields("Using private key readable by other users", logger.Fields{
+				"key_file": keyFile,
+			})
+		}
+	}
+
+	return []XrayCertificateConfig{
+		{
+			CertificateFile: certFile,
+			KeyFile:         keyFile,
+		},
+	}, nil
+}
+
+// TLSDomain 启用 TLS 的入站使用的证书域名
+type TLSDomain struct {
+	Domain    string  `json:"domain"`
+	Protocols []int64 `json:"protocols"` // 使用该域名的入站 ID
+}
+
+// TLSDomains 扫描启用 TLS 的 VMess、VLESS 和 Trojan 入站，返回需要证书的域名，按域名排序。
+// 使用 REALITY 的入站、IP 地址和通配符域名不需要申请证书，被忽略
+func (m *Manager) TLSDomains() ([]*TLSDomain, error) {
+	domains := make(map[string]*TLSDomain)
+	for page := 1; ; page++ {
+		list, err := m.db.ListProtocols(page, tlsDomainPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			domain := protocolTLSDomain(p)
+			if domain == "" {
+				continue
+			}
+			d, ok := domains[domain]
+			if !ok {
+				d = &TLSDomain{Domain: domain}
+				domains[domain] = d
+			}
+			d.Protocols = append(d.Protocols, p.ID)
+		}
+		if len(list) < tlsDomainPageSize {
+			break
+		}
+	}
+
+	result := make([]*TLSDomain, 0, len(domains))
+	for _, d := range domains {
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Domain < result[j].Domain })
+	return result, nil
+}
+
+// protocolTLSDomain 返回入站 TLS 证书的域名，不需要证书时返回空
+func protocolTLSDomain(p *model.Protocol) string {
+	var tls bool
+	var sni, host string
+	switch p.Type {
+	case "vmess":
+		var s model.VMessSettings
+		if json.Unmarshal(p.Settings, &s) != nil {
+			return ""
+		}
+		tls, sni, host = s.TLS, s.SNI, s.Host
+	case "vless":
+		var s model.VLESSSettings
+		if json.Unmarshal(p.Settings, &s) != nil || s.Reality != nil {
+			return ""
+		}
+		tls, sni, host = s.TLS, s.SNI, s.Host
+	case "trojan":
+		var s model.TrojanSettings
+		if json.Unmarshal(p.Settings, &s) != nil {
+			return ""
+		}
+		tls, sni, host = s.TLS, s.SNI, s.Host
+	default:
+		return ""
+	}
+	if !tls {
+		return ""
+	}
+	return CertificateDomain(tlsServerName(sni, host))
+}
+
+// CertificateDomain 规范化可以申请证书的域名，IP 地址、通配符和不含点的主机名返回空
+func CertificateDomain(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if host == "" || strings.Contains(host, "*") || !strings.Contains(host, ".") || net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return ""
+	}
+	return host
+}
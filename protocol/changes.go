@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"sync"
+
+	"v/model"
+)
+
+// 协议变化的原因
+const (
+	ChangeCreated  = "protocol_created"
+	ChangeUpdated  = "protocol_updated"
+	ChangeRollback = "protocol_rollback"
+	ChangeDeleted  = "protocol_deleted"
+)
+
+// ChangeListener 协议配置变化后的回调，userID 为协议所属用户。回调同步调用，耗时操作应放到后台
+type ChangeListener func(userID int64, reason string)
+
+// ProtocolListener 带协议内容的变化回调，删除时 p 为删除前的协议。回调同步调用，耗时操作应放到后台
+type ProtocolListener func(p *model.Protocol, reason string)
+
+// changeListeners 全局的协议变化回调。面板中存在多个 Manager 实例，回调注册在包级别以覆盖所有实例
+var changeListeners struct {
+	sync.RWMutex
+	fns []ChangeListener
+}
+
+// protocolListeners 全局的带协议内容的变化回调
+var protocolListeners struct {
+	sync.RWMutex
+	fns []ProtocolListener
+}
+
+// OnChange 注册协议创建、修改、回滚和删除后的回调，如让订阅缓存失效
+func OnChange(fn ChangeListener) {
+	changeListeners.Lock()
+	defer changeListeners.Unlock()
+	changeListeners.fns = append(changeListeners.fns, fn)
+}
+
+// notifyChange 通知所有回调
+func notifyChange(userID int64, reason string) {
+	changeListeners.RLock()
+	fns := changeListeners.fns
+	changeListeners.RUnlock()
+
+	for _, fn := range fns {
+		fn(userID, reason)
+	}
+}
+
+// OnProtocolChange 注册需要协议内容的变化回调，如触发外部钩子
+func OnProtocolChange(fn ProtocolListener) {
+	protocolListeners.Lock()
+	defer protocolListeners.Unlock()
+	protocolListeners.fns = append(protocolListeners.fns, fn)
+}
+
+// notifyProtocol 通知所有回调，包括只关心所属用户的回调
+func notifyProtocol(p *model.Protocol, reason string) {
+	notifyChange(p.UserID, reason)
+
+	protocolListeners.RLock()
+	fns := protocolListeners.fns
+	protocolListeners.RUnlock()
+
+	for _, fn := range fns {
+		fn(p, reason)
+	}
+}
@@ -0,0 +1,207 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"v/model"
+
+	"github.com/google/uuid"
+)
+
+// 复制协议相关错误
+var (
+	ErrPortInUse   = errors.New("port is already used by another protocol")
+	ErrInvalidPort = errors.New("port must be between 1 and 65535")
+)
+
+// CloneOptions 复制协议选项
+type CloneOptions struct {
+	Port   int    // 新端口，为 0 时从原端口往后选择第一个未被使用的端口
+	UserID int64  // 新协议所属用户，为 0 时与原协议相同
+	Name   string // 新协议名称，为空时使用原名称加 "(副本)"
+}
+
+// credentialKeys 复制时重新生成的凭据字段
+var credentialKeys = map[string]bool{
+	"uuid":     true,
+	"id":       true,
+	"password": true,
+	"pass":     true,
+}
+
+// CloneProtocolAs 以现有协议为模板创建新协议，保留传输层、TLS 和路由等配置，
+// 使用新端口并重新生成 UUID 和密码，流量和有效期不会复制
+func (m *Manager) CloneProtocolAs(id int64, opts CloneOptions, changedBy string) (*model.Protocol, error) {
+	src, err := m.db.GetProtocol(id)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, model.ErrNotFound
+	}
+
+	userID := src.UserID
+	if opts.UserID > 0 {
+		user, err := m.db.GetUser(opts.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, model.ErrNotFound
+		}
+		userID = opts.UserID
+	}
+
+	port := opts.Port
+	if port == 0 {
+		if port, err = m.nextFreePort(src.Port + 1); err != nil {
+			return nil, err
+		}
+	} else if err := m.checkPortFree(port); err != nil {
+		return nil, err
+	}
+
+	settings, err := cloneSettings(src.Settings, port)
+	if err != nil {
+		return nil, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = src.Name + " (副本)"
+	}
+
+	clone := &model.Protocol{
+		UserID:       userID,
+		Type:         src.Type,
+		Name:         name,
+		Settings:     settings,
+		Status:       src.Status,
+		Port:         port,
+		Listen:       src.Listen,
+		TrafficLimit: src.TrafficLimit,
+		Enable:       src.Enable,
+		Tags:         append([]string(nil), src.Tags...),
+		Remark:       src.Remark,
+	}
+	clone.Listen = NormalizeListen(clone.Listen)
+	if err := ValidateListenAddress(clone.Listen); err != nil {
+		return nil, err
+	}
+
+	if err := m.db.CreateProtocol(clone); err != nil {
+		return nil, err
+	}
+	m.saveVersion(clone, fmt.Sprintf("cloned from protocol %d", src.ID), changedBy)
+	notifyProtocol(clone, ChangeCreated)
+	return clone, nil
+}
+
+// checkPortFree 检查端口是否可用
+func (m *Manager) checkPortFree(port int) error {
+	if port < 1 || port > 65535 {
+		return ErrInvalidPort
+	}
+	used, err := m.db.GetProtocolsByPort(port)
+	if err != nil {
+		return fmt.Errorf("failed to check port: %v", err)
+	}
+	if len(used) > 0 {
+		return ErrPortInUse
+	}
+	return nil
+}
+
+// nextFreePort 从 start 开始选择第一个未被协议使用的端口
+func (m *Manager) nextFreePort(start int) (int, error) {
+	for port := start; port <= 65535; port++ {
+		err := m.checkPortFree(port)
+		if err == nil {
+			return port, nil
+		}
+		if !errors.Is(err, ErrPortInUse) {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("no free port after %d", start)
+}
+
+// cloneSettings 复制协议配置并重新生成凭据，配置中的端口改为新端口
+func cloneSettings(data []byte, port int) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse protocol settings: %v", err)
+	}
+
+	if err := regenerateCredentials(settings, ""); err != nil {
+		return nil, err
+	}
+	if _, ok := settings["port"]; ok {
+		settings["port"] = port
+	}
+
+	out, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal protocol settings: %v", err)
+	}
+	return out, nil
+}
+
+// regenerateCredentials 递归替换配置中的 UUID 和密码，包括 clients 等列表中的凭据
+func regenerateCredentials(value interface{}, method string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if m, ok := v["method"].(string); ok {
+			method = m
+		}
+		for key, item := range v {
+			if s, ok := item.(string); ok && credentialKeys[key] && s != "" {
+				credential, err := newCredential(key, method)
+				if err != nil {
+					return err
+				}
+				v[key] = credential
+				continue
+			}
+			if err := regenerateCredentials(item, method); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := regenerateCredentials(item, method); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newCredential 生成新的凭据。Shadowsocks 2022 的密码必须是与加密方式匹配长度的 base64 密钥
+func newCredential(key, method string) (string, error) {
+	if key == "uuid" || key == "id" {
+		return uuid.NewString(), nil
+	}
+
+	size := 16
+	if strings.HasPrefix(method, "2022-") && !strings.Contains(method, "aes-128") {
+		size = 32
+	}
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate password: %v", err)
+	}
+	if strings.HasPrefix(method, "2022-") {
+		return base64.StdEncoding.EncodeToString(buf), nil
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
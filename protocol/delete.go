@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"v/model"
+)
+
+// recentTrafficWindow 删除前检查流量的时间窗口
+const recentTrafficWindow = 24 * time.Hour
+
+// ErrDeleteConfirmationRequired 协议最近有流量，删除需要确认
+var ErrDeleteConfirmationRequired = errors.New("protocol had traffic in the last 24 hours, confirmation required")
+
+// DeleteOptions 删除协议选项
+type DeleteOptions struct {
+	Confirm bool // 确认删除最近有流量的协议
+	Archive bool // 将统计数据归档而不是直接删除
+}
+
+// DeleteProtocolWith 删除协议及其统计数据，并请求从运行中的 Xray 配置移除入站，返回配置变更的应用状态
+func (m *Manager) DeleteProtocolWith(id int64, opts DeleteOptions) (*ApplyChange, error) {
+	p, err := m.db.GetProtocol(id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, model.ErrNotFound
+	}
+
+	if !opts.Confirm {
+		active, err := m.hadRecentTraffic(id, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check protocol traffic: %v", err)
+		}
+		if active {
+			return nil, ErrDeleteConfirmationRequired
+		}
+	}
+
+	if err := m.db.DeleteProtocolCascade(id, opts.Archive); err != nil {
+		return nil, err
+	}
+	notifyProtocol(p, ChangeDeleted)
+
+	change, err := m.RequestApply(fmt.Sprintf("delete protocol %d", id))
+	if err != nil {
+		return nil, fmt.Errorf("protocol deleted but failed to reload xray config: %v", err)
+	}
+	return change, nil
+}
+
+// hadRecentTraffic 判断协议在时间窗口内是否有流量
+func (m *Manager) hadRecentTraffic(id int64, now time.Time) (bool, error) {
+	stats, err := m.db.ListProtocolStatsByProtocolID(id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range stats {
+		if s.Upload+s.Download > 0 && now.Sub(s.LastActive) < recentTrafficWindow {
+			return true, nil
+		}
+	}
+	return false, nil
+}
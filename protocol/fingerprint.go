@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SupportedFingerprints Xray 客户端支持的 uTLS 指纹
+var SupportedFingerprints = []string{
+	"chrome", "firefox", "safari", "edge", "ios", "android", "360", "qq", "random", "randomized",
+}
+
+// defaultFingerprint 未设置指纹时客户端使用的 uTLS 指纹
+const defaultFingerprint = "chrome"
+
+// maxALPNLength 单个 ALPN 协议名的最大长度（TLS 规定为 255 字节）
+const maxALPNLength = 255
+
+// validateTLSClientOptions 验证 uTLS 指纹和 ALPN 列表
+func validateTLSClientOptions(fingerprint string, alpn []string) error {
+	if fingerprint != "" && !contains(SupportedFingerprints, fingerprint) {
+		return fmt.Errorf("unsupported fingerprint %q, expected one of %s", fingerprint, strings.Join(SupportedFingerprints, ", "))
+	}
+	for _, proto := range alpn {
+		if proto == "" || len(proto) > maxALPNLength || strings.ContainsAny(proto, ", ") {
+			return fmt.Errorf("invalid alpn %q", proto)
+		}
+	}
+	return nil
+}
+
+// clientFingerprint 返回分享链接和客户端配置中使用的指纹
+func clientFingerprint(fingerprint string) string {
+	if fingerprint == "" {
+		return defaultFingerprint
+	}
+	return fingerprint
+}
+
+// clashFingerprint 返回 Clash 支持的指纹，Clash 没有 randomized，使用 random 代替
+func clashFingerprint(fingerprint string) string {
+	if fingerprint == "randomized" {
+		return "random"
+	}
+	return clientFingerprint(fingerprint)
+}
+
+// tlsServerName 返回 TLS 证书域名，未单独设置 SNI 时使用 Host
+func tlsServerName(sni, host string) string {
+	if sni != "" {
+		return sni
+	}
+	return host
+}
+
+// contains 判断列表是否包含 s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+)
+
+// ErrVersionNotFound 协议版本不存在
+var ErrVersionNotFound = errors.New("protocol version not found")
+
+// versionLocks 按协议串行化历史记录，protocolID => *sync.Mutex。
+// 协议管理器在多处各自创建，锁放在包级别才能覆盖所有实例
+var versionLocks sync.Map
+
+// lockVersions 锁定协议的历史记录，返回解锁函数
+func lockVersions(protocolID int64) func() {
+	mu, _ := versionLocks.LoadOrStore(protocolID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// protocolSnapshot 协议配置快照，只包含可回滚的配置字段
+type protocolSnapshot struct {
+	Type         string          `json:"type"`
+	Name         string          `json:"name"`
+	Settings     json.RawMessage `json:"settings,omitempty"`
+	Status       string          `json:"status"`
+	Port         int             `json:"port"`
+	Listen       string          `json:"listen,omitempty"`
+	TrafficLimit int64           `json:"traffic_limit"`
+	ExpireAt     time.Time       `json:"expire_at"`
+	Enable       bool            `json:"enable"`
+	Tags         []string        `json:"tags,omitempty"`
+}
+
+// newSnapshot 从协议生成快照
+func newSnapshot(p *model.Protocol) *protocolSnapshot {
+	s := &protocolSnapshot{
+		Type:         p.Type,
+		Name:         p.Name,
+		Status:       p.Status,
+		Port:         p.Port,
+		Listen:       p.Listen,
+		TrafficLimit: p.TrafficLimit,
+		ExpireAt:     p.ExpireAt,
+		Enable:       p.Enable,
+		Tags:         p.Tags,
+	}
+	if json.Valid(p.Settings) {
+		s.Settings = json.RawMessage(p.Settings)
+	} else if len(p.Settings) > 0 {
+		// 非 JSON 配置按字符串保存
+		s.Settings, _ = json.Marshal(string(p.Settings))
+	}
+	return s
+}
+
+// apply 将快照写回协议，流量使用量等运行时数据保持不变
+func (s *protocolSnapshot) apply(p *model.Protocol) {
+	p.Type = s.Type
+	p.Name = s.Name
+	p.Settings = []byte(s.Settings)
+	p.Status = s.Status
+	p.Port = s.Port
+	p.Listen = s.Listen
+	p.TrafficLimit = s.TrafficLimit
+	p.ExpireAt = s.ExpireAt
+	p.Enable = s.Enable
+	p.Tags = s.Tags
+}
+
+// SetReconciler 设置配置变更后的同步函数，例如重新生成并加载 Xray 配置
+func (m *Manager) SetReconciler(fn func() error) {
+	m.reconcile = fn
+}
+
+// ListVersions 获取协议的配置历史
+func (m *Manager) ListVersions(protocolID int64) ([]*model.ProtocolVersion, error) {
+	return m.db.ListProtocolVersions(protocolID)
+}
+
+// UpdateProtocolAs 更新协议并记录修改人
+func (m *Manager) UpdateProtocolAs(protocol *model.Protocol, changedBy string) error {
+	protocol.Listen = NormalizeListen(protocol.Listen)
+	if err := ValidateListenAddress(protocol.Listen); err != nil {
+		return err
+	}
+	if err := checkPortConflict(m.db, protocol.ID, protocol.Port, protocol.Listen); err != nil {
+		return err
+	}
+
+	old, err := m.db.GetProtocol(protocol.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.UpdateProtocol(protocol); err != nil {
+		return err
+	}
+
+	m.recordVersion(old, protocol, changedBy, "")
+	notifyProtocol(protocol, ChangeUpdated)
+	if old != nil && old.UserID != protocol.UserID {
+		notifyChange(old.UserID, ChangeUpdated)
+	}
+	return nil
+}
+
+// Rollback 将协议恢复到指定版本的配置并请求同步，返回恢复后的协议和配置变更的应用状态
+func (m *Manager) Rollback(protocolID int64, version int, changedBy string) (*model.Protocol, *ApplyChange, error) {
+	v, err := m.db.GetProtocolVersion(protocolID, version)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, nil, ErrVersionNotFound
+		}
+		return nil, nil, err
+	}
+	if v == nil {
+		return nil, nil, ErrVersionNotFound
+	}
+
+	var snapshot protocolSnapshot
+	if err := json.Unmarshal(v.Snapshot, &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode protocol snapshot: %v", err)
+	}
+
+	old, err := m.db.GetProtocol(protocolID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if old == nil {
+		return nil, nil, model.ErrNotFound
+	}
+
+	restored := *old
+	snapshot.apply(&restored)
+	// 快照中的端口可能已被其他协议占用，与更新时一样检查
+	if err := checkPortConflict(m.db, protocolID, restored.Port, restored.Listen); err != nil {
+		return nil, nil, err
+	}
+	if err := m.db.UpdateProtocol(&restored); err != nil {
+		return nil, nil, err
+	}
+
+	m.recordVersion(old, &restored, changedBy, fmt.Sprintf("rollback to version %d", version))
+	notifyProtocol(&restored, ChangeRollback)
+
+	change, err := m.RequestApply(fmt.Sprintf("rollback protocol %d to version %d", protocolID, version))
+	if err != nil {
+		return &restored, nil, fmt.Errorf("failed to reconcile after rollback: %v", err)
+	}
+	return &restored, change, nil
+}
+
+// recordVersion 记录一次配置变更，历史记录失败不影响主流程
+func (m *Manager) recordVersion(old, current *model.Protocol, changedBy, note string) {
+	// 查询历史和补记第 1 版需要作为整体执行，否则并发的首次修改会重复保存原始配置
+	unlock := lockVersions(current.ID)
+	defer unlock()
+
+	versions, err := m.db.ListProtocolVersions(current.ID)
+	if err != nil {
+		m.log.ErrorWithFields("Failed to load protocol versions", logger.Fields{
+			"protocol_id": current.ID,
+			"error":       err,
+		})
+		return
+	}
+
+	// 版本号由数据库在插入时分配
+	if len(versions) == 0 && old != nil {
+		// 首次修改前没有历史时，先保存原始配置作为第 1 版
+		if err := m.saveVersion(old, "", ""); err != nil {
+			return
+		}
+	}
+
+	var diff string
+	if old != nil {
+		diff = diffSnapshots(newSnapshot(old), newSnapshot(current))
+		if diff == "" && note == "" {
+			return
+		}
+	}
+	if note != "" {
+		diff = strings.TrimSpace(note + "\n" + diff)
+	}
+
+	m.saveVersion(current, diff, changedBy)
+}
+
+// saveVersion 保存协议快照，版本号由数据库分配
+func (m *Manager) saveVersion(p *model.Protocol, diff, changedBy string) error {
+	data, err := json.Marshal(newSnapshot(p))
+	if err != nil {
+		return err
+	}
+
+	version := &model.ProtocolVersion{
+		ProtocolID: p.ID,
+		Snapshot:   data,
+		Diff:       diff,
+		ChangedBy:  changedBy,
+	}
+	if err := m.db.CreateProtocolVersion(version); err != nil {
+		m.log.ErrorWithFields("Failed to record protocol version", logger.Fields{
+			"protocol_id": p.ID,
+			"error":       err,
+		})
+		return err
+	}
+	return nil
+}
+
+// diffSnapshots 比较两个快照，每行输出一个变化的字段 "path: old -> new"
+func diffSnapshots(a, b *protocolSnapshot) string {
+	left := flattenJSON(a)
+	right := flattenJSON(b)
+
+	keys := make(map[string]struct{}, len(left)+len(right))
+	for k := range left {
+		keys[k] = struct{}{}
+	}
+	for k := range right {
+		keys[k] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, k := range sorted {
+		l, lok := left[k]
+		r, rok := right[k]
+		switch {
+		case !lok:
+			lines = append(lines, fmt.Sprintf("%s: (none) -> %s", k, r))
+		case !rok:
+			lines = append(lines, fmt.Sprintf("%s: %s -> (none)", k, l))
+		case l != r:
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", k, l, r))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flattenJSON 将对象展开为 "a.b.c" => 值 的形式
+func flattenJSON(v interface{}) map[string]string {
+	data, _ := json.Marshal(v)
+	var generic interface{}
+	json.Unmarshal(data, &generic)
+
+	out := make(map[string]string)
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			for k, child := range val {
+				key := k
+				if prefix != "" {
+					key = prefix + "." + k
+				}
+				walk(key, child)
+			}
+		case []interface{}:
+			for i, child := range val {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), child)
+			}
+		default:
+			b, _ := json.Marshal(val)
+			out[prefix] = string(b)
+		}
+	}
+	walk("", generic)
+	return out
+}
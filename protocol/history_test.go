@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"v/logger"
+	"v/model"
+)
+
+// historyDB 在 portDB 的基础上保存协议和版本历史
+type historyDB struct {
+	portDB
+	mu       sync.Mutex
+	versions []*model.ProtocolVersion
+	updated  int
+}
+
+func (d *historyDB) GetProtocol(id int64) (*model.Protocol, error) {
+	for _, p := range d.protocols {
+		if p.ID == id {
+			copied := *p
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *historyDB) UpdateProtocol(p *model.Protocol) error {
+	d.updated++
+	return nil
+}
+
+func (d *historyDB) ListProtocolVersions(protocolID int64) ([]*model.ProtocolVersion, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var found []*model.ProtocolVersion
+	for _, v := range d.versions {
+		if v.ProtocolID == protocolID {
+			found = append(found, v)
+		}
+	}
+	return found, nil
+}
+
+func (d *historyDB) CreateProtocolVersion(v *model.ProtocolVersion) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v.Version = len(d.versions) + 1
+	d.versions = append(d.versions, v)
+	return nil
+}
+
+func (d *historyDB) GetProtocolVersion(protocolID int64, version int) (*model.ProtocolVersion, error) {
+	for _, v := range d.versions {
+		if v.ProtocolID == protocolID && v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func newHistoryManager(db model.DB) *Manager {
+	return New(logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR}), nil, db)
+}
+
+func TestRollbackChecksPortConflict(t *testing.T) {
+	current := &model.Protocol{Type: "vmess", Port: 10086}
+	current.ID = 1
+	other := &model.Protocol{Type: "vless", Port: 443}
+	other.ID = 2
+	db := &historyDB{portDB: portDB{protocols: []*model.Protocol{current, other}}}
+
+	// 第 1 版使用的 443 端口现在属于协议 2
+	snapshot, _ := json.Marshal(newSnapshot(&model.Protocol{Type: "vmess", Port: 443}))
+	db.versions = []*model.ProtocolVersion{{ProtocolID: 1, Version: 1, Snapshot: snapshot}}
+
+	_, _, err := newHistoryManager(db).Rollback(1, 1, "admin")
+	if !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("Rollback error = %v, want %v", err, ErrPortInUse)
+	}
+	if db.updated != 0 {
+		t.Errorf("protocol updated %d times, want it unchanged", db.updated)
+	}
+}
+
+func TestRecordVersionSavesOriginalOnce(t *testing.T) {
+	db := &historyDB{}
+	m := newHistoryManager(db)
+	old := &model.Protocol{Type: "vmess", Port: 10086}
+	old.ID = 1
+
+	// 同一协议的首次修改并发进行时，原始配置只保存为第 1 版一次
+	const writers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			current := *old
+			current.Port = port
+			m.recordVersion(old, &current, "admin", "")
+		}(20000 + i)
+	}
+	wg.Wait()
+
+	originals := 0
+	for _, v := range db.versions {
+		if v.Diff == "" {
+			originals++
+		}
+	}
+	if originals != 1 || len(db.versions) != writers+1 {
+		t.Errorf("saved %d versions with %d originals, want %d with 1 original", len(db.versions), originals, writers+1)
+	}
+}
@@ -0,0 +1,193 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"v/model"
+)
+
+// ImportResult 从 xray 入站导入协议的结果
+type ImportResult struct {
+	Imported []*model.Protocol `json:"imported"`
+	Skipped  []string          `json:"skipped"` // 跳过的入站及原因
+}
+
+// InboundToProtocol 将 xray 配置中的入站转换为协议，入站的第一个客户端作为协议凭据。
+// 只支持面板能管理的协议类型，传输层和 TLS 配置转换为面板的扁平格式
+func InboundToProtocol(inbound map[string]interface{}) (*model.Protocol, error) {
+	typ, _ := inbound["protocol"].(string)
+	if typ == string(model.ProtocolDokodemo) {
+		// 固定目标的 dokodemo-door 即端口中转
+		typ = string(model.ProtocolRelay)
+	}
+	if _, ok := protocolSpecs[typ]; !ok {
+		return nil, fmt.Errorf("unsupported protocol %q", typ)
+	}
+	port, ok := inbound["port"].(float64)
+	if !ok || port < 1 || port > 65535 {
+		return nil, ErrInvalidPort
+	}
+
+	inboundSettings, _ := inbound["settings"].(map[string]interface{})
+	stream, _ := inbound["streamSettings"].(map[string]interface{})
+
+	settings := map[string]interface{}{}
+	client := map[string]interface{}{}
+	if clients, _ := inboundSettings["clients"].([]interface{}); len(clients) > 0 {
+		client, _ = clients[0].(map[string]interface{})
+	}
+	switch typ {
+	case "vmess", "vless":
+		settings["uuid"] = client["id"]
+		if typ == "vless" {
+			settings["flow"] = stringValue(client["flow"])
+		} else {
+			settings["alterId"] = client["alterId"]
+			settings["security"] = stringValue(client["security"])
+		}
+	case "trojan":
+		settings["password"] = client["password"]
+	case "shadowsocks":
+		settings["method"] = inboundSettings["method"]
+		settings["password"] = inboundSettings["password"]
+	case "relay":
+		if inboundSettings["followRedirect"] == true {
+			return nil, fmt.Errorf("transparent proxy dokodemo-door is not supported")
+		}
+		settings["target_host"] = inboundSettings["address"]
+		settings["target_port"] = inboundSettings["port"]
+		settings["timeout"] = inboundSettings["timeout"]
+		network := stringValue(inboundSettings["network"])
+		if network == "" {
+			network = "tcp"
+		}
+		settings["network"] = network
+		if sniffing, _ := inbound["sniffing"].(map[string]interface{}); sniffing["enabled"] == true {
+			settings["tls_passthrough"] = true
+		}
+	case "socks", "http":
+		if accounts, _ := inboundSettings["accounts"].([]interface{}); len(accounts) > 0 {
+			if account, ok := accounts[0].(map[string]interface{}); ok {
+				settings["username"] = account["user"]
+				settings["password"] = account["pass"]
+			}
+		}
+		if typ == "socks" {
+			settings["auth"] = stringValue(inboundSettings["auth"])
+			settings["udp"] = inboundSettings["udp"] == true
+		}
+	}
+
+	network := stringValue(stream["network"])
+	if network == "" {
+		network = "tcp"
+	}
+	if typ != "relay" {
+		settings["network"] = network
+	}
+
+	var host, path string
+	switch network {
+	case "ws":
+		ws, _ := stream["wsSettings"].(map[string]interface{})
+		path = stringValue(ws["path"])
+		headers, _ := ws["headers"].(map[string]interface{})
+		host = stringValue(headers["Host"])
+	case "grpc":
+		grpc, _ := stream["grpcSettings"].(map[string]interface{})
+		path = stringValue(grpc["serviceName"])
+	case "http":
+		h2, _ := stream["httpSettings"].(map[string]interface{})
+		path = stringValue(h2["path"])
+	}
+
+	if stringValue(stream["security"]) == "tls" {
+		settings["tls"] = true
+		tls, _ := stream["tlsSettings"].(map[string]interface{})
+		sni := stringValue(tls["serverName"])
+		if typ == "trojan" {
+			settings["sni"] = sni
+		}
+		if host == "" {
+			host = sni
+		}
+		if certs, _ := tls["certificates"].([]interface{}); len(certs) > 0 {
+			if cert, ok := certs[0].(map[string]interface{}); ok {
+				settings["certFile"] = stringValue(cert["certificateFile"])
+				settings["keyFile"] = stringValue(cert["keyFile"])
+			}
+		}
+	}
+	if typ != "relay" {
+		settings["host"] = host
+		settings["path"] = path
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal protocol settings: %v", err)
+	}
+
+	name := stringValue(inbound["tag"])
+	if name == "" {
+		name = fmt.Sprintf("%s-%d", typ, int(port))
+	}
+	return &model.Protocol{
+		Type:     typ,
+		Name:     name,
+		Settings: data,
+		Status:   "active",
+		Port:     int(port),
+		Listen:   stringValue(inbound["listen"]),
+		Enable:   true,
+		Remark:   "imported from external xray",
+	}, nil
+}
+
+// ImportInbounds 将 xray 入站导入为用户的协议，端口已被其他协议使用或类型不支持的入站跳过
+func (m *Manager) ImportInbounds(inbounds []map[string]interface{}, userID int64, changedBy string) (*ImportResult, error) {
+	user, err := m.db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, model.ErrNotFound
+	}
+
+	result := &ImportResult{Imported: []*model.Protocol{}, Skipped: []string{}}
+	for _, inbound := range inbounds {
+		tag := stringValue(inbound["tag"])
+		if tag == "api" {
+			continue
+		}
+
+		protocol, err := InboundToProtocol(inbound)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", tag, err))
+			continue
+		}
+		if err := m.checkPortFree(protocol.Port); err != nil {
+			if !errors.Is(err, ErrPortInUse) {
+				return result, err
+			}
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", tag, err))
+			continue
+		}
+
+		protocol.UserID = userID
+		if err := m.CreateProtocolAs(protocol, changedBy); err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", tag, err))
+			continue
+		}
+		result.Imported = append(result.Imported, protocol)
+	}
+	return result, nil
+}
+
+// stringValue 返回 JSON 值中的字符串，不是字符串时返回空字符串
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
@@ -23,6 +23,9 @@ type VMessLink struct {
 	Host string `json:"host"`
 	Path string `json:"path"`
 	TLS  string `json:"tls"`
+	SNI  string `json:"sni,omitempty"`
+	FP   string `json:"fp,omitempty"`
+	ALPN string `json:"alpn,omitempty"`
 }
 
 // VLESSLink VLESS 链接结构
@@ -77,6 +80,29 @@ func (m *ProtocolManager) GenerateVMessLink(protocol *model.Protocol) (string, e
 
 	if settings.TLS {
 		link.TLS = "tls"
+		link.SNI = tlsServerName(settings.SNI, settings.Host)
+	}
+
+	// CDN 模式下客户端连接 CDN 地址，通过 Host/SNI 回源
+	if settings.CDN {
+		link.Add = cdnAddress(settings.CDNAddress, settings.Host)
+		link.TLS = cdnSecurity(protocol.Port)
+		if link.TLS == "tls" {
+			link.SNI = settings.Host
+		} else {
+			link.TLS, link.SNI = "", ""
+		}
+	}
+
+	// QUIC 链接中 type 为伪装类型，host 为加密方式，path 为密钥
+	if settings.Network == quicTransport {
+		quic := xrayQUICConfig(settings.QUIC)
+		link.Type, link.Host, link.Path = quic.Header.Type, quic.Security, quic.Key
+	}
+
+	if link.TLS == "tls" {
+		link.FP = clientFingerprint(settings.Fingerprint)
+		link.ALPN = strings.Join(settings.ALPN, ",")
 	}
 
 	jsonData, err := json.Marshal(link)
@@ -94,11 +120,21 @@ func (m *ProtocolManager) GenerateVLESSLink(protocol *model.Protocol) (string, e
 		return "", err
 	}
 
+	if settings.CDN {
+		return fmt.Sprintf("vless://%s@%s:%d?%s#%s",
+			settings.UUID,
+			cdnAddress(settings.CDNAddress, settings.Host),
+			protocol.Port,
+			strings.Join(append([]string{"encryption=none"}, cdnLinkParams(settings.Network, settings.Host, settings.Path, protocol.Port, settings.Fingerprint, settings.ALPN)...), "&"),
+			url.QueryEscape(protocol.Name),
+		), nil
+	}
+
 	link := VLESSLink{
 		ID:         settings.UUID,
 		Flow:       settings.Flow,
 		Encryption: "none",
-		FP:         "chrome",
+		FP:         clientFingerprint(settings.Fingerprint),
 		Type:       "none",
 		Host:       settings.Host,
 		Path:       settings.Path,
@@ -112,9 +148,14 @@ func (m *ProtocolManager) GenerateVLESSLink(protocol *model.Protocol) (string, e
 	// 构建参数列表
 	params := []string{
 		fmt.Sprintf("encryption=%s", link.Encryption),
-		fmt.Sprintf("type=%s", link.Type),
-		fmt.Sprintf("host=%s", url.QueryEscape(link.Host)),
 	}
+	if settings.Network == quicTransport {
+		params = append(params, "security=tls")
+		params = append(params, quicLinkParams(settings.QUIC)...)
+	} else {
+		params = append(params, fmt.Sprintf("type=%s", link.Type))
+	}
+	params = append(params, fmt.Sprintf("host=%s", url.QueryEscape(link.Host)))
 
 	// 添加Flow参数，如果存在
 	if link.Flow != "" {
@@ -126,6 +167,16 @@ func (m *ProtocolManager) GenerateVLESSLink(protocol *model.Protocol) (string, e
 		params = append(params, fmt.Sprintf("path=%s", url.QueryEscape(link.Path)))
 	}
 
+	// 添加 SNI 和 ALPN 参数，仅 TLS 时有效
+	if settings.TLS {
+		if settings.SNI != "" {
+			params = append(params, fmt.Sprintf("sni=%s", url.QueryEscape(settings.SNI)))
+		}
+		if len(settings.ALPN) > 0 {
+			params = append(params, fmt.Sprintf("alpn=%s", url.QueryEscape(strings.Join(settings.ALPN, ","))))
+		}
+	}
+
 	// 添加指纹参数
 	params = append(params, fmt.Sprintf("fp=%s", link.FP))
 
@@ -145,6 +196,16 @@ func (m *ProtocolManager) GenerateTrojanLink(protocol *model.Protocol) (string,
 		return "", err
 	}
 
+	if settings.CDN {
+		return fmt.Sprintf("trojan://%s@%s:%d?%s#%s",
+			url.QueryEscape(settings.Password),
+			cdnAddress(settings.CDNAddress, settings.Host),
+			protocol.Port,
+			strings.Join(cdnLinkParams(settings.Network, settings.Host, settings.Path, protocol.Port, settings.Fingerprint, settings.ALPN), "&"),
+			url.QueryEscape(protocol.Name),
+		), nil
+	}
+
 	link := TrojanLink{
 		Password: settings.Password,
 		Host:     settings.Host,
@@ -156,18 +217,24 @@ func (m *ProtocolManager) GenerateTrojanLink(protocol *model.Protocol) (string,
 	params := []string{"security=tls"}
 
 	// 添加 SNI 参数，优先使用专门的SNI字段，如果不存在则使用Host
-	sni := settings.SNI
-	if sni == "" {
-		sni = settings.Host
-	}
+	params = append(params, fmt.Sprintf("sni=%s", tlsServerName(settings.SNI, settings.Host)))
 
-	params = append(params, fmt.Sprintf("sni=%s", sni))
+	// 添加指纹和 ALPN 参数
+	params = append(params, fmt.Sprintf("fp=%s", clientFingerprint(settings.Fingerprint)))
+	if len(settings.ALPN) > 0 {
+		params = append(params, fmt.Sprintf("alpn=%s", url.QueryEscape(strings.Join(settings.ALPN, ","))))
+	}
 
 	// 添加 Path 参数，如果存在且不为空
 	if link.Path != "" {
 		params = append(params, fmt.Sprintf("path=%s", url.QueryEscape(link.Path)))
 	}
 
+	// 添加 QUIC 传输参数
+	if settings.Network == quicTransport {
+		params = append(params, quicLinkParams(settings.QUIC)...)
+	}
+
 	// 构建完整链接
 	return fmt.Sprintf("trojan://%s@%s:%s?%s#%s",
 		url.QueryEscape(link.Password),
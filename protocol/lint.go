@@ -0,0 +1,296 @@
+package protocol
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"v/model"
+)
+
+// 检查结果的严重程度
+const (
+	LintError   = "error"   // 配置无法工作，保存前必须修正
+	LintWarning = "warning" // 配置可以工作，但很可能不是预期的效果
+)
+
+// realityProbeTimeout 探测 REALITY 目标网站的超时时间
+const realityProbeTimeout = 5 * time.Second
+
+// certExpiryWarning 证书剩余有效期少于该值时提示
+const certExpiryWarning = 7 * 24 * time.Hour
+
+// ErrLintFailed 协议配置检查发现错误
+var ErrLintFailed = errors.New("protocol configuration has errors")
+
+// LintIssue 一条检查结果
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`            // 稳定的问题标识，如 ws_path_no_slash
+	Field    string `json:"field,omitempty"` // 相关的配置字段
+	Message  string `json:"message"`
+}
+
+// LintReport 协议配置的检查结果，错误和警告分开列出
+type LintReport struct {
+	Errors   []*LintIssue `json:"errors"`
+	Warnings []*LintIssue `json:"warnings"`
+}
+
+// HasErrors 判断是否有必须修正的错误
+func (r *LintReport) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// WarningMessages 返回警告的文字说明，用于附加到保存接口的 warnings 中
+func (r *LintReport) WarningMessages() []string {
+	messages := make([]string, 0, len(r.Warnings))
+	for _, issue := range r.Warnings {
+		messages = append(messages, issue.Message)
+	}
+	return messages
+}
+
+// Err 有错误时返回包装了 ErrLintFailed 的错误，否则返回 nil
+func (r *LintReport) Err() error {
+	if !r.HasErrors() {
+		return nil
+	}
+	messages := make([]string, 0, len(r.Errors))
+	for _, issue := range r.Errors {
+		messages = append(messages, issue.Message)
+	}
+	return fmt.Errorf("%w: %s", ErrLintFailed, strings.Join(messages, "; "))
+}
+
+// add 添加一条检查结果
+func (r *LintReport) add(severity, code, field, format string, args ...interface{}) {
+	issue := &LintIssue{
+		Severity: severity,
+		Code:     code,
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if severity == LintError {
+		r.Errors = append(r.Errors, issue)
+	} else {
+		r.Warnings = append(r.Warnings, issue)
+	}
+}
+
+// LintOptions 检查选项
+type LintOptions struct {
+	// Probe 连接外部地址做检查（如 REALITY 目标网站是否支持 TLS 1.3），保存前的检查不探测
+	Probe bool
+}
+
+// lintTransport 各协议共有的传输和 TLS 配置
+type lintTransport struct {
+	network   string
+	host      string
+	path      string
+	tls       bool
+	certFile  string
+	keyFile   string
+	fallbacks []model.Fallback
+	reality   *model.RealitySettings
+	// canFallback 协议支持回落
+	canFallback bool
+}
+
+// Lint 检查协议配置中的常见错误，不修改协议
+func (m *Manager) Lint(ctx context.Context, p *model.Protocol, opts LintOptions) *LintReport {
+	report := &LintReport{Errors: []*LintIssue{}, Warnings: []*LintIssue{}}
+	if len(p.Settings) == 0 {
+		return report
+	}
+
+	var t lintTransport
+	var err error
+	switch p.Type {
+	case string(model.ProtocolVMess):
+		var s model.VMessSettings
+		if err = json.Unmarshal(p.Settings, &s); err == nil {
+			t = lintTransport{network: s.Network, host: s.Host, path: s.Path, tls: s.TLS, certFile: s.CertFile, keyFile: s.KeyFile}
+		}
+	case string(model.ProtocolVLESS):
+		var s model.VLESSSettings
+		if err = json.Unmarshal(p.Settings, &s); err == nil {
+			t = lintTransport{network: s.Network, host: s.Host, path: s.Path, tls: s.TLS, certFile: s.CertFile, keyFile: s.KeyFile,
+				fallbacks: s.Fallbacks, reality: s.Reality, canFallback: true}
+		}
+	case string(model.ProtocolTrojan):
+		var s model.TrojanSettings
+		if err = json.Unmarshal(p.Settings, &s); err == nil {
+			host := s.Host
+			if s.SNI != "" {
+				host = s.SNI
+			}
+			// Trojan 入站始终启用 TLS
+			t = lintTransport{network: s.Network, host: host, path: s.Path, tls: true, certFile: s.CertFile, keyFile: s.KeyFile,
+				fallbacks: s.Fallbacks, canFallback: true}
+		}
+	case string(model.ProtocolShadowsocks):
+		var s model.ShadowsocksSettings
+		if err = json.Unmarshal(p.Settings, &s); err == nil {
+			lintShadowsocksKey(report, &s)
+			t = lintTransport{network: s.Network, host: s.Host, path: s.Path}
+		}
+	default:
+		return report
+	}
+	if err != nil {
+		report.add(LintError, "invalid_settings", "settings", "settings is not valid for %s: %v", p.Type, err)
+		return report
+	}
+
+	m.lintTransport(ctx, report, p, &t, opts)
+	return report
+}
+
+// lintTransport 检查传输路径、证书、REALITY 和回落配置
+func (m *Manager) lintTransport(ctx context.Context, report *LintReport, p *model.Protocol, t *lintTransport, opts LintOptions) {
+	if (t.network == "ws" || t.network == "http") && t.path != "" && !strings.HasPrefix(t.path, "/") {
+		report.add(LintError, "path_no_leading_slash", "path",
+			"%s path %q must start with '/', clients requesting /%s will not match", t.network, t.path, t.path)
+	}
+	for _, fb := range t.fallbacks {
+		if fb.Path != "" && !strings.HasPrefix(fb.Path, "/") {
+			report.add(LintError, "fallback_path_no_leading_slash", "fallbacks", "fallback path %q must start with '/'", fb.Path)
+		}
+		if fb.Dest == "" {
+			report.add(LintError, "fallback_no_dest", "fallbacks", "fallback dest is required")
+		}
+	}
+
+	switch {
+	case t.reality != nil:
+		m.lintReality(ctx, report, t.reality, opts)
+	case t.tls:
+		m.lintCertificate(report, t)
+	}
+
+	// 443 端口上的 TLS 入站收到浏览器或主动探测时没有回落会直接断开，容易被识别
+	if p.Port == 443 && t.canFallback && t.reality == nil && t.tls && len(t.fallbacks) == 0 {
+		report.add(LintWarning, "no_fallback_on_443", "fallbacks",
+			"port 443 has no fallback: non-proxy requests are dropped, which makes the server easy to fingerprint")
+	}
+}
+
+// lintCertificate 检查 TLS 证书是否存在并覆盖 host
+func (m *Manager) lintCertificate(report *LintReport, t *lintTransport) {
+	certFile := t.certFile
+	if certFile == "" && t.host != "" && m.db != nil {
+		// 未指定证书路径时使用证书管理中为该域名申请的证书
+		if cert, err := m.db.GetCertificate(t.host); err == nil && cert != nil {
+			certFile = cert.CertFile
+		}
+	}
+	if certFile == "" {
+		report.add(LintError, "tls_no_certificate", "certFile",
+			"tls is enabled but no certificate is configured for host %q", t.host)
+		return
+	}
+	if t.certFile != "" && t.keyFile == "" {
+		report.add(LintError, "tls_no_key", "keyFile", "certificate file is set without a key file")
+	}
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		report.add(LintError, "tls_certificate_unreadable", "certFile", "cannot read certificate %s: %v", certFile, err)
+		return
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		report.add(LintError, "tls_certificate_invalid", "certFile", "certificate %s is not PEM encoded", certFile)
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		report.add(LintError, "tls_certificate_invalid", "certFile", "cannot parse certificate %s: %v", certFile, err)
+		return
+	}
+
+	if t.host != "" && cert.VerifyHostname(t.host) != nil {
+		report.add(LintWarning, "tls_host_mismatch", "host",
+			"certificate %s does not cover host %q, clients will reject it unless allowInsecure is set", certFile, t.host)
+	}
+	now := time.Now()
+	switch {
+	case now.After(cert.NotAfter):
+		report.add(LintWarning, "tls_certificate_expired", "certFile", "certificate %s expired at %s", certFile, cert.NotAfter.Format(time.RFC3339))
+	case cert.NotAfter.Sub(now) < certExpiryWarning:
+		report.add(LintWarning, "tls_certificate_expiring", "certFile", "certificate %s expires at %s", certFile, cert.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// lintReality 检查 REALITY 配置，Probe 时确认目标网站支持 TLS 1.3
+func (m *Manager) lintReality(ctx context.Context, report *LintReport, r *model.RealitySettings, opts LintOptions) {
+	if r.Dest == "" {
+		report.add(LintError, "reality_no_dest", "reality.dest", "reality dest is required")
+		return
+	}
+	if r.PrivateKey == "" {
+		report.add(LintError, "reality_no_private_key", "reality.privateKey", "reality private key is required")
+	}
+	if len(r.ServerNames) == 0 {
+		report.add(LintError, "reality_no_server_names", "reality.serverNames", "reality requires at least one server name")
+	}
+	if !opts.Probe {
+		return
+	}
+
+	addr := r.Dest
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "443")
+	}
+	serverName, _, _ := net.SplitHostPort(addr)
+	if len(r.ServerNames) > 0 {
+		serverName = r.ServerNames[0]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, realityProbeTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS13,
+		MaxVersion: tls.VersionTLS13,
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		report.add(LintWarning, "reality_dest_no_tls13", "reality.dest",
+			"reality dest %s did not complete a TLS 1.3 handshake for %q: %v", addr, serverName, err)
+		return
+	}
+	conn.Close()
+}
+
+// lintShadowsocksKey 检查 Shadowsocks 2022 密钥长度，密钥必须是对应长度的 base64 编码
+func lintShadowsocksKey(report *LintReport, s *model.ShadowsocksSettings) {
+	if !strings.HasPrefix(s.Method, "2022-blake3-") || s.Password == "" {
+		return
+	}
+	want := 32
+	if s.Method == "2022-blake3-aes-128-gcm" {
+		want = 16
+	}
+	key, err := base64.StdEncoding.DecodeString(s.Password)
+	if err != nil {
+		report.add(LintError, "ss_key_not_base64", "password",
+			"%s requires a base64 encoded %d-byte key, generate one with: openssl rand -base64 %d", s.Method, want, want)
+		return
+	}
+	if len(key) != want {
+		report.add(LintError, "ss_key_length", "password",
+			"%s requires a %d-byte key, got %d bytes", s.Method, want, len(key))
+	}
+}
@@ -0,0 +1,98 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 特殊监听地址
+const (
+	ListenAllIPv4 = "0.0.0.0"
+	ListenAllIPv6 = "::" // 在 Linux 上默认为双栈监听
+)
+
+var (
+	// ErrInvalidListenAddress 监听地址格式无效
+	ErrInvalidListenAddress = errors.New("invalid listen address")
+	// ErrListenAddressNotFound 监听地址不属于本机
+	ErrListenAddressNotFound = errors.New("listen address is not assigned to any interface")
+)
+
+// NormalizeListen 规范化监听地址，去掉 IPv6 地址的方括号
+func NormalizeListen(listen string) string {
+	listen = strings.TrimSpace(listen)
+	if strings.HasPrefix(listen, "[") && strings.HasSuffix(listen, "]") {
+		listen = listen[1 : len(listen)-1]
+	}
+	return listen
+}
+
+// ValidateListenAddress 验证监听地址：可以为空、通配地址、本机已配置的 IPv4/IPv6 地址，
+// 或以 "/" 或 "@" 开头的 Unix 域套接字
+func ValidateListenAddress(listen string) error {
+	listen = NormalizeListen(listen)
+	if listen == "" || listen == ListenAllIPv4 || listen == ListenAllIPv6 {
+		return nil
+	}
+	if strings.HasPrefix(listen, "/") || strings.HasPrefix(listen, "@") {
+		return nil
+	}
+
+	ip := net.ParseIP(listen)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", ErrInvalidListenAddress, listen)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("failed to get interface addresses: %v", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrListenAddressNotFound, listen)
+}
+
+// listenOverlaps 判断两个监听地址在同一端口上是否冲突
+func listenOverlaps(a, b string) bool {
+	a, b = NormalizeListen(a), NormalizeListen(b)
+	if a == b {
+		return true
+	}
+
+	wildcard := func(s string) bool {
+		return s == "" || s == ListenAllIPv4 || s == ListenAllIPv6
+	}
+	if wildcard(a) && wildcard(b) {
+		return true
+	}
+
+	// Unix 域套接字不占用端口
+	if isSocketListen(a) || isSocketListen(b) {
+		return false
+	}
+
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	switch {
+	case wildcard(a):
+		return a == ListenAllIPv6 || ipB == nil || ipB.To4() != nil
+	case wildcard(b):
+		return b == ListenAllIPv6 || ipA == nil || ipA.To4() != nil
+	}
+	return ipA != nil && ipB != nil && ipA.Equal(ipB)
+}
+
+// isSocketListen 判断监听地址是否为 Unix 域套接字
+func isSocketListen(listen string) bool {
+	return strings.HasPrefix(listen, "/") || strings.HasPrefix(listen, "@")
+}
+
+// xrayListen 返回写入 Xray 入站的 listen 值，为空时由 Xray 使用默认地址
+func xrayListen(listen string) string {
+	return NormalizeListen(listen)
+}
@@ -11,6 +11,11 @@ type Manager struct {
 	log      *logger.Logger
 	settings *settings.Manager
 	db       model.DB
+
+	// reconcile 协议修改后调用，用于重新生成并加载 Xray 配置
+	reconcile func() error
+	// applyQueue 设置后协议修改合并后由队列调用 reconcile
+	applyQueue *ApplyQueue
 }
 
 // New 创建协议管理器
@@ -32,24 +37,57 @@ func (m *Manager) GetTotalProtocols() (int64, error) {
 	return m.db.GetTotalProtocols()
 }
 
+// SearchProtocols 按关键词搜索协议，结果按相关度排序并附带命中位置
+func (m *Manager) SearchProtocols(query string) ([]*model.ProtocolSearchResult, error) {
+	protocols, err := m.db.SearchProtocols(query)
+	if err != nil {
+		return nil, err
+	}
+	return model.RankProtocols(model.SearchTerms(query), protocols), nil
+}
+
 // GetProtocol 获取指定协议
 func (m *Manager) GetProtocol(id int64) (*model.Protocol, error) {
 	return m.db.GetProtocol(id)
 }
 
+// ResolveID 将 API 中的协议标识（自增 ID 或 UUID）解析为自增 ID
+func (m *Manager) ResolveID(ref string) (int64, error) {
+	return model.ResolveProtocolID(m.db, ref)
+}
+
 // CreateProtocol 创建协议
 func (m *Manager) CreateProtocol(protocol *model.Protocol) error {
-	return m.db.CreateProtocol(protocol)
+	return m.CreateProtocolAs(protocol, "")
+}
+
+// CreateProtocolAs 创建协议并记录创建人
+func (m *Manager) CreateProtocolAs(protocol *model.Protocol, changedBy string) error {
+	protocol.Listen = NormalizeListen(protocol.Listen)
+	if err := ValidateListenAddress(protocol.Listen); err != nil {
+		return err
+	}
+	if err := checkPortConflict(m.db, 0, protocol.Port, protocol.Listen); err != nil {
+		return err
+	}
+
+	if err := m.db.CreateProtocol(protocol); err != nil {
+		return err
+	}
+	m.saveVersion(protocol, "created", changedBy)
+	notifyProtocol(protocol, ChangeCreated)
+	return nil
 }
 
 // UpdateProtocol 更新协议
 func (m *Manager) UpdateProtocol(protocol *model.Protocol) error {
-	return m.db.UpdateProtocol(protocol)
+	return m.UpdateProtocolAs(protocol, "")
 }
 
-// DeleteProtocol 删除协议
+// DeleteProtocol 删除协议，统计数据归档，不检查最近流量
 func (m *Manager) DeleteProtocol(id int64) error {
-	return m.db.DeleteProtocol(id)
+	_, err := m.DeleteProtocolWith(id, DeleteOptions{Confirm: true, Archive: true})
+	return err
 }
 
 // GetProtocolStats 获取协议统计
@@ -67,12 +105,13 @@ func (m *Manager) GetSupportedProtocolTypes() []string {
 		"shadowsocks",
 		"socks",
 		"http",
+		"relay",
 	}
 }
 
 // Create creates a new protocol
 func (m *Manager) Create(protocol *model.Protocol) error {
-	return m.db.CreateProtocol(protocol)
+	return m.CreateProtocol(protocol)
 }
 
 // Get retrieves a protocol by ID
@@ -87,12 +126,12 @@ func (m *Manager) GetByUserID(userID int64) ([]*model.Protocol, error) {
 
 // Update updates a protocol
 func (m *Manager) Update(protocol *model.Protocol) error {
-	return m.db.UpdateProtocol(protocol)
+	return m.UpdateProtocol(protocol)
 }
 
 // Delete deletes a protocol
 func (m *Manager) Delete(id int64) error {
-	return m.db.DeleteProtocol(id)
+	return m.DeleteProtocol(id)
 }
 
 // Enable enables a protocol
@@ -103,5 +142,9 @@ func (m *Manager) Enable(id int64) error {
 	}
 
 	protocol.Enable = true
-	return m.db.UpdateProtocol(protocol)
+	if err := m.db.UpdateProtocol(protocol); err != nil {
+		return err
+	}
+	notifyProtocol(protocol, ChangeUpdated)
+	return nil
 }
@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"v/logger"
+	"v/mirror"
+	"v/model"
+)
+
+// freePort 选择一个本机空闲端口作为入站的原端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestMirrorSessionRewritesInboundAndRecordsClientHello(t *testing.T) {
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	mirrors := mirror.New(log)
+	defer mirrors.StopAll()
+
+	mgr := NewProtocolManager(log, nil, nil)
+	mgr.SetMirror(mirrors)
+
+	settings, _ := json.Marshal(model.VMessSettings{UUID: "b831381d-6324-4d53-ad4f-8cda48b30811", Network: "tcp"})
+	p := &model.Protocol{Type: "vmess", Listen: "127.0.0.1", Port: freePort(t), Settings: settings}
+	p.ID = 7
+
+	config, err := mgr.GenerateXrayConfig(p)
+	if err != nil {
+		t.Fatalf("GenerateXrayConfig: %v", err)
+	}
+	if config.Inbounds[0].Port != p.Port {
+		t.Fatalf("inbound port before mirror = %d, want %d", config.Inbounds[0].Port, p.Port)
+	}
+
+	session, err := mirrors.Start(p.ID, net.JoinHostPort(p.Listen, strconv.Itoa(p.Port)), time.Minute)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	config, err = mgr.GenerateXrayConfig(p)
+	if err != nil {
+		t.Fatalf("GenerateXrayConfig: %v", err)
+	}
+	if in := config.Inbounds[0]; in.Listen != "127.0.0.1" || in.Port != session.InternalPort {
+		t.Fatalf("inbound = %s:%d, want 127.0.0.1:%d", in.Listen, in.Port, session.InternalPort)
+	}
+
+	// 模拟按新配置监听内部端口的 Xray 入站，读取后直接关闭
+	upstream, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(session.InternalPort)))
+	if err != nil {
+		t.Fatalf("listen internal port: %v", err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4096)
+			conn.Read(buf)
+			conn.Close()
+		}
+	}()
+
+	waitFor(t, func() bool {
+		info, _, _ := mirrors.Get(p.ID)
+		return info.Status == mirror.StatusActive
+	})
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(p.Listen, strconv.Itoa(p.Port)), time.Second)
+	if err != nil {
+		t.Fatalf("dial original port: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	client := tls.Client(conn, &tls.Config{ServerName: "mirror.example.com", NextProtos: []string{"h2", "http/1.1"}})
+	client.Handshake()
+	client.Close()
+
+	var records []*mirror.Record
+	waitFor(t, func() bool {
+		_, records, _ = mirrors.Get(p.ID)
+		return len(records) > 0
+	})
+	r := records[0]
+	if !r.TLS || r.SNI != "mirror.example.com" {
+		t.Errorf("record TLS=%v SNI=%q, want TLS with mirror.example.com", r.TLS, r.SNI)
+	}
+	if len(r.ALPN) != 2 || r.ALPN[0] != "h2" {
+		t.Errorf("record ALPN = %v, want [h2 http/1.1]", r.ALPN)
+	}
+
+	if err := mirrors.Stop(p.ID); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	config, err = mgr.GenerateXrayConfig(p)
+	if err != nil {
+		t.Fatalf("GenerateXrayConfig: %v", err)
+	}
+	if config.Inbounds[0].Port != p.Port {
+		t.Errorf("inbound port after stop = %d, want %d", config.Inbounds[0].Port, p.Port)
+	}
+}
+
+// waitFor 轮询直到条件成立，超时后测试失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
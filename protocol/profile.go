@@ -0,0 +1,443 @@
+package protocol
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"v/model"
+	"v/settings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 客户端配置格式
+const (
+	ProfileClash   = "clash"
+	ProfileSingBox = "sing-box"
+)
+
+// proxyGroupName 客户端配置中汇总全部节点的代理组名称
+const proxyGroupName = "Proxy"
+
+// clientProxy 生成客户端配置所需的节点信息，由各协议配置统一转换而来
+type clientProxy struct {
+	name         string
+	typ          string
+	server       string
+	port         int
+	uuid         string
+	password     string
+	method       string
+	alterID      int
+	flow         string
+	network      string
+	host         string
+	path         string
+	tls          bool
+	sni          string
+	insecure     bool
+	realityKey   string
+	realityShort string
+	fingerprint  string // 为空时只有 REALITY 节点使用默认指纹
+	alpn         []string
+}
+
+// clientProxies 将协议转换为客户端节点，不支持的协议类型被跳过
+func (m *ProtocolManager) clientProxies(protocols []*model.Protocol) ([]*clientProxy, error) {
+	proxies := make([]*clientProxy, 0, len(protocols))
+	for _, p := range protocols {
+		cp := &clientProxy{name: p.Name, typ: p.Type, port: p.Port}
+		switch p.Type {
+		case string(model.ProtocolVMess):
+			s, err := m.GenerateVMessConfig(p)
+			if err != nil {
+				return nil, err
+			}
+			cp.uuid, cp.alterID, cp.method = s.UUID, s.AlterID, s.Security
+			cp.network, cp.host, cp.path, cp.tls, cp.insecure = s.Network, s.Host, s.Path, s.TLS, s.AllowInsecure
+			cp.sni, cp.fingerprint, cp.alpn = s.SNI, s.Fingerprint, s.ALPN
+			cp.server = clientServer(s.CDN, s.CDNAddress, s.Host)
+		case string(model.ProtocolVLESS):
+			s, err := m.GenerateVLESSConfig(p)
+			if err != nil {
+				return nil, err
+			}
+			cp.uuid, cp.flow = s.UUID, s.Flow
+			cp.network, cp.host, cp.path, cp.tls, cp.insecure = s.Network, s.Host, s.Path, s.TLS, s.AllowInsecure
+			cp.sni, cp.fingerprint, cp.alpn = s.SNI, s.Fingerprint, s.ALPN
+			cp.server = clientServer(s.CDN, s.CDNAddress, s.Host)
+			if r := s.Reality; r != nil {
+				pub, err := realityPublicKey(r.PrivateKey)
+				if err != nil {
+					return nil, fmt.Errorf("protocol %s: %v", p.Name, err)
+				}
+				cp.tls, cp.realityKey = true, pub
+				if len(r.ServerNames) > 0 {
+					cp.sni = r.ServerNames[0]
+				}
+				if len(r.ShortIDs) > 0 {
+					cp.realityShort = r.ShortIDs[0]
+				}
+			}
+		case string(model.ProtocolTrojan):
+			s, err := m.GenerateTrojanConfig(p)
+			if err != nil {
+				return nil, err
+			}
+			cp.password, cp.sni = s.Password, s.SNI
+			cp.fingerprint, cp.alpn = s.Fingerprint, s.ALPN
+			cp.network, cp.host, cp.path, cp.tls = s.Network, s.Host, s.Path, true
+			cp.server = clientServer(s.CDN, s.CDNAddress, s.Host)
+		case string(model.ProtocolShadowsocks):
+			s, err := m.GenerateShadowsocksConfig(p)
+			if err != nil {
+				return nil, err
+			}
+			cp.method, cp.password, cp.server = s.Method, s.Password, s.Host
+		default:
+			continue
+		}
+		if cp.network == "" {
+			cp.network = "tcp"
+		}
+		if cp.sni == "" && cp.tls {
+			cp.sni = cp.host
+		}
+		proxies = append(proxies, cp)
+	}
+	return proxies, nil
+}
+
+// clientServer 返回客户端连接的地址，CDN 模式下连接 CDN 优选地址
+func clientServer(cdn bool, cdnAddr, host string) string {
+	if cdn {
+		return cdnAddress(cdnAddr, host)
+	}
+	return host
+}
+
+// realityPublicKey 由 REALITY 私钥（base64url，与 xray x25519 输出相同）计算客户端使用的公钥
+func realityPublicKey(privateKey string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid reality private key: %v", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid reality private key: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// GenerateClashProfile 生成 Clash（Mihomo）配置，routing 为 nil 时所有流量走代理
+func (m *ProtocolManager) GenerateClashProfile(protocols []*model.Protocol, routing *settings.RoutingProfile) ([]byte, error) {
+	proxies, err := m.clientProxies(protocols)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(proxies)+1)
+	items := make([]map[string]interface{}, 0, len(proxies))
+	for _, p := range proxies {
+		names = append(names, p.name)
+		items = append(items, clashProxy(p))
+	}
+	names = append(names, "DIRECT")
+
+	profile := map[string]interface{}{
+		"mixed-port": 7890,
+		"mode":       "rule",
+		"proxies":    items,
+		"proxy-groups": []map[string]interface{}{
+			{"name": proxyGroupName, "type": "select", "proxies": names},
+		},
+		"rules": clashRules(routing),
+	}
+	return yaml.Marshal(profile)
+}
+
+// clashProxy 转换为 Clash 节点
+func clashProxy(p *clientProxy) map[string]interface{} {
+	out := map[string]interface{}{
+		"name":   p.name,
+		"server": p.server,
+		"port":   p.port,
+		"udp":    true,
+	}
+	switch p.typ {
+	case string(model.ProtocolVMess):
+		out["type"], out["uuid"], out["alterId"] = "vmess", p.uuid, p.alterID
+		out["cipher"] = p.method
+		if p.method == "" {
+			out["cipher"] = "auto"
+		}
+	case string(model.ProtocolVLESS):
+		out["type"], out["uuid"] = "vless", p.uuid
+		if p.flow != "" {
+			out["flow"] = p.flow
+		}
+	case string(model.ProtocolTrojan):
+		out["type"], out["password"] = "trojan", p.password
+	case string(model.ProtocolShadowsocks):
+		out["type"], out["cipher"], out["password"] = "ss", p.method, p.password
+		return out
+	}
+
+	out["network"] = p.network
+	if p.tls {
+		out["tls"] = true
+		out["servername"] = p.sni
+		if p.typ == string(model.ProtocolTrojan) {
+			delete(out, "servername")
+			out["sni"] = p.sni
+		}
+		if p.insecure {
+			out["skip-cert-verify"] = true
+		}
+		if p.fingerprint != "" {
+			out["client-fingerprint"] = clashFingerprint(p.fingerprint)
+		}
+		if len(p.alpn) > 0 {
+			out["alpn"] = p.alpn
+		}
+	}
+	if p.realityKey != "" {
+		out["reality-opts"] = map[string]interface{}{"public-key": p.realityKey, "short-id": p.realityShort}
+		out["client-fingerprint"] = clashFingerprint(p.fingerprint)
+	}
+	switch p.network {
+	case "ws":
+		out["ws-opts"] = map[string]interface{}{"path": p.path, "headers": map[string]string{"Host": p.host}}
+	case "grpc":
+		out["grpc-opts"] = map[string]interface{}{"grpc-service-name": p.path}
+	case "http":
+		out["network"] = "h2"
+		out["h2-opts"] = map[string]interface{}{"path": p.path, "host": []string{p.host}}
+	}
+	return out
+}
+
+// clashRules 按屏蔽、代理、直连的顺序生成 Clash 规则
+func clashRules(routing *settings.RoutingProfile) []string {
+	final := proxyGroupName
+	if routing == nil {
+		return []string{"MATCH," + final}
+	}
+	if routing.Final == settings.RouteDirect {
+		final = "DIRECT"
+	}
+
+	var rules []string
+	add := func(domains, ips []string, target string) {
+		for _, d := range domains {
+			rules = append(rules, clashDomainRule(d)+","+target)
+		}
+		for _, ip := range ips {
+			rules = append(rules, clashIPRule(ip, target))
+		}
+	}
+	add(routing.BlockDomains, routing.BlockIPs, "REJECT")
+	add(routing.ProxyDomains, routing.ProxyIPs, proxyGroupName)
+	add(routing.DirectDomains, routing.DirectIPs, "DIRECT")
+	return append(rules, "MATCH,"+final)
+}
+
+// clashDomainRule 转换域名规则，不含目标
+func clashDomainRule(d string) string {
+	switch {
+	case strings.HasPrefix(d, "full:"):
+		return "DOMAIN," + strings.TrimPrefix(d, "full:")
+	case strings.HasPrefix(d, "keyword:"):
+		return "DOMAIN-KEYWORD," + strings.TrimPrefix(d, "keyword:")
+	case strings.HasPrefix(d, "geosite:"):
+		return "GEOSITE," + strings.TrimPrefix(d, "geosite:")
+	default:
+		return "DOMAIN-SUFFIX," + strings.TrimPrefix(d, "domain:")
+	}
+}
+
+// clashIPRule 转换 IP 规则，IP 规则不触发 DNS 解析
+func clashIPRule(ip, target string) string {
+	if strings.HasPrefix(ip, "geoip:") {
+		return "GEOIP," + strings.ToUpper(strings.TrimPrefix(ip, "geoip:")) + "," + target + ",no-resolve"
+	}
+	cidr := routeCIDR(ip)
+	if strings.Contains(cidr, ":") {
+		return "IP-CIDR6," + cidr + "," + target + ",no-resolve"
+	}
+	return "IP-CIDR," + cidr + "," + target + ",no-resolve"
+}
+
+// routeCIDR 将单个地址转换为 CIDR
+func routeCIDR(ip string) string {
+	if strings.Contains(ip, "/") {
+		return ip
+	}
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return ip + "/128"
+	}
+	return ip + "/32"
+}
+
+// GenerateSingBoxProfile 生成 sing-box 配置，routing 为 nil 时所有流量走代理
+func (m *ProtocolManager) GenerateSingBoxProfile(protocols []*model.Protocol, routing *settings.RoutingProfile) ([]byte, error) {
+	proxies, err := m.clientProxies(protocols)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(proxies))
+	outbounds := []map[string]interface{}{}
+	for _, p := range proxies {
+		tags = append(tags, p.name)
+		outbounds = append(outbounds, singBoxOutbound(p))
+	}
+	outbounds = append([]map[string]interface{}{
+		{"type": "selector", "tag": strings.ToLower(proxyGroupName), "outbounds": append(tags, "direct")},
+	}, outbounds...)
+	outbounds = append(outbounds,
+		map[string]interface{}{"type": "direct", "tag": "direct"},
+		map[string]interface{}{"type": "block", "tag": "block"},
+	)
+
+	route := map[string]interface{}{
+		"rules":                 singBoxRules(routing),
+		"final":                 strings.ToLower(proxyGroupName),
+		"auto_detect_interface": true,
+	}
+	if routing != nil && routing.Final == settings.RouteDirect {
+		route["final"] = "direct"
+	}
+
+	profile := map[string]interface{}{
+		"inbounds": []map[string]interface{}{
+			{"type": "mixed", "tag": "mixed-in", "listen": "127.0.0.1", "listen_port": 2080},
+		},
+		"outbounds": outbounds,
+		"route":     route,
+	}
+	return json.MarshalIndent(profile, "", "  ")
+}
+
+// singBoxOutbound 转换为 sing-box 出站
+func singBoxOutbound(p *clientProxy) map[string]interface{} {
+	out := map[string]interface{}{
+		"tag":         p.name,
+		"server":      p.server,
+		"server_port": p.port,
+	}
+	switch p.typ {
+	case string(model.ProtocolVMess):
+		out["type"], out["uuid"], out["alter_id"] = "vmess", p.uuid, p.alterID
+		out["security"] = p.method
+		if p.method == "" {
+			out["security"] = "auto"
+		}
+	case string(model.ProtocolVLESS):
+		out["type"], out["uuid"] = "vless", p.uuid
+		if p.flow != "" {
+			out["flow"] = p.flow
+		}
+	case string(model.ProtocolTrojan):
+		out["type"], out["password"] = "trojan", p.password
+	case string(model.ProtocolShadowsocks):
+		out["type"], out["method"], out["password"] = "shadowsocks", p.method, p.password
+		return out
+	}
+
+	if p.tls {
+		tls := map[string]interface{}{"enabled": true, "server_name": p.sni}
+		if p.insecure {
+			tls["insecure"] = true
+		}
+		if len(p.alpn) > 0 {
+			tls["alpn"] = p.alpn
+		}
+		if p.fingerprint != "" || p.realityKey != "" {
+			tls["utls"] = map[string]interface{}{"enabled": true, "fingerprint": clientFingerprint(p.fingerprint)}
+		}
+		if p.realityKey != "" {
+			tls["reality"] = map[string]interface{}{"enabled": true, "public_key": p.realityKey, "short_id": p.realityShort}
+		}
+		out["tls"] = tls
+	}
+	switch p.network {
+	case "ws":
+		out["transport"] = map[string]interface{}{"type": "ws", "path": p.path, "headers": map[string]string{"Host": p.host}}
+	case "grpc":
+		out["transport"] = map[string]interface{}{"type": "grpc", "service_name": p.path}
+	case "http":
+		out["transport"] = map[string]interface{}{"type": "http", "path": p.path, "host": []string{p.host}}
+	}
+	return out
+}
+
+// singBoxRules 按屏蔽、代理、直连的顺序生成 sing-box 路由规则。
+// geosite 和 geoip 使用旧版规则字段，需要客户端自带对应数据库
+func singBoxRules(routing *settings.RoutingProfile) []map[string]interface{} {
+	rules := []map[string]interface{}{}
+	if routing == nil {
+		return rules
+	}
+
+	add := func(domains, ips []string, outbound string) {
+		match := map[string][]string{}
+		for _, d := range domains {
+			switch {
+			case strings.HasPrefix(d, "full:"):
+				match["domain"] = append(match["domain"], strings.TrimPrefix(d, "full:"))
+			case strings.HasPrefix(d, "keyword:"):
+				match["domain_keyword"] = append(match["domain_keyword"], strings.TrimPrefix(d, "keyword:"))
+			case strings.HasPrefix(d, "geosite:"):
+				match["geosite"] = append(match["geosite"], strings.TrimPrefix(d, "geosite:"))
+			default:
+				match["domain_suffix"] = append(match["domain_suffix"], strings.TrimPrefix(d, "domain:"))
+			}
+		}
+		for _, ip := range ips {
+			if strings.HasPrefix(ip, "geoip:") {
+				match["geoip"] = append(match["geoip"], strings.TrimPrefix(ip, "geoip:"))
+			} else {
+				match["ip_cidr"] = append(match["ip_cidr"], routeCIDR(ip))
+			}
+		}
+		// sing-box 同一条规则内的不同字段为“与”关系，每个字段单独生成规则
+		for _, field := range []string{"domain", "domain_suffix", "domain_keyword", "geosite", "ip_cidr", "geoip"} {
+			if values := match[field]; len(values) > 0 {
+				rules = append(rules, map[string]interface{}{field: values, "outbound": outbound})
+			}
+		}
+	}
+	add(routing.BlockDomains, routing.BlockIPs, "block")
+	add(routing.ProxyDomains, routing.ProxyIPs, strings.ToLower(proxyGroupName))
+	add(routing.DirectDomains, routing.DirectIPs, "direct")
+	return rules
+}
+
+// xrayBlockRules 服务端执行的分流方案屏蔽规则，只匹配指定入站的流量
+func xrayBlockRules(routing *settings.RoutingProfile, inboundTag string) []XrayRoutingRule {
+	if routing == nil || !routing.ServerSide {
+		return nil
+	}
+
+	var rules []XrayRoutingRule
+	if len(routing.BlockDomains) > 0 {
+		domains := make([]string, 0, len(routing.BlockDomains))
+		for _, d := range routing.BlockDomains {
+			// Xray 中不带前缀的域名是子串匹配，统一转换为后缀匹配
+			if !strings.Contains(d, ":") {
+				d = "domain:" + d
+			}
+			domains = append(domains, d)
+		}
+		rules = append(rules, XrayRoutingRule{Type: "field", InboundTag: []string{inboundTag}, Domain: domains, OutboundTag: "blocked"})
+	}
+	if len(routing.BlockIPs) > 0 {
+		rules = append(rules, XrayRoutingRule{Type: "field", InboundTag: []string{inboundTag}, IP: routing.BlockIPs, OutboundTag: "blocked"})
+	}
+	return rules
+}
@@ -3,6 +3,7 @@ package protocol
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"path/filepath"
 
 	"v/logger"
@@ -15,6 +16,23 @@ type ProtocolManager struct {
 	logger   *logger.Logger
 	settings *settings.Manager
 	db       model.DB
+	mirror   MirrorSource
+	limiter  MirrorSource
+}
+
+// MirrorSource 提供处于调试模式的入站，这些入站临时监听本机端口，由面板在原端口转发并记录连接
+type MirrorSource interface {
+	Redirect(protocolID int64) (port int, ok bool)
+}
+
+// SetMirror 设置入站调试模式来源
+func (m *ProtocolManager) SetMirror(src MirrorSource) {
+	m.mirror = src
+}
+
+// SetConnLimiter 设置入站并发连接数限制来源，限制连接数的入站同样改为监听本机端口，由面板在原端口计数并转发
+func (m *ProtocolManager) SetConnLimiter(src MirrorSource) {
+	m.limiter = src
 }
 
 // NewProtocolManager 创建协议管理器
@@ -29,7 +47,7 @@ func NewProtocolManager(logger *logger.Logger, settings *settings.Manager, db mo
 // Create 创建协议配置
 func (m *ProtocolManager) Create(userID int64, protocolType model.ProtocolType, name string, port int, settings interface{}) (*model.Protocol, error) {
 	// 验证端口是否可用
-	if err := m.validatePort(port); err != nil {
+	if err := m.validatePort(0, port, ""); err != nil {
 		return nil, err
 	}
 
@@ -76,8 +94,13 @@ func (m *ProtocolManager) GetByUserID(userID int64) ([]*model.Protocol, error) {
 
 // Update 更新协议配置
 func (m *ProtocolManager) Update(protocol *model.Protocol) error {
+	// 验证监听地址
+	if err := ValidateListenAddress(protocol.Listen); err != nil {
+		return err
+	}
+
 	// 验证端口是否可用
-	if err := m.validatePort(protocol.Port); err != nil {
+	if err := m.validatePort(protocol.ID, protocol.Port, protocol.Listen); err != nil {
 		return err
 	}
 
@@ -122,20 +145,33 @@ func (m *ProtocolManager) UpdateTraffic(id int64, upload, download int64) error
 	return m.Update(protocol)
 }
 
-// validatePort 验证端口是否可用
-func (m *ProtocolManager) validatePort(port int) error {
+// validatePort 验证端口是否可用，id 为正在修改的协议，创建时为 0
+func (m *ProtocolManager) validatePort(id int64, port int, listen string) error {
+	return checkPortConflict(m.db, id, port, listen)
+}
+
+// checkPortConflict 检查端口是否与其他协议冲突，监听不同地址的协议可以共用端口，
+// exclude 协议自身不算冲突，修改时保留原端口可以通过
+func checkPortConflict(db model.DB, exclude int64, port int, listen string) error {
+	// Unix 域套接字不占用端口
+	if isSocketListen(NormalizeListen(listen)) {
+		return nil
+	}
 	if port < 1 || port > 65535 {
-		return errors.New("invalid port number")
+		return ErrInvalidPort
 	}
 
-	// 检查端口是否已被使用
-	protocols, err := m.db.GetProtocolsByPort(port)
+	protocols, err := db.GetProtocolsByPort(port)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to check port: %v", err)
 	}
-
-	if len(protocols) > 0 {
-		return errors.New("port already in use")
+	for _, p := range protocols {
+		if p.ID == exclude {
+			continue
+		}
+		if listenOverlaps(p.Listen, listen) {
+			return ErrPortInUse
+		}
 	}
 
 	return nil
@@ -177,6 +213,15 @@ func (m *ProtocolManager) GenerateShadowsocksConfig(protocol *model.Protocol) (*
 	return &settings, nil
 }
 
+// GenerateRelayConfig 生成端口中转配置
+func (m *ProtocolManager) GenerateRelayConfig(protocol *model.Protocol) (*model.RelaySettings, error) {
+	var settings model.RelaySettings
+	if err := json.Unmarshal(protocol.Settings, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
 // ValidateVMessSettings 验证 VMess 配置
 func (m *ProtocolManager) ValidateVMessSettings(settings *model.VMessSettings) error {
 	if settings.UUID == "" {
@@ -194,7 +239,13 @@ func (m *ProtocolManager) ValidateVMessSettings(settings *model.VMessSettings) e
 	if settings.Host == "" {
 		return errors.New("host is required")
 	}
-	return nil
+	if err := m.validateQUIC(settings.Network, settings.TLS, settings.CDN, &settings.QUIC); err != nil {
+		return err
+	}
+	if err := validateSockopt(settings.Network, settings.Sockopt); err != nil {
+		return err
+	}
+	return validateTLSClientOptions(settings.Fingerprint, settings.ALPN)
 }
 
 // ValidateVLESSSettings 验证 VLESS 配置
@@ -208,7 +259,13 @@ func (m *ProtocolManager) ValidateVLESSSettings(settings *model.VLESSSettings) e
 	if settings.Host == "" {
 		return errors.New("host is required")
 	}
-	return nil
+	if err := m.validateQUIC(settings.Network, settings.TLS && settings.Reality == nil, settings.CDN, &settings.QUIC); err != nil {
+		return err
+	}
+	if err := validateSockopt(settings.Network, settings.Sockopt); err != nil {
+		return err
+	}
+	return validateTLSClientOptions(settings.Fingerprint, settings.ALPN)
 }
 
 // ValidateTrojanSettings 验证 Trojan 配置
@@ -222,7 +279,13 @@ func (m *ProtocolManager) ValidateTrojanSettings(settings *model.TrojanSettings)
 	if settings.Host == "" {
 		return errors.New("host is required")
 	}
-	return nil
+	if err := m.validateQUIC(settings.Network, true, settings.CDN, &settings.QUIC); err != nil {
+		return err
+	}
+	if err := validateSockopt(settings.Network, settings.Sockopt); err != nil {
+		return err
+	}
+	return validateTLSClientOptions(settings.Fingerprint, settings.ALPN)
 }
 
 // ValidateShadowsocksSettings 验证 Shadowsocks 配置
@@ -239,7 +302,29 @@ func (m *ProtocolManager) ValidateShadowsocksSettings(settings *model.Shadowsock
 	if settings.Host == "" {
 		return errors.New("host is required")
 	}
-	return nil
+	return validateSockopt(settings.Network, settings.Sockopt)
+}
+
+// ValidateRelaySettings 验证端口中转配置
+func (m *ProtocolManager) ValidateRelaySettings(settings *model.RelaySettings) error {
+	if settings.TargetHost == "" {
+		return errors.New("target host is required")
+	}
+	if settings.TargetPort < 1 || settings.TargetPort > 65535 {
+		return errors.New("target port must be between 1 and 65535")
+	}
+	if settings.Network == "" {
+		settings.Network = "tcp"
+	}
+	switch settings.Network {
+	case "tcp", "udp", "tcp,udp":
+	default:
+		return errors.New("network must be tcp, udp or tcp,udp")
+	}
+	if settings.Timeout < 0 {
+		return errors.New("timeout must be non-negative")
+	}
+	return validateSockopt(settings.Network, settings.Sockopt)
 }
 
 // ValidateProtocolSettings 验证协议配置
@@ -268,6 +353,11 @@ func (m *ProtocolManager) ValidateProtocolSettings(protocolType model.ProtocolTy
 			return m.ValidateShadowsocksSettings(ssSettings)
 		}
 		return errors.New("invalid Shadowsocks settings")
+	case "relay":
+		if relaySettings, ok := settings.(*model.RelaySettings); ok {
+			return m.ValidateRelaySettings(relaySettings)
+		}
+		return errors.New("invalid Relay settings")
 	default:
 		return errors.New("unsupported protocol")
 	}
@@ -300,6 +390,7 @@ type XrayOutbound struct {
 	Settings       interface{}         `json:"settings"`
 	StreamSettings *XrayStreamSettings `json:"streamSettings,omitempty"`
 	Tag            string              `json:"tag,omitempty"`
+	SendThrough    string              `json:"sendThrough,omitempty"`
 	ProxySettings  *XrayProxySettings  `json:"proxySettings,omitempty"`
 	Mux            *XrayMuxConfig      `json:"mux,omitempty"`
 }
@@ -400,6 +491,11 @@ type XraySockoptConfig struct {
 	DomainStrategy       string `json:"domainStrategy,omitempty"`
 	DialerProxy          string `json:"dialerProxy,omitempty"`
 	TCPKeepAliveInterval int    `json:"tcpKeepAliveInterval,omitempty"`
+	TCPKeepAliveIdle     int    `json:"tcpKeepAliveIdle,omitempty"`
+	TCPUserTimeout       int    `json:"tcpUserTimeout,omitempty"`
+	TCPMaxSeg            int    `json:"tcpMaxSeg,omitempty"`
+	TCPCongestion        string `json:"tcpCongestion,omitempty"`
+	TCPMptcp             bool   `json:"tcpMptcp,omitempty"`
 }
 
 // XraySniffingConfig Xray 流量嗅探配置
@@ -407,6 +503,7 @@ type XraySniffingConfig struct {
 	Enabled      bool     `json:"enabled"`
 	DestOverride []string `json:"destOverride"`
 	MetadataOnly bool     `json:"metadataOnly,omitempty"`
+	RouteOnly    bool     `json:"routeOnly,omitempty"`
 }
 
 // XrayRoutingConfig Xray 路由配置
@@ -451,10 +548,11 @@ type XrayLogConfig struct {
 
 // XrayDNSConfig Xray DNS 配置
 type XrayDNSConfig struct {
-	Servers  []interface{}     `json:"servers"`
-	Hosts    map[string]string `json:"hosts,omitempty"`
-	ClientIP string            `json:"clientIp,omitempty"`
-	Tag      string            `json:"tag,omitempty"`
+	Servers      []interface{}     `json:"servers"`
+	Hosts        map[string]string `json:"hosts,omitempty"`
+	ClientIP     string            `json:"clientIp,omitempty"`
+	Tag          string            `json:"tag,omitempty"`
+	DisableCache bool              `json:"disableCache,omitempty"`
 }
 
 // XrayPolicyConfig Xray 策略配置
@@ -493,6 +591,15 @@ type XrayMuxConfig struct {
 	Concurrency int  `json:"concurrency,omitempty"`
 }
 
+// XrayDokodemoSettings Xray dokodemo-door 设置
+type XrayDokodemoSettings struct {
+	Address        string `json:"address"`
+	Port           int    `json:"port"`
+	Network        string `json:"network"`
+	Timeout        int    `json:"timeout,omitempty"`
+	FollowRedirect bool   `json:"followRedirect"`
+}
+
 // XrayFreedomSettings Xray freedom设置
 type XrayFreedomSettings struct {
 	DomainStrategy string `json:"domainStrategy,omitempty"`
@@ -502,6 +609,11 @@ type XrayFreedomSettings struct {
 
 // GenerateXrayConfig 生成 Xray 配置
 func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayConfig, error) {
+	var xraySettings settings.XraySettings
+	if m.settings != nil {
+		xraySettings = m.settings.Get().Xray
+	}
+
 	config := &XrayConfig{
 		Log: XrayLogConfig{
 			Access:   "none",
@@ -511,7 +623,7 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 		Inbounds:  make([]XrayInbound, 0),
 		Outbounds: make([]XrayOutbound, 0),
 		Routing: XrayRoutingConfig{
-			DomainStrategy: "AsIs",
+			DomainStrategy: xraySettings.RoutingStrategy(),
 			Rules: []XrayRoutingRule{
 				{
 					Type:        "field",
@@ -521,6 +633,12 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 			},
 		},
 	}
+	if xraySettings.DNSDisableCache {
+		config.DNS = &XrayDNSConfig{
+			Servers:      []interface{}{"localhost"},
+			DisableCache: true,
+		}
+	}
 
 	// 根据协议类型生成相应配置
 	var settings interface{}
@@ -542,8 +660,13 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 				if vmessSettings.TLS {
 					streamSettings.Security = "tls"
 					streamSettings.TLS = &XrayTLSConfig{
-						ServerName:    vmessSettings.Host,
+						ServerName:    tlsServerName(vmessSettings.SNI, vmessSettings.Host),
 						AllowInsecure: vmessSettings.AllowInsecure,
+						Alpn:          vmessSettings.ALPN,
+					}
+					streamSettings.TLS.Certificates, err = m.xrayCertificates(vmessSettings.CertFile, vmessSettings.KeyFile)
+					if err != nil {
+						return nil, err
 					}
 				}
 
@@ -561,12 +684,19 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 						Path: vmessSettings.Path,
 						Host: []string{vmessSettings.Host},
 					}
+				case quicTransport:
+					if !m.quicEnabled() {
+						return nil, errQUICDisabled
+					}
+					streamSettings.QUIC = xrayQUICConfig(vmessSettings.QUIC)
 				}
+				streamSettings.Sockopt = xraySockopt(vmessSettings.Sockopt)
 
 				// 配置入站
 				config.Inbounds = append(config.Inbounds, XrayInbound{
 					Port:           protocol.Port,
 					Protocol:       protocol.Type,
+					Listen:         xrayListen(protocol.Listen),
 					Settings:       settings,
 					StreamSettings: streamSettings,
 					Sniffing: &XraySniffingConfig{
@@ -587,12 +717,25 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 					Network: vlessSettings.Network,
 				}
 
-				// 检查并设置 TLS
-				if vlessSettings.TLS {
+				// 检查并设置 TLS，配置了 REALITY 时优先使用 REALITY
+				if reality := vlessSettings.Reality; reality != nil {
+					streamSettings.Security = "reality"
+					streamSettings.Reality = &XrayRealityConfig{
+						Dest:        reality.Dest,
+						ServerNames: reality.ServerNames,
+						PrivateKey:  reality.PrivateKey,
+						ShortIds:    reality.ShortIDs,
+					}
+				} else if vlessSettings.TLS {
 					streamSettings.Security = "tls"
 					streamSettings.TLS = &XrayTLSConfig{
-						ServerName:    vlessSettings.Host,
+						ServerName:    tlsServerName(vlessSettings.SNI, vlessSettings.Host),
 						AllowInsecure: vlessSettings.AllowInsecure,
+						Alpn:          vlessSettings.ALPN,
+					}
+					streamSettings.TLS.Certificates, err = m.xrayCertificates(vlessSettings.CertFile, vlessSettings.KeyFile)
+					if err != nil {
+						return nil, err
 					}
 				}
 
@@ -614,12 +757,19 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 					streamSettings.GRPC = &XrayGRPCConfig{
 						ServiceName: vlessSettings.Path,
 					}
+				case quicTransport:
+					if !m.quicEnabled() {
+						return nil, errQUICDisabled
+					}
+					streamSettings.QUIC = xrayQUICConfig(vlessSettings.QUIC)
 				}
+				streamSettings.Sockopt = xraySockopt(vlessSettings.Sockopt)
 
 				// 配置入站
 				config.Inbounds = append(config.Inbounds, XrayInbound{
 					Port:           protocol.Port,
 					Protocol:       protocol.Type,
+					Listen:         xrayListen(protocol.Listen),
 					Settings:       settings,
 					StreamSettings: streamSettings,
 					Sniffing: &XraySniffingConfig{
@@ -644,15 +794,13 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 				streamSettings.Security = "tls"
 
 				// 设置 SNI，优先使用 SNI 字段，如果为空则使用 Host 字段
-				var serverName string
-				if trojanSettings.SNI != "" {
-					serverName = trojanSettings.SNI
-				} else {
-					serverName = trojanSettings.Host
-				}
-
 				streamSettings.TLS = &XrayTLSConfig{
-					ServerName: serverName,
+					ServerName: tlsServerName(trojanSettings.SNI, trojanSettings.Host),
+					Alpn:       trojanSettings.ALPN,
+				}
+				streamSettings.TLS.Certificates, err = m.xrayCertificates(trojanSettings.CertFile, trojanSettings.KeyFile)
+				if err != nil {
+					return nil, err
 				}
 
 				// 根据网络类型设置特定配置
@@ -668,12 +816,19 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 					streamSettings.GRPC = &XrayGRPCConfig{
 						ServiceName: trojanSettings.Path,
 					}
+				case quicTransport:
+					if !m.quicEnabled() {
+						return nil, errQUICDisabled
+					}
+					streamSettings.QUIC = xrayQUICConfig(trojanSettings.QUIC)
 				}
+				streamSettings.Sockopt = xraySockopt(trojanSettings.Sockopt)
 
 				// 配置入站
 				config.Inbounds = append(config.Inbounds, XrayInbound{
 					Port:           protocol.Port,
 					Protocol:       protocol.Type,
+					Listen:         xrayListen(protocol.Listen),
 					Settings:       settings,
 					StreamSettings: streamSettings,
 					Sniffing: &XraySniffingConfig{
@@ -704,11 +859,13 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 						},
 					}
 				}
+				streamSettings.Sockopt = xraySockopt(ssSettings.Sockopt)
 
 				// 配置入站
 				config.Inbounds = append(config.Inbounds, XrayInbound{
 					Port:           protocol.Port,
 					Protocol:       protocol.Type,
+					Listen:         xrayListen(protocol.Listen),
 					Settings:       settings,
 					StreamSettings: streamSettings,
 					Sniffing: &XraySniffingConfig{
@@ -718,6 +875,45 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 				})
 			}
 		}
+	case "relay":
+		var relaySettings *model.RelaySettings
+		relaySettings, err = m.GenerateRelayConfig(protocol)
+		if err == nil {
+			if err = m.ValidateRelaySettings(relaySettings); err != nil {
+				return nil, err
+			}
+			settings = relaySettings
+
+			// 中转使用 dokodemo-door 固定转发到目标地址，不嗅探目标以免被改写；
+			// TLS 透传时只读取 SNI 供路由和日志使用
+			inbound := XrayInbound{
+				Port:     protocol.Port,
+				Protocol: "dokodemo-door",
+				Listen:   xrayListen(protocol.Listen),
+				Settings: XrayDokodemoSettings{
+					Address: relaySettings.TargetHost,
+					Port:    relaySettings.TargetPort,
+					Network: relaySettings.Network,
+					Timeout: relaySettings.Timeout,
+				},
+				// 流量统计按 inbound-<ID> 标签归属到协议
+				Tag: fmt.Sprintf("inbound-%d", protocol.ID),
+			}
+			if sockopt := xraySockopt(relaySettings.Sockopt); sockopt != nil {
+				inbound.StreamSettings = &XrayStreamSettings{
+					Network: "tcp",
+					Sockopt: sockopt,
+				}
+			}
+			if relaySettings.TLSPassthrough {
+				inbound.Sniffing = &XraySniffingConfig{
+					Enabled:      true,
+					DestOverride: []string{"tls"},
+					RouteOnly:    true,
+				}
+			}
+			config.Inbounds = append(config.Inbounds, inbound)
+		}
 	default:
 		return nil, errors.New("unsupported protocol type")
 	}
@@ -731,6 +927,7 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 		config.Inbounds = append(config.Inbounds, XrayInbound{
 			Port:     protocol.Port,
 			Protocol: protocol.Type,
+			Listen:   xrayListen(protocol.Listen),
 			Settings: settings,
 			Sniffing: &XraySniffingConfig{
 				Enabled:      true,
@@ -744,8 +941,10 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 		Protocol: "freedom",
 		Tag:      "direct",
 		Settings: XrayFreedomSettings{
-			DomainStrategy: "UseIP",
+			DomainStrategy: xraySettings.OutboundStrategy("direct"),
 		},
+		// 多 IP 服务器上按协议所属分组选择出口 IP
+		SendThrough: xraySettings.EgressIP("direct", protocol.Tags),
 		Mux: &XrayMuxConfig{
 			Enabled:     true,
 			Concurrency: 8,
@@ -759,5 +958,31 @@ func (m *ProtocolManager) GenerateXrayConfig(protocol *model.Protocol) (*XrayCon
 		Settings: map[string]interface{}{},
 	})
 
+	// 调试模式和限制连接数的入站改为监听本机内部端口，原端口由面板接收连接后转发，调试模式优先
+	if protocol.Type != "relay" {
+		for _, src := range []MirrorSource{m.mirror, m.limiter} {
+			if src == nil {
+				continue
+			}
+			if port, ok := src.Redirect(protocol.ID); ok {
+				config.Inbounds[0].Listen = "127.0.0.1"
+				config.Inbounds[0].Port = port
+				break
+			}
+		}
+	}
+
+	// 协议所属用户的分流方案要求服务端执行时，在服务端屏蔽方案中的目标
+	if m.settings != nil {
+		routing := m.settings.Get().Routing.ProfileFor(protocol.UserID, protocol.Tags)
+		if routing != nil && routing.ServerSide {
+			inbound := &config.Inbounds[0]
+			if inbound.Tag == "" {
+				inbound.Tag = fmt.Sprintf("inbound-%d", protocol.ID)
+			}
+			config.Routing.Rules = append(config.Routing.Rules, xrayBlockRules(routing, inbound.Tag)...)
+		}
+	}
+
 	return config, nil
 }
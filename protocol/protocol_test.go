@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	"v/model"
+)
+
+// portDB 只实现按端口查询协议，其余方法未实现
+type portDB struct {
+	model.DB
+	protocols []*model.Protocol
+}
+
+func (d *portDB) GetProtocolsByPort(port int) ([]*model.Protocol, error) {
+	var found []*model.Protocol
+	for _, p := range d.protocols {
+		if p.Port == port {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func TestCheckPortConflict(t *testing.T) {
+	existing := func(id int64, port int, listen string) *model.Protocol {
+		p := &model.Protocol{Port: port, Listen: listen}
+		p.ID = id
+		return p
+	}
+	db := &portDB{protocols: []*model.Protocol{
+		existing(1, 443, ""),
+		existing(2, 8443, "127.0.0.1"),
+	}}
+
+	tests := []struct {
+		name    string
+		exclude int64
+		port    int
+		listen  string
+		want    error
+	}{
+		{name: "free port", port: 10086},
+		{name: "create on used port", port: 443, want: ErrPortInUse},
+		{name: "update keeps its own port", exclude: 1, port: 443},
+		{name: "update moves onto another protocol's port", exclude: 1, port: 8443, listen: "127.0.0.1", want: ErrPortInUse},
+		{name: "wildcard overlaps specific address", exclude: 1, port: 8443, want: ErrPortInUse},
+		{name: "different address shares port", port: 8443, listen: "127.0.0.2"},
+		{name: "unix socket needs no port", port: 0, listen: "/run/xray.sock"},
+		{name: "port out of range", port: 70000, want: ErrInvalidPort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkPortConflict(db, tt.exclude, tt.port, tt.listen); !errors.Is(err, tt.want) {
+				t.Errorf("checkPortConflict = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
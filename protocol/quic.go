@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"v/model"
+)
+
+// QUICSecurities QUIC 数据包加密方式
+var QUICSecurities = []string{"none", "aes-128-gcm", "chacha20-poly1305"}
+
+// QUICHeaderTypes QUIC 数据包伪装类型
+var QUICHeaderTypes = []string{"none", "srtp", "utp", "wechat-video", "dtls", "wireguard"}
+
+// quicTransport 设置中 QUIC 传输开关的名称
+const quicTransport = "quic"
+
+// errQUICDisabled 传输设置中未启用 QUIC
+var errQUICDisabled = errors.New("quic transport is disabled in transport settings")
+
+// quicEnabled 判断是否在传输设置中启用了实验性的 QUIC 传输
+func (m *ProtocolManager) quicEnabled() bool {
+	return m.settings != nil && m.settings.Get().Transports[quicTransport]
+}
+
+// validateQUIC 验证 QUIC 传输配置并补全默认值。QUIC 必须启用 TLS，且不支持 CDN 和 REALITY
+func (m *ProtocolManager) validateQUIC(network string, tls, cdn bool, quic **model.QUICSettings) error {
+	if network != quicTransport {
+		return nil
+	}
+	if !m.quicEnabled() {
+		return errQUICDisabled
+	}
+	if !tls {
+		return errors.New("quic transport requires tls")
+	}
+	if cdn {
+		return errors.New("quic transport cannot be used with cdn")
+	}
+
+	if *quic == nil {
+		*quic = &model.QUICSettings{}
+	}
+	q := *quic
+	if q.Security == "" {
+		q.Security = "none"
+	}
+	if q.HeaderType == "" {
+		q.HeaderType = "none"
+	}
+	if !contains(QUICSecurities, q.Security) {
+		return fmt.Errorf("unsupported quic security %q, expected one of %s", q.Security, strings.Join(QUICSecurities, ", "))
+	}
+	if !contains(QUICHeaderTypes, q.HeaderType) {
+		return fmt.Errorf("unsupported quic header type %q, expected one of %s", q.HeaderType, strings.Join(QUICHeaderTypes, ", "))
+	}
+	if q.Security != "none" && q.Key == "" {
+		return errors.New("quic key is required when quic security is enabled")
+	}
+	return nil
+}
+
+// xrayQUICConfig 生成 Xray quicSettings，未设置的字段使用 none
+func xrayQUICConfig(q *model.QUICSettings) *XrayQUICConfig {
+	config := &XrayQUICConfig{Security: "none"}
+	config.Header.Type = "none"
+	if q == nil {
+		return config
+	}
+	if q.Security != "" {
+		config.Security = q.Security
+	}
+	if config.Security != "none" {
+		config.Key = q.Key
+	}
+	if q.HeaderType != "" {
+		config.Header.Type = q.HeaderType
+	}
+	return config
+}
+
+// quicLinkParams 生成 VLESS/Trojan 分享链接中的 QUIC 参数
+func quicLinkParams(q *model.QUICSettings) []string {
+	config := xrayQUICConfig(q)
+	params := []string{
+		"type=" + quicTransport,
+		"quicSecurity=" + config.Security,
+		"headerType=" + config.Header.Type,
+	}
+	if config.Key != "" {
+		params = append(params, "key="+url.QueryEscape(config.Key))
+	}
+	return params
+}
@@ -0,0 +1,197 @@
+package protocol
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"v/heartbeat"
+	"v/logger"
+	"v/model"
+)
+
+// scheduleInterval 检查协议计划的间隔，计划时段精确到分钟
+const scheduleInterval = 30 * time.Second
+
+// scheduleActor 按计划修改协议时记录的修改人
+const scheduleActor = "scheduler"
+
+// GetSchedule 获取协议的定时计划，没有计划时返回 nil
+func (m *Manager) GetSchedule(protocolID int64) (*model.ProtocolSchedule, error) {
+	return m.db.GetProtocolSchedule(protocolID)
+}
+
+// SaveSchedule 保存协议的定时计划，新计划在下一次检查时立即按当前时段生效
+func (m *Manager) SaveSchedule(schedule *model.ProtocolSchedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	p, err := m.db.GetProtocol(schedule.ProtocolID)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return model.ErrNotFound
+	}
+
+	old, err := m.db.GetProtocolSchedule(schedule.ProtocolID)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		schedule.ID = old.ID
+		schedule.CreatedAt = old.CreatedAt
+		schedule.LastApplied = old.LastApplied
+	}
+	schedule.LastState = nil
+	schedule.LastError = ""
+	return m.db.SaveProtocolSchedule(schedule)
+}
+
+// DeleteSchedule 删除协议的定时计划，协议保持当前状态
+func (m *Manager) DeleteSchedule(protocolID int64) error {
+	return m.db.DeleteProtocolSchedule(protocolID)
+}
+
+// ApplySchedules 按计划启用或停用协议，有协议状态变化时同步 Xray 配置。
+// 只在计划要求的状态发生变化时修改协议，两次变化之间的手动启用或停用会保留到下一个时段边界
+func (m *Manager) ApplySchedules(now time.Time) (int, error) {
+	schedules, err := m.db.ListProtocolSchedules()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list protocol schedules: %v", err)
+	}
+
+	local := now.In(m.settings.Location())
+	changed := 0
+	for _, s := range schedules {
+		if !s.Enabled {
+			continue
+		}
+		want := s.ActiveAt(local)
+		if s.LastState != nil && *s.LastState == want {
+			continue
+		}
+
+		applied, err := m.applySchedule(s, want)
+		s.LastError = ""
+		if err != nil {
+			s.LastError = err.Error()
+			m.log.ErrorWithFields("Failed to apply protocol schedule", logger.Fields{
+				"protocol_id": s.ProtocolID,
+				"enable":      want,
+				"error":       err.Error(),
+			})
+		} else {
+			s.LastState = &want
+			if applied {
+				s.LastApplied = &now
+				changed++
+			}
+		}
+		if err := m.db.SaveProtocolSchedule(s); err != nil {
+			return changed, err
+		}
+	}
+
+	if changed > 0 {
+		if _, err := m.RequestApply("protocol schedules"); err != nil {
+			return changed, fmt.Errorf("failed to reconcile after applying schedules: %v", err)
+		}
+	}
+	return changed, nil
+}
+
+// applySchedule 将协议设置为计划要求的状态，返回是否有修改
+func (m *Manager) applySchedule(s *model.ProtocolSchedule, enable bool) (bool, error) {
+	p, err := m.db.GetProtocol(s.ProtocolID)
+	if err != nil {
+		return false, err
+	}
+	if p == nil {
+		return false, model.ErrNotFound
+	}
+	if p.Enable == enable {
+		return false, nil
+	}
+
+	p.Enable = enable
+	if err := m.UpdateProtocolAs(p, scheduleActor); err != nil {
+		return false, err
+	}
+	m.log.WithFields("Protocol state changed by schedule", logger.Fields{
+		"protocol_id": p.ID,
+		"name":        p.Name,
+		"enable":      enable,
+	})
+	return true, nil
+}
+
+// Scheduler 定期执行协议计划
+type Scheduler struct {
+	log *logger.Logger
+	mgr *Manager
+
+	heartbeat *heartbeat.Pinger
+
+	mu     sync.Mutex
+	stopCh chan struct{}
+}
+
+// NewScheduler 创建协议计划执行器
+func NewScheduler(log *logger.Logger, mgr *Manager) *Scheduler {
+	return &Scheduler{
+		log: log,
+		mgr: mgr,
+	}
+}
+
+// SetHeartbeat 设置外部心跳，每次检查成功后上报
+func (s *Scheduler) SetHeartbeat(h *heartbeat.Pinger) {
+	s.heartbeat = h
+}
+
+// Start 启动定期检查，启动时立即执行一次
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopCh != nil {
+		return
+	}
+	s.stopCh = make(chan struct{})
+	go s.run(s.stopCh)
+}
+
+// Stop 停止定期检查
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopCh != nil {
+		close(s.stopCh)
+		s.stopCh = nil
+	}
+}
+
+// run 检查循环
+func (s *Scheduler) run(stopCh chan struct{}) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.mgr.ApplySchedules(time.Now()); err != nil {
+			s.log.WarnWithFields("Failed to apply protocol schedules", logger.Fields{
+				"error": err.Error(),
+			})
+			s.heartbeat.Fail(heartbeat.JobScheduler, err)
+		} else {
+			s.heartbeat.Success(heartbeat.JobScheduler)
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
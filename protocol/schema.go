@@ -0,0 +1,241 @@
+package protocol
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"v/model"
+)
+
+// FieldSchema 单个配置字段的描述
+type FieldSchema struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Required bool           `json:"required"`
+	Enum     []string       `json:"enum,omitempty"`
+	Default  interface{}    `json:"default,omitempty"`
+	Fields   []*FieldSchema `json:"fields,omitempty"` // 对象类型字段的子字段
+}
+
+// ProtocolSchema 协议配置的描述，供前端和第三方工具动态生成表单
+type ProtocolSchema struct {
+	Type       string         `json:"type"`
+	Networks   []string       `json:"networks"`
+	Securities []string       `json:"securities"`
+	Fields     []*FieldSchema `json:"fields"`
+}
+
+// SchemaSet 全部协议的配置描述
+type SchemaSet struct {
+	Common    []*FieldSchema    `json:"common"`
+	Protocols []*ProtocolSchema `json:"protocols"`
+}
+
+// protocolSpec 协议配置中无法从结构体推导的约束，与 Validate*Settings 和 GenerateXrayConfig 保持一致
+type protocolSpec struct {
+	settings   interface{}
+	networks   []string
+	securities []string
+	required   []string
+	enums      map[string][]string
+	defaults   map[string]interface{}
+}
+
+// fingerprintEnum uTLS 指纹的可选值，空值表示使用默认指纹
+var fingerprintEnum = append([]string{""}, SupportedFingerprints...)
+
+var protocolSpecs = map[string]protocolSpec{
+	"vmess": {
+		settings:   model.VMessSettings{},
+		networks:   []string{"tcp", "ws", "http", "quic"},
+		securities: []string{"none", "tls"},
+		required:   []string{"uuid", "host"},
+		enums: map[string][]string{
+			"security":    {"auto", "aes-128-gcm", "chacha20-poly1305", "none", "zero"},
+			"fingerprint": fingerprintEnum,
+		},
+		defaults: map[string]interface{}{"security": "auto", "alterId": 0},
+	},
+	"vless": {
+		settings:   model.VLESSSettings{},
+		networks:   []string{"tcp", "ws", "http", "grpc", "quic"},
+		securities: []string{"none", "tls"},
+		required:   []string{"uuid", "host"},
+		enums: map[string][]string{
+			"flow":        {"", "xtls-rprx-vision"},
+			"fingerprint": fingerprintEnum,
+		},
+	},
+	"trojan": {
+		settings:   model.TrojanSettings{},
+		networks:   []string{"tcp", "ws", "grpc", "quic"},
+		securities: []string{"tls"},
+		required:   []string{"password", "host"},
+		enums: map[string][]string{
+			"fingerprint": fingerprintEnum,
+		},
+		defaults: map[string]interface{}{"tls": true},
+	},
+	"shadowsocks": {
+		settings:   model.ShadowsocksSettings{},
+		networks:   []string{"tcp", "ws"},
+		securities: []string{"none"},
+		required:   []string{"method", "password", "host"},
+		enums: map[string][]string{
+			"method": {
+				"aes-128-gcm", "aes-256-gcm", "chacha20-poly1305",
+				"2022-blake3-aes-128-gcm", "2022-blake3-aes-256-gcm", "2022-blake3-chacha20-poly1305",
+			},
+		},
+		defaults: map[string]interface{}{"method": "aes-256-gcm"},
+	},
+	"socks": {
+		settings:   model.SocksSettings{},
+		networks:   []string{"tcp"},
+		securities: []string{"none"},
+		enums: map[string][]string{
+			"auth": {"noauth", "password"},
+		},
+		defaults: map[string]interface{}{"auth": "noauth"},
+	},
+	"http": {
+		settings:   model.HTTPSettings{},
+		networks:   []string{"tcp"},
+		securities: []string{"none", "tls"},
+	},
+	"relay": {
+		settings:   model.RelaySettings{},
+		networks:   []string{"tcp", "udp", "tcp,udp"},
+		securities: []string{"none"},
+		required:   []string{"target_host", "target_port"},
+	},
+}
+
+// commonFields model.Protocol 中由用户填写的字段
+var commonFields = map[string]bool{
+	"type":          true,
+	"name":          true,
+	"port":          true,
+	"listen":        true,
+	"traffic_limit": true,
+	"expire_at":     true,
+	"enable":        true,
+	"tags":          true,
+	"remark":        true,
+}
+
+// Schema 根据模型结构体生成协议配置描述
+func (m *Manager) Schema() *SchemaSet {
+	set := &SchemaSet{}
+
+	for _, field := range structFields(reflect.TypeOf(model.Protocol{})) {
+		if !commonFields[field.Name] {
+			continue
+		}
+		switch field.Name {
+		case "type":
+			field.Required = true
+			field.Enum = m.GetSupportedProtocolTypes()
+		case "port":
+			field.Required = true
+		case "enable":
+			field.Default = true
+		}
+		set.Common = append(set.Common, field)
+	}
+
+	// 未启用实验性的 QUIC 传输时不提供 quic 选项
+	quicEnabled := m.settings != nil && m.settings.Get().Transports[quicTransport]
+	for _, typ := range m.GetSupportedProtocolTypes() {
+		spec, ok := protocolSpecs[typ]
+		if !ok {
+			continue
+		}
+
+		networks := spec.networks
+		if !quicEnabled {
+			networks = slices.DeleteFunc(slices.Clone(networks), func(n string) bool { return n == quicTransport })
+		}
+		schema := &ProtocolSchema{
+			Type:       typ,
+			Networks:   networks,
+			Securities: spec.securities,
+		}
+		for _, field := range structFields(reflect.TypeOf(spec.settings)) {
+			field.Required = slices.Contains(spec.required, field.Name)
+			field.Enum = spec.enums[field.Name]
+			field.Default = spec.defaults[field.Name]
+			switch field.Name {
+			case "network":
+				field.Enum = networks
+				field.Default = networks[0]
+			case "sockopt":
+				field.Fields = sockoptSchema(field.Fields)
+			}
+			schema.Fields = append(schema.Fields, field)
+		}
+		set.Protocols = append(set.Protocols, schema)
+	}
+
+	return set
+}
+
+// structFields 按 JSON 标签列出结构体字段，嵌入的结构体会被展开
+func structFields(t reflect.Type) []*FieldSchema {
+	var fields []*FieldSchema
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, structFields(f.Type)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		field := &FieldSchema{
+			Name: name,
+			Type: fieldType(f.Type),
+		}
+		if t := f.Type; t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+			field.Fields = structFields(t.Elem())
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// fieldType 将 Go 类型映射为 JSON Schema 风格的类型名
+func fieldType(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "datetime"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Ptr:
+		return fieldType(t.Elem())
+	default:
+		return "string"
+	}
+}
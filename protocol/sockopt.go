@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"v/model"
+)
+
+// TCPCongestions Xray 支持的 TCP 拥塞控制算法
+var TCPCongestions = []string{"bbr", "cubic", "reno"}
+
+const (
+	// minTCPMaxSeg 允许的最小 MSS，对应 IPv4 最小 MTU 576
+	minTCPMaxSeg = 536
+	// maxTCPMaxSeg 允许的最大 MSS
+	maxTCPMaxSeg = 65535
+)
+
+// linuxOnlySockopts 只在 Linux 上支持的 sockopt 选项
+var linuxOnlySockopts = []string{"tcpUserTimeout", "tcpMaxSeg", "tcpCongestion", "tcpMptcp", "mark"}
+
+// validateSockopt 验证入站的 socket 调优选项。TCP 选项不能用于基于 UDP 的传输，
+// 仅限 Linux 的选项在其他平台上报错，MPTCP 还要求内核已启用
+func validateSockopt(network string, s *model.SockoptSettings) error {
+	if s == nil {
+		return nil
+	}
+	if s.TCPKeepAliveInterval < 0 || s.TCPKeepAliveIdle < 0 {
+		return errors.New("tcp keepalive values must be non-negative")
+	}
+	if s.TCPUserTimeout < 0 {
+		return errors.New("tcpUserTimeout must be non-negative")
+	}
+	if s.Mark < 0 {
+		return errors.New("mark must be non-negative")
+	}
+	if s.TCPMaxSeg != 0 && (s.TCPMaxSeg < minTCPMaxSeg || s.TCPMaxSeg > maxTCPMaxSeg) {
+		return fmt.Errorf("tcpMaxSeg must be between %d and %d", minTCPMaxSeg, maxTCPMaxSeg)
+	}
+	if s.TCPCongestion != "" && !contains(TCPCongestions, s.TCPCongestion) {
+		return fmt.Errorf("unsupported tcp congestion %q, expected one of %s", s.TCPCongestion, strings.Join(TCPCongestions, ", "))
+	}
+
+	tcpOptions := s.TCPFastOpen || s.TCPKeepAliveInterval > 0 || s.TCPKeepAliveIdle > 0 || s.TCPUserTimeout > 0 ||
+		s.TCPMaxSeg > 0 || s.TCPCongestion != "" || s.TCPMptcp
+	if tcpOptions && (network == quicTransport || network == "udp") {
+		return fmt.Errorf("tcp socket options do not apply to %s transport", network)
+	}
+
+	if !linuxSockopts && (s.TCPUserTimeout > 0 || s.TCPMaxSeg > 0 || s.TCPCongestion != "" || s.TCPMptcp || s.Mark > 0) {
+		return fmt.Errorf("%s are only supported on linux", strings.Join(linuxOnlySockopts, ", "))
+	}
+	if s.TCPMptcp && !mptcpSupported() {
+		return errors.New("tcpMptcp requires multipath tcp to be enabled in the kernel (net.mptcp.enabled)")
+	}
+	return nil
+}
+
+// xraySockopt 生成 Xray sockopt 配置，没有设置任何选项时返回 nil
+func xraySockopt(s *model.SockoptSettings) *XraySockoptConfig {
+	if s == nil || *s == (model.SockoptSettings{}) {
+		return nil
+	}
+	return &XraySockoptConfig{
+		Mark:                 s.Mark,
+		TCPFastOpen:          s.TCPFastOpen,
+		TCPKeepAliveInterval: s.TCPKeepAliveInterval,
+		TCPKeepAliveIdle:     s.TCPKeepAliveIdle,
+		TCPUserTimeout:       s.TCPUserTimeout,
+		TCPMaxSeg:            s.TCPMaxSeg,
+		TCPCongestion:        s.TCPCongestion,
+		TCPMptcp:             s.TCPMptcp,
+	}
+}
+
+// sockoptSchema 按当前平台过滤 sockopt 的字段描述，不支持的选项不提供
+func sockoptSchema(fields []*FieldSchema) []*FieldSchema {
+	kept := fields[:0]
+	for _, field := range fields {
+		if !linuxSockopts && contains(linuxOnlySockopts, field.Name) {
+			continue
+		}
+		if field.Name == "tcpMptcp" && !mptcpSupported() {
+			continue
+		}
+		if field.Name == "tcpCongestion" {
+			field.Enum = append([]string{""}, TCPCongestions...)
+		}
+		kept = append(kept, field)
+	}
+	return kept
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package protocol
+
+import (
+	"os"
+	"strings"
+)
+
+// linuxSockopts 当前平台支持仅限 Linux 的 sockopt 选项
+const linuxSockopts = true
+
+// mptcpSupported 判断内核是否启用了 Multipath TCP
+func mptcpSupported() bool {
+	data, err := os.ReadFile("/proc/sys/net/mptcp/enabled")
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package protocol
+
+// linuxSockopts 当前平台不支持仅限 Linux 的 sockopt 选项
+const linuxSockopts = false
+
+// mptcpSupported 只有 Linux 支持 Multipath TCP
+func mptcpSupported() bool {
+	return false
+}
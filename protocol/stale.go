@@ -0,0 +1,481 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/notification"
+)
+
+// 闲置入站的处理方式
+const (
+	CleanupNotify  = "notify"
+	CleanupDisable = "disable"
+	CleanupArchive = "archive"
+)
+
+// 闲置检测的默认值
+const (
+	defaultStaleDays       = 30
+	defaultCleanupGrace    = 7
+	defaultCleanupInterval = 6 * time.Hour
+
+	// cleanupActor 停用闲置入站时记录的修改人
+	cleanupActor = "cleanup"
+	// stalePageSize 列出入站时的分页大小
+	stalePageSize = 100
+)
+
+// staleStatePath 已通知的闲置入站，重启后继续计算等待时间
+var staleStatePath = filepath.Join("data", "stale_protocols.json")
+
+// StaleProtocol 长期没有流量和连接的入站
+type StaleProtocol struct {
+	ProtocolID int64      `json:"protocol_id"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Port       int        `json:"port"`
+	UserID     int64      `json:"user_id"`
+	IdleSince  time.Time  `json:"idle_since"` // 最后一次有流量的时间，从未使用时为创建时间
+	IdleDays   int        `json:"idle_days"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	ActionAt   *time.Time `json:"action_at,omitempty"` // 计划执行停用或归档的时间，仅通知时为空
+}
+
+// CleanupResult 一轮闲置检测的结果
+type CleanupResult struct {
+	Stale    int     `json:"stale"`
+	Notified []int64 `json:"notified"`
+	Disabled []int64 `json:"disabled"`
+	Archived []int64 `json:"archived"`
+}
+
+// FindStale 返回启用中且超过 days 天没有流量的入站，按闲置时间从长到短排序。
+// conns 返回入站当前的连接数，有连接的入站不视为闲置；带有 excludeTags 中任一标签的入站被忽略
+func (m *Manager) FindStale(now time.Time, days int, excludeTags []string, conns func(protocolID int64) int) ([]*StaleProtocol, error) {
+	if days <= 0 {
+		days = defaultStaleDays
+	}
+	cutoff := now.AddDate(0, 0, -days)
+
+	var stale []*StaleProtocol
+	for page := 1; ; page++ {
+		list, err := m.db.ListProtocols(page, stalePageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			p, err := m.db.GetProtocol(item.ID)
+			if err != nil || p == nil || !p.Enable || hasAnyTag(p.Tags, excludeTags) {
+				continue
+			}
+			since, err := m.lastTraffic(p)
+			if err != nil {
+				return nil, err
+			}
+			if since.After(cutoff) || (conns != nil && conns(p.ID) > 0) {
+				continue
+			}
+			stale = append(stale, &StaleProtocol{
+				ProtocolID: p.ID,
+				Name:       p.Name,
+				Type:       p.Type,
+				Port:       p.Port,
+				UserID:     p.UserID,
+				IdleSince:  since,
+				IdleDays:   int(now.Sub(since).Hours() / 24),
+			})
+		}
+		if len(list) < stalePageSize {
+			break
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].IdleSince.Before(stale[j].IdleSince) })
+	return stale, nil
+}
+
+// lastTraffic 返回入站最后一次有流量的时间，从未有流量时返回创建时间
+func (m *Manager) lastTraffic(p *model.Protocol) (time.Time, error) {
+	last := p.LastActive
+	stats, err := m.db.ListProtocolStatsByProtocolID(p.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, s := range stats {
+		if s.Upload+s.Download > 0 && s.LastActive.After(last) {
+			last = s.LastActive
+		}
+	}
+	if last.IsZero() {
+		last = p.CreatedAt
+	}
+	return last, nil
+}
+
+// StaleCleaner 定期检测闲置入站：首次发现时通知管理员（可选通知所属用户），
+// 等待期过后仍闲置的按设置停用或归档，减少长期运行的面板 Xray 配置中的无用入站
+type StaleCleaner struct {
+	log      *logger.Logger
+	mgr      *Manager
+	notifier notification.Notifier
+	conns    func(protocolID int64) int
+
+	mu       sync.Mutex
+	notified map[int64]time.Time
+	loaded   bool
+	stopCh   chan struct{}
+}
+
+// NewStaleCleaner 创建闲置入站清理器
+func NewStaleCleaner(log *logger.Logger, mgr *Manager, notifier notification.Notifier) *StaleCleaner {
+	return &StaleCleaner{
+		log:      log,
+		mgr:      mgr,
+		notifier: notifier,
+		notified: make(map[int64]time.Time),
+	}
+}
+
+// SetConnCounter 设置入站当前连接数来源，有连接的入站不视为闲置
+func (c *StaleCleaner) SetConnCounter(fn func(protocolID int64) int) {
+	c.conns = fn
+}
+
+// Start 启动定期检测
+func (c *StaleCleaner) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopCh != nil {
+		return
+	}
+	c.stopCh = make(chan struct{})
+	go c.run(c.stopCh)
+}
+
+// Stop 停止定期检测
+func (c *StaleCleaner) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopCh != nil {
+		close(c.stopCh)
+		c.stopCh = nil
+	}
+}
+
+// List 返回当前的闲置入站及通知和计划处理时间
+func (c *StaleCleaner) List(now time.Time) ([]*StaleProtocol, error) {
+	cfg := c.mgr.settings.Get().Cleanup
+	stale, err := c.mgr.FindStale(now, cfg.StaleDays, cfg.ExcludeTags, c.conns)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	for _, s := range stale {
+		if at, ok := c.notified[s.ProtocolID]; ok {
+			notifiedAt := at
+			s.NotifiedAt = &notifiedAt
+			if cleanupAction(cfg.Action) != CleanupNotify {
+				actionAt := at.AddDate(0, 0, cleanupGrace(cfg.GraceDays))
+				s.ActionAt = &actionAt
+			}
+		}
+	}
+	return stale, nil
+}
+
+// run 检测循环，间隔每轮重新读取
+func (c *StaleCleaner) run(stopCh chan struct{}) {
+	for {
+		cfg := c.mgr.settings.Get().Cleanup
+		if cfg.Enable {
+			if _, err := c.Run(time.Now()); err != nil {
+				c.log.WarnWithFields("Failed to clean up stale protocols", logger.Fields{
+					"error": err.Error(),
+				})
+			}
+		}
+
+		interval := cfg.Interval
+		if interval <= 0 {
+			interval = defaultCleanupInterval
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Run 执行一轮闲置检测：通知新发现的闲置入站，处理等待期已过的入站，恢复使用的入站重新计时
+func (c *StaleCleaner) Run(now time.Time) (*CleanupResult, error) {
+	cfg := c.mgr.settings.Get().Cleanup
+	stale, err := c.mgr.FindStale(now, cfg.StaleDays, cfg.ExcludeTags, c.conns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stale protocols: %v", err)
+	}
+	action := cleanupAction(cfg.Action)
+	grace := time.Duration(cleanupGrace(cfg.GraceDays)) * 24 * time.Hour
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	current := make(map[int64]bool, len(stale))
+	for _, s := range stale {
+		current[s.ProtocolID] = true
+	}
+	for id := range c.notified {
+		if !current[id] {
+			delete(c.notified, id)
+		}
+	}
+
+	result := &CleanupResult{Stale: len(stale)}
+	var fresh, handled []*StaleProtocol
+	for _, s := range stale {
+		at, ok := c.notified[s.ProtocolID]
+		if !ok {
+			c.notified[s.ProtocolID] = now
+			result.Notified = append(result.Notified, s.ProtocolID)
+			fresh = append(fresh, s)
+			continue
+		}
+		if action == CleanupNotify || now.Sub(at) < grace {
+			continue
+		}
+		if err := c.handle(s, action); err != nil {
+			c.log.ErrorWithFields("Failed to clean up stale protocol", logger.Fields{
+				"protocol_id": s.ProtocolID,
+				"action":      action,
+				"error":       err.Error(),
+			})
+			continue
+		}
+		delete(c.notified, s.ProtocolID)
+		handled = append(handled, s)
+		if action == CleanupDisable {
+			result.Disabled = append(result.Disabled, s.ProtocolID)
+		} else {
+			result.Archived = append(result.Archived, s.ProtocolID)
+		}
+	}
+	if err := c.save(); err != nil {
+		c.log.WarnWithFields("Failed to save stale protocol state", logger.Fields{
+			"error": err.Error(),
+		})
+	}
+
+	if len(handled) > 0 {
+		if _, err := c.mgr.RequestApply("stale protocol cleanup"); err != nil {
+			c.log.ErrorWithFields("Failed to apply xray config after cleanup", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+	}
+	if len(fresh) > 0 || len(handled) > 0 {
+		c.log.WithFields("Stale protocols processed", logger.Fields{
+			"stale":    len(stale),
+			"notified": len(fresh),
+			"handled":  len(handled),
+			"action":   action,
+		})
+		c.notify(fresh, handled, action, cleanupGrace(cfg.GraceDays), cfg.NotifyOwner)
+	}
+	return result, nil
+}
+
+// handle 停用或归档闲置入站
+func (c *StaleCleaner) handle(s *StaleProtocol, action string) error {
+	if action == CleanupArchive {
+		if err := c.mgr.db.DeleteProtocolCascade(s.ProtocolID, true); err != nil {
+			return err
+		}
+		notifyProtocol(&model.Protocol{
+			Base:   model.Base{ID: s.ProtocolID},
+			UserID: s.UserID,
+			Type:   s.Type,
+			Name:   s.Name,
+			Port:   s.Port,
+		}, ChangeDeleted)
+		return nil
+	}
+	p, err := c.mgr.db.GetProtocol(s.ProtocolID)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return model.ErrNotFound
+	}
+	p.Enable = false
+	return c.mgr.UpdateProtocolAs(p, cleanupActor)
+}
+
+// notify 发送闲置入站通知，管理员收到全部入站，所属用户只收到自己的入站
+func (c *StaleCleaner) notify(fresh, handled []*StaleProtocol, action string, graceDays int, notifyOwner bool) {
+	s := c.mgr.settings.Get()
+	if s.Admin.Email != "" {
+		c.send(s.Admin.Email, "管理员", fresh, handled, action, graceDays)
+	}
+	if !notifyOwner {
+		return
+	}
+
+	owners := make(map[int64]bool)
+	for _, list := range [][]*StaleProtocol{fresh, handled} {
+		for _, p := range list {
+			owners[p.UserID] = true
+		}
+	}
+	for userID := range owners {
+		user, err := c.mgr.db.GetUser(userID)
+		if err != nil || user == nil || user.Email == "" || user.Email == s.Admin.Email {
+			continue
+		}
+		c.send(user.Email, user.Username, filterOwner(fresh, userID), filterOwner(handled, userID), action, graceDays)
+	}
+}
+
+// send 发送一封闲置入站通知
+func (c *StaleCleaner) send(to, name string, fresh, handled []*StaleProtocol, action string, graceDays int) {
+	if len(fresh) == 0 && len(handled) == 0 {
+		return
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "<p>%s，您好：</p>", html.EscapeString(name))
+	if len(fresh) > 0 {
+		switch action {
+		case CleanupDisable:
+			fmt.Fprintf(&body, "<p>以下入站长期没有流量，%d 天后仍未使用将被停用：</p>", graceDays)
+		case CleanupArchive:
+			fmt.Fprintf(&body, "<p>以下入站长期没有流量，%d 天后仍未使用将被删除并归档统计：</p>", graceDays)
+		default:
+			body.WriteString("<p>以下入站长期没有流量，如不再使用请及时清理：</p>")
+		}
+		writeStaleList(&body, fresh)
+	}
+	if len(handled) > 0 {
+		if action == CleanupDisable {
+			body.WriteString("<p>以下入站已因长期闲置被停用，需要时可重新启用：</p>")
+		} else {
+			body.WriteString("<p>以下入站已因长期闲置被删除，统计数据已归档：</p>")
+		}
+		writeStaleList(&body, handled)
+	}
+	fmt.Fprintf(&body, "<p>%s</p>", html.EscapeString(c.mgr.settings.Get().Site.Name))
+
+	if err := c.notifier.Send(&notification.Notification{
+		To:      []string{to},
+		Subject: "闲置入站提醒",
+		Body:    body.String(),
+		Type:    "stale_protocols",
+	}); err != nil {
+		c.log.WarnWithFields("Failed to send stale protocol notification", logger.Fields{
+			"to":    to,
+			"error": err.Error(),
+		})
+	}
+}
+
+// load 读取已通知的闲置入站，只在首次使用时读取
+func (c *StaleCleaner) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	data, err := os.ReadFile(staleStatePath)
+	if err != nil {
+		return
+	}
+	var notified map[int64]time.Time
+	if err := json.Unmarshal(data, &notified); err != nil {
+		c.log.WarnWithFields("Failed to parse stale protocol state", logger.Fields{
+			"error": err.Error(),
+		})
+		return
+	}
+	for id, at := range notified {
+		c.notified[id] = at
+	}
+}
+
+// save 保存已通知的闲置入站
+func (c *StaleCleaner) save() error {
+	data, err := json.MarshalIndent(c.notified, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stale protocol state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(staleStatePath), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+	if err := os.WriteFile(staleStatePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stale protocol state: %v", err)
+	}
+	return nil
+}
+
+// writeStaleList 输出入站列表
+func writeStaleList(body *strings.Builder, list []*StaleProtocol) {
+	body.WriteString("<ul>")
+	for _, p := range list {
+		fmt.Fprintf(body, "<li>%s（ID %d，%s，端口 %d）已闲置 %d 天</li>",
+			html.EscapeString(p.Name), p.ProtocolID, html.EscapeString(p.Type), p.Port, p.IdleDays)
+	}
+	body.WriteString("</ul>")
+}
+
+// filterOwner 返回属于指定用户的入站
+func filterOwner(list []*StaleProtocol, userID int64) []*StaleProtocol {
+	var owned []*StaleProtocol
+	for _, p := range list {
+		if p.UserID == userID {
+			owned = append(owned, p)
+		}
+	}
+	return owned
+}
+
+// hasAnyTag 判断入站是否带有任一标签
+func hasAnyTag(tags, want []string) bool {
+	for _, t := range want {
+		if contains(tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupAction 规范化处理方式
+func cleanupAction(action string) string {
+	switch action {
+	case CleanupDisable, CleanupArchive:
+		return action
+	default:
+		return CleanupNotify
+	}
+}
+
+// cleanupGrace 返回通知后的等待天数
+func cleanupGrace(days int) int {
+	if days <= 0 {
+		return defaultCleanupGrace
+	}
+	return days
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"v/common"
@@ -89,18 +90,18 @@ func (s *BaseServer) GetPort() int {
 
 // GetUpload returns the upload traffic
 func (s *BaseServer) GetUpload() int64 {
-	return s.Upload
+	return atomic.LoadInt64(&s.Upload)
 }
 
 // GetDownload returns the download traffic
 func (s *BaseServer) GetDownload() int64 {
-	return s.Download
+	return atomic.LoadInt64(&s.Download)
 }
 
 // UpdateTraffic updates traffic statistics
 func (s *BaseServer) UpdateTraffic(upload, download int64) {
-	s.Upload += upload
-	s.Download += download
+	atomic.AddInt64(&s.Upload, upload)
+	atomic.AddInt64(&s.Download, download)
 }
 
 // UpdateLastActive updates last active time
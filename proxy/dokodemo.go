@@ -3,9 +3,9 @@ package proxy
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"v/common"
@@ -113,13 +113,16 @@ func (s *DokodemoServer) handleConnection(conn net.Conn) {
 	defer target.Close()
 
 	// 开始转发数据
-	go DokoCopyIO(conn, target)
-	DokoCopyIO(target, conn)
+	var counter TrafficCounter
+	Relay(conn, target, &counter)
+
+	atomic.AddInt64(&s.Upload, counter.Upload())
+	atomic.AddInt64(&s.Download, counter.Download())
 }
 
 // DokoCopyIO copies data between two connections
 func DokoCopyIO(src, dst net.Conn) {
 	defer src.Close()
 	defer dst.Close()
-	io.Copy(dst, src)
+	copyCounted(dst, src, nil, nil)
 }
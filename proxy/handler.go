@@ -52,7 +52,7 @@ func (h *Handler) CreateProxy(c *gin.Context) {
 	}
 
 	proxy := &model.Proxy{
-		UserID:   int64(userID),
+		UserID:   userID,
 		Protocol: req.Protocol,
 		Port:     req.Port,
 		Settings: string(settings),
@@ -82,7 +82,7 @@ func (h *Handler) GetProxy(c *gin.Context) {
 		return
 	}
 
-	if int64(userID) != proxy.UserID {
+	if userID != proxy.UserID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 		return
 	}
@@ -93,7 +93,7 @@ func (h *Handler) GetProxy(c *gin.Context) {
 // ListProxies lists all proxies for the current user
 func (h *Handler) ListProxies(c *gin.Context) {
 	userID := utils.GetUserIDFromContext(c.Request.Context())
-	proxies, err := h.service.ListProxies(int64(userID))
+	proxies, err := h.service.ListProxies(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -123,7 +123,7 @@ func (h *Handler) UpdateProxy(c *gin.Context) {
 		return
 	}
 
-	if int64(userID) != proxy.UserID {
+	if userID != proxy.UserID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 		return
 	}
@@ -162,7 +162,7 @@ func (h *Handler) DeleteProxy(c *gin.Context) {
 		return
 	}
 
-	if int64(userID) != proxy.UserID {
+	if userID != proxy.UserID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 		return
 	}
@@ -190,7 +190,7 @@ func (h *Handler) GetProxyStats(c *gin.Context) {
 		return
 	}
 
-	if int64(userID) != proxy.UserID {
+	if userID != proxy.UserID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 		return
 	}
@@ -236,7 +236,7 @@ func (h *Handler) EnableProxy(c *gin.Context) {
 		return
 	}
 
-	if int64(userID) != proxy.UserID {
+	if userID != proxy.UserID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 		return
 	}
@@ -264,7 +264,7 @@ func (h *Handler) DisableProxy(c *gin.Context) {
 		return
 	}
 
-	if int64(userID) != proxy.UserID {
+	if userID != proxy.UserID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
 		return
 	}
@@ -292,7 +292,7 @@ func (h *Handler) ListUserProxies(c *gin.Context) {
 
 	// In a real system, you would check if adminID is actually an admin
 	// For simplicity, we just check if the user is trying to access their own data
-	if int64(adminID) != userID {
+	if adminID != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "access denied, you can only view your own proxies"})
 		return
 	}
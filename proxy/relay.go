@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// relayBufferSize 转发缓冲区大小
+const relayBufferSize = 32 * 1024
+
+// ErrRelayIdle 两个方向持续没有数据，连接已被关闭
+var ErrRelayIdle = errors.New("relay idle timeout")
+
+// relayIdleTimeout 两个方向都没有数据的最长时间，超过后关闭连接，
+// 避免对端失联（如断网、NAT 超时）后连接和转发协程一直占用
+var relayIdleTimeout = 5 * time.Minute
+
+// relayBufPool 转发缓冲区池，避免每个连接和每次读取分配内存
+var relayBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, relayBufferSize)
+		return &buf
+	},
+}
+
+// TrafficCounter 连接流量计数器，可在转发过程中并发读取
+type TrafficCounter struct {
+	upload   atomic.Int64
+	download atomic.Int64
+}
+
+// Upload 返回上传字节数
+func (c *TrafficCounter) Upload() int64 {
+	return c.upload.Load()
+}
+
+// Download 返回下载字节数
+func (c *TrafficCounter) Download() int64 {
+	return c.download.Load()
+}
+
+// Swap 返回并清零当前计数，用于周期性上报
+func (c *TrafficCounter) Swap() (upload, download int64) {
+	return c.upload.Swap(0), c.download.Swap(0)
+}
+
+// Relay 在客户端和目标之间双向转发数据，客户端到目标计为上传，目标到客户端计为下载。
+// 一个方向结束后半关闭对端写方向，两个方向都结束后关闭连接，返回第一个非 EOF 错误。
+// 两个方向都空闲超过 relayIdleTimeout 时关闭连接并返回 ErrRelayIdle。
+func Relay(client, target io.ReadWriteCloser, counter *TrafficCounter) error {
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+	done := make(chan struct{})
+	idle := make(chan struct{})
+	go watchIdle(client, target, &lastActive, done, idle)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := copyCounted(target, client, &counter.upload, &lastActive)
+		closeWrite(target)
+		errCh <- err
+	}()
+
+	_, err := copyCounted(client, target, &counter.download, &lastActive)
+	closeWrite(client)
+
+	// 等待另一方向结束，对端不再发送数据时由空闲超时关闭连接
+	if uploadErr := <-errCh; err == nil {
+		err = uploadErr
+	}
+	close(done)
+
+	client.Close()
+	target.Close()
+
+	select {
+	case <-idle:
+		return ErrRelayIdle
+	default:
+		return err
+	}
+}
+
+// watchIdle 定期检查最近一次收到数据的时间，空闲超时后关闭两端连接使阻塞的读取返回
+func watchIdle(client, target io.Closer, lastActive *atomic.Int64, done <-chan struct{}, idle chan<- struct{}) {
+	ticker := time.NewTicker(relayIdleTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if now.Sub(time.Unix(0, lastActive.Load())) >= relayIdleTimeout {
+				close(idle)
+				client.Close()
+				target.Close()
+				return
+			}
+		}
+	}
+}
+
+// copyCounted 使用池化缓冲区从 src 复制到 dst，每次写入后原子累加计数，不产生内存分配。
+// active 不为 nil 时记录最近一次读到数据的时间
+func copyCounted(dst io.Writer, src io.Reader, counter, active *atomic.Int64) (int64, error) {
+	bufp := relayBufPool.Get().(*[]byte)
+	defer relayBufPool.Put(bufp)
+	buf := *bufp
+
+	var written int64
+	for {
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			if active != nil {
+				active.Store(time.Now().UnixNano())
+			}
+			nw, werr := dst.Write(buf[:nr])
+			if nw > 0 {
+				written += int64(nw)
+				if counter != nil {
+					counter.Add(int64(nw))
+				}
+			}
+			if werr != nil {
+				return written, werr
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr != nil {
+			if rerr == io.EOF || errors.Is(rerr, net.ErrClosed) {
+				return written, nil
+			}
+			return written, rerr
+		}
+	}
+}
+
+// closeWrite 半关闭连接的写方向，让对端读到 EOF
+func closeWrite(conn io.Closer) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// chunkReader 从固定缓冲区返回 size 字节，用于不受网络影响地测量复制开销
+type chunkReader struct {
+	chunk []byte
+	left  int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunk)
+	if n > r.left {
+		n = r.left
+	}
+	r.left -= n
+	return n, nil
+}
+
+func TestCopyCounted_NoAllocs(t *testing.T) {
+	chunk := make([]byte, relayBufferSize)
+	var counter atomic.Int64
+
+	r := &chunkReader{chunk: chunk}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.left = 1 << 20
+		copyCounted(io.Discard, r, &counter, nil)
+	})
+	if allocs != 0 {
+		t.Fatalf("copyCounted allocated %.1f times per run, want 0", allocs)
+	}
+	if counter.Load() != 101<<20 {
+		t.Fatalf("counted %d bytes, want %d", counter.Load(), 101<<20)
+	}
+}
+
+func TestRelay_CountsBothDirections(t *testing.T) {
+	clientSide, clientConn := tcpPair(t)
+	targetConn, targetSide := tcpPair(t)
+
+	var counter TrafficCounter
+	done := make(chan error, 1)
+	go func() { done <- Relay(clientConn, targetConn, &counter) }()
+
+	upload := bytes.Repeat([]byte("u"), 100000)
+	download := bytes.Repeat([]byte("d"), 50000)
+
+	go func() {
+		targetSide.Write(download)
+		targetSide.(*net.TCPConn).CloseWrite()
+	}()
+	go func() {
+		clientSide.Write(upload)
+		clientSide.(*net.TCPConn).CloseWrite()
+	}()
+
+	gotDown, _ := io.ReadAll(clientSide)
+	gotUp, _ := io.ReadAll(targetSide)
+
+	if err := <-done; err != nil {
+		t.Fatalf("relay returned error: %v", err)
+	}
+	if !bytes.Equal(gotUp, upload) || !bytes.Equal(gotDown, download) {
+		t.Fatalf("relayed data mismatch: up %d/%d down %d/%d", len(gotUp), len(upload), len(gotDown), len(download))
+	}
+	if counter.Upload() != int64(len(upload)) || counter.Download() != int64(len(download)) {
+		t.Fatalf("counter = %d/%d, want %d/%d", counter.Upload(), counter.Download(), len(upload), len(download))
+	}
+}
+
+func TestRelay_ClosesIdleConnections(t *testing.T) {
+	defer func(timeout time.Duration) { relayIdleTimeout = timeout }(relayIdleTimeout)
+	relayIdleTimeout = 200 * time.Millisecond
+
+	clientSide, clientConn := tcpPair(t)
+	_, targetConn := tcpPair(t)
+
+	var counter TrafficCounter
+	done := make(chan error, 1)
+	go func() { done <- Relay(clientConn, targetConn, &counter) }()
+
+	// 持续有数据时不会超时
+	for i := 0; i < 4; i++ {
+		clientSide.Write([]byte("ping"))
+		time.Sleep(100 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("relay ended while active: %v", err)
+	default:
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrRelayIdle) {
+			t.Fatalf("relay returned %v, want ErrRelayIdle", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("relay did not close idle connections")
+	}
+	if counter.Upload() != 16 {
+		t.Fatalf("upload = %d, want 16", counter.Upload())
+	}
+}
+
+// 对比 BenchmarkCopyBaseline 和 BenchmarkCopyCounted 的 MB/s 即为计数带来的开销，
+// 两者在 1Gbps（125MB/s）以上的吞吐下差距应小于 5%：
+//
+//	go test -run '^$' -bench 'Copy|Relay' -benchmem ./proxy
+func BenchmarkCopyBaseline(b *testing.B) {
+	chunk := make([]byte, relayBufferSize)
+	buf := make([]byte, relayBufferSize)
+	r := &chunkReader{chunk: chunk}
+	src := io.Reader(struct{ io.Reader }{r}) // 屏蔽 WriterTo/ReaderFrom，与 copyCounted 走相同路径
+	dst := io.Writer(struct{ io.Writer }{io.Discard})
+	b.SetBytes(1 << 20)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.left = 1 << 20
+		io.CopyBuffer(dst, src, buf)
+	}
+}
+
+func BenchmarkCopyCounted(b *testing.B) {
+	chunk := make([]byte, relayBufferSize)
+	var counter atomic.Int64
+	r := &chunkReader{chunk: chunk}
+	dst := io.Writer(struct{ io.Writer }{io.Discard})
+	b.SetBytes(1 << 20)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.left = 1 << 20
+		copyCounted(dst, r, &counter, nil)
+	}
+}
+
+// BenchmarkRelayTCPBaseline 和 BenchmarkRelayTCP 通过本地 TCP 比较直接转发和带计数的转发
+func BenchmarkRelayTCPBaseline(b *testing.B) {
+	benchmarkTCP(b, func(client, target net.Conn) {
+		go func() { io.Copy(target, client); target.(*net.TCPConn).CloseWrite() }()
+		io.Copy(client, target)
+	})
+}
+
+func BenchmarkRelayTCP(b *testing.B) {
+	benchmarkTCP(b, func(client, target net.Conn) {
+		var counter TrafficCounter
+		Relay(client, target, &counter)
+	})
+}
+
+func benchmarkTCP(b *testing.B, relay func(client, target net.Conn)) {
+	clientSide, clientConn := tcpPair(b)
+	targetConn, targetSide := tcpPair(b)
+	go relay(clientConn, targetConn)
+
+	size := int64(b.N) * (1 << 20)
+	b.SetBytes(1 << 20)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		r := chunkReader{chunk: make([]byte, relayBufferSize), left: int(size)}
+		io.Copy(clientSide, &r)
+		clientSide.(*net.TCPConn).CloseWrite()
+	}()
+	io.Copy(io.Discard, targetSide)
+}
+
+// tcpPair 创建一对本地 TCP 连接
+func tcpPair(tb testing.TB) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	server := <-accepted
+	tb.Cleanup(func() {
+		dialed.Close()
+		server.Close()
+	})
+	return dialed, server
+}
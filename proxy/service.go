@@ -267,7 +267,7 @@ func (s *Service) UpdateTraffic(id int64, upload, download int64) error {
 	server.UpdateTraffic(upload, download)
 
 	// Use the database function that matches the actual expected type
-	if err := database.DBInstance.UpdateTraffic(uint(id), server.GetUpload(), server.GetDownload()); err != nil {
+	if err := database.DBInstance.UpdateTraffic(id, server.GetUpload(), server.GetDownload()); err != nil {
 		return fmt.Errorf("failed to update traffic stats: %v", err)
 	}
 
@@ -296,7 +296,7 @@ func (s *Service) Enable(id int64) error {
 	}
 
 	// Enable the proxy in the database
-	if err := database.DBInstance.Enable(uint(id)); err != nil {
+	if err := database.DBInstance.Enable(id); err != nil {
 		return fmt.Errorf("failed to enable proxy in database: %v", err)
 	}
 
@@ -337,7 +337,7 @@ func (s *Service) Disable(id int64) error {
 	delete(s.servers, id)
 
 	// Update database
-	if err := database.DBInstance.Disable(uint(id)); err != nil {
+	if err := database.DBInstance.Disable(id); err != nil {
 		return fmt.Errorf("failed to disable proxy in database: %v", err)
 	}
 
@@ -359,7 +359,7 @@ func (s *Service) UpdateLastActive(id int64) error {
 	server.UpdateLastActive(now)
 
 	// Update database
-	if err := database.DBInstance.UpdateLastActive(uint(id)); err != nil {
+	if err := database.DBInstance.UpdateLastActive(id); err != nil {
 		return fmt.Errorf("failed to update proxy last active time: %v", err)
 	}
 
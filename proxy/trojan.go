@@ -389,18 +389,12 @@ func TrojanCopyIO(dst io.Writer, src io.Reader) (int64, int64) {
 
 	// Copy from src to dst (upload)
 	go func() {
-		n, err := io.Copy(dst, src)
-		if err != nil {
-			// Just log or ignore the error
-		}
+		n, _ := copyCounted(dst, src, nil, nil)
 		ch <- n
 	}()
 
 	// Copy from dst to src (download) - for our case, dst parameter is the client connection
-	n, err := io.Copy(src.(io.Writer), dst.(io.Reader))
-	if err != nil {
-		// Just log or ignore the error
-	}
+	n, _ := copyCounted(src.(io.Writer), dst.(io.Reader), nil, nil)
 	download = n
 
 	// Get upload bytes from goroutine
@@ -270,18 +270,9 @@ func (s *VLESSServer) HandleConnection(conn io.ReadWriteCloser) error {
 	defer target.Close()
 
 	// Start proxying
-	errChan := make(chan error, 2)
-	go func() {
-		_, err := io.Copy(target, conn)
-		errChan <- err
-	}()
-	go func() {
-		_, err := io.Copy(conn, target)
-		errChan <- err
-	}()
-
-	// Wait for either direction to finish
-	err = <-errChan
+	var counter TrafficCounter
+	err = Relay(conn, target, &counter)
+	s.UpdateTraffic(counter.Upload(), counter.Download())
 	if err != nil {
 		s.Logger.Error("Copy error: %v", err)
 	}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"path/filepath"
 	"strconv"
 
 	"v/backup"
 	"v/config"
+	"v/heartbeat"
 	"v/logger"
 	"v/model"
 	"v/notification"
@@ -20,6 +22,8 @@ var backupMgr *backup.Manager
 // InitBackupHandlers 初始化备份处理器
 func InitBackupHandlers(log *logger.Logger, settingsMgr *settings.Manager, notifyMgr *notification.Manager, cfg *config.Config, db model.DB) {
 	backupMgr = backup.New(log, settingsMgr, notifyMgr, cfg, db)
+	backupMgr.SetHeartbeat(heartbeat.New(log, settingsMgr))
+	backupMgr.Start()
 }
 
 // HandleCreateBackup 处理创建备份的请求
@@ -130,3 +134,48 @@ func HandleDownloadBackup(c *gin.Context) {
 		return
 	}
 }
+
+// HandleListRemoteBackups 处理获取远程目标备份列表的请求
+func HandleListRemoteBackups(c *gin.Context) {
+	objects, err := backupMgr.ListRemote(c.Param("target"))
+	if errors.Is(err, backup.ErrTargetNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Backup target not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "Failed to list remote backups: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, objects)
+}
+
+// HandleRestoreRemoteBackup 处理从远程目标恢复备份的请求
+func HandleRestoreRemoteBackup(c *gin.Context) {
+	err := backupMgr.RestoreRemote(c.Param("target"), c.Param("name"))
+	switch {
+	case errors.Is(err, backup.ErrTargetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Backup target not found",
+		})
+		return
+	case errors.Is(err, backup.ErrRemoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Remote backup not found",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to restore remote backup: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Backup restored successfully",
+	})
+}
@@ -18,11 +18,12 @@ type UserResponse struct {
 
 // UpdateUserRequest represents a request to update user information
 type UpdateUserRequest struct {
-	Email        *string    `json:"email"`
-	Password     *string    `json:"password"`
-	IsAdmin      *bool      `json:"is_admin"`
-	ExpireAt     *time.Time `json:"expire_at"`
-	TrafficLimit *int64     `json:"traffic_limit"`
+	Email          *string    `json:"email"`
+	Password       *string    `json:"password"`
+	IsAdmin        *bool      `json:"is_admin"`
+	ExpireAt       *time.Time `json:"expire_at"`
+	TrafficLimit   *int64     `json:"traffic_limit"`
+	ActivityOptOut *bool      `json:"activity_opt_out"` // disables new-location and device-limit alert emails
 }
 
 // UpdatePasswordRequest represents a request to update user password
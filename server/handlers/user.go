@@ -69,6 +69,9 @@ func HandleUpdateCurrentUser(c *gin.Context) {
 		}
 		user.Password = hashedPassword
 	}
+	if req.ActivityOptOut != nil {
+		user.ActivityOptOut = *req.ActivityOptOut
+	}
 
 	if err := userMgr.UpdateUser(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user information"})
@@ -69,7 +69,7 @@ func Auth() gin.HandlerFunc {
 		var enabled bool
 		var isAdmin bool
 		db := database.GetDB()
-		err = db.QueryRow("SELECT enabled, is_admin FROM users WHERE id = ?", uint(userID)).Scan(&enabled, &isAdmin)
+		err = db.QueryRow("SELECT enabled, is_admin FROM users WHERE id = ?", int64(userID)).Scan(&enabled, &isAdmin)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
@@ -83,7 +83,7 @@ func Auth() gin.HandlerFunc {
 		}
 
 		// Store user information in context
-		c.Set("user_id", uint(userID))
+		c.Set("user_id", int64(userID))
 		c.Set("is_admin", isAdmin)
 		c.Next()
 	}
@@ -80,6 +80,8 @@ func SetupRouter() *gin.Engine {
 		backupGroup.POST("/:id/restore", handlers.HandleRestoreBackup)
 		backupGroup.DELETE("/:id", handlers.HandleDeleteBackup)
 		backupGroup.GET("/:id/download", handlers.HandleDownloadBackup)
+		backupGroup.GET("/remote/:target", handlers.HandleListRemoteBackups)
+		backupGroup.POST("/remote/:target/:name/restore", handlers.HandleRestoreRemoteBackup)
 	}
 
 	// 系统监控路由
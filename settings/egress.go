@@ -0,0 +1,90 @@
+package settings
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// EgressIP 返回出站使用的源地址（sendThrough）。协议标签即用户分组，
+// 分组设置优先于出站设置，都未设置时使用默认值，为空表示由系统选择
+func (x XraySettings) EgressIP(tag string, groups []string) string {
+	if len(groups) > 0 && len(x.GroupSendThrough) > 0 {
+		// 协议带有多个分组时按名称取第一个匹配，保证生成的配置稳定
+		sorted := append([]string(nil), groups...)
+		sort.Strings(sorted)
+		for _, group := range sorted {
+			if ip := x.GroupSendThrough[group]; ip != "" {
+				return ip
+			}
+		}
+	}
+	if ip := x.OutboundSendThrough[tag]; ip != "" {
+		return ip
+	}
+	return x.SendThrough
+}
+
+// ValidateSendThrough 检查出口 IP 的格式
+func (x XraySettings) ValidateSendThrough() error {
+	for _, ip := range x.egressIPs() {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid egress ip %q", ip)
+		}
+	}
+	return nil
+}
+
+// ValidateEgressHost 检查出口 IP 是否都属于本机网卡，Xray 无法从不属于本机的地址发起连接
+func (x XraySettings) ValidateEgressHost() error {
+	if err := x.ValidateSendThrough(); err != nil {
+		return err
+	}
+	local, err := LocalIPs()
+	if err != nil {
+		return err
+	}
+	for _, ip := range x.egressIPs() {
+		if !containsString(local, net.ParseIP(ip).String()) {
+			return fmt.Errorf("egress ip %s is not assigned to this host", ip)
+		}
+	}
+	return nil
+}
+
+// egressIPs 返回设置中出现的全部出口 IP
+func (x XraySettings) egressIPs() []string {
+	var ips []string
+	if x.SendThrough != "" {
+		ips = append(ips, x.SendThrough)
+	}
+	for _, ip := range x.OutboundSendThrough {
+		ips = append(ips, ip)
+	}
+	for _, ip := range x.GroupSendThrough {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// LocalIPs 返回本机网卡上可用作出口的单播地址，不包含回环和链路本地地址
+func LocalIPs() ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interface addresses: %v", err)
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+			continue
+		}
+		ips = append(ips, ip.String())
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
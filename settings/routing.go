@@ -0,0 +1,127 @@
+package settings
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// 分流方案中未匹配流量的去向
+const (
+	RouteProxy  = "proxy"
+	RouteDirect = "direct"
+)
+
+// RoutingProfile 分流方案，写入客户端配置（Clash、sing-box），决定哪些域名和 IP 直连、哪些走代理。
+// 域名支持 full:、keyword:、geosite: 前缀，不带前缀时匹配域名及其子域名；IP 支持 CIDR、单个地址和 geoip: 前缀
+type RoutingProfile struct {
+	Name          string   `json:"name"`
+	DirectDomains []string `json:"direct_domains"`
+	DirectIPs     []string `json:"direct_ips"`
+	ProxyDomains  []string `json:"proxy_domains"` // 优先于直连规则
+	ProxyIPs      []string `json:"proxy_ips"`
+	BlockDomains  []string `json:"block_domains"` // 优先于其他规则
+	BlockIPs      []string `json:"block_ips"`
+	Final         string   `json:"final"`       // 未匹配的流量：proxy（默认）或 direct
+	ServerSide    bool     `json:"server_side"` // 同时在服务端拒绝该方案中的屏蔽规则，客户端改写配置也无法绕过
+}
+
+// RoutingSettings represents per-user split tunneling settings
+type RoutingSettings struct {
+	Profiles      []RoutingProfile  `json:"profiles"`
+	Default       string            `json:"default"`        // 未单独指定时使用的方案，为空时不下发分流规则
+	UserProfiles  map[int64]string  `json:"user_profiles"`  // 按用户 ID 指定方案，优先于分组
+	GroupProfiles map[string]string `json:"group_profiles"` // 按用户分组（协议标签）指定方案
+}
+
+// ProfileFor 返回用户使用的分流方案，用户设置优先于分组设置，都未设置时使用默认方案，没有方案时返回 nil
+func (r RoutingSettings) ProfileFor(userID int64, groups []string) *RoutingProfile {
+	if name := r.UserProfiles[userID]; name != "" {
+		return r.profile(name)
+	}
+	if len(groups) > 0 && len(r.GroupProfiles) > 0 {
+		// 带有多个分组时按名称取第一个匹配，保证生成的配置稳定
+		sorted := append([]string(nil), groups...)
+		sort.Strings(sorted)
+		for _, group := range sorted {
+			if name := r.GroupProfiles[group]; name != "" {
+				return r.profile(name)
+			}
+		}
+	}
+	if r.Default != "" {
+		return r.profile(r.Default)
+	}
+	return nil
+}
+
+// profile 按名称查找方案
+func (r RoutingSettings) profile(name string) *RoutingProfile {
+	for i := range r.Profiles {
+		if r.Profiles[i].Name == name {
+			return &r.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// ValidateProfiles 检查方案名称、规则格式和引用的方案是否存在
+func (r RoutingSettings) ValidateProfiles() error {
+	names := make(map[string]bool, len(r.Profiles))
+	for _, p := range r.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("routing profile name is required")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate routing profile %q", p.Name)
+		}
+		names[p.Name] = true
+
+		switch p.Final {
+		case "", RouteProxy, RouteDirect:
+		default:
+			return fmt.Errorf("routing profile %s: final must be %s or %s", p.Name, RouteProxy, RouteDirect)
+		}
+		for _, list := range [][]string{p.DirectIPs, p.ProxyIPs, p.BlockIPs} {
+			for _, ip := range list {
+				if !validRouteIP(ip) {
+					return fmt.Errorf("routing profile %s: invalid ip rule %q", p.Name, ip)
+				}
+			}
+		}
+		for _, list := range [][]string{p.DirectDomains, p.ProxyDomains, p.BlockDomains} {
+			for _, domain := range list {
+				if strings.TrimSpace(domain) == "" || strings.ContainsAny(domain, " ,") {
+					return fmt.Errorf("routing profile %s: invalid domain rule %q", p.Name, domain)
+				}
+			}
+		}
+	}
+
+	if r.Default != "" && !names[r.Default] {
+		return fmt.Errorf("default routing profile %q does not exist", r.Default)
+	}
+	for userID, name := range r.UserProfiles {
+		if !names[name] {
+			return fmt.Errorf("routing profile %q for user %d does not exist", name, userID)
+		}
+	}
+	for group, name := range r.GroupProfiles {
+		if !names[name] {
+			return fmt.Errorf("routing profile %q for group %s does not exist", name, group)
+		}
+	}
+	return nil
+}
+
+// validRouteIP 判断 IP 规则是否为 CIDR、单个地址或 geoip: 规则
+func validRouteIP(rule string) bool {
+	if strings.HasPrefix(rule, "geoip:") {
+		return len(rule) > len("geoip:")
+	}
+	if _, _, err := net.ParseCIDR(rule); err == nil {
+		return true
+	}
+	return net.ParseIP(rule) != nil
+}
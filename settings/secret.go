@@ -0,0 +1,225 @@
+package settings
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// secretPrefix 加密后的密文前缀，用于区分明文和密文
+const secretPrefix = "enc:v1:"
+
+// secretKeyEnv 指定 base64 编码的 32 字节密钥的环境变量，未设置时使用设置目录下的密钥文件
+const secretKeyEnv = "SETTINGS_SECRET_KEY"
+
+var (
+	secretMu  sync.RWMutex
+	secretKey []byte
+)
+
+// Secret 加密保存的凭据。序列化为 JSON 时使用 AES-GCM 加密，反序列化时解密，
+// 内存中始终是明文。API 返回的密文原样提交时可以正确解密，提交明文时按新值保存
+type Secret string
+
+// MarshalJSON 实现json.Marshaler接口
+func (s Secret) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return json.Marshal("")
+	}
+	encrypted, err := encryptSecret(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encrypted)
+}
+
+// UnmarshalJSON 实现json.Unmarshaler接口。
+// 密钥不匹配（如在其他主机上恢复设置）时凭据置空，需要重新填写，不影响其他设置的加载
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(value, secretPrefix) {
+		*s = Secret(value)
+		return nil
+	}
+	plain, err := decryptSecret(value)
+	if err != nil {
+		*s = ""
+		return nil
+	}
+	*s = Secret(plain)
+	return nil
+}
+
+// String 返回明文
+func (s Secret) String() string {
+	return string(s)
+}
+
+// RowCipher 使用设置加密密钥加密数据库中的敏感列，实现 model.FieldCipher。
+// 密文格式与 Secret 相同，更换密钥后已加密的记录无法读取
+type RowCipher struct{}
+
+// Encrypt 加密明文
+func (RowCipher) Encrypt(plain string) (string, error) {
+	return encryptSecret(plain)
+}
+
+// Decrypt 解密密文，未加密的值原样返回
+func (RowCipher) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, secretPrefix) {
+		return value, nil
+	}
+	return decryptSecret(value)
+}
+
+// IsEncrypted 判断是否为密文
+func (RowCipher) IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// Hash 返回 HMAC-SHA256 摘要，密钥未加载时返回空字符串
+func (RowCipher) Hash(value string) string {
+	return KeyedHash("row-index", value)
+}
+
+// KeyedHash 使用设置加密密钥计算 value 的 HMAC-SHA256 十六进制值，domain 区分不同用途，
+// 密钥未加载时返回空字符串
+func KeyedHash(domain, value string) string {
+	secretMu.RLock()
+	key := secretKey
+	secretMu.RUnlock()
+	if key == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(domain + ":"))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 从订阅签名密钥派生的密钥用途
+const (
+	SubscriptionKeyURL     = "sub-url"     // 签名订阅地址
+	SubscriptionKeyWebhook = "sub-webhook" // 签名 CDN 缓存清除请求
+)
+
+// DeriveSubscriptionKey 从订阅签名密钥派生指定用途的密钥，值为 hex(HMAC-SHA256(signingKey, purpose))。
+// 不同用途的签名互不通用，缓存清除地址的接收方拿到的密钥不能用来签名订阅地址
+func DeriveSubscriptionKey(signingKey, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SwapSecretKey 替换当前的设置加密密钥并返回原密钥，用于其他包的测试临时使用固定密钥，结束后换回原密钥。
+// 正常运行时密钥由 Manager.Load 加载
+func SwapSecretKey(key []byte) []byte {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	previous := secretKey
+	secretKey = key
+	return previous
+}
+
+// loadSecretKey 从环境变量或密钥文件加载设置加密密钥，密钥文件不存在时生成
+func loadSecretKey(dir string) error {
+	var key []byte
+	if encoded := os.Getenv(secretKeyEnv); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(decoded) != 32 {
+			return fmt.Errorf("invalid %s: must be 32 bytes base64 encoded", secretKeyEnv)
+		}
+		key = decoded
+	} else {
+		path := filepath.Join(dir, "secret.key")
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+			if err != nil || len(decoded) != 32 {
+				return fmt.Errorf("invalid secret key file %s", path)
+			}
+			key = decoded
+		case os.IsNotExist(err):
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return fmt.Errorf("failed to generate secret key: %v", err)
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create config directory: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+				return fmt.Errorf("failed to write secret key file: %v", err)
+			}
+		default:
+			return fmt.Errorf("failed to read secret key file: %v", err)
+		}
+	}
+
+	secretMu.Lock()
+	secretKey = key
+	secretMu.Unlock()
+	return nil
+}
+
+// secretAEAD 返回当前密钥的 AES-GCM 实例
+func secretAEAD() (cipher.AEAD, error) {
+	secretMu.RLock()
+	key := secretKey
+	secretMu.RUnlock()
+	if key == nil {
+		return nil, fmt.Errorf("settings secret key not loaded")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret 加密明文，返回带前缀的 base64 密文
+func encryptSecret(plain string) (string, error) {
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %v", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密带前缀的密文
+func decryptSecret(value string) (string, error) {
+	aead, err := secretAEAD()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret: %v", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("secret too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %v", err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,102 @@
+package settings
+
+import (
+	"strings"
+	"testing"
+)
+
+// useTestSecretKey 在测试期间加载临时目录下新生成的密钥，结束后还原
+func useTestSecretKey(t *testing.T) {
+	t.Helper()
+	secretMu.RLock()
+	previous := secretKey
+	secretMu.RUnlock()
+	t.Cleanup(func() {
+		secretMu.Lock()
+		secretKey = previous
+		secretMu.Unlock()
+	})
+
+	t.Setenv(secretKeyEnv, "")
+	if err := loadSecretKey(t.TempDir()); err != nil {
+		t.Fatalf("loadSecretKey: %v", err)
+	}
+}
+
+func TestRowCipherRoundTrip(t *testing.T) {
+	useTestSecretKey(t)
+	var c RowCipher
+
+	tests := []struct {
+		name  string
+		plain string
+	}{
+		{name: "email", plain: "alice@example.com"},
+		{name: "json settings", plain: `{"clients":[{"id":"b831381d-6324-4d53-ad4f-8cda48b30811"}]}`},
+		{name: "unicode", plain: "备注：测试"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := c.Encrypt(tt.plain)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if !c.IsEncrypted(sealed) || strings.Contains(sealed, tt.plain) {
+				t.Fatalf("Encrypt(%q) = %q, want ciphertext with %s prefix", tt.plain, sealed, secretPrefix)
+			}
+			if c.IsEncrypted(tt.plain) {
+				t.Errorf("IsEncrypted(%q) = true for plaintext", tt.plain)
+			}
+
+			plain, err := c.Decrypt(sealed)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if plain != tt.plain {
+				t.Errorf("Decrypt = %q, want %q", plain, tt.plain)
+			}
+
+			// 加密前写入的明文原样返回
+			if got, err := c.Decrypt(tt.plain); err != nil || got != tt.plain {
+				t.Errorf("Decrypt(plaintext) = %q, %v; want it unchanged", got, err)
+			}
+		})
+	}
+}
+
+func TestRowCipherHash(t *testing.T) {
+	useTestSecretKey(t)
+	var c RowCipher
+
+	tests := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{name: "same value", a: "alice@example.com", b: "alice@example.com", equal: true},
+		{name: "different value", a: "alice@example.com", b: "bob@example.com", equal: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := c.Hash(tt.a), c.Hash(tt.b)
+			if a == "" || b == "" {
+				t.Fatal("Hash returned empty string with a loaded key")
+			}
+			if (a == b) != tt.equal {
+				t.Errorf("Hash(%q) == Hash(%q) is %v, want %v", tt.a, tt.b, a == b, tt.equal)
+			}
+		})
+	}
+
+	// 用途不同的摘要互不相同，验证令牌的签名不能当作查找摘要使用
+	if c.Hash("alice@example.com") == KeyedHash("email-verification", "alice@example.com") {
+		t.Error("row hash collides with another domain")
+	}
+
+	// 更换密钥后摘要随之变化，旧库中的 email_hash 需要重新计算
+	before := c.Hash("alice@example.com")
+	useTestSecretKey(t)
+	if c.Hash("alice@example.com") == before {
+		t.Error("hash did not change with a new key")
+	}
+}
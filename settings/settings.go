@@ -1,14 +1,20 @@
 package settings
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"v/logger"
@@ -20,14 +26,96 @@ type SiteSettings struct {
 	Description     string `json:"description" env:"SITE_DESCRIPTION"`
 	AllowRegister   bool   `json:"allow_register" env:"SITE_ALLOW_REGISTER"`
 	MaintenanceMode bool   `json:"maintenance_mode" env:"SITE_MAINTENANCE_MODE"`
+	Timezone        string `json:"timezone" env:"SITE_TIMEZONE"` // 面板时区，如 Asia/Shanghai，为空使用服务器本地时区
+}
+
+// locations 已加载的时区
+var locations sync.Map
+
+// Location 返回面板时区，未配置或无法加载时使用服务器本地时区
+func (s SiteSettings) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.Local
+	}
+	if loc, ok := locations.Load(s.Timezone); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	locations.Store(s.Timezone, loc)
+	return loc
+}
+
+// ValidateTimezone 检查时区是否为有效的 IANA 时区名称
+func (s SiteSettings) ValidateTimezone() error {
+	if s.Timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %v", s.Timezone, err)
+	}
+	return nil
 }
 
 // TrafficSettings represents traffic settings
 type TrafficSettings struct {
-	DefaultLimit      int64         `json:"default_limit" env:"TRAFFIC_DEFAULT_LIMIT"`
-	StatsInterval     time.Duration `json:"stats_interval" env:"TRAFFIC_STATS_INTERVAL"`
-	WarningPercent    int           `json:"warning_percent" env:"TRAFFIC_WARNING_PERCENT"`
-	AccountExpireDays int           `json:"account_expire_days" env:"TRAFFIC_ACCOUNT_EXPIRE_DAYS"`
+	DefaultLimit       int64         `json:"default_limit" env:"TRAFFIC_DEFAULT_LIMIT"`
+	StatsInterval      time.Duration `json:"stats_interval" env:"TRAFFIC_STATS_INTERVAL"`
+	WarningPercent     int           `json:"warning_percent" env:"TRAFFIC_WARNING_PERCENT"`
+	AccountExpireDays  int           `json:"account_expire_days" env:"TRAFFIC_ACCOUNT_EXPIRE_DAYS"`
+	CollectTargets     []string      `json:"collect_targets" env:"TRAFFIC_COLLECT_TARGETS"`         // 拉取流量计数的 xray API 地址，格式为 name=host:port 或 host:port
+	CollectConcurrency int           `json:"collect_concurrency" env:"TRAFFIC_COLLECT_CONCURRENCY"` // 同时采集的目标数，默认 4
+	CollectTimeout     time.Duration `json:"collect_timeout" env:"TRAFFIC_COLLECT_TIMEOUT"`         // 单个目标的采集超时，默认 5 秒
+	SampleTargets      []string      `json:"sample_targets" env:"TRAFFIC_SAMPLE_TARGETS"`           // 使用采样模式的采集目标（节点），格式为 name 或 name=ratio，ratio 单独指定该目标的采样比例
+	SampleRatio        float64       `json:"sample_ratio" env:"TRAFFIC_SAMPLE_RATIO"`               // 采样模式下每个采集周期实际计数的时间比例（0-1），其余时间按比例外推，默认 0.1
+}
+
+// DefaultSampleRatio 未配置采样比例时的默认值
+const DefaultSampleRatio = 0.1
+
+// SamplingRatio 返回采集目标的采样比例，目标不使用采样模式时返回 0
+func (s TrafficSettings) SamplingRatio(target string) float64 {
+	for _, spec := range s.SampleTargets {
+		name, ratio, err := s.parseSampleTarget(spec)
+		if err == nil && name == target {
+			return ratio
+		}
+	}
+	return 0
+}
+
+// ValidateSampling 校验采样模式设置
+func (s TrafficSettings) ValidateSampling() error {
+	if s.SampleRatio < 0 || s.SampleRatio >= 1 {
+		return fmt.Errorf("sample_ratio must be between 0 and 1")
+	}
+	for _, spec := range s.SampleTargets {
+		if _, _, err := s.parseSampleTarget(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSampleTarget 解析 name 或 name=ratio 格式的采样目标
+func (s TrafficSettings) parseSampleTarget(spec string) (string, float64, error) {
+	name, value, found := strings.Cut(strings.TrimSpace(spec), "=")
+	if name == "" {
+		return "", 0, fmt.Errorf("invalid sample target %q", spec)
+	}
+	if !found {
+		if s.SampleRatio > 0 {
+			return name, s.SampleRatio, nil
+		}
+		return name, DefaultSampleRatio, nil
+	}
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio <= 0 || ratio >= 1 {
+		return "", 0, fmt.Errorf("invalid sample ratio for target %q: must be between 0 and 1", name)
+	}
+	return name, ratio, nil
 }
 
 // SSLSettings represents SSL settings
@@ -43,6 +131,7 @@ type SSLSettings struct {
 	RenewInterval     time.Duration `json:"renew_interval" env:"SSL_RENEW_INTERVAL"`
 	ExpiryWarningDays time.Duration `json:"expiry_warning_days" env:"SSL_EXPIRY_WARNING_DAYS"`
 	RenewBeforeDays   time.Duration `json:"renew_before_days" env:"SSL_RENEW_BEFORE_DAYS"`
+	AllowInsecureKeys bool          `json:"allow_insecure_keys" env:"SSL_ALLOW_INSECURE_KEYS"` // 允许将其他用户可读的私钥写入 xray 配置
 }
 
 // ProxySettings represents proxy settings
@@ -55,43 +144,136 @@ type ProxySettings struct {
 
 // SecuritySettings represents security settings
 type SecuritySettings struct {
-	JWTSecret         string        `json:"jwt_secret" env:"SECURITY_JWT_SECRET"`
-	TokenExpiry       time.Duration `json:"token_expiry" env:"SECURITY_TOKEN_EXPIRY"`
-	MinPasswordLength int           `json:"min_password_length" env:"SECURITY_MIN_PASSWORD_LENGTH"`
-	LoginAttempts     int           `json:"login_attempts" env:"SECURITY_LOGIN_ATTEMPTS"`
-	LockoutTime       time.Duration `json:"lockout_time" env:"SECURITY_LOCKOUT_TIME"`
+	JWTSecret          string        `json:"jwt_secret" env:"SECURITY_JWT_SECRET" secret:"true"`
+	TokenExpiry        time.Duration `json:"token_expiry" env:"SECURITY_TOKEN_EXPIRY"`
+	MinPasswordLength  int           `json:"min_password_length" env:"SECURITY_MIN_PASSWORD_LENGTH"`
+	LoginAttempts      int           `json:"login_attempts" env:"SECURITY_LOGIN_ATTEMPTS"`
+	LockoutTime        time.Duration `json:"lockout_time" env:"SECURITY_LOCKOUT_TIME"`
+	APIRateLimit       float64       `json:"api_rate_limit" env:"SECURITY_API_RATE_LIMIT"`             // 每个 API 密钥每秒请求数，0 表示不限制
+	APIRateBurst       int           `json:"api_rate_burst" env:"SECURITY_API_RATE_BURST"`             // 突发请求数
+	APIErrorThreshold  float64       `json:"api_error_threshold" env:"SECURITY_API_ERROR_THRESHOLD"`   // 错误率超过该值时收紧限速，0 表示不启用
+	APIUsageRetention  time.Duration `json:"api_usage_retention" env:"SECURITY_API_USAGE_RETENTION"`   // 使用统计保留时长
+	SessionIdleTimeout time.Duration `json:"session_idle_timeout" env:"SECURITY_SESSION_IDLE_TIMEOUT"` // 会话无操作超过该时长后失效，与令牌有效期分开计算，0 表示不限制
+	MaxAdminSessions   int           `json:"max_admin_sessions" env:"SECURITY_MAX_ADMIN_SESSIONS"`     // 每个管理员账户同时保持的会话数，超过时注销最早的会话，0 表示不限制
 }
 
 // NotificationSettings represents notification settings
 type NotificationSettings struct {
-	EnableEmail  bool   `json:"enable_email" env:"NOTIFICATION_ENABLE_EMAIL"`
-	SMTPHost     string `json:"smtp_host" env:"NOTIFICATION_SMTP_HOST"`
-	SMTPPort     int    `json:"smtp_port" env:"NOTIFICATION_SMTP_PORT"`
-	SMTPUser     string `json:"smtp_user" env:"NOTIFICATION_SMTP_USER"`
-	SMTPPassword string `json:"smtp_password" env:"NOTIFICATION_SMTP_PASSWORD"`
-	FromEmail    string `json:"from_email" env:"NOTIFICATION_FROM_EMAIL"`
-	FromName     string `json:"from_name" env:"NOTIFICATION_FROM_NAME"`
+	EnableEmail      bool          `json:"enable_email" env:"NOTIFICATION_ENABLE_EMAIL"`
+	SMTPHost         string        `json:"smtp_host" env:"NOTIFICATION_SMTP_HOST"`
+	SMTPPort         int           `json:"smtp_port" env:"NOTIFICATION_SMTP_PORT"`
+	SMTPUser         string        `json:"smtp_user" env:"NOTIFICATION_SMTP_USER"`
+	SMTPPassword     string        `json:"smtp_password" env:"NOTIFICATION_SMTP_PASSWORD" secret:"true"`
+	FromEmail        string        `json:"from_email" env:"NOTIFICATION_FROM_EMAIL"`
+	FromName         string        `json:"from_name" env:"NOTIFICATION_FROM_NAME"`
+	ActivityAlerts   bool          `json:"activity_alerts" env:"NOTIFICATION_ACTIVITY_ALERTS"`     // 从新 IP/国家登录或拉取订阅、超出设备数时邮件提醒用户
+	MaxDevices       int           `json:"max_devices" env:"NOTIFICATION_MAX_DEVICES"`             // 同时在线设备（IP）上限，0 表示不检查
+	ActivityCooldown time.Duration `json:"activity_cooldown" env:"NOTIFICATION_ACTIVITY_COOLDOWN"` // 同一用户同类提醒的最小间隔，默认 1 小时
+	VerificationURL  string        `json:"verification_url" env:"NOTIFICATION_VERIFICATION_URL"`   // 邮箱验证页面地址，令牌作为 token 参数附加，为空时邮件中只包含令牌
+	VerificationTTL  time.Duration `json:"verification_ttl" env:"NOTIFICATION_VERIFICATION_TTL"`   // 邮箱验证链接有效期，默认 24 小时
+}
+
+// ValidateVerification 校验邮箱验证设置
+func (s NotificationSettings) ValidateVerification() error {
+	if s.VerificationURL != "" {
+		u, err := url.Parse(s.VerificationURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid verification url %q", s.VerificationURL)
+		}
+	}
+	if s.VerificationTTL < 0 {
+		return fmt.Errorf("verification ttl must not be negative")
+	}
+	return nil
 }
 
 // BackupSettings represents backup settings
 type BackupSettings struct {
-	Enable      bool          `json:"enable" env:"BACKUP_ENABLE"`
-	Interval    time.Duration `json:"interval" env:"BACKUP_INTERVAL"`
-	Retention   int           `json:"retention" env:"BACKUP_RETENTION"`
-	Path        string        `json:"path" env:"BACKUP_PATH"`
-	Compression bool          `json:"compression" env:"BACKUP_COMPRESSION"`
+	Enable      bool           `json:"enable" env:"BACKUP_ENABLE"`
+	Interval    time.Duration  `json:"interval" env:"BACKUP_INTERVAL"`
+	Retention   int            `json:"retention" env:"BACKUP_RETENTION"`
+	Path        string         `json:"path" env:"BACKUP_PATH"`
+	Compression bool           `json:"compression" env:"BACKUP_COMPRESSION"`
+	Time        string         `json:"time" env:"BACKUP_TIME"` // 每日备份时间（面板时区），如 03:00，为空时按 Interval 间隔备份
+	Targets     []BackupTarget `json:"targets"`                // 远程备份目标，本地备份完成后依次上传
+}
+
+// 远程备份目标类型
+const (
+	BackupTargetS3     = "s3"
+	BackupTargetWebDAV = "webdav"
+	BackupTargetSFTP   = "sftp"
+)
+
+// BackupTarget 远程备份目标，凭据加密保存
+type BackupTarget struct {
+	Name       string `json:"name"` // 目标名称，唯一
+	Type       string `json:"type"` // s3、webdav 或 sftp
+	Enable     bool   `json:"enable"`
+	Endpoint   string `json:"endpoint"`    // S3 为 https://s3.example.com，WebDAV 为目录 URL，SFTP 为 host:port
+	Region     string `json:"region"`      // S3 区域，默认 us-east-1
+	Bucket     string `json:"bucket"`      // S3 存储桶
+	Path       string `json:"path"`        // 远程目录或对象前缀
+	Username   string `json:"username"`    // S3 为 Access Key ID
+	Password   Secret `json:"password"`    // S3 为 Secret Access Key
+	PrivateKey Secret `json:"private_key"` // SFTP 私钥（PEM），与密码二选一
+	HostKey    string `json:"host_key"`    // SFTP 服务器公钥（authorized_keys 格式），SFTP 必填
+	Retention  int    `json:"retention"`   // 远程保留的备份数量，0 表示与本地相同
+}
+
+// ValidateTargets 校验远程备份目标
+func (s BackupSettings) ValidateTargets() error {
+	names := make(map[string]bool, len(s.Targets))
+	for _, target := range s.Targets {
+		if target.Name == "" {
+			return fmt.Errorf("backup target name is required")
+		}
+		if names[target.Name] {
+			return fmt.Errorf("duplicate backup target: %s", target.Name)
+		}
+		names[target.Name] = true
+
+		switch target.Type {
+		case BackupTargetS3:
+			if target.Bucket == "" {
+				return fmt.Errorf("backup target %s: bucket is required", target.Name)
+			}
+		case BackupTargetSFTP:
+			if strings.TrimSpace(target.HostKey) == "" {
+				return fmt.Errorf("backup target %s: host_key is required", target.Name)
+			}
+		case BackupTargetWebDAV:
+		default:
+			return fmt.Errorf("backup target %s: unsupported type %q", target.Name, target.Type)
+		}
+		if target.Endpoint == "" {
+			return fmt.Errorf("backup target %s: endpoint is required", target.Name)
+		}
+		if target.Retention < 0 {
+			return fmt.Errorf("backup target %s: retention must not be negative", target.Name)
+		}
+	}
+	return nil
 }
 
 // MonitorSettings represents monitor settings
 type MonitorSettings struct {
-	Interval          time.Duration `json:"interval" env:"MONITOR_INTERVAL"`
-	CPUThreshold      float64       `json:"cpu_threshold" env:"MONITOR_CPU_THRESHOLD"`
-	MemoryThreshold   float64       `json:"memory_threshold" env:"MONITOR_MEMORY_THRESHOLD"`
-	DiskThreshold     float64       `json:"disk_threshold" env:"MONITOR_DISK_THRESHOLD"`
-	EnableCPUAlert    bool          `json:"enable_cpu_alert" env:"MONITOR_ENABLE_CPU_ALERT"`
-	EnableMemoryAlert bool          `json:"enable_memory_alert" env:"MONITOR_ENABLE_MEMORY_ALERT"`
-	EnableDiskAlert   bool          `json:"enable_disk_alert" env:"MONITOR_ENABLE_DISK_ALERT"`
-	AlertInterval     int           `json:"alert_interval" env:"MONITOR_ALERT_INTERVAL"`
+	Interval             time.Duration `json:"interval" env:"MONITOR_INTERVAL"`
+	CPUThreshold         float64       `json:"cpu_threshold" env:"MONITOR_CPU_THRESHOLD"`
+	MemoryThreshold      float64       `json:"memory_threshold" env:"MONITOR_MEMORY_THRESHOLD"`
+	DiskThreshold        float64       `json:"disk_threshold" env:"MONITOR_DISK_THRESHOLD"`
+	EnableCPUAlert       bool          `json:"enable_cpu_alert" env:"MONITOR_ENABLE_CPU_ALERT"`
+	EnableMemoryAlert    bool          `json:"enable_memory_alert" env:"MONITOR_ENABLE_MEMORY_ALERT"`
+	EnableDiskAlert      bool          `json:"enable_disk_alert" env:"MONITOR_ENABLE_DISK_ALERT"`
+	AlertInterval        int           `json:"alert_interval" env:"MONITOR_ALERT_INTERVAL"`
+	CPUClearThreshold    float64       `json:"cpu_clear_threshold" env:"MONITOR_CPU_CLEAR_THRESHOLD"` // 恢复阈值，为 0 时使用触发阈值减 5
+	MemoryClearThreshold float64       `json:"memory_clear_threshold" env:"MONITOR_MEMORY_CLEAR_THRESHOLD"`
+	DiskClearThreshold   float64       `json:"disk_clear_threshold" env:"MONITOR_DISK_CLEAR_THRESHOLD"`
+	AlertMinDuration     time.Duration `json:"alert_min_duration" env:"MONITOR_ALERT_MIN_DURATION"`
+	MinFreeDiskMB        int64         `json:"min_free_disk_mb" env:"MONITOR_MIN_FREE_DISK_MB"`         // 0 使用默认值，负数关闭检查
+	NTPServers           []string      `json:"ntp_servers" env:"MONITOR_NTP_SERVERS"`                   // 时钟检查使用的 NTP 服务器，为空使用默认列表
+	ClockSkewThreshold   time.Duration `json:"clock_skew_threshold" env:"MONITOR_CLOCK_SKEW_THRESHOLD"` // 时钟偏差告警阈值，0 使用默认值，负数关闭检查
+	ClockCheckInterval   time.Duration `json:"clock_check_interval" env:"MONITOR_CLOCK_CHECK_INTERVAL"`
 }
 
 // LogSettings represents log settings
@@ -107,6 +289,73 @@ type LogSettings struct {
 	ErrorFilePath string        `json:"error_file_path" env:"LOG_ERROR_FILE_PATH"`
 	SeparateError bool          `json:"separate_error" env:"LOG_SEPARATE_ERROR"`
 	RotateTime    time.Duration `json:"rotate_time" env:"LOG_ROTATE_TIME"`
+
+	ShipTarget     string `json:"ship_target" env:"LOG_SHIP_TARGET"`           // 日志外发目标：syslog（远程 syslog 服务器）或 journald，为空时不外发
+	ShipLevel      string `json:"ship_level" env:"LOG_SHIP_LEVEL"`             // 外发的最低级别：debug、info、warn、error，默认 info
+	ShipXray       bool   `json:"ship_xray" env:"LOG_SHIP_XRAY"`               // 同时外发 Xray 的输出
+	SyslogAddress  string `json:"syslog_address" env:"LOG_SYSLOG_ADDRESS"`     // syslog 服务器地址 host:port
+	SyslogNetwork  string `json:"syslog_network" env:"LOG_SYSLOG_NETWORK"`     // 传输方式：udp、tcp、tls，默认 udp
+	SyslogFacility string `json:"syslog_facility" env:"LOG_SYSLOG_FACILITY"`   // syslog facility，如 daemon、local0，默认 daemon
+	SyslogAppName  string `json:"syslog_app_name" env:"LOG_SYSLOG_APP_NAME"`   // syslog APP-NAME 和 journald SYSLOG_IDENTIFIER，默认 v，Xray 日志固定为 xray
+	SyslogCAFile   string `json:"syslog_ca_file" env:"LOG_SYSLOG_CA_FILE"`     // tls 时校验服务器证书的 CA 文件，为空时使用系统根证书
+	SyslogCertFile string `json:"syslog_cert_file" env:"LOG_SYSLOG_CERT_FILE"` // tls 时的客户端证书，服务器要求双向认证时配置
+	SyslogKeyFile  string `json:"syslog_key_file" env:"LOG_SYSLOG_KEY_FILE"`   // 客户端证书的私钥
+}
+
+// 日志外发目标
+const (
+	LogShipSyslog   = "syslog"
+	LogShipJournald = "journald"
+)
+
+// SyslogFacilities syslog facility 名称和编号
+var SyslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ValidateShipping 校验日志外发设置
+func (s LogSettings) ValidateShipping() error {
+	switch s.ShipLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unsupported ship_level %q", s.ShipLevel)
+	}
+	switch s.ShipTarget {
+	case "", LogShipJournald:
+		return nil
+	case LogShipSyslog:
+	default:
+		return fmt.Errorf("unsupported log ship target %q", s.ShipTarget)
+	}
+
+	if s.SyslogAddress == "" {
+		return fmt.Errorf("syslog_address is required when shipping logs to syslog")
+	}
+	if _, _, err := net.SplitHostPort(s.SyslogAddress); err != nil {
+		return fmt.Errorf("invalid syslog_address %q: %v", s.SyslogAddress, err)
+	}
+	switch s.SyslogNetwork {
+	case "", "udp", "tcp", "tls":
+	default:
+		return fmt.Errorf("unsupported syslog_network %q, expected udp, tcp or tls", s.SyslogNetwork)
+	}
+	if _, ok := SyslogFacilities[s.SyslogFacility]; s.SyslogFacility != "" && !ok {
+		return fmt.Errorf("unknown syslog_facility %q", s.SyslogFacility)
+	}
+	if (s.SyslogCertFile == "") != (s.SyslogKeyFile == "") {
+		return fmt.Errorf("syslog_cert_file and syslog_key_file must be set together")
+	}
+	return nil
+}
+
+// CrashSettings represents crash report settings
+type CrashSettings struct {
+	Dir        string `json:"dir" env:"CRASH_DIR"`                 // 崩溃报告目录，默认 logs/crashes
+	MaxReports int    `json:"max_reports" env:"CRASH_MAX_REPORTS"` // 保留的崩溃报告数，默认 20
+	LogLines   int    `json:"log_lines" env:"CRASH_LOG_LINES"`     // 报告附带的最近日志行数，默认 100
+	UploadURL  string `json:"upload_url" env:"CRASH_UPLOAD_URL"`   // 同时上报到该地址（POST JSON），为空时只保存在本地
 }
 
 // AdminSettings represents admin settings
@@ -116,15 +365,411 @@ type AdminSettings struct {
 
 // XraySettings represents xray settings
 type XraySettings struct {
-	Version       string        `json:"version" env:"XRAY_VERSION"`
-	AutoUpdate    bool          `json:"auto_update" env:"XRAY_AUTO_UPDATE"`
-	CheckInterval time.Duration `json:"check_interval" env:"XRAY_CHECK_INTERVAL"`
-	CustomConfig  bool          `json:"custom_config" env:"XRAY_CUSTOM_CONFIG"`
-	ConfigPath    string        `json:"config_path" env:"XRAY_CONFIG_PATH"`
+	Version                string            `json:"version" env:"XRAY_VERSION"`
+	AutoUpdate             bool              `json:"auto_update" env:"XRAY_AUTO_UPDATE"`
+	CheckInterval          time.Duration     `json:"check_interval" env:"XRAY_CHECK_INTERVAL"`
+	CustomConfig           bool              `json:"custom_config" env:"XRAY_CUSTOM_CONFIG"`
+	ConfigPath             string            `json:"config_path" env:"XRAY_CONFIG_PATH"`
+	CPULimit               float64           `json:"cpu_limit" env:"XRAY_CPU_LIMIT"`                             // 可使用的 CPU 核数，如 0.5，0 表示不限制
+	MemoryLimitMB          int64             `json:"memory_limit_mb" env:"XRAY_MEMORY_LIMIT_MB"`                 // 内存上限（MB），0 表示不限制
+	Nice                   int               `json:"nice" env:"XRAY_NICE"`                                       // 进程优先级，-20 到 19
+	IOClass                string            `json:"io_class" env:"XRAY_IO_CLASS"`                               // IO 调度类别：best-effort、idle，仅 Linux
+	IOPriority             int               `json:"io_priority" env:"XRAY_IO_PRIORITY"`                         // best-effort 类别下的 IO 优先级，0 到 7
+	SnapshotKeep           int               `json:"snapshot_keep" env:"XRAY_SNAPSHOT_KEEP"`                     // 保留的配置快照数量，0 使用默认值 20，负数表示不保存
+	SnapshotMaxAge         time.Duration     `json:"snapshot_max_age" env:"XRAY_SNAPSHOT_MAX_AGE"`               // 快照最长保留时间，0 表示不按时间清理
+	DomainStrategy         string            `json:"domain_strategy" env:"XRAY_DOMAIN_STRATEGY"`                 // 出站默认 domainStrategy：AsIs、UseIP、UseIPv4、UseIPv6 等，默认 UseIP
+	OutboundDomainStrategy map[string]string `json:"outbound_domain_strategy"`                                   // 按出站 tag 覆盖 domainStrategy，如 {"direct": "AsIs"}
+	RoutingDomainStrategy  string            `json:"routing_domain_strategy" env:"XRAY_ROUTING_DOMAIN_STRATEGY"` // 路由 domainStrategy：AsIs、IPIfNonMatch、IPOnDemand，默认 AsIs
+	DNSDisableCache        bool              `json:"dns_disable_cache" env:"XRAY_DNS_DISABLE_CACHE"`             // 关闭 Xray 内置 DNS 缓存
+	SendThrough            string            `json:"send_through" env:"XRAY_SEND_THROUGH"`                       // 出站默认出口 IP，多 IP 服务器上使用，空表示由系统选择
+	OutboundSendThrough    map[string]string `json:"outbound_send_through"`                                      // 按出站 tag 指定出口 IP，如 {"direct": "203.0.113.10"}
+	GroupSendThrough       map[string]string `json:"group_send_through"`                                         // 按用户分组（协议标签）指定出口 IP，优先于出站设置
+	ApplyDelay             time.Duration     `json:"apply_delay" env:"XRAY_APPLY_DELAY"`                         // 协议修改后等待该时间合并后续修改再重新生成配置，默认 2 秒，负数表示立即应用
+	LogStoreLevel          string            `json:"log_store_level" env:"XRAY_LOG_STORE_LEVEL"`                 // 写入日志表的 Xray 输出最低级别：warning、error、none，默认 warning
+	InboundMaxConnections  map[string]int    `json:"inbound_max_connections"`                                    // 按协议 ID 限制入站的 TCP 并发连接数，如 {"12": 200}，0 或未设置表示不限制
+}
+
+var (
+	// outboundDomainStrategies freedom 出站支持的 domainStrategy
+	outboundDomainStrategies = []string{"AsIs", "UseIP", "UseIPv4", "UseIPv6", "UseIPv4v6", "UseIPv6v4", "ForceIP", "ForceIPv4", "ForceIPv6", "ForceIPv4v6", "ForceIPv6v4"}
+	// routingDomainStrategies 路由支持的 domainStrategy
+	routingDomainStrategies = []string{"AsIs", "IPIfNonMatch", "IPOnDemand"}
+)
+
+// OutboundStrategy 返回指定出站使用的 domainStrategy
+func (x XraySettings) OutboundStrategy(tag string) string {
+	if strategy := x.OutboundDomainStrategy[tag]; strategy != "" {
+		return strategy
+	}
+	if x.DomainStrategy != "" {
+		return x.DomainStrategy
+	}
+	return "UseIP"
+}
+
+// MaxConnections 返回入站的并发连接数上限，0 表示不限制
+func (x XraySettings) MaxConnections(protocolID int64) int {
+	if limit := x.InboundMaxConnections[strconv.FormatInt(protocolID, 10)]; limit > 0 {
+		return limit
+	}
+	return 0
+}
+
+// RoutingStrategy 返回路由使用的 domainStrategy
+func (x XraySettings) RoutingStrategy() string {
+	if x.RoutingDomainStrategy != "" {
+		return x.RoutingDomainStrategy
+	}
+	return "AsIs"
+}
+
+// ValidateStrategies 检查 domainStrategy 设置是否为 Xray 支持的值
+func (x XraySettings) ValidateStrategies() error {
+	if x.DomainStrategy != "" && !containsString(outboundDomainStrategies, x.DomainStrategy) {
+		return fmt.Errorf("invalid domain strategy %q", x.DomainStrategy)
+	}
+	for tag, strategy := range x.OutboundDomainStrategy {
+		if !containsString(outboundDomainStrategies, strategy) {
+			return fmt.Errorf("invalid domain strategy %q for outbound %q", strategy, tag)
+		}
+	}
+	if x.RoutingDomainStrategy != "" && !containsString(routingDomainStrategies, x.RoutingDomainStrategy) {
+		return fmt.Errorf("invalid routing domain strategy %q", x.RoutingDomainStrategy)
+	}
+	return nil
+}
+
+// ValidateResourceLimits 检查 xray 进程资源限制的取值范围
+func (x XraySettings) ValidateResourceLimits() error {
+	if x.CPULimit < 0 {
+		return fmt.Errorf("invalid cpu limit %v", x.CPULimit)
+	}
+	if x.MemoryLimitMB < 0 {
+		return fmt.Errorf("invalid memory limit %d", x.MemoryLimitMB)
+	}
+	if x.Nice < -20 || x.Nice > 19 {
+		return fmt.Errorf("nice must be between -20 and 19, got %d", x.Nice)
+	}
+	if x.IOClass != "" && x.IOClass != "best-effort" && x.IOClass != "idle" {
+		return fmt.Errorf("invalid io class %q", x.IOClass)
+	}
+	if x.IOPriority < 0 || x.IOPriority > 7 {
+		return fmt.Errorf("io priority must be between 0 and 7, got %d", x.IOPriority)
+	}
+	return nil
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeSettings represents multi-node latency probing settings
+type NodeSettings struct {
+	Name            string        `json:"name" env:"NODE_NAME"`                         // 本节点名称，在延迟矩阵中标识本节点
+	ControllerURL   string        `json:"controller_url" env:"NODE_CONTROLLER_URL"`     // 控制端面板地址（含路径前缀），如 https://panel.example.com，为空时本节点即控制端
+	Peers           []string      `json:"peers" env:"NODE_PEERS"`                       // 需要探测的其他节点，格式为 name=host:port，为空时不探测
+	ProbeInterval   time.Duration `json:"probe_interval" env:"NODE_PROBE_INTERVAL"`     // 探测间隔，默认 1 分钟
+	ProbeCount      int           `json:"probe_count" env:"NODE_PROBE_COUNT"`           // 每轮对每个节点的探测次数，默认 5
+	ProbeTimeout    time.Duration `json:"probe_timeout" env:"NODE_PROBE_TIMEOUT"`       // 单次探测超时，默认 2 秒
+	DegradedLatency time.Duration `json:"degraded_latency" env:"NODE_DEGRADED_LATENCY"` // 平均延迟超过该值视为链路劣化，默认 300 毫秒
+	DegradedLoss    float64       `json:"degraded_loss" env:"NODE_DEGRADED_LOSS"`       // 丢包率（%）超过该值视为链路劣化，默认 20
+	AgentURL        string        `json:"agent_url" env:"NODE_AGENT_URL"`               // 引导新节点时下载 agent 的地址，{arch} 替换为节点架构，为空时上传本程序（要求架构相同）
+
+	BandwidthBudget         int64    `json:"bandwidth_budget" env:"NODE_BANDWIDTH_BUDGET"`                   // 本节点每月流量预算（字节），按网卡计数统计，0 不限制
+	BudgetResetDay          int      `json:"budget_reset_day" env:"NODE_BUDGET_RESET_DAY"`                   // 每月流量重置日（1-28），与服务商账单日一致，默认 1
+	BudgetDirection         string   `json:"budget_direction" env:"NODE_BUDGET_DIRECTION"`                   // 计费方向：both（上下行合计）、out（仅出站）、in（仅入站）、max（取较大者），默认 both
+	BudgetAlertPercents     []int    `json:"budget_alert_percents" env:"NODE_BUDGET_ALERT_PERCENTS"`         // 用量达到预算的这些百分比时告警，每个周期各告警一次，默认 80,90,100
+	BudgetAction            string   `json:"budget_action" env:"NODE_BUDGET_ACTION"`                         // 预算将耗尽时的处理：none、throttle（限制并发连接数）、disable（停用入站），默认 none
+	BudgetActionPercent     int      `json:"budget_action_percent" env:"NODE_BUDGET_ACTION_PERCENT"`         // 用量达到预算的该百分比时执行处理，默认 95
+	BudgetThrottleConns     int      `json:"budget_throttle_conns" env:"NODE_BUDGET_THROTTLE_CONNS"`         // throttle 时非优先入站的最大并发连接数，默认 4
+	BudgetPriorityTag       string   `json:"budget_priority_tag" env:"NODE_BUDGET_PRIORITY_TAG"`             // 带有该标签的入站为优先入站，不受处理影响，默认 priority
+	BudgetExcludeInterfaces []string `json:"budget_exclude_interfaces" env:"NODE_BUDGET_EXCLUDE_INTERFACES"` // 不计入用量的网卡，如内网网卡，回环网卡始终排除
+}
+
+// CleanupSettings represents stale protocol cleanup settings
+type CleanupSettings struct {
+	Enable      bool          `json:"enable" env:"CLEANUP_ENABLE"`             // 定期检测长期没有流量和连接的入站
+	StaleDays   int           `json:"stale_days" env:"CLEANUP_STALE_DAYS"`     // 超过该天数没有流量和连接视为闲置，默认 30
+	Action      string        `json:"action" env:"CLEANUP_ACTION"`             // 处理方式：notify（仅通知）、disable（停用）、archive（删除入站并归档统计），默认 notify
+	GraceDays   int           `json:"grace_days" env:"CLEANUP_GRACE_DAYS"`     // 通知后等待的天数，期间恢复使用则不处理，默认 7
+	NotifyOwner bool          `json:"notify_owner" env:"CLEANUP_NOTIFY_OWNER"` // 同时通知入站所属用户
+	ExcludeTags []string      `json:"exclude_tags" env:"CLEANUP_EXCLUDE_TAGS"` // 带有这些标签的入站不检测
+	Interval    time.Duration `json:"interval" env:"CLEANUP_INTERVAL"`         // 检测间隔，默认 6 小时
+}
+
+// 客户端 IP 匿名化方式
+const (
+	PrivacyModeTruncate = "truncate"
+	PrivacyModeHash     = "hash"
+)
+
+// PrivacySettings represents client IP anonymization settings
+type PrivacySettings struct {
+	AnonymizeIPs bool          `json:"anonymize_ips" env:"PRIVACY_ANONYMIZE_IPS"` // 匿名化日志、登录和访问记录、在线客户端记录中的客户端 IP
+	Mode         string        `json:"mode" env:"PRIVACY_MODE"`                   // truncate（截断为网段，默认）或 hash（带密钥的哈希，仍可判断是否同一地址）
+	Delay        time.Duration `json:"delay" env:"PRIVACY_DELAY"`                 // 保留完整 IP 的时长，供处理滥用投诉，0 表示写入时即匿名化
+	IPv4Prefix   int           `json:"ipv4_prefix" env:"PRIVACY_IPV4_PREFIX"`     // 截断时保留的 IPv4 前缀长度，默认 24
+	IPv6Prefix   int           `json:"ipv6_prefix" env:"PRIVACY_IPV6_PREFIX"`     // 截断时保留的 IPv6 前缀长度，默认 48
+}
+
+// ValidatePrivacy 校验客户端 IP 匿名化设置
+func (s PrivacySettings) ValidatePrivacy() error {
+	switch s.Mode {
+	case "", PrivacyModeTruncate, PrivacyModeHash:
+	default:
+		return fmt.Errorf("unsupported privacy mode %q", s.Mode)
+	}
+	if s.Delay < 0 {
+		return fmt.Errorf("privacy delay must not be negative")
+	}
+	if s.IPv4Prefix < 0 || s.IPv4Prefix > 32 {
+		return fmt.Errorf("ipv4_prefix must be between 0 and 32")
+	}
+	if s.IPv6Prefix < 0 || s.IPv6Prefix > 128 {
+		return fmt.Errorf("ipv6_prefix must be between 0 and 128")
+	}
+	return nil
+}
+
+// HooksSettings represents custom event hook settings
+type HooksSettings struct {
+	Enable  bool          `json:"enable" env:"HOOKS_ENABLE"`   // 事件发生时执行自定义脚本或请求 HTTP 地址
+	Timeout time.Duration `json:"timeout" env:"HOOKS_TIMEOUT"` // 钩子的默认超时，默认 10 秒
+	Hooks   []Hook        `json:"hooks"`                       // 钩子列表，同一事件按顺序在后台执行
+}
+
+// Hook 事件钩子，Command 和 URL 二选一，事件以 JSON 从标准输入或请求体传入
+type Hook struct {
+	Name    string        `json:"name"`    // 名称，唯一
+	Enable  bool          `json:"enable"`  // 是否启用
+	Events  []string      `json:"events"`  // 触发的事件，如 user.quota_exceeded；node.* 匹配前缀，* 匹配所有事件
+	Command string        `json:"command"` // 本地可执行文件的绝对路径，不经过 shell
+	Args    []string      `json:"args"`    // 命令参数
+	URL     string        `json:"url"`     // HTTP(S) 地址，以 POST 发送
+	Secret  Secret        `json:"secret"`  // HTTP 请求的签名密钥，为空时不签名
+	Timeout time.Duration `json:"timeout"` // 超时，为 0 时使用默认值
+}
+
+// ValidateHooks 校验事件钩子
+func (s HooksSettings) ValidateHooks() error {
+	if s.Timeout < 0 {
+		return fmt.Errorf("hook timeout must not be negative")
+	}
+	names := make(map[string]bool, len(s.Hooks))
+	for _, hook := range s.Hooks {
+		if hook.Name == "" {
+			return fmt.Errorf("hook name is required")
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("duplicate hook: %s", hook.Name)
+		}
+		names[hook.Name] = true
+
+		if len(hook.Events) == 0 {
+			return fmt.Errorf("hook %s: at least one event is required", hook.Name)
+		}
+		for _, event := range hook.Events {
+			if strings.TrimSpace(event) == "" {
+				return fmt.Errorf("hook %s: empty event name", hook.Name)
+			}
+		}
+		switch {
+		case hook.Command != "" && hook.URL != "":
+			return fmt.Errorf("hook %s: command and url are mutually exclusive", hook.Name)
+		case hook.Command != "":
+			if !filepath.IsAbs(hook.Command) {
+				return fmt.Errorf("hook %s: command must be an absolute path", hook.Name)
+			}
+		case hook.URL != "":
+			u, err := url.Parse(hook.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("hook %s: invalid url %q", hook.Name, hook.URL)
+			}
+		default:
+			return fmt.Errorf("hook %s: command or url is required", hook.Name)
+		}
+		if hook.Timeout < 0 {
+			return fmt.Errorf("hook %s: timeout must not be negative", hook.Name)
+		}
+	}
+	return nil
+}
+
+// HASettings represents warm standby settings
+type HASettings struct {
+	Enable        bool          `json:"enable" env:"HA_ENABLE"`                 // 多个面板实例共用数据库时选举主节点，备用实例只读
+	NodeID        string        `json:"node_id" env:"HA_NODE_ID"`               // 本实例 ID，为空时使用主机名
+	AdvertiseURL  string        `json:"advertise_url" env:"HA_ADVERTISE_URL"`   // 本实例的面板访问地址，备用实例拒绝写请求时返回给客户端
+	LeaseTTL      time.Duration `json:"lease_ttl" env:"HA_LEASE_TTL"`           // 主节点租约时长，超过该时间未续约由备用实例接管，默认 15 秒
+	RenewInterval time.Duration `json:"renew_interval" env:"HA_RENEW_INTERVAL"` // 续约和竞选间隔，默认为租约时长的三分之一
+	LeaseDB       string        `json:"lease_db" env:"HA_LEASE_DB"`             // 保存主节点租约的 SQLite 数据库路径，必须位于所有实例共享的存储上，启用主备模式时必填
+}
+
+// ValidateHA 检查主备模式配置，启用时必须指定所有实例共用的租约数据库
+func (s HASettings) ValidateHA() error {
+	if s.Enable && strings.TrimSpace(s.LeaseDB) == "" {
+		return fmt.Errorf("ha lease_db is required when ha is enabled")
+	}
+	if s.LeaseTTL < 0 || s.RenewInterval < 0 {
+		return fmt.Errorf("ha lease_ttl and renew_interval must not be negative")
+	}
+	return nil
+}
+
+// HeartbeatSettings represents external dead man's switch settings
+type HeartbeatSettings struct {
+	Enable       bool          `json:"enable" env:"HEARTBEAT_ENABLE"`                             // 任务成功后请求外部检查地址（如 healthchecks.io），长时间没有请求时由外部服务告警
+	URL          string        `json:"url" env:"HEARTBEAT_URL" secret:"true"`                     // 所有任务共用的检查地址，未单独设置的任务使用该地址
+	BackupURL    string        `json:"backup_url" env:"HEARTBEAT_BACKUP_URL" secret:"true"`       // 自动备份完成后请求的地址
+	StatsURL     string        `json:"stats_url" env:"HEARTBEAT_STATS_URL" secret:"true"`         // 流量统计保存后请求的地址
+	SchedulerURL string        `json:"scheduler_url" env:"HEARTBEAT_SCHEDULER_URL" secret:"true"` // 协议计划检查后请求的地址
+	MinInterval  time.Duration `json:"min_interval" env:"HEARTBEAT_MIN_INTERVAL"`                 // 同一地址两次成功请求的最小间隔，默认 1 分钟
+	ReportFail   bool          `json:"report_fail" env:"HEARTBEAT_REPORT_FAIL"`                   // 任务失败时请求地址的 /fail 路径立即告警
+}
+
+// DebugSettings represents panel self-profiling settings
+type DebugSettings struct {
+	Profiling bool `json:"profiling" env:"DEBUG_PROFILING"` // 开放 pprof、运行时指标和协程转储接口（仅管理员），排查性能问题时临时开启
+}
+
+// SSOSettings represents single sign-on settings
+type SSOSettings struct {
+	OIDCEnable        bool     `json:"oidc_enable" env:"SSO_OIDC_ENABLE"`
+	OIDCIssuer        string   `json:"oidc_issuer" env:"SSO_OIDC_ISSUER"`
+	OIDCClientID      string   `json:"oidc_client_id" env:"SSO_OIDC_CLIENT_ID"`
+	OIDCClientSecret  string   `json:"oidc_client_secret" env:"SSO_OIDC_CLIENT_SECRET" secret:"true"`
+	OIDCRedirectURL   string   `json:"oidc_redirect_url" env:"SSO_OIDC_REDIRECT_URL"`
+	OIDCScopes        []string `json:"oidc_scopes" env:"SSO_OIDC_SCOPES"`
+	OIDCUsernameClaim string   `json:"oidc_username_claim" env:"SSO_OIDC_USERNAME_CLAIM"`
+	OIDCGroupsClaim   string   `json:"oidc_groups_claim" env:"SSO_OIDC_GROUPS_CLAIM"`
+	LDAPEnable        bool     `json:"ldap_enable" env:"SSO_LDAP_ENABLE"`
+	LDAPAddress       string   `json:"ldap_address" env:"SSO_LDAP_ADDRESS"`
+	LDAPUseTLS        bool     `json:"ldap_use_tls" env:"SSO_LDAP_USE_TLS"`
+	LDAPBindDN        string   `json:"ldap_bind_dn" env:"SSO_LDAP_BIND_DN"`                     // 例如 uid=%s,ou=people,dc=example,dc=com
+	LDAPGroupBaseDN   string   `json:"ldap_group_base_dn" env:"SSO_LDAP_GROUP_BASE_DN"`         // 查询用户所属组的起点，为空时只读取用户条目的 memberOf
+	LDAPGroupMember   string   `json:"ldap_group_member_attr" env:"SSO_LDAP_GROUP_MEMBER_ATTR"` // 组条目中记录成员 DN 的属性，默认 member
+	AdminGroups       []string `json:"admin_groups" env:"SSO_ADMIN_GROUPS"`
+	UserGroups        []string `json:"user_groups" env:"SSO_USER_GROUPS"`
+	AutoProvision     bool     `json:"auto_provision" env:"SSO_AUTO_PROVISION"`
+	DisableLocalLogin bool     `json:"disable_local_login" env:"SSO_DISABLE_LOCAL_LOGIN"`
+}
+
+// ExportSettings represents traffic export settings
+type ExportSettings struct {
+	Enable        bool          `json:"enable" env:"EXPORT_ENABLE"`
+	Backend       string        `json:"backend" env:"EXPORT_BACKEND"` // clickhouse 或 influxdb
+	URL           string        `json:"url" env:"EXPORT_URL"`
+	Database      string        `json:"database" env:"EXPORT_DATABASE"`
+	Table         string        `json:"table" env:"EXPORT_TABLE"`
+	Org           string        `json:"org" env:"EXPORT_ORG"`
+	Username      string        `json:"username" env:"EXPORT_USERNAME"`
+	Password      string        `json:"password" env:"EXPORT_PASSWORD" secret:"true"`
+	Token         string        `json:"token" env:"EXPORT_TOKEN" secret:"true"`
+	BatchSize     int           `json:"batch_size" env:"EXPORT_BATCH_SIZE"`
+	FlushInterval time.Duration `json:"flush_interval" env:"EXPORT_FLUSH_INTERVAL"`
+	QueueSize     int           `json:"queue_size" env:"EXPORT_QUEUE_SIZE"`
+}
+
+// IngestSettings represents external traffic ingestion settings
+type IngestSettings struct {
+	Enable       bool              `json:"enable" env:"INGEST_ENABLE"`
+	Secret       string            `json:"secret" env:"INGEST_SECRET" secret:"true"`   // 上报请求的 HMAC-SHA256 签名密钥
+	MaxClockSkew time.Duration     `json:"max_clock_skew" env:"INGEST_MAX_CLOCK_SKEW"` // 允许的时间戳偏差，默认 5 分钟
+	NodeSecrets  map[string]string `json:"node_secrets" secret:"true"`                 // 引导节点时为每个节点生成的签名密钥，节点名称为键
+}
+
+// SubscriptionSettings represents subscription refresh settings
+type SubscriptionSettings struct {
+	UpdateInterval     int               `json:"update_interval" env:"SUBSCRIPTION_UPDATE_INTERVAL"`         // 建议客户端拉取间隔（小时），默认 12
+	WebhookEnable      bool              `json:"webhook_enable" env:"SUBSCRIPTION_WEBHOOK_ENABLE"`           // 配置变化时推送客户端注册的 webhook
+	WebhookTimeout     time.Duration     `json:"webhook_timeout" env:"SUBSCRIPTION_WEBHOOK_TIMEOUT"`         // 单个 webhook 请求超时，默认 10 秒
+	WebhookConcurrency int               `json:"webhook_concurrency" env:"SUBSCRIPTION_WEBHOOK_CONCURRENCY"` // 同时推送的 webhook 数，默认 8
+	HideUserInfo       bool              `json:"hide_user_info" env:"SUBSCRIPTION_HIDE_USER_INFO"`           // 不返回 subscription-userinfo 头
+	ProfileTitle       string            `json:"profile_title" env:"SUBSCRIPTION_PROFILE_TITLE"`             // 客户端显示的订阅名称
+	Headers            map[string]string `json:"headers"`                                                    // 额外的响应头，可覆盖默认值
+	CacheTTL           time.Duration     `json:"cache_ttl" env:"SUBSCRIPTION_CACHE_TTL"`                     // CDN 边缘缓存时长，0 表示不允许共享缓存
+	SigningKey         string            `json:"signing_key" env:"SUBSCRIPTION_SIGNING_KEY" secret:"true"`   // 签名订阅地址的 HMAC 密钥，为空时不生成签名地址
+	SignedURLTTL       time.Duration     `json:"signed_url_ttl" env:"SUBSCRIPTION_SIGNED_URL_TTL"`           // 签名地址的最长有效期，默认 7 天
+	RequireSignature   bool              `json:"require_signature" env:"SUBSCRIPTION_REQUIRE_SIGNATURE"`     // 拒绝未签名或签名已过期的订阅请求
+	CachePurgeURL      string            `json:"cache_purge_url" env:"SUBSCRIPTION_CACHE_PURGE_URL"`         // 订阅变化时 POST 缓存键的地址，用于清除 CDN 缓存
+}
+
+// CORSSettings represents cross-origin resource sharing settings
+type CORSSettings struct {
+	AllowedOrigins   []string      `json:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"` // 允许的来源，支持 https://*.example.com，为空允许所有
+	AllowedMethods   []string      `json:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `json:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	AllowCredentials bool          `json:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `json:"max_age" env:"CORS_MAX_AGE"` // 预检请求缓存时长
+}
+
+// ServerSettings represents HTTP server settings
+type ServerSettings struct {
+	Listen         string        `json:"listen" env:"SERVER_LISTEN"`                   // 面板监听地址，默认 :8080
+	LegacyListen   string        `json:"legacy_listen" env:"SERVER_LEGACY_LISTEN"`     // 兼容旧版 API 端口的第二个监听地址，如 0.0.0.0:9000，为空不启用
+	DatabasePath   string        `json:"database_path" env:"SERVER_DATABASE_PATH"`     // 数据库文件路径，默认 data/v.db
+	BasePath       string        `json:"base_path" env:"SERVER_BASE_PATH"`             // 面板访问路径，如 /k3x9q2m7，设置后其他路径一律返回 404，为空不启用
+	MaxBodySize    int64         `json:"max_body_size" env:"SERVER_MAX_BODY_SIZE"`     // 普通请求体上限（字节），默认 1MB
+	MaxUploadSize  int64         `json:"max_upload_size" env:"SERVER_MAX_UPLOAD_SIZE"` // 证书、配置备份等上传的请求体上限（字节），默认 64MB
+	RequestTimeout time.Duration `json:"request_timeout" env:"SERVER_REQUEST_TIMEOUT"` // 普通请求处理超时，超时返回 503，默认 30 秒
+	UploadTimeout  time.Duration `json:"upload_timeout" env:"SERVER_UPLOAD_TIMEOUT"`   // 上传和耗时操作的处理超时，默认 5 分钟
+}
+
+// basePathRe 面板访问路径允许的字符
+var basePathRe = regexp.MustCompile(`^(/[A-Za-z0-9_-]+)+$`)
+
+// NormalizeBasePath 规范化面板访问路径，补齐开头的斜杠并去掉末尾的斜杠，"/" 视为未设置
+func NormalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// ValidateBasePath 检查面板访问路径是否只包含字母、数字、下划线和连字符
+func (s ServerSettings) ValidateBasePath() error {
+	path := NormalizeBasePath(s.BasePath)
+	if path != "" && !basePathRe.MatchString(path) {
+		return fmt.Errorf("invalid base path %q: only letters, digits, '_' and '-' are allowed", s.BasePath)
+	}
+	return nil
+}
+
+// RandomBasePath 生成随机的面板访问路径
+func RandomBasePath() (string, error) {
+	// 32 个字符，按字节取模没有偏差
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate base path: %v", err)
+	}
+	for i, b := range buf {
+		buf[i] = alphabet[int(b)%len(alphabet)]
+	}
+	return "/" + string(buf), nil
 }
 
 // Settings represents system settings
 type Settings struct {
+	// Server settings
+	Server ServerSettings `json:"server"`
+
+	// CORS settings
+	CORS CORSSettings `json:"cors"`
+
+	// Ingest settings
+	Ingest IngestSettings `json:"ingest"`
+
+	// Subscription settings
+	Subscription SubscriptionSettings `json:"subscription"`
+
 	// Site settings
 	Site SiteSettings `json:"site"`
 
@@ -152,12 +797,45 @@ type Settings struct {
 	// Log settings
 	Log LogSettings `json:"log"`
 
+	// Crash report settings
+	Crash CrashSettings `json:"crash"`
+
 	// Admin settings
 	Admin AdminSettings `json:"admin"`
 
 	// Xray settings
 	Xray XraySettings `json:"xray"`
 
+	// Export settings
+	Export ExportSettings `json:"export"`
+
+	// SSO settings
+	SSO SSOSettings `json:"sso"`
+
+	// Node settings
+	Nodes NodeSettings `json:"nodes"`
+
+	// Warm standby settings
+	HA HASettings `json:"ha"`
+
+	// Split tunneling settings
+	Routing RoutingSettings `json:"routing"`
+
+	// Heartbeat settings
+	Heartbeat HeartbeatSettings `json:"heartbeat"`
+
+	// Debug settings
+	Debug DebugSettings `json:"debug"`
+
+	// Stale protocol cleanup settings
+	Cleanup CleanupSettings `json:"cleanup"`
+
+	// Event hook settings
+	Hooks HooksSettings `json:"hooks"`
+
+	// Client IP anonymization settings
+	Privacy PrivacySettings `json:"privacy"`
+
 	// Protocol settings
 	Protocols map[string]bool `json:"protocols"`
 
@@ -165,21 +843,101 @@ type Settings struct {
 	Transports map[string]bool `json:"transports"`
 }
 
-// Manager represents a settings manager
+// Clone 返回设置的深拷贝，修改后可传给 Manager.Update
+func (s *Settings) Clone() *Settings {
+	c := *s
+	cloneValue(reflect.ValueOf(&c).Elem())
+	return &c
+}
+
+// cloneValue 递归复制切片、map 和指针，避免与原设置共享底层数据，
+// 包括钩子的事件列表、分流方案的规则等嵌套在元素中的切片。未导出字段（如 time.Time 内部）保持共享
+func cloneValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Field(i); field.CanSet() {
+				cloneValue(field)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			cloneValue(v.Index(i))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		for i := 0; i < c.Len(); i++ {
+			cloneValue(c.Index(i))
+		}
+		v.Set(c)
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), cloned(iter.Value()))
+		}
+		v.Set(c)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(cloned(v.Elem()))
+		v.Set(c)
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		v.Set(cloned(v.Elem()))
+	}
+}
+
+// cloned 返回值的深拷贝，用于 map 元素等不可直接修改的值
+func cloned(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	cloneValue(c)
+	return c
+}
+
+// Manager represents a settings manager.
+// 当前设置以不可变快照的形式保存，读取无锁；写操作在副本上修改，持久化成功后才替换快照。
 type Manager struct {
 	log          *logger.Logger
-	settings     *Settings
+	current      atomic.Pointer[Settings]
 	settingsPath string
-	mu           sync.RWMutex
+	mu           sync.Mutex // 串行化写操作
+	listeners    []ChangeListener
 }
 
+// ChangeListener 设置保存后的回调，actor 为修改人，内部修改时为空
+type ChangeListener func(prev, next *Settings, actor string)
+
 // New creates a new settings manager
 func New(log *logger.Logger) *Manager {
-	return &Manager{
+	return NewWithPath(log, filepath.Join("config", "settings.json"))
+}
+
+// NewWithPath 创建使用指定设置文件的管理器，密钥文件保存在同一目录下
+func NewWithPath(log *logger.Logger, path string) *Manager {
+	m := &Manager{
 		log:          log,
-		settings:     &Settings{},
-		settingsPath: filepath.Join("config", "settings.json"),
+		settingsPath: path,
 	}
+	m.current.Store(&Settings{})
+	return m
+}
+
+// Path 返回设置文件路径
+func (m *Manager) Path() string {
+	return m.settingsPath
 }
 
 // Start starts the settings manager
@@ -194,6 +952,11 @@ func (m *Manager) Start() error {
 		return fmt.Errorf("failed to load settings: %v", err)
 	}
 
+	// 首次启动没有 JWT 密钥时生成并保存，空密钥签名的令牌任何人都能伪造
+	if err := m.ensureJWTSecret(); err != nil {
+		return err
+	}
+
 	m.log.Info("Settings manager started", logger.Fields{
 		"settings_path": m.settingsPath,
 	})
@@ -201,6 +964,30 @@ func (m *Manager) Start() error {
 	return nil
 }
 
+// ensureJWTSecret 在未配置 JWT 密钥时生成随机密钥并写入设置文件
+func (m *Manager) ensureJWTSecret() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.current.Load()
+	if current.Security.JWTSecret != "" {
+		return nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate jwt secret: %v", err)
+	}
+	next := current.Clone()
+	next.Security.JWTSecret = base64.RawURLEncoding.EncodeToString(key)
+	if err := m.commit(next); err != nil {
+		return fmt.Errorf("failed to save generated jwt secret: %v", err)
+	}
+	m.log.Info("Generated JWT secret", logger.Fields{
+		"settings_path": m.settingsPath,
+	})
+	return nil
+}
+
 // Stop stops the settings manager
 func (m *Manager) Stop() {
 	// Save settings
@@ -213,69 +1000,83 @@ func (m *Manager) Stop() {
 
 // Load loads settings from file and environment variables
 func (m *Manager) Load() error {
+	next := &Settings{}
+
+	// 加载凭据加密密钥，需在读取设置文件之前
+	if err := loadSecretKey(filepath.Dir(m.settingsPath)); err != nil {
+		return fmt.Errorf("failed to load secret key: %v", err)
+	}
+
 	// Load from file
-	if err := m.loadFromFile(); err != nil {
+	if err := m.loadFromFile(next); err != nil {
 		m.log.Warn("Failed to load settings from file", logger.Fields{
 			"error": err,
 		})
 	}
 
 	// Load from environment variables
-	if err := m.loadFromEnv(); err != nil {
+	if err := m.loadFromEnv(next); err != nil {
 		return fmt.Errorf("failed to load settings from environment: %v", err)
 	}
 
 	// 确保协议和传输层设置存在，不为nil
-	if m.settings.Protocols == nil {
-		m.settings.Protocols = make(map[string]bool)
+	if next.Protocols == nil {
+		next.Protocols = make(map[string]bool)
 	}
-	if m.settings.Transports == nil {
-		m.settings.Transports = make(map[string]bool)
+	if next.Transports == nil {
+		next.Transports = make(map[string]bool)
 	}
 
 	// 设置默认值
 	// 默认协议
-	if _, exists := m.settings.Protocols["trojan"]; !exists {
-		m.settings.Protocols["trojan"] = true
+	if _, exists := next.Protocols["trojan"]; !exists {
+		next.Protocols["trojan"] = true
+	}
+	if _, exists := next.Protocols["vmess"]; !exists {
+		next.Protocols["vmess"] = true
 	}
-	if _, exists := m.settings.Protocols["vmess"]; !exists {
-		m.settings.Protocols["vmess"] = true
+	if _, exists := next.Protocols["vless"]; !exists {
+		next.Protocols["vless"] = true
 	}
-	if _, exists := m.settings.Protocols["vless"]; !exists {
-		m.settings.Protocols["vless"] = true
+	if _, exists := next.Protocols["shadowsocks"]; !exists {
+		next.Protocols["shadowsocks"] = true
 	}
-	if _, exists := m.settings.Protocols["shadowsocks"]; !exists {
-		m.settings.Protocols["shadowsocks"] = true
+	if _, exists := next.Protocols["socks"]; !exists {
+		next.Protocols["socks"] = false
 	}
-	if _, exists := m.settings.Protocols["socks"]; !exists {
-		m.settings.Protocols["socks"] = false
+	if _, exists := next.Protocols["http"]; !exists {
+		next.Protocols["http"] = false
 	}
-	if _, exists := m.settings.Protocols["http"]; !exists {
-		m.settings.Protocols["http"] = false
+	if _, exists := next.Protocols["relay"]; !exists {
+		next.Protocols["relay"] = false
 	}
 
 	// 默认传输层
-	if _, exists := m.settings.Transports["tcp"]; !exists {
-		m.settings.Transports["tcp"] = true
+	if _, exists := next.Transports["tcp"]; !exists {
+		next.Transports["tcp"] = true
 	}
-	if _, exists := m.settings.Transports["ws"]; !exists {
-		m.settings.Transports["ws"] = true
+	if _, exists := next.Transports["ws"]; !exists {
+		next.Transports["ws"] = true
 	}
-	if _, exists := m.settings.Transports["http2"]; !exists {
-		m.settings.Transports["http2"] = true
+	if _, exists := next.Transports["http2"]; !exists {
+		next.Transports["http2"] = true
 	}
-	if _, exists := m.settings.Transports["grpc"]; !exists {
-		m.settings.Transports["grpc"] = true
+	if _, exists := next.Transports["grpc"]; !exists {
+		next.Transports["grpc"] = true
 	}
-	if _, exists := m.settings.Transports["quic"]; !exists {
-		m.settings.Transports["quic"] = false
+	if _, exists := next.Transports["quic"]; !exists {
+		next.Transports["quic"] = false
 	}
 
+	m.mu.Lock()
+	m.current.Store(next)
+	m.mu.Unlock()
+
 	return nil
 }
 
 // loadFromFile loads settings from file
-func (m *Manager) loadFromFile() error {
+func (m *Manager) loadFromFile(target *Settings) error {
 	// Check if file exists
 	if _, err := os.Stat(m.settingsPath); os.IsNotExist(err) {
 		m.log.Warn("Settings file does not exist, using defaults", logger.Fields{
@@ -296,23 +1097,23 @@ func (m *Manager) loadFromFile() error {
 	})
 
 	// Unmarshal settings
-	if err := json.Unmarshal(data, m.settings); err != nil {
+	if err := json.Unmarshal(data, target); err != nil {
 		return fmt.Errorf("failed to unmarshal settings: %v", err)
 	}
 
 	// 记录关键设置
 	m.log.Info("Settings loaded from file", logger.Fields{
-		"auto_update": m.settings.Xray.AutoUpdate,
-		"protocols":   m.settings.Protocols != nil,
-		"transports":  m.settings.Transports != nil,
+		"auto_update": target.Xray.AutoUpdate,
+		"protocols":   target.Protocols != nil,
+		"transports":  target.Transports != nil,
 	})
 
 	return nil
 }
 
 // loadFromEnv loads settings from environment variables
-func (m *Manager) loadFromEnv() error {
-	val := reflect.ValueOf(m.settings).Elem()
+func (m *Manager) loadFromEnv(target *Settings) error {
+	val := reflect.ValueOf(target).Elem()
 	typ := val.Type()
 
 	for i := 0; i < val.NumField(); i++ {
@@ -358,8 +1159,17 @@ func (m *Manager) loadFromEnv() error {
 					structField.SetBool(boolValue)
 				}
 			case reflect.Slice:
-				if structType.Type.Elem().Kind() == reflect.String {
+				switch structType.Type.Elem().Kind() {
+				case reflect.String:
 					structField.Set(reflect.ValueOf(strings.Split(envValue, ",")))
+				case reflect.Int:
+					var values []int
+					for _, part := range strings.Split(envValue, ",") {
+						if intValue, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+							values = append(values, intValue)
+						}
+					}
+					structField.Set(reflect.ValueOf(values))
 				}
 			case reflect.Struct:
 				if structType.Type == reflect.TypeOf(time.Duration(0)) {
@@ -376,123 +1186,302 @@ func (m *Manager) loadFromEnv() error {
 
 // Save saves settings to file
 func (m *Manager) Save() error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.current.Load()
 
 	// 记录保存前的设置
 	m.log.Debug("Saving settings", logger.Fields{
-		"auto_update":   m.settings.Xray.AutoUpdate,
+		"auto_update":   current.Xray.AutoUpdate,
 		"settings_path": m.settingsPath,
 	})
 
-	return m.saveNoLock()
+	return m.persist(current)
 }
 
-// Get returns the current settings
+// Get returns the current settings snapshot.
+// 返回的快照由所有调用方共享，不能修改；需要修改时使用 Clone。
 func (m *Manager) Get() *Settings {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	return m.current.Load()
+}
 
-	// Create a copy of settings
-	settings := *m.settings
-	return &settings
+// Clone returns a mutable copy of the current settings
+func (m *Manager) Clone() *Settings {
+	return m.current.Load().Clone()
+}
+
+// Location returns the panel timezone used for reports, schedules and notifications
+func (m *Manager) Location() *time.Location {
+	return m.Get().Site.Location()
+}
+
+// FormatTime formats t in the panel timezone
+func (m *Manager) FormatTime(t time.Time) string {
+	return t.In(m.Location()).Format("2006-01-02 15:04:05")
+}
+
+// OnChange 注册设置变更回调。回调在持有写锁时同步调用，应尽快返回且不能再修改设置
+func (m *Manager) OnChange(fn ChangeListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Replace validates and saves a complete settings copy obtained from Clone
+func (m *Manager) Replace(settings *Settings) error {
+	return m.ReplaceAs(settings, "")
+}
+
+// Validate 执行保存前的全部校验，不修改设置
+func (s *Settings) Validate() error {
+	if err := s.Xray.ValidateStrategies(); err != nil {
+		return err
+	}
+	if err := s.Xray.ValidateSendThrough(); err != nil {
+		return err
+	}
+	if err := s.Xray.ValidateResourceLimits(); err != nil {
+		return err
+	}
+	if err := s.Site.ValidateTimezone(); err != nil {
+		return err
+	}
+	if err := s.Server.ValidateBasePath(); err != nil {
+		return err
+	}
+	if err := s.Backup.ValidateTargets(); err != nil {
+		return err
+	}
+	if err := s.Routing.ValidateProfiles(); err != nil {
+		return err
+	}
+	if err := s.Hooks.ValidateHooks(); err != nil {
+		return err
+	}
+	if err := s.Traffic.ValidateSampling(); err != nil {
+		return err
+	}
+	if err := s.Log.ValidateShipping(); err != nil {
+		return err
+	}
+	if err := s.Notification.ValidateVerification(); err != nil {
+		return err
+	}
+	if err := s.HA.ValidateHA(); err != nil {
+		return err
+	}
+	return s.Privacy.ValidatePrivacy()
+}
+
+// ReplaceAs 与 Replace 相同，并记录修改人
+func (m *Manager) ReplaceAs(settings *Settings, actor string) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	settings.Server.BasePath = NormalizeBasePath(settings.Server.BasePath)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.commitAs(settings, actor); err != nil {
+		return fmt.Errorf("failed to save settings: %v", err)
+	}
+	return nil
 }
 
 // Update updates settings
 func (m *Manager) Update(settings *Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// 记录更新前的重要设置
-	oldAutoUpdate := m.settings.Xray.AutoUpdate
+	current := m.current.Load()
+	next := current.Clone()
 
 	// 记录完整的更新内容
 	m.log.Debug("Updating settings", logger.Fields{
-		"old_auto_update": m.settings.Xray.AutoUpdate,
+		"old_auto_update": current.Xray.AutoUpdate,
 		"new_auto_update": settings.Xray.AutoUpdate,
 		"xray_settings":   settings.Xray,
 	})
 
 	// 手动更新Xray设置
-	m.settings.Xray.AutoUpdate = settings.Xray.AutoUpdate
-	m.settings.Xray.CheckInterval = settings.Xray.CheckInterval
-	m.settings.Xray.CustomConfig = settings.Xray.CustomConfig
-	m.settings.Xray.ConfigPath = settings.Xray.ConfigPath
-	m.settings.Xray.Version = settings.Xray.Version
+	next.Xray.AutoUpdate = settings.Xray.AutoUpdate
+	next.Xray.CheckInterval = settings.Xray.CheckInterval
+	next.Xray.CustomConfig = settings.Xray.CustomConfig
+	next.Xray.ConfigPath = settings.Xray.ConfigPath
+	next.Xray.Version = settings.Xray.Version
+	next.Xray.DomainStrategy = settings.Xray.DomainStrategy
+	next.Xray.OutboundDomainStrategy = settings.Xray.OutboundDomainStrategy
+	next.Xray.RoutingDomainStrategy = settings.Xray.RoutingDomainStrategy
+	next.Xray.DNSDisableCache = settings.Xray.DNSDisableCache
+	next.Xray.SendThrough = settings.Xray.SendThrough
+	next.Xray.OutboundSendThrough = settings.Xray.OutboundSendThrough
+	next.Xray.GroupSendThrough = settings.Xray.GroupSendThrough
+	next.Xray.ApplyDelay = settings.Xray.ApplyDelay
+	next.Xray.LogStoreLevel = settings.Xray.LogStoreLevel
+	next.Xray.InboundMaxConnections = settings.Xray.InboundMaxConnections
+	// 资源限制在下次启动 xray 时生效
+	next.Xray.CPULimit = settings.Xray.CPULimit
+	next.Xray.MemoryLimitMB = settings.Xray.MemoryLimitMB
+	next.Xray.Nice = settings.Xray.Nice
+	next.Xray.IOClass = settings.Xray.IOClass
+	next.Xray.IOPriority = settings.Xray.IOPriority
+
+	// 更新流量导出设置
+	next.Export = settings.Export
+
+	// 更新单点登录设置
+	next.SSO = settings.SSO
+
+	// 更新服务器设置，重启后生效
+	next.Server = settings.Server
+	next.Server.BasePath = NormalizeBasePath(settings.Server.BasePath)
+
+	// 更新跨域设置
+	next.CORS = settings.CORS
+
+	// 更新外部流量上报设置
+	next.Ingest = settings.Ingest
+
+	// 更新订阅刷新设置
+	next.Subscription = settings.Subscription
+
+	// 更新崩溃报告设置
+	next.Crash = settings.Crash
+
+	// 更新多节点延迟探测设置
+	next.Nodes = settings.Nodes
+
+	// 更新主备模式设置，重启后生效
+	next.HA = settings.HA
+
+	// 更新分流方案
+	next.Routing = settings.Routing
+
+	// 更新外部心跳设置
+	next.Heartbeat = settings.Heartbeat
+
+	// 更新性能诊断设置
+	next.Debug = settings.Debug
+
+	// 更新闲置入站清理设置
+	next.Cleanup = settings.Cleanup
+
+	// 更新事件钩子
+	next.Hooks = settings.Hooks
+
+	// 更新客户端 IP 匿名化设置
+	next.Privacy = settings.Privacy
 
 	// 手动更新协议和传输层设置
 	if settings.Protocols != nil {
-		// 如果m.settings.Protocols为nil，先初始化
-		if m.settings.Protocols == nil {
-			m.settings.Protocols = make(map[string]bool)
+		// 如果next.Protocols为nil，先初始化
+		if next.Protocols == nil {
+			next.Protocols = make(map[string]bool)
 		}
 
 		// 复制新的协议设置
 		for k, v := range settings.Protocols {
-			m.settings.Protocols[k] = v
+			next.Protocols[k] = v
 		}
 	}
 
 	if settings.Transports != nil {
-		// 如果m.settings.Transports为nil，先初始化
-		if m.settings.Transports == nil {
-			m.settings.Transports = make(map[string]bool)
+		// 如果next.Transports为nil，先初始化
+		if next.Transports == nil {
+			next.Transports = make(map[string]bool)
 		}
 
 		// 复制新的传输层设置
 		for k, v := range settings.Transports {
-			m.settings.Transports[k] = v
+			next.Transports[k] = v
 		}
 	}
 
+	if err := m.commit(next); err != nil {
+		return fmt.Errorf("failed to save settings: %v", err)
+	}
+
 	// 记录变更
-	if oldAutoUpdate != m.settings.Xray.AutoUpdate {
+	if current.Xray.AutoUpdate != next.Xray.AutoUpdate {
 		m.log.Info("Xray auto update setting changed", logger.Fields{
-			"old_value": oldAutoUpdate,
-			"new_value": m.settings.Xray.AutoUpdate,
+			"old_value": current.Xray.AutoUpdate,
+			"new_value": next.Xray.AutoUpdate,
 		})
 	}
 
-	// 在解锁前保存设置
-	if err := m.saveNoLock(); err != nil {
-		return fmt.Errorf("failed to save settings: %v", err)
+	return nil
+}
+
+// commit persists next and swaps it in as the current snapshot only if the
+// write succeeded, the caller must hold m.mu
+func (m *Manager) commit(next *Settings) error {
+	return m.commitAs(next, "")
+}
+
+// commitAs 与 commit 相同，保存成功后通知变更回调
+func (m *Manager) commitAs(next *Settings, actor string) error {
+	if err := m.persist(next); err != nil {
+		return err
+	}
+	prev := m.current.Swap(next)
+	for _, fn := range m.listeners {
+		fn(prev, next, actor)
 	}
+	return nil
+}
 
-	// 验证保存后的设置
-	fileData, err := os.ReadFile(m.settingsPath)
-	if err == nil {
-		var savedSettings Settings
-		if err := json.Unmarshal(fileData, &savedSettings); err == nil {
-			m.log.Debug("Verified saved settings", logger.Fields{
-				"auto_update_in_file": savedSettings.Xray.AutoUpdate,
-			})
+// ChangedSections 返回两份设置之间内容不同的顶层分区，使用 JSON 名称
+func ChangedSections(prev, next *Settings) []string {
+	if prev == nil || next == nil {
+		return nil
+	}
+	var sections []string
+	a, b := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		// 不比较 JSON，加密字段每次序列化的结果都不同
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			sections = append(sections, name)
 		}
 	}
-
-	return nil
+	return sections
 }
 
-// saveNoLock saves settings without acquiring the lock
-func (m *Manager) saveNoLock() error {
-	// 在保存前检查protocols和transports是否有效
-	if m.settings.Protocols == nil {
-		m.settings.Protocols = make(map[string]bool)
+// persist writes settings to file, the caller must hold m.mu
+func (m *Manager) persist(settings *Settings) error {
+	// 快照不能修改，空的协议和传输层设置在副本上补齐
+	out := *settings
+	if out.Protocols == nil {
+		out.Protocols = make(map[string]bool)
 	}
-	if m.settings.Transports == nil {
-		m.settings.Transports = make(map[string]bool)
+	if out.Transports == nil {
+		out.Transports = make(map[string]bool)
 	}
 
 	// 添加日志记录关键设置
 	m.log.Debug("Settings before saving", logger.Fields{
-		"auto_update":      m.settings.Xray.AutoUpdate,
-		"check_interval":   m.settings.Xray.CheckInterval,
-		"custom_config":    m.settings.Xray.CustomConfig,
-		"protocols_count":  len(m.settings.Protocols),
-		"transports_count": len(m.settings.Transports),
+		"auto_update":      out.Xray.AutoUpdate,
+		"check_interval":   out.Xray.CheckInterval,
+		"custom_config":    out.Xray.CustomConfig,
+		"protocols_count":  len(out.Protocols),
+		"transports_count": len(out.Transports),
 	})
 
 	// Marshal settings
-	data, err := json.MarshalIndent(m.settings, "", "  ")
+	data, err := json.MarshalIndent(&out, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal settings: %v", err)
 	}
@@ -516,7 +1505,7 @@ func (m *Manager) saveNoLock() error {
 
 	m.log.Info("Settings saved successfully", logger.Fields{
 		"settings_path": m.settingsPath,
-		"auto_update":   m.settings.Xray.AutoUpdate,
+		"auto_update":   out.Xray.AutoUpdate,
 		"size":          len(data),
 	})
 
@@ -525,10 +1514,7 @@ func (m *Manager) saveNoLock() error {
 
 // GetString returns a string setting value
 func (m *Manager) GetString(path string) (string, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	val := reflect.ValueOf(m.settings).Elem()
+	val := reflect.ValueOf(m.current.Load()).Elem()
 	parts := strings.Split(path, ".")
 
 	for _, part := range parts {
@@ -554,7 +1540,8 @@ func (m *Manager) SetString(path, value string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	val := reflect.ValueOf(m.settings).Elem()
+	next := m.current.Load().Clone()
+	val := reflect.ValueOf(next).Elem()
 	parts := strings.Split(path, ".")
 
 	for _, part := range parts {
@@ -567,7 +1554,7 @@ func (m *Manager) SetString(path, value string) error {
 			val = field
 		} else if field.Kind() == reflect.String {
 			field.SetString(value)
-			return m.Save()
+			return m.commit(next)
 		} else {
 			return fmt.Errorf("invalid setting type: %s", path)
 		}
@@ -578,10 +1565,7 @@ func (m *Manager) SetString(path, value string) error {
 
 // GetInt returns an integer setting value
 func (m *Manager) GetInt(path string) (int, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	val := reflect.ValueOf(m.settings).Elem()
+	val := reflect.ValueOf(m.current.Load()).Elem()
 	parts := strings.Split(path, ".")
 
 	for _, part := range parts {
@@ -607,7 +1591,8 @@ func (m *Manager) SetInt(path string, value int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	val := reflect.ValueOf(m.settings).Elem()
+	next := m.current.Load().Clone()
+	val := reflect.ValueOf(next).Elem()
 	parts := strings.Split(path, ".")
 
 	for _, part := range parts {
@@ -620,7 +1605,7 @@ func (m *Manager) SetInt(path string, value int) error {
 			val = field
 		} else if field.Kind() == reflect.Int || field.Kind() == reflect.Int64 {
 			field.SetInt(int64(value))
-			return m.Save()
+			return m.commit(next)
 		} else {
 			return fmt.Errorf("invalid setting type: %s", path)
 		}
@@ -631,10 +1616,7 @@ func (m *Manager) SetInt(path string, value int) error {
 
 // GetBool returns a boolean setting value
 func (m *Manager) GetBool(path string) (bool, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	val := reflect.ValueOf(m.settings).Elem()
+	val := reflect.ValueOf(m.current.Load()).Elem()
 	parts := strings.Split(path, ".")
 
 	for _, part := range parts {
@@ -660,7 +1642,8 @@ func (m *Manager) SetBool(path string, value bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	val := reflect.ValueOf(m.settings).Elem()
+	next := m.current.Load().Clone()
+	val := reflect.ValueOf(next).Elem()
 	parts := strings.Split(path, ".")
 
 	for _, part := range parts {
@@ -673,7 +1656,7 @@ func (m *Manager) SetBool(path string, value bool) error {
 			val = field
 		} else if field.Kind() == reflect.Bool {
 			field.SetBool(value)
-			return m.Save()
+			return m.commit(next)
 		} else {
 			return fmt.Errorf("invalid setting type: %s", path)
 		}
@@ -684,9 +1667,6 @@ func (m *Manager) SetBool(path string, value bool) error {
 
 // Backup 备份设置到文件
 func (m *Manager) Backup() (string, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
 	// 创建备份目录
 	backupDir := filepath.Join("backups", "settings")
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
@@ -698,7 +1678,7 @@ func (m *Manager) Backup() (string, error) {
 	backupPath := filepath.Join(backupDir, fmt.Sprintf("settings_%s.json", timestamp))
 
 	// 序列化设置
-	data, err := json.MarshalIndent(m.settings, "", "  ")
+	data, err := json.MarshalIndent(m.current.Load(), "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal settings: %v", err)
 	}
@@ -733,11 +1713,8 @@ func (m *Manager) Restore(backupPath string) error {
 		return fmt.Errorf("failed to unmarshal settings: %v", err)
 	}
 
-	// 更新当前设置
-	m.settings = &settings
-
-	// 保存设置
-	if err := m.Save(); err != nil {
+	// 保存成功后替换当前设置
+	if err := m.commit(&settings); err != nil {
 		return fmt.Errorf("failed to save settings: %v", err)
 	}
 
@@ -0,0 +1,234 @@
+package settings
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"v/logger"
+)
+
+func newTestManager(t testing.TB) *Manager {
+	m := New(logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR}))
+	m.settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return m
+}
+
+func TestManager_UpdateSwapsSnapshot(t *testing.T) {
+	m := newTestManager(t)
+	before := m.Get()
+
+	next := m.Clone()
+	next.Xray.AutoUpdate = !before.Xray.AutoUpdate
+	next.Protocols["vmess"] = false
+	if err := m.Update(next); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	after := m.Get()
+	if after == before {
+		t.Fatal("expected a new snapshot after update")
+	}
+	if after.Xray.AutoUpdate == before.Xray.AutoUpdate {
+		t.Error("update not applied")
+	}
+	// 旧快照不受影响
+	if !before.Protocols["vmess"] {
+		t.Error("previous snapshot was modified")
+	}
+	if after.Protocols["vmess"] {
+		t.Error("protocol update not applied")
+	}
+}
+
+func TestManager_UpdateKeepsSnapshotOnSaveFailure(t *testing.T) {
+	m := newTestManager(t)
+	before := m.Get()
+
+	// 父目录不存在，写入失败
+	m.settingsPath = filepath.Join(t.TempDir(), "missing", "settings.json")
+
+	next := m.Clone()
+	next.Xray.AutoUpdate = !before.Xray.AutoUpdate
+	if err := m.Update(next); err == nil {
+		t.Fatal("expected update to fail")
+	}
+	if m.Get() != before {
+		t.Error("snapshot swapped despite failed save")
+	}
+}
+
+func TestSettings_CloneIsDeep(t *testing.T) {
+	s := &Settings{
+		Protocols: map[string]bool{"vmess": true},
+		CORS:      CORSSettings{AllowedOrigins: []string{"https://a.example.com"}},
+		Xray:      XraySettings{OutboundDomainStrategy: map[string]string{"direct": "UseIPv4"}},
+	}
+
+	c := s.Clone()
+	c.Protocols["vmess"] = false
+	c.CORS.AllowedOrigins[0] = "https://b.example.com"
+	c.Xray.OutboundDomainStrategy["direct"] = "AsIs"
+
+	if !s.Protocols["vmess"] || s.CORS.AllowedOrigins[0] != "https://a.example.com" ||
+		s.Xray.OutboundDomainStrategy["direct"] != "UseIPv4" {
+		t.Error("clone shares data with original")
+	}
+}
+
+func TestSettings_CloneNestedSlices(t *testing.T) {
+	s := &Settings{
+		Hooks: HooksSettings{Hooks: []Hook{{Name: "notify", Events: []string{"user.created"}, Args: []string{"--quiet"}}}},
+		Routing: RoutingSettings{
+			Profiles:     []RoutingProfile{{Name: "cn", DirectDomains: []string{"geosite:cn"}, BlockIPs: []string{"10.0.0.0/8"}}},
+			UserProfiles: map[int64]string{1: "cn"},
+		},
+		Ingest: IngestSettings{NodeSecrets: map[string]string{"edge-1": "secret"}},
+	}
+	before, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改副本中所有嵌套的数据，原设置序列化后应保持不变
+	c := s.Clone()
+	c.Hooks.Hooks[0].Events[0] = "user.deleted"
+	c.Hooks.Hooks[0].Args = append(c.Hooks.Hooks[0].Args[:0], "--verbose")
+	c.Routing.Profiles[0].DirectDomains[0] = "geosite:us"
+	c.Routing.Profiles[0].BlockIPs[0] = "192.168.0.0/16"
+	c.Routing.UserProfiles[1] = "us"
+	c.Ingest.NodeSecrets["edge-1"] = "changed"
+
+	after, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("clone shares nested data with original:\nbefore %s\nafter  %s", before, after)
+	}
+
+	// 未修改的副本与原设置序列化结果一致
+	if same, _ := json.Marshal(s.Clone()); string(same) != string(before) {
+		t.Errorf("clone differs from original:\nclone    %s\noriginal %s", same, before)
+	}
+}
+
+func BenchmarkManager_Get(b *testing.B) {
+	m := newTestManager(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = m.Get().Xray.AutoUpdate
+	}
+}
+
+func BenchmarkManager_GetParallel(b *testing.B) {
+	m := newTestManager(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = m.Get().Xray.AutoUpdate
+		}
+	})
+}
+
+func BenchmarkManager_GetParallelWithUpdates(b *testing.B) {
+	m := newTestManager(b)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				next := m.Clone()
+				next.Xray.AutoUpdate = !next.Xray.AutoUpdate
+				m.Update(next)
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = m.Get().Xray.AutoUpdate
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
+
+func TestManager_StartGeneratesJWTSecret(t *testing.T) {
+	t.Setenv("SECURITY_JWT_SECRET", "")
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	path := filepath.Join(t.TempDir(), "config", "settings.json")
+
+	m := New(log)
+	m.settingsPath = path
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	secret := m.Get().Security.JWTSecret
+	if len(secret) < 32 {
+		t.Fatalf("generated jwt secret %q is too short", secret)
+	}
+
+	// 再次启动读取已保存的密钥，不重新生成
+	again := New(log)
+	again.settingsPath = path
+	if err := again.Start(); err != nil {
+		t.Fatalf("second Start failed: %v", err)
+	}
+	if got := again.Get().Security.JWTSecret; got != secret {
+		t.Errorf("jwt secret changed across restarts: %q -> %q", secret, got)
+	}
+}
+
+func TestManager_UpdateXrayResourceLimits(t *testing.T) {
+	valid := XraySettings{CPULimit: 0.5, MemoryLimitMB: 256, Nice: 10, IOClass: "idle", IOPriority: 4}
+
+	tests := []struct {
+		name    string
+		limits  XraySettings
+		wantErr bool
+	}{
+		{name: "limits are saved", limits: valid},
+		{name: "negative cpu", limits: XraySettings{CPULimit: -1}, wantErr: true},
+		{name: "nice out of range", limits: XraySettings{Nice: 20}, wantErr: true},
+		{name: "unknown io class", limits: XraySettings{IOClass: "realtime"}, wantErr: true},
+		{name: "io priority out of range", limits: XraySettings{IOClass: "best-effort", IOPriority: 8}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			next := m.Clone()
+			next.Xray.CPULimit = tt.limits.CPULimit
+			next.Xray.MemoryLimitMB = tt.limits.MemoryLimitMB
+			next.Xray.Nice = tt.limits.Nice
+			next.Xray.IOClass = tt.limits.IOClass
+			next.Xray.IOPriority = tt.limits.IOPriority
+
+			err := m.Update(next)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Update error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := m.Get().Xray
+			if got.CPULimit != valid.CPULimit || got.MemoryLimitMB != valid.MemoryLimitMB || got.Nice != valid.Nice ||
+				got.IOClass != valid.IOClass || got.IOPriority != valid.IOPriority {
+				t.Errorf("saved limits = cpu %v, memory %d, nice %d, io %s/%d; want %+v",
+					got.CPULimit, got.MemoryLimitMB, got.Nice, got.IOClass, got.IOPriority, valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportVersion 分区导出文件的格式版本
+const ExportVersion = 1
+
+// secretType 加密保存的凭据类型，导出时总是排除
+var secretType = reflect.TypeOf(Secret(""))
+
+// jsonMarshalerType 自行序列化的类型（如 time.Time），比较和导出时整体处理
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// Export 部分设置分区的导出结果，不包含凭据，可导入到其他实例
+type Export struct {
+	Version    int                    `json:"version"`
+	ExportedAt time.Time              `json:"exported_at"`
+	Sections   map[string]interface{} `json:"sections"`
+	Omitted    []string               `json:"omitted,omitempty"` // 未导出的凭据字段路径
+}
+
+// FieldChange 导入设置时一个字段的变化，凭据字段不显示值
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// SectionNames 返回所有设置分区的 JSON 名称，按字母排序
+func SectionNames() []string {
+	t := reflect.TypeOf(Settings{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := fieldName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sectionField 按 JSON 名称查找设置分区
+func sectionField(s *Settings, name string) (reflect.Value, bool) {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if fieldName(v.Type().Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// ValidateSections 检查分区名称是否存在，sections 不能为空
+func ValidateSections(sections []string) error {
+	if len(sections) == 0 {
+		return fmt.Errorf("no settings sections specified")
+	}
+	var s Settings
+	for _, name := range sections {
+		if _, ok := sectionField(&s, name); !ok {
+			return fmt.Errorf("unknown settings section %q", name)
+		}
+	}
+	return nil
+}
+
+// ExportSections 导出指定分区。Secret 类型和带 secret:"true" 标签的凭据字段不导出，其路径记录在 Omitted 中
+func ExportSections(s *Settings, sections []string) (*Export, error) {
+	if err := ValidateSections(sections); err != nil {
+		return nil, err
+	}
+	export := &Export{
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Sections:   make(map[string]interface{}, len(sections)),
+	}
+	for _, name := range sections {
+		field, _ := sectionField(s, name)
+		export.Sections[name] = stripSecrets(field, name, &export.Omitted)
+	}
+	return export, nil
+}
+
+// KeepSecrets 导入后 next 中为空的凭据字段沿用 prev 中的值，导入的分区不会清空本机的凭据。
+// 列表中的元素按 Name 字段匹配，没有 Name 字段时按位置匹配
+func KeepSecrets(prev, next *Settings, sections []string) {
+	for _, name := range sections {
+		dst, ok := sectionField(next, name)
+		if !ok {
+			continue
+		}
+		src, _ := sectionField(prev, name)
+		keepSecrets(src, dst)
+	}
+}
+
+// DiffSections 返回指定分区中内容不同的字段，凭据字段只显示是否修改
+func DiffSections(prev, next *Settings, sections []string) []FieldChange {
+	changes := []FieldChange{}
+	for _, name := range sections {
+		a, ok := sectionField(prev, name)
+		if !ok {
+			continue
+		}
+		b, _ := sectionField(next, name)
+		diffValue(a, b, name, &changes)
+	}
+	return changes
+}
+
+// fieldName 返回字段的 JSON 名称，不导出或忽略的字段返回空字符串
+func fieldName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+// isSecret 判断字段是否为凭据
+func isSecret(f reflect.StructField) bool {
+	return f.Type == secretType || f.Tag.Get("secret") == "true"
+}
+
+// isLeaf 判断值是否整体比较和导出，不再展开
+func isLeaf(t reflect.Type) bool {
+	return t.Kind() != reflect.Struct || t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType)
+}
+
+// stripSecrets 将值转为可序列化的形式，结构体转为按 JSON 名称索引的 map，去掉凭据字段
+func stripSecrets(v reflect.Value, path string, omitted *[]string) interface{} {
+	switch {
+	case v.Kind() == reflect.Struct && !isLeaf(v.Type()):
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			name := fieldName(f)
+			if name == "" {
+				continue
+			}
+			if isSecret(f) {
+				*omitted = append(*omitted, path+"."+name)
+				continue
+			}
+			out[name] = stripSecrets(v.Field(i), path+"."+name, omitted)
+		}
+		return out
+	case v.Kind() == reflect.Slice && !isLeaf(v.Type().Elem()):
+		if v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			// 列表中各元素的凭据字段相同，只记录一次
+			var elemOmitted []string
+			out[i] = stripSecrets(v.Index(i), fmt.Sprintf("%s[]", path), &elemOmitted)
+			if i == 0 {
+				*omitted = append(*omitted, elemOmitted...)
+			}
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
+
+// keepSecrets 将 src 中的凭据复制到 dst 中对应的空字段
+func keepSecrets(src, dst reflect.Value) {
+	switch {
+	case dst.Kind() == reflect.Struct && !isLeaf(dst.Type()):
+		for i := 0; i < dst.NumField(); i++ {
+			f := dst.Type().Field(i)
+			if fieldName(f) == "" {
+				continue
+			}
+			if isSecret(f) {
+				if dst.Field(i).IsZero() {
+					dst.Field(i).Set(src.Field(i))
+				}
+				continue
+			}
+			keepSecrets(src.Field(i), dst.Field(i))
+		}
+	case dst.Kind() == reflect.Slice && !isLeaf(dst.Type().Elem()):
+		for i := 0; i < dst.Len(); i++ {
+			if match, ok := matchElement(src, dst.Index(i), i); ok {
+				keepSecrets(match, dst.Index(i))
+			}
+		}
+	}
+}
+
+// matchElement 在 src 列表中查找与 elem 对应的元素，优先按 Name 字段匹配
+func matchElement(src, elem reflect.Value, index int) (reflect.Value, bool) {
+	if name := elem.FieldByName("Name"); name.IsValid() && name.Kind() == reflect.String {
+		for i := 0; i < src.Len(); i++ {
+			if src.Index(i).FieldByName("Name").String() == name.String() {
+				return src.Index(i), true
+			}
+		}
+		return reflect.Value{}, false
+	}
+	if index < src.Len() {
+		return src.Index(index), true
+	}
+	return reflect.Value{}, false
+}
+
+// diffValue 比较两个值，结构体逐字段比较，其余值整体比较
+func diffValue(a, b reflect.Value, path string, changes *[]FieldChange) {
+	if a.Kind() == reflect.Struct && !isLeaf(a.Type()) {
+		for i := 0; i < a.NumField(); i++ {
+			f := a.Type().Field(i)
+			name := fieldName(f)
+			if name == "" {
+				continue
+			}
+			if isSecret(f) {
+				if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+					*changes = append(*changes, FieldChange{Path: path + "." + name, Old: "******", New: "******"})
+				}
+				continue
+			}
+			diffValue(a.Field(i), b.Field(i), path+"."+name, changes)
+		}
+		return
+	}
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	var omitted []string
+	*changes = append(*changes, FieldChange{
+		Path: path,
+		Old:  stripSecrets(a, path, &omitted),
+		New:  stripSecrets(b, path, &omitted),
+	})
+}
@@ -18,6 +18,7 @@ import (
 
 	"v/logger"
 	"v/settings"
+	"v/utils"
 )
 
 // SelfSignedCert represents a self-signed SSL certificate
@@ -336,6 +337,9 @@ func (m *LocalCertManager) generateCertificate(cert *SelfSignedCert) error {
 	if err := pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privBytes}); err != nil {
 		return fmt.Errorf("failed to write private key to file: %v", err)
 	}
+	if err := utils.SecureKeyFile(filepath.Join(certDir, cert.Domain+".key")); err != nil {
+		return err
+	}
 
 	// Update certificate paths
 	cert.CertFile = filepath.Join(certDir, cert.Domain+".crt")
@@ -11,6 +11,8 @@ import (
 	"crypto"
 
 	"github.com/go-acme/lego/v4/registration"
+
+	"v/utils"
 )
 
 // User implements the registration.User interface
@@ -56,7 +58,7 @@ func (u *User) SavePrivateKey(filename string) error {
 		Bytes: x509.MarshalPKCS1PrivateKey(u.key),
 	})
 
-	return os.WriteFile(filename, keyPEM, 0600)
+	return utils.WriteKeyFile(filename, keyPEM)
 }
 
 // LoadPrivateKey loads the private key from a file
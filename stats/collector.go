@@ -0,0 +1,464 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+	"v/settings"
+)
+
+const (
+	// defaultCollectConcurrency 未配置时同时采集的目标数
+	defaultCollectConcurrency = 4
+	// defaultCollectTimeout 未配置时单个目标的采集超时
+	defaultCollectTimeout = 5 * time.Second
+	// defaultCollectInterval 未配置统计间隔时的采集间隔
+	defaultCollectInterval = time.Minute
+	// staleIntervals 连续多少个采集周期没有成功结果时标记为过期
+	staleIntervals = 3
+)
+
+// ErrCollectInFlight 上一次采集仍未返回
+var ErrCollectInFlight = errors.New("previous collection still in flight")
+
+// CollectTarget 可拉取流量计数的采集目标，如本机或远程节点的 xray API。
+// Collect 需要在 ctx 取消后尽快返回
+type CollectTarget interface {
+	Name() string
+	Collect(ctx context.Context) ([]IngestCounter, error)
+}
+
+// TargetStatus 采集目标的最近状态
+type TargetStatus struct {
+	Name        string        `json:"name"`
+	LastAttempt time.Time     `json:"last_attempt"`
+	LastSuccess time.Time     `json:"last_success"`
+	Duration    time.Duration `json:"duration"`
+	Counters    int           `json:"counters"`
+	Error       string        `json:"error,omitempty"`
+	Stale       bool          `json:"stale"`
+	// Sampling 采样模式下的外推结果和误差范围，非采样目标为空
+	Sampling *model.SamplingAccuracy `json:"sampling,omitempty"`
+	inFlight bool
+}
+
+// CollectResult 一个采集周期的结果
+type CollectResult struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Counters  int `json:"counters"`
+}
+
+// Collector 并行拉取各采集目标的流量计数，单个目标超时或失败不影响其他目标
+type Collector struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	sink     TrafficSink
+
+	mu       sync.Mutex
+	targets  []CollectTarget
+	status   map[string]*TargetStatus
+	samplers map[string]*sampler
+	stopCh   chan struct{}
+}
+
+// NewCollector 创建流量采集器
+func NewCollector(log *logger.Logger, settingsMgr *settings.Manager, sink TrafficSink) *Collector {
+	return &Collector{
+		log:      log,
+		settings: settingsMgr,
+		sink:     sink,
+		status:   make(map[string]*TargetStatus),
+		samplers: make(map[string]*sampler),
+	}
+}
+
+// SetTargets 替换采集目标列表
+func (c *Collector) SetTargets(targets []CollectTarget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.targets = targets
+	status := make(map[string]*TargetStatus, len(targets))
+	for _, t := range targets {
+		if st, ok := c.status[t.Name()]; ok {
+			status[t.Name()] = st
+		} else {
+			status[t.Name()] = &TargetStatus{Name: t.Name()}
+		}
+	}
+	c.status = status
+
+	for name, s := range c.samplers {
+		if _, ok := status[name]; !ok {
+			s.stop()
+			delete(c.samplers, name)
+		}
+	}
+}
+
+// Start 启动定期采集，没有采集目标时不启动
+func (c *Collector) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.targets) == 0 || c.stopCh != nil {
+		return
+	}
+	c.stopCh = make(chan struct{})
+	go c.run(c.stopCh)
+}
+
+// Stop 停止定期采集
+func (c *Collector) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopCh != nil {
+		close(c.stopCh)
+		c.stopCh = nil
+	}
+	for _, s := range c.samplers {
+		s.stop()
+	}
+}
+
+// run 采集循环
+func (c *Collector) run(stopCh chan struct{}) {
+	for {
+		timer := time.NewTimer(c.interval())
+		select {
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+			c.CollectOnce(context.Background())
+		}
+	}
+}
+
+// interval 采集间隔，与流量统计间隔一致
+func (c *Collector) interval() time.Duration {
+	if d := c.settings.Get().Traffic.StatsInterval; d > 0 {
+		return d
+	}
+	return defaultCollectInterval
+}
+
+// collectTimeout 单个目标的采集超时
+func (c *Collector) collectTimeout() time.Duration {
+	if d := c.settings.Get().Traffic.CollectTimeout; d > 0 {
+		return d
+	}
+	return defaultCollectTimeout
+}
+
+// CollectOnce 并行采集所有目标，每个目标单独超时，成功的部分照常记账
+func (c *Collector) CollectOnce(ctx context.Context) *CollectResult {
+	concurrency := c.settings.Get().Traffic.CollectConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultCollectConcurrency
+	}
+	timeout := c.collectTimeout()
+
+	c.mu.Lock()
+	targets := c.targets
+	c.mu.Unlock()
+
+	result := &CollectResult{}
+	var resultMu sync.Mutex
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for _, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target CollectTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			counters, err := c.collectTarget(ctx, target, timeout)
+
+			resultMu.Lock()
+			defer resultMu.Unlock()
+			if err != nil {
+				result.Failed++
+				return
+			}
+			result.Succeeded++
+			result.Counters += counters
+		}(target)
+	}
+	wg.Wait()
+
+	if result.Failed > 0 {
+		c.log.WarnWithFields("Traffic collection finished with failures", logger.Fields{
+			"succeeded": result.Succeeded,
+			"failed":    result.Failed,
+		})
+	}
+	return result
+}
+
+// collectTarget 采集单个目标并记账，返回记账的计数器数量
+func (c *Collector) collectTarget(ctx context.Context, target CollectTarget, timeout time.Duration) (int, error) {
+	name := target.Name()
+	start := time.Now()
+
+	c.mu.Lock()
+	st, ok := c.status[name]
+	if !ok {
+		st = &TargetStatus{Name: name}
+		c.status[name] = st
+	}
+	// 不响应取消的目标可能仍在运行，跳过本轮避免堆积
+	if st.inFlight {
+		st.LastAttempt = start
+		st.Error = ErrCollectInFlight.Error()
+		c.mu.Unlock()
+		return 0, ErrCollectInFlight
+	}
+	st.inFlight = true
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type collected struct {
+		counters []IngestCounter
+		err      error
+	}
+	done := make(chan collected, 1)
+	go func() {
+		counters, err := target.Collect(ctx)
+		done <- collected{counters, err}
+
+		c.mu.Lock()
+		st.inFlight = false
+		c.mu.Unlock()
+	}()
+
+	var res collected
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = fmt.Errorf("collect %s: %w", name, ctx.Err())
+	}
+
+	recorded := 0
+	if res.err == nil {
+		if ratio := c.settings.Get().Traffic.SamplingRatio(name); ratio > 0 {
+			res.counters = c.extrapolate(name, ratio, res.counters, time.Now())
+			c.scheduleWindow(target, ratio)
+		} else {
+			c.dropSampler(name)
+		}
+		for _, counter := range res.counters {
+			if err := c.record(counter); err != nil {
+				c.log.ErrorWithFields("Failed to record collected traffic", logger.Fields{
+					"target":  name,
+					"counter": counter.Counter,
+					"error":   err,
+				})
+				continue
+			}
+			recorded++
+		}
+	}
+
+	c.mu.Lock()
+	st.LastAttempt = start
+	st.Duration = time.Since(start)
+	if res.err != nil {
+		st.Error = res.err.Error()
+	} else {
+		st.Error = ""
+		st.LastSuccess = time.Now()
+		st.Counters = recorded
+	}
+	c.mu.Unlock()
+
+	if res.err != nil {
+		c.log.WarnWithFields("Failed to collect traffic", logger.Fields{
+			"target": name,
+			"error":  res.err.Error(),
+		})
+	}
+	return recorded, res.err
+}
+
+// record 写入流量统计
+func (c *Collector) record(counter IngestCounter) error {
+	if counter.UserID != 0 {
+		if err := c.sink.AddTraffic(counter.UserID, counter.Upload, counter.Download); err != nil {
+			return err
+		}
+	}
+	if counter.ProtocolID != 0 {
+		if err := c.sink.UpdateProtocolTraffic(counter.ProtocolID, counter.Upload, counter.Download); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status 返回各采集目标的状态，超过若干采集周期没有成功结果的目标标记为过期
+func (c *Collector) Status() []*TargetStatus {
+	staleAfter := staleIntervals * c.interval()
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]*TargetStatus, 0, len(c.status))
+	for _, st := range c.status {
+		s := *st
+		s.Stale = !s.LastAttempt.IsZero() && now.Sub(s.LastSuccess) > staleAfter
+		if sm, ok := c.samplers[s.Name]; ok {
+			accuracy := sm.accuracy
+			s.Sampling = &accuracy
+		}
+		list = append(list, &s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// XrayAPITarget 通过 xray api statsquery 拉取并重置 xray 流量计数
+type XrayAPITarget struct {
+	name   string
+	server string
+	binary func() string
+	// Resolve 将 xray 计数器名称（用户 email 或入站 tag）映射为用户或协议 ID，返回 0 表示忽略
+	Resolve func(kind, name string) int64
+}
+
+// NewXrayAPITarget 创建 xray API 采集目标，binary 返回当前 xray 可执行文件路径
+func NewXrayAPITarget(name, server string, binary func() string) *XrayAPITarget {
+	return &XrayAPITarget{
+		name:    name,
+		server:  server,
+		binary:  binary,
+		Resolve: resolveCounterID,
+	}
+}
+
+// ParseCollectTargets 解析 name=host:port 或 host:port 格式的采集目标
+func ParseCollectTargets(specs []string, binary func() string) []CollectTarget {
+	targets := make([]CollectTarget, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, server := spec, spec
+		if i := strings.Index(spec, "="); i >= 0 {
+			name, server = spec[:i], spec[i+1:]
+		}
+		targets = append(targets, NewXrayAPITarget(name, server, binary))
+	}
+	return targets
+}
+
+// Name 返回目标名称
+func (t *XrayAPITarget) Name() string {
+	return t.name
+}
+
+// Collect 查询并重置计数器，按用户和入站汇总上下行流量
+func (t *XrayAPITarget) Collect(ctx context.Context) ([]IngestCounter, error) {
+	cmd := exec.CommandContext(ctx, t.binary(), "api", "statsquery", "--server="+t.server, "-reset")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("xray statsquery failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return t.parse(out)
+}
+
+// parse 解析 statsquery 输出，计数器名称形如 user>>>email>>>traffic>>>uplink
+func (t *XrayAPITarget) parse(out []byte) ([]IngestCounter, error) {
+	var resp struct {
+		Stat []struct {
+			Name  string      `json:"name"`
+			Value json.Number `json:"value"`
+		} `json:"stat"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse statsquery output: %v", err)
+	}
+
+	byName := make(map[string]*IngestCounter)
+	var order []string
+	for _, stat := range resp.Stat {
+		parts := strings.Split(stat.Name, ">>>")
+		if len(parts) != 4 || parts[2] != "traffic" {
+			continue
+		}
+		kind, name, direction := parts[0], parts[1], parts[3]
+		if kind != "user" && kind != "inbound" {
+			continue
+		}
+		value, err := stat.Value.Int64()
+		if err != nil || value <= 0 {
+			continue
+		}
+
+		key := kind + ">>>" + name
+		counter, ok := byName[key]
+		if !ok {
+			id := t.Resolve(kind, name)
+			if id == 0 {
+				continue
+			}
+			counter = &IngestCounter{Counter: key}
+			if kind == "user" {
+				counter.UserID = id
+			} else {
+				counter.ProtocolID = id
+			}
+			byName[key] = counter
+			order = append(order, key)
+		}
+		if direction == "uplink" {
+			counter.Upload += value
+		} else {
+			counter.Download += value
+		}
+	}
+
+	counters := make([]IngestCounter, 0, len(order))
+	for _, key := range order {
+		counters = append(counters, *byName[key])
+	}
+	return counters, nil
+}
+
+// resolveCounterID 默认映射：名称为数字 ID，或以 -ID 结尾（如 inbound-12）
+func resolveCounterID(kind, name string) int64 {
+	if i := strings.LastIndex(name, "-"); i >= 0 {
+		name = name[i+1:]
+	}
+	id, err := strconv.ParseInt(name, 10, 64)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,244 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"v/logger"
+	"v/settings"
+)
+
+// 使用 go test ./stats -update 重新生成 golden 文件
+var update = flag.Bool("update", false, "update golden files")
+
+// replayTarget 按顺序回放录制的 statsquery 输出，每次采集返回一轮
+type replayTarget struct {
+	*XrayAPITarget
+	rounds []json.RawMessage
+	next   int
+}
+
+func (t *replayTarget) Collect(ctx context.Context) ([]IngestCounter, error) {
+	if t.next >= len(t.rounds) {
+		return nil, fmt.Errorf("no more recorded rounds")
+	}
+	out := t.rounds[t.next]
+	t.next++
+	return t.parse(out)
+}
+
+// sinkCall 记账接口的一次调用
+type sinkCall struct {
+	Kind     string `json:"kind"` // user 或 protocol
+	ID       int64  `json:"id"`
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+}
+
+// traffic 累计的上下行流量
+type traffic struct {
+	Upload   int64 `json:"upload"`
+	Download int64 `json:"download"`
+}
+
+// recordingSink 记录每次记账调用并按用户和协议累计
+type recordingSink struct {
+	mu    sync.Mutex
+	calls []sinkCall
+}
+
+func (s *recordingSink) AddTraffic(userID int64, upload, download int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, sinkCall{"user", userID, upload, download})
+	return nil
+}
+
+func (s *recordingSink) UpdateProtocolTraffic(protocolID int64, upload, download int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, sinkCall{"protocol", protocolID, upload, download})
+	return nil
+}
+
+// drain 返回并清空已记录的调用
+func (s *recordingSink) drain() []sinkCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := s.calls
+	s.calls = nil
+	if calls == nil {
+		calls = []sinkCall{}
+	}
+	return calls
+}
+
+// accountingResult golden 文件内容：每轮的记账调用和最终累计结果
+type accountingResult struct {
+	Rounds    [][]sinkCall       `json:"rounds"`
+	Users     map[string]traffic `json:"users"`
+	Protocols map[string]traffic `json:"protocols"`
+}
+
+func TestCollector_GoldenStats(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs []string
+	for _, f := range fixtures {
+		if !strings.HasSuffix(f, ".golden.json") {
+			inputs = append(inputs, f)
+		}
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no fixtures found in testdata")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".json")
+		t.Run(name, func(t *testing.T) {
+			got := runFixture(t, input)
+
+			data, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, '\n')
+
+			golden := strings.TrimSuffix(input, ".json") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(golden, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file (run with -update to create): %v", err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("accounting mismatch for %s\ngot:\n%s\nwant:\n%s", name, data, want)
+			}
+		})
+	}
+}
+
+// runFixture 用录制的输出逐轮驱动采集器，返回记账结果
+func runFixture(t *testing.T, path string) *accountingResult {
+	t.Helper()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rounds []json.RawMessage
+	if err := json.Unmarshal(raw, &rounds); err != nil {
+		t.Fatalf("invalid fixture %s: %v", path, err)
+	}
+
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	sink := &recordingSink{}
+	c := NewCollector(log, settings.New(log), sink)
+	target := &replayTarget{
+		XrayAPITarget: NewXrayAPITarget("replay", "127.0.0.1:10085", nil),
+		rounds:        rounds,
+	}
+	c.SetTargets([]CollectTarget{target})
+
+	result := &accountingResult{
+		Users:     make(map[string]traffic),
+		Protocols: make(map[string]traffic),
+	}
+	for i := range rounds {
+		res := c.CollectOnce(context.Background())
+		if res.Failed != 0 {
+			t.Fatalf("round %d: collection failed: %s", i, c.Status()[0].Error)
+		}
+		calls := sink.drain()
+		// 每个计数器只归属用户或协议之一，对应一次记账调用
+		if res.Counters != len(calls) {
+			t.Errorf("round %d: reported %d counters, sink saw %d", i, res.Counters, len(calls))
+		}
+		result.Rounds = append(result.Rounds, calls)
+
+		for _, call := range calls {
+			totals := result.Users
+			if call.Kind == "protocol" {
+				totals = result.Protocols
+			}
+			key := fmt.Sprint(call.ID)
+			sum := totals[key]
+			sum.Upload += call.Upload
+			sum.Download += call.Download
+			totals[key] = sum
+		}
+	}
+	return result
+}
+
+func TestXrayAPITarget_ParseSkipsInvalidCounters(t *testing.T) {
+	target := NewXrayAPITarget("local", "127.0.0.1:10085", nil)
+
+	tests := []struct {
+		name string
+		out  string
+		want []IngestCounter
+	}{
+		{
+			name: "uplink and downlink merged",
+			out:  `{"stat":[{"name":"user>>>5>>>traffic>>>uplink","value":10},{"name":"user>>>5>>>traffic>>>downlink","value":20}]}`,
+			want: []IngestCounter{{Counter: "user>>>5", UserID: 5, Upload: 10, Download: 20}},
+		},
+		{
+			name: "string values",
+			out:  `{"stat":[{"name":"inbound>>>inbound-7>>>traffic>>>downlink","value":"30"}]}`,
+			want: []IngestCounter{{Counter: "inbound>>>inbound-7", ProtocolID: 7, Download: 30}},
+		},
+		{
+			// 重置后的计数器值为 0 或省略，不产生记账
+			name: "reset counters",
+			out:  `{"stat":[{"name":"user>>>5>>>traffic>>>uplink","value":0},{"name":"user>>>5>>>traffic>>>downlink"}]}`,
+			want: []IngestCounter{},
+		},
+		{
+			name: "unknown tags",
+			out:  `{"stat":[{"name":"inbound>>>api>>>traffic>>>uplink","value":10},{"name":"user>>>a@b.c>>>traffic>>>uplink","value":10}]}`,
+			want: []IngestCounter{},
+		},
+		{
+			name: "empty output",
+			out:  `{}`,
+			want: []IngestCounter{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := target.parse([]byte(tt.out))
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d counters, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("counter %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := target.parse([]byte("not json")); err == nil {
+		t.Error("expected error for malformed output")
+	}
+}
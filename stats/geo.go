@@ -0,0 +1,226 @@
+package stats
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/notification"
+)
+
+const (
+	// UnknownCountry 未配置地理位置查询或查询失败时使用的国家代码
+	UnknownCountry = "ZZ"
+	// sessionGap 同一来源超过该时长未出现后再次出现时计为新连接
+	sessionGap = 5 * time.Minute
+	// maxGeoCache 缓存的 IP 国家查询结果数量，超出时清空重建
+	maxGeoCache = 10000
+)
+
+// 国家访问统计的分组方式
+const (
+	GroupCountry = "country"
+	GroupInbound = "inbound"
+	GroupUser    = "user"
+)
+
+// OnlineClient 节点上报的在线客户端，Upload 和 Download 为自上次上报以来该来源产生的流量
+type OnlineClient struct {
+	UserID     int64  `json:"user_id,omitempty"`
+	ProtocolID int64  `json:"protocol_id,omitempty"`
+	IP         string `json:"ip"`
+	Upload     int64  `json:"upload"`
+	Download   int64  `json:"download"`
+}
+
+// CountryStat 一个国家的访问统计，按入站或用户分组时带有对应的 ID
+type CountryStat struct {
+	Country     string    `json:"country"`
+	ProtocolID  int64     `json:"protocol_id,omitempty"`
+	UserID      int64     `json:"user_id,omitempty"`
+	Connections int64     `json:"connections"`
+	Upload      int64     `json:"upload"`
+	Download    int64     `json:"download"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// CountryReport 国家访问统计报告
+type CountryReport struct {
+	Group   string        `json:"group"`
+	Since   time.Time     `json:"since"` // 统计开始时间，统计只保存在内存中，重启后重新计算
+	Entries []CountryStat `json:"entries"`
+}
+
+// geoKey 统计维度
+type geoKey struct {
+	country    string
+	protocolID int64
+	userID     int64
+}
+
+// sourceKey 在线来源
+type sourceKey struct {
+	protocolID int64
+	userID     int64
+	ip         string
+}
+
+// GeoStats 按来源国家汇总在线客户端的连接数和流量
+type GeoStats struct {
+	log *logger.Logger
+	geo notification.GeoLookup
+
+	mu        sync.Mutex
+	since     time.Time
+	countries map[string]string
+	sources   map[sourceKey]time.Time
+	entries   map[geoKey]*CountryStat
+}
+
+// NewGeoStats 创建国家访问统计，geo 为 nil 时所有来源计入 UnknownCountry
+func NewGeoStats(log *logger.Logger, geo notification.GeoLookup) *GeoStats {
+	return &GeoStats{
+		log:       log,
+		geo:       geo,
+		since:     time.Now(),
+		countries: make(map[string]string),
+		sources:   make(map[sourceKey]time.Time),
+		entries:   make(map[geoKey]*CountryStat),
+	}
+}
+
+// Observe 记录一批在线客户端，来源 IP 无效的记录被忽略，返回忽略的数量
+func (g *GeoStats) Observe(clients []OnlineClient, now time.Time) int {
+	ignored := 0
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, c := range clients {
+		if net.ParseIP(c.IP) == nil || c.Upload < 0 || c.Download < 0 || (c.UserID == 0 && c.ProtocolID == 0) {
+			ignored++
+			continue
+		}
+
+		country := g.country(c.IP)
+		key := geoKey{country: country, protocolID: c.ProtocolID, userID: c.UserID}
+		entry, ok := g.entries[key]
+		if !ok {
+			entry = &CountryStat{Country: country, ProtocolID: c.ProtocolID, UserID: c.UserID}
+			g.entries[key] = entry
+		}
+
+		source := sourceKey{protocolID: c.ProtocolID, userID: c.UserID, ip: c.IP}
+		if last, ok := g.sources[source]; !ok || now.Sub(last) > sessionGap {
+			entry.Connections++
+		}
+		g.sources[source] = now
+
+		entry.Upload += c.Upload
+		entry.Download += c.Download
+		entry.LastSeen = now
+	}
+
+	g.expireSources(now)
+	return ignored
+}
+
+// Report 按分组汇总统计，按总流量从高到低排序
+func (g *GeoStats) Report(group string) *CountryReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	merged := make(map[geoKey]*CountryStat)
+	for key, entry := range g.entries {
+		switch group {
+		case GroupInbound:
+			key.userID = 0
+		case GroupUser:
+			key.protocolID = 0
+		default:
+			key.protocolID, key.userID = 0, 0
+		}
+		stat, ok := merged[key]
+		if !ok {
+			stat = &CountryStat{Country: key.country, ProtocolID: key.protocolID, UserID: key.userID}
+			merged[key] = stat
+		}
+		stat.Connections += entry.Connections
+		stat.Upload += entry.Upload
+		stat.Download += entry.Download
+		if entry.LastSeen.After(stat.LastSeen) {
+			stat.LastSeen = entry.LastSeen
+		}
+	}
+
+	report := &CountryReport{
+		Group:   group,
+		Since:   g.since,
+		Entries: make([]CountryStat, 0, len(merged)),
+	}
+	for _, stat := range merged {
+		report.Entries = append(report.Entries, *stat)
+	}
+	sort.Slice(report.Entries, func(i, j int) bool {
+		a, b := report.Entries[i], report.Entries[j]
+		if a.Upload+a.Download != b.Upload+b.Download {
+			return a.Upload+a.Download > b.Upload+b.Download
+		}
+		if a.Country != b.Country {
+			return a.Country < b.Country
+		}
+		if a.ProtocolID != b.ProtocolID {
+			return a.ProtocolID < b.ProtocolID
+		}
+		return a.UserID < b.UserID
+	})
+	return report
+}
+
+// country 查询 IP 所在国家，结果缓存，调用方需持有锁
+func (g *GeoStats) country(ip string) string {
+	if g.geo == nil {
+		return UnknownCountry
+	}
+	if country, ok := g.countries[ip]; ok {
+		return country
+	}
+
+	country, err := g.geo.Country(ip)
+	if err != nil || country == "" {
+		if err != nil {
+			g.log.DebugWithFields("Geo lookup failed", logger.Fields{
+				"ip":    ip,
+				"error": err.Error(),
+			})
+		}
+		country = UnknownCountry
+	}
+	if len(g.countries) >= maxGeoCache {
+		g.countries = make(map[string]string)
+	}
+	g.countries[ip] = country
+	return country
+}
+
+// AnonymizeBefore 清空 IP 到国家的缓存。在线来源只保留一个会话间隔，不会超过匿名化延迟，
+// 因此只需处理缓存，返回清除的缓存条数
+func (g *GeoStats) AnonymizeBefore(cutoff time.Time, anonymize func(string) string) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	count := len(g.countries)
+	g.countries = make(map[string]string)
+	return count, nil
+}
+
+// expireSources 清理长时间未出现的来源，调用方需持有锁
+func (g *GeoStats) expireSources(now time.Time) {
+	for source, last := range g.sources {
+		if now.Sub(last) > sessionGap {
+			delete(g.sources, source)
+		}
+	}
+}
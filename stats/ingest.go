@@ -0,0 +1,209 @@
+package stats
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// defaultIngestClockSkew 未配置时允许的时间戳偏差
+const defaultIngestClockSkew = 5 * time.Minute
+
+var (
+	// ErrIngestDisabled 未启用外部流量上报
+	ErrIngestDisabled = errors.New("traffic ingestion is disabled")
+	// ErrIngestSignature 签名无效
+	ErrIngestSignature = errors.New("invalid ingest signature")
+	// ErrIngestTimestamp 时间戳无效或超出允许偏差
+	ErrIngestTimestamp = errors.New("ingest timestamp out of range")
+	// ErrIngestInvalidBatch 上报数据格式错误
+	ErrIngestInvalidBatch = errors.New("invalid ingest batch")
+)
+
+// TrafficSink 流量记账接口，与本地采集使用同一套处理流程
+type TrafficSink interface {
+	AddTraffic(userID int64, upload, download int64) error
+	UpdateProtocolTraffic(protocolID int64, upload, download int64) error
+}
+
+// IngestCounter 外部采集器上报的单个计数器增量
+type IngestCounter struct {
+	Counter    string `json:"counter"`               // 采集器内的计数器名称，如 user>>>42>>>traffic
+	Sequence   uint64 `json:"sequence"`              // 计数器内单调递增的序号，用于去重
+	UserID     int64  `json:"user_id,omitempty"`     // 归属用户
+	ProtocolID int64  `json:"protocol_id,omitempty"` // 归属协议
+	Upload     int64  `json:"upload"`                // 自上次上报以来的上传字节数
+	Download   int64  `json:"download"`              // 自上次上报以来的下载字节数
+}
+
+// IngestBatch 外部采集器的一次上报
+type IngestBatch struct {
+	Node     string          `json:"node"`
+	Counters []IngestCounter `json:"counters"`
+	Online   []OnlineClient  `json:"online,omitempty"` // 在线客户端的来源 IP，用于国家访问统计
+}
+
+// IngestResult 上报处理结果
+type IngestResult struct {
+	Accepted   int `json:"accepted"`
+	Duplicates int `json:"duplicates"`
+	Rejected   int `json:"rejected"`
+}
+
+// counterKey 去重维度
+type counterKey struct {
+	node    string
+	counter string
+}
+
+// Ingestor 接收外部节点上报的流量计数
+type Ingestor struct {
+	log      *logger.Logger
+	settings *settings.Manager
+	sink     TrafficSink
+	geo      *GeoStats
+	// sequences 每个 (节点, 计数器) 已接受的最大序号，重启后由时间戳校验限制重放窗口
+	sequences map[counterKey]uint64
+	mu        sync.Mutex
+}
+
+// NewIngestor 创建外部流量接收器
+func NewIngestor(log *logger.Logger, settingsMgr *settings.Manager, sink TrafficSink) *Ingestor {
+	return &Ingestor{
+		log:       log,
+		settings:  settingsMgr,
+		sink:      sink,
+		sequences: make(map[counterKey]uint64),
+	}
+}
+
+// SetGeoStats 设置国家访问统计，为 nil 时忽略上报的在线客户端
+func (i *Ingestor) SetGeoStats(geo *GeoStats) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.geo = geo
+}
+
+// Verify 校验请求签名。签名为 hex(HMAC-SHA256(secret, timestamp + "." + body))，
+// 可带 sha256= 前缀，timestamp 为 Unix 秒。node 为请求体中的节点名称，
+// 该节点有引导时生成的专用密钥时只接受专用密钥，其他节点使用全局密钥
+func (i *Ingestor) Verify(node, timestamp, signature string, body []byte, now time.Time) error {
+	cfg := i.settings.Get().Ingest
+	if !cfg.Enable {
+		return ErrIngestDisabled
+	}
+	secret, ok := cfg.NodeSecrets[node]
+	if !ok {
+		secret = cfg.Secret
+	}
+	if secret == "" {
+		return ErrIngestDisabled
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrIngestTimestamp
+	}
+	skew := cfg.MaxClockSkew
+	if skew <= 0 {
+		skew = defaultIngestClockSkew
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > skew || d < -skew {
+		return ErrIngestTimestamp
+	}
+
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return ErrIngestSignature
+	}
+	if !hmac.Equal(sig, SignIngest(secret, timestamp, body)) {
+		return ErrIngestSignature
+	}
+	return nil
+}
+
+// SignIngest 计算上报请求签名，供采集器和测试使用
+func SignIngest(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Ingest 处理一批计数器，按 (节点, 计数器, 序号) 去重后写入流量统计
+func (i *Ingestor) Ingest(batch *IngestBatch) (*IngestResult, error) {
+	if batch.Node == "" {
+		return nil, fmt.Errorf("%w: node is required", ErrIngestInvalidBatch)
+	}
+
+	result := &IngestResult{}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, c := range batch.Counters {
+		if c.Counter == "" || c.Upload < 0 || c.Download < 0 || (c.UserID == 0 && c.ProtocolID == 0) {
+			result.Rejected++
+			continue
+		}
+
+		key := counterKey{node: batch.Node, counter: c.Counter}
+		if last, ok := i.sequences[key]; ok && c.Sequence <= last {
+			result.Duplicates++
+			continue
+		}
+
+		if err := i.record(c); err != nil {
+			i.log.ErrorWithFields("Failed to record ingested traffic", logger.Fields{
+				"node":    batch.Node,
+				"counter": c.Counter,
+				"error":   err,
+			})
+			result.Rejected++
+			continue
+		}
+
+		i.sequences[key] = c.Sequence
+		result.Accepted++
+	}
+
+	if i.geo != nil && len(batch.Online) > 0 {
+		result.Rejected += i.geo.Observe(batch.Online, time.Now())
+	}
+
+	if result.Rejected > 0 || result.Duplicates > 0 {
+		i.log.DebugWithFields("Traffic batch ingested", logger.Fields{
+			"node":       batch.Node,
+			"accepted":   result.Accepted,
+			"duplicates": result.Duplicates,
+			"rejected":   result.Rejected,
+		})
+	}
+
+	return result, nil
+}
+
+// record 写入流量统计
+func (i *Ingestor) record(c IngestCounter) error {
+	if c.UserID != 0 {
+		if err := i.sink.AddTraffic(c.UserID, c.Upload, c.Download); err != nil {
+			return err
+		}
+	}
+	if c.ProtocolID != 0 {
+		if err := i.sink.UpdateProtocolTraffic(c.ProtocolID, c.Upload, c.Download); err != nil {
+			return err
+		}
+	}
+	return nil
+}
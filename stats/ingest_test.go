@@ -0,0 +1,151 @@
+package stats
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+// newTestIngestor 使用给定的上报设置创建接收器，设置文件写入临时目录
+func newTestIngestor(t *testing.T, cfg settings.IngestSettings, sink TrafficSink) *Ingestor {
+	t.Helper()
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	m := settings.NewWithPath(log, filepath.Join(t.TempDir(), "settings.json"))
+	next := m.Clone()
+	next.Ingest = cfg
+	if err := m.Update(next); err != nil {
+		t.Fatalf("Update settings: %v", err)
+	}
+	return NewIngestor(log, m, sink)
+}
+
+func TestIngestorVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"node":"edge-1","counters":[]}`)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sign := func(secret, timestamp string) string {
+		return hex.EncodeToString(SignIngest(secret, timestamp, body))
+	}
+
+	enabled := settings.IngestSettings{
+		Enable:      true,
+		Secret:      "global-secret",
+		NodeSecrets: map[string]string{"edge-1": "node-secret"},
+	}
+
+	tests := []struct {
+		name      string
+		cfg       settings.IngestSettings
+		node      string
+		timestamp string
+		signature string
+		body      []byte
+		want      error
+	}{
+		{name: "node secret", cfg: enabled, node: "edge-1", timestamp: ts, signature: sign("node-secret", ts)},
+		{name: "sha256 prefix", cfg: enabled, node: "edge-1", timestamp: ts, signature: "sha256=" + sign("node-secret", ts)},
+		{name: "global secret for unknown node", cfg: enabled, node: "edge-2", timestamp: ts, signature: sign("global-secret", ts)},
+		{name: "global secret rejected for node with its own secret", cfg: enabled, node: "edge-1", timestamp: ts, signature: sign("global-secret", ts), want: ErrIngestSignature},
+		{name: "tampered body", cfg: enabled, node: "edge-1", timestamp: ts, signature: sign("node-secret", ts), body: []byte(`{"node":"edge-1","counters":[{}]}`), want: ErrIngestSignature},
+		{name: "signature is not hex", cfg: enabled, node: "edge-1", timestamp: ts, signature: "not-hex", want: ErrIngestSignature},
+		{name: "timestamp within default skew", cfg: enabled, node: "edge-1", timestamp: strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10), signature: sign("node-secret", strconv.FormatInt(now.Add(-4*time.Minute).Unix(), 10))},
+		{name: "timestamp too old", cfg: enabled, node: "edge-1", timestamp: strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), signature: sign("node-secret", strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)), want: ErrIngestTimestamp},
+		{name: "timestamp in the future", cfg: enabled, node: "edge-1", timestamp: strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), signature: sign("node-secret", strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10)), want: ErrIngestTimestamp},
+		{name: "timestamp is not a number", cfg: enabled, node: "edge-1", timestamp: "yesterday", signature: sign("node-secret", "yesterday"), want: ErrIngestTimestamp},
+		{name: "disabled", cfg: settings.IngestSettings{Secret: "global-secret"}, node: "edge-2", timestamp: ts, signature: sign("global-secret", ts), want: ErrIngestDisabled},
+		{name: "no secret configured", cfg: settings.IngestSettings{Enable: true}, node: "edge-2", timestamp: ts, signature: sign("", ts), want: ErrIngestDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIngestor(t, tt.cfg, &recordingSink{})
+			b := tt.body
+			if b == nil {
+				b = body
+			}
+			if err := i.Verify(tt.node, tt.timestamp, tt.signature, b, now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngestorIngest(t *testing.T) {
+	sink := &recordingSink{}
+	i := newTestIngestor(t, settings.IngestSettings{Enable: true, Secret: "secret"}, sink)
+
+	// 每批的结果和记账调用，同一节点同一计数器的序号不大于已接受的序号时视为重复
+	batches := []struct {
+		name      string
+		batch     IngestBatch
+		want      IngestResult
+		wantCalls []sinkCall
+	}{
+		{
+			name: "first batch",
+			batch: IngestBatch{Node: "edge-1", Counters: []IngestCounter{
+				{Counter: "user>>>42", Sequence: 1, UserID: 42, ProtocolID: 7, Upload: 100, Download: 200},
+				{Counter: "inbound>>>7", Sequence: 1, ProtocolID: 7, Upload: 5, Download: 6},
+			}},
+			want: IngestResult{Accepted: 2},
+			wantCalls: []sinkCall{
+				{"user", 42, 100, 200}, {"protocol", 7, 100, 200},
+				{"protocol", 7, 5, 6},
+			},
+		},
+		{
+			name: "replayed and newer sequences",
+			batch: IngestBatch{Node: "edge-1", Counters: []IngestCounter{
+				{Counter: "user>>>42", Sequence: 1, UserID: 42, Upload: 100, Download: 200},
+				{Counter: "user>>>42", Sequence: 2, UserID: 42, Upload: 10, Download: 20},
+				{Counter: "user>>>42", Sequence: 2, UserID: 42, Upload: 10, Download: 20},
+			}},
+			want:      IngestResult{Accepted: 1, Duplicates: 2},
+			wantCalls: []sinkCall{{"user", 42, 10, 20}},
+		},
+		{
+			name: "same counter on another node",
+			batch: IngestBatch{Node: "edge-2", Counters: []IngestCounter{
+				{Counter: "user>>>42", Sequence: 1, UserID: 42, Upload: 1, Download: 2},
+			}},
+			want:      IngestResult{Accepted: 1},
+			wantCalls: []sinkCall{{"user", 42, 1, 2}},
+		},
+		{
+			name: "invalid counters",
+			batch: IngestBatch{Node: "edge-1", Counters: []IngestCounter{
+				{Sequence: 3, UserID: 42, Upload: 1},
+				{Counter: "user>>>42", Sequence: 3, UserID: 42, Upload: -1},
+				{Counter: "orphan", Sequence: 1, Upload: 1},
+			}},
+			want:      IngestResult{Rejected: 3},
+			wantCalls: []sinkCall{},
+		},
+	}
+
+	for _, tt := range batches {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := i.Ingest(&tt.batch)
+			if err != nil {
+				t.Fatalf("Ingest: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("result = %+v, want %+v", *got, tt.want)
+			}
+			if calls := sink.drain(); !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("sink calls = %+v, want %+v", calls, tt.wantCalls)
+			}
+		})
+	}
+
+	if _, err := i.Ingest(&IngestBatch{}); !errors.Is(err, ErrIngestInvalidBatch) {
+		t.Errorf("Ingest without node: error = %v, want %v", err, ErrIngestInvalidBatch)
+	}
+}
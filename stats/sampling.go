@@ -0,0 +1,203 @@
+package stats
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"v/logger"
+	"v/model"
+)
+
+const (
+	// sampleHistory 估计误差时参考的最近采样窗口数
+	sampleHistory = 30
+	// sampleZ 95% 置信水平对应的 z 值
+	sampleZ = 1.96
+)
+
+// sampler 采样模式目标的窗口状态。
+// 采样模式下每个采集周期只统计最后 ratio 比例的时间：周期中途读取并丢弃一次计数（打开采样窗口），
+// 周期结束时读取的计数按 已过时间/窗口时间 外推到整个周期
+type sampler struct {
+	lastRead    time.Time   // 上次读取并记账的时间
+	windowStart time.Time   // 本轮采样窗口打开的时间，零值表示计数未被丢弃，读取结果为精确值
+	timer       *time.Timer // 打开下一个采样窗口的定时器
+	rates       []float64   // 最近采样窗口的速率（字节/秒）
+	variance    float64     // 累计外推字节数的方差
+	accuracy    model.SamplingAccuracy
+}
+
+// stop 停止尚未触发的采样窗口
+func (s *sampler) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// extrapolate 按采样窗口外推读取到的计数，并更新累计误差范围
+func (c *Collector) extrapolate(name string, ratio float64, counters []IngestCounter, readAt time.Time) []IngestCounter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.samplers[name]
+	if !ok {
+		s = &sampler{accuracy: model.SamplingAccuracy{Target: name, Since: readAt}}
+		c.samplers[name] = s
+	}
+	s.accuracy.Ratio = ratio
+
+	windowStart, lastRead := s.windowStart, s.lastRead
+	s.windowStart, s.lastRead = time.Time{}, readAt
+
+	measured := counterBytes(counters)
+	s.accuracy.MeasuredBytes += measured
+	// 本轮没有丢弃计数（首次读取、窗口未能打开），结果为精确值
+	if windowStart.IsZero() || lastRead.IsZero() || !windowStart.After(lastRead) || !readAt.After(windowStart) {
+		s.accuracy.RecordedBytes += measured
+		return counters
+	}
+
+	sampled := readAt.Sub(windowStart).Seconds()
+	elapsed := readAt.Sub(lastRead).Seconds()
+	factor := elapsed / sampled
+
+	scaled := make([]IngestCounter, len(counters))
+	for i, counter := range counters {
+		counter.Upload = int64(math.Round(float64(counter.Upload) * factor))
+		counter.Download = int64(math.Round(float64(counter.Download) * factor))
+		scaled[i] = counter
+	}
+
+	rate := float64(measured) / sampled
+	s.rates = append(s.rates, rate)
+	if len(s.rates) > sampleHistory {
+		s.rates = s.rates[len(s.rates)-sampleHistory:]
+	}
+	// 未计数的时间段按窗口速率外推，其误差取最近各窗口速率的标准差；只有一个窗口时按速率本身估计
+	sd := rate
+	if len(s.rates) > 1 {
+		sd = stddev(s.rates)
+	}
+	unobserved := (elapsed - sampled) * sd
+	s.variance += unobserved * unobserved
+
+	s.accuracy.Windows++
+	s.accuracy.RecordedBytes += counterBytes(scaled)
+	s.accuracy.ErrorBound = int64(math.Round(sampleZ * math.Sqrt(s.variance)))
+	if s.accuracy.RecordedBytes > 0 {
+		s.accuracy.ErrorPercent = math.Round(float64(s.accuracy.ErrorBound)/float64(s.accuracy.RecordedBytes)*10000) / 100
+	}
+	return scaled
+}
+
+// scheduleWindow 安排在下一个采集周期的最后 ratio 比例时间打开采样窗口，采集器未启动时不安排
+func (c *Collector) scheduleWindow(target CollectTarget, ratio float64) {
+	delay := time.Duration(float64(c.interval()) * (1 - ratio))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.samplers[target.Name()]
+	if !ok || c.stopCh == nil {
+		return
+	}
+	s.stop()
+	s.timer = time.AfterFunc(delay, func() {
+		c.openWindow(target)
+	})
+}
+
+// openWindow 读取并丢弃目标当前的计数，开始本轮的采样窗口。
+// 失败时窗口保持关闭，下一次读取按精确值记账
+func (c *Collector) openWindow(target CollectTarget) {
+	name := target.Name()
+
+	c.mu.Lock()
+	st, ok := c.status[name]
+	if !ok || st.inFlight || c.stopCh == nil {
+		c.mu.Unlock()
+		return
+	}
+	st.inFlight = true
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.collectTimeout())
+	_, err := target.Collect(ctx)
+	cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st.inFlight = false
+	if err != nil {
+		c.log.DebugWithFields("Failed to open traffic sampling window", logger.Fields{
+			"target": name,
+			"error":  err.Error(),
+		})
+		return
+	}
+	if s, ok := c.samplers[name]; ok {
+		s.windowStart = time.Now()
+	}
+}
+
+// dropSampler 目标不再使用采样模式时清除其窗口状态
+func (c *Collector) dropSampler(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.samplers[name]; ok {
+		s.stop()
+		delete(c.samplers, name)
+	}
+}
+
+// Sampling 返回各采样模式目标的外推结果和误差范围，按名称排序
+func (c *Collector) Sampling() []*model.SamplingAccuracy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]*model.SamplingAccuracy, 0, len(c.samplers))
+	for _, s := range c.samplers {
+		accuracy := s.accuracy
+		list = append(list, &accuracy)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Target < list[j].Target
+	})
+	return list
+}
+
+// counterBytes 计数器的总字节数。用户和入站计数器统计的是同一份流量，有入站计数器时只按入站汇总
+func counterBytes(counters []IngestCounter) int64 {
+	var inbound, user int64
+	for _, counter := range counters {
+		if counter.ProtocolID != 0 {
+			inbound += counter.Upload + counter.Download
+		} else {
+			user += counter.Upload + counter.Download
+		}
+	}
+	if inbound > 0 {
+		return inbound
+	}
+	return user
+}
+
+// stddev 样本标准差
+func stddev(values []float64) float64 {
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	var sum float64
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
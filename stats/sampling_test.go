@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"v/logger"
+	"v/settings"
+)
+
+func TestCollector_ExtrapolateSampledWindow(t *testing.T) {
+	log := logger.NewLoggerWithConfig(logger.Configuration{Level: logger.ERROR})
+	c := NewCollector(log, settings.New(log), &recordingSink{})
+	start := time.Unix(1700000000, 0)
+
+	// 首次读取时计数没有被丢弃，按精确值记账
+	first := c.extrapolate("edge", 0.1, []IngestCounter{
+		{Counter: "inbound>>>inbound-1", ProtocolID: 1, Upload: 100, Download: 200},
+	}, start)
+	if first[0].Upload != 100 || first[0].Download != 200 {
+		t.Fatalf("first read = %+v, want exact counters", first[0])
+	}
+
+	// 采样窗口为 60 秒周期的最后 6 秒，计数外推 10 倍
+	c.samplers["edge"].windowStart = start.Add(54 * time.Second)
+	got := c.extrapolate("edge", 0.1, []IngestCounter{
+		{Counter: "inbound>>>inbound-1", ProtocolID: 1, Upload: 10, Download: 20},
+		{Counter: "user>>>5", UserID: 5, Upload: 10, Download: 20},
+	}, start.Add(60*time.Second))
+	for _, counter := range got {
+		if counter.Upload != 100 || counter.Download != 200 {
+			t.Errorf("extrapolated %s = %+v, want upload 100 download 200", counter.Counter, counter)
+		}
+	}
+
+	sampled := c.Sampling()
+	if len(sampled) != 1 {
+		t.Fatalf("got %d sampled targets, want 1", len(sampled))
+	}
+	acc := sampled[0]
+	// 只有一个窗口时按窗口速率（30 字节 / 6 秒）估计未计数的 54 秒：1.96 * 5 * 54 ≈ 529
+	if acc.Windows != 1 || acc.MeasuredBytes != 330 || acc.RecordedBytes != 600 || acc.ErrorBound != 529 {
+		t.Errorf("accuracy = %+v", acc)
+	}
+	if acc.ErrorPercent != 88.17 {
+		t.Errorf("error percent = %v, want 88.17", acc.ErrorPercent)
+	}
+
+	// 窗口在下一次读取后关闭，未能打开窗口的周期按精确值记账
+	exact := c.extrapolate("edge", 0.1, []IngestCounter{
+		{Counter: "inbound>>>inbound-1", ProtocolID: 1, Upload: 7, Download: 9},
+	}, start.Add(120*time.Second))
+	if exact[0].Upload != 7 || exact[0].Download != 9 {
+		t.Errorf("read without window = %+v, want exact counters", exact[0])
+	}
+}
@@ -8,10 +8,13 @@ import (
 	"sync"
 	"time"
 
+	"v/exporter"
+	"v/heartbeat"
 	"v/logger"
 	"v/model"
 	"v/notification"
 	"v/settings"
+	"v/utils"
 )
 
 // TrafficStats represents traffic statistics
@@ -39,7 +42,9 @@ type Manager struct {
 	statsPath string
 	stats     map[int64]*TrafficStats
 	mu        sync.RWMutex
-	stopChan  chan struct{}
+	stopChan  chan struct{} // 运行中时非空，停止后可以重新启动
+	exporter  *exporter.Exporter
+	heartbeat *heartbeat.Pinger
 }
 
 // StatsManager alias for compatibility with interfaces
@@ -53,7 +58,6 @@ func New(log *logger.Logger, settings *settings.Manager, notifier *notification.
 		notifier:  notifier,
 		statsPath: filepath.Join("stats"),
 		stats:     make(map[int64]*TrafficStats),
-		stopChan:  make(chan struct{}),
 	}
 }
 
@@ -63,6 +67,16 @@ func NewStatsManager(log *logger.Logger, settings *settings.Manager, notifier *n
 	return (*StatsManager)(manager)
 }
 
+// SetExporter sets the optional external traffic exporter
+func (m *Manager) SetExporter(e *exporter.Exporter) {
+	m.exporter = e
+}
+
+// SetHeartbeat sets the optional external heartbeat, pinged after each successful flush cycle
+func (m *Manager) SetHeartbeat(h *heartbeat.Pinger) {
+	m.heartbeat = h
+}
+
 // Start starts the statistics manager
 func (m *Manager) Start() error {
 	s := m.settings.Get()
@@ -74,15 +88,22 @@ func (m *Manager) Start() error {
 
 	// Load existing stats
 	if err := m.loadStats(); err != nil {
-		m.log.Error("Failed to load stats", logger.Fields{
+		m.log.ErrorWithFields("Failed to load stats", logger.Fields{
 			"error": err,
 		})
 	}
 
 	// Start stats routine
-	go m.statsRoutine()
+	m.mu.Lock()
+	if m.stopChan != nil {
+		m.mu.Unlock()
+		return nil
+	}
+	m.stopChan = make(chan struct{})
+	go m.statsRoutine(m.stopChan)
+	m.mu.Unlock()
 
-	m.log.Info("Statistics manager started", logger.Fields{
+	m.log.WithFields("Statistics manager started", logger.Fields{
 		"stats_path": m.statsPath,
 		"interval":   s.Traffic.StatsInterval,
 	})
@@ -92,7 +113,13 @@ func (m *Manager) Start() error {
 
 // Stop stops the statistics manager
 func (m *Manager) Stop() {
-	close(m.stopChan)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopChan != nil {
+		close(m.stopChan)
+		m.stopChan = nil
+	}
 }
 
 // Start starts the statistics manager (StatsManager implementation)
@@ -148,26 +175,36 @@ func (m *StatsManager) UpdateTraffic(userID int64, upload, download int64) error
 }
 
 // statsRoutine runs the statistics routine
-func (m *Manager) statsRoutine() {
+func (m *Manager) statsRoutine(stopChan chan struct{}) {
 	s := m.settings.Get()
 	ticker := time.NewTicker(s.Traffic.StatsInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-m.stopChan:
+		case <-stopChan:
 			return
 		case <-ticker.C:
-			if err := m.saveStats(); err != nil {
-				m.log.Error("Failed to save stats", logger.Fields{
+			err := m.saveStats()
+			if err != nil {
+				m.log.ErrorWithFields("Failed to save stats", logger.Fields{
 					"error": err,
 				})
 			}
 
-			if err := m.generateDailyStats(); err != nil {
-				m.log.Error("Failed to generate daily stats", logger.Fields{
-					"error": err,
+			if dailyErr := m.generateDailyStats(); dailyErr != nil {
+				m.log.ErrorWithFields("Failed to generate daily stats", logger.Fields{
+					"error": dailyErr,
 				})
+				if err == nil {
+					err = dailyErr
+				}
+			}
+
+			if err != nil {
+				m.heartbeat.Fail(heartbeat.JobStats, err)
+			} else {
+				m.heartbeat.Success(heartbeat.JobStats)
 			}
 		}
 	}
@@ -193,6 +230,11 @@ func (m *Manager) AddTraffic(userID int64, upload, download int64) error {
 	stats.Download += download
 	stats.Timestamp = time.Now()
 
+	// 导出到外部分析数据库
+	if m.exporter != nil {
+		m.exporter.RecordTraffic(userID, 0, upload, download)
+	}
+
 	return nil
 }
 
@@ -209,6 +251,19 @@ func (m *Manager) GetTraffic(userID int64) (*TrafficStats, error) {
 	return stats, nil
 }
 
+// Snapshot 返回所有用户当前累计流量的副本，调用方按两次快照的差值计算速率
+func (m *Manager) Snapshot() []*TrafficStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]*TrafficStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		c := *s
+		result = append(result, &c)
+	}
+	return result
+}
+
 // GetDailyStats returns daily traffic statistics for a user
 func (m *Manager) GetDailyStats(userID int64, start, end time.Time) ([]*DailyStats, error) {
 	statsFile := filepath.Join(m.statsPath, fmt.Sprintf("daily_%d.json", userID))
@@ -277,8 +332,9 @@ func (m *Manager) saveStats() error {
 // generateDailyStats generates daily traffic statistics
 func (m *Manager) generateDailyStats() error {
 	s := m.settings.Get()
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	// 按面板时区划分日期
+	now := time.Now().In(m.settings.Location())
+	today := utils.StartOfDay(now)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -302,7 +358,7 @@ func (m *Manager) generateDailyStats() error {
 		// Save daily stats
 		statsFile := filepath.Join(m.statsPath, fmt.Sprintf("daily_%d.json", userID))
 		if err := m.saveDailyStats(statsFile, dailyStats); err != nil {
-			m.log.Error("Failed to save daily stats", logger.Fields{
+			m.log.ErrorWithFields("Failed to save daily stats", logger.Fields{
 				"user_id": userID,
 				"error":   err,
 			})
@@ -313,7 +369,7 @@ func (m *Manager) generateDailyStats() error {
 		if dailyStats.Total > s.Traffic.DefaultLimit {
 			// Send warning notification
 			if err := m.notifier.SendTrafficWarning(userID, "", dailyStats.Total, s.Traffic.DefaultLimit); err != nil {
-				m.log.Error("Failed to send traffic warning", logger.Fields{
+				m.log.ErrorWithFields("Failed to send traffic warning", logger.Fields{
 					"user_id": userID,
 					"error":   err,
 				})
@@ -372,5 +428,8 @@ func (m *Manager) GetProtocolStats(protocolID int64, start, end time.Time) ([]*D
 func (m *Manager) UpdateProtocolTraffic(protocolID int64, upload, download int64) error {
 	// This is a stub implementation since we don't have protocol-specific stats updating yet
 	// In a real implementation, we would update protocol-specific stats in the database
+	if m.exporter != nil {
+		m.exporter.RecordTraffic(0, protocolID, upload, download)
+	}
 	return nil
 }
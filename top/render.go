@@ -0,0 +1,234 @@
+package top
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"v/api"
+)
+
+// 终端控制序列
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+)
+
+// userRate 单个用户的流量速率
+type userRate struct {
+	name     string
+	up       float64 // 字节/秒
+	down     float64
+	upload   int64 // 累计字节
+	download int64
+}
+
+// frame 一次刷新的显示数据
+type frame struct {
+	status *api.LiveStatus
+	users  []*userRate
+	up     float64 // 所有用户的上下行速率之和
+	down   float64
+	nicUp  float64 // 网卡速率
+	nicIn  float64
+	warmup bool // 第一次刷新，还没有速率
+	err    error
+}
+
+// newFrame 按两次状态的差值计算速率，计数器回退（如面板重启）时速率记为 0
+func newFrame(prev, cur *api.LiveStatus) *frame {
+	f := &frame{status: cur, warmup: prev == nil}
+
+	var elapsed float64
+	previous := make(map[int64]*api.LiveTraffic)
+	if prev != nil {
+		elapsed = cur.Time.Sub(prev.Time).Seconds()
+		for _, t := range prev.Traffic {
+			previous[t.UserID] = t
+		}
+		if elapsed > 0 && prev.System != nil && cur.System != nil {
+			f.nicUp = counterRate(prev.System.NetworkBytesSent, cur.System.NetworkBytesSent, elapsed)
+			f.nicIn = counterRate(prev.System.NetworkBytesReceived, cur.System.NetworkBytesReceived, elapsed)
+		}
+	}
+
+	for _, t := range cur.Traffic {
+		u := &userRate{name: t.Username, upload: t.Upload, download: t.Download}
+		if p, ok := previous[t.UserID]; ok && elapsed > 0 {
+			u.up = counterRate(uint64(max(p.Upload, 0)), uint64(max(t.Upload, 0)), elapsed)
+			u.down = counterRate(uint64(max(p.Download, 0)), uint64(max(t.Download, 0)), elapsed)
+		}
+		f.up += u.up
+		f.down += u.down
+		f.users = append(f.users, u)
+	}
+	return f
+}
+
+// counterRate 计算计数器的每秒增量
+func counterRate(prev, cur uint64, elapsed float64) float64 {
+	if cur < prev || elapsed <= 0 {
+		return 0
+	}
+	return float64(cur-prev) / elapsed
+}
+
+// draw 重绘整个屏幕
+func (d *Dashboard) draw() {
+	var b bytes.Buffer
+	b.WriteString(clearScreen)
+
+	state := fmt.Sprintf("每 %s 刷新", d.cfg.Interval)
+	if d.paused {
+		state = "已暂停"
+	}
+	fmt.Fprintf(&b, "v top  %s  %s  %s\n", d.cfg.URL, time.Now().Format("2006-01-02 15:04:05"), state)
+	fmt.Fprintf(&b, "[q] 退出  [p] 暂停  [s] 排序: %s  [r] 立即刷新  [+/-] 刷新间隔\n\n", d.sortBy)
+
+	f := d.last
+	if f == nil {
+		b.WriteString("连接中...\n")
+		d.flush(&b)
+		return
+	}
+	if f.err != nil {
+		fmt.Fprintf(&b, "错误: %v\n\n", f.err)
+	}
+	if f.status == nil {
+		d.flush(&b)
+		return
+	}
+	s := f.status
+
+	xrayState := "已停止"
+	if s.Xray.Running {
+		xrayState = "运行中"
+	}
+	fmt.Fprintf(&b, "Xray   %s  %s\n", xrayState, s.Xray.Version)
+
+	if sys := s.System; sys != nil {
+		fmt.Fprintf(&b, "系统   CPU %.1f%% (%d 核)  内存 %s / %s (%.1f%%)  磁盘 %.1f%%\n",
+			sys.CPUUsage, sys.CPUCount, formatBytes(float64(sys.MemoryUsed)), formatBytes(float64(sys.MemoryTotal)),
+			sys.MemoryUsage, sys.DiskUsage)
+		fmt.Fprintf(&b, "网卡   ↑ %s  ↓ %s\n", formatRate(f.nicUp), formatRate(f.nicIn))
+	} else if s.SystemError != "" {
+		fmt.Fprintf(&b, "系统   获取失败: %s\n", s.SystemError)
+	}
+
+	active := 0
+	for _, u := range f.users {
+		if u.up > 0 || u.down > 0 {
+			active++
+		}
+	}
+	fmt.Fprintf(&b, "流量   ↑ %s  ↓ %s  活跃用户 %d / %d\n\n", formatRate(f.up), formatRate(f.down), active, len(f.users))
+
+	d.drawUsers(&b, f)
+	drawAlerts(&b, s)
+	d.flush(&b)
+}
+
+// drawUsers 输出流量最高的用户
+func (d *Dashboard) drawUsers(b *bytes.Buffer, f *frame) {
+	users := append([]*userRate(nil), f.users...)
+	sort.SliceStable(users, func(i, j int) bool {
+		if d.sortBy == SortTotal {
+			return users[i].upload+users[i].download > users[j].upload+users[j].download
+		}
+		return users[i].up+users[i].down > users[j].up+users[j].down
+	})
+	if len(users) > d.cfg.Users {
+		users = users[:d.cfg.Users]
+	}
+
+	fmt.Fprintf(b, "流量最高的用户（按%s）\n", map[string]string{SortRate: "速率", SortTotal: "累计流量"}[d.sortBy])
+	if len(users) == 0 {
+		b.WriteString("  暂无流量\n\n")
+		return
+	}
+	tw := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  USER\tUP/S\tDOWN/S\tUPLOAD\tDOWNLOAD")
+	for _, u := range users {
+		up, down := formatRate(u.up), formatRate(u.down)
+		if f.warmup {
+			up, down = "-", "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", truncate(u.name, 24), up, down,
+			formatBytes(float64(u.upload)), formatBytes(float64(u.download)))
+	}
+	tw.Flush()
+	b.WriteString("\n")
+}
+
+// drawAlerts 输出最近告警
+func drawAlerts(b *bytes.Buffer, s *api.LiveStatus) {
+	b.WriteString("最近告警\n")
+	if len(s.Alerts) == 0 {
+		b.WriteString("  无\n")
+		return
+	}
+	for _, a := range s.Alerts {
+		kind := string(a.Type)
+		if a.Recovered {
+			kind += " (已恢复)"
+		}
+		fmt.Fprintf(b, "  %s  %s  %s\n", a.Timestamp.Local().Format("01-02 15:04:05"), kind, truncate(stripTags(a.Message), 80))
+	}
+}
+
+// flush 一次写出整屏，减少闪烁
+func (d *Dashboard) flush(b *bytes.Buffer) {
+	d.out.Write(b.Bytes())
+}
+
+// formatBytes 以 1024 为进制格式化字节数
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// formatRate 格式化每秒字节数
+func formatRate(n float64) string {
+	return formatBytes(n) + "/s"
+}
+
+// truncate 截断过长的文本
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// stripTags 去掉告警消息中的 HTML 标签和换行
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			if r == '\n' || r == '\r' || r == '\t' {
+				r = ' '
+			}
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package top
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cbreak 关闭终端的行缓冲和回显，按键立即可读，Ctrl+C 仍然产生信号。返回恢复终端设置的函数
+func cbreak(f *os.File) (func(), error) {
+	fd := int(f.Fd())
+	old, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Lflag &^= unix.ICANON | unix.ECHO
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() {
+		unix.IoctlSetTermios(fd, unix.TCSETS, old)
+	}, nil
+}
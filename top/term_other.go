@@ -0,0 +1,13 @@
+//go:build !linux
+
+package top
+
+import (
+	"errors"
+	"os"
+)
+
+// cbreak 当前平台不支持逐键读取，按键后需回车
+func cbreak(f *os.File) (func(), error) {
+	return nil, errors.New("single key input is only supported on linux")
+}
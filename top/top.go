@@ -0,0 +1,197 @@
+// Package top 终端实时仪表盘：通过本机面板 API 定时刷新流量速率、流量最高的用户、Xray 状态、
+// 最近告警和系统状态，供通过 SSH 管理服务器、不方便打开网页的运维人员使用
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"v/api"
+)
+
+// 用户列表的排序方式
+const (
+	SortRate  = "rate"  // 按当前上下行速率之和
+	SortTotal = "total" // 按累计流量
+)
+
+// 刷新间隔的调整范围
+const (
+	minInterval = time.Second
+	maxInterval = 10 * time.Second
+)
+
+// livePath 实时状态接口
+const livePath = "/api/dashboard/live"
+
+// Config 仪表盘参数
+type Config struct {
+	URL      string        // 面板地址，设置了访问路径时需包含，如 http://127.0.0.1:8080/k3x9q2m7
+	Token    string        // 管理员令牌
+	Interval time.Duration // 刷新间隔，默认 1 秒
+	Users    int           // 显示的用户数，默认 10
+	Timeout  time.Duration // 单次请求超时，默认 5 秒
+}
+
+// Dashboard 终端仪表盘
+type Dashboard struct {
+	cfg    Config
+	client *http.Client
+	out    io.Writer
+
+	prev   *api.LiveStatus
+	last   *frame
+	sortBy string
+	paused bool
+}
+
+// New 创建仪表盘，输出写入 out
+func New(cfg Config, out io.Writer) *Dashboard {
+	if cfg.Interval < minInterval {
+		cfg.Interval = minInterval
+	}
+	if cfg.Users <= 0 {
+		cfg.Users = 10
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &Dashboard{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		out:    out,
+		sortBy: SortRate,
+	}
+}
+
+// Run 持续刷新直到 ctx 取消或按下 q。in 为终端时切换为逐键读取，否则按键后需回车
+func (d *Dashboard) Run(ctx context.Context, in *os.File) error {
+	if restore, err := cbreak(in); err == nil {
+		defer restore()
+	}
+	keys := make(chan byte)
+	go readKeys(in, keys)
+
+	fmt.Fprint(d.out, hideCursor)
+	defer fmt.Fprint(d.out, showCursor+"\n")
+
+	d.refresh(ctx)
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if !d.paused {
+				d.refresh(ctx)
+			}
+		case key, ok := <-keys:
+			if !ok {
+				// 输入已关闭（如重定向自 /dev/null），只能通过信号退出
+				keys = nil
+				continue
+			}
+			switch key {
+			case 'q', 'Q':
+				return nil
+			case 'p', 'P', ' ':
+				d.paused = !d.paused
+			case 's', 'S':
+				if d.sortBy == SortRate {
+					d.sortBy = SortTotal
+				} else {
+					d.sortBy = SortRate
+				}
+			case 'r', 'R':
+				d.refresh(ctx)
+				continue
+			case '+', '=':
+				d.setInterval(ticker, d.cfg.Interval+time.Second)
+			case '-', '_':
+				d.setInterval(ticker, d.cfg.Interval-time.Second)
+			default:
+				continue
+			}
+			d.draw()
+		}
+	}
+}
+
+// setInterval 调整刷新间隔
+func (d *Dashboard) setInterval(ticker *time.Ticker, interval time.Duration) {
+	d.cfg.Interval = min(max(interval, minInterval), maxInterval)
+	ticker.Reset(d.cfg.Interval)
+}
+
+// refresh 拉取最新状态并重绘
+func (d *Dashboard) refresh(ctx context.Context) {
+	status, err := d.fetch(ctx)
+	if err != nil {
+		f := &frame{err: err}
+		if d.last != nil {
+			// 保留上次的数据，只提示错误
+			f = &frame{err: err, status: d.last.status, users: d.last.users, up: d.last.up, down: d.last.down}
+		}
+		d.last = f
+		d.draw()
+		return
+	}
+	d.last = newFrame(d.prev, status)
+	d.prev = status
+	d.draw()
+}
+
+// fetch 请求实时状态接口
+func (d *Dashboard) fetch(ctx context.Context) (*api.LiveStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.cfg.URL+livePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.cfg.Token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Success bool            `json:"success"`
+		Message string          `json:"message"`
+		Error   string          `json:"error"`
+		Data    *api.LiveStatus `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("unexpected response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Data == nil {
+		msg := body.Error
+		if msg == "" {
+			msg = body.Message
+		}
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg)
+	}
+	return body.Data, nil
+}
+
+// readKeys 逐字节读取输入，读取失败时关闭通道
+func readKeys(in io.Reader, keys chan<- byte) {
+	defer close(keys)
+	buf := make([]byte, 1)
+	for {
+		if _, err := in.Read(buf); err != nil {
+			return
+		}
+		keys <- buf[0]
+	}
+}
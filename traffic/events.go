@@ -0,0 +1,34 @@
+package traffic
+
+import (
+	"sync"
+
+	"v/model"
+)
+
+// QuotaListener 用户总流量超过限制后的回调，used 为已用流量（字节）。回调同步调用，耗时操作应放到后台
+type QuotaListener func(user *model.User, used int64)
+
+// quotaListeners 全局的超限回调，面板中可能存在多个 Manager 实例
+var quotaListeners struct {
+	sync.RWMutex
+	fns []QuotaListener
+}
+
+// OnQuotaExceeded 注册用户总流量超限的回调。同一用户在流量限制调整或用量回落前只触发一次
+func OnQuotaExceeded(fn QuotaListener) {
+	quotaListeners.Lock()
+	defer quotaListeners.Unlock()
+	quotaListeners.fns = append(quotaListeners.fns, fn)
+}
+
+// notifyQuotaExceeded 通知所有回调
+func notifyQuotaExceeded(user *model.User, used int64) {
+	quotaListeners.RLock()
+	fns := quotaListeners.fns
+	quotaListeners.RUnlock()
+
+	for _, fn := range fns {
+		fn(user, used)
+	}
+}
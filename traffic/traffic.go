@@ -21,6 +21,7 @@ type Manager struct {
 	stop       chan struct{}
 	wg         sync.WaitGroup
 	notifier   notification.Notifier
+	exceeded   sync.Map // map[int64]bool 已超过总流量限制的用户，恢复前不重复触发回调
 }
 
 // New 创建流量统计管理器
@@ -365,6 +366,7 @@ func (m *Manager) CheckUserTrafficLimit(userID int64) error {
 
 	// 如果没有设置流量限制，直接返回
 	if user.TrafficLimit <= 0 {
+		m.exceeded.Delete(userID)
 		return nil
 	}
 
@@ -387,6 +389,10 @@ func (m *Manager) CheckUserTrafficLimit(userID int64) error {
 
 	// 检查是否超出限制
 	if totalUsed >= user.TrafficLimit {
+		if _, ok := m.exceeded.LoadOrStore(userID, true); !ok {
+			notifyQuotaExceeded(user, totalUsed)
+		}
+
 		// 禁用所有协议
 		protocols, err := m.db.GetProtocolsByUserID(userID)
 		if err != nil {
@@ -421,6 +427,8 @@ func (m *Manager) CheckUserTrafficLimit(userID int64) error {
 		return model.ErrTrafficLimitExceeded
 	}
 
+	m.exceeded.Delete(userID)
+
 	// 检查警告阈值
 	warningThreshold := float64(user.TrafficLimit) * 0.8 // 80%警告阈值
 	if float64(totalUsed) >= warningThreshold {
@@ -330,10 +330,29 @@ func (m *Manager) List(page, pageSize int) ([]*model.User, error) {
 	return m.db.ListUsers((page-1)*pageSize, pageSize)
 }
 
-// Search searches for users
-func (m *Manager) Search(query string, page, pageSize int) ([]*model.User, error) {
-	// TODO: Implement search functionality
-	return m.db.ListUsers((page-1)*pageSize, pageSize)
+// Search searches users by username, email, remark, role and status, ranked by
+// relevance with match positions for highlighting. Returns the page and the total count.
+func (m *Manager) Search(query string, page, pageSize int) ([]*model.UserSearchResult, int, error) {
+	users, err := m.db.SearchUsers(query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := model.RankUsers(model.SearchTerms(query), users)
+	total := len(results)
+
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * pageSize
+	if pageSize <= 0 || start >= total {
+		return []*model.UserSearchResult{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return results[start:end], total, nil
 }
 
 // validateInput validates user input
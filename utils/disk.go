@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// DefaultMinFreeDiskMB 未配置时要求保留的最小可用磁盘空间（MB）
+const DefaultMinFreeDiskMB = 200
+
+// ErrInsufficientDiskSpace 磁盘可用空间不足
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// MinFreeDiskBytes 将配置的 MB 数转换为字节，0 表示使用默认值，负数表示不检查
+func MinFreeDiskBytes(mb int64) uint64 {
+	if mb < 0 {
+		return 0
+	}
+	if mb == 0 {
+		mb = DefaultMinFreeDiskMB
+	}
+	return uint64(mb) * 1024 * 1024
+}
+
+// FreeDiskSpace 返回路径所在磁盘的可用空间（字节），路径不存在时使用最近的已存在父目录
+func FreeDiskSpace(path string) (uint64, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	usage, err := disk.Usage(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get disk usage for %s: %v", dir, err)
+	}
+
+	return usage.Free, nil
+}
+
+// CheckDiskSpace 检查写入 required 字节后可用空间是否仍不低于 minFree 字节
+func CheckDiskSpace(path string, required, minFree uint64) error {
+	if minFree == 0 && required == 0 {
+		return nil
+	}
+
+	free, err := FreeDiskSpace(path)
+	if err != nil {
+		return err
+	}
+
+	if free < required+minFree {
+		return fmt.Errorf("%w: %s has %s free, need %s plus %s reserved",
+			ErrInsufficientDiskSpace, path, FormatBytes(free), FormatBytes(required), FormatBytes(minFree))
+	}
+
+	return nil
+}
+
+// DirSize 统计目录下所有文件的总大小和文件数，路径为文件时返回文件大小，不存在时返回 0
+func DirSize(path string) (int64, int, error) {
+	var size int64
+	var files int
+	err := filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		size += info.Size()
+		files++
+		return nil
+	})
+	return size, files, err
+}
+
+// FormatBytes 格式化字节数
+func FormatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
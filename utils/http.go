@@ -19,8 +19,8 @@ func WriteError(w http.ResponseWriter, status int, message string) {
 }
 
 // GetUserIDFromContext gets user ID from context
-func GetUserIDFromContext(ctx context.Context) uint {
-	if id, ok := ctx.Value("user_id").(uint); ok {
+func GetUserIDFromContext(ctx context.Context) int64 {
+	if id, ok := ctx.Value("user_id").(int64); ok {
 		return id
 	}
 	return 0
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// KeyFileMode 私钥文件权限
+const KeyFileMode os.FileMode = 0600
+
+// ErrKeyFileInsecure 私钥文件可被其他用户读取
+var ErrKeyFileInsecure = errors.New("private key file is readable by other users")
+
+// KeyFileStatus 私钥文件权限检查结果
+type KeyFileStatus struct {
+	Path          string `json:"path"`
+	Mode          string `json:"mode"`
+	UID           int    `json:"uid"`
+	GID           int    `json:"gid"`
+	WorldReadable bool   `json:"world_readable"`
+	GroupReadable bool   `json:"group_readable"`
+	OwnerMismatch bool   `json:"owner_mismatch"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Secure 权限和所有者都符合要求
+func (s *KeyFileStatus) Secure() bool {
+	return s.Error == "" && !s.WorldReadable && !s.GroupReadable && !s.OwnerMismatch
+}
+
+// WriteKeyFile 写入私钥文件，强制 0600 权限并归属面板运行用户。
+// 已存在的文件在截断写入时不会改变权限，因此写入后再次设置
+func WriteKeyFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, KeyFileMode); err != nil {
+		return fmt.Errorf("failed to write private key: %v", err)
+	}
+	return SecureKeyFile(path)
+}
+
+// SecureKeyFile 将私钥文件权限设置为 0600 并归属面板运行用户
+func SecureKeyFile(path string) error {
+	if err := os.Chmod(path, KeyFileMode); err != nil {
+		return fmt.Errorf("failed to set private key permissions: %v", err)
+	}
+	if err := chownToCurrentUser(path); err != nil {
+		return fmt.Errorf("failed to set private key owner: %v", err)
+	}
+	return nil
+}
+
+// CheckKeyFile 检查私钥文件的权限和所有者
+func CheckKeyFile(path string) *KeyFileStatus {
+	status := &KeyFileStatus{Path: path, UID: -1, GID: -1}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	mode := info.Mode().Perm()
+	status.Mode = fmt.Sprintf("%04o", mode)
+	if permissionBitsSupported {
+		status.WorldReadable = mode&0004 != 0
+		status.GroupReadable = mode&0040 != 0
+	}
+
+	if uid, gid, ok := fileOwner(info); ok {
+		status.UID, status.GID = uid, gid
+		status.OwnerMismatch = uid != os.Getuid()
+	}
+
+	return status
+}
+
+// VerifyKeyFile 检查私钥文件是否可被其他用户读取，可读时返回 ErrKeyFileInsecure
+func VerifyKeyFile(path string) error {
+	status := CheckKeyFile(path)
+	if status.Error != "" {
+		return fmt.Errorf("failed to check private key %s: %s", path, status.Error)
+	}
+	if status.WorldReadable {
+		return fmt.Errorf("%w: %s (mode %s)", ErrKeyFileInsecure, path, status.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// permissionBitsSupported 当前平台是否使用 Unix 权限位
+const permissionBitsSupported = true
+
+// fileOwner 返回文件的 uid 和 gid
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// chownToCurrentUser 将文件所有者改为当前用户，已是当前用户时不做修改
+func chownToCurrentUser(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	uid, gid, ok := fileOwner(info)
+	if ok && uid == os.Getuid() && gid == os.Getgid() {
+		return nil
+	}
+	return os.Chown(path, os.Getuid(), os.Getgid())
+}
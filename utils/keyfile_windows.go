@@ -0,0 +1,18 @@
+//go:build windows
+
+package utils
+
+import "os"
+
+// permissionBitsSupported Windows 使用 ACL，不检查权限位
+const permissionBitsSupported = false
+
+// fileOwner Windows 不支持 uid/gid
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
+
+// chownToCurrentUser Windows 下新建文件默认归属当前用户
+func chownToCurrentUser(path string) error {
+	return nil
+}
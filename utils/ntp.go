@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultNTPServers 未配置时使用的 NTP 服务器
+var DefaultNTPServers = []string{"pool.ntp.org", "time.cloudflare.com", "time.google.com"}
+
+// ntpEpochOffset NTP 纪元（1900 年）与 Unix 纪元之间的秒数
+const ntpEpochOffset = 2208988800
+
+// ClockOffset 本机时钟与 NTP 服务器的偏差，Offset 为正表示本机时钟落后
+type ClockOffset struct {
+	Server    string        `json:"server"`
+	Offset    time.Duration `json:"offset"`
+	RTT       time.Duration `json:"rtt"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// Skew 返回偏差的绝对值
+func (o *ClockOffset) Skew() time.Duration {
+	if o.Offset < 0 {
+		return -o.Offset
+	}
+	return o.Offset
+}
+
+// QueryNTP 向 NTP 服务器发送一次 SNTP 请求并计算本机时钟偏差
+func QueryNTP(server string, timeout time.Duration) (*ClockOffset, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ntp server %s: %v", server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// LI = 0, VN = 4, Mode = 3 (client)
+	req := make([]byte, 48)
+	req[0] = 0x23
+	t1 := time.Now()
+	putNTPTime(req[40:], t1)
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("failed to send ntp request to %s: %v", server, err)
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ntp response from %s: %v", server, err)
+	}
+	if n < 48 {
+		return nil, fmt.Errorf("short ntp response from %s", server)
+	}
+	if mode := resp[0] & 0x07; mode != 4 {
+		return nil, fmt.Errorf("unexpected ntp mode %d from %s", mode, server)
+	}
+	if stratum := resp[1]; stratum == 0 || stratum > 15 {
+		return nil, fmt.Errorf("ntp server %s is unsynchronized (stratum %d)", server, stratum)
+	}
+
+	t2 := ntpTime(resp[32:])
+	t3 := ntpTime(resp[40:])
+
+	// offset = ((T2 - T1) + (T3 - T4)) / 2, rtt = (T4 - T1) - (T3 - T2)
+	return &ClockOffset{
+		Server:    server,
+		Offset:    (t2.Sub(t1) + t3.Sub(t4)) / 2,
+		RTT:       t4.Sub(t1) - t3.Sub(t2),
+		CheckedAt: t4,
+	}, nil
+}
+
+// CheckClockSkew 依次查询 NTP 服务器，返回第一个成功的结果
+func CheckClockSkew(servers []string, timeout time.Duration) (*ClockOffset, error) {
+	if len(servers) == 0 {
+		servers = DefaultNTPServers
+	}
+
+	var errs []error
+	for _, server := range servers {
+		offset, err := QueryNTP(server, timeout)
+		if err == nil {
+			return offset, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// ntpTime 解析 64 位 NTP 时间戳
+func ntpTime(b []byte) time.Time {
+	sec := binary.BigEndian.Uint32(b[0:4])
+	frac := binary.BigEndian.Uint32(b[4:8])
+	nsec := (int64(frac) * 1e9) >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, nsec)
+}
+
+// putNTPTime 写入 64 位 NTP 时间戳
+func putNTPTime(b []byte, t time.Time) {
+	sec := uint32(t.Unix() + ntpEpochOffset)
+	frac := uint32((int64(t.Nanosecond()) << 32) / 1e9)
+	binary.BigEndian.PutUint32(b[0:4], sec)
+	binary.BigEndian.PutUint32(b[4:8], frac)
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseClock 解析 HH:MM 格式的时刻
+func ParseClock(clock string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q, expected HH:MM", clock)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// NextDailyRun 返回 now 之后下一次到达 clock（HH:MM）的时间，按 now 所在时区计算
+func NextDailyRun(now time.Time, clock string) (time.Time, error) {
+	hour, minute, err := ParseClock(clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, now.Location())
+	}
+	return next, nil
+}
+
+// StartOfDay 返回 t 所在时区当天的零点
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -1,4 +1,74 @@
 package version
 
-// Version 是当前程序的版本
-const Version = "1.0.0"
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// 构建信息，发布时通过 -ldflags "-X v/version.Commit=... -X v/version.BuildDate=..." 注入，
+// 未注入时使用 Go 工具链写入的 VCS 信息
+var (
+	// Version 是当前程序的版本
+	Version = "1.0.0"
+	// Commit 构建时的 git 提交
+	Commit = ""
+	// BuildDate 构建时间，RFC 3339 格式
+	BuildDate = ""
+)
+
+// Info 程序的构建信息
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Modified  bool   `json:"modified"` // 构建时工作区有未提交的修改
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// Get 返回构建信息，提交和构建时间未知时为 unknown
+func Get() *Info {
+	info := &Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	} else if t, err := time.Parse(time.RFC3339, info.BuildDate); err == nil {
+		info.BuildDate = t.UTC().Format(time.RFC3339)
+	}
+	return info
+}
+
+// ShortCommit 返回提交的前 12 位
+func (i *Info) ShortCommit() string {
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
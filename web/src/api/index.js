@@ -208,6 +208,12 @@ export const statsApi = {
   getDetailedStats: (params) => api.get('/stats/detailed', { params })
 }
 
+// Reports API
+export const reportsApi = {
+  getTopTalkers: (params) => api.get('/reports/top-talkers', { params }),
+  getCountryStats: (params) => api.get('/reports/countries', { params })
+}
+
 // Monitor API
 export const monitorApi = {
   getSystemStats: () => api.get('/monitor/system'),
@@ -13,17 +13,43 @@ class XrayEventSource {
     this.reconnecting = false;
   }
 
+  /**
+   * 获取SSE短期令牌，EventSource无法设置Authorization请求头，令牌通过查询参数传递
+   */
+  async fetchStreamToken() {
+    const token = localStorage.getItem('token');
+    if (!token) {
+      return null;
+    }
+    const response = await fetch('/api/sse/token', {
+      method: 'POST',
+      headers: {
+        'Authorization': `Bearer ${token}`
+      }
+    });
+    if (!response.ok) {
+      return null;
+    }
+    const data = await response.json();
+    return data.token;
+  }
+
   /**
    * 初始化SSE连接
    */
-  init() {
+  async init() {
     if (this.eventSource) {
       // 如果已经连接，先关闭之前的连接
       this.close();
     }
 
     try {
-      this.eventSource = new EventSource('/api/sse/xray-events');
+      const streamToken = await this.fetchStreamToken();
+      if (!streamToken) {
+        console.log('XrayEventSource: Not logged in, skipping SSE connection');
+        return;
+      }
+      this.eventSource = new EventSource(`/api/sse/xray-events?token=${encodeURIComponent(streamToken)}`);
 
       // 添加事件监听器
       this.eventSource.addEventListener('connected', this.handleConnected.bind(this));
@@ -20,7 +20,7 @@ export default defineConfig({
     },
     proxy: {
       '/api': {
-        target: 'http://127.0.0.1:9000',
+        target: 'http://127.0.0.1:8080',
         changeOrigin: true,
         secure: false,
         ws: true,
@@ -0,0 +1,89 @@
+package xray
+
+import (
+	"strings"
+)
+
+// AccessEntry xray 访问日志中的一条连接记录
+type AccessEntry struct {
+	Source     string // 客户端地址，如 1.2.3.4:51234
+	Target     string // 目标地址，如 tcp:example.com:443
+	InboundTag string // 入站标签，面板生成的入站为 inbound-<ID>
+	Email      string // 客户端标识，未配置时为空
+}
+
+// accessLogTarget 返回配置中的访问日志位置。开启流量导出时输出到标准输出，
+// 由输出采集逐行解析连接事件，否则关闭访问日志
+func accessLogTarget(export bool) string {
+	if export {
+		return ""
+	}
+	return "none"
+}
+
+// SetAccessObserver 设置访问日志回调，每条已接受的连接调用一次。回调在输出采集中同步调用，应尽快返回
+func (m *Manager) SetAccessObserver(fn func(AccessEntry)) {
+	m.accessObserver.Store(&fn)
+}
+
+// ParseAccessLine 解析一行访问日志，不是已接受的连接时返回 false。支持两种格式：
+//
+//	2024/01/02 15:04:05 1.2.3.4:51234 accepted tcp:example.com:443 [inbound-3 -> direct] email: a@example.com
+//	2024/01/02 15:04:05.123456 from 1.2.3.4:51234 accepted tcp:example.com:443 [inbound-3 >> direct]
+func ParseAccessLine(line string) (AccessEntry, bool) {
+	fields := strings.Fields(line)
+	i := indexOf(fields, "accepted")
+	if i < 1 || i+1 >= len(fields) {
+		return AccessEntry{}, false
+	}
+
+	entry := AccessEntry{
+		Source: trimNetwork(fields[i-1]),
+		Target: fields[i+1],
+	}
+	if route, ok := between(line, "[", "]"); ok {
+		for _, sep := range []string{" -> ", " >> "} {
+			if tag, _, found := strings.Cut(route, sep); found {
+				route = tag
+				break
+			}
+		}
+		entry.InboundTag = strings.TrimSpace(route)
+	}
+	if _, email, ok := strings.Cut(line, "email: "); ok {
+		entry.Email = strings.TrimSpace(email)
+	}
+	return entry, true
+}
+
+// trimNetwork 去掉地址前的 tcp: 或 udp:
+func trimNetwork(addr string) string {
+	for _, prefix := range []string{"tcp:", "udp:"} {
+		addr = strings.TrimPrefix(addr, prefix)
+	}
+	return addr
+}
+
+// indexOf 返回字段在切片中的位置，不存在时返回 -1
+func indexOf(fields []string, s string) int {
+	for i, f := range fields {
+		if f == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// between 返回 open 和之后第一个 close 之间的内容
+func between(s, open, close string) (string, bool) {
+	start := strings.Index(s, open)
+	if start < 0 {
+		return "", false
+	}
+	rest := s[start+len(open):]
+	end := strings.Index(rest, close)
+	if end < 0 {
+		return "", false
+	}
+	return rest[:end], true
+}
@@ -0,0 +1,311 @@
+package xray
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"v/logger"
+)
+
+// externalStopTimeout 接管时等待外部 xray 退出的最长时间
+const externalStopTimeout = 10 * time.Second
+
+// defaultExternalConfig 官方安装脚本使用的默认配置文件
+const defaultExternalConfig = "/usr/local/etc/xray/config.json"
+
+// ErrExternalNotFound 指定的外部 xray 进程不存在
+var ErrExternalNotFound = errors.New("external xray process not found")
+
+// processInfo 系统中运行的 xray 进程
+type processInfo struct {
+	PID  int
+	Exe  string
+	Args []string
+	Unit string
+}
+
+// ExternalInstance 不由面板启动的 xray 实例，例如通过安装脚本或 systemd 运行的 xray
+type ExternalInstance struct {
+	PID         int                      `json:"pid"`
+	Executable  string                   `json:"executable"`
+	Args        []string                 `json:"args"`
+	Unit        string                   `json:"unit,omitempty"` // 所属的 systemd 服务
+	ConfigPaths []string                 `json:"config_paths"`
+	Inbounds    []map[string]interface{} `json:"inbounds"`
+	ConfigError string                   `json:"config_error,omitempty"`
+}
+
+// AdoptResult 接管外部 xray 的结果
+type AdoptResult struct {
+	Merged  []string `json:"merged"`            // 合并到面板配置的入站
+	Skipped []string `json:"skipped"`           // 因标签或端口已存在而跳过的入站
+	Stopped bool     `json:"stopped"`           // 外部 xray 已停止
+	Started bool     `json:"started"`           // 面板的 xray 已启动
+	Message string   `json:"message,omitempty"` // 需要手动处理的事项
+}
+
+// DetectExternal 查找系统中不由面板启动的 xray 进程，并读取其配置中的入站
+func (m *Manager) DetectExternal() ([]*ExternalInstance, error) {
+	procs, err := listXrayProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %v", err)
+	}
+
+	ownPID := 0
+	m.mutex.Lock()
+	if m.process != nil {
+		ownPID = m.process.Pid
+	}
+	m.mutex.Unlock()
+
+	instances := make([]*ExternalInstance, 0, len(procs))
+	for _, p := range procs {
+		if p.PID == ownPID || p.PID == os.Getpid() {
+			continue
+		}
+		inst := &ExternalInstance{
+			PID:         p.PID,
+			Executable:  p.Exe,
+			Args:        p.Args,
+			Unit:        p.Unit,
+			ConfigPaths: externalConfigPaths(p.Args),
+			Inbounds:    []map[string]interface{}{},
+		}
+		if len(inst.ConfigPaths) == 0 {
+			inst.ConfigError = "无法确定配置文件路径"
+		}
+		for _, path := range inst.ConfigPaths {
+			config, err := readConfigFile(path)
+			if err != nil {
+				inst.ConfigError = err.Error()
+				continue
+			}
+			inbounds, _ := config["inbounds"].([]interface{})
+			for _, item := range inbounds {
+				if inbound, ok := item.(map[string]interface{}); ok {
+					inst.Inbounds = append(inst.Inbounds, inbound)
+				}
+			}
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// AdoptExternal 将外部 xray 的入站合并到面板配置，takeOver 为 true 时停止外部 xray
+// （有 systemd 服务时同时禁用开机启动）并启动面板管理的 xray。
+// 面板使用自定义配置时不修改配置文件，只停止外部进程
+func (m *Manager) AdoptExternal(pid int, takeOver bool) (*AdoptResult, error) {
+	instances, err := m.DetectExternal()
+	if err != nil {
+		return nil, err
+	}
+	var inst *ExternalInstance
+	for _, candidate := range instances {
+		if candidate.PID == pid {
+			inst = candidate
+			break
+		}
+	}
+	if inst == nil {
+		return nil, ErrExternalNotFound
+	}
+
+	result := &AdoptResult{Merged: []string{}, Skipped: []string{}}
+	if s := m.settings.Get().Xray; s.CustomConfig && s.ConfigPath != "" {
+		result.Message = "当前使用自定义配置，请手动将外部入站合并到配置文件"
+	} else if err := m.mergeInbounds(inst.Inbounds, result); err != nil {
+		return nil, err
+	}
+
+	m.log.WithFields("Adopting external Xray", logger.Fields{
+		"pid":       inst.PID,
+		"unit":      inst.Unit,
+		"merged":    len(result.Merged),
+		"skipped":   len(result.Skipped),
+		"take_over": takeOver,
+	})
+
+	if !takeOver {
+		return result, nil
+	}
+
+	if err := stopExternal(inst); err != nil {
+		return result, err
+	}
+	result.Stopped = true
+
+	if m.IsRunning() {
+		if err := m.Stop(); err != nil {
+			return result, fmt.Errorf("failed to stop xray: %v", err)
+		}
+	}
+	if err := m.Start(); err != nil {
+		return result, fmt.Errorf("external xray stopped but failed to start xray: %v", err)
+	}
+	result.Started = true
+	return result, nil
+}
+
+// mergeInbounds 将入站追加到面板生成的配置中，标签或端口已存在的入站跳过
+func (m *Manager) mergeInbounds(inbounds []map[string]interface{}, result *AdoptResult) error {
+	configPath := m.GetConfigPath()
+	var config map[string]interface{}
+	var err error
+	if _, statErr := os.Stat(configPath); os.IsNotExist(statErr) {
+		config, err = m.GenerateConfig()
+	} else {
+		config, err = readConfigFile(configPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	existing, _ := config["inbounds"].([]interface{})
+	tags := make(map[string]bool)
+	ports := make(map[int]bool)
+	for _, item := range existing {
+		if inbound, ok := item.(map[string]interface{}); ok {
+			tag, _ := inbound["tag"].(string)
+			tags[tag] = true
+			ports[inboundPort(inbound)] = true
+		}
+	}
+
+	for _, inbound := range inbounds {
+		tag, _ := inbound["tag"].(string)
+		port := inboundPort(inbound)
+		name := tag
+		if name == "" {
+			name = fmt.Sprintf("port %d", port)
+		}
+		if tag == "api" || (tag != "" && tags[tag]) || ports[port] {
+			result.Skipped = append(result.Skipped, name)
+			continue
+		}
+		existing = append(existing, inbound)
+		tags[tag] = true
+		ports[port] = true
+		result.Merged = append(result.Merged, name)
+	}
+	if len(result.Merged) == 0 {
+		return nil
+	}
+
+	config["inbounds"] = existing
+	return writeConfigFile(configPath, config)
+}
+
+// stopExternal 停止外部 xray。由 systemd 管理时停止并禁用服务，避免重启后再次与面板争用端口
+func stopExternal(inst *ExternalInstance) error {
+	if inst.Unit != "" && runtime.GOOS == "linux" {
+		if out, err := exec.Command("systemctl", "disable", "--now", inst.Unit).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to stop %s: %v: %s", inst.Unit, err, strings.TrimSpace(string(out)))
+		}
+	} else if runtime.GOOS == "windows" {
+		if out, err := exec.Command("taskkill", "/F", "/PID", fmt.Sprint(inst.PID)).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to stop process %d: %v: %s", inst.PID, err, strings.TrimSpace(string(out)))
+		}
+	} else {
+		process, err := os.FindProcess(inst.PID)
+		if err != nil {
+			return fmt.Errorf("failed to find process %d: %v", inst.PID, err)
+		}
+		if err := process.Signal(os.Interrupt); err != nil {
+			return fmt.Errorf("failed to stop process %d: %v", inst.PID, err)
+		}
+	}
+
+	deadline := time.Now().Add(externalStopTimeout)
+	for processExists(inst.PID) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("external xray (pid %d) did not exit within %s", inst.PID, externalStopTimeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return nil
+}
+
+// externalConfigPaths 从命令行参数中解析配置文件，支持 -c/-config 和 -confdir，
+// 未指定时使用 XRAY_LOCATION_CONFIG 或安装脚本的默认路径
+func externalConfigPaths(args []string) []string {
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		switch name {
+		case "c", "config":
+			paths = append(paths, value)
+		case "confdir":
+			matches, _ := filepath.Glob(filepath.Join(value, "*.json"))
+			sort.Strings(matches)
+			paths = append(paths, matches...)
+		default:
+			continue
+		}
+		if !hasValue {
+			i++
+		}
+	}
+	if len(paths) > 0 {
+		return paths
+	}
+
+	if dir := os.Getenv("XRAY_LOCATION_CONFDIR"); dir != "" {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		sort.Strings(matches)
+		return matches
+	}
+	if path := os.Getenv("XRAY_LOCATION_CONFIG"); path != "" {
+		return []string{path}
+	}
+	if _, err := os.Stat(defaultExternalConfig); err == nil {
+		return []string{defaultExternalConfig}
+	}
+	return nil
+}
+
+// isXrayExecutable 判断可执行文件名是否为 xray
+func isXrayExecutable(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	return name == "xray" || name == "xray.exe"
+}
+
+// splitCommandLine 按空白拆分命令行，双引号中的空白不拆分
+func splitCommandLine(line string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes, hasArg := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package xray
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listXrayProcesses 在 /proc 中查找 xray 进程，并从 cgroup 中读取所属的 systemd 单元
+func listXrayProcesses() ([]*processInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []*processInfo
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		exe, err := os.Readlink(filepath.Join(dir, "exe"))
+		if err != nil {
+			exe = args[0]
+		}
+		if !isXrayExecutable(exe) && !isXrayExecutable(args[0]) {
+			continue
+		}
+		procs = append(procs, &processInfo{
+			PID:  pid,
+			Exe:  exe,
+			Args: args[1:],
+			Unit: systemdUnit(filepath.Join(dir, "cgroup")),
+		})
+	}
+	return procs, nil
+}
+
+// systemdUnit 从进程的 cgroup 路径中读取 systemd 服务名，如 xray.service
+func systemdUnit(cgroupPath string) string {
+	f, err := os.Open(cgroupPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, part := range strings.Split(scanner.Text(), "/") {
+			if strings.HasSuffix(part, ".service") {
+				return part
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+//go:build !linux && !windows
+
+package xray
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// listXrayProcesses 通过 ps 查找 xray 进程，不识别 launchd 等服务管理器
+func listXrayProcesses() ([]*processInfo, error) {
+	out, err := exec.Command("ps", "-axo", "pid=,args=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ps: %v", err)
+	}
+
+	var procs []*processInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		args := splitCommandLine(fields[1])
+		if len(args) == 0 || !isXrayExecutable(args[0]) {
+			continue
+		}
+		procs = append(procs, &processInfo{
+			PID:  pid,
+			Exe:  args[0],
+			Args: args[1:],
+		})
+	}
+	return procs, nil
+}
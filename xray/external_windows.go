@@ -0,0 +1,41 @@
+//go:build windows
+
+package xray
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// listXrayProcesses 通过 PowerShell 查询 xray.exe 进程及其命令行，Windows 上不识别服务
+func listXrayProcesses() ([]*processInfo, error) {
+	script := `Get-CimInstance Win32_Process -Filter "Name='xray.exe'" | ForEach-Object { "$($_.ProcessId)` + "`t" + `$($_.CommandLine)" }`
+	out, err := exec.Command("powershell", "-NoProfile", "-Command", script).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query processes: %v", err)
+	}
+
+	var procs []*processInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		args := splitCommandLine(fields[1])
+		if len(args) == 0 {
+			continue
+		}
+		procs = append(procs, &processInfo{
+			PID:  pid,
+			Exe:  args[0],
+			Args: args[1:],
+		})
+	}
+	return procs, nil
+}
@@ -0,0 +1,49 @@
+package xray
+
+import (
+	"v/settings"
+)
+
+// IO 调度类别
+const (
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle"
+)
+
+// ResourceLimits xray 进程的资源限制
+type ResourceLimits struct {
+	CPU         float64 // 可使用的 CPU 核数
+	MemoryBytes uint64  // 内存上限
+	Nice        int     // 进程优先级
+	IOClass     string  // IO 调度类别
+	IOPriority  int     // IO 优先级
+}
+
+// resourceLimitsFromSettings 从设置中读取资源限制
+func resourceLimitsFromSettings(s settings.XraySettings) ResourceLimits {
+	limits := ResourceLimits{
+		CPU:        s.CPULimit,
+		Nice:       s.Nice,
+		IOClass:    s.IOClass,
+		IOPriority: s.IOPriority,
+	}
+	if s.MemoryLimitMB > 0 {
+		limits.MemoryBytes = uint64(s.MemoryLimitMB) * 1024 * 1024
+	}
+	if limits.Nice < -20 {
+		limits.Nice = -20
+	} else if limits.Nice > 19 {
+		limits.Nice = 19
+	}
+	if limits.IOPriority < 0 {
+		limits.IOPriority = 0
+	} else if limits.IOPriority > 7 {
+		limits.IOPriority = 7
+	}
+	return limits
+}
+
+// Enabled 是否配置了任何限制
+func (l ResourceLimits) Enabled() bool {
+	return l.CPU > 0 || l.MemoryBytes > 0 || l.Nice != 0 || l.IOClass != ""
+}
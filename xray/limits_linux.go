@@ -0,0 +1,283 @@
+//go:build linux
+
+package xray
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// cgroupRoot cgroup v2 挂载点
+	cgroupRoot = "/sys/fs/cgroup"
+	// cgroupName xray 进程所在的 cgroup，创建在面板自身的 cgroup 下
+	cgroupName = "v-xray"
+	// cpuPeriod cpu.max 的统计周期（微秒）
+	cpuPeriod = 100000
+
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+// preparedLimits 启动前创建并写入限制的 cgroup
+type preparedLimits struct {
+	dir    string // cgroup 目录
+	fd     int    // 传给 CLONE_INTO_CGROUP 的目录句柄，-1 表示未使用
+	joined bool   // 进程已直接在 cgroup 中创建
+}
+
+// prepareResourceLimits 在启动前创建 cgroup 并写入 CPU 和内存限制，通过 CLONE_INTO_CGROUP
+// 让进程直接在 cgroup 中创建，避免启动后再加入时 xray 有一段时间不受限制。
+// 返回的错误为未能生效的限制，此时 preparedLimits 仍可能可用
+func prepareResourceLimits(cmd *exec.Cmd, limits ResourceLimits) (*preparedLimits, error) {
+	if limits.CPU <= 0 && limits.MemoryBytes == 0 {
+		return nil, nil
+	}
+
+	dir, warnings, err := createCgroup(limits)
+	if err != nil {
+		return nil, fmt.Errorf("%s", strings.Join(append(warnings, err.Error()), "; "))
+	}
+
+	p := &preparedLimits{dir: dir, fd: -1}
+	fd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		// 无法打开目录时退回到启动后加入 cgroup
+		warnings = append(warnings, fmt.Sprintf("failed to open cgroup: %v", err))
+	} else {
+		p.fd = fd
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = fd
+	}
+
+	if len(warnings) > 0 {
+		return p, fmt.Errorf("%s", strings.Join(warnings, "; "))
+	}
+	return p, nil
+}
+
+// usesCgroupFD 进程是否将通过 CLONE_INTO_CGROUP 创建
+func (p *preparedLimits) usesCgroupFD() bool {
+	return p != nil && p.fd >= 0
+}
+
+// started 在 Start 之后调用，记录进程是否已在 cgroup 中创建并关闭目录句柄
+func (p *preparedLimits) started(ok bool) {
+	if !p.usesCgroupFD() {
+		return
+	}
+	p.joined = ok
+	unix.Close(p.fd)
+	p.fd = -1
+}
+
+// applyResourceLimits 使用 cgroups v2 限制 CPU 和内存，并设置 nice/ionice，返回进程退出后的清理函数。
+// 进程已在 prepared 的 cgroup 中创建时不再移动
+func applyResourceLimits(pid int, limits ResourceLimits, prepared *preparedLimits) (func(), error) {
+	cleanup := func() {}
+	if !limits.Enabled() {
+		return cleanup, nil
+	}
+
+	var errs []string
+
+	if limits.CPU > 0 || limits.MemoryBytes > 0 {
+		if prepared != nil && prepared.joined {
+			// 进程退出后 cgroup 为空，可以直接删除
+			cleanup = func() { os.Remove(prepared.dir) }
+		} else {
+			dir, warnings, err := setupCgroup(pid, limits)
+			errs = append(errs, warnings...)
+			if err != nil {
+				errs = append(errs, err.Error())
+			} else {
+				cleanup = func() { os.Remove(dir) }
+			}
+		}
+	}
+
+	// nice 和 ionice 是线程级别的，需要对所有已创建的线程设置
+	tids := processThreads(pid)
+
+	if limits.Nice != 0 {
+		for _, tid := range tids {
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, limits.Nice); err != nil {
+				errs = append(errs, fmt.Sprintf("failed to set nice: %v", err))
+				break
+			}
+		}
+	}
+
+	if limits.IOClass != "" {
+		var class int
+		switch limits.IOClass {
+		case IOClassBestEffort:
+			class = ioprioClassBE
+		case IOClassIdle:
+			class = ioprioClassIdle
+		default:
+			errs = append(errs, fmt.Sprintf("unsupported io class: %s", limits.IOClass))
+		}
+		if class != 0 {
+			prio := class<<ioprioClassShift | limits.IOPriority
+			for _, tid := range tids {
+				if _, _, e := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); e != 0 {
+					errs = append(errs, fmt.Sprintf("failed to set io priority: %v", e))
+					break
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return cleanup, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return cleanup, nil
+}
+
+// setupCgroup 在面板自身的 cgroup 下创建子 cgroup 并将已启动的进程加入
+func setupCgroup(pid int, limits ResourceLimits) (string, []string, error) {
+	dir, warnings, err := createCgroup(limits)
+	if err != nil {
+		return "", warnings, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return "", warnings, fmt.Errorf("failed to move xray into cgroup: %v", err)
+	}
+	return dir, warnings, nil
+}
+
+// createCgroup 在面板自身的 cgroup 下创建子 cgroup 并写入限制。
+// 无法启用控制器时只返回警告，进程仍可加入子 cgroup，对应的限制不生效
+func createCgroup(limits ResourceLimits) (string, []string, error) {
+	parent, err := selfCgroup()
+	if err != nil {
+		return "", nil, err
+	}
+	controllers, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return "", nil, fmt.Errorf("cgroup v2 is not available: %v", err)
+	}
+	available := strings.Fields(string(controllers))
+
+	var warnings, enable []string
+	if limits.CPU > 0 {
+		if containsField(available, "cpu") {
+			enable = append(enable, "+cpu")
+		} else {
+			warnings = append(warnings, "cgroup cpu controller is not available")
+		}
+	}
+	if limits.MemoryBytes > 0 {
+		if containsField(available, "memory") {
+			enable = append(enable, "+memory")
+		} else {
+			warnings = append(warnings, "cgroup memory controller is not available")
+		}
+	}
+
+	// 面板所在的 cgroup 中仍有进程时内核不允许启用控制器（systemd 未开启 Delegate 时常见），
+	// 此时只能加入子 cgroup 而无法限制
+	if len(enable) > 0 {
+		if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0644); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to enable cgroup controllers in %s: %v", parent, err))
+		}
+	}
+
+	dir := filepath.Join(parent, cgroupName)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", warnings, fmt.Errorf("failed to create cgroup: %v", err)
+	}
+
+	cpuMax := "max " + strconv.Itoa(cpuPeriod)
+	if limits.CPU > 0 {
+		quota := int(limits.CPU * cpuPeriod)
+		if quota < 1000 {
+			quota = 1000
+		}
+		cpuMax = fmt.Sprintf("%d %d", quota, cpuPeriod)
+	}
+	if fileExists(filepath.Join(dir, "cpu.max")) {
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(cpuMax), 0644); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to set cpu limit: %v", err))
+		}
+	} else if limits.CPU > 0 {
+		warnings = append(warnings, "cgroup cpu controller is not enabled, cpu limit is not applied")
+	}
+
+	memoryMax := "max"
+	if limits.MemoryBytes > 0 {
+		memoryMax = strconv.FormatUint(limits.MemoryBytes, 10)
+	}
+	if fileExists(filepath.Join(dir, "memory.max")) {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(memoryMax), 0644); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to set memory limit: %v", err))
+		}
+	} else if limits.MemoryBytes > 0 {
+		warnings = append(warnings, "cgroup memory controller is not enabled, memory limit is not applied")
+	}
+
+	return dir, warnings, nil
+}
+
+// selfCgroup 从 /proc/self/cgroup 读取面板进程所在的 cgroup v2 目录
+func selfCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("failed to read cgroup of current process: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		// cgroup v2 的条目格式为 "0::/path"
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(cgroupRoot, filepath.Clean("/"+path)), nil
+		}
+	}
+	return "", fmt.Errorf("cgroup v2 is not available: no unified hierarchy entry in /proc/self/cgroup")
+}
+
+// containsField 判断控制器列表中是否包含 name
+func containsField(fields []string, name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// processThreads 返回进程的所有线程 ID
+func processThreads(pid int) []int {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return []int{pid}
+	}
+
+	tids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	if len(tids) == 0 {
+		tids = append(tids, pid)
+	}
+	return tids
+}
+
+// fileExists 判断文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
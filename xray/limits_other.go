@@ -0,0 +1,32 @@
+//go:build !linux && !windows
+
+package xray
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// preparedLimits 当前平台不支持在启动前准备资源限制
+type preparedLimits struct{}
+
+// prepareResourceLimits 当前平台不支持在启动前准备资源限制
+func prepareResourceLimits(cmd *exec.Cmd, limits ResourceLimits) (*preparedLimits, error) {
+	return nil, nil
+}
+
+// usesCgroupFD 当前平台不使用 cgroup
+func (p *preparedLimits) usesCgroupFD() bool {
+	return false
+}
+
+// started 当前平台无需处理
+func (p *preparedLimits) started(ok bool) {}
+
+// applyResourceLimits 当前平台不支持资源限制
+func applyResourceLimits(pid int, limits ResourceLimits, prepared *preparedLimits) (func(), error) {
+	if !limits.Enabled() {
+		return func() {}, nil
+	}
+	return func() {}, errors.New("xray resource limits are only supported on linux and windows")
+}
@@ -0,0 +1,122 @@
+//go:build windows
+
+package xray
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	jobObjectCPURateControlEnable  = 0x1
+	jobObjectCPURateControlHardCap = 0x4
+)
+
+// jobObjectCPURateControlInformation JOBOBJECT_CPU_RATE_CONTROL_INFORMATION
+type jobObjectCPURateControlInformation struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
+// preparedLimits Windows 上 Job Object 在启动后立即分配，无需提前准备
+type preparedLimits struct{}
+
+// prepareResourceLimits Windows 上无需提前准备
+func prepareResourceLimits(cmd *exec.Cmd, limits ResourceLimits) (*preparedLimits, error) {
+	return nil, nil
+}
+
+// usesCgroupFD Windows 不使用 cgroup
+func (p *preparedLimits) usesCgroupFD() bool {
+	return false
+}
+
+// started Windows 上无需处理
+func (p *preparedLimits) started(ok bool) {}
+
+// applyResourceLimits 使用 Job Object 限制 CPU 和内存，并根据 nice 设置优先级类别，返回进程退出后的清理函数
+func applyResourceLimits(pid int, limits ResourceLimits, prepared *preparedLimits) (func(), error) {
+	cleanup := func() {}
+	if !limits.Enabled() {
+		return cleanup, nil
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE|windows.PROCESS_SET_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to open xray process: %v", err)
+	}
+	defer windows.CloseHandle(process)
+
+	if limits.Nice != 0 {
+		if err := windows.SetPriorityClass(process, priorityClass(limits.Nice)); err != nil {
+			return cleanup, fmt.Errorf("failed to set priority class: %v", err)
+		}
+	}
+
+	if limits.CPU <= 0 && limits.MemoryBytes == 0 {
+		return cleanup, nil
+	}
+
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to create job object: %v", err)
+	}
+
+	if limits.MemoryBytes > 0 {
+		info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+		info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_PROCESS_MEMORY
+		info.ProcessMemoryLimit = uintptr(limits.MemoryBytes)
+		if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+			uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+			windows.CloseHandle(job)
+			return cleanup, fmt.Errorf("failed to set memory limit: %v", err)
+		}
+	}
+
+	if limits.CPU > 0 {
+		// CPURate 是占全部 CPU 的比例乘以 10000
+		rate := uint32(limits.CPU / float64(runtime.NumCPU()) * 10000)
+		if rate < 1 {
+			rate = 1
+		} else if rate > 10000 {
+			rate = 10000
+		}
+		info := jobObjectCPURateControlInformation{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap,
+			CPURate:      rate,
+		}
+		if _, err := windows.SetInformationJobObject(job, windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+			windows.CloseHandle(job)
+			return cleanup, fmt.Errorf("failed to set cpu limit: %v", err)
+		}
+	}
+
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return cleanup, fmt.Errorf("failed to assign xray to job object: %v", err)
+	}
+
+	// Job Object 需要保持打开直到进程退出
+	return func() { windows.CloseHandle(job) }, nil
+}
+
+// priorityClass 将 nice 值映射为 Windows 优先级类别
+func priorityClass(nice int) uint32 {
+	switch {
+	case nice >= 10:
+		return windows.IDLE_PRIORITY_CLASS
+	case nice > 0:
+		return windows.BELOW_NORMAL_PRIORITY_CLASS
+	case nice <= -10:
+		return windows.HIGH_PRIORITY_CLASS
+	case nice < 0:
+		return windows.ABOVE_NORMAL_PRIORITY_CLASS
+	default:
+		return windows.NORMAL_PRIORITY_CLASS
+	}
+}
@@ -9,13 +9,19 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"v/logger"
+	"v/model"
 	"v/settings"
+	"v/utils"
 )
 
+// downloadSpaceRequired 下载并解压 Xray 所需的磁盘空间
+const downloadSpaceRequired = 64 * 1024 * 1024
+
 // 支持的版本列表
 var SupportedVersions = []string{
 	// v1系列
@@ -39,6 +45,19 @@ type Manager struct {
 	// 事件通知相关
 	eventsMutex      sync.RWMutex
 	eventSubscribers map[chan XrayEvent]bool
+	// 端口冲突相关
+	conflictsMutex sync.Mutex
+	portConflicts  []*PortConflict
+	// 输出采集相关
+	outputMutex  sync.Mutex
+	logQueue     chan *model.Log
+	recentLines  []string // 本次运行的警告、错误和标准错误输出
+	lastCrash    *CrashReport
+	storeWindow  time.Time
+	storeCount   int
+	storeDropped int
+	// 访问日志回调，开启流量导出时 xray 将访问日志写到标准输出
+	accessObserver atomic.Pointer[func(AccessEntry)]
 }
 
 // XrayEvent 表示Xray事件
@@ -90,8 +109,9 @@ func (m *Manager) Initialize() error {
 		}
 
 		// 更新设置
-		settings.Xray.Version = currentVersion
-		if err := m.settings.Save(); err != nil {
+		updated := m.settings.Clone()
+		updated.Xray.Version = currentVersion
+		if err := m.settings.Update(updated); err != nil {
 			m.log.Error("Failed to save settings", logger.Fields{
 				"error": err,
 			})
@@ -158,6 +178,11 @@ func (m *Manager) GetExecutablePath(version string) string {
 	return filepath.Join(m.binPath, version, filename)
 }
 
+// BinDir 返回xray可执行文件目录，每个版本一个子目录
+func (m *Manager) BinDir() string {
+	return m.binPath
+}
+
 // GetConfigPath 获取xray配置文件路径
 func (m *Manager) GetConfigPath() string {
 	return filepath.Join("xray", "config.json")
@@ -191,6 +216,19 @@ func (m *Manager) DownloadVersion(version string) error {
 		return fmt.Errorf("failed to create version directory: %v", err)
 	}
 
+	// 检查磁盘空间，预留压缩包和解压后文件所需的空间
+	minFree := utils.MinFreeDiskBytes(m.settings.Get().Monitor.MinFreeDiskMB)
+	if err := utils.CheckDiskSpace(versionDir, downloadSpaceRequired, minFree); err != nil {
+		m.PublishEvent(XrayEvent{
+			Type:    "download",
+			Version: version,
+			Status:  "error",
+			Message: fmt.Sprintf("磁盘空间不足: %v", err),
+			Percent: 0,
+		})
+		return fmt.Errorf("refusing to download xray: %w", err)
+	}
+
 	// 发布进度事件 - 10%
 	m.PublishEvent(XrayEvent{
 		Type:    "download",
@@ -419,9 +457,9 @@ func (m *Manager) SwitchVersion(version string) error {
 	m.currentVersion = version
 
 	// 更新设置
-	settings := m.settings.Get()
+	settings := m.settings.Clone()
 	settings.Xray.Version = version
-	if err := m.settings.Save(); err != nil {
+	if err := m.settings.Update(settings); err != nil {
 		m.log.Error("Failed to save settings", logger.Fields{
 			"error": err,
 		})
@@ -607,8 +645,8 @@ func (m *Manager) Start() error {
 	// 设置进程属性
 	cmd.SysProcAttr = &syscall.SysProcAttr{}
 
-	// 设置输出
-	stdout, err := os.Create(filepath.Join(logDir, "xray_stdout.log"))
+	// 设置输出，写入文件的同时按行分类采集
+	stdoutFile, err := os.Create(filepath.Join(logDir, "xray_stdout.log"))
 	if err != nil {
 		m.log.Error("Failed to create stdout log", logger.Fields{
 			"error": err,
@@ -616,20 +654,46 @@ func (m *Manager) Start() error {
 		return fmt.Errorf("failed to create stdout log: %v", err)
 	}
 
-	stderr, err := os.Create(filepath.Join(logDir, "xray_stderr.log"))
+	stderrFile, err := os.Create(filepath.Join(logDir, "xray_stderr.log"))
 	if err != nil {
-		stdout.Close()
+		stdoutFile.Close()
 		m.log.Error("Failed to create stderr log", logger.Fields{
 			"error": err,
 		})
 		return fmt.Errorf("failed to create stderr log: %v", err)
 	}
 
+	stdout := newOutputWriter(stdoutFile, "stdout", m.handleOutput)
+	stderr := newOutputWriter(stderrFile, "stderr", m.handleOutput)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
+	m.resetOutput()
+
+	// CPU 和内存限制在启动前准备好，进程直接在受限的 cgroup 中创建
+	limits := resourceLimitsFromSettings(m.settings.Get().Xray)
+	prepared, err := prepareResourceLimits(cmd, limits)
+	if err != nil {
+		m.log.WarnWithFields("Failed to prepare Xray resource limits", logger.Fields{
+			"error": err,
+		})
+	}
 
 	// 启动进程
-	if err := cmd.Start(); err != nil {
+	err = cmd.Start()
+	if err != nil && prepared.usesCgroupFD() {
+		// 内核不支持在创建进程时指定 cgroup（5.7 之前）时，改为启动后再加入
+		prepared.started(false)
+		m.log.WarnWithFields("Failed to start Xray inside cgroup, moving it after start", logger.Fields{
+			"error": err,
+		})
+		cmd = exec.Command(execPath, "-config", configPath)
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err = cmd.Start()
+	}
+	prepared.started(err == nil)
+	if err != nil {
 		stdout.Close()
 		stderr.Close()
 		m.log.Error("Failed to start Xray process", logger.Fields{
@@ -643,6 +707,23 @@ func (m *Manager) Start() error {
 	m.process = cmd.Process
 	m.running = true
 
+	// 应用其余资源限制，失败时只记录警告，不影响xray运行
+	releaseLimits, err := applyResourceLimits(cmd.Process.Pid, limits, prepared)
+	if err != nil {
+		m.log.WarnWithFields("Failed to apply Xray resource limits", logger.Fields{
+			"pid":   cmd.Process.Pid,
+			"error": err,
+		})
+	}
+
+	// 保存已应用配置的快照，便于配置出错时回滚
+	if _, err := m.snapshotConfig(configPath); err != nil {
+		m.log.WarnWithFields("Failed to snapshot Xray config", logger.Fields{
+			"config": configPath,
+			"error":  err,
+		})
+	}
+
 	m.log.Info("Started Xray successfully", logger.Fields{
 		"version": m.currentVersion,
 		"pid":     m.process.Pid,
@@ -653,11 +734,17 @@ func (m *Manager) Start() error {
 	})
 
 	// 异步等待进程结束
+	startedAt := time.Now()
+	customConfig := settings.Xray.CustomConfig && settings.Xray.ConfigPath != ""
 	go func() {
 		err := cmd.Wait()
 		m.mutex.Lock()
-		m.running = false
-		m.process = nil
+		// Stop 已经清除了进程，说明是主动停止
+		stopped := m.process != cmd.Process
+		if !stopped {
+			m.running = false
+			m.process = nil
+		}
 		m.mutex.Unlock()
 
 		if err != nil {
@@ -673,6 +760,24 @@ func (m *Manager) Start() error {
 
 		stdout.Close()
 		stderr.Close()
+		releaseLimits()
+
+		// 异常退出时生成失败报告，附带退出前的错误输出
+		if err != nil && !stopped {
+			report := m.recordCrash(err, time.Since(startedAt))
+			m.PublishEvent(XrayEvent{
+				Type:    "crash",
+				Version: report.Version,
+				Status:  "failed",
+				Message: fmt.Sprintf("Xray 异常退出: %s", report.ExitError),
+				Details: report,
+			})
+		}
+
+		// 启动后很快退出时检查是否为端口冲突
+		if err != nil && !stopped && time.Since(startedAt) < portConflictWindow {
+			m.handleStartupFailure(configPath, customConfig)
+		}
 	}()
 
 	return nil
@@ -857,9 +962,11 @@ func (m *Manager) UpdateConfig(config map[string]interface{}) error {
 
 // GenerateConfig 生成完整的Xray配置
 func (m *Manager) GenerateConfig() (map[string]interface{}, error) {
+	xraySettings := m.settings.Get().Xray
+
 	config := map[string]interface{}{
 		"log": map[string]interface{}{
-			"access":   "none",
+			"access":   accessLogTarget(m.settings.Get().Export.Enable),
 			"error":    filepath.Join("logs", "xray.log"),
 			"loglevel": "warning",
 		},
@@ -869,7 +976,7 @@ func (m *Manager) GenerateConfig() (map[string]interface{}, error) {
 				"protocol": "freedom",
 				"tag":      "direct",
 				"settings": map[string]interface{}{
-					"domainStrategy": "UseIP",
+					"domainStrategy": xraySettings.OutboundStrategy("direct"),
 				},
 				"mux": map[string]interface{}{
 					"enabled":     true,
@@ -883,7 +990,7 @@ func (m *Manager) GenerateConfig() (map[string]interface{}, error) {
 			},
 		},
 		"routing": map[string]interface{}{
-			"domainStrategy": "AsIs",
+			"domainStrategy": xraySettings.RoutingStrategy(),
 			"rules": []map[string]interface{}{
 				{
 					"type":        "field",
@@ -908,6 +1015,7 @@ func (m *Manager) GenerateConfig() (map[string]interface{}, error) {
 				"8.8.8.8",
 				"localhost",
 			},
+			"disableCache": xraySettings.DNSDisableCache,
 		},
 		"policy": map[string]interface{}{
 			"levels": map[string]interface{}{
@@ -929,9 +1037,15 @@ func (m *Manager) GenerateConfig() (map[string]interface{}, error) {
 		},
 	}
 
-	// 获取当前设置
-	// 注意: 当前未使用此设置，保留以便未来扩展
-	// settings := m.settings.Get()
+	// 多 IP 服务器上指定出口 IP
+	for _, outbound := range config["outbounds"].([]map[string]interface{}) {
+		tag, _ := outbound["tag"].(string)
+		if outbound["protocol"] == "freedom" {
+			if ip := xraySettings.EgressIP(tag, nil); ip != "" {
+				outbound["sendThrough"] = ip
+			}
+		}
+	}
 
 	// 添加API入站
 	apiPort := 62789 // 默认API端口
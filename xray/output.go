@@ -0,0 +1,279 @@
+package xray
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"v/logger"
+	"v/model"
+)
+
+// Xray 输出行的级别
+const (
+	OutputDebug   = "debug"
+	OutputInfo    = "info"
+	OutputWarning = "warning"
+	OutputError   = "error"
+)
+
+const (
+	// maxOutputLine 单行输出的最大长度，超出部分截断
+	maxOutputLine = 4096
+	// crashLinesKeep 进程异常退出时写入失败报告的最近警告和错误行数
+	crashLinesKeep = 50
+	// logStoreQueueSize 等待写入日志表的行数，写入跟不上时丢弃
+	logStoreQueueSize = 256
+	// logStorePerMinute 每分钟最多写入日志表的行数，防止刷屏的错误占满数据库
+	logStorePerMinute = 120
+	// outputModule 日志表中 Xray 输出的模块名
+	outputModule = "xray"
+)
+
+// xrayLogLineRe 匹配 Xray 日志格式：2024/01/02 15:04:05.123456 [Warning] message
+var xrayLogLineRe = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? \[(\w+)\] (.*)$`)
+
+// LogStore 保存 Xray 警告和错误输出的日志表
+type LogStore interface {
+	CreateLog(log *model.Log) error
+}
+
+// CrashReport Xray 进程异常退出的失败报告
+type CrashReport struct {
+	Time      time.Time     `json:"time"`
+	Version   string        `json:"version"`
+	ExitError string        `json:"exit_error"`
+	Uptime    time.Duration `json:"uptime"`
+	Lines     []string      `json:"lines"` // 退出前的警告、错误和标准错误输出，旧的在前
+}
+
+// ClassifyOutput 解析一行 Xray 输出的级别和消息。带级别标记的行按标记分类，
+// panic 和 fatal error 视为错误，其他标准错误输出视为警告，标准输出视为信息
+func ClassifyOutput(stream, line string) (level, message string) {
+	if match := xrayLogLineRe.FindStringSubmatch(line); match != nil {
+		switch strings.ToLower(match[1]) {
+		case "debug":
+			return OutputDebug, match[2]
+		case "warning", "warn":
+			return OutputWarning, match[2]
+		case "error":
+			return OutputError, match[2]
+		default:
+			return OutputInfo, match[2]
+		}
+	}
+	switch {
+	case strings.HasPrefix(line, "panic:"), strings.HasPrefix(line, "fatal error:"), strings.HasPrefix(line, "Failed to start"):
+		return OutputError, line
+	case stream == "stderr":
+		return OutputWarning, line
+	}
+	return OutputInfo, line
+}
+
+// outputWriter 按行交给 Manager 分类，需要保留的行写入日志文件
+type outputWriter struct {
+	file   *os.File
+	stream string
+	onLine func(stream, line string) bool
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// newOutputWriter 创建输出采集器
+func newOutputWriter(file *os.File, stream string, onLine func(stream, line string) bool) *outputWriter {
+	return &outputWriter{file: file, stream: stream, onLine: onLine}
+}
+
+// Write 处理完整的行并写入文件。总是返回成功，避免写入失败导致 Xray 的输出管道被关闭
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > maxOutputLine {
+		w.emit(w.buf)
+		w.buf = w.buf[:0]
+	}
+	return len(p), nil
+}
+
+// Close 处理未以换行结束的最后一行并关闭文件
+func (w *outputWriter) Close() error {
+	w.mu.Lock()
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+	w.mu.Unlock()
+	return w.file.Close()
+}
+
+// emit 交出一行输出，访问日志等不需要保留的行不写入文件
+func (w *outputWriter) emit(line []byte) {
+	text := strings.TrimRight(string(line), "\r\n")
+	if len(text) > maxOutputLine {
+		text = text[:maxOutputLine]
+	}
+	if strings.TrimSpace(text) != "" && !w.onLine(w.stream, text) {
+		return
+	}
+	w.file.Write(line)
+}
+
+// SetLogStore 设置日志表，Xray 的警告和错误输出按 Xray.LogStoreLevel 写入，模块为 xray
+func (m *Manager) SetLogStore(store LogStore) {
+	m.outputMutex.Lock()
+	defer m.outputMutex.Unlock()
+
+	if m.logQueue != nil {
+		return
+	}
+	m.logQueue = make(chan *model.Log, logStoreQueueSize)
+	go m.storeLogs(store, m.logQueue)
+}
+
+// LastCrash 返回最近一次异常退出的失败报告，没有时返回 nil
+func (m *Manager) LastCrash() *CrashReport {
+	m.outputMutex.Lock()
+	defer m.outputMutex.Unlock()
+	return m.lastCrash
+}
+
+// resetOutput 进程启动前清空上一次运行的输出记录
+func (m *Manager) resetOutput() {
+	m.outputMutex.Lock()
+	m.recentLines = nil
+	m.outputMutex.Unlock()
+}
+
+// handleOutput 分类一行输出，记录可能与崩溃相关的行，外发并写入日志表。
+// 访问日志只交给访问日志回调，返回 false 表示该行不写入输出文件
+func (m *Manager) handleOutput(stream, line string) bool {
+	if stream == "stdout" {
+		if entry, ok := ParseAccessLine(line); ok {
+			if fn := m.accessObserver.Load(); fn != nil && *fn != nil {
+				(*fn)(entry)
+			}
+			return false
+		}
+	}
+
+	level, message := ClassifyOutput(stream, line)
+
+	m.outputMutex.Lock()
+	defer m.outputMutex.Unlock()
+
+	if level == OutputWarning || level == OutputError || stream == "stderr" {
+		m.recentLines = append(m.recentLines, line)
+		if len(m.recentLines) > crashLinesKeep {
+			m.recentLines = m.recentLines[len(m.recentLines)-crashLinesKeep:]
+		}
+	}
+
+	logger.Ship(&logger.Entry{
+		Time:    time.Now(),
+		Level:   shipLevel(level),
+		Source:  logger.SourceXray,
+		Message: message,
+		Fields: map[string]string{
+			"stream":  stream,
+			"version": m.currentVersion,
+		},
+	})
+
+	if m.logQueue == nil || !shouldStoreOutput(m.settings.Get().Xray.LogStoreLevel, level) {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(m.storeWindow) >= time.Minute {
+		if m.storeDropped > 0 {
+			m.log.WarnWithFields("Dropped Xray output lines over the log store limit", logger.Fields{
+				"dropped": m.storeDropped,
+			})
+		}
+		m.storeWindow, m.storeCount, m.storeDropped = now, 0, 0
+	}
+	if m.storeCount >= logStorePerMinute {
+		m.storeDropped++
+		return true
+	}
+	m.storeCount++
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"stream":  stream,
+		"version": m.currentVersion,
+	})
+	select {
+	case m.logQueue <- &model.Log{Level: level, Module: outputModule, Message: message, Details: string(details)}:
+	default:
+		m.storeDropped++
+	}
+	return true
+}
+
+// storeLogs 写入日志表
+func (m *Manager) storeLogs(store LogStore, queue chan *model.Log) {
+	for entry := range queue {
+		if err := store.CreateLog(entry); err != nil {
+			m.log.WarnWithFields("Failed to store Xray output", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// recordCrash 生成并保存异常退出的失败报告
+func (m *Manager) recordCrash(exitErr error, uptime time.Duration) *CrashReport {
+	m.outputMutex.Lock()
+	defer m.outputMutex.Unlock()
+
+	report := &CrashReport{
+		Time:      time.Now(),
+		Version:   m.currentVersion,
+		ExitError: exitErr.Error(),
+		Uptime:    uptime,
+		Lines:     append([]string(nil), m.recentLines...),
+	}
+	m.lastCrash = report
+	return report
+}
+
+// shipLevel 输出级别对应的面板日志级别，用于日志外发
+func shipLevel(level string) logger.LogLevel {
+	switch level {
+	case OutputDebug:
+		return logger.DEBUG
+	case OutputWarning:
+		return logger.WARN
+	case OutputError:
+		return logger.ERROR
+	default:
+		return logger.INFO
+	}
+}
+
+// shouldStoreOutput 判断该级别的输出是否写入日志表
+func shouldStoreOutput(minLevel, level string) bool {
+	switch minLevel {
+	case "none":
+		return false
+	case OutputError:
+		return level == OutputError
+	default:
+		return level == OutputWarning || level == OutputError
+	}
+}
@@ -0,0 +1,287 @@
+package xray
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"v/logger"
+)
+
+const (
+	// portConflictWindow 进程在启动后多长时间内退出视为启动失败
+	portConflictWindow = 30 * time.Second
+	// startupOutputLimit 检查启动失败时读取的输出末尾字节数
+	startupOutputLimit = 64 * 1024
+)
+
+// bindFailureRe 匹配 xray 输出中的端口绑定失败，如
+// listen tcp 0.0.0.0:443: bind: address already in use
+var bindFailureRe = regexp.MustCompile(`listen (tcp|udp)[46]? (\S*):(\d+): bind: (?:address already in use|Only one usage of each socket address)`)
+
+// PortConflict 入站端口被其他进程占用导致 xray 启动失败
+type PortConflict struct {
+	Port       int       `json:"port"`
+	Network    string    `json:"network"`
+	Address    string    `json:"address"`
+	InboundTag string    `json:"inbound_tag,omitempty"`
+	PID        int       `json:"pid,omitempty"`
+	Process    string    `json:"process,omitempty"`
+	Disabled   bool      `json:"disabled"`
+	Hint       string    `json:"hint"`
+	DetectedAt time.Time `json:"detected_at"`
+
+	// inbound 被禁用的入站配置，恢复时写回
+	inbound map[string]interface{}
+}
+
+// ParseBindFailures 从 xray 输出中解析端口绑定失败，同一端口只返回一次
+func ParseBindFailures(output string) []*PortConflict {
+	var conflicts []*PortConflict
+	seen := make(map[string]bool)
+	for _, match := range bindFailureRe.FindAllStringSubmatch(output, -1) {
+		port, err := strconv.Atoi(match[3])
+		if err != nil {
+			continue
+		}
+		key := match[1] + ":" + match[3]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		conflicts = append(conflicts, &PortConflict{
+			Port:    port,
+			Network: match[1],
+			Address: match[2],
+		})
+	}
+	return conflicts
+}
+
+// PortConflicts 返回最近检测到的端口冲突
+func (m *Manager) PortConflicts() []*PortConflict {
+	m.conflictsMutex.Lock()
+	defer m.conflictsMutex.Unlock()
+
+	list := make([]*PortConflict, len(m.portConflicts))
+	copy(list, m.portConflicts)
+	return list
+}
+
+// RestoreConflictInbounds 将因端口冲突禁用的入站写回配置并清除冲突记录，xray 运行时会重启
+func (m *Manager) RestoreConflictInbounds() error {
+	m.conflictsMutex.Lock()
+	conflicts := m.portConflicts
+	m.portConflicts = nil
+	m.conflictsMutex.Unlock()
+
+	var inbounds []map[string]interface{}
+	for _, c := range conflicts {
+		if c.inbound != nil {
+			inbounds = append(inbounds, c.inbound)
+		}
+	}
+	if len(inbounds) == 0 {
+		return nil
+	}
+
+	configPath := m.GetConfigPath()
+	config, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	list, _ := config["inbounds"].([]interface{})
+	for _, inbound := range inbounds {
+		list = append(list, inbound)
+	}
+	config["inbounds"] = list
+
+	if err := writeConfigFile(configPath, config); err != nil {
+		return err
+	}
+	m.log.WithFields("Restored inbounds disabled by port conflicts", logger.Fields{
+		"count": len(inbounds),
+	})
+
+	if m.IsRunning() {
+		if err := m.Stop(); err != nil {
+			return fmt.Errorf("failed to stop xray: %v", err)
+		}
+		return m.Start()
+	}
+	return nil
+}
+
+// handleStartupFailure 检查启动失败是否由端口冲突导致，禁用冲突的入站并重启 xray。
+// 每次重启至少禁用一个新的入站，因此不会无限重试
+func (m *Manager) handleStartupFailure(configPath string, customConfig bool) {
+	var output string
+	for _, name := range []string{"xray_stderr.log", "xray_stdout.log"} {
+		output += readTail(filepath.Join("logs", name), startupOutputLimit)
+	}
+
+	conflicts := ParseBindFailures(output)
+	if len(conflicts) == 0 {
+		return
+	}
+
+	// 自定义配置由用户维护，只报告不修改
+	var config map[string]interface{}
+	if !customConfig {
+		var err error
+		if config, err = readConfigFile(configPath); err != nil {
+			m.log.WarnWithFields("Failed to read Xray config for port conflict", logger.Fields{
+				"config": configPath,
+				"error":  err.Error(),
+			})
+		}
+	}
+
+	disabled := 0
+	for _, c := range conflicts {
+		c.DetectedAt = time.Now()
+		if pid, name, err := findPortOwner(c.Network, c.Port); err == nil {
+			c.PID, c.Process = pid, name
+		}
+		if config != nil && disableInbound(config, c) {
+			disabled++
+		}
+		c.Hint = portConflictHint(c, customConfig)
+
+		m.log.ErrorWithFields("Xray inbound port is already in use", logger.Fields{
+			"port":     c.Port,
+			"network":  c.Network,
+			"inbound":  c.InboundTag,
+			"pid":      c.PID,
+			"process":  c.Process,
+			"disabled": c.Disabled,
+		})
+	}
+
+	m.conflictsMutex.Lock()
+	m.portConflicts = append(m.portConflicts, conflicts...)
+	m.conflictsMutex.Unlock()
+
+	m.PublishEvent(XrayEvent{
+		Type:    "port_conflict",
+		Version: m.currentVersion,
+		Status:  "failed",
+		Message: fmt.Sprintf("%d 个入站端口被占用", len(conflicts)),
+		Details: conflicts,
+	})
+
+	if disabled == 0 {
+		return
+	}
+	if err := writeConfigFile(configPath, config); err != nil {
+		m.log.ErrorWithFields("Failed to disable conflicting inbounds", logger.Fields{
+			"config": configPath,
+			"error":  err.Error(),
+		})
+		return
+	}
+	if err := m.Start(); err != nil {
+		m.log.ErrorWithFields("Failed to restart Xray without conflicting inbounds", logger.Fields{
+			"error": err.Error(),
+		})
+	}
+}
+
+// disableInbound 从配置中移除监听冲突端口的入站，API 入站不会被移除
+func disableInbound(config map[string]interface{}, c *PortConflict) bool {
+	inbounds, _ := config["inbounds"].([]interface{})
+	for i, item := range inbounds {
+		inbound, ok := item.(map[string]interface{})
+		if !ok || inboundPort(inbound) != c.Port {
+			continue
+		}
+		c.InboundTag, _ = inbound["tag"].(string)
+		if c.InboundTag == "api" {
+			return false
+		}
+		config["inbounds"] = append(inbounds[:i:i], inbounds[i+1:]...)
+		c.inbound = inbound
+		c.Disabled = true
+		return true
+	}
+	return false
+}
+
+// inboundPort 读取入站端口，端口可以是数字或字符串
+func inboundPort(inbound map[string]interface{}) int {
+	switch port := inbound["port"].(type) {
+	case float64:
+		return int(port)
+	case string:
+		n, _ := strconv.Atoi(port)
+		return n
+	}
+	return 0
+}
+
+// portConflictHint 生成端口冲突的处理建议
+func portConflictHint(c *PortConflict, customConfig bool) string {
+	owner := "其他进程"
+	if c.Process != "" {
+		owner = fmt.Sprintf("进程 %s (PID %d)", c.Process, c.PID)
+	} else if c.PID > 0 {
+		owner = fmt.Sprintf("PID %d", c.PID)
+	}
+
+	hint := fmt.Sprintf("%s 端口 %d 已被%s占用，请停止该进程或为入站更换端口", c.Network, c.Port, owner)
+	if c.PID == 0 {
+		hint += "，可使用 ss -lntup 或 netstat -ano 查看占用端口的进程"
+	}
+	switch {
+	case c.Disabled:
+		hint += fmt.Sprintf("。入站 %s 已被临时禁用，处理后可恢复", c.InboundTag)
+	case customConfig:
+		hint += "。当前使用自定义配置，需要手动修改配置文件"
+	}
+	return hint
+}
+
+// readTail 读取文件末尾最多 limit 字节，文件不存在时返回空字符串
+func readTail(path string, limit int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.Size() > limit {
+		f.Seek(-limit, io.SeekEnd)
+	}
+	data, _ := io.ReadAll(f)
+	return string(data)
+}
+
+// readConfigFile 读取 xray 配置文件
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return config, nil
+}
+
+// writeConfigFile 写入 xray 配置文件
+func writeConfigFile(path string, config map[string]interface{}) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package xray
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListenState /proc/net/tcp 中 LISTEN 状态的编码
+const tcpListenState = "0A"
+
+// findPortOwner 通过 /proc/net 找到监听端口的 socket inode，再在 /proc/*/fd 中查找持有该 socket 的进程
+func findPortOwner(network string, port int) (int, string, error) {
+	inodes := make(map[string]bool)
+	for _, suffix := range []string{"", "6"} {
+		if err := listenInodes(filepath.Join("/proc/net", network+suffix), network, port, inodes); err != nil && !os.IsNotExist(err) {
+			return 0, "", err
+		}
+	}
+	if len(inodes) == 0 {
+		return 0, "", fmt.Errorf("no socket listening on %s port %d", network, port)
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read /proc: %v", err)
+	}
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			if inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] {
+				comm, _ := os.ReadFile(filepath.Join("/proc", proc.Name(), "comm"))
+				return pid, strings.TrimSpace(string(comm)), nil
+			}
+		}
+	}
+	return 0, "", fmt.Errorf("owner of %s port %d not found, root may be required", network, port)
+}
+
+// listenInodes 解析 /proc/net/tcp 格式的文件，收集监听指定端口的 socket inode
+func listenInodes(path, network string, port int, inodes map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // 表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local := fields[1]
+		i := strings.LastIndex(local, ":")
+		if i < 0 {
+			continue
+		}
+		p, err := strconv.ParseInt(local[i+1:], 16, 32)
+		if err != nil || int(p) != port {
+			continue
+		}
+		if network == "tcp" && fields[3] != tcpListenState {
+			continue
+		}
+		if fields[9] != "0" {
+			inodes[fields[9]] = true
+		}
+	}
+	return scanner.Err()
+}
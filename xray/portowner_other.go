@@ -0,0 +1,36 @@
+//go:build !linux && !windows
+
+package xray
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// findPortOwner 通过 lsof 查找监听端口的进程
+func findPortOwner(network string, port int) (int, string, error) {
+	args := []string{"-nP", "-F", "pc", "-i", fmt.Sprintf("%s:%d", strings.ToUpper(network), port)}
+	if network == "tcp" {
+		args = append(args, "-sTCP:LISTEN")
+	}
+	out, err := exec.Command("lsof", args...).Output()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to run lsof: %v", err)
+	}
+
+	pid, name := 0, ""
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "p") && pid == 0:
+			pid, _ = strconv.Atoi(line[1:])
+		case strings.HasPrefix(line, "c") && name == "":
+			name = line[1:]
+		}
+	}
+	if pid == 0 {
+		return 0, "", fmt.Errorf("no process listening on %s port %d", network, port)
+	}
+	return pid, name, nil
+}
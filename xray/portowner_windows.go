@@ -0,0 +1,50 @@
+//go:build windows
+
+package xray
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// findPortOwner 通过 netstat -ano 查找监听端口的进程，再用 tasklist 获取进程名
+func findPortOwner(network string, port int) (int, string, error) {
+	out, err := exec.Command("netstat", "-ano", "-p", strings.ToUpper(network)).Output()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to run netstat: %v", err)
+	}
+
+	suffix := ":" + strconv.Itoa(port)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.EqualFold(fields[0], network) || !strings.HasSuffix(fields[1], suffix) {
+			continue
+		}
+		// TCP 行包含状态列，UDP 行没有
+		if network == "tcp" && (len(fields) < 5 || fields[3] != "LISTENING") {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil || pid == 0 {
+			continue
+		}
+		return pid, processName(pid), nil
+	}
+	return 0, "", fmt.Errorf("no process listening on %s port %d", network, port)
+}
+
+// processName 通过 tasklist 获取进程名，失败时返回空字符串
+func processName(pid int) string {
+	out, err := exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return ""
+	}
+	record, err := csv.NewReader(strings.NewReader(string(out))).Read()
+	if err != nil || len(record) == 0 {
+		return ""
+	}
+	return record[0]
+}
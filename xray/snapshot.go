@@ -0,0 +1,221 @@
+package xray
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"v/logger"
+)
+
+const (
+	// defaultSnapshotKeep 未配置时保留的配置快照数量
+	defaultSnapshotKeep = 20
+	// snapshotTimeLayout 快照文件名中的时间格式
+	snapshotTimeLayout = "20060102-150405.000"
+)
+
+// ErrSnapshotNotFound 配置快照不存在
+var ErrSnapshotNotFound = errors.New("config snapshot not found")
+
+// ConfigSnapshot 已应用的 Xray 配置快照
+type ConfigSnapshot struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum"` // 配置内容 SHA-256 的前 12 位
+}
+
+// SnapshotDir 返回配置快照目录
+func (m *Manager) SnapshotDir() string {
+	return filepath.Join("xray", "snapshots")
+}
+
+// RestoredConfigPath 返回从快照恢复的自定义配置路径
+func (m *Manager) RestoredConfigPath() string {
+	return filepath.Join("xray", "restored_config.json")
+}
+
+// snapshotConfig 保存已应用的配置，内容与最新快照相同时跳过，随后按保留策略清理旧快照
+func (m *Manager) snapshotConfig(configPath string) (*ConfigSnapshot, error) {
+	keep := m.settings.Get().Xray.SnapshotKeep
+	if keep < 0 {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])[:12]
+
+	snapshots, err := m.ListSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) > 0 && snapshots[0].Checksum == checksum {
+		return snapshots[0], nil
+	}
+
+	if err := os.MkdirAll(m.SnapshotDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	snapshot := &ConfigSnapshot{
+		ID:        now.Format(snapshotTimeLayout) + "-" + checksum,
+		CreatedAt: now,
+		Size:      int64(len(data)),
+		Checksum:  checksum,
+	}
+	// 配置中包含用户凭据，仅所有者可读
+	if err := os.WriteFile(m.snapshotPath(snapshot.ID), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %v", err)
+	}
+
+	m.pruneSnapshots(append([]*ConfigSnapshot{snapshot}, snapshots...))
+	return snapshot, nil
+}
+
+// pruneSnapshots 删除超出数量或超过保留时间的快照，snapshots 需按时间倒序
+func (m *Manager) pruneSnapshots(snapshots []*ConfigSnapshot) {
+	s := m.settings.Get().Xray
+	keep := s.SnapshotKeep
+	if keep == 0 {
+		keep = defaultSnapshotKeep
+	}
+
+	for i, snapshot := range snapshots {
+		// 最新的快照始终保留
+		if i == 0 {
+			continue
+		}
+		expired := s.SnapshotMaxAge > 0 && time.Since(snapshot.CreatedAt) > s.SnapshotMaxAge
+		if i < keep && !expired {
+			continue
+		}
+		if err := os.Remove(m.snapshotPath(snapshot.ID)); err != nil && !os.IsNotExist(err) {
+			m.log.WarnWithFields("Failed to remove config snapshot", logger.Fields{
+				"id":    snapshot.ID,
+				"error": err,
+			})
+		}
+	}
+}
+
+// ListSnapshots 按时间倒序列出配置快照
+func (m *Manager) ListSnapshots() ([]*ConfigSnapshot, error) {
+	entries, err := os.ReadDir(m.SnapshotDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*ConfigSnapshot{}, nil
+		}
+		return nil, fmt.Errorf("failed to read snapshot directory: %v", err)
+	}
+
+	snapshots := make([]*ConfigSnapshot, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		snapshot, ok := parseSnapshotID(strings.TrimSuffix(entry.Name(), ".json"))
+		if !ok {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			snapshot.Size = info.Size()
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// ReadSnapshot 读取配置快照内容
+func (m *Manager) ReadSnapshot(id string) ([]byte, error) {
+	if _, ok := parseSnapshotID(id); !ok {
+		return nil, ErrSnapshotNotFound
+	}
+	data, err := os.ReadFile(m.snapshotPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSnapshotNotFound
+		}
+		return nil, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+	return data, nil
+}
+
+// RestoreSnapshot 将快照恢复为自定义配置并启用，Xray 正在运行时重启以应用
+func (m *Manager) RestoreSnapshot(id string) error {
+	data, err := m.ReadSnapshot(id)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(bytes.TrimSpace(data)) {
+		return fmt.Errorf("snapshot %s is not valid JSON", id)
+	}
+
+	path := m.RestoredConfigPath()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write restored config: %v", err)
+	}
+
+	s := m.settings.Clone()
+	s.Xray.CustomConfig = true
+	s.Xray.ConfigPath = path
+	if err := m.settings.Update(s); err != nil {
+		return fmt.Errorf("failed to update xray settings: %v", err)
+	}
+
+	m.log.WithFields("Restored Xray config from snapshot", logger.Fields{
+		"id":   id,
+		"path": path,
+	})
+
+	if m.IsRunning() {
+		if err := m.Stop(); err != nil {
+			return fmt.Errorf("failed to stop xray: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+		if err := m.Start(); err != nil {
+			return fmt.Errorf("failed to restart xray: %v", err)
+		}
+	}
+	return nil
+}
+
+// snapshotPath 返回快照文件路径
+func (m *Manager) snapshotPath(id string) string {
+	return filepath.Join(m.SnapshotDir(), id+".json")
+}
+
+// parseSnapshotID 从快照 ID（时间-校验和前缀）解析创建时间，同时防止路径穿越
+func parseSnapshotID(id string) (*ConfigSnapshot, bool) {
+	i := strings.LastIndex(id, "-")
+	if i < 0 {
+		return nil, false
+	}
+	createdAt, err := time.Parse(snapshotTimeLayout, id[:i])
+	if err != nil {
+		return nil, false
+	}
+	prefix := id[i+1:]
+	if _, err := hex.DecodeString(prefix); err != nil || prefix == "" {
+		return nil, false
+	}
+	return &ConfigSnapshot{ID: id, CreatedAt: createdAt, Checksum: prefix}, true
+}
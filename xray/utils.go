@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -169,3 +170,33 @@ func getFileSize(path string) string {
 
 	return fmt.Sprintf("%.2f %s", size, units[unit])
 }
+
+// CompareVersions 比较两个 vX.Y.Z 形式的版本号，a 较新时返回正数，较旧时返回负数，无法解析的部分按 0 处理
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// LatestVersion 返回支持的版本中最新的版本
+func LatestVersion() string {
+	latest := ""
+	for _, v := range SupportedVersions {
+		if latest == "" || CompareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}